@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"q/llm"
+	"q/theme"
+
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// explainMorePrompt is the follow-up the e action asks
+const explainMorePrompt = "Explain that in more detail."
+
+// action is a key the action bar offers after an answer
+type action struct {
+	key, label string
+}
+
+// actions are what the bar offers for the latest answer: running it only
+// when it has a command
+func (m model) actions() []action {
+	actions := []action{{"r", "regenerate"}, {"c", "copy"}, {"e", "explain more"}}
+	if m.latestCommandResponse != "" {
+		actions = append(actions, action{"x", "run"})
+	}
+	return append(actions, action{"f", "follow up"}, action{"enter", "copy & quit"}, action{"esc", "quit"})
+}
+
+// actionBar shows the keys that act on the answer
+func (m model) actionBar() string {
+	keyStyle := lipgloss.NewStyle().Foreground(theme.Accent()).Bold(true)
+	labelStyle := lipgloss.NewStyle().Faint(true)
+	var parts []string
+	for _, a := range m.actions() {
+		parts = append(parts, keyStyle.Render(a.key)+" "+labelStyle.Render(a.label))
+	}
+	return "  " + strings.Join(parts, labelStyle.Render(" · "))
+}
+
+// handleActionKey acts on a key pressed at the action bar. Any other text
+// starts a follow-up question, as if f had been pressed first.
+func (m model) handleActionKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.Type == tea.KeySpace || msg.Type == tea.KeyRunes && len(msg.Runes) > 1 {
+		return m.followUp(msg)
+	}
+	if msg.Type != tea.KeyRunes {
+		return m, nil
+	}
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	switch msg.Runes[0] {
+	case 'r':
+		m.state = Loading
+		m.waitStart = time.Now()
+		m.waitModel = m.client.Model()
+		message := dimStyle.Width(m.maxWidth).Render("> " + m.query + " (regenerated)")
+		return m, tea.Sequence(tea.Printf("%s", message), tea.Batch(m.spinner.Tick, regenerateAnswer(m.client)))
+	case 'c':
+		text, what := m.latestCommandResponse, "Copied the code to the clipboard."
+		if text == "" {
+			text, what = m.latestResponse, "Copied the answer to the clipboard."
+		}
+		if err := clipboard.WriteAll(text); err != nil {
+			what = "Failed to copy to the clipboard: " + err.Error()
+		}
+		return m, tea.Printf("%s", dimStyle.Render("  "+what))
+	case 'e':
+		return m.ask(explainMorePrompt)
+	case 'x':
+		if m.latestCommandResponse == "" {
+			return m, nil
+		}
+		run := &runAction{command: m.latestCommandResponse}
+		return m, tea.Exec(run, func(err error) tea.Msg { return commandRanMsg{run} })
+	case 'f':
+		m.state = RecevingInput
+		return m, textinput.Blink
+	}
+	return m.followUp(msg)
+}
+
+// followUp switches to the input to ask a follow-up, starting with key
+func (m model) followUp(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.state = RecevingInput
+	var cmd tea.Cmd
+	m.textInput, cmd = m.textInput.Update(key)
+	return m, tea.Batch(cmd, m.drafts.changed())
+}
+
+// ask sends a question in the session, echoing it like a typed one
+func (m model) ask(query string) (tea.Model, tea.Cmd) {
+	m.textInput.SetValue("")
+	m.query = query
+	m.state = Loading
+	m.waitStart = time.Now()
+	m.waitModel = m.client.NextModel(query)
+	placeholderStyle := lipgloss.NewStyle().Faint(true).Width(m.maxWidth)
+	message := placeholderStyle.Render(fmt.Sprintf("> %s", query))
+	return m, tea.Sequence(tea.Printf("%s", message), tea.Batch(m.spinner.Tick, makeQuery(m.client, m.contextIndex, query)))
+}
+
+// regenerateAnswer asks the last question again, as the r action does
+func regenerateAnswer(client *llm.LLMClient) tea.Cmd {
+	return func() tea.Msg {
+		response, err := client.Regenerate(regenerateTemperature)
+		return responseMsg{response: response, err: err, citations: client.LastEntry().Citations}
+	}
+}
+
+// runAction runs the answer's command for the x action, once confirmed, with
+// the terminal handed over from the session
+type runAction struct {
+	command string
+	ran     bool
+	result  runResult
+	err     error
+}
+
+func (r *runAction) Run() error {
+	fmt.Println()
+	if !confirmRun(r.command, "Run it?") {
+		return nil
+	}
+	r.ran = true
+	r.result, r.err = runShellCommand(r.command, nil)
+	return r.err
+}
+
+func (r *runAction) SetStdin(io.Reader)  {}
+func (r *runAction) SetStdout(io.Writer) {}
+func (r *runAction) SetStderr(io.Writer) {}
+
+// commandRanMsg reports how the x action's command went
+type commandRanMsg struct{ run *runAction }
+
+func (m model) handleCommandRanMsg(msg commandRanMsg) (tea.Model, tea.Cmd) {
+	run := msg.run
+	if !run.ran {
+		return m, nil
+	}
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	switch {
+	case run.err != nil:
+		return m, tea.Printf("%s", lipgloss.NewStyle().Foreground(theme.Error()).Render("  Error: "+run.err.Error()))
+	case run.result.exitCode != 0:
+		return m, tea.Printf("%s", dimStyle.Render(fmt.Sprintf("  Exited with %d.", run.result.exitCode)))
+	}
+	return m, tea.Printf("%s", dimStyle.Render("  Done."))
+}
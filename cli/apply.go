@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/patch"
+	"q/theme"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	applyDryRun bool
+	applyYes    bool
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply [id|file|-]",
+	Short: "Apply the file edits in an answer, after a preview",
+	Long: `Find the file edits in an answer, as unified diffs or SEARCH/REPLACE blocks,
+preview them as a colored diff, and apply them once you agree. The answer is
+the latest logged one unless you give a log ID, a file, or - for stdin.
+
+Either every file is changed or none is. The files are backed up first to
+~/.shell-ai/backups/<time>/, under their full paths.
+
+  q apply --dry-run
+  q apply 3f9a2c1b
+  pbpaste | q apply - --yes`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runApplyCommand,
+}
+
+func init() {
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "Only preview the changes")
+	applyCmd.Flags().BoolVarP(&applyYes, "yes", "y", false, "Apply without asking")
+	RootCmd.AddCommand(applyCmd)
+}
+
+func runApplyCommand(cmd *cobra.Command, args []string) {
+	source := "last"
+	if len(args) > 0 {
+		source = args[0]
+	}
+	text, err := readApplySource(source)
+	if err != nil {
+		applyFail(err.Error())
+	}
+	edits, err := patch.Parse(text)
+	if err != nil {
+		applyFail(err.Error())
+	}
+	if len(edits) == 0 {
+		applyFail("the answer has no diffs or SEARCH/REPLACE blocks to apply")
+	}
+
+	var results []*patch.Result
+	for _, edit := range edits {
+		result, err := prepareEdit(edit)
+		if err != nil {
+			applyFail(err.Error() + "; nothing was changed")
+		}
+		results = append(results, result)
+	}
+	printPreview(results)
+	if applyDryRun {
+		return
+	}
+
+	styleDim := lipgloss.NewStyle().Faint(true)
+	if !applyYes {
+		if !util.IsTerminal(os.Stdin) {
+			applyFail("pass --yes to apply without asking")
+		}
+		if !askYesNo("Apply these changes?") {
+			fmt.Fprintln(os.Stderr, styleDim.Render("Nothing was changed."))
+			return
+		}
+	}
+	configPath, err := config.Path()
+	if err != nil {
+		applyFail(err.Error())
+	}
+	backupDir := filepath.Join(filepath.Dir(configPath), "backups", time.Now().Format("20060102-150405"))
+	if err := patch.Write(results, backupDir); err != nil {
+		applyFail(err.Error())
+	}
+	fmt.Println(lipgloss.NewStyle().Foreground(theme.Success()).Render(fmt.Sprintf("✓ Changed %d file(s)", len(results))) +
+		styleDim.Render(" · backups in "+backupDir))
+}
+
+// readApplySource reads an answer from stdin, a file, or the log
+func readApplySource(source string) (string, error) {
+	if source == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+	if _, err := os.Stat(source); err == nil {
+		data, err := os.ReadFile(source)
+		return string(data), err
+	}
+	entry, err := loadLoggedEntry(source)
+	if err != nil {
+		return "", err
+	}
+	return entry.Response, nil
+}
+
+// prepareEdit checks an edit stays in the current directory and works it out
+// against the file
+func prepareEdit(edit patch.FileEdit) (*patch.Result, error) {
+	path := filepath.Clean(edit.Path)
+	if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is outside the current directory", edit.Path)
+	}
+	edit.Path = path
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err) && !edit.Create:
+		return nil, fmt.Errorf("%s doesn't exist", path)
+	case err != nil && !os.IsNotExist(err):
+		return nil, err
+	}
+	return edit.Apply(string(data))
+}
+
+// printPreview shows each file's changes as a colored diff
+func printPreview(results []*patch.Result) {
+	fileStyle := lipgloss.NewStyle().Bold(true)
+	removedStyle := lipgloss.NewStyle().Foreground(theme.Error())
+	addedStyle := lipgloss.NewStyle().Foreground(theme.Success())
+	hunkStyle := lipgloss.NewStyle().Foreground(theme.Info())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+
+	added, removed := 0, 0
+	for _, result := range results {
+		name := result.Edit.Path
+		switch {
+		case result.Edit.Delete:
+			name += dimStyle.Render(" (deleted)")
+		case result.Before == "" && result.Edit.Create:
+			name += dimStyle.Render(" (new)")
+		}
+		fmt.Println(fileStyle.Render(name))
+		for _, hunk := range result.Hunks {
+			fmt.Println(hunkStyle.Render(patch.HunkHeader(hunk)))
+			for _, op := range hunk {
+				line := string(op.Kind) + op.Text
+				switch op.Kind {
+				case '-':
+					removed++
+					fmt.Println(removedStyle.Render(line))
+				case '+':
+					added++
+					fmt.Println(addedStyle.Render(line))
+				default:
+					fmt.Println(line)
+				}
+			}
+		}
+		fmt.Println()
+	}
+	fmt.Println(dimStyle.Render(fmt.Sprintf("%d file(s), ", len(results))) +
+		addedStyle.Render(fmt.Sprintf("+%d", added)) + " " + removedStyle.Render(fmt.Sprintf("-%d", removed)))
+}
+
+func applyFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(exitStatus)
+}
@@ -0,0 +1,285 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"q/config"
+	"q/llm"
+	"q/logger"
+	"q/theme"
+	. "q/types"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	batchWorkers int
+	batchRate    float64
+	batchOut     string
+	batchAsync   bool
+)
+
+// batchLogSize is how many answers are logged per transaction during a batch
+const batchLogSize = 50
+
+var batchCmd = &cobra.Command{
+	Use:   "batch <prompts-file>",
+	Short: "Run many prompts concurrently and write the results as JSONL",
+	Long: `Run every prompt in a file against the default model. The file has one
+prompt per line, or one JSON object per line with a "prompt" field (and an
+optional "id"). Use - to read from stdin. Each prompt is answered on its own,
+without follow-up context, and results are written as JSON lines.
+
+With --async the prompts are submitted to OpenAI's Batch API instead, which
+finishes within 24 hours at half the price. Check on it with ` + "`q batch status`" + `
+and collect the results with ` + "`q batch fetch <id>`" + `.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runBatchCommand,
+}
+
+func init() {
+	batchCmd.Flags().IntVarP(&batchWorkers, "workers", "j", 4, "Number of prompts to run at once")
+	batchCmd.Flags().Float64Var(&batchRate, "rate", 0, "Maximum requests started per second (0 for no limit)")
+	batchCmd.Flags().StringVarP(&batchOut, "out", "o", "", "Results file (default: stdout)")
+	batchCmd.Flags().BoolVar(&debugFlag, "debug", false, "Log the exact request JSON and raw response of each prompt")
+	batchCmd.Flags().BoolVar(&noRouteFlag, "no-route", false, "Always use the default model, ignoring routing preferences")
+	batchCmd.Flags().BoolVar(&batchAsync, "async", false, "Submit to the OpenAI Batch API (cheaper, results within 24h)")
+	batchFetchCmd.Flags().StringVarP(&batchOut, "out", "o", "", "Results file (default: stdout)")
+	batchCmd.AddCommand(batchStatusCmd, batchFetchCmd)
+	RootCmd.AddCommand(batchCmd)
+}
+
+// batchPrompt is one line of the input file
+type batchPrompt struct {
+	ID     string `json:"id,omitempty"`
+	Prompt string `json:"prompt"`
+	line   int
+}
+
+// batchResult is one line of the results file
+type batchResult struct {
+	ID           string  `json:"id,omitempty"`
+	Line         int     `json:"line"`
+	Prompt       string  `json:"prompt"`
+	Response     string  `json:"response,omitempty"`
+	Error        string  `json:"error,omitempty"`
+	Model        string  `json:"model"`
+	RequestID    string  `json:"request_id,omitempty"`
+	DurationMs   int64   `json:"duration_ms"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"estimated_cost"`
+}
+
+// readBatchPrompts parses plain-text or JSONL prompts, skipping blank lines
+func readBatchPrompts(r io.Reader) ([]batchPrompt, error) {
+	var prompts []batchPrompt
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		prompt := batchPrompt{Prompt: text, line: line}
+		if strings.HasPrefix(text, "{") {
+			if err := json.Unmarshal([]byte(text), &prompt); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if strings.TrimSpace(prompt.Prompt) == "" {
+				return nil, fmt.Errorf("line %d: missing \"prompt\"", line)
+			}
+		}
+		prompts = append(prompts, prompt)
+	}
+	return prompts, scanner.Err()
+}
+
+func runBatchCommand(cmd *cobra.Command, args []string) {
+	var input io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			batchFail(err.Error())
+		}
+		defer f.Close()
+		input = f
+	}
+	prompts, err := readBatchPrompts(input)
+	if err != nil {
+		batchFail("failed to read prompts: " + err.Error())
+	}
+	if len(prompts) == 0 {
+		batchFail("no prompts found in " + args[0])
+	}
+	if batchWorkers < 1 {
+		batchWorkers = 1
+	}
+	if batchAsync {
+		_, modelConfig := loadModelConfig()
+		submitAsyncBatch(modelConfig, prompts)
+		return
+	}
+
+	out := os.Stdout
+	if batchOut != "" {
+		out, err = os.Create(batchOut)
+		if err != nil {
+			batchFail("failed to create results file: " + err.Error())
+		}
+		defer out.Close()
+	}
+
+	appConfig, modelConfig := loadModelConfig()
+	results := runBatch(appConfig, modelConfig, prompts, out)
+	printBatchSummary(results, modelConfig.ModelName)
+
+	for _, result := range results {
+		if result.Error != "" {
+			os.Exit(1)
+		}
+	}
+}
+
+// runBatch answers prompts with a pool of workers, writing each result as soon as it is done
+func runBatch(appConfig config.AppConfig, modelConfig ModelConfig, prompts []batchPrompt, out io.Writer) []batchResult {
+	var limiter <-chan time.Time
+	if batchRate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / batchRate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	jobs := make(chan batchPrompt)
+	var (
+		mu      sync.Mutex
+		results []batchResult
+		wg      sync.WaitGroup
+	)
+	encoder := json.NewEncoder(out)
+	started := time.Now()
+	route := modelRouter(appConfig)
+
+	// Write the log in transactions of batchLogSize responses rather than one each
+	if reqLogger, err := logger.Shared(); err == nil {
+		reqLogger.Buffer(batchLogSize)
+		defer func() {
+			if err := reqLogger.Buffer(0); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to write log: %v\n", err)
+			}
+		}()
+	}
+
+	for i := 0; i < batchWorkers && i < len(prompts); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := llm.NewLLMClient(modelConfig)
+			client.Persona = personaFlag
+			client.Debug = debugFlag
+			client.ErrorLog = appConfig.Preferences.ErrorLog
+			for prompt := range jobs {
+				client.Reset()
+				client.ConversationID = ""
+				client.Route = route
+				response, err := client.Query(prompt.Prompt)
+				entry := client.LastEntry()
+				result := batchResult{
+					ID:           prompt.ID,
+					Line:         prompt.line,
+					Prompt:       prompt.Prompt,
+					Response:     response,
+					Model:        client.Model(),
+					RequestID:    entry.RequestID,
+					DurationMs:   entry.DurationMs,
+					InputTokens:  entry.PromptTokens,
+					OutputTokens: entry.CompletionTokens,
+					Cost:         entry.EstimatedCost,
+				}
+				if err != nil {
+					result.Error = err.Error()
+				}
+
+				mu.Lock()
+				results = append(results, result)
+				if err := encoder.Encode(result); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to write result: %v\n", err)
+				}
+				fmt.Fprintf(os.Stderr, "\r%d/%d done (%s)", len(results), len(prompts), time.Since(started).Round(time.Second))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, prompt := range prompts {
+		if limiter != nil {
+			<-limiter
+		}
+		jobs <- prompt
+	}
+	close(jobs)
+	wg.Wait()
+	fmt.Fprintln(os.Stderr)
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Line < results[j].Line })
+	return results
+}
+
+func printBatchSummary(results []batchResult, model string) {
+	labelStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+
+	var (
+		failed               int
+		cost                 float64
+		inputTokens, outputs int
+		durations            []int64
+	)
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+		cost += result.Cost
+		inputTokens += result.InputTokens
+		outputs += result.OutputTokens
+		durations = append(durations, result.DurationMs)
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	fmt.Fprintln(os.Stderr, labelStyle.Render("Batch summary")+" ("+model+")")
+	fmt.Fprintf(os.Stderr, "  Prompts:  %d (%d succeeded", len(results), len(results)-failed)
+	if failed > 0 {
+		fmt.Fprint(os.Stderr, ", "+styleRed.Render(fmt.Sprintf("%d failed", failed)))
+	}
+	fmt.Fprintln(os.Stderr, ")")
+	fmt.Fprintf(os.Stderr, "  Tokens:   %d in, %d out\n", inputTokens, outputs)
+	fmt.Fprintf(os.Stderr, "  Cost:     $%.6f\n", cost)
+	// Batch API results carry no per-request latency
+	if len(durations) > 0 && durations[len(durations)-1] > 0 {
+		fmt.Fprintf(os.Stderr, "  Latency:  p50 %dms, p95 %dms, max %dms\n",
+			percentile(durations, 50), percentile(durations, 95), durations[len(durations)-1])
+	}
+}
+
+// percentile returns the p-th percentile of sorted values (nearest rank)
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/llm"
+	"q/logger"
+	"q/theme"
+	. "q/types"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var batchStatusCmd = &cobra.Command{
+	Use:   "status [batch-id]",
+	Short: "Show the status of Batch API jobs submitted with --async",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runBatchStatusCommand,
+}
+
+var batchFetchCmd = &cobra.Command{
+	Use:   "fetch <batch-id>",
+	Short: "Download the results of a finished Batch API job and add them to the logs",
+	Args:  cobra.ExactArgs(1),
+	Run:   runBatchFetchCommand,
+}
+
+// submitAsyncBatch sends the prompts to the Batch API and records the job locally
+func submitAsyncBatch(modelConfig ModelConfig, prompts []batchPrompt) {
+	reqLogger := openBatchLogger()
+	defer reqLogger.Close()
+
+	requests := make([]BatchRequest, 0, len(prompts))
+	seen := make(map[string]bool)
+	for _, prompt := range prompts {
+		customID := prompt.ID
+		if customID == "" || seen[customID] {
+			customID = fmt.Sprintf("line-%d", prompt.line)
+		}
+		seen[customID] = true
+		messages := append(llm.Prompt(modelConfig), Message{Role: "user", Content: prompt.Prompt})
+		requests = append(requests, BatchRequest{CustomID: customID, ID: prompt.ID, Line: prompt.line, Messages: messages})
+	}
+
+	client := llm.NewLLMClient(modelConfig)
+	job, err := client.SubmitBatch(requests)
+	if err != nil {
+		batchFail("failed to submit batch: " + requestError(err))
+	}
+	err = reqLogger.SaveBatch(BatchRecord{
+		ID:        job.ID,
+		Model:     modelConfig.ModelName,
+		Endpoint:  modelConfig.Endpoint,
+		Status:    job.Status,
+		CreatedAt: time.Now(),
+		Requests:  requests,
+	})
+	if err != nil {
+		batchFail(fmt.Sprintf("batch %s was submitted but could not be recorded: %v", job.ID, err))
+	}
+
+	fmt.Printf("Submitted %d prompts as batch %s (%s).\n", len(requests), job.ID, job.Status)
+	fmt.Printf("Check on it with `q batch status %s` and collect results with `q batch fetch %s`.\n", job.ID, job.ID)
+}
+
+func runBatchStatusCommand(cmd *cobra.Command, args []string) {
+	reqLogger := openBatchLogger()
+	defer reqLogger.Close()
+
+	var records []BatchRecord
+	if len(args) == 1 {
+		record, err := reqLogger.GetBatch(args[0])
+		if err != nil {
+			batchFail(err.Error())
+		}
+		records = append(records, record)
+	} else {
+		var err error
+		records, err = reqLogger.ListBatches(20)
+		if err != nil {
+			batchFail("failed to read batches: " + err.Error())
+		}
+		if len(records) == 0 {
+			fmt.Println("No batch jobs yet. Submit one with `q batch --async prompts.txt`.")
+			return
+		}
+	}
+
+	appConfig, _ := loadModelConfig()
+	idStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	dimStyle := lipgloss.NewStyle().Foreground(theme.Muted())
+	for _, record := range records {
+		status := record.Status
+		progress := ""
+		if !record.ImportedAt.IsZero() {
+			status = "imported"
+		} else if !llm.IsFinalBatchStatus(record.Status) {
+			client, err := batchClient(appConfig, record)
+			if err == nil {
+				var job BatchJob
+				if job, err = client.GetBatch(record.ID); err == nil {
+					status = job.Status
+					progress = fmt.Sprintf(" %d/%d done", job.RequestCounts.Completed+job.RequestCounts.Failed, job.RequestCounts.Total)
+					if job.RequestCounts.Failed > 0 {
+						progress += fmt.Sprintf(", %d failed", job.RequestCounts.Failed)
+					}
+					reqLogger.UpdateBatchStatus(record.ID, job.Status)
+				}
+			}
+			if err != nil {
+				progress = " (could not refresh: " + err.Error() + ")"
+			}
+		}
+		fmt.Printf("%s  %s%s\n", idStyle.Render(record.ID), status, progress)
+		fmt.Println(dimStyle.Render(fmt.Sprintf("  %s · %d prompts · submitted %s",
+			record.Model, len(record.Requests), record.CreatedAt.Local().Format("2006-01-02 15:04"))))
+	}
+}
+
+func runBatchFetchCommand(cmd *cobra.Command, args []string) {
+	reqLogger := openBatchLogger()
+	defer reqLogger.Close()
+
+	record, err := reqLogger.GetBatch(args[0])
+	if err != nil {
+		batchFail(err.Error())
+	}
+	appConfig, _ := loadModelConfig()
+	client, err := batchClient(appConfig, record)
+	if err != nil {
+		batchFail(err.Error())
+	}
+	job, err := client.GetBatch(record.ID)
+	if err != nil {
+		batchFail("failed to get batch status: " + err.Error())
+	}
+	reqLogger.UpdateBatchStatus(record.ID, job.Status)
+	if !llm.IsFinalBatchStatus(job.Status) {
+		fmt.Printf("Batch %s is %s (%d/%d done), try again later.\n",
+			job.ID, job.Status, job.RequestCounts.Completed+job.RequestCounts.Failed, job.RequestCounts.Total)
+		os.Exit(1)
+	}
+
+	outputs, err := client.BatchOutputs(job)
+	if err != nil {
+		batchFail(err.Error())
+	}
+	results, entries := batchResults(record, job, outputs)
+
+	out := os.Stdout
+	if batchOut != "" {
+		out, err = os.Create(batchOut)
+		if err != nil {
+			batchFail("failed to create results file: " + err.Error())
+		}
+		defer out.Close()
+	}
+	encoder := json.NewEncoder(out)
+	for _, result := range results {
+		encoder.Encode(result)
+	}
+
+	if record.ImportedAt.IsZero() {
+		if err := reqLogger.ImportBatch(record.ID, entries); err != nil {
+			batchFail("failed to import results into the logs: " + err.Error())
+		}
+		fmt.Fprintf(os.Stderr, "Imported %d results into the logs.\n", len(entries))
+	}
+	printBatchSummary(results, record.Model)
+}
+
+// batchResults matches Batch API output lines to the submitted prompts
+func batchResults(record BatchRecord, job BatchJob, outputs []BatchOutput) ([]batchResult, []LogEntry) {
+	byCustomID := make(map[string]BatchOutput, len(outputs))
+	for _, output := range outputs {
+		byCustomID[output.CustomID] = output
+	}
+	finished := time.Now().UTC()
+	if job.CompletedAt > 0 {
+		finished = time.Unix(job.CompletedAt, 0).UTC()
+	}
+
+	var results []batchResult
+	var entries []LogEntry
+	for _, request := range record.Requests {
+		output, ok := byCustomID[request.CustomID]
+		if !ok {
+			continue
+		}
+		entry := LogEntry{
+			Timestamp: finished,
+			Model:     record.Model,
+			Messages:  request.Messages,
+			BatchID:   record.ID,
+		}
+		switch {
+		case output.Response != nil && output.Response.StatusCode == 200:
+			body := output.Response.Body
+			if len(body.Choices) > 0 {
+				entry.Response = body.Choices[0].Message.Content
+			}
+			entry.RequestID = body.ID
+			entry.PromptTokens = body.Usage.PromptTokens
+			entry.CompletionTokens = body.Usage.CompletionTokens
+			entry.TotalTokens = body.Usage.TotalTokens
+			entry.EstimatedCost = logger.CalculateCost(record.Model, entry.PromptTokens, entry.CompletionTokens) * logger.BatchPriceFactor
+		case output.Error != nil:
+			entry.Error = output.Error.Message
+		case output.Response != nil:
+			entry.RequestID = output.Response.RequestID
+			entry.Error = fmt.Sprintf("API request failed: status %d", output.Response.StatusCode)
+		default:
+			entry.Error = "no response in batch output"
+		}
+		entries = append(entries, entry)
+
+		prompt := ""
+		if len(request.Messages) > 0 {
+			prompt = request.Messages[len(request.Messages)-1].Content
+		}
+		results = append(results, batchResult{
+			ID:           request.ID,
+			Line:         request.Line,
+			Prompt:       prompt,
+			Response:     entry.Response,
+			Error:        entry.Error,
+			Model:        record.Model,
+			RequestID:    entry.RequestID,
+			InputTokens:  entry.PromptTokens,
+			OutputTokens: entry.CompletionTokens,
+			Cost:         entry.EstimatedCost,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Line < results[j].Line })
+	return results, entries
+}
+
+// batchClient builds a client for the model and endpoint a batch was submitted with
+func batchClient(appConfig config.AppConfig, record BatchRecord) (*llm.LLMClient, error) {
+	modelConfig, err := findModelConfig(appConfig, record.Model)
+	if err != nil {
+		return nil, err
+	}
+	modelConfig.Endpoint = record.Endpoint
+	return llm.NewLLMClient(modelConfig), nil
+}
+
+func openBatchLogger() *logger.RequestLogger {
+	reqLogger, err := logger.NewRequestLogger()
+	if err != nil {
+		batchFail("failed to open logs database: " + err.Error())
+	}
+	return reqLogger
+}
+
+func batchFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
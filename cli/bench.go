@@ -0,0 +1,301 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/llm"
+	"q/logger"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// benchPrompt is the standard prompt q bench sends: small, with a short
+// answer of about the same length from any model
+const benchPrompt = "List three common options of the ls command, one per line, with a few words on each."
+
+var (
+	benchRuns       int
+	benchPromptFlag string
+	benchJSON       bool
+	benchDays       int
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench [model...]",
+	Short: "Measure the latency, speed, reliability and cost of the configured models",
+	Long: `Send a small standard prompt to every configured model, or the ones named,
+a few times each, and report how long the first token of the answer took
+(TTFT), how fast the rest streamed in tokens per second, how many requests
+failed, and what they cost. The model with the lowest TTFT feels fastest in
+interactive use.
+
+Models are run one after another, so they don't slow each other down. The
+requests are logged like any other, and the results are kept in the logs
+database for q bench history.`,
+	Run: runBenchCommand,
+}
+
+var benchHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the results of earlier benchmarks",
+	Args:  cobra.NoArgs,
+	Run:   runBenchHistoryCommand,
+}
+
+func init() {
+	benchCmd.Flags().IntVarP(&benchRuns, "runs", "n", 3, "How many times to send the prompt to each model")
+	benchCmd.Flags().StringVar(&benchPromptFlag, "prompt", benchPrompt, "The prompt to send")
+	benchCmd.PersistentFlags().BoolVar(&benchJSON, "json", false, "Output in JSON format")
+	benchHistoryCmd.Flags().IntVar(&benchDays, "days", 0, "Show every run of the last this many days, instead of each model's latest")
+	benchCmd.AddCommand(benchHistoryCmd)
+	RootCmd.AddCommand(benchCmd)
+}
+
+func runBenchCommand(cmd *cobra.Command, args []string) {
+	if benchRuns < 1 {
+		benchFail("--runs must be at least 1")
+	}
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		config.PrintConfigErrorMessage(err)
+		os.Exit(exitStatus)
+	}
+	models := appConfig.Models
+	if len(args) > 0 {
+		models = nil
+		for _, name := range args {
+			found := false
+			for _, model := range appConfig.Models {
+				if model.ModelName == name {
+					models, found = append(models, model), true
+					break
+				}
+			}
+			if !found {
+				benchFail(fmt.Sprintf("model %s is not in your config", name))
+			}
+		}
+	}
+
+	reqLogger, logErr := logger.Shared()
+	var results []Benchmark
+	for _, model := range models {
+		if !benchJSON {
+			fmt.Fprintf(util.Notes(), "Benchmarking %s…\n", model.ModelName)
+		}
+		result := benchModel(model, benchPromptFlag, benchRuns)
+		results = append(results, result)
+		if logErr == nil {
+			if err := reqLogger.SaveBenchmark(result); err != nil {
+				fmt.Fprintf(util.Notes(), "Warning: the results of %s weren't saved: %v\n", model.ModelName, err)
+			}
+		}
+	}
+
+	if benchJSON {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	printBenchmarks(results, false)
+}
+
+// benchModel sends the prompt to a model runs times, one at a time
+func benchModel(model ModelConfig, prompt string, runs int) Benchmark {
+	result := Benchmark{Model: model.ModelName, Time: time.Now(), Runs: runs}
+	modelConfig, err := applyModel(model)
+	if err == nil {
+		modelConfig, err = resolveAuth(modelConfig)
+	}
+	if err != nil {
+		result.Failures, result.Error = runs, err.Error()
+		return result
+	}
+
+	var ttfts, durations []int64
+	var speeds []float64
+	for i := 0; i < runs; i++ {
+		client := llm.NewLLMClient(modelConfig)
+		client.ConversationID = ""
+		var first time.Time
+		client.StreamHandler = llm.StreamFuncs{Token: func(text string) {
+			if first.IsZero() && text != "" {
+				first = time.Now()
+			}
+		}}
+		start := time.Now()
+		_, err := client.Query(prompt)
+		end := time.Now()
+		entry := client.LastEntry()
+		result.Cost += entry.EstimatedCost
+		if err != nil {
+			result.Failures++
+			result.Error = err.Error()
+			continue
+		}
+		if first.IsZero() {
+			first = end
+		}
+		ttfts = append(ttfts, first.Sub(start).Milliseconds())
+		durations = append(durations, end.Sub(start).Milliseconds())
+		if streaming := end.Sub(first).Seconds(); streaming > 0 && entry.CompletionTokens > 1 {
+			// The first token arrived at first, so the rest streamed after it
+			speeds = append(speeds, float64(entry.CompletionTokens-1)/streaming)
+		}
+	}
+	result.TTFTMs = medianInt(ttfts)
+	result.DurationMs = medianInt(durations)
+	result.TokensPerSec = medianFloat(speeds)
+	return result
+}
+
+func medianInt(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func medianFloat(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// printBenchmarks shows results fastest first, by time to first token, with
+// the models that always failed last
+func printBenchmarks(results []Benchmark, withDate bool) {
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	redStyle := lipgloss.NewStyle().Foreground(theme.Error())
+	greenStyle := lipgloss.NewStyle().Foreground(theme.Success())
+
+	sorted := append([]Benchmark(nil), results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		iFailed, jFailed := sorted[i].Failures == sorted[i].Runs, sorted[j].Failures == sorted[j].Runs
+		if iFailed != jFailed {
+			return jFailed
+		}
+		return sorted[i].TTFTMs < sorted[j].TTFTMs
+	})
+	width := len("Model")
+	for _, b := range sorted {
+		if len(b.Model) > width {
+			width = len(b.Model)
+		}
+	}
+
+	header := fmt.Sprintf("  %-*s  %8s  %8s  %9s  %8s  %9s", width, "Model", "TTFT", "Total", "Tokens/s", "Failed", "Cost")
+	if withDate {
+		header += "  Run"
+	}
+	fmt.Println(headerStyle.Render(header))
+	for i, b := range sorted {
+		name := fmt.Sprintf("%-*s", width, b.Model)
+		if i == 0 && b.Failures < b.Runs && distinctModels(sorted) {
+			name = greenStyle.Render(name)
+		}
+		failed := fmt.Sprintf("%d/%d", b.Failures, b.Runs)
+		if b.Failures > 0 {
+			failed = redStyle.Render(fmt.Sprintf("%8s", failed))
+		} else {
+			failed = fmt.Sprintf("%8s", failed)
+		}
+		line := fmt.Sprintf("  %s  %8s  %8s  %9s  %s  %9s", name,
+			benchTime(b.TTFTMs, b), benchTime(b.DurationMs, b), benchSpeed(b), failed, fmt.Sprintf("$%.4f", b.Cost))
+		if withDate {
+			line += "  " + dimStyle.Render(b.Time.Local().Format("2006-01-02 15:04"))
+		}
+		fmt.Println(line)
+		if b.Error != "" {
+			fmt.Println(dimStyle.Render("  " + strings.Repeat(" ", width) + "  last error: " + firstLine(b.Error)))
+		}
+	}
+	if len(sorted) > 1 && sorted[0].Failures < sorted[0].Runs && distinctModels(sorted) {
+		fmt.Printf("\n%s has the lowest time to first token, for interactive use.\n", greenStyle.Render(sorted[0].Model))
+	}
+}
+
+// distinctModels reports whether each result is of another model, so they
+// can be compared
+func distinctModels(results []Benchmark) bool {
+	seen := map[string]bool{}
+	for _, b := range results {
+		if seen[b.Model] {
+			return false
+		}
+		seen[b.Model] = true
+	}
+	return true
+}
+
+func benchTime(ms int64, b Benchmark) string {
+	if b.Failures == b.Runs {
+		return "-"
+	}
+	if ms < 1000 {
+		return fmt.Sprintf("%dms", ms)
+	}
+	return fmt.Sprintf("%.2fs", float64(ms)/1000)
+}
+
+func benchSpeed(b Benchmark) string {
+	if b.Failures == b.Runs || b.TokensPerSec == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f", b.TokensPerSec)
+}
+
+func runBenchHistoryCommand(cmd *cobra.Command, args []string) {
+	reqLogger, err := logger.Shared()
+	if err != nil {
+		benchFail(err.Error())
+	}
+	since, latest := time.Time{}, true
+	if benchDays > 0 {
+		since, latest = time.Now().AddDate(0, 0, -benchDays), false
+	}
+	results, err := reqLogger.Benchmarks(since, latest)
+	if err != nil {
+		benchFail(err.Error())
+	}
+	if benchJSON {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	if len(results) == 0 {
+		fmt.Println("No benchmarks yet; run q bench.")
+		return
+	}
+	printBenchmarks(results, true)
+}
+
+func benchFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
@@ -1,15 +1,27 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"q/config"
+	"q/exitcode"
+	"q/keychain"
 	"q/llm"
+	"q/logger"
+	"q/pkgmgr"
+	"q/provider"
+	"q/rag"
+	"q/router"
+	"q/sink"
+	"q/theme"
 	. "q/types"
 	"q/util"
 
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/spinner"
@@ -26,52 +38,112 @@ const (
 	Loading State = iota
 	RecevingInput
 	ReceivingResponse
+	// ChoosingAction shows the action bar after an answer
+	ChoosingAction
 )
 
 type model struct {
 	client           *llm.LLMClient
+	contextIndex     *rag.Index
+	tee              *responseTee
 	markdownRenderer *glamour.TermRenderer
 	p                *tea.Program
 
 	textInput textinput.Model
 	spinner   spinner.Model
+	// waitStart and waitModel describe the request the spinner is waiting on
+	waitStart time.Time
+	waitModel string
+	// showSpinner is off when stdout isn't a terminal
+	showSpinner bool
 
 	state                 State
 	query                 string
 	latestCommandResponse string
 	latestCommandIsCode   bool
+	latestResponse        string
 
-	formattedPartialResponse string
+	// partial renders the answer being received
+	partial *streamRenderer
+	// drafts saves what's typed, and restoredNote tells of a draft restored
+	// from an earlier session
+	drafts       *drafts
+	restoredNote string
+	// thinking is how reasoning is shown (llm.ThinkingHide, Dim or Show),
+	// and reasoning is that of the answer being received
+	thinking  string
+	reasoning string
 
 	maxWidth int
 
 	runWithArgs bool
-	err         error
+	// interrupting is set once Ctrl-C asked the client to stop the response
+	interrupting bool
+	err          error
 }
 
 type responseMsg struct {
-	response string
-	err      error
-}
-type partialResponseMsg struct {
-	content string
-	err     error
+	response  string
+	err       error
+	citations []CitedSource
 }
+type partialResponseMsg struct{ text string }
+type partialThinkingMsg struct{ reasoning string }
 type setPMsg struct{ p *tea.Program }
 
+var (
+	contextFlag string
+	urlFlags    []string
+	topKFlag    int
+	outputFlag  string
+	personaFlag string
+	debugFlag   bool
+	noRouteFlag bool
+	themeFlag   string
+	widthFlag   int
+	quietFlag   bool
+	prefillFlag string
+	stopAtCode  bool
+	shortFlag   bool
+	detailFlag  bool
+	langFlag    string
+	pmFlag      string
+	// showThinkingFlag is --show-thinking: hide, dim or show
+	showThinkingFlag string
+	// thinking is how the session shows reasoning (see thinkingMode)
+	thinking string
+)
+
 // === Commands === //
 
-func makeQuery(client *llm.LLMClient, query string) tea.Cmd {
+func makeQuery(client *llm.LLMClient, contextIndex *rag.Index, query string) tea.Cmd {
 	return func() tea.Msg {
+		client.Sources = nil
+		if contextIndex != nil {
+			results, err := contextIndex.Search(contextFlag, query, topKFlag)
+			if err != nil {
+				return responseMsg{err: fmt.Errorf("failed to search context: %w", err)}
+			}
+			query = rag.BuildPrompt(contextFlag, query, results)
+			client.Sources = rag.Sources(contextFlag, results)
+		}
+		attachEnv(client, query)
+		start := time.Now()
 		response, err := client.Query(query)
-		return responseMsg{response: response, err: err}
+		if err == nil {
+			finishPending(client.LastEntry().RequestID)
+		} else {
+			finishPending("")
+		}
+		notifyIfSlow(time.Since(start), response, err)
+		return responseMsg{response: response, err: err, citations: client.LastEntry().Citations}
 	}
 }
 
 // === Msg Handlers === //
 
 func (m model) handleKeyEnter() (tea.Model, tea.Cmd) {
-	if m.state != RecevingInput {
+	if m.state != RecevingInput && m.state != ChoosingAction {
 		return m, nil
 	}
 	v := m.textInput.Value()
@@ -95,23 +167,20 @@ func (m model) handleKeyEnter() (tea.Model, tea.Cmd) {
 		return m, tea.Sequence(tea.Printf("%s", message), tea.Quit)
 	}
 	// Input, run query.
-	m.textInput.SetValue("")
-	m.query = v
-	m.state = Loading
-	placeholderStyle := lipgloss.NewStyle().Faint(true).Width(m.maxWidth)
-	message := placeholderStyle.Render(fmt.Sprintf("> %s", v))
-	return m, tea.Sequence(tea.Printf("%s", message), tea.Batch(m.spinner.Tick, makeQuery(m.client, m.query)))
+	m.drafts.save(v, true)
+	return m.ask(v)
 }
 
-func (m model) formatResponse(response string, isCode bool) (string, error) {
-
-	// format nicely
+// formatResponse renders a response's markdown for the terminal, or shows it
+// as it is if it can't be rendered
+func (m model) formatResponse(response string, isCode bool) string {
 	formatted, err := m.markdownRenderer.Render(response)
 	if err != nil {
-		// TODO: handle error
-		panic(err)
+		formatted = response
 	}
 
+	formatted = theme.HangIndents(formatted, m.maxWidth)
+
 	// trim preceding and trailing newlines
 	formatted = strings.TrimPrefix(formatted, "\n")
 	formatted = strings.TrimSuffix(formatted, "\n")
@@ -120,14 +189,46 @@ func (m model) formatResponse(response string, isCode bool) (string, error) {
 	if !isCode {
 		formatted = "\n" + formatted
 	}
-	return formatted, nil
+	return formatted
+}
+
+// formatThinking renders the reasoning of the answer being received as the
+// thinking preference asks: faint with dim, plain with show, or not at all
+func (m model) formatThinking() string {
+	if m.reasoning == "" || (m.thinking != llm.ThinkingDim && m.thinking != llm.ThinkingShow) {
+		return ""
+	}
+	label := lipgloss.NewStyle().Faint(true).PaddingLeft(2).Render("Thinking")
+	style := lipgloss.NewStyle().Width(m.maxWidth).PaddingLeft(2)
+	if m.thinking == llm.ThinkingDim {
+		style = style.Faint(true).Italic(true)
+	}
+	return "\n" + label + "\n" + style.Render(m.reasoning) + "\n"
+}
+
+// citationFooter lists the attached sources the answer cited
+func citationFooter(citations []CitedSource, width int) string {
+	if len(citations) == 0 {
+		return ""
+	}
+	var cited []string
+	for _, citation := range citations {
+		if citation.Cited {
+			cited = append(cited, fmt.Sprintf("[%d] %s", citation.N, citation.Source))
+		}
+	}
+	styleDim := lipgloss.NewStyle().Faint(true).Width(width).PaddingLeft(2)
+	if len(cited) == 0 {
+		return "\n\n" + styleDim.Render(fmt.Sprintf("No sources cited (%d excerpts were provided).", len(citations)))
+	}
+	return "\n\n" + styleDim.Render("Sources:\n"+strings.Join(cited, "\n"))
 }
 
 // TODO: parse the model endpoint to infer whether it's openai, other, or local.
 // for local, suggest it may not be running, and how to run it
 func (m model) getConnectionError(err error) string {
-	styleRed := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
-	styleGreen := lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	styleGreen := lipgloss.NewStyle().Foreground(theme.Success())
 	styleDim := lipgloss.NewStyle().Faint(true).Width(m.maxWidth).PaddingLeft(2)
 	message := fmt.Sprintf("\n  %v\n\n%v\n",
 		styleRed.Render("Error: Failed to connect to OpenAI."),
@@ -145,12 +246,48 @@ func (m model) getConnectionError(err error) string {
 }
 
 func (m model) handleResponseMsg(msg responseMsg) (tea.Model, tea.Cmd) {
-	m.formattedPartialResponse = ""
+	m.partial = nil
+	m.tee.finish(msg.response)
+	if msg.err == nil || m.interrupting {
+		m.drafts.drop()
+	}
+	thinking := m.formatThinking()
+	m.reasoning = ""
+
+	m.err = msg.err
+	if m.interrupting {
+		m.err = llm.ErrInterrupted
+		styleDim := lipgloss.NewStyle().Faint(true).PaddingLeft(2)
+		message := styleDim.Render("Interrupted. The partial response was logged.")
+		if msg.response != "" {
+			formatted := m.formatResponse(msg.response, util.StartsWithCodeBlock(msg.response))
+			message = formatted + "\n\n" + message
+		}
+		return m, tea.Sequence(tea.Printf("%s", thinking+message), tea.Quit)
+	}
 
 	// error handling
 	if msg.err != nil {
 		m.state = RecevingInput
 		message := m.getConnectionError(msg.err)
+		if hint := conflictHint(msg.err, m.client.ConversationHead); hint != "" {
+			styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+			styleDim := lipgloss.NewStyle().Faint(true).Width(m.maxWidth).PaddingLeft(2)
+			message = fmt.Sprintf("\n  %v\n\n%v\n", styleRed.Render("Error: "+msg.err.Error()+"."), styleDim.Render(hint))
+		}
+		if errors.Is(msg.err, llm.ErrStalled) {
+			styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+			styleDim := lipgloss.NewStyle().Faint(true).Width(m.maxWidth).PaddingLeft(2)
+			message = fmt.Sprintf("\n  %v\n\n%v\n", styleRed.Render("Error: "+msg.err.Error()+"."), styleDim.Render("The partial response was logged. Set idle_timeout on the model if it's just slow."))
+			if msg.response != "" {
+				message = m.formatResponse(msg.response, util.StartsWithCodeBlock(msg.response)) + "\n" + message
+			}
+		}
+		if note := queueOffline(m.client, m.query, msg.err); note != "" {
+			m.drafts.drop()
+			styleDim := lipgloss.NewStyle().Faint(true).Width(m.maxWidth).PaddingLeft(2)
+			message = strings.TrimRight(message, "\n") + "\n\n" + styleDim.Render(note) + "\n"
+		}
 		return m, tea.Sequence(tea.Printf("%s", message), textinput.Blink)
 	}
 
@@ -160,11 +297,7 @@ func (m model) handleResponseMsg(msg responseMsg) (tea.Model, tea.Cmd) {
 		m.latestCommandResponse = content
 	}
 
-	formatted, err := m.formatResponse(msg.response, util.StartsWithCodeBlock(msg.response))
-	if err != nil {
-		// TODO: handle error
-		panic(err)
-	}
+	formatted := m.formatResponse(msg.response, util.StartsWithCodeBlock(msg.response))
 
 	m.textInput.Placeholder = "Follow up, ENTER to copy & quit, CTRL+C to quit"
 	if !isOnlyCode {
@@ -175,20 +308,21 @@ func (m model) handleResponseMsg(msg responseMsg) (tea.Model, tea.Cmd) {
 	}
 
 	m.state = RecevingInput
+	if m.showSpinner {
+		m.state = ChoosingAction
+	}
 	m.latestCommandIsCode = isOnlyCode
-	message := formatted
+	m.latestResponse = msg.response
+	message := thinking + formatted + citationFooter(msg.citations, m.maxWidth) + answerFooter(m.client.LastEntry(), footerFields, m.maxWidth)
 	return m, tea.Sequence(tea.Printf("%s", message), textinput.Blink)
 }
 
 func (m model) handlePartialResponseMsg(msg partialResponseMsg) (tea.Model, tea.Cmd) {
 	m.state = ReceivingResponse
-	isCode := util.StartsWithCodeBlock(msg.content)
-	formatted, err := m.formatResponse(msg.content, isCode)
-	if err != nil {
-		// TODO: handle error
-		panic(err)
+	if m.partial == nil {
+		m.partial = newStreamRenderer(func(block string) string { return m.formatResponse(block, true) })
 	}
-	m.formattedPartialResponse = formatted
+	m.partial.write(msg.text)
 	return m, nil
 }
 
@@ -196,7 +330,10 @@ func (m model) handlePartialResponseMsg(msg partialResponseMsg) (tea.Model, tea.
 
 func (m model) Init() tea.Cmd {
 	if m.runWithArgs {
-		return tea.Batch(m.spinner.Tick, makeQuery(m.client, m.query))
+		return tea.Batch(m.spinner.Tick, makeQuery(m.client, m.contextIndex, m.query))
+	}
+	if m.restoredNote != "" {
+		return tea.Batch(tea.Printf("%s", m.restoredNote), textinput.Blink)
 	}
 	return textinput.Blink
 }
@@ -208,11 +345,23 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.Type {
 		case tea.KeyCtrlC, tea.KeyEsc, tea.KeyCtrlD:
+			// Stop a response in flight first, so what arrived so far is shown and logged
+			if (m.state == Loading || m.state == ReceivingResponse) && !m.interrupting {
+				m.interrupting = true
+				m.client.Interrupt()
+				return m, nil
+			}
+			if m.state == RecevingInput {
+				m.drafts.save(m.textInput.Value(), false)
+			}
 			return m, tea.Quit
 
 		case tea.KeyEnter:
 			return m.handleKeyEnter()
 		}
+		if m.state == ChoosingAction {
+			return m.handleActionKey(msg)
+		}
 
 	case responseMsg:
 		return m.handleResponseMsg(msg)
@@ -220,10 +369,23 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case partialResponseMsg:
 		return m.handlePartialResponseMsg(msg)
 
+	case partialThinkingMsg:
+		m.reasoning = msg.reasoning
+		return m, nil
+
 	case setPMsg:
 		m.p = msg.p
 		return m, nil
 
+	case commandRanMsg:
+		return m.handleCommandRanMsg(msg)
+
+	case saveDraftMsg:
+		if m.drafts != nil && msg.seq == m.drafts.seq && m.state == RecevingInput {
+			m.drafts.save(m.textInput.Value(), false)
+		}
+		return m, nil
+
 	case error:
 		m.err = msg
 		return m, nil
@@ -234,7 +396,11 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.spinner, cmd = m.spinner.Update(msg)
 		return m, cmd
 	case RecevingInput:
+		value := m.textInput.Value()
 		m.textInput, cmd = m.textInput.Update(msg)
+		if m.textInput.Value() != value {
+			cmd = tea.Batch(cmd, m.drafts.changed())
+		}
 		return m, cmd
 	}
 	return m, nil
@@ -243,18 +409,31 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m model) View() string {
 	switch m.state {
 	case Loading:
-		return m.spinner.View()
+		if !m.showSpinner {
+			return ""
+		}
+		waiting := fmt.Sprintf(" Waiting for %s · %.1fs", m.waitModel, time.Since(m.waitStart).Seconds())
+		if m.reasoning != "" {
+			waiting = fmt.Sprintf(" %s is thinking · %.1fs", m.waitModel, time.Since(m.waitStart).Seconds())
+		}
+		return m.formatThinking() + m.spinner.View() + lipgloss.NewStyle().Faint(true).Render(waiting)
 	case RecevingInput:
 		return m.textInput.View()
+	case ChoosingAction:
+		return m.actionBar()
 	case ReceivingResponse:
-		return m.formattedPartialResponse + "\n"
+		partial := ""
+		if m.partial != nil {
+			partial = m.partial.String()
+		}
+		return m.formatThinking() + partial + "\n"
 	}
 	return ""
 }
 
 // === Initial Model Setup === //
 
-func initialModel(prompt string, client *llm.LLMClient) model {
+func initialModel(prompt string, client *llm.LLMClient, contextIndex *rag.Index, tee *responseTee) model {
 	maxWidth := util.GetTermSafeMaxWidth()
 	ti := textinput.New()
 	ti.Placeholder = "Describe a shell command, or ask a question."
@@ -263,16 +442,15 @@ func initialModel(prompt string, client *llm.LLMClient) model {
 
 	s := spinner.New()
 	s.Spinner = spinner.Dot
-	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	s.Style = lipgloss.NewStyle().Foreground(theme.Highlight())
 
 	runWithArgs := prompt != ""
 
-	r, _ := glamour.NewTermRenderer(
-		glamour.WithAutoStyle(),
-		glamour.WithWordWrap(int(maxWidth)),
-	)
+	r, _ := theme.MarkdownRenderer(int(maxWidth))
 	model := model{
 		client:                client,
+		contextIndex:          contextIndex,
+		tee:                   tee,
 		markdownRenderer:      r,
 		textInput:             ti,
 		spinner:               s,
@@ -281,6 +459,7 @@ func initialModel(prompt string, client *llm.LLMClient) model {
 		latestCommandResponse: "",
 		latestCommandIsCode:   false,
 		maxWidth:              maxWidth,
+		showSpinner:           util.IsTerminal(os.Stdout),
 		runWithArgs:           false,
 		err:                   nil,
 	}
@@ -289,6 +468,8 @@ func initialModel(prompt string, client *llm.LLMClient) model {
 		model.runWithArgs = true
 		model.state = Loading
 		model.query = prompt
+		model.waitStart = time.Now()
+		model.waitModel = client.NextModel(prompt)
 	}
 	return model
 }
@@ -297,9 +478,7 @@ func initialModel(prompt string, client *llm.LLMClient) model {
 
 func printAPIKeyNotSetMessage(modelConfig ModelConfig) {
 	auth := modelConfig.Auth
-	r, _ := glamour.NewTermRenderer(
-		glamour.WithAutoStyle(),
-	)
+	r, _ := theme.MarkdownRenderer(0)
 
 	profileScriptName := ".zshrc or.bashrc"
 	shellSyntax := "\n```bash\nexport OPENAI_API_KEY=[your key]\n```"
@@ -308,7 +487,7 @@ func printAPIKeyNotSetMessage(modelConfig ModelConfig) {
 		shellSyntax = "\n```powershell\n$env:OPENAI_API_KEY = \"[your key]\"\n```"
 	}
 
-	styleRed := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
 
 	switch auth {
 	case "OPENAI_API_KEY":
@@ -320,20 +499,23 @@ func printAPIKeyNotSetMessage(modelConfig ModelConfig) {
 	2. Add your credit card in the API (for the free trial)
 	3. Set your key by running:
 	%s
-	4. (Recommended) Add that ^ line to your %s file.`, shellSyntax, profileScriptName)
+	4. (Recommended) Add that ^ line to your %s file.
+
+Or run `+"`q setup`"+` to store the key in your keychain.`, shellSyntax, profileScriptName)
 
 		msg2, _ := r.Render(message_string)
 		fmt.Printf("\n  %v%v\n", msg1, msg2)
 	default:
 		msg := styleRed.Render(auth + " environment variable not set.")
-		fmt.Printf("\n  %v", msg)
+		fmt.Printf("\n  %v\n\n  Set it, or run `q setup` to store the key in your keychain.\n\n", msg)
 	}
 }
 
-func streamHandler(p *tea.Program) func(content string, err error) {
-	return func(content string, err error) {
-		p.Send(partialResponseMsg{content, err})
-	}
+func streamHandler(p *tea.Program, tee *responseTee) llm.StreamHandler {
+	return llm.StreamFuncs{Token: func(text string) {
+		tee.write(text)
+		p.Send(partialResponseMsg{text})
+	}}
 }
 
 func getModelConfig(appConfig config.AppConfig) (ModelConfig, error) {
@@ -342,14 +524,26 @@ func getModelConfig(appConfig config.AppConfig) (ModelConfig, error) {
 	}
 	for _, model := range appConfig.Models {
 		if model.ModelName == appConfig.Preferences.DefaultModel {
-			return model, nil
+			return applyModel(model)
 		}
 	}
 	// If the preferred model is not found, return the first model
-	return appConfig.Models[0], nil
+	return applyModel(appConfig.Models[0])
 }
 
-func runQProgram(prompt string) {
+// applyModel expands the variables in a configured model's settings and
+// fills in its provider's defaults
+func applyModel(model ModelConfig) (ModelConfig, error) {
+	model, err := config.ExpandEnv(model)
+	if err != nil {
+		return model, err
+	}
+	return provider.Apply(model)
+}
+
+// loadModelConfig loads the app config and resolves the default model with its
+// credentials (and the --persona prompt, if given), exiting with a message on failure
+func loadModelConfig() (config.AppConfig, ModelConfig) {
 	appConfig, err := config.LoadAppConfig()
 	if err != nil {
 		config.PrintConfigErrorMessage(err)
@@ -361,39 +555,501 @@ func runQProgram(prompt string) {
 		config.PrintConfigErrorMessage(err)
 		os.Exit(1)
 	}
-	auth := os.Getenv(modelConfig.Auth)
-	if auth == "" || os.Getenv(modelConfig.Auth) == "" {
+	resolved, err := resolveAuth(modelConfig)
+	if err != nil {
+		if len(modelConfig.Keys) > 0 {
+			modelConfig.Auth = modelConfig.Keys[0].EnvVar
+		}
 		printAPIKeyNotSetMessage(modelConfig)
-		os.Exit(1)
+		os.Exit(exitcode.Auth)
+	}
+	// The config isn't saved back: that would drop anything it doesn't know,
+	// like a misspelled key, before `q config validate` could point it out
+	modelConfig = resolved
+
+	if personaFlag != "" {
+		persona, err := config.FindPersona(appConfig, personaFlag)
+		if err != nil {
+			styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+			fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+err.Error()))
+			os.Exit(1)
+		}
+		modelConfig = applyPersona(modelConfig, persona)
+	}
+	return appConfig, modelConfig
+}
+
+// findModelConfig resolves a configured model by name with its credentials from the environment
+func findModelConfig(appConfig config.AppConfig, name string) (ModelConfig, error) {
+	for _, model := range appConfig.Models {
+		if model.ModelName != name {
+			continue
+		}
+		modelConfig, err := applyModel(model)
+		if err != nil {
+			return modelConfig, err
+		}
+		return resolveAuth(modelConfig)
+	}
+	return ModelConfig{}, fmt.Errorf("model %s is not in your config", name)
+}
+
+// apiKey returns the key in the environment variable name, or else the one
+// stored in the keychain under its name (see q setup)
+func apiKey(name string) string {
+	if key := os.Getenv(name); key != "" || name == "" {
+		return key
+	}
+	key, _ := keychain.Get(name)
+	return key
+}
+
+// resolveAuth replaces the model's auth and org env var names with their
+// values. Of several keys, those whose variables aren't set are left out.
+func resolveAuth(modelConfig ModelConfig) (ModelConfig, error) {
+	if len(modelConfig.Keys) == 0 {
+		auth := apiKey(modelConfig.Auth)
+		if auth == "" {
+			return modelConfig, fmt.Errorf("%s is not set", modelConfig.Auth)
+		}
+		modelConfig.Auth = auth
+	} else {
+		var keys []APIKey
+		var unset []string
+		for _, key := range modelConfig.Keys {
+			key.Key = apiKey(key.EnvVar)
+			if key.Key == "" {
+				unset = append(unset, key.EnvVar)
+				continue
+			}
+			if key.Alias == "" {
+				key.Alias = key.EnvVar
+			}
+			keys = append(keys, key)
+		}
+		if len(keys) == 0 {
+			return modelConfig, fmt.Errorf("none of %s is set", strings.Join(unset, ", "))
+		}
+		if len(unset) > 0 {
+			fmt.Fprintf(util.Notes(), "Warning: %s not set, using the other keys of %s\n", strings.Join(unset, ", "), modelConfig.ModelName)
+		}
+		modelConfig.Keys = keys
+		// Anything that reads Auth directly, such as embeddings, gets the first key
+		modelConfig.Auth = keys[0].Key
+	}
+	modelConfig.OrgID = os.Getenv(modelConfig.OrgID)
+	return modelConfig, nil
+}
+
+func runQProgram(prompt string) {
+	appConfig, modelConfig := loadModelConfig()
+	var setup func(*llm.LLMClient)
+	if len(raceFlag) > 0 {
+		var rivals []ModelConfig
+		modelConfig, rivals = raceModels(appConfig)
+		setup = raceSetup(rivals)
+	}
+	if voiceFlag || audioFlag != "" {
+		prompt = voicePrompt(appConfig, modelConfig, prompt)
+	}
+	runSession(appConfig, modelConfig, prompt, setup)
+}
+
+// runSession runs the interactive TUI for prompt. setup, if given, can adjust
+// the client before the first request is sent.
+func runSession(appConfig config.AppConfig, modelConfig ModelConfig, prompt string, setup func(*llm.LLMClient)) {
+	// Exit only after the deferred cleanup below has run
+	status := exitcode.OK
+	defer func() {
+		if status != exitcode.OK {
+			os.Exit(status)
+		}
+	}()
+
+	checkSampleFlags(prompt)
+	var err error
+	var contextIndex *rag.Index
+	if contextFlag != "" {
+		contextIndex, err = openContextIndex(appConfig, modelConfig)
+		if err != nil {
+			styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+			fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+err.Error()))
+			os.Exit(1)
+		}
+		defer contextIndex.Close()
 	}
-	// everything checks out, save the config
-	// TODO: maybe add a validating function
-	config.SaveAppConfig(appConfig)
 
-	orgID := os.Getenv(modelConfig.OrgID)
-	modelConfig.Auth = auth
-	modelConfig.OrgID = orgID
+	var tee *responseTee
+	if outputFlag != "" {
+		tee, err = newResponseTee(outputFlag)
+		if err != nil {
+			styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+			fmt.Printf("\n  %v\n\n", styleRed.Render("Error: failed to create output file: "+err.Error()))
+			os.Exit(1)
+		}
+		defer tee.Close()
+	}
 
 	c := llm.NewLLMClient(modelConfig)
-	p := tea.NewProgram(initialModel(prompt, c))
-	c.StreamCallback = streamHandler(p)
-	if _, err := p.Run(); err != nil {
+	if tee != nil {
+		c.OutputPath = tee.path
+	}
+	c.Persona = personaFlag
+	c.Debug = debugFlag
+	c.Prefill = unescape(prefillFlag)
+	c.StopAtCode = stopAtCode || appConfig.Preferences.StopAtCode
+	c.Memory = rememberedFacts()
+	c.Language = answerLanguage(appConfig, langFlag)
+	c.PackageManager = packageManager(appConfig, pmFlag)
+	notifyAfter = notifyThreshold(appConfig)
+	offlineQueue = appConfig.Preferences.OfflineQueue
+	envNames = envContextNames(appConfig)
+	footerFields = footerSettings(appConfig)
+	thinking = thinkingMode(appConfig)
+	if shortFlag {
+		c.Length = llm.LengthShort
+	} else if detailFlag {
+		c.Length = llm.LengthDetailed
+	}
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	c.Route = modelRouter(appConfig)
+	if setup != nil {
+		setup(c)
+	}
+	if len(urlFlags) > 0 {
+		if err := pinURLs(c, appConfig); err != nil {
+			styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+			fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+err.Error()))
+			os.Exit(1)
+		}
+	}
+	if paneFlag {
+		if err := pinPane(c); err != nil {
+			styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+			fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+err.Error()))
+			os.Exit(1)
+		}
+	}
+	if clipFlag {
+		if err := pinClipboard(c); err != nil {
+			styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+			fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+err.Error()))
+			os.Exit(1)
+		}
+	}
+	if repoFlag {
+		if err := pinRepo(c); err != nil {
+			styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+			fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+err.Error()))
+			os.Exit(1)
+		}
+	}
+	defer finishPending("")
+	if !guardDuplicate(c, appConfig, prompt) {
+		return
+	}
+	// Once the session ends, title its conversation if it has new turns, and
+	// since the network is evidently up, send any prompts queued while offline
+	head := c.ConversationHead
+	defer func() {
+		if c.ConversationHead == head {
+			return
+		}
+		if appConfig.Preferences.TitleModel != "" {
+			titleInBackground(c.ConversationID)
+		}
+		flushQueueInBackground(appConfig)
+	}()
+	if samplesFlag > 1 {
+		status = runSamples(c, appConfig, modelConfig, contextIndex, tee, prompt)
+		return
+	}
+	if runFlag {
+		status = runAndRepair(c, contextIndex, tee, prompt, appConfig.Preferences.Sandbox)
+		return
+	}
+	if quietFlag {
+		status = runQuiet(c, contextIndex, tee, prompt)
+		return
+	}
+	session := initialModel(prompt, c, contextIndex, tee)
+	session.thinking = thinking
+	session.drafts = openDrafts()
+	if prompt == "" {
+		if text, note := session.drafts.restore(); text != "" {
+			session.textInput.SetValue(text)
+			session.textInput.CursorEnd()
+			session.restoredNote = note
+		}
+	}
+	p := tea.NewProgram(session)
+	c.StreamHandler = streamHandler(p, tee)
+	c.ThinkingCallback = func(reasoning string) {
+		p.Send(partialThinkingMsg{reasoning})
+	}
+	final, err := p.Run()
+	if err != nil {
 		fmt.Printf("Alas, there's been an error: %v", err)
+		os.Exit(exitcode.Failure)
+	}
+	// The session ends with the status of its last request
+	status = exitcode.For(final.(model).err)
+}
+
+// thinkingMode is how to show reasoning: as --show-thinking says if given,
+// or else as the thinking preference does
+func thinkingMode(appConfig config.AppConfig) string {
+	mode := showThinkingFlag
+	if mode == "" {
+		mode = appConfig.Preferences.Thinking
+	}
+	switch mode {
+	case llm.ThinkingDim, llm.ThinkingShow:
+		return mode
+	case "", llm.ThinkingHide:
+	default:
+		fmt.Fprintf(util.Notes(), "Warning: --show-thinking=%s is not show, dim or hide, so thinking is hidden\n", mode)
+	}
+	return llm.ThinkingHide
+}
+
+// answerLanguage is the language to ask for answers in: lang if set, or else
+// the language preference, where auto takes it from the locale unless that's
+// English, which models answer in anyway. "" leaves it to the model.
+func answerLanguage(appConfig config.AppConfig, lang string) string {
+	if lang == "" {
+		lang = appConfig.Preferences.Language
+	}
+	switch strings.ToLower(lang) {
+	case "off":
+		return ""
+	case "", "auto":
+		if language := llm.LocaleLanguage(os.Getenv); language != "en" {
+			return language
+		}
+		return ""
+	}
+	return lang
+}
+
+// packageManager is the instruction to install software with: the package
+// manager pm names if set, or else the package_manager preference, where auto
+// detects it. It's "" with off, or if none is found.
+func packageManager(appConfig config.AppConfig, pm string) string {
+	if pm == "" {
+		pm = appConfig.Preferences.PackageManager
+	}
+	switch strings.ToLower(pm) {
+	case "off":
+		return ""
+	case "", "auto":
+		if m, ok := pkgmgr.Detect(runtime.GOOS, exec.LookPath); ok {
+			return m.Instruction()
+		}
+		return ""
+	}
+	m, err := pkgmgr.Lookup(pm)
+	if err != nil {
+		styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+		fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+err.Error()))
 		os.Exit(1)
 	}
+	return m.Instruction()
+}
+
+// modelRouter returns a Route hook that applies the routing preferences, or nil
+// when routing isn't configured or --no-route is set
+func modelRouter(appConfig config.AppConfig) func(string) (ModelConfig, bool) {
+	routing := appConfig.Preferences.Routing
+	if routing == nil || noRouteFlag {
+		return nil
+	}
+	names := []string{routing.SimpleModel, routing.ComplexModel}
+	for _, rule := range routing.Rules {
+		names = append(names, rule.Model)
+	}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if _, err := findModelConfig(appConfig, name); err != nil {
+			fmt.Fprintf(util.Notes(), "Warning: routing to %s is skipped: %v\n", name, err)
+		}
+	}
+
+	return func(query string) (ModelConfig, bool) {
+		name, _ := router.Route(*routing, query)
+		if name == "" {
+			return ModelConfig{}, false
+		}
+		modelConfig, err := findModelConfig(appConfig, name)
+		if err != nil {
+			return ModelConfig{}, false
+		}
+		if personaFlag != "" {
+			if persona, err := config.FindPersona(appConfig, personaFlag); err == nil {
+				modelConfig = applyPersona(modelConfig, persona)
+			}
+		}
+		return modelConfig, true
+	}
+}
+
+// applyPersona replaces the model's prompt with the persona's system prompt
+func applyPersona(modelConfig ModelConfig, persona Persona) ModelConfig {
+	modelConfig.Prompt = []Message{{Role: "system", Content: persona.Prompt}}
+	modelConfig.Examples = persona.Examples
+	if persona.Length != "" {
+		modelConfig.Length = persona.Length
+	}
+	return modelConfig
+}
+
+// openContextIndex brings the local index for --context up to date with the files on disk
+func openContextIndex(appConfig config.AppConfig, modelConfig ModelConfig) (*rag.Index, error) {
+	if _, err := os.Stat(contextFlag); err != nil {
+		return nil, fmt.Errorf("context path not found: %s", contextFlag)
+	}
+	embedder := rag.NewEmbedder(modelConfig, appConfig.Preferences.EmbeddingModel)
+	index, err := rag.OpenIndex(embedder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open context index: %w", err)
+	}
+
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fmt.Fprintln(util.Notes(), styleDim.Render("Indexing "+contextFlag+"..."))
+	updated, err := index.Update(contextFlag)
+	if err != nil {
+		index.Close()
+		return nil, fmt.Errorf("failed to index %s: %w", contextFlag, err)
+	}
+	if updated > 0 {
+		fmt.Fprintln(util.Notes(), styleDim.Render(fmt.Sprintf("Embedded %d changed file(s).", updated)))
+	}
+	return index, nil
 }
 
 var RootCmd = &cobra.Command{
 	Use:   "q [request]",
 	Short: "A command line interface for natural language queries",
+	Args:  cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		// join args into a single string separated by spaces
 		prompt := strings.Join((args), " ")
-		if len(args) > 0 && args[0] == "config" {
-			config.RunConfigProgram(args)
+		if retryFlag {
+			runRegenerate("last")
+			return
+		}
+		if continueFlag {
+			continueConversation("last", prompt)
 			return
 		}
 		runQProgram(prompt)
 
 	},
 }
+
+var asCmd = &cobra.Command{
+	Use:   "as <persona> [request]",
+	Short: "Ask using a persona's system prompt (see `q personas list`)",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		personaFlag = args[0]
+		runQProgram(strings.Join(args[1:], " "))
+	},
+}
+
+// loadSettings applies the settings from the config that are needed before
+// any command runs, reading the config once for all of them. q spend skips
+// it, as shell prompts run it before every line.
+func loadSettings() {
+	if cmd, _, err := RootCmd.Find(os.Args[1:]); err == nil && cmd == spendCmd {
+		return
+	}
+	appConfig, err := config.LoadAppConfig()
+	loadDisplay(appConfig, err)
+	if err != nil {
+		return
+	}
+	loadSink(appConfig)
+	logger.SetAudit(appConfig.Preferences.AuditLog)
+}
+
+// loadDisplay applies --theme and --width, or their preferences, before any
+// output is styled
+func loadDisplay(appConfig config.AppConfig, err error) {
+	name := themeFlag
+	util.Width = widthFlag
+	var themes map[string]Theme
+	if err == nil {
+		if name == "" {
+			name = appConfig.Preferences.Theme
+		}
+		if util.Width == 0 {
+			util.Width = appConfig.Preferences.Width
+		}
+		themes = appConfig.Themes
+	}
+	if err := theme.Load(name, themes); err != nil {
+		fmt.Fprintf(util.Notes(), "Warning: %v\n", err)
+	}
+}
+
+// loadSink sends logged requests to the log sink, if one is configured
+func loadSink(appConfig config.AppConfig) {
+	cfg := appConfig.Preferences.LogSink
+	if cfg == nil {
+		return
+	}
+	s, err := sink.New(cfg)
+	if err != nil {
+		fmt.Fprintf(util.Notes(), "Warning: %v\n", err)
+		return
+	}
+	logger.SetSink(s, cfg.BatchSize, cfg.Anonymize, sink.Source(cfg))
+}
+
+func init() {
+	cobra.OnInitialize(initWorkspace, initQuiet, loadSettings)
+	RootCmd.PersistentFlags().StringVar(&themeFlag, "theme", "", "Color theme: auto, dark, light, mono, or one defined under themes in your config")
+	RootCmd.PersistentFlags().IntVar(&widthFlag, "width", 0, "Wrap output at this column instead of fitting it to the terminal")
+	RootCmd.AddCommand(asCmd)
+	addQuietFlag(RootCmd)
+	addQuietFlag(asCmd)
+	RootCmd.Flags().StringVar(&personaFlag, "persona", "", "Use a persona's system prompt (see q personas list)")
+	RootCmd.Flags().StringVar(&contextFlag, "context", "", "Answer using relevant excerpts from files under this path")
+	RootCmd.Flags().StringArrayVar(&urlFlags, "url", nil, "Answer using the text of this web page (repeatable)")
+	RootCmd.Flags().BoolVar(&clipFlag, "clip", false, "Answer using the text on the clipboard, with secrets redacted")
+	RootCmd.Flags().BoolVar(&paneFlag, "pane", false, "Answer using what's on screen in the current tmux pane, with secrets redacted")
+	RootCmd.Flags().BoolVar(&envFlag, "env", false, "Answer using the values of environment variables like PATH and VIRTUAL_ENV, with secrets hashed")
+	RootCmd.Flags().IntVar(&paneLines, "pane-lines", 200, "With --pane, how many lines of scrollback above the screen to include")
+	RootCmd.Flags().BoolVar(&repoFlag, "repo", false, "Answer using a summary of the current git repository: branch, latest commits, changes and files")
+	RootCmd.Flags().BoolVar(&voiceFlag, "voice", false, "Speak the prompt: record from the microphone until Enter, then transcribe it")
+	RootCmd.Flags().StringVar(&audioFlag, "audio", "", "Transcribe this audio file and use it as the prompt")
+	RootCmd.Flags().IntVar(&topKFlag, "top-k", 5, "Number of context excerpts to include with --context")
+	RootCmd.Flags().StringVarP(&outputFlag, "output", "o", "", "Also write the raw markdown response to this file")
+	RootCmd.Flags().StringVar(&outputFlag, "tee", "", "Alias for --output")
+	RootCmd.Flags().BoolVar(&debugFlag, "debug", false, "Log the exact request JSON and raw response stream (see q logs show --raw)")
+	RootCmd.Flags().BoolVar(&noRouteFlag, "no-route", false, "Always use the default model, ignoring routing preferences")
+	RootCmd.Flags().BoolVar(&retryFlag, "retry", false, "Get a new answer to the last prompt (see q logs regenerate)")
+	RootCmd.Flags().BoolVar(&runFlag, "run", false, "Run the command in the answer once you confirm it, asking for a fix if it fails")
+	RootCmd.Flags().IntVar(&repairFlag, "repairs", 2, "With --run, how many times to ask for a fix of a failing command")
+	RootCmd.Flags().BoolVar(&noSandboxFlag, "no-sandbox", false, "With --run, run commands directly even if a sandbox is configured")
+	RootCmd.Flags().BoolVarP(&continueFlag, "continue", "c", false, "Continue the most recent conversation (see q conversations continue)")
+	RootCmd.Flags().BoolVar(&forkFlag, "fork", false, "With -c, continue in a new branch, leaving the original conversation as it is")
+	RootCmd.Flags().BoolVar(&shortFlag, "short", false, "Ask for a terse answer, capped at a few hundred tokens")
+	RootCmd.Flags().BoolVar(&detailFlag, "detailed", false, "Ask for a thorough answer that explains the command")
+	RootCmd.Flags().StringVar(&showThinkingFlag, "show-thinking", "", "Show the reasoning of models that think before answering: show (the default with no value), dim, or hide")
+	RootCmd.Flags().Lookup("show-thinking").NoOptDefVal = llm.ThinkingShow
+	RootCmd.Flags().StringVar(&pmFlag, "pm", "", "Install software with this package manager, like apt or brew (default: the package_manager preference, or the one found)")
+	RootCmd.Flags().StringVar(&langFlag, "lang", "", "Answer in this language, like ja or German (default: the language preference, or LANG's)")
+	RootCmd.MarkFlagsMutuallyExclusive("short", "detailed")
+	RootCmd.Flags().BoolVar(&notifyFlag, "notify", false, "Show a desktop notification when an answer takes longer than notify_after (default 10s)")
+	RootCmd.Flags().BoolVar(&stopAtCode, "stop-at-code", false, "End the answer once its first code block is complete, saving the tokens of any explanation")
+	RootCmd.Flags().StringVar(&prefillFlag, "prefill", "", "Start the answer with this text to steer its format, such as a code fence (\\n and \\t are escapes)")
+}
+
+// unescape turns \n, \t and \\ typed in a flag into a newline, tab and backslash
+func unescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\t`, "\t").Replace(s)
+}
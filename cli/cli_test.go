@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"q/config"
+)
+
+func TestLoadModelConfigLeavesConfigAlone(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SHELL_AI_WORKSPACE", "")
+	t.Setenv("Q_TEST_KEY", "sk-test")
+	path, err := config.Path()
+	if err != nil {
+		t.Fatalf("config.Path: %v", err)
+	}
+	// A misspelled key is kept for `q config validate` to point out
+	data := []byte(`preferences:
+  default_model: gpt-4.1
+  them: dark
+models:
+- name: gpt-4.1
+  endpoint: https://api.openai.com/v1/chat/completions
+  auth_env_var: Q_TEST_KEY
+  prompt:
+  - role: system
+    content: You are a terminal assistant.
+`)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, modelConfig := loadModelConfig()
+	if modelConfig.ModelName != "gpt-4.1" {
+		t.Errorf("loadModelConfig resolved %q, want gpt-4.1", modelConfig.ModelName)
+	}
+	if saved, err := os.ReadFile(path); err != nil || string(saved) != string(data) {
+		t.Errorf("loading the config rewrote it:\n%s", saved)
+	}
+}
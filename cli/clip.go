@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"q/llm"
+	"q/secrets"
+	"q/tokens"
+	. "q/types"
+	"q/util"
+
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// clipTokens is how much of the clipboard --clip sends
+	clipTokens = 4000
+	// clipPreviewLines is how many lines of the clipboard are shown before asking to send it
+	clipPreviewLines = 8
+)
+
+var clipFlag bool
+
+// pinClipboard pins the clipboard's text to the client's context for --clip,
+// with any secrets in it blanked out. In a terminal, it's shown first and only
+// sent once confirmed.
+func pinClipboard(c *llm.LLMClient) error {
+	text, err := clipboard.ReadAll()
+	if err != nil {
+		return fmt.Errorf("--clip: failed to read the clipboard: %w", err)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("--clip: the clipboard is empty")
+	}
+
+	styleDim := lipgloss.NewStyle().Faint(true)
+	var notes []string
+	if parts := tokens.Split(text, clipTokens); len(parts) > 1 {
+		text = parts[0] + "\n\n[... truncated ...]"
+		notes = append(notes, fmt.Sprintf("cut to about %d tokens", clipTokens))
+	}
+	text, redacted := secrets.Redact(text)
+	if redacted > 0 {
+		notes = append(notes, fmt.Sprintf("%d %s redacted", redacted, pluralize(redacted, "secret", "secrets")))
+	}
+	note := "Attached the clipboard"
+	if len(notes) > 0 {
+		note += " (" + strings.Join(notes, ", ") + ")"
+	}
+
+	if util.IsTerminal(os.Stdin) && !quietFlag {
+		fmt.Fprintln(util.Notes(), styleDim.Render("Clipboard:"))
+		fmt.Fprintln(util.Notes(), clipPreview(text))
+		if len(notes) > 0 {
+			fmt.Fprintln(util.Notes(), styleDim.Render("("+strings.Join(notes, ", ")+")"))
+		}
+		if !askYesNo("Send it with your request?") {
+			fmt.Fprintln(util.Notes(), styleDim.Render("Cancelled."))
+			os.Exit(0)
+		}
+	} else {
+		fmt.Fprintln(util.Notes(), styleDim.Render(note))
+	}
+
+	c.Pin(Message{
+		Role: "system",
+		Content: "The user has copied this text, such as an error or a stack trace, and is asking about it:\n\n" +
+			"```\n" + text + "\n```",
+	})
+	return nil
+}
+
+// clipPreview indents the first lines of text, noting how many more there are
+func clipPreview(text string) string {
+	lines := strings.Split(text, "\n")
+	more := 0
+	if len(lines) > clipPreviewLines {
+		lines, more = lines[:clipPreviewLines], len(lines)-clipPreviewLines
+	}
+	preview := "  " + strings.Join(lines, "\n  ")
+	if more > 0 {
+		preview += "\n" + lipgloss.NewStyle().Faint(true).Render(fmt.Sprintf("  ... %d more %s", more, pluralize(more, "line", "lines")))
+	}
+	return preview
+}
+
+func pluralize(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
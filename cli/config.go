@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"q/config"
+	"q/llm"
+	"q/theme"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configStrict        bool
+	configPromptModel   string
+	configPromptPersona string
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config [reset|revert]",
+	Short: "Change models and preferences, or reset the config",
+	Long: `Open a menu to pick the default model and edit the config file. With
+reset, the config is replaced by the defaults; with revert, by the backup
+saved the last time it was changed successfully.`,
+	Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"reset", "revert"},
+	Run: func(cmd *cobra.Command, args []string) {
+		config.RunConfigProgram(append([]string{"config"}, args...))
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Check the config file for mistakes",
+	Long: `Check a config file, ~/.shell-ai/config.yaml unless another is given,
+for syntax errors, values of the wrong type, missing required settings,
+values a setting doesn't take, and unknown keys. Each problem is printed as
+file:line: message, and the exit status is non-zero if there are any.
+
+Unknown keys are only warnings, since they may be meant for a newer version
+of q; --strict fails on them too, which suits checking dotfiles in CI.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runConfigValidateCommand,
+}
+
+var configPromptCmd = &cobra.Command{
+	Use:   "prompt",
+	Short: "Show the system prompt questions are sent with",
+	Long: `Show the system prompt of the default model, or of --model, as the next
+question would be sent with it: built from the model's system_prompt sections
+if it has any, else its prompt's system messages and the remembered facts.
+Examples and earlier turns aren't shown.`,
+	Args: cobra.NoArgs,
+	Run:  runConfigPromptCommand,
+}
+
+func init() {
+	configValidateCmd.Flags().BoolVar(&configStrict, "strict", false, "Fail on unknown keys too")
+	configPromptCmd.Flags().StringVar(&configPromptModel, "model", "", "Model to show the prompt of (default: the default model)")
+	configPromptCmd.Flags().StringVar(&configPromptPersona, "persona", "", "Show the prompt with a persona's")
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configPromptCmd)
+	RootCmd.AddCommand(configCmd)
+}
+
+func runConfigValidateCommand(cmd *cobra.Command, args []string) {
+	path, err := config.Path()
+	if err != nil {
+		configFail(err.Error())
+	}
+	if len(args) > 0 {
+		path = args[0]
+	}
+	_, problems, err := config.ValidateFile(path)
+	if err != nil {
+		configFail(err.Error())
+	}
+
+	failed := false
+	for _, problem := range problems {
+		location := path
+		if problem.Line > 0 {
+			location = fmt.Sprintf("%s:%d", path, problem.Line)
+		}
+		msg := problem.Message
+		if problem.Path != "" {
+			msg = problem.Path + ": " + msg
+		}
+		if problem.Warning && !configStrict {
+			msg = "warning: " + msg
+		} else {
+			failed = true
+		}
+		fmt.Printf("%s: %s\n", location, msg)
+	}
+	if failed {
+		os.Exit(1)
+	}
+	if len(problems) == 0 {
+		fmt.Println(lipgloss.NewStyle().Foreground(theme.Success()).Render("✓ " + path + " is valid"))
+	}
+}
+
+func runConfigPromptCommand(cmd *cobra.Command, args []string) {
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		configFail(err.Error())
+	}
+	modelConfig, err := getModelConfig(appConfig)
+	if configPromptModel != "" {
+		err = fmt.Errorf("model %s is not in your config", configPromptModel)
+		for _, model := range appConfig.Models {
+			if model.ModelName == configPromptModel {
+				modelConfig, err = applyModel(model)
+				break
+			}
+		}
+	}
+	if err != nil {
+		configFail(err.Error())
+	}
+	if configPromptPersona != "" {
+		persona, err := config.FindPersona(appConfig, configPromptPersona)
+		if err != nil {
+			configFail(err.Error())
+		}
+		modelConfig = applyPersona(modelConfig, persona)
+	}
+
+	c := llm.NewLLMClient(modelConfig)
+	c.Memory = rememberedFacts()
+	c.PackageManager = packageManager(appConfig, "")
+	prompt, err := c.SystemPrompt()
+	if err != nil {
+		configFail(err.Error())
+	}
+	if prompt == "" {
+		fmt.Println(lipgloss.NewStyle().Faint(true).Render(modelConfig.ModelName + " has no system prompt."))
+		return
+	}
+	fmt.Println(prompt)
+}
+
+func configFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
@@ -0,0 +1,589 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"q/llm"
+	"q/logger"
+	"q/theme"
+	. "q/types"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// transcriptVersion is the version of the exported JSON format
+const transcriptVersion = 1
+
+var (
+	conversationsLimit int
+	exportFormat       string
+	exportOut          string
+	continueFlag       bool
+	forkFlag           bool
+	forkAt             int
+)
+
+var conversationsCmd = &cobra.Command{
+	Use:     "conversations",
+	Aliases: []string{"conv"},
+	Short:   "List, export, import and continue logged conversations",
+	Long: `Every interactive session is logged as a conversation. Export one as a
+Markdown or JSON transcript to share it, import someone else's JSON transcript,
+and pick up any conversation where it left off.`,
+	Args: cobra.NoArgs,
+	Run:  runConversationsCommand,
+}
+
+var conversationsExportCmd = &cobra.Command{
+	Use:   "export [last|<id>]",
+	Short: "Write a conversation as a Markdown or JSON transcript",
+	Long: `Write a conversation as a transcript. The ID can be a conversation ID or the
+request ID of any answer in it (see ` + "`q logs`" + `).`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runConversationsExportCommand,
+}
+
+var conversationsImportCmd = &cobra.Command{
+	Use:   "import <file.json>",
+	Short: "Import a JSON transcript so it can be continued locally",
+	Args:  cobra.ExactArgs(1),
+	Run:   runConversationsImportCommand,
+}
+
+var conversationsContinueCmd = &cobra.Command{
+	Use:   "continue [last|<id>] [follow-up]",
+	Short: "Resume a conversation with its earlier messages as context",
+	Long: `Resume a conversation with its earlier messages as context.
+
+If another session adds to the conversation while you're in it, your next
+prompt is refused rather than mixing the two sessions' turns. --fork starts a
+separate branch instead; given the request ID of an answer, the branch starts
+right after that answer.`,
+	Args: cobra.ArbitraryArgs,
+	Run:  runConversationsContinueCommand,
+}
+
+var conversationsForkCmd = &cobra.Command{
+	Use:   "fork [last|<id>]",
+	Short: "Branch a conversation off at one of its turns",
+	Long: `Create a branch of a conversation that shares its history up to a turn
+(the last one unless --at is given), to explore another line of questioning
+without losing the original. Continue the branch with
+` + "`q conversations continue <branch-id>`" + `.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runConversationsForkCommand,
+}
+
+var conversationsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recent conversations (the same as `q conversations`)",
+	Args:  cobra.NoArgs,
+	Run:   runConversationsCommand,
+}
+
+var conversationsSearchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Find conversations by name, title or summary",
+	Long: `Find conversations whose first prompt, title or summary match the query.
+Words must all match; use "quoted phrases", prefix* and OR for more.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runConversationsSearchCommand,
+}
+
+var conversationsTitleCmd = &cobra.Command{
+	Use:   "title [last|<id>]",
+	Short: "Write a title and summary for a conversation",
+	Long: `Ask the title model (preferences.title_model, or the default model) for a
+one-line title and a short summary of a conversation, shown by ` + "`q conversations`" + `
+and searchable with ` + "`q conversations search`" + `. With title_model set this runs
+in the background whenever a session ends.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runConversationsTitleCommand,
+}
+
+var conversationsTreeCmd = &cobra.Command{
+	Use:   "tree [last|<id>]",
+	Short: "Show a conversation with all of its branches",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runConversationsTreeCommand,
+}
+
+func init() {
+	conversationsCmd.Flags().IntVarP(&conversationsLimit, "limit", "n", 10, "Number of recent conversations to list")
+	conversationsListCmd.Flags().IntVarP(&conversationsLimit, "limit", "n", 10, "Number of recent conversations to list")
+	conversationsSearchCmd.Flags().IntVarP(&conversationsLimit, "limit", "n", 10, "Number of matches to list")
+	conversationsExportCmd.Flags().StringVarP(&exportFormat, "format", "f", "md", "Transcript format: md or json")
+	conversationsExportCmd.Flags().StringVarP(&exportOut, "out", "o", "", "Write the transcript to a file instead of stdout")
+	conversationsContinueCmd.Flags().BoolVar(&forkFlag, "fork", false, "Continue in a new branch, leaving the original conversation as it is")
+	conversationsForkCmd.Flags().IntVar(&forkAt, "at", 0, "Turn to branch off after, counting from 1 (default: the last)")
+	conversationsCmd.AddCommand(conversationsListCmd, conversationsSearchCmd, conversationsExportCmd,
+		conversationsImportCmd, conversationsContinueCmd, conversationsForkCmd, conversationsTreeCmd,
+		conversationsTitleCmd)
+	addQuietFlag(conversationsContinueCmd)
+	RootCmd.AddCommand(conversationsCmd)
+}
+
+func conversationsFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(exitStatus)
+}
+
+func openConversationLogger() *logger.RequestLogger {
+	reqLogger, err := logger.NewRequestLogger()
+	if err != nil {
+		conversationsFail("failed to open logs database: " + err.Error())
+	}
+	return reqLogger
+}
+
+// loadConversation returns a conversation and its answered prompts, oldest first
+func loadConversation(ref string) (Conversation, []LogEntry) {
+	reqLogger := openConversationLogger()
+	defer reqLogger.Close()
+
+	conv, err := reqLogger.FindConversation(ref)
+	if err != nil {
+		conversationsFail(err.Error())
+	}
+	entries, err := reqLogger.ConversationEntries(conv.ID)
+	if err != nil {
+		conversationsFail("failed to read the conversation: " + err.Error())
+	}
+	if len(entries) == 0 {
+		conversationsFail("conversation " + conv.ID + " has no answered prompts")
+	}
+	return conv, entries
+}
+
+func runConversationsCommand(cmd *cobra.Command, args []string) {
+	reqLogger := openConversationLogger()
+	defer reqLogger.Close()
+
+	conversations, err := reqLogger.ListConversations(conversationsLimit)
+	if err != nil {
+		conversationsFail("failed to read conversations: " + err.Error())
+	}
+	if len(conversations) == 0 {
+		fmt.Println("No conversations logged yet.")
+		return
+	}
+	printConversations(conversations)
+}
+
+func runConversationsSearchCommand(cmd *cobra.Command, args []string) {
+	reqLogger := openConversationLogger()
+	defer reqLogger.Close()
+
+	conversations, err := reqLogger.SearchConversations(strings.Join(args, " "), conversationsLimit)
+	if err != nil {
+		conversationsFail("search failed: " + err.Error())
+	}
+	if len(conversations) == 0 {
+		fmt.Println("No matching conversations.")
+		return
+	}
+	printConversations(conversations)
+}
+
+// printConversations lists conversations with their details and summaries
+func printConversations(conversations []Conversation) {
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	summaryStyle := lipgloss.NewStyle().Width(78).PaddingLeft(2)
+	for _, conv := range conversations {
+		turns := "1 turn"
+		if conv.Turns != 1 {
+			turns = fmt.Sprintf("%d turns", conv.Turns)
+		}
+		fmt.Println(headerStyle.Render(conv.ID) + "  " + conversationTitle(conv))
+		details := fmt.Sprintf("  %s · %s · %s · $%.4f", conv.Updated.Local().Format("2006-01-02 15:04"), conv.Model, turns, conv.Cost)
+		if conv.ImportedFrom != "" {
+			details += " · imported from " + conv.ImportedFrom
+		}
+		if conv.ParentID != "" {
+			details += " · branch of " + conv.ParentID
+		}
+		fmt.Println(dimStyle.Render(details))
+		if conv.Summary != "" {
+			fmt.Println(summaryStyle.Render(conv.Summary))
+		}
+	}
+}
+
+// conversationTitle is the generated title of a conversation, or its first prompt
+func conversationTitle(conv Conversation) string {
+	if conv.Title != "" {
+		return conv.Title
+	}
+	return conv.Name
+}
+
+// conflictHint explains how to go on after another session continued the
+// conversation err is about, or returns "" for other errors
+func conflictHint(err error, head string) string {
+	var conflict *logger.ConflictError
+	if !errors.As(err, &conflict) {
+		return ""
+	}
+	return fmt.Sprintf("Pick up after the other session's turns with `q conversations continue %s`, "+
+		"or branch off from your last answer with `q conversations continue %s --fork`.", conflict.ID, head)
+}
+
+// buildTranscript turns a conversation's log entries into a portable transcript.
+// The system prompt of the first request is kept; prompts are timestamped when
+// they were sent and answers when they finished.
+func buildTranscript(conv Conversation, entries []LogEntry) Transcript {
+	transcript := Transcript{
+		Version:    transcriptVersion,
+		ID:         conv.ID,
+		Name:       conversationTitle(conv),
+		Model:      conv.Model,
+		ExportedAt: time.Now().UTC(),
+	}
+	for _, msg := range entries[0].Messages {
+		if msg.Role == "system" {
+			transcript.Messages = append(transcript.Messages, TranscriptMessage{
+				Role:      "system",
+				Content:   msg.Content,
+				Timestamp: entries[0].Timestamp.Add(-time.Duration(entries[0].DurationMs) * time.Millisecond),
+			})
+		}
+	}
+	for _, entry := range entries {
+		transcript.Messages = append(transcript.Messages, TranscriptMessage{
+			Role:      "user",
+			Content:   userPrompt(entry),
+			Timestamp: entry.Timestamp.Add(-time.Duration(entry.DurationMs) * time.Millisecond),
+		})
+		if entry.Response != "" {
+			transcript.Messages = append(transcript.Messages, TranscriptMessage{
+				Role:      "assistant",
+				Content:   entry.Response,
+				Timestamp: entry.Timestamp,
+				Model:     entry.Model,
+			})
+		}
+	}
+	return transcript
+}
+
+// transcriptMarkdown renders a transcript for reading
+func transcriptMarkdown(transcript Transcript) string {
+	var b strings.Builder
+	title := transcript.Name
+	if title == "" {
+		title = "Conversation " + transcript.ID
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "_%s · %s · exported %s_\n", transcript.ID, transcript.Model, transcript.ExportedAt.Local().Format("2006-01-02 15:04"))
+	for _, msg := range transcript.Messages {
+		heading := strings.ToUpper(msg.Role[:1]) + msg.Role[1:]
+		if msg.Model != "" {
+			heading += " (" + msg.Model + ")"
+		}
+		if !msg.Timestamp.IsZero() {
+			heading += " · " + msg.Timestamp.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", heading, strings.TrimSpace(msg.Content))
+	}
+	return b.String()
+}
+
+func runConversationsExportCommand(cmd *cobra.Command, args []string) {
+	ref := "last"
+	if len(args) == 1 {
+		ref = args[0]
+	}
+	transcript := buildTranscript(loadConversation(ref))
+
+	var output string
+	switch exportFormat {
+	case "md", "markdown":
+		output = transcriptMarkdown(transcript)
+	case "json":
+		data, err := json.MarshalIndent(transcript, "", "  ")
+		if err != nil {
+			conversationsFail(err.Error())
+		}
+		output = string(data) + "\n"
+	default:
+		conversationsFail(fmt.Sprintf("unknown format %q (use md or json)", exportFormat))
+	}
+
+	if exportOut == "" {
+		fmt.Print(output)
+		return
+	}
+	if err := os.WriteFile(exportOut, []byte(output), 0644); err != nil {
+		conversationsFail("failed to write transcript: " + err.Error())
+	}
+	fmt.Fprintf(os.Stderr, "Exported %s to %s\n", transcript.ID, exportOut)
+}
+
+func runConversationsImportCommand(cmd *cobra.Command, args []string) {
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		conversationsFail(err.Error())
+	}
+	var transcript Transcript
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		conversationsFail(fmt.Sprintf("%s is not a JSON transcript: %v", args[0], err))
+	}
+	if transcript.Version > transcriptVersion {
+		conversationsFail(fmt.Sprintf("%s uses transcript version %d; this version of q reads up to %d", args[0], transcript.Version, transcriptVersion))
+	}
+
+	reqLogger := openConversationLogger()
+	defer reqLogger.Close()
+	source := transcript.ID
+	if source == "" {
+		source = args[0]
+	}
+	id, err := reqLogger.ImportConversation(transcript, source)
+	if err != nil {
+		conversationsFail("failed to import " + args[0] + ": " + err.Error())
+	}
+	fmt.Printf("Imported %d messages as %s\n", len(transcript.Messages), id)
+	fmt.Printf("Continue it with: q conversations continue %s\n", id)
+}
+
+func runConversationsContinueCommand(cmd *cobra.Command, args []string) {
+	ref := "last"
+	if len(args) > 0 {
+		ref = args[0]
+	}
+	continueConversation(ref, strings.Join(args[1:], " "))
+}
+
+// continueConversation resumes the conversation ref points to, in a fork of
+// it with --fork
+func continueConversation(ref, prompt string) {
+	conv, entries := loadConversation(ref)
+
+	id, version := conv.ID, conv.Version
+	if forkFlag {
+		// Fork right after the answer ref names, or after the latest one
+		for i, entry := range entries {
+			if entry.RequestID == ref {
+				entries = entries[:i+1]
+				break
+			}
+		}
+		reqLogger := openConversationLogger()
+		fork, err := reqLogger.ForkConversation(conv.ID, entries[len(entries)-1].RequestID)
+		reqLogger.Close()
+		if err != nil {
+			conversationsFail("failed to fork the conversation: " + err.Error())
+		}
+		id, version = fork, 0
+	}
+
+	appConfig, modelConfig := loadModelConfig()
+	model := entries[len(entries)-1].Model
+	if model != modelConfig.ModelName {
+		if logged, err := findModelConfig(appConfig, model); err == nil {
+			modelConfig = logged
+		}
+	}
+
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	if id != conv.ID {
+		fmt.Println(dimStyle.Render(fmt.Sprintf("Forking %q after turn %d as %s (%s)", conv.Name, len(entries), id, modelConfig.ModelName)))
+	} else {
+		fmt.Println(dimStyle.Render(fmt.Sprintf("Continuing %q (%d turns, %s)", conv.Name, len(entries), modelConfig.ModelName)))
+	}
+	runSession(appConfig, modelConfig, prompt, func(c *llm.LLMClient) {
+		resumeConversation(c, id, version, entries)
+	})
+}
+
+// resumeConversation gives a client a conversation's turns as its history, so
+// its next answer is logged as the next turn of id, at version
+func resumeConversation(c *llm.LLMClient, id string, version int, entries []LogEntry) {
+	c.Route = nil
+	c.ConversationID = id
+	c.ConversationVersion = version
+	c.ConversationHead = entries[len(entries)-1].RequestID
+	for _, entry := range entries {
+		c.AppendHistory(Message{Role: "user", Content: userPrompt(entry)})
+		if entry.Response != "" {
+			c.AppendHistory(Message{Role: "assistant", Content: entry.Response})
+		}
+	}
+}
+
+func runConversationsForkCommand(cmd *cobra.Command, args []string) {
+	ref := "last"
+	if len(args) == 1 {
+		ref = args[0]
+	}
+	conv, entries := loadConversation(ref)
+	at := len(entries)
+	if forkAt != 0 {
+		if forkAt < 1 || forkAt > len(entries) {
+			conversationsFail(fmt.Sprintf("--at must be between 1 and %d, the number of turns in %s", len(entries), conv.ID))
+		}
+		at = forkAt
+	}
+
+	reqLogger := openConversationLogger()
+	defer reqLogger.Close()
+	id, err := reqLogger.ForkConversation(conv.ID, entries[at-1].RequestID)
+	if err != nil {
+		conversationsFail("failed to fork the conversation: " + err.Error())
+	}
+	fmt.Printf("Forked %s after turn %d as %s\n", conv.ID, at, id)
+	fmt.Printf("Continue it with: q conversations continue %s\n", id)
+}
+
+func runConversationsTreeCommand(cmd *cobra.Command, args []string) {
+	ref := "last"
+	if len(args) == 1 {
+		ref = args[0]
+	}
+	reqLogger := openConversationLogger()
+	defer reqLogger.Close()
+
+	current, err := reqLogger.FindConversation(ref)
+	if err != nil {
+		conversationsFail(err.Error())
+	}
+	root := current
+	for root.ParentID != "" {
+		if root, err = reqLogger.FindConversation(root.ParentID); err != nil {
+			conversationsFail("failed to read the conversation tree: " + err.Error())
+		}
+	}
+
+	// A fork hangs off the turn it shares last with its parent, which may
+	// belong to an earlier ancestor when a fork was itself forked early
+	var branches []Conversation
+	queue := []string{root.ID}
+	for len(queue) > 0 {
+		forks, err := reqLogger.Forks(queue[0])
+		if err != nil {
+			conversationsFail("failed to read the conversation tree: " + err.Error())
+		}
+		queue = queue[1:]
+		for _, fork := range forks {
+			branches = append(branches, fork)
+			queue = append(queue, fork.ID)
+		}
+	}
+	forksAt := make(map[string][]Conversation)
+	for _, branch := range branches {
+		forksAt[branch.ForkPoint] = append(forksAt[branch.ForkPoint], branch)
+	}
+
+	t := conversationTree{log: reqLogger, forksAt: forksAt, current: current.ID}
+	t.print(root, 0, 0)
+}
+
+// conversationTree prints a conversation's turns with its forks nested under
+// the turn they branch off after
+type conversationTree struct {
+	log     *logger.RequestLogger
+	forksAt map[string][]Conversation
+	current string
+}
+
+func (t conversationTree) print(conv Conversation, indent, turn int) {
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	pad := strings.Repeat(" ", indent)
+
+	header := headerStyle.Render(conv.ID)
+	if conv.ParentID == "" {
+		header += "  " + conversationTitle(conv)
+	} else {
+		header = "└ " + header + dimStyle.Render(fmt.Sprintf("  branched after turn %d", turn))
+	}
+	if conv.ID == t.current {
+		header += dimStyle.Render("  (this conversation)")
+	}
+	fmt.Println(pad + header)
+
+	entries, err := t.log.BranchEntries(conv.ID)
+	if err != nil {
+		conversationsFail("failed to read the conversation tree: " + err.Error())
+	}
+	if len(entries) == 0 {
+		fmt.Println(pad + dimStyle.Render("    no turns yet"))
+	}
+	for i, entry := range entries {
+		fmt.Printf("%s  %s %s\n", pad, dimStyle.Render(fmt.Sprintf("%d.", turn+i+1)), turnSummary(userPrompt(entry)))
+		for _, fork := range t.forksAt[entry.RequestID] {
+			t.print(fork, indent+5, turn+i+1)
+		}
+	}
+}
+
+// turnSummary shortens a prompt to one line for the tree
+func turnSummary(prompt string) string {
+	summary := strings.TrimSpace(prompt)
+	if i := strings.IndexByte(summary, '\n'); i >= 0 {
+		summary = strings.TrimSpace(summary[:i]) + " ..."
+	}
+	if runes := []rune(summary); len(runes) > 60 {
+		summary = string(runes[:57]) + "..."
+	}
+	return summary
+}
+
+func runConversationsTitleCommand(cmd *cobra.Command, args []string) {
+	ref := "last"
+	if len(args) == 1 {
+		ref = args[0]
+	}
+	conv, entries := loadConversation(ref)
+
+	appConfig, modelConfig := loadModelConfig()
+	if name := appConfig.Preferences.TitleModel; name != "" && name != modelConfig.ModelName {
+		titleConfig, err := findModelConfig(appConfig, name)
+		if err != nil {
+			conversationsFail("title_model: " + err.Error())
+		}
+		modelConfig = titleConfig
+	}
+
+	var turns []Message
+	for _, entry := range entries {
+		turns = append(turns, Message{Role: "user", Content: userPrompt(entry)}, Message{Role: "assistant", Content: entry.Response})
+	}
+	c := llm.NewLLMClient(modelConfig)
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	title, summary, err := c.TitleConversation(turns)
+	if err != nil {
+		conversationsFail("failed to title the conversation: " + requestError(err))
+	}
+
+	reqLogger := openConversationLogger()
+	defer reqLogger.Close()
+	if err := reqLogger.SetConversationSummary(conv.ID, title, summary); err != nil {
+		conversationsFail("failed to save the title: " + err.Error())
+	}
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	fmt.Println(headerStyle.Render(title))
+	fmt.Println(summary)
+}
+
+// titleInBackground titles a conversation from a separate q process, so the
+// session that just ended doesn't wait for it
+func titleInBackground(id string) {
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+	cmd := exec.Command(exe, "conversations", "title", id)
+	if cmd.Start() == nil {
+		cmd.Process.Release()
+	}
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"q/llm"
+	"q/logger"
+	. "q/types"
+)
+
+func TestConversationRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var mu sync.Mutex
+	var sent [][]Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct{ Messages []Message }
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		sent = append(sent, payload.Messages)
+		n := len(sent)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunk, _ := json.Marshal(map[string]interface{}{
+			"id":      fmt.Sprintf("req-%d", time.Now().UnixNano()),
+			"choices": []interface{}{map[string]interface{}{"delta": map[string]string{"content": fmt.Sprintf("answer %d", n)}}},
+		})
+		fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", chunk)
+	}))
+	defer server.Close()
+	config := ModelConfig{ModelName: "gpt-4.1", Endpoint: server.URL + "/v1/chat/completions", Auth: "test"}
+	reqLogger, err := logger.Shared()
+	if err != nil {
+		t.Fatalf("logger.Shared: %v", err)
+	}
+
+	c := llm.NewLLMClient(config)
+	for _, prompt := range []string{"list files", "with sizes"} {
+		if _, err := c.Query(prompt); err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+	}
+	conv, err := reqLogger.FindConversation(c.ConversationID)
+	if err != nil {
+		t.Fatalf("FindConversation: %v", err)
+	}
+	entries, err := reqLogger.ConversationEntries(conv.ID)
+	if err != nil {
+		t.Fatalf("ConversationEntries: %v", err)
+	}
+
+	// Export, then import what was exported
+	exported := buildTranscript(conv, entries)
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var transcript Transcript
+	if err := json.Unmarshal(data, &transcript); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	id, err := reqLogger.ImportConversation(transcript, transcript.ID)
+	if err != nil {
+		t.Fatalf("ImportConversation: %v", err)
+	}
+	imported, err := reqLogger.FindConversation(id)
+	if err != nil {
+		t.Fatalf("FindConversation(%s): %v", id, err)
+	}
+	if id == conv.ID || imported.ImportedFrom != conv.ID || imported.Model != conv.Model || imported.Turns != 2 {
+		t.Errorf("imported %s as %+v, want a new conversation of 2 turns from %s", conv.ID, imported, conv.ID)
+	}
+	importedEntries, err := reqLogger.ConversationEntries(id)
+	if err != nil {
+		t.Fatalf("ConversationEntries(%s): %v", id, err)
+	}
+
+	// Exported again, it's the same transcript under the new ID
+	again := buildTranscript(imported, importedEntries)
+	if again.ID != id || len(again.Messages) != len(exported.Messages) {
+		t.Fatalf("exported again as %+v, want %+v", again, exported)
+	}
+	for i, msg := range again.Messages {
+		want := exported.Messages[i]
+		if msg.Role != want.Role || msg.Content != want.Content || msg.Model != want.Model || !msg.Timestamp.Equal(want.Timestamp) {
+			t.Errorf("message %d exported again as %+v, want %+v", i+1, msg, want)
+		}
+	}
+
+	// Continued, the next turn has the imported history and is logged to it
+	resumed := llm.NewLLMClient(config)
+	resumeConversation(resumed, id, imported.Version, importedEntries)
+	if _, err := resumed.Query("and hidden ones"); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var got []string
+	for _, msg := range sent[len(sent)-1] {
+		got = append(got, msg.Role+": "+msg.Content)
+	}
+	want := "user: list files|assistant: answer 1|user: with sizes|assistant: answer 2|user: and hidden ones"
+	if strings.Join(got, "|") != want {
+		t.Errorf("continuing sent %q, want %q", strings.Join(got, "|"), want)
+	}
+	continued, err := reqLogger.ConversationEntries(id)
+	if err != nil {
+		t.Fatalf("ConversationEntries(%s): %v", id, err)
+	}
+	if len(continued) != 3 || continued[2].RequestID != resumed.LastEntry().RequestID || continued[2].Response != "answer 3" {
+		t.Errorf("the imported conversation has %+v, want the new turn after the imported ones", continued)
+	}
+	if original, _ := reqLogger.ConversationEntries(conv.ID); len(original) != 2 {
+		t.Errorf("the original conversation has %d turns, want it left alone with 2", len(original))
+	}
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"q/cron"
+	"q/llm"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// cronPlaceholder stands in for the command when the description doesn't say
+const cronPlaceholder = "/path/to/command"
+
+var (
+	cronCommand string
+	cronTries   int
+)
+
+var cronCmd = &cobra.Command{
+	Use:   "cron <description>",
+	Short: "Write a crontab line and show when it runs",
+	Long: `Write a crontab line for a description, check it with a cron parser, and
+show its next five run times. In a terminal, it then offers to add the line to
+your crontab.
+
+  q cron "every weekday at 6pm" --command "~/bin/backup.sh"
+  q cron "at 2:30 on the first of every month run certbot renew"`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runCronCommand,
+}
+
+func init() {
+	cronCmd.Flags().StringVar(&cronCommand, "command", "", "The command to schedule")
+	cronCmd.Flags().IntVar(&cronTries, "tries", 3, "How many lines to try before giving up")
+	addQuietFlag(cronCmd)
+	RootCmd.AddCommand(cronCmd)
+}
+
+func runCronCommand(cmd *cobra.Command, args []string) {
+	request := "Description: " + strings.Join(args, " ")
+	if cronCommand != "" {
+		request += "\n\nThe command is exactly: " + cronCommand
+	}
+
+	appConfig, modelConfig := loadModelConfig()
+	c := llm.NewLLMClient(modelConfig)
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	attempts, err := c.Refine(cronPrompt, request, cronTries, "cron", func(line string) (string, error) {
+		return checkCronLine(line), nil
+	})
+	if err != nil || len(attempts) == 0 || attempts[len(attempts)-1].Feedback != "" {
+		finishGenerator(attempts, err, "")
+	}
+	line := attempts[len(attempts)-1].Answer
+	fmt.Fprintln(answerOut, line)
+	if quietFlag {
+		return
+	}
+
+	spec, command, _ := cron.SplitLine(line)
+	schedule, _ := cron.Parse(spec)
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fmt.Fprintln(util.Notes())
+	if schedule.Reboot {
+		fmt.Fprintln(util.Notes(), styleDim.Render("Runs once each time the system starts."))
+	} else if runs := schedule.NextN(time.Now(), 5); len(runs) > 0 {
+		fmt.Fprintln(util.Notes(), styleDim.Render("Next runs:"))
+		for _, run := range runs {
+			fmt.Fprintln(util.Notes(), styleDim.Render("  "+run.Format("Mon 2006-01-02 15:04 MST")))
+		}
+	}
+
+	if !util.IsTerminal(os.Stdin) || !util.IsTerminal(os.Stdout) {
+		return
+	}
+	fmt.Fprintln(util.Notes())
+	if strings.Contains(command, cronPlaceholder) {
+		fmt.Fprintln(util.Notes(), styleDim.Render("Replace "+cronPlaceholder+" with your command, or pass --command, to add it to your crontab."))
+		return
+	}
+	fmt.Fprint(util.Notes(), styleDim.Render("Add it to your crontab? [y/N] "))
+	answer, err := stdinLines.ReadString('\n')
+	if err != nil {
+		return
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		added, err := appendCrontab(line)
+		if err != nil {
+			generatorFail(err.Error())
+		}
+		if added {
+			fmt.Fprintln(util.Notes(), styleDim.Render("Added."))
+		} else {
+			fmt.Fprintln(util.Notes(), styleDim.Render("Your crontab already has this line."))
+		}
+	}
+}
+
+const cronPrompt = "Write a single crontab line for the user's description: five schedule fields " +
+	"(minute, hour, day of month, month, day of week) or a macro such as @daily, then the command. " +
+	"If no command is given, use " + cronPlaceholder + ". " +
+	"Reply with only the line in a single code block, without comments."
+
+// checkCronLine describes what's wrong with a crontab line for the model, or
+// returns "" if it parses
+func checkCronLine(line string) string {
+	if strings.Contains(line, "\n") {
+		return "Reply with a single line."
+	}
+	spec, _, err := cron.SplitLine(line)
+	if err != nil {
+		return "The line doesn't parse: " + err.Error()
+	}
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return "The schedule doesn't parse: " + err.Error()
+	}
+	if !schedule.Reboot && schedule.Next(time.Now()).IsZero() {
+		return "The schedule never runs."
+	}
+	return ""
+}
+
+// appendCrontab adds line to the user's crontab, reporting false if it was
+// already there
+func appendCrontab(line string) (bool, error) {
+	if _, err := exec.LookPath("crontab"); err != nil {
+		return false, fmt.Errorf("crontab isn't installed")
+	}
+	var current, stderr bytes.Buffer
+	list := exec.Command("crontab", "-l")
+	list.Stdout = &current
+	list.Stderr = &stderr
+	if err := list.Run(); err != nil {
+		// Having no crontab yet is fine; anything else isn't
+		if !strings.Contains(strings.ToLower(stderr.String()), "no crontab") {
+			return false, fmt.Errorf("failed to read your crontab: %s", strings.TrimSpace(stderr.String()))
+		}
+		current.Reset()
+	}
+	existing := current.String()
+	for _, l := range strings.Split(existing, "\n") {
+		if strings.TrimSpace(l) == line {
+			return false, nil
+		}
+	}
+	if existing != "" && !strings.HasSuffix(existing, "\n") {
+		existing += "\n"
+	}
+	install := exec.Command("crontab", "-")
+	install.Stdin = strings.NewReader(existing + line + "\n")
+	if out, err := install.CombinedOutput(); err != nil {
+		return false, fmt.Errorf("failed to update your crontab: %s", strings.TrimSpace(string(out)))
+	}
+	return true, nil
+}
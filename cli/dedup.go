@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/llm"
+	"q/logger"
+	"q/util"
+)
+
+// defaultDedupWindow is how soon sending the same prompt again is taken for
+// a double Enter or a shell retry
+const defaultDedupWindow = 5 * time.Second
+
+const (
+	// dedupPoll is how often a run sharing another's request checks on it
+	dedupPoll = 250 * time.Millisecond
+	// dedupWait is how long a run waits for the request it shares
+	dedupWait = 2 * time.Minute
+)
+
+// pendingID is the session's first request while it's marked in flight for
+// the duplicate guard, or 0
+var pendingID int64
+
+// dedupWindow is the dedup_window preference, or 0 when the guard is off
+func dedupWindow(appConfig config.AppConfig) time.Duration {
+	if d, err := time.ParseDuration(appConfig.Preferences.DedupWindow); err == nil {
+		return d
+	}
+	return defaultDedupWindow
+}
+
+// requestHash identifies what a prompt asks of which model, in which
+// conversation, so the same question sent twice has the same hash
+func requestHash(c *llm.LLMClient, prompt string) string {
+	parts := []string{c.Model(), c.Persona, c.ConversationHead, strings.TrimSpace(prompt)}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// guardDuplicate marks the session's first request as in flight, and checks
+// whether another q sent the same prompt moments ago, by a double Enter or a
+// shell retry. In a terminal it asks before sending the prompt again. Scripts
+// can't answer, and may well send the same prompt on purpose, so they're only
+// guarded when dedup_window is set, and then only wait for a request still in
+// flight and print its answer. It reports whether the prompt should still be
+// sent.
+func guardDuplicate(c *llm.LLMClient, appConfig config.AppConfig, prompt string) bool {
+	window := dedupWindow(appConfig)
+	if window <= 0 || strings.TrimSpace(prompt) == "" || c.RegeneratedFrom != "" {
+		return true
+	}
+	interactive := util.IsTerminal(os.Stdin) && !quietFlag
+	if !interactive {
+		if appConfig.Preferences.DedupWindow == "" {
+			return true
+		}
+		window = 0
+	}
+	reqLogger, err := logger.Shared()
+	if err != nil {
+		return true
+	}
+	id, earlier, err := reqLogger.BeginRequest(requestHash(c, prompt), window)
+	if err != nil {
+		return true
+	}
+	pendingID = id
+	if earlier == nil {
+		return true
+	}
+
+	ago := time.Since(earlier.Started).Round(time.Second)
+	if interactive {
+		question := fmt.Sprintf("You sent this same prompt %s ago, and it's still waiting for an answer. Send it again?", ago)
+		if earlier.RequestID != "" {
+			question = fmt.Sprintf("You sent this same prompt %s ago (logged as %s). Send it again?", ago, earlier.RequestID)
+		}
+		if askYesNo(question) {
+			return true
+		}
+		finishPending("")
+		return false
+	}
+
+	answer, ok := awaitAnswer(reqLogger, earlier.ID)
+	if !ok {
+		// It failed, so this one is a retry after all
+		return true
+	}
+	finishPending("")
+	fmt.Fprintf(util.Notes(), "The same prompt was sent %s ago; this is its answer.\n", ago)
+	if quietFlag {
+		fmt.Fprintln(answerOut, quietAnswer(answer))
+	} else {
+		fmt.Println(strings.TrimRight(answer, "\n"))
+	}
+	return false
+}
+
+// awaitAnswer waits for a request marked in flight to be answered, returning
+// the answer, or false if it failed or took too long
+func awaitAnswer(reqLogger *logger.RequestLogger, id int64) (string, bool) {
+	deadline := time.Now().Add(dedupWait)
+	for time.Now().Before(deadline) {
+		request, err := reqLogger.GetPendingRequest(id)
+		if err != nil {
+			return "", false
+		}
+		if !request.Finished.IsZero() {
+			entry, err := reqLogger.GetResponse(request.RequestID)
+			if err != nil {
+				return "", false
+			}
+			return entry.Response, true
+		}
+		time.Sleep(dedupPoll)
+	}
+	return "", false
+}
+
+// finishPending marks the session's first request as answered under
+// requestID, or forgets it when it failed ("")
+func finishPending(requestID string) {
+	if pendingID == 0 {
+		return
+	}
+	if reqLogger, err := logger.Shared(); err == nil {
+		reqLogger.FinishRequest(pendingID, requestID)
+	}
+	pendingID = 0
+}
@@ -0,0 +1,298 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/hooks"
+	"q/llm"
+	"q/logger"
+	"q/sink"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var doctorNoPing bool
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the config, API keys, endpoints and logs database",
+	Long: `Check that q is set up correctly: the config file parses, each model's
+API key is set, each endpoint answers a tiny request, and the logs database
+is sound. Problems come with a hint on how to fix them. The exit status is
+non-zero if any check fails.
+
+Pinging sends each model one short request, which costs a few tokens and is
+logged. Use --no-ping to skip it.`,
+	Args: cobra.NoArgs,
+	Run:  runDoctorCommand,
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorNoPing, "no-ping", false, "Don't send each model a test request")
+	RootCmd.AddCommand(doctorCmd)
+}
+
+// doctorStatus is the outcome of one check
+type doctorStatus int
+
+const (
+	doctorPass doctorStatus = iota
+	doctorWarn
+	doctorFail
+)
+
+// doctorReport prints checks as they finish and remembers whether any failed
+type doctorReport struct {
+	failed bool
+}
+
+func (r *doctorReport) check(status doctorStatus, name, detail, hint string) {
+	mark := lipgloss.NewStyle().Foreground(theme.Success()).Render("✓")
+	switch status {
+	case doctorWarn:
+		mark = lipgloss.NewStyle().Foreground(theme.Highlight()).Render("!")
+	case doctorFail:
+		mark = lipgloss.NewStyle().Foreground(theme.Error()).Render("✗")
+		r.failed = true
+	}
+	line := "  " + mark + " " + name
+	if detail != "" {
+		line += lipgloss.NewStyle().Faint(true).Render(" · " + detail)
+	}
+	fmt.Println(line)
+	if hint != "" {
+		fmt.Println(lipgloss.NewStyle().Foreground(theme.Info()).Render("      → " + hint))
+	}
+}
+
+func runDoctorCommand(cmd *cobra.Command, args []string) {
+	report := &doctorReport{}
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+
+	fmt.Println(headerStyle.Render("Config"))
+	appConfig, ok := doctorConfig(report)
+
+	if ok && len(appConfig.Models) > 0 {
+		fmt.Println()
+		fmt.Println(headerStyle.Render("Models"))
+		for _, model := range appConfig.Models {
+			doctorModel(report, model)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(headerStyle.Render("Logs"))
+	doctorLogs(report, appConfig.Preferences.LogSink)
+	fmt.Println()
+
+	if report.failed {
+		os.Exit(1)
+	}
+}
+
+// doctorConfig checks the config file parses and its model references resolve
+func doctorConfig(report *doctorReport) (config.AppConfig, bool) {
+	path, err := config.Path()
+	if err != nil {
+		report.check(doctorFail, "Config file", err.Error(), "")
+		return config.AppConfig{}, false
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		report.check(doctorWarn, "Config file", path+" doesn't exist", "run `q config` to create the default config")
+		return config.AppConfig{}, false
+	}
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		report.check(doctorFail, "Config file", err.Error(), "fix the YAML, or run `q config revert` to restore the backup or `q config reset` for the defaults")
+		return appConfig, false
+	}
+	report.check(doctorPass, "Config file", path, "")
+	if _, problems, err := config.ValidateFile(path); err == nil {
+		var unknown []string
+		for _, problem := range problems {
+			if problem.Warning {
+				unknown = append(unknown, problem.String())
+			}
+		}
+		if len(unknown) > 0 {
+			report.check(doctorWarn, "Unknown keys", strings.Join(unknown, "; "), "they're ignored; check them for typos")
+		}
+	}
+
+	if len(appConfig.Models) == 0 {
+		report.check(doctorFail, "Models", "none configured", "add a model under models, or run `q config reset`")
+		return appConfig, false
+	}
+	names := map[string]bool{}
+	for _, model := range appConfig.Models {
+		names[model.ModelName] = true
+	}
+	preferences := appConfig.Preferences
+	if !names[preferences.DefaultModel] {
+		report.check(doctorWarn, "Default model", fmt.Sprintf("%q is not configured, so %s is used", preferences.DefaultModel, appConfig.Models[0].ModelName),
+			"set default_model to one of the models, or pick one with `q config`")
+	} else {
+		report.check(doctorPass, "Default model", preferences.DefaultModel, "")
+	}
+
+	// Settings that name another model, in the order they appear in the config
+	var references [][2]string
+	for _, model := range appConfig.Models {
+		references = append(references, [2]string{"summary_model of " + model.ModelName, model.SummaryModel})
+	}
+	references = append(references, [2]string{"title_model", preferences.TitleModel})
+	references = append(references, [2]string{"judge_model", preferences.JudgeModel})
+	if routing := preferences.Routing; routing != nil {
+		references = append(references,
+			[2]string{"routing.simple_model", routing.SimpleModel},
+			[2]string{"routing.complex_model", routing.ComplexModel})
+		for i, rule := range routing.Rules {
+			references = append(references, [2]string{fmt.Sprintf("routing.rules[%d].model", i), rule.Model})
+		}
+	}
+	for _, ref := range references {
+		setting, name := ref[0], ref[1]
+		if name != "" && !names[name] {
+			report.check(doctorFail, setting, fmt.Sprintf("model %q is not configured", name), "add it under models or change "+setting)
+		}
+	}
+
+	for _, model := range appConfig.Models {
+		if expanded, err := config.ExpandEnv(model); err == nil {
+			model = expanded
+		}
+		if model.Hooks == nil {
+			continue
+		}
+		for _, hook := range [][2]string{{hooks.PreRequest, model.Hooks.PreRequest}, {hooks.PostResponse, model.Hooks.PostResponse}} {
+			name, path := hook[0], hook[1]
+			if path == "" {
+				continue
+			}
+			setting := fmt.Sprintf("hooks.%s of %s", name, model.ModelName)
+			if err := hooks.Check(util.ExpandHome(path), name); err != nil {
+				report.check(doctorFail, setting, err.Error(), "fix the script or remove "+name+" from the model's hooks")
+			} else {
+				report.check(doctorPass, setting, path, "")
+			}
+		}
+	}
+	return appConfig, true
+}
+
+// doctorModel checks a model's provider, credentials and endpoint
+func doctorModel(report *doctorReport, model ModelConfig) {
+	modelConfig, err := applyModel(model)
+	if err != nil {
+		report.check(doctorFail, model.ModelName, err.Error(), "fix provider or endpoint in the config, or set the variable")
+		return
+	}
+	resolved, err := resolveAuth(modelConfig)
+	if err != nil {
+		names := modelConfig.Auth
+		if len(modelConfig.Keys) > 0 {
+			var vars []string
+			for _, key := range modelConfig.Keys {
+				vars = append(vars, key.EnvVar)
+			}
+			names = strings.Join(vars, " or ")
+		}
+		report.check(doctorFail, model.ModelName, "API key: "+err.Error(), fmt.Sprintf("export %s in your shell profile", names))
+		return
+	}
+	if doctorNoPing {
+		report.check(doctorPass, model.ModelName, "API key set (not pinged)", "")
+		return
+	}
+
+	elapsed, err := llm.NewLLMClient(resolved).Ping(20 * time.Second)
+	if err != nil {
+		report.check(doctorFail, model.ModelName, err.Error(), pingHint(err, resolved))
+		return
+	}
+	report.check(doctorPass, model.ModelName, fmt.Sprintf("%s answered in %dms", resolved.Endpoint, elapsed.Milliseconds()), "")
+}
+
+// pingHint suggests a fix for a failed ping
+func pingHint(err error, modelConfig ModelConfig) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "401") || strings.Contains(msg, "403"):
+		return "the endpoint rejected the API key; check it's valid for " + modelConfig.Endpoint
+	case strings.Contains(msg, "404"):
+		return "check the endpoint URL, and that the provider offers a model named " + modelConfig.ModelName
+	case strings.Contains(msg, "429"):
+		return "rate limited or out of credits; check your plan and billing"
+	case strings.Contains(msg, "connection refused"):
+		return "nothing is listening at " + modelConfig.Endpoint + "; is the server running?"
+	case strings.Contains(msg, "no such host"):
+		return "check the host name in the endpoint URL"
+	case strings.Contains(msg, "Client.Timeout") || strings.Contains(msg, "deadline exceeded"):
+		return "the endpoint didn't answer within 20s; check your network or the server"
+	case strings.Contains(msg, "request failed: 5"):
+		return "the provider may be having problems; try again later"
+	}
+	return ""
+}
+
+// doctorLogs checks the logs database opens and passes SQLite's integrity check
+func doctorLogs(report *doctorReport, sinkConfig *LogSinkConfig) {
+	if os.Getenv("SHELL_AI_DISABLE_LOGGING") != "" {
+		report.check(doctorWarn, "Logging", "disabled by SHELL_AI_DISABLE_LOGGING", "")
+		return
+	}
+	reqLogger, err := logger.NewRequestLogger()
+	if err != nil {
+		report.check(doctorFail, "Logs database", err.Error(), "check ~/.shell-ai is writable, or move logs.db aside to start a new one")
+		return
+	}
+	defer reqLogger.Close()
+	problems, err := reqLogger.IntegrityCheck()
+	if err != nil {
+		report.check(doctorFail, "Logs database", err.Error(), "move "+reqLogger.GetDBPath()+" aside to start a new one")
+		return
+	}
+	if len(problems) > 0 {
+		detail := problems[0]
+		if len(problems) > 1 {
+			detail += fmt.Sprintf(" (and %d more)", len(problems)-1)
+		}
+		report.check(doctorFail, "Logs database", detail,
+			"recover it with `sqlite3 "+reqLogger.GetDBPath()+" .recover`, or move it aside to start a new one")
+		return
+	}
+	report.check(doctorPass, "Logs database", reqLogger.GetDBPath(), "")
+	if sinkConfig != nil {
+		doctorSink(report, reqLogger, sinkConfig)
+	}
+}
+
+// doctorSink checks the log sink can be set up and is keeping up
+func doctorSink(report *doctorReport, reqLogger *logger.RequestLogger, cfg *LogSinkConfig) {
+	if _, err := sink.New(cfg); err != nil {
+		report.check(doctorFail, "Log sink", err.Error(), "fix log_sink under preferences")
+		return
+	}
+	target := cfg.URL
+	if cfg.S3 != nil {
+		target = "s3://" + cfg.S3.Bucket
+	}
+	queued, failed, err := reqLogger.SinkQueue()
+	switch {
+	case err != nil:
+		report.check(doctorFail, "Log sink", err.Error(), "")
+	case failed > 0:
+		report.check(doctorWarn, "Log sink", fmt.Sprintf("%s: %d of %d queued records failed to send", target, failed, queued),
+			"see `q logs errors --kind sink`, and retry now with `q logs ship`")
+	default:
+		report.check(doctorPass, "Log sink", fmt.Sprintf("%s, %d records queued", target, queued), "")
+	}
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"q/logger"
+	. "q/types"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// draftDelay is how long typing has to pause before the draft is saved
+const draftDelay = 500 * time.Millisecond
+
+// saveDraftMsg saves the draft unless it changed again since the pause began
+type saveDraftMsg struct{ seq int }
+
+// drafts keeps what's typed in an interactive session in the logs database,
+// so a closed terminal or a stray Ctrl-C doesn't lose a long prompt. The next
+// session that isn't given a prompt restores it.
+type drafts struct {
+	logger  *logger.RequestLogger
+	session string
+	// seq counts changes to the input; saved is the text last saved
+	seq   int
+	saved string
+	sent  bool
+}
+
+// openDrafts returns the session's drafts, or nil if the logs can't be opened
+func openDrafts() *drafts {
+	reqLogger, err := logger.Shared()
+	if err != nil {
+		return nil
+	}
+	return &drafts{logger: reqLogger, session: logger.NewConversationID()}
+}
+
+// changed schedules saving the input once typing pauses
+func (d *drafts) changed() tea.Cmd {
+	if d == nil {
+		return nil
+	}
+	d.seq++
+	seq := d.seq
+	return tea.Tick(draftDelay, func(time.Time) tea.Msg { return saveDraftMsg{seq} })
+}
+
+// save keeps text as the session's draft; sent marks one whose answer hasn't
+// arrived yet
+func (d *drafts) save(text string, sent bool) {
+	if d == nil || (text == d.saved && sent == d.sent) {
+		return
+	}
+	err := d.logger.SaveDraft(Draft{Session: d.session, PID: os.Getpid(), Text: text, Sent: sent})
+	if err == nil {
+		d.saved, d.sent = text, sent
+	}
+}
+
+// drop forgets the draft, once it's answered
+func (d *drafts) drop() {
+	d.save("", false)
+}
+
+// restore takes the draft a session that's over left behind, returning it
+// with a note saying where it came from, or "" if there's none
+func (d *drafts) restore() (string, string) {
+	if d == nil {
+		return "", ""
+	}
+	draft, err := d.logger.TakeDraft(processRunning)
+	if err != nil || draft == nil {
+		return "", ""
+	}
+	note := fmt.Sprintf("Restored the prompt you were writing %s (Ctrl+U clears it).", draftTime(draft.SavedAt))
+	if draft.Sent {
+		note = fmt.Sprintf("Restored the prompt sent %s, which was never answered (Ctrl+U clears it).", draftTime(draft.SavedAt))
+	}
+	d.save(draft.Text, false)
+	return draft.Text, lipgloss.NewStyle().Faint(true).Render(note)
+}
+
+// draftTime says when a draft was saved: the time today, else the date
+func draftTime(t time.Time) string {
+	t = t.Local()
+	if t.Format("2006-01-02") == time.Now().Format("2006-01-02") {
+		return "at " + t.Format("15:04")
+	}
+	return "on " + t.Format("Jan 2 at 15:04")
+}
+
+// processRunning reports whether the process with the ID still runs. Windows
+// can't be asked, so its sessions are all taken as over.
+func processRunning(pid int) bool {
+	if pid <= 0 || pid == os.Getpid() {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
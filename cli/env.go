@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"os"
+
+	"q/config"
+	"q/envcontext"
+	"q/llm"
+	. "q/types"
+)
+
+var (
+	envFlag bool
+	// envNames are the variables the running session attaches, or nil if it
+	// doesn't (see env_context); they're attached once, then left pinned
+	envNames []string
+)
+
+// envContextNames are the variables to attach with env_context on or --env
+func envContextNames(appConfig config.AppConfig) []string {
+	if !envFlag && !appConfig.Preferences.EnvContext {
+		return nil
+	}
+	return append(append([]string(nil), envcontext.Defaults...), appConfig.Preferences.EnvVars...)
+}
+
+// attachEnv pins the environment variables to the client's context, with
+// --env for the first prompt, else for the first that looks like a tooling
+// or build error
+func attachEnv(c *llm.LLMClient, query string) {
+	if envNames == nil || !envFlag && !envcontext.LooksLikeError(query) {
+		return
+	}
+	vars := envcontext.Collect(envNames, os.Getenv)
+	envNames = nil
+	if len(vars) == 0 {
+		return
+	}
+	c.Pin(Message{
+		Role: "system",
+		Content: "Here are some of the user's environment variables, which may explain a problem with their tools. " +
+			"Values shown as sha256: hashes are secrets:\n\n```\n" + envcontext.Format(vars) + "\n```",
+	})
+}
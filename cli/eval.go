@@ -0,0 +1,321 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/eval"
+	"q/llm"
+	"q/logger"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	evalModels     []string
+	evalJudgeModel string
+	evalFromLogs   int
+	evalSave       string
+	evalJSON       bool
+)
+
+var evalCmd = &cobra.Command{
+	Use:   "eval [suite.yaml]",
+	Short: "Compare models on a suite of prompts, checking and grading their answers",
+	Long: `Send each prompt of a suite to one or more models and check the answers:
+with text they must or must not contain, regular expressions they must or
+must not match, a shell command that must succeed, and a judge model's grade
+from 1 to 5, with min_score to fail the case below it. The report compares the
+models' pass rates, grades, speed and cost, and says when a cheaper model did
+as well as the best, which is worth knowing before changing the default.
+
+A suite is a YAML file:
+
+  models: [gpt-4.1, gpt-4.1-mini]
+  judge: gpt-4.1
+  cases:
+    - prompt: list files by size, largest first
+      expect:
+        regex: 'ls .*-\w*S'
+        not_regex: 'rm '
+    - prompt: count the lines of all go files
+      expect:
+        exec: 'echo "$Q_COMMAND" | grep -q wc'
+        judge: counts the lines of every .go file, recursively
+
+An exec command gets the answer on stdin, and its first code block in
+$Q_COMMAND. A case with judge criteria, or a reference answer, is graded by
+the judge: --judge-model, the suite's judge, the judge_model preference, or
+else the default model.
+
+--from-logs replays the prompts of your recent sessions instead, with the
+answers they got as references. Add --save to write them as a suite to edit
+and run again.
+
+  q eval suite.yaml --model gpt-4.1,gpt-4.1-mini
+  q eval --from-logs 20 --model gpt-4.1-mini
+  q eval --from-logs 20 --save suite.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runEvalCommand,
+}
+
+func init() {
+	evalCmd.Flags().StringSliceVarP(&evalModels, "model", "m", nil, "Models to evaluate (default: the suite's, or the default model)")
+	evalCmd.Flags().StringVar(&evalJudgeModel, "judge-model", "", "Model that grades the answers")
+	evalCmd.Flags().IntVar(&evalFromLogs, "from-logs", 0, "Replay this many recent prompts from the logs, graded against the answers they got")
+	evalCmd.Flags().StringVar(&evalSave, "save", "", "With --from-logs, write the prompts to this suite file instead of running them")
+	evalCmd.Flags().BoolVar(&evalJSON, "json", false, "Output every result and the summaries in JSON format")
+	RootCmd.AddCommand(evalCmd)
+}
+
+func runEvalCommand(cmd *cobra.Command, args []string) {
+	var suite eval.Suite
+	var err error
+	switch {
+	case len(args) == 1 && evalFromLogs > 0:
+		evalFail("give a suite file or --from-logs, not both")
+	case len(args) == 1:
+		suite, err = eval.LoadSuite(args[0])
+	case evalFromLogs > 0:
+		suite, err = suiteFromLogs(evalFromLogs)
+	default:
+		evalFail("give a suite file, or --from-logs to replay logged prompts")
+	}
+	if err != nil {
+		evalFail(err.Error())
+	}
+	if evalSave != "" {
+		if evalFromLogs == 0 {
+			evalFail("--save only works with --from-logs")
+		}
+		data, _ := yaml.Marshal(suite)
+		if err := os.WriteFile(evalSave, data, 0644); err != nil {
+			evalFail(err.Error())
+		}
+		n := len(suite.Cases)
+		fmt.Printf("Saved %d %s to %s; run it with q eval %s\n", n, pluralize(n, "case", "cases"), evalSave, evalSave)
+		return
+	}
+
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		config.PrintConfigErrorMessage(err)
+		os.Exit(exitStatus)
+	}
+	names := evalModels
+	if len(names) == 0 {
+		names = suite.Models
+	}
+	if len(names) == 0 {
+		defaultConfig, err := getModelConfig(appConfig)
+		if err != nil {
+			evalFail(err.Error())
+		}
+		names = []string{defaultConfig.ModelName}
+	}
+	var models []ModelConfig
+	for _, name := range names {
+		modelConfig, err := findModelConfig(appConfig, name)
+		if err != nil {
+			evalFail(err.Error())
+		}
+		models = append(models, modelConfig)
+	}
+	judge := evalJudge(appConfig, suite)
+
+	styleDim := lipgloss.NewStyle().Faint(true)
+	var results []eval.Result
+	for _, modelConfig := range models {
+		for i, c := range suite.Cases {
+			if !evalJSON {
+				fmt.Fprintln(util.Notes(), styleDim.Render(fmt.Sprintf("%s: case %d of %d...", modelConfig.ModelName, i+1, len(suite.Cases))))
+			}
+			results = append(results, evalCase(appConfig, modelConfig, "", judge, i, c))
+		}
+	}
+
+	summaries := eval.Summarize(results)
+	if evalJSON {
+		data, _ := json.MarshalIndent(struct {
+			Results   []eval.Result  `json:"results"`
+			Summaries []eval.Summary `json:"summaries"`
+		}{results, summaries}, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	printEvalReport(results, summaries)
+}
+
+// evalJudge is the client that grades answers, or nil if no case needs one
+func evalJudge(appConfig config.AppConfig, suite eval.Suite) *llm.LLMClient {
+	judged := false
+	for _, c := range suite.Cases {
+		judged = judged || c.Judged()
+	}
+	if !judged {
+		return nil
+	}
+	name := evalJudgeModel
+	for _, candidate := range []string{suite.Judge, appConfig.Preferences.JudgeModel} {
+		if name == "" {
+			name = candidate
+		}
+	}
+	if name == "" {
+		defaultConfig, err := getModelConfig(appConfig)
+		if err != nil {
+			evalFail("judge: " + err.Error())
+		}
+		name = defaultConfig.ModelName
+	}
+	judgeConfig, err := findModelConfig(appConfig, name)
+	if err != nil {
+		evalFail("judge: " + err.Error())
+	}
+	judge := llm.NewLLMClient(judgeConfig)
+	judge.ErrorLog = appConfig.Preferences.ErrorLog
+	return judge
+}
+
+// evalCase sends a case's prompt to a model, as a request of its own, and
+// checks the answer. persona names the persona applied to the model, if any.
+func evalCase(appConfig config.AppConfig, modelConfig ModelConfig, persona string, judge *llm.LLMClient, i int, c eval.Case) eval.Result {
+	result := eval.Result{Case: i + 1, Label: c.Label(), Model: modelConfig.ModelName}
+	client := llm.NewLLMClient(modelConfig)
+	client.ErrorLog = appConfig.Preferences.ErrorLog
+	client.Persona = persona
+	client.ConversationID = ""
+	start := time.Now()
+	answer, err := client.Query(c.Prompt)
+	result.DurationMs = time.Since(start).Milliseconds()
+	result.Cost = client.LastEntry().EstimatedCost
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Answer = answer
+	result.Failures = eval.Check(c, answer)
+	if judge != nil && c.Judged() {
+		score, reason, err := judge.Score(c.Prompt, answer, c.Expect.Judge, c.Reference)
+		if err != nil {
+			reason := "not graded: " + firstLine(err.Error())
+			if c.Expect.MinScore > 0 {
+				result.Failures = append(result.Failures, reason)
+			} else {
+				result.Reason = reason
+			}
+		} else {
+			result.Score, result.Reason = score, reason
+			if failure := eval.CheckScore(c, score); failure != "" {
+				result.Failures = append(result.Failures, failure)
+			}
+		}
+	}
+	return result
+}
+
+// suiteFromLogs makes a suite of the last n distinct prompts of interactive
+// sessions that were answered, with their answers as references. Prompts
+// sent on their own, like q eval's, have no conversation and are left out.
+func suiteFromLogs(n int) (eval.Suite, error) {
+	reqLogger, err := logger.Shared()
+	if err != nil {
+		return eval.Suite{}, err
+	}
+	entries, err := reqLogger.GetRecentResponses(n * 10)
+	if err != nil {
+		return eval.Suite{}, err
+	}
+	suite := eval.Suite{Name: "prompts from the logs"}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		prompt := strings.TrimSpace(userPrompt(entry))
+		if entry.ConversationID == "" || entry.Error != "" || entry.Interrupted || entry.ContextNote != "" || prompt == "" || seen[prompt] {
+			continue
+		}
+		seen[prompt] = true
+		suite.Cases = append(suite.Cases, eval.Case{Prompt: prompt, Reference: entry.Response})
+		if len(suite.Cases) == n {
+			break
+		}
+	}
+	if len(suite.Cases) == 0 {
+		return suite, fmt.Errorf("the logs have no answered prompts to replay")
+	}
+	return suite, nil
+}
+
+// printEvalReport shows each model's summary, the cases that failed, and
+// whether a cheaper model did as well as the best
+func printEvalReport(results []eval.Result, summaries []eval.Summary) {
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	redStyle := lipgloss.NewStyle().Foreground(theme.Error())
+	greenStyle := lipgloss.NewStyle().Foreground(theme.Success())
+
+	width := len("Model")
+	for _, s := range summaries {
+		if len(s.Model) > width {
+			width = len(s.Model)
+		}
+	}
+	fmt.Println(headerStyle.Render(fmt.Sprintf("  %-*s  %8s  %6s  %8s  %9s", width, "Model", "Passed", "Grade", "Time", "Cost")))
+	for _, s := range summaries {
+		grade := "-"
+		if s.Judged > 0 {
+			grade = fmt.Sprintf("%.1f/%d", s.Score, llm.MaxScore)
+		}
+		fmt.Printf("  %-*s  %8s  %6s  %8s  %9s\n", width, s.Model, fmt.Sprintf("%d/%d", s.Passed, s.Cases), grade,
+			benchTime(s.DurationMs, Benchmark{Runs: 1}), fmt.Sprintf("$%.4f", s.Cost))
+	}
+
+	var failed []eval.Result
+	for _, r := range results {
+		if !r.Passed() || r.Score <= 2 && r.Reason != "" {
+			failed = append(failed, r)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Println()
+		fmt.Println(headerStyle.Render("Failed, graded low or not graded"))
+	}
+	for _, r := range failed {
+		fmt.Printf("  %s %s\n", dimStyle.Render(fmt.Sprintf("%s, case %d:", r.Model, r.Case)), r.Label)
+		var problems []string
+		if r.Error != "" {
+			problems = append(problems, "error: "+firstLine(r.Error))
+		}
+		problems = append(problems, r.Failures...)
+		if r.Score > 0 {
+			problems = append(problems, fmt.Sprintf("graded %d: %s", r.Score, r.Reason))
+		} else if r.Reason != "" {
+			problems = append(problems, r.Reason)
+		}
+		for _, problem := range problems {
+			fmt.Println("    " + redStyle.Render(problem))
+		}
+	}
+
+	if cheaper, best, ok := eval.Cheaper(summaries); ok {
+		share := 0.0
+		if best.Cost > 0 {
+			share = cheaper.Cost / best.Cost * 100
+		}
+		fmt.Printf("\n%s did as well as %s at %.0f%% of the cost.\n", greenStyle.Render(cheaper.Model), best.Model, share)
+	}
+}
+
+func evalFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
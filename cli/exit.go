@@ -0,0 +1,17 @@
+package cli
+
+import (
+	"q/exitcode"
+)
+
+// exitStatus is the status the commands' fail helpers exit with. It stays
+// exitcode.Failure unless requestError set it for a failed model request.
+var exitStatus = exitcode.Failure
+
+// requestError returns the message of an error from a model request, and has
+// the next fail helper exit with the status for it (see q/exitcode), so
+// scripts can tell a rejected key or an outage from a usage mistake
+func requestError(err error) string {
+	exitStatus = exitcode.For(err)
+	return err.Error()
+}
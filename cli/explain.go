@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"q/llm"
+	"q/safety"
+	"q/theme"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// maxPartWidth caps the width of the first column of the breakdown
+const maxPartWidth = 28
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <command>",
+	Short: "Explain a shell command flag by flag",
+	Long: `Explain what a shell command does, part by part, as a table. Parts that
+delete, overwrite or are otherwise hard to undo are highlighted, and safety
+notes are listed below. Quote the command so your shell doesn't run its pipes
+or redirections, or pipe it in:
+
+  q explain 'tar -xzvf file.tgz'
+  q explain 'find . -name "*.log" -mtime +7 -delete'
+  history | tail -1 | cut -c8- | q explain`,
+	Run: runExplainCommand,
+}
+
+func init() {
+	addQuietFlag(explainCmd)
+	RootCmd.AddCommand(explainCmd)
+}
+
+func runExplainCommand(cmd *cobra.Command, args []string) {
+	command := strings.Join(args, " ")
+	if command == "" {
+		if util.IsTerminal(os.Stdin) {
+			explainFail("give a command to explain, or pipe one in")
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			explainFail(err.Error())
+		}
+		command = strings.TrimSpace(string(data))
+	}
+	if command == "" {
+		explainFail("there is no command to explain")
+	}
+
+	appConfig, modelConfig := loadModelConfig()
+	c := llm.NewLLMClient(modelConfig)
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	explanation, err := c.Explain(command)
+	if err != nil {
+		explainFail(requestError(err))
+	}
+	findings := safety.Analyze(command)
+
+	plain := quietFlag || !util.IsTerminal(os.Stdout)
+	fmt.Fprint(answerOut, renderExplanation(command, explanation, findings, plain))
+}
+
+// renderExplanation lays out the breakdown as a two-column table with the
+// analyzer's findings and the model's notes below. plain leaves out colors.
+func renderExplanation(command string, explanation llm.Explanation, findings []safety.Finding, plain bool) string {
+	style := func(s lipgloss.Style) lipgloss.Style {
+		if plain {
+			return lipgloss.NewStyle()
+		}
+		return s
+	}
+	commandStyle := style(lipgloss.NewStyle().Bold(true).Foreground(theme.Accent()))
+	partStyle := style(lipgloss.NewStyle().Foreground(theme.Info()))
+	dangerStyle := style(lipgloss.NewStyle().Bold(true).Foreground(theme.Error()))
+	cautionStyle := style(lipgloss.NewStyle().Foreground(theme.Highlight()))
+	dimStyle := style(lipgloss.NewStyle().Faint(true))
+
+	width := util.GetTermSafeMaxWidth()
+	partWidth := 0
+	for _, part := range explanation.Parts {
+		if w := lipgloss.Width(part.Part); w > partWidth {
+			partWidth = w
+		}
+	}
+	if partWidth > maxPartWidth {
+		partWidth = maxPartWidth
+	}
+	meaningWidth := width - partWidth - 5
+	if meaningWidth < 20 {
+		meaningWidth = 20
+	}
+
+	var b strings.Builder
+	b.WriteString("\n  " + commandStyle.Render(command) + "\n\n")
+	if explanation.Summary != "" {
+		b.WriteString(lipgloss.NewStyle().Width(width-2).PaddingLeft(2).Render(explanation.Summary) + "\n\n")
+	}
+	for _, part := range explanation.Parts {
+		severity := flagged(part.Part, findings)
+		cell := partStyle
+		marker := "  "
+		switch severity {
+		case safety.Danger:
+			cell, marker = dangerStyle, dangerStyle.Render("✗ ")
+		case safety.Caution:
+			cell, marker = cautionStyle, cautionStyle.Render("! ")
+		}
+		left := cell.Copy().Width(partWidth).Render(part.Part)
+		right := lipgloss.NewStyle().Width(meaningWidth).Render(part.Meaning)
+		b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, marker, left, "  ", right) + "\n")
+	}
+
+	if len(findings) > 0 || len(explanation.Notes) > 0 {
+		b.WriteString("\n")
+		for _, finding := range findings {
+			label := cautionStyle.Render("  Caution: ")
+			if finding.Severity == safety.Danger {
+				label = dangerStyle.Render("  Danger: ")
+			}
+			b.WriteString(label + "`" + strings.Join(finding.Words, " ") + "` " + finding.Reason + "\n")
+		}
+		for _, note := range explanation.Notes {
+			b.WriteString(lipgloss.NewStyle().Width(width-2).PaddingLeft(2).Render(dimStyle.Render("• "+note)) + "\n")
+		}
+	}
+	b.WriteString("\n")
+
+	// Drop the padding lipgloss adds to fill each cell's width
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// flagged returns the severity of the worst finding a part of the breakdown
+// belongs to: every word of the part is among the finding's words, or a short
+// flag like -f is one of the letters of a combined flag like -rf
+func flagged(part string, findings []safety.Finding) safety.Severity {
+	var worst safety.Severity
+	words := safety.Split(part)
+	if len(words) == 0 {
+		return 0
+	}
+	for _, finding := range findings {
+		matched := true
+		for _, word := range words {
+			if !findingHas(finding, word) {
+				matched = false
+				break
+			}
+		}
+		if matched && finding.Severity > worst {
+			worst = finding.Severity
+		}
+	}
+	return worst
+}
+
+func findingHas(finding safety.Finding, word string) bool {
+	for _, w := range finding.Words {
+		if w == word {
+			return true
+		}
+		// -f within -rf
+		if len(word) == 2 && word[0] == '-' && word[1] != '-' && len(w) > 2 && w[0] == '-' && w[1] != '-' &&
+			strings.ContainsRune(w[1:], rune(word[1])) {
+			return true
+		}
+	}
+	return false
+}
+
+func explainFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(exitStatus)
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"q/config"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// defaultFooterFields are what the footer shows unless footer_fields says
+var defaultFooterFields = []string{"model", "tokens", "cost", "duration"}
+
+// footerFields are what the footer after each answer shows, or nil when
+// it's off (see answerFooter)
+var footerFields []string
+
+// footerSettings returns the fields of the footer preference, or nil when
+// it's off or the output isn't a terminal, where it would end up in a file
+// or another program's input
+func footerSettings(appConfig config.AppConfig) []string {
+	if !appConfig.Preferences.Footer || !util.IsTerminal(os.Stdout) {
+		return nil
+	}
+	if len(appConfig.Preferences.FooterFields) > 0 {
+		return appConfig.Preferences.FooterFields
+	}
+	return defaultFooterFields
+}
+
+// answerFooter is the line shown after an answer with what it took, like
+// "gpt-4.1 · 812 in / 96 out tokens · $0.0024 · 2.4s". Counts estimated
+// because the provider sent none are marked with a ~.
+func answerFooter(entry LogEntry, fields []string, width int) string {
+	if len(fields) == 0 || entry.Model == "" {
+		return ""
+	}
+	approx := ""
+	if entry.TokensEstimated {
+		approx = "~"
+	}
+	var parts []string
+	for _, field := range fields {
+		switch field {
+		case "model":
+			parts = append(parts, entry.Model)
+		case "tokens":
+			parts = append(parts, fmt.Sprintf("%s%d in / %d out tokens", approx, entry.PromptTokens, entry.CompletionTokens))
+		case "cost":
+			parts = append(parts, fmt.Sprintf("%s$%.4f", approx, entry.EstimatedCost))
+		case "duration":
+			parts = append(parts, fmt.Sprintf("%.1fs", float64(entry.DurationMs)/1000))
+		}
+	}
+	styleDim := lipgloss.NewStyle().Faint(true).Width(width).PaddingLeft(2)
+	return "\n\n" + styleDim.Render(strings.Join(parts, " · "))
+}
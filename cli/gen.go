@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"q/llm"
+	"q/theme"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// generator is a kind of file `q gen` writes
+type generator struct {
+	name   string
+	prompt string
+	// validator checks the file on stdin, exiting non-zero with its problems
+	validator string
+}
+
+var generators = []generator{
+	{
+		name: "dockerfile",
+		prompt: "Write a Dockerfile for the user's description. Follow best practices: pin base image " +
+			"tags, combine and clean up package installs, and don't run as root unless needed. " +
+			"Reply with only the Dockerfile in a single code block.",
+		validator: "hadolint -",
+	},
+	{
+		name: "k8s",
+		prompt: "Write Kubernetes manifests for the user's description, as YAML documents separated " +
+			"by ---. Set resource requests and limits, and labels that selectors match. " +
+			"Reply with only the YAML in a single code block.",
+		validator: "kubeconform -strict -summary -",
+	},
+}
+
+var (
+	genOutput string
+	genTries  int
+)
+
+var genCmd = &cobra.Command{
+	Use:   "gen",
+	Short: "Generate Dockerfiles and Kubernetes manifests, checked by a validator",
+	Long: `Generate a file for a description and check it with a local validator,
+sending any problems back to the model until it passes or --tries run out.
+Dockerfiles are checked with hadolint and Kubernetes manifests with
+kubeconform, when they're installed. Set validators under preferences to use
+other commands, or "off" to skip checking.
+
+  q gen dockerfile "a Go web service, built in a separate stage" -o Dockerfile
+  q gen k8s "a deployment of nginx with 3 replicas and a service" | kubectl apply -f -`,
+}
+
+func init() {
+	for _, g := range generators {
+		g := g
+		cmd := &cobra.Command{
+			Use:   g.name + " <description>",
+			Short: "Generate a " + g.name + " file",
+			Args:  cobra.MinimumNArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				runGenerator(g, strings.Join(args, " "))
+			},
+		}
+		cmd.Flags().StringVarP(&genOutput, "output", "o", "", "Write the file here instead of to stdout")
+		cmd.Flags().IntVar(&genTries, "tries", 3, "How many versions to try before giving up")
+		addQuietFlag(cmd)
+		genCmd.AddCommand(cmd)
+	}
+	RootCmd.AddCommand(genCmd)
+}
+
+func runGenerator(g generator, description string) {
+	appConfig, modelConfig := loadModelConfig()
+	validator := g.validator
+	if custom, ok := appConfig.Preferences.Validators[g.name]; ok {
+		validator = custom
+	}
+	styleDim := lipgloss.NewStyle().Faint(true)
+	if validator == "off" {
+		validator = ""
+	} else if name := strings.Fields(validator); len(name) > 0 {
+		if _, err := exec.LookPath(name[0]); err != nil {
+			fmt.Fprintln(util.Notes(), styleDim.Render(name[0]+" isn't installed, so the result won't be checked"))
+			validator = ""
+		}
+	}
+
+	c := llm.NewLLMClient(modelConfig)
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	attempts, err := c.Refine(g.prompt, "Description: "+description, genTries, "gen "+g.name, func(file string) (string, error) {
+		if validator == "" {
+			return "", nil
+		}
+		fmt.Fprintln(util.Notes(), styleDim.Render("Checking with "+strings.Fields(validator)[0]+"..."))
+		return runValidator(validator, file), nil
+	})
+	if err != nil || len(attempts) == 0 || attempts[len(attempts)-1].Feedback != "" {
+		finishGenerator(attempts, err, "")
+	}
+	file := attempts[len(attempts)-1].Answer + "\n"
+	if validator != "" {
+		summary := "✓ Passes " + strings.Fields(validator)[0]
+		if len(attempts) > 1 {
+			summary += fmt.Sprintf(" (try %d)", len(attempts))
+		}
+		fmt.Fprintln(util.Notes(), lipgloss.NewStyle().Foreground(theme.Success()).Render(summary))
+	}
+	if genOutput == "" {
+		fmt.Fprint(answerOut, file)
+		return
+	}
+	if err := os.WriteFile(genOutput, []byte(file), 0644); err != nil {
+		generatorFail(err.Error())
+	}
+	fmt.Fprintln(util.Notes(), styleDim.Render("Saved to "+genOutput))
+}
+
+// runValidator runs a validator command with file on stdin, returning its
+// output if it found problems
+func runValidator(command, file string) string {
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(file)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		problems := strings.TrimSpace(out.String())
+		if problems == "" {
+			problems = err.Error()
+		}
+		return "The validator reported problems:\n" + problems
+	}
+	return ""
+}
@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/llm"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// thumbnailSize is the longest side of the thumbnails kept for `q logs`
+const thumbnailSize = 256
+
+var (
+	imageSize    string
+	imageQuality string
+	imageOutput  string
+	imageModel   string
+	imageOpen    bool
+)
+
+var imageCmd = &cobra.Command{
+	Use:   "image <prompt>",
+	Short: "Generate an image",
+	Long: `Generate an image with gpt-image-1 (or preferences.image_model, or --model)
+using the default model's endpoint and API key, and save it to a file. A small
+thumbnail is kept in ~/.shell-ai/thumbnails, and the image, its size, quality
+and price are logged for ` + "`q logs`" + `.
+
+  q image "a lighthouse at dusk, watercolor"
+  q image "app icon of a terminal with a sparkle" --size 1024x1024 --quality high -o icon.png --open
+
+Sizes are 1024x1024, 1536x1024 and 1024x1536 for gpt-image-1, and 1024x1024,
+1792x1024 and 1024x1792 for dall-e-3. Quality is low, medium (the default) or
+high for gpt-image-1, and standard (the default) or hd for dall-e-3.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runImageCommand,
+}
+
+func init() {
+	imageCmd.Flags().StringVar(&imageSize, "size", "1024x1024", "Image size, as WIDTHxHEIGHT")
+	imageCmd.Flags().StringVar(&imageQuality, "quality", "", "Image quality (default medium, or standard for dall-e-3)")
+	imageCmd.Flags().StringVarP(&imageOutput, "output", "o", "", "File to save the image to (default image-<time>.png)")
+	imageCmd.Flags().StringVar(&imageModel, "model", "", "Image model (default preferences.image_model, or gpt-image-1)")
+	imageCmd.Flags().BoolVar(&imageOpen, "open", false, "Open the image in the default viewer")
+	RootCmd.AddCommand(imageCmd)
+}
+
+func runImageCommand(cmd *cobra.Command, args []string) {
+	prompt := strings.Join(args, " ")
+	appConfig, modelConfig := loadModelConfig()
+
+	opts := llm.ImageOptions{Model: imageModel, Size: imageSize, Quality: imageQuality}
+	if opts.Model == "" {
+		opts.Model = appConfig.Preferences.ImageModel
+	}
+	if opts.Model == "" {
+		opts.Model = llm.DefaultImageModel
+	}
+	if opts.Quality == "" {
+		opts.Quality = llm.DefaultImageQuality(opts.Model)
+	}
+
+	c := llm.NewLLMClient(modelConfig)
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fmt.Fprintln(util.Notes(), styleDim.Render(fmt.Sprintf("Generating a %s image with %s...", opts.Size, opts.Model)))
+
+	start := time.Now()
+	generated, err := c.GenerateImage(prompt, opts)
+	var record *ImageRecord
+	if err == nil {
+		record, err = saveImage(generated.Data, opts)
+	}
+	c.LogImage(prompt, opts, generated, record, time.Since(start).Milliseconds(), err)
+	if err != nil {
+		imageFail(requestError(err))
+	}
+
+	if generated.RevisedPrompt != "" {
+		fmt.Fprintln(util.Notes(), styleDim.Render("Revised prompt: "+generated.RevisedPrompt))
+	}
+	fmt.Println(record.Path)
+	if imageOpen {
+		if err := util.OpenBrowser(record.Path); err != nil {
+			fmt.Fprintf(util.Notes(), "Warning: failed to open the image: %v\n", err)
+		}
+	}
+}
+
+// saveImage writes the image to --output (or a timestamped file in the
+// current directory) and a thumbnail of it next to the logs
+func saveImage(data []byte, opts llm.ImageOptions) (*ImageRecord, error) {
+	path := imageOutput
+	if path == "" {
+		path = "image-" + time.Now().Format("20060102-150405") + imageExtension(data)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save the image: %w", err)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	record := &ImageRecord{Path: path, Size: opts.Size, Quality: opts.Quality}
+
+	thumbnail, err := writeThumbnail(data, filepath.Base(path))
+	if err != nil {
+		fmt.Fprintf(util.Notes(), "Warning: no thumbnail: %v\n", err)
+	}
+	record.Thumbnail = thumbnail
+	return record, nil
+}
+
+// imageExtension picks a file extension from the image's contents
+func imageExtension(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	}
+	return ".png"
+}
+
+// writeThumbnail saves a scaled-down PNG of the image in ~/.shell-ai/thumbnails
+func writeThumbnail(data []byte, name string) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	configPath, err := config.Path()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(filepath.Dir(configPath), "thumbnails")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	// Name it after the image, numbered if an earlier one had the same name
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	var path string
+	var file *os.File
+	for i := 1; ; i++ {
+		path = filepath.Join(dir, stem+".png")
+		if i > 1 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d.png", stem, i))
+		}
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if err := png.Encode(file, shrink(img, thumbnailSize)); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// shrink scales img down to fit within size pixels, averaging the source
+// pixels behind each thumbnail pixel
+func shrink(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	tw, th := w, h
+	if w >= h && w > size {
+		tw, th = size, h*size/w
+	} else if h > w && h > size {
+		tw, th = w*size/h, size
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	thumb := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := bounds.Min.Y+ty*h/th, bounds.Min.Y+(ty+1)*h/th
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := bounds.Min.X+tx*w/tw, bounds.Min.X+(tx+1)*w/tw
+			var r, g, b, a, n uint32
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := img.At(x, y).RGBA()
+					r, g, b, a, n = r+pr, g+pg, b+pb, a+pa, n+1
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			thumb.Set(tx, ty, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+	return thumb
+}
+
+func imageFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(exitStatus)
+}
@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+
+	"q/llm"
+
+	"github.com/spf13/cobra"
+)
+
+// maxJQSample caps how much of the --test data is shown to the model
+const maxJQSample = 3000
+
+var (
+	jqTest   string
+	jqExpect string
+	jqTries  int
+)
+
+var jqCmd = &cobra.Command{
+	Use:   "jq <description>",
+	Short: "Write a jq filter, tested against sample data",
+	Long: `Write a jq filter for a description. With --test, the model sees the start
+of the file, and the filter is run on it with jq: an error, no output, or only
+null sends the problem back to the model until the filter works or --tries run
+out. With --expect, the output must also equal the JSON values in that file.
+
+  q jq "get all author names" --test data.json
+  q jq "count the open issues" --test issues.json --expect count.json`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runJQCommand,
+}
+
+func init() {
+	jqCmd.Flags().StringVar(&jqTest, "test", "", "JSON file to run the filter on")
+	jqCmd.Flags().StringVar(&jqExpect, "expect", "", "File with the JSON the filter should output (needs --test)")
+	jqCmd.Flags().IntVar(&jqTries, "tries", 3, "How many filters to try before giving up")
+	addQuietFlag(jqCmd)
+	RootCmd.AddCommand(jqCmd)
+}
+
+func runJQCommand(cmd *cobra.Command, args []string) {
+	if jqExpect != "" && jqTest == "" {
+		generatorFail("--expect needs --test")
+	}
+	request := "Description: " + strings.Join(args, " ")
+
+	var check func(string) (string, error)
+	if jqTest != "" {
+		if _, err := exec.LookPath("jq"); err != nil {
+			generatorFail("testing needs jq installed and in your PATH")
+		}
+		data, err := os.ReadFile(jqTest)
+		if err != nil {
+			generatorFail(err.Error())
+		}
+		var expected []interface{}
+		var expectText string
+		if jqExpect != "" {
+			expectData, err := os.ReadFile(jqExpect)
+			if err != nil {
+				generatorFail(err.Error())
+			}
+			if expected, err = decodeJSONValues(expectData); err != nil {
+				generatorFail(fmt.Sprintf("%s isn't JSON: %v", jqExpect, err))
+			}
+			expectText = strings.TrimSpace(string(expectData))
+		}
+		sample := string(data)
+		if len(sample) > maxJQSample {
+			sample = sample[:maxJQSample] + "\n... (truncated)"
+		}
+		request += "\n\nThe input looks like this:\n" + sample
+		if jqExpect != "" {
+			request += "\n\nThe output should be:\n" + expectText
+		}
+		check = func(filter string) (string, error) {
+			return checkJQ(filter, jqTest, expected), nil
+		}
+	} else {
+		check = func(string) (string, error) { return "", nil }
+	}
+
+	appConfig, modelConfig := loadModelConfig()
+	c := llm.NewLLMClient(modelConfig)
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	attempts, err := c.Refine(jqPrompt, request, jqTries, "jq", check)
+	passed := ""
+	switch {
+	case jqExpect != "":
+		passed = "Output matches " + jqExpect
+	case jqTest != "":
+		passed = "Runs on " + jqTest
+	}
+	finishGenerator(attempts, err, passed)
+}
+
+const jqPrompt = "Write a jq filter for the user's description. " +
+	"Reply with only the filter in a single code block, without the jq command or shell quotes."
+
+// checkJQ runs filter on the file at path, describing what went wrong for
+// the model, or returning "" if it worked
+func checkJQ(filter, path string, expected []interface{}) string {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("jq", "-c", filter, path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "jq failed: " + msg
+	}
+	values, err := decodeJSONValues(stdout.Bytes())
+	if err != nil {
+		return fmt.Sprintf("jq's output isn't JSON: %v", err)
+	}
+	if expected == nil {
+		for _, value := range values {
+			if value != nil {
+				return ""
+			}
+		}
+		if len(values) == 0 {
+			return "The filter ran but produced no output."
+		}
+		return "The filter ran but produced only null, so it likely doesn't match the structure of the input."
+	}
+	if reflect.DeepEqual(values, expected) {
+		return ""
+	}
+	got := strings.TrimSpace(stdout.String())
+	if len(got) > maxJQSample {
+		got = got[:maxJQSample] + "\n... (truncated)"
+	}
+	return "The output doesn't match what's expected. It was:\n" + got
+}
+
+// decodeJSONValues decodes a stream of JSON values, as jq reads and writes them
+func decodeJSONValues(data []byte) ([]interface{}, error) {
+	values := []interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+}
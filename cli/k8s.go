@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"q/kube"
+	"q/llm"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	k8sContext   string
+	k8sNamespace string
+)
+
+// kubectlParameters is the JSON schema of the kubectl tool's arguments
+const kubectlParameters = `{
+  "type": "object",
+  "properties": {
+    "args": {
+      "type": "array",
+      "items": {"type": "string"},
+      "description": "The arguments to kubectl, without kubectl itself, like [\"get\", \"pods\", \"-o\", \"wide\"]"
+    }
+  },
+  "required": ["args"]
+}`
+
+var k8sCmd = &cobra.Command{
+	Use:     "k8s [question]",
+	Aliases: []string{"kube"},
+	Short:   "Troubleshoot a Kubernetes cluster, with read-only kubectl commands run for the model",
+	Long: `Ask about a Kubernetes cluster. The model can run read-only kubectl
+commands (get, describe, logs, events, top, rollout status and the like)
+against the context and namespace of your current kubeconfig, so its answer
+is based on the cluster's real state. Commands that change anything, watch,
+or read secrets are refused, and output is redacted before it's sent.
+
+  q k8s why is the api deployment not ready
+  q k8s -n payments why do the pods keep restarting
+  q k8s --context staging what's using the most memory`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runK8s(strings.Join(args, " "))
+	},
+}
+
+func init() {
+	k8sCmd.Flags().StringVar(&k8sContext, "context", "", "The kubectl context to use (default: the current one)")
+	k8sCmd.Flags().StringVarP(&k8sNamespace, "namespace", "n", "", "The namespace to look in (default: the context's)")
+	addQuietFlag(k8sCmd)
+	RootCmd.AddCommand(k8sCmd)
+}
+
+func runK8s(question string) {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		k8sFail("kubectl isn't on the PATH")
+	}
+	target, err := kube.Current(kube.Kubectl)
+	if err != nil && k8sContext == "" {
+		k8sFail(err.Error())
+	}
+	if k8sContext != "" {
+		target.Context = k8sContext
+	}
+	if k8sNamespace != "" {
+		target.Namespace = k8sNamespace
+	}
+	if question == "" {
+		question = "Check the health of the workloads in this namespace and explain any problems."
+	}
+
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fmt.Fprintln(util.Notes(), styleDim.Render(fmt.Sprintf("Using context %s, namespace %s (read-only)", target.Context, target.Namespace)))
+
+	appConfig, modelConfig := loadModelConfig()
+	runSession(appConfig, modelConfig, question, func(c *llm.LLMClient) {
+		c.Tools = append(c.Tools, kubectlTool(target))
+		c.Pin(Message{
+			Role: "system",
+			Content: fmt.Sprintf("The user is troubleshooting the Kubernetes context %q, namespace %q. "+
+				"Use the kubectl tool to look at the cluster's real state before answering: start broad "+
+				"(get pods, events) and describe or read the logs of what looks wrong. "+
+				"Only these read-only commands run: %s. Secrets can't be read. "+
+				"Base your answer on what the commands showed, say which ones you ran, "+
+				"and give any fix as commands for the user to run themselves.",
+				target.Context, target.Namespace, strings.Join(kube.Commands(), ", ")),
+		})
+	})
+}
+
+// kubectlTool lets the model run read-only kubectl commands against target
+func kubectlTool(target kube.Target) llm.Tool {
+	return llm.Tool{
+		Name:        "kubectl",
+		Description: "Run a read-only kubectl command against the user's cluster and return its output.",
+		Parameters:  kubectlParameters,
+		Run: func(arguments string) string {
+			var call struct {
+				Args []string `json:"args"`
+			}
+			if err := json.Unmarshal([]byte(arguments), &call); err != nil {
+				return "Not run: the arguments aren't valid JSON: " + err.Error()
+			}
+			if len(call.Args) > 0 && call.Args[0] == "kubectl" {
+				call.Args = call.Args[1:]
+			}
+			return target.Run(call.Args, kube.Kubectl)
+		},
+	}
+}
+
+func k8sFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(1)
+}
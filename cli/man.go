@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"q/llm"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// maxManChars caps how much documentation is sent (roughly 8k tokens)
+const maxManChars = 32000
+
+var (
+	commandNamePattern = regexp.MustCompile(`^[A-Za-z0-9._+-]+$`)
+	// overstrike matches the "X\bX" bold and "_\bX" underline sequences man uses on terminals
+	overstrike = regexp.MustCompile(".\x08")
+)
+
+var manCmd = &cobra.Command{
+	Use:   "man <command> [question]",
+	Short: "Explain a command or its flags using its local man page",
+	Long: `Look up the man page (or --help output) of a command installed on this
+machine and ask about it, so answers match the installed version.
+
+  q man tar
+  q man rsync how do I mirror a directory and delete extra files
+  q man find what does -prune do`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runMan(args[0], strings.Join(args[1:], " "))
+	},
+}
+
+func init() {
+	addQuietFlag(manCmd)
+	RootCmd.AddCommand(manCmd)
+}
+
+func runMan(command, question string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	if !commandNamePattern.MatchString(command) {
+		fmt.Printf("\n  %v\n\n", styleRed.Render("Error: not a command name: "+command))
+		os.Exit(1)
+	}
+	doc, source := commandDocs(command)
+	if doc == "" {
+		fmt.Printf("\n  %v\n\n", styleRed.Render(fmt.Sprintf("Error: no man page or --help output found for %s", command)))
+		os.Exit(1)
+	}
+	if len(doc) > maxManChars {
+		doc = doc[:maxManChars] + "\n[... truncated ...]"
+	}
+	if question == "" {
+		question = fmt.Sprintf("Explain what %s does and its most useful flags, with a few example invocations.", command)
+	}
+
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fmt.Fprintln(util.Notes(), styleDim.Render(fmt.Sprintf("Using %s for %s", source, command)))
+
+	appConfig, modelConfig := loadModelConfig()
+	runSession(appConfig, modelConfig, question, func(c *llm.LLMClient) {
+		c.Pin(Message{
+			Role: "system",
+			Content: fmt.Sprintf("The user is asking about the `%s` command. Here is its documentation (%s) from their machine:\n\n%s\n\n"+
+				"Base your answer on this documentation, since it matches the installed version. "+
+				"If it doesn't cover something, say so rather than guessing.", command, source, doc),
+		})
+	})
+}
+
+// commandDocs returns the man page of command, falling back to its --help output
+func commandDocs(command string) (doc, source string) {
+	man := exec.Command("man", command)
+	man.Env = append(os.Environ(), "MANPAGER=cat", "PAGER=cat", "MANWIDTH=100")
+	if out, err := man.Output(); err == nil && len(strings.TrimSpace(string(out))) > 0 {
+		return overstrike.ReplaceAllString(string(out), ""), "man " + command
+	}
+
+	if _, err := exec.LookPath(command); err != nil {
+		return "", ""
+	}
+	for _, flag := range []string{"--help", "-h"} {
+		// Many tools print help to stderr and/or exit non-zero, so only the output matters
+		out, _ := exec.Command(command, flag).CombinedOutput()
+		if text := strings.TrimSpace(string(out)); len(text) > 40 {
+			return text, command + " " + flag
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"q/memory"
+	"q/theme"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	memoryProfile string
+	forgetAll     bool
+)
+
+var rememberCmd = &cobra.Command{
+	Use:   "remember <fact>",
+	Short: "Remember a fact about your setup and send it with every request",
+	Long: `Remember a fact about your setup, such as which cloud or package manager
+you use, so answers take it into account. Facts are sent with every request, in
+the system prompt, and are kept in ~/.shell-ai/memory.db.
+
+Facts belong to the profile in SHELL_AI_PROFILE ("default" when it's unset),
+so you can keep separate ones for work and home.
+
+  q remember "our k8s cluster is on GKE 1.29"
+  q remember --profile work "deploys go through argocd"`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runRememberCommand,
+}
+
+var memoryCmd = &cobra.Command{
+	Use:   "memory",
+	Short: "List and forget remembered facts (see q remember)",
+	Args:  cobra.NoArgs,
+	Run:   runMemoryListCommand,
+}
+
+var memoryListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the facts remembered in the profile",
+	Args:  cobra.NoArgs,
+	Run:   runMemoryListCommand,
+}
+
+var memoryForgetCmd = &cobra.Command{
+	Use:   "forget <id>...",
+	Short: "Forget facts by the IDs shown in q memory list",
+	Run:   runMemoryForgetCommand,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{rememberCmd, memoryCmd} {
+		cmd.PersistentFlags().StringVar(&memoryProfile, "profile", "", "Profile of the facts (default $SHELL_AI_PROFILE, or \"default\")")
+	}
+	memoryForgetCmd.Flags().BoolVar(&forgetAll, "all", false, "Forget every fact in the profile")
+	memoryCmd.AddCommand(memoryListCmd, memoryForgetCmd)
+	RootCmd.AddCommand(rememberCmd, memoryCmd)
+}
+
+// profile is the profile the memory commands work on
+func profile() string {
+	if memoryProfile != "" {
+		return memoryProfile
+	}
+	return memory.Profile()
+}
+
+func openMemory() *memory.Store {
+	store, err := memory.Open()
+	if err != nil {
+		memoryFail(err.Error())
+	}
+	return store
+}
+
+func runRememberCommand(cmd *cobra.Command, args []string) {
+	store := openMemory()
+	defer store.Close()
+	id, err := store.Add(profile(), strings.Join(args, " "))
+	if err != nil {
+		memoryFail("failed to remember: " + err.Error())
+	}
+	forget := fmt.Sprintf("q memory forget %d", id)
+	if memoryProfile != "" {
+		forget += " --profile " + memoryProfile
+	}
+	fmt.Printf("Remembered (#%d in profile %s). Forget it with `%s`.\n", id, profile(), forget)
+}
+
+func runMemoryListCommand(cmd *cobra.Command, args []string) {
+	store := openMemory()
+	defer store.Close()
+	facts, err := store.List(profile())
+	if err != nil {
+		memoryFail("failed to read facts: " + err.Error())
+	}
+	if len(facts) == 0 {
+		fmt.Printf("Nothing remembered in profile %s. Add a fact with `q remember <fact>`.\n", profile())
+		return
+	}
+
+	idStyle := lipgloss.NewStyle().Foreground(theme.Muted())
+	for _, fact := range facts {
+		fmt.Printf("%s  %s\n", idStyle.Render(fmt.Sprintf("%4d", fact.ID)), fact.Text)
+	}
+}
+
+func runMemoryForgetCommand(cmd *cobra.Command, args []string) {
+	if forgetAll == (len(args) > 0) {
+		memoryFail("give the IDs of the facts to forget, or --all")
+	}
+	store := openMemory()
+	defer store.Close()
+	if forgetAll {
+		n, err := store.ForgetAll(profile())
+		if err != nil {
+			memoryFail("failed to forget: " + err.Error())
+		}
+		fmt.Printf("Forgot %d %s in profile %s.\n", n, pluralize(int(n), "fact", "facts"), profile())
+		return
+	}
+	for _, arg := range args {
+		id, err := strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64)
+		if err != nil {
+			memoryFail(fmt.Sprintf("%q is not a fact ID (see q memory list)", arg))
+		}
+		ok, err := store.Forget(profile(), id)
+		if err != nil {
+			memoryFail("failed to forget: " + err.Error())
+		}
+		if !ok {
+			memoryFail(fmt.Sprintf("no fact #%d in profile %s (see q memory list)", id, profile()))
+		}
+		fmt.Printf("Forgot #%d.\n", id)
+	}
+}
+
+// rememberedFacts is the active profile's facts, rendered for the system
+// prompt, or "" if there are none or they can't be read
+func rememberedFacts() string {
+	store, err := memory.Open()
+	if err != nil {
+		fmt.Fprintf(util.Notes(), "Warning: remembered facts are left out: %v\n", err)
+		return ""
+	}
+	defer store.Close()
+	facts, err := store.List(memory.Profile())
+	if err != nil {
+		fmt.Fprintf(util.Notes(), "Warning: remembered facts are left out: %v\n", err)
+		return ""
+	}
+	return memory.Prompt(facts)
+}
+
+func memoryFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
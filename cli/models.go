@@ -0,0 +1,273 @@
+package cli
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/llm"
+	"q/provider"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	discoverAll bool
+	discoverAdd []string
+)
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "List the configured models, or discover others your keys can use",
+	Args:  cobra.NoArgs,
+	Run:   runModelsCommand,
+}
+
+var modelsDiscoverCmd = &cobra.Command{
+	Use:   "discover [filter]",
+	Short: "List the models each provider offers for your keys, and add some to the config",
+	Long: `Ask each configured endpoint, and each provider whose API key is set, for
+the models it offers (its /models list), and show them next to the ones
+already configured. Models that can't chat, like embeddings and speech, are
+left out unless --all is given; a filter keeps only models containing it.
+
+In a terminal you can then pick models to add to the config. Added models
+use the same provider, endpoint and keys they were found with, and the
+default prompt. --add adds them without asking:
+
+  q models discover mini
+  q models discover --add gpt-4.1-nano --add o3`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runModelsDiscoverCommand,
+}
+
+func init() {
+	modelsDiscoverCmd.Flags().BoolVar(&discoverAll, "all", false, "Include models that can't chat, like embeddings and speech")
+	modelsDiscoverCmd.Flags().StringSliceVar(&discoverAdd, "add", nil, "Add these models to the config without asking")
+	modelsCmd.AddCommand(modelsDiscoverCmd)
+	RootCmd.AddCommand(modelsCmd)
+}
+
+func runModelsCommand(cmd *cobra.Command, args []string) {
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		config.PrintConfigErrorMessage(err)
+		os.Exit(exitStatus)
+	}
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	for _, model := range appConfig.Models {
+		mark := " "
+		if model.ModelName == appConfig.Preferences.DefaultModel {
+			mark = lipgloss.NewStyle().Foreground(theme.Success()).Render("*")
+		}
+		fmt.Printf("%s %s %s\n", mark, model.ModelName, dimStyle.Render(sourceName(model)))
+	}
+}
+
+// modelSource is one endpoint and key to list models with, and the config
+// that models found there are added with
+type modelSource struct {
+	name     string
+	template ModelConfig
+	resolved ModelConfig
+}
+
+// modelSources are the distinct endpoint and key pairs of the configured
+// models, then the providers whose key is set but aren't configured yet
+func modelSources(appConfig config.AppConfig) []modelSource {
+	var sources []modelSource
+	seen := map[string]bool{}
+	add := func(template ModelConfig) {
+		modelConfig, err := applyModel(template)
+		if err != nil {
+			return
+		}
+		resolved, err := resolveAuth(modelConfig)
+		if err != nil {
+			return
+		}
+		id := resolved.Endpoint + " " + resolved.Auth
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		sources = append(sources, modelSource{name: sourceName(template), template: template, resolved: resolved})
+	}
+	for _, model := range appConfig.Models {
+		add(ModelConfig{
+			Provider:    model.Provider,
+			Endpoint:    model.Endpoint,
+			Auth:        model.Auth,
+			AuthHeader:  model.AuthHeader,
+			OrgID:       model.OrgID,
+			Keys:        model.Keys,
+			KeyRotation: model.KeyRotation,
+			Headers:     model.Headers,
+			Messages:    model.Messages,
+		})
+	}
+	for _, name := range provider.Names() {
+		if preset, _ := provider.Lookup(name); preset.Endpoint != "" {
+			add(ModelConfig{Provider: name})
+		}
+	}
+	return sources
+}
+
+// sourceName describes where a model is sent: its provider, or the host of
+// its endpoint
+func sourceName(model ModelConfig) string {
+	name := model.Provider
+	if model.Endpoint != "" {
+		name = model.Endpoint
+		if u, err := url.Parse(model.Endpoint); err == nil && u.Host != "" {
+			name = u.Host
+		}
+	}
+	if name == "" {
+		name = "openai"
+	}
+	return name
+}
+
+func runModelsDiscoverCommand(cmd *cobra.Command, args []string) {
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		config.PrintConfigErrorMessage(err)
+		os.Exit(exitStatus)
+	}
+	filter := ""
+	if len(args) > 0 {
+		filter = strings.ToLower(args[0])
+	}
+	configured := map[string]bool{}
+	for _, model := range appConfig.Models {
+		configured[model.ModelName] = true
+	}
+	sources := modelSources(appConfig)
+	if len(sources) == 0 {
+		modelsFail("no API keys are set for the configured models or any provider; run q setup")
+	}
+
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	errorStyle := lipgloss.NewStyle().Foreground(theme.Error())
+
+	// Models that could be added, numbered in the order they're listed, with
+	// the config each would be added with
+	var found []ModelConfig
+	var lastErr error
+	listed := false
+	for _, source := range sources {
+		ids, err := llm.NewLLMClient(source.resolved).ListModels(20 * time.Second)
+		fmt.Println(headerStyle.Render(source.name) + dimStyle.Render(" · "+credentialName(source.template)))
+		if err != nil {
+			fmt.Println(errorStyle.Render("  ✗ "+err.Error()) + "\n")
+			lastErr = err
+			continue
+		}
+		listed = true
+		shown := 0
+		for _, id := range ids {
+			if (!discoverAll && !provider.IsChatModel(id)) || !strings.Contains(strings.ToLower(id), filter) {
+				continue
+			}
+			shown++
+			if configured[id] {
+				fmt.Println(dimStyle.Render("   ✓ " + id + " (configured)"))
+				continue
+			}
+			model := source.template
+			model.ModelName = id
+			found = append(found, model)
+			fmt.Printf("  %2d. %s\n", len(found), id)
+		}
+		if shown == 0 {
+			fmt.Println(dimStyle.Render("  no matching models"))
+		}
+		fmt.Println()
+	}
+	if !listed {
+		modelsFail(requestError(lastErr))
+	}
+
+	var picked []ModelConfig
+	switch {
+	case len(discoverAdd) > 0:
+		for _, name := range discoverAdd {
+			picked = append(picked, pickModel(found, name, configured))
+		}
+	case len(found) > 0 && util.IsTerminal(os.Stdin):
+		answer := askLine("Add which models? Numbers or names, blank for none", "")
+		for _, name := range strings.Fields(strings.ReplaceAll(answer, ",", " ")) {
+			picked = append(picked, pickModel(found, name, configured))
+		}
+	}
+	if len(picked) == 0 {
+		return
+	}
+
+	for _, model := range picked {
+		model.Prompt = config.DefaultPrompt()
+		appConfig.Models = append(appConfig.Models, model)
+	}
+	if err := saveValidConfig(appConfig); err != nil {
+		modelsFail(err.Error())
+	}
+	okStyle := lipgloss.NewStyle().Foreground(theme.Success())
+	for _, model := range picked {
+		fmt.Println(okStyle.Render("✓ Added " + model.ModelName))
+	}
+	fmt.Println(dimStyle.Render("  Make one the default with q config."))
+}
+
+// credentialName names the variables a source's key comes from
+func credentialName(model ModelConfig) string {
+	if len(model.Keys) > 0 {
+		var vars []string
+		for _, key := range model.Keys {
+			vars = append(vars, key.EnvVar)
+		}
+		return strings.Join(vars, ", ")
+	}
+	if model.Auth != "" {
+		return model.Auth
+	}
+	if preset, ok := provider.Lookup(model.Provider); ok {
+		return preset.AuthEnvVar
+	}
+	return ""
+}
+
+// pickModel finds a model to add by its number in the list or its name,
+// marking it configured so it isn't added twice
+func pickModel(found []ModelConfig, name string, configured map[string]bool) ModelConfig {
+	if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= len(found) {
+		name = found[n-1].ModelName
+	}
+	if configured[name] {
+		modelsFail(name + " is already configured")
+	}
+	for _, model := range found {
+		if model.ModelName == name {
+			configured[name] = true
+			return model
+		}
+	}
+	modelsFail(fmt.Sprintf("%s isn't among the models found; pick a number or name from the list", name))
+	return ModelConfig{}
+}
+
+func modelsFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/util"
+)
+
+// defaultNotifyAfter is how long a request takes before --notify shows a notification
+const defaultNotifyAfter = 10 * time.Second
+
+// maxNotifyBody is how much of the answer's first line a notification shows
+const maxNotifyBody = 200
+
+var (
+	notifyFlag bool
+	// notifyAfter is how long a request takes before it's notified of, or 0 when
+	// notifications are off
+	notifyAfter time.Duration
+)
+
+// notifyThreshold returns how long a request has to take to be notified of,
+// or 0 when neither --notify nor the notify preference is set
+func notifyThreshold(appConfig config.AppConfig) time.Duration {
+	if !notifyFlag && !appConfig.Preferences.Notify {
+		return 0
+	}
+	if d, err := time.ParseDuration(appConfig.Preferences.NotifyAfter); err == nil && d > 0 {
+		return d
+	}
+	return defaultNotifyAfter
+}
+
+// notifyIfSlow shows a desktop notification with the first line of the answer
+// if the request took long enough, so a query left running in the background
+// can be picked up once it's done
+func notifyIfSlow(elapsed time.Duration, response string, err error) {
+	if notifyAfter == 0 || elapsed < notifyAfter {
+		return
+	}
+	title, body := "q: answer ready", firstLine(response)
+	if err != nil {
+		title, body = "q: request failed", err.Error()
+	}
+	if runes := []rune(body); len(runes) > maxNotifyBody {
+		body = string(runes[:maxNotifyBody]) + "…"
+	}
+	if err := util.Notify(title, body); err != nil {
+		fmt.Fprintf(util.Notes(), "Warning: failed to show a notification: %v\n", err)
+	}
+}
+
+// firstLine is the first line of an answer with text on it, leaving out code fences
+func firstLine(answer string) string {
+	for _, line := range strings.Split(answer, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "```") {
+			return line
+		}
+	}
+	return ""
+}
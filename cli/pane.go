@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"q/llm"
+	"q/secrets"
+	"q/tokens"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// paneTokens is how much of the tmux pane --pane sends, keeping the latest lines
+const paneTokens = 4000
+
+var (
+	paneFlag  bool
+	paneLines int
+)
+
+// pinPane pins the end of the current tmux pane's scrollback to the client's
+// context for --pane, with any secrets in it blanked out
+func pinPane(c *llm.LLMClient) error {
+	if os.Getenv("TMUX") == "" {
+		return fmt.Errorf("--pane only works inside tmux")
+	}
+	text, err := capturePane(os.Getenv("TMUX_PANE"), paneLines)
+	if err != nil {
+		return fmt.Errorf("--pane: %w", err)
+	}
+	if text == "" {
+		return fmt.Errorf("--pane: the pane is empty")
+	}
+
+	note := "Attached the tmux pane"
+	var notes []string
+	if parts := tokens.Split(text, paneTokens); len(parts) > 1 {
+		// The end of the pane is what was just run, so that's what's kept
+		text = "[... truncated ...]\n\n" + parts[len(parts)-1]
+		notes = append(notes, fmt.Sprintf("cut to about %d tokens", paneTokens))
+	}
+	text, redacted := secrets.Redact(text)
+	if redacted > 0 {
+		notes = append(notes, fmt.Sprintf("%d %s redacted", redacted, pluralize(redacted, "secret", "secrets")))
+	}
+	if len(notes) > 0 {
+		note += " (" + strings.Join(notes, ", ") + ")"
+	}
+	fmt.Fprintln(util.Notes(), lipgloss.NewStyle().Faint(true).Render(note))
+
+	c.Pin(Message{
+		Role: "system",
+		Content: "Here is what the user's terminal shows, ending with the command that asked you. " +
+			"Questions about what happened \"above\" refer to it:\n\n```\n" + text + "\n```",
+	})
+	return nil
+}
+
+// capturePane returns the text of a tmux pane (the current one if pane is
+// ""), from lines above the visible part to its last non-empty line
+func capturePane(pane string, lines int) (string, error) {
+	args := []string{"capture-pane", "-p", "-J", "-S", "-" + strconv.Itoa(lines)}
+	if pane != "" {
+		args = append(args, "-t", pane)
+	}
+	out, err := exec.Command("tmux", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("tmux capture-pane failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("tmux capture-pane failed: %w", err)
+	}
+	return strings.TrimRight(string(out), " \n"), nil
+}
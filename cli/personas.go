@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"q/config"
+	"q/eval"
+	"q/exitcode"
+	"q/llm"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	personasTestSuite  string
+	personasTestPrompt string
+	personasTestModel  string
+)
+
+// PersonasTestCmd runs a persona's or a model's test suite; main adds it to `q personas`
+var PersonasTestCmd = &cobra.Command{
+	Use:   "test <persona|model>",
+	Short: "Check that a persona's or a model's prompt still gives the answers wanted",
+	Long: `Run the test suite of a persona, or of a model's own system prompt and its
+templates, and fail if any answer doesn't hold up. The suite is
+tests/<name>.yaml in the config directory, or --suite, in the format of
+q eval's:
+
+  cases:
+    - prompt: review this diff for bugs
+      expect:
+        contains: "Bugs:"
+        not_regex: '(?i)looks good to me'
+    - prompt: review a function that shells out with user input
+      expect:
+        judge: points out the command injection first
+        min_score: 4
+
+Each case checks the answer for text it must or must not contain, regular
+expressions it must or must not match, a shell command that must succeed, or
+a judge model's grade. With --prompt, the suite runs with a reworded prompt
+from a file instead of the saved one, to check a change before saving it.
+
+  q personas test review
+  q personas test review --prompt review-v2.md
+  q personas test gpt-4.1`,
+	Args: cobra.ExactArgs(1),
+	Run:  runPersonasTestCommand,
+}
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "Work with models' system_prompt templates",
+}
+
+// templatesTestCmd is PersonasTestCmd under `q templates`, for a model whose
+// system_prompt templates are being changed
+var templatesTestCmd = &cobra.Command{
+	Use:   "test <model|persona>",
+	Short: "Check that a model's templates, or a persona's prompt, still give the answers wanted",
+	Long: `Run the test suite of a model's own system prompt and its templates, or of
+a persona, exactly as q personas test does: the suite is tests/<name>.yaml in
+the config directory, or --suite.
+
+  q templates test gpt-4.1
+  q templates test review`,
+	Args: cobra.ExactArgs(1),
+	Run:  runPersonasTestCommand,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{PersonasTestCmd, templatesTestCmd} {
+		cmd.Flags().StringVar(&personasTestSuite, "suite", "", "Suite file to run (default: tests/<name>.yaml in the config directory)")
+		cmd.Flags().StringVar(&personasTestPrompt, "prompt", "", "File with a prompt to test in place of the saved one")
+		cmd.Flags().StringVarP(&personasTestModel, "model", "m", "", "Model to test a persona with (default: the suite's first, or the default model)")
+	}
+	templatesCmd.AddCommand(templatesTestCmd)
+	RootCmd.AddCommand(templatesCmd)
+}
+
+func runPersonasTestCommand(cmd *cobra.Command, args []string) {
+	name := args[0]
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		config.PrintConfigErrorMessage(err)
+		os.Exit(exitcode.Failure)
+	}
+
+	path := personasTestSuite
+	if path == "" {
+		if path, err = config.FullFilePath(filepath.Join("tests", name+".yaml")); err != nil {
+			testFail(err.Error())
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			testFail(fmt.Sprintf("%s has no test suite: write one at %s", name, path))
+		}
+	}
+	suite, err := eval.LoadSuite(path)
+	if err != nil {
+		testFail(err.Error())
+	}
+	var prompt string
+	if personasTestPrompt != "" {
+		data, err := os.ReadFile(personasTestPrompt)
+		if err != nil {
+			testFail(err.Error())
+		}
+		if prompt = strings.TrimSpace(string(data)); prompt == "" {
+			testFail(personasTestPrompt + " is empty")
+		}
+	}
+
+	// A persona is tested with a model; a model with its own prompt
+	modelConfig, persona, err := testSubject(appConfig, name, suite, prompt)
+	if err != nil {
+		testFail(err.Error())
+	}
+	judge := evalJudge(appConfig, suite)
+
+	passStyle := lipgloss.NewStyle().Foreground(theme.Success())
+	failStyle := lipgloss.NewStyle().Foreground(theme.Error())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	failed := 0
+	for i, c := range suite.Cases {
+		result := evalCase(appConfig, modelConfig, persona, judge, i, c)
+		grade := ""
+		if result.Score > 0 {
+			grade = dimStyle.Render(fmt.Sprintf("  graded %d/%d", result.Score, llm.MaxScore))
+		}
+		if result.Passed() {
+			fmt.Println(passStyle.Render("✓ ") + c.Label() + grade)
+			continue
+		}
+		failed++
+		fmt.Println(failStyle.Render("✗ ") + c.Label() + grade)
+		problems := result.Failures
+		if result.Error != "" {
+			problems = []string{"error: " + firstLine(result.Error)}
+		}
+		for _, problem := range problems {
+			fmt.Println("    " + failStyle.Render(problem))
+		}
+		if result.Reason != "" {
+			fmt.Println("    " + dimStyle.Render(result.Reason))
+		}
+	}
+
+	summary := fmt.Sprintf("%d of %d passed with %s", len(suite.Cases)-failed, len(suite.Cases), modelConfig.ModelName)
+	if failed > 0 {
+		fmt.Fprintln(util.Notes(), "\n"+failStyle.Render(summary))
+		os.Exit(exitcode.Failure)
+	}
+	fmt.Fprintln(util.Notes(), "\n"+passStyle.Render(summary))
+}
+
+// testSubject is the model config a suite runs with, and the name of the
+// persona applied to it, if name is a persona. A prompt other than "" stands
+// in for the persona's, or the model's.
+func testSubject(appConfig config.AppConfig, name string, suite eval.Suite, prompt string) (ModelConfig, string, error) {
+	persona, personaErr := config.FindPersona(appConfig, name)
+	if personaErr != nil {
+		modelConfig, err := findModelConfig(appConfig, name)
+		if err != nil {
+			return modelConfig, "", fmt.Errorf("%s is neither a persona nor a model in your config", name)
+		}
+		if personasTestModel != "" && personasTestModel != name {
+			return modelConfig, "", fmt.Errorf("--model is for testing a persona; %s is a model", name)
+		}
+		if prompt != "" {
+			messages := []Message{{Role: "system", Content: prompt}}
+			for _, message := range modelConfig.Prompt {
+				if message.Role != "system" {
+					messages = append(messages, message)
+				}
+			}
+			modelConfig.Prompt = messages
+		}
+		return modelConfig, "", nil
+	}
+
+	model := personasTestModel
+	if model == "" && len(suite.Models) > 0 {
+		model = suite.Models[0]
+	}
+	if model == "" {
+		defaultConfig, err := getModelConfig(appConfig)
+		if err != nil {
+			return defaultConfig, "", err
+		}
+		model = defaultConfig.ModelName
+	}
+	modelConfig, err := findModelConfig(appConfig, model)
+	if err != nil {
+		return modelConfig, "", err
+	}
+	if prompt != "" {
+		persona.Prompt = prompt
+	}
+	return applyPersona(modelConfig, persona), persona.Name, nil
+}
+
+func testFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitcode.Failure)
+}
@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/llm"
+	"q/logger"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// Values of the offline_queue preference
+const (
+	queueAuto   = "auto"
+	queueManual = "manual"
+	queueOff    = "off"
+)
+
+var queueDropAll bool
+
+// offlineQueue is the offline_queue preference of the running session
+var offlineQueue string
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "List, send and drop prompts written while offline",
+	Long: `When the network is unreachable, such as on a flight, the prompt that
+started a session is kept in the logs database instead of being lost. Queued
+prompts are sent, and their answers logged, after the next request that gets
+an answer, or right away with ` + "`q queue flush`" + `.
+
+Set offline_queue under preferences to "manual" to only send them with
+` + "`q queue flush`" + `, or to "off" to not queue prompts at all.`,
+	Args: cobra.NoArgs,
+	Run:  runQueueListCommand,
+}
+
+var queueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the queued prompts",
+	Args:  cobra.NoArgs,
+	Run:   runQueueListCommand,
+}
+
+var queueFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Send the queued prompts and show their answers",
+	Args:  cobra.NoArgs,
+	Run:   runQueueFlushCommand,
+}
+
+var queueDropCmd = &cobra.Command{
+	Use:   "drop <id>...",
+	Short: "Drop queued prompts without sending them",
+	Run:   runQueueDropCommand,
+}
+
+func init() {
+	queueDropCmd.Flags().BoolVar(&queueDropAll, "all", false, "Drop every queued prompt")
+	queueCmd.AddCommand(queueListCmd, queueFlushCmd, queueDropCmd)
+	RootCmd.AddCommand(queueCmd)
+}
+
+// queueOffline queues the prompt that started a session if its request
+// failed because the network is unreachable, returning a note saying so, or
+// "" if it wasn't queued
+func queueOffline(c *llm.LLMClient, prompt string, err error) string {
+	mode := offlineQueue
+	// Follow-ups only make sense in their conversation, so only a session's
+	// first prompt is queued
+	if mode == queueOff || !llm.IsOffline(err) || c.ConversationHead != "" || strings.TrimSpace(prompt) == "" {
+		return ""
+	}
+	reqLogger, logErr := logger.Shared()
+	if logErr != nil {
+		return ""
+	}
+	id, logErr := reqLogger.QueuePrompt(QueuedPrompt{Prompt: prompt, Model: c.Model(), Persona: c.Persona})
+	if logErr != nil {
+		return ""
+	}
+	if mode == queueManual {
+		return fmt.Sprintf("You seem to be offline. The prompt is queued as #%d; send it with `q queue flush`.", id)
+	}
+	return fmt.Sprintf("You seem to be offline. The prompt is queued as #%d, and is sent after the next answered request (or with `q queue flush`).", id)
+}
+
+// flushQueueInBackground sends the queued prompts from a separate process, if
+// there are any and offline_queue is auto, once a session got an answer
+func flushQueueInBackground(appConfig config.AppConfig) {
+	mode := appConfig.Preferences.OfflineQueue
+	if mode == queueOff || mode == queueManual {
+		return
+	}
+	reqLogger, err := logger.Shared()
+	if err != nil {
+		return
+	}
+	if prompts, err := reqLogger.QueuedPrompts(); err != nil || len(prompts) == 0 {
+		return
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+	cmd := exec.Command(exe, "queue", "flush")
+	if cmd.Start() == nil {
+		cmd.Process.Release()
+	}
+}
+
+func openQueue() *logger.RequestLogger {
+	reqLogger, err := logger.NewRequestLogger()
+	if err != nil {
+		queueFail("failed to open logs database: " + err.Error())
+	}
+	if os.Getenv("SHELL_AI_DISABLE_LOGGING") != "" {
+		queueFail("logging is disabled by SHELL_AI_DISABLE_LOGGING, so there's no queue")
+	}
+	return reqLogger
+}
+
+func runQueueListCommand(cmd *cobra.Command, args []string) {
+	reqLogger := openQueue()
+	defer reqLogger.Close()
+	prompts, err := reqLogger.QueuedPrompts()
+	if err != nil {
+		queueFail("failed to read the queue: " + err.Error())
+	}
+	if len(prompts) == 0 {
+		fmt.Println("No queued prompts.")
+		return
+	}
+
+	idStyle := lipgloss.NewStyle().Foreground(theme.Muted())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	errorStyle := lipgloss.NewStyle().Foreground(theme.Error())
+	for _, prompt := range prompts {
+		model := prompt.Model
+		if prompt.Persona != "" {
+			model += ", as " + prompt.Persona
+		}
+		fmt.Printf("%s  %s  %s\n", idStyle.Render(fmt.Sprintf("%4d", prompt.ID)), prompt.Prompt,
+			dimStyle.Render(fmt.Sprintf("(%s, %s)", model, prompt.QueuedAt.Local().Format("Jan 2 15:04"))))
+		if prompt.LastError != "" {
+			fmt.Printf("      %s\n", errorStyle.Render(fmt.Sprintf("failed %d times: %s", prompt.Attempts, prompt.LastError)))
+		}
+	}
+}
+
+func runQueueFlushCommand(cmd *cobra.Command, args []string) {
+	reqLogger := openQueue()
+	defer reqLogger.Close()
+	prompts, err := reqLogger.QueuedPrompts()
+	if err != nil {
+		queueFail("failed to read the queue: " + err.Error())
+	}
+	if len(prompts) == 0 {
+		fmt.Println("No queued prompts.")
+		return
+	}
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		config.PrintConfigErrorMessage(err)
+		os.Exit(exitStatus)
+	}
+
+	promptStyle := lipgloss.NewStyle().Foreground(theme.Accent()).Bold(true)
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	errorStyle := lipgloss.NewStyle().Foreground(theme.Error())
+	r, _ := theme.MarkdownRenderer(util.GetTermSafeMaxWidth())
+	sent, failed := 0, 0
+	for _, prompt := range prompts {
+		fmt.Println(promptStyle.Render("> " + prompt.Prompt))
+		answer, requestID, err := sendQueued(appConfig, prompt)
+		if llm.IsOffline(err) {
+			reqLogger.PromptFailed(prompt.ID, err)
+			queueFail(fmt.Sprintf("still offline (%v); %d prompts are left in the queue", err, len(prompts)-sent))
+		}
+		if err != nil {
+			reqLogger.PromptFailed(prompt.ID, err)
+			fmt.Printf("%s\n\n", errorStyle.Render("  Error: "+err.Error()+" (kept in the queue)"))
+			failed++
+			continue
+		}
+		reqLogger.DequeuePrompt(prompt.ID)
+		sent++
+		if rendered, err := r.Render(answer); err == nil {
+			fmt.Print(theme.HangIndents(rendered, util.GetTermSafeMaxWidth()))
+		} else {
+			fmt.Println(answer)
+		}
+		fmt.Printf("%s\n\n", dimStyle.Render(fmt.Sprintf("  Queued %s ago, logged as %s", time.Since(prompt.QueuedAt).Round(time.Minute), requestID)))
+	}
+	if failed > 0 {
+		queueFail(fmt.Sprintf("%d of %d prompts failed and are still queued", failed, len(prompts)))
+	}
+}
+
+// sendQueued asks a queued prompt of the model and persona it was written
+// for, returning the answer and the ID it was logged under
+func sendQueued(appConfig config.AppConfig, prompt QueuedPrompt) (string, string, error) {
+	modelConfig, err := findModelConfig(appConfig, prompt.Model)
+	if err != nil {
+		return "", "", err
+	}
+	if prompt.Persona != "" {
+		persona, err := config.FindPersona(appConfig, prompt.Persona)
+		if err != nil {
+			return "", "", err
+		}
+		modelConfig = applyPersona(modelConfig, persona)
+	}
+	c := llm.NewLLMClient(modelConfig)
+	c.Persona = prompt.Persona
+	c.Language = answerLanguage(appConfig, "")
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	answer, err := c.Query(prompt.Prompt)
+	return answer, c.LastEntry().RequestID, err
+}
+
+func runQueueDropCommand(cmd *cobra.Command, args []string) {
+	if queueDropAll == (len(args) > 0) {
+		queueFail("give the IDs of the prompts to drop, or --all")
+	}
+	reqLogger := openQueue()
+	defer reqLogger.Close()
+	if queueDropAll {
+		prompts, err := reqLogger.QueuedPrompts()
+		if err != nil {
+			queueFail("failed to read the queue: " + err.Error())
+		}
+		for _, prompt := range prompts {
+			args = append(args, strconv.FormatInt(prompt.ID, 10))
+		}
+	}
+	for _, arg := range args {
+		id, err := strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64)
+		if err != nil {
+			queueFail(fmt.Sprintf("%q is not a queued prompt's ID (see q queue list)", arg))
+		}
+		ok, err := reqLogger.DequeuePrompt(id)
+		if err != nil {
+			queueFail("failed to drop: " + err.Error())
+		}
+		if !ok {
+			queueFail(fmt.Sprintf("no queued prompt #%d (see q queue list)", id))
+		}
+		fmt.Printf("Dropped #%d.\n", id)
+	}
+}
+
+func queueFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
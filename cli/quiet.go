@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"q/exitcode"
+	"q/llm"
+	"q/rag"
+	"q/util"
+
+	"github.com/spf13/cobra"
+)
+
+// answerOut is where --quiet writes the answer. Everything else printed to
+// stdout is redirected to stderr, so $(q -q ...) captures only the answer.
+var answerOut = os.Stdout
+
+// addQuietFlag adds --quiet to a command that answers a prompt
+func addQuietFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&quietFlag, "quiet", "q", false, "Print only the answer (just the command when it has one), without styling, spinners or warnings")
+}
+
+// initQuiet applies --quiet once the flags are parsed
+func initQuiet() {
+	if !quietFlag {
+		return
+	}
+	util.Quiet = true
+	os.Stdout = os.Stderr
+}
+
+// runQuiet answers prompt without the TUI, for scripts: only the answer is
+// written to stdout (just its command when it contains a code block) and
+// everything else, including error messages, goes to stderr. It returns the
+// status to exit with (see q/exitcode).
+func runQuiet(c *llm.LLMClient, contextIndex *rag.Index, tee *responseTee, prompt string) int {
+	if strings.TrimSpace(prompt) == "" {
+		fmt.Fprintln(os.Stderr, "Error: --quiet needs a prompt")
+		return exitcode.Failure
+	}
+	c.StreamHandler = llm.StreamFuncs{Token: tee.write}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer func() {
+		signal.Stop(interrupts)
+		close(interrupts)
+	}()
+	go func() {
+		if _, ok := <-interrupts; ok {
+			c.Interrupt()
+		}
+	}()
+
+	msg := makeQuery(c, contextIndex, prompt)().(responseMsg)
+	tee.finish(msg.response)
+	if msg.err == llm.ErrInterrupted {
+		// A partial command isn't safe to run, so it never goes to stdout
+		fmt.Fprintln(os.Stderr, msg.response)
+		fmt.Fprintln(os.Stderr, "Interrupted. The partial response was logged.")
+		return exitcode.Interrupted
+	}
+	if msg.err != nil {
+		if errors.Is(msg.err, llm.ErrStalled) && msg.response != "" {
+			// Like an interrupted one, a stalled answer never goes to stdout
+			fmt.Fprintln(os.Stderr, msg.response)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", msg.err)
+		if hint := conflictHint(msg.err, c.ConversationHead); hint != "" {
+			fmt.Fprintln(os.Stderr, hint)
+		}
+		if note := queueOffline(c, prompt, msg.err); note != "" {
+			fmt.Fprintln(os.Stderr, note)
+		}
+		return exitcode.For(msg.err)
+	}
+
+	// Reasoning is only ever shown on stderr, so it can't end up in a command
+	if reasoning := c.LastEntry().Reasoning; reasoning != "" && (thinking == llm.ThinkingDim || thinking == llm.ThinkingShow) {
+		fmt.Fprintf(os.Stderr, "Thinking:\n%s\n\n", reasoning)
+	}
+	fmt.Fprintln(answerOut, quietAnswer(msg.response))
+	return exitcode.OK
+}
+
+// quietAnswer is what --quiet prints of a response: the command, if it has a
+// code block, or else the whole answer
+func quietAnswer(response string) string {
+	if command, _ := util.ExtractFirstCodeBlock(response); command != "" {
+		return command
+	}
+	return strings.TrimRight(response, "\n")
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"q/config"
+	"q/llm"
+	"q/theme"
+	. "q/types"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var raceFlag []string
+
+func init() {
+	RootCmd.Flags().StringSliceVar(&raceFlag, "race", nil, "Send the prompt to these models at once (like --race gpt-4o-mini,claude-3-5-haiku), show the first to answer and cancel the others")
+}
+
+// raceModels resolves the --race models, each with the --persona prompt if
+// given: the first is the session's model, and the rest race it
+func raceModels(appConfig config.AppConfig) (ModelConfig, []ModelConfig) {
+	var models []ModelConfig
+	seen := map[string]bool{}
+	for _, name := range raceFlag {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		modelConfig, err := findModelConfig(appConfig, name)
+		if err != nil {
+			raceFail(err.Error())
+		}
+		if personaFlag != "" {
+			persona, err := config.FindPersona(appConfig, personaFlag)
+			if err != nil {
+				raceFail(err.Error())
+			}
+			modelConfig = applyPersona(modelConfig, persona)
+		}
+		models = append(models, modelConfig)
+	}
+	if len(models) < 2 {
+		raceFail("--race needs at least two models, like --race gpt-4o-mini,claude-3-5-haiku")
+	}
+	return models[0], models[1:]
+}
+
+// raceSetup has the session's first request race the rivals. Routing is
+// skipped, since the models to use were named.
+func raceSetup(rivals []ModelConfig) func(*llm.LLMClient) {
+	return func(c *llm.LLMClient) {
+		c.Route = nil
+		c.Rivals = rivals
+	}
+}
+
+func raceFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"q/config"
+	"q/llm"
+	"q/logger"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// differentApproachPrompt asks for a variation when the original answer is kept in context
+const differentApproachPrompt = "Try a different approach than your previous answer."
+
+var (
+	retryFlag             bool
+	regenerateTemperature float32
+	regenerateDifferent   bool
+)
+
+// RegenerateCmd asks for a new answer to a logged prompt. It is registered under `q logs`.
+var RegenerateCmd = &cobra.Command{
+	Use:   "regenerate [last|<request-id>]",
+	Short: "Get a new answer to a previous prompt (default: the last one)",
+	Long: `Re-send a logged prompt to get a different answer. The original answer is
+shown first, and the new entry is linked to it in the logs.
+
+By default the prompt is re-sent at a higher temperature. With --different the
+original answer is included and the model is asked to try another approach.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id := "last"
+		if len(args) == 1 {
+			id = args[0]
+		}
+		runRegenerate(id)
+	},
+}
+
+func init() {
+	RegenerateCmd.Flags().Float32Var(&regenerateTemperature, "temperature", 0.9, "Sampling temperature for the new answer")
+	addQuietFlag(RegenerateCmd)
+	RegenerateCmd.Flags().BoolVar(&regenerateDifferent, "different", false, "Show the model its previous answer and ask for a different approach")
+}
+
+func runRegenerate(id string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fail := func(msg string) {
+		fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg))
+		os.Exit(1)
+	}
+
+	original, err := loadLoggedEntry(id)
+	if err != nil {
+		fail(err.Error())
+	}
+	prompt := userPrompt(original)
+	// A --different entry's prompt is the instruction; follow the chain back to the real question
+	for from := original; prompt == differentApproachPrompt && from.RegeneratedFrom != ""; {
+		if from, err = loadLoggedEntry(from.RegeneratedFrom); err != nil {
+			fail(err.Error())
+		}
+		prompt = userPrompt(from)
+	}
+	if prompt == "" {
+		fail("that log entry has no prompt to regenerate")
+	}
+	if prompt == logger.Redacted {
+		fail("that log entry's prompt was redacted")
+	}
+
+	if personaFlag == "" {
+		personaFlag = original.Persona
+	}
+	appConfig, modelConfig := loadModelConfig()
+	if original.Model != modelConfig.ModelName {
+		if logged, err := findModelConfig(appConfig, original.Model); err == nil {
+			modelConfig = logged
+			if personaFlag != "" {
+				if persona, err := config.FindPersona(appConfig, personaFlag); err == nil {
+					modelConfig = applyPersona(modelConfig, persona)
+				}
+			}
+		}
+	}
+
+	printOriginalAnswer(original)
+
+	query := prompt
+	if regenerateDifferent {
+		query = differentApproachPrompt
+	}
+	runSession(appConfig, modelConfig, query, func(c *llm.LLMClient) {
+		c.Temperature = regenerateTemperature
+		c.Route = nil
+		c.RegeneratedFrom = original.RequestID
+		if regenerateDifferent {
+			c.AppendHistory(
+				Message{Role: "user", Content: prompt},
+				Message{Role: "assistant", Content: original.Response},
+			)
+		}
+	})
+}
+
+// userPrompt returns the (last) user message of a log entry
+func userPrompt(entry LogEntry) string {
+	var prompt string
+	for _, msg := range entry.Messages {
+		if msg.Role == "user" {
+			prompt = msg.Content
+		}
+	}
+	return prompt
+}
+
+// loadLoggedEntry returns the log entry with the given request ID, or the latest for "last"
+func loadLoggedEntry(id string) (LogEntry, error) {
+	reqLogger, err := logger.NewRequestLogger()
+	if err != nil {
+		return LogEntry{}, fmt.Errorf("failed to open logs database: %w", err)
+	}
+	defer reqLogger.Close()
+
+	if id != "last" {
+		return reqLogger.GetResponse(id)
+	}
+	entries, err := reqLogger.GetRecentResponses(1)
+	if err != nil {
+		return LogEntry{}, fmt.Errorf("failed to read logs: %w", err)
+	}
+	if len(entries) == 0 {
+		return LogEntry{}, fmt.Errorf("no logged requests yet")
+	}
+	return entries[0], nil
+}
+
+func printOriginalAnswer(original LogEntry) {
+	labelStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+
+	fmt.Println(labelStyle.Render("Original answer") +
+		dimStyle.Render(fmt.Sprintf(" · %s · %s", original.Timestamp.Local().Format("2006-01-02 15:04"), original.Model)))
+	if original.Error != "" {
+		fmt.Println(lipgloss.NewStyle().Foreground(theme.Error()).Render("  Error: " + original.Error))
+	} else {
+		width := util.GetTermSafeMaxWidth()
+		r, _ := theme.MarkdownRenderer(width)
+		rendered, err := r.Render(original.Response)
+		if err != nil {
+			rendered = original.Response + "\n"
+		}
+		fmt.Print(theme.HangIndents(rendered, width))
+	}
+	fmt.Println(labelStyle.Render("New answer"))
+}
@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"q/llm"
+	"q/theme"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// maxPromptSamples caps how many samples are shown to the model; all of them are tested
+const maxPromptSamples = 50
+
+// maxFeedbackFailures caps how many failing samples are sent back to the model
+const maxFeedbackFailures = 20
+
+var (
+	regexTest  string
+	regexTries int
+)
+
+var regexCmd = &cobra.Command{
+	Use:   "regex <description>",
+	Short: "Write a regular expression, tested against samples",
+	Long: `Write a regular expression (Go/RE2 syntax, which also works with grep -E and
+ripgrep for most patterns) for a description. With --test, every line of the
+file must contain a match, except lines starting with ! which must not (write
+\! for a line that starts with !). Failing samples are sent back to the model
+until the expression passes or --tries run out.
+
+  q regex "ISO 8601 dates like 2024-01-31" --test dates.txt
+  q regex "a semantic version with an optional v prefix"`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runRegexCommand,
+}
+
+func init() {
+	regexCmd.Flags().StringVar(&regexTest, "test", "", "File of sample lines to test the expression against")
+	regexCmd.Flags().IntVar(&regexTries, "tries", 3, "How many expressions to try before giving up")
+	addQuietFlag(regexCmd)
+	RootCmd.AddCommand(regexCmd)
+}
+
+// regexSample is a line the expression must, or must not, match
+type regexSample struct {
+	text  string
+	match bool
+}
+
+func runRegexCommand(cmd *cobra.Command, args []string) {
+	description := strings.Join(args, " ")
+	var samples []regexSample
+	if regexTest != "" {
+		var err error
+		if samples, err = readRegexSamples(regexTest); err != nil {
+			generatorFail(err.Error())
+		}
+	}
+
+	request := "Description: " + description
+	if len(samples) > 0 {
+		var matching, other []string
+		for i, sample := range samples {
+			if i == maxPromptSamples {
+				break
+			}
+			if sample.match {
+				matching = append(matching, sample.text)
+			} else {
+				other = append(other, sample.text)
+			}
+		}
+		if len(matching) > 0 {
+			request += "\n\nIt must match somewhere in each of these lines:\n" + strings.Join(matching, "\n")
+		}
+		if len(other) > 0 {
+			request += "\n\nIt must not match anywhere in these lines:\n" + strings.Join(other, "\n")
+		}
+	}
+
+	appConfig, modelConfig := loadModelConfig()
+	c := llm.NewLLMClient(modelConfig)
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	attempts, err := c.Refine(regexPrompt, request, regexTries, "regex", func(expr string) (string, error) {
+		return checkRegex(expr, samples), nil
+	})
+	passed := ""
+	if len(samples) > 0 {
+		passed = fmt.Sprintf("Passes all %d samples", len(samples))
+	}
+	finishGenerator(attempts, err, passed)
+}
+
+const regexPrompt = "Write a regular expression for the user's description, in Go's RE2 syntax: " +
+	"no lookarounds or backreferences. Use inline flags like (?i) if needed. " +
+	"Reply with only the expression in a single code block, without delimiters or quotes."
+
+// readRegexSamples reads the --test file
+func readRegexSamples(path string) ([]regexSample, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var samples []regexSample
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "!"):
+			samples = append(samples, regexSample{text: line[1:], match: false})
+		case strings.HasPrefix(line, `\!`):
+			samples = append(samples, regexSample{text: line[1:], match: true})
+		default:
+			samples = append(samples, regexSample{text: line, match: true})
+		}
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("%s has no samples", path)
+	}
+	return samples, nil
+}
+
+// checkRegex compiles expr and tests it against the samples, describing what
+// failed for the model, or returning "" if everything passed
+func checkRegex(expr string, samples []regexSample) string {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Sprintf("The expression doesn't compile as a Go (RE2) regular expression: %v", err)
+	}
+	var failures []string
+	for _, sample := range samples {
+		found := re.FindString(sample.text)
+		matched := re.MatchString(sample.text)
+		switch {
+		case sample.match && !matched:
+			failures = append(failures, fmt.Sprintf("should match but doesn't: %s", sample.text))
+		case !sample.match && matched:
+			failures = append(failures, fmt.Sprintf("shouldn't match but matches %q: %s", found, sample.text))
+		}
+	}
+	if len(failures) == 0 {
+		return ""
+	}
+	total := len(failures)
+	if len(failures) > maxFeedbackFailures {
+		failures = failures[:maxFeedbackFailures]
+	}
+	return fmt.Sprintf("%d of %d samples fail:\n%s", total, len(samples), strings.Join(failures, "\n"))
+}
+
+// finishGenerator prints the expression that passed, or why none did. passed
+// describes the tests it passed, empty if there were none.
+func finishGenerator(attempts []llm.Attempt, err error, passed string) {
+	if err != nil {
+		generatorFail(requestError(err))
+	}
+	if len(attempts) == 0 {
+		generatorFail("the model gave no answer")
+	}
+	last := attempts[len(attempts)-1]
+	if last.Feedback != "" {
+		styleDim := lipgloss.NewStyle().Faint(true)
+		fmt.Fprintf(os.Stderr, "%s\n\n", last.Answer)
+		for _, line := range strings.Split(last.Feedback, "\n") {
+			fmt.Fprintln(os.Stderr, styleDim.Render(line))
+		}
+		generatorFail(fmt.Sprintf("nothing passed the checks after %d tries", len(attempts)))
+	}
+	if passed != "" {
+		summary := "✓ " + passed
+		if len(attempts) > 1 {
+			summary += fmt.Sprintf(" (try %d)", len(attempts))
+		}
+		fmt.Fprintln(util.Notes(), lipgloss.NewStyle().Foreground(theme.Success()).Render(summary))
+	}
+	fmt.Fprintln(answerOut, last.Answer)
+}
+
+func generatorFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(exitStatus)
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"q/llm"
+	. "q/types"
+)
+
+func TestRefineRegex(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "dates.txt")
+	os.WriteFile(path, []byte("2024-01-31\nborn 1999-12-01\n!2024-1-31\n!12-01\n\\!2024-02-29!\n"), 0644)
+	samples, err := readRegexSamples(path)
+	if err != nil {
+		t.Fatalf("readRegexSamples: %v", err)
+	}
+	if len(samples) != 5 || samples[2].match || samples[4].text != "!2024-02-29!" || !samples[4].match {
+		t.Fatalf("read %+v", samples)
+	}
+
+	tests := []struct {
+		name    string
+		replies []string
+		tries   int
+		// wantFeedback is the start of each attempt's feedback
+		wantFeedback []string
+	}{
+		{"passing at once", []string{"```\n\\d{4}-\\d{2}-\\d{2}\n```"}, 3, []string{""}},
+		{"passing on the second try", []string{"```\n\\d+-\\d+\n```", "\\d{4}-\\d{2}-\\d{2}"}, 3, []string{"2 of 5 samples fail:\nshouldn't match but matches \"2024-1\": 2024-1-31\nshouldn't match but matches \"12-01\": 12-01", ""}},
+		{"not compiling", []string{"```\n(\\d{4}\n```", "\\d{4}-\\d{2}-\\d{2}"}, 3, []string{"The expression doesn't compile", ""}},
+		{"out of tries", []string{"\\d+", "\\d+-", "\\d+-\\d+"}, 3, []string{"2 of 5", "2 of 5", "2 of 5"}},
+	}
+	for _, tt := range tests {
+		var requests [][]Message
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload struct{ Messages []Message }
+			json.NewDecoder(r.Body).Decode(&payload)
+			requests = append(requests, payload.Messages)
+			reply, _ := json.Marshal(tt.replies[len(requests)-1])
+			fmt.Fprintf(w, `{"id":"req-%d","choices":[{"message":{"role":"assistant","content":%s}}]}`, time.Now().UnixNano(), reply)
+		}))
+		c := llm.NewLLMClient(ModelConfig{ModelName: "gpt-4.1", Endpoint: server.URL + "/v1/chat/completions", Auth: "test"})
+		attempts, err := c.Refine(regexPrompt, "Description: ISO 8601 dates", tt.tries, "regex", func(expr string) (string, error) {
+			return checkRegex(expr, samples), nil
+		})
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if len(attempts) != len(tt.wantFeedback) {
+			t.Errorf("%s: got %d attempts, want %d: %+v", tt.name, len(attempts), len(tt.wantFeedback), attempts)
+			continue
+		}
+		for i, attempt := range attempts {
+			if !strings.HasPrefix(attempt.Feedback, tt.wantFeedback[i]) || (tt.wantFeedback[i] == "") != (attempt.Feedback == "") {
+				t.Errorf("%s: try %d got the feedback %q, want %q", tt.name, i+1, attempt.Feedback, tt.wantFeedback[i])
+			}
+			// The expression is taken out of its code block
+			if strings.Contains(attempt.Answer, "`") {
+				t.Errorf("%s: try %d got %q", tt.name, i+1, attempt.Answer)
+			}
+		}
+		// Each retry carries the conversation so far and the failures
+		for i := 1; i < len(requests); i++ {
+			sent := requests[i]
+			if len(sent) != 2+2*i || sent[len(sent)-2].Content != tt.replies[i-1] ||
+				!strings.HasPrefix(sent[len(sent)-1].Content, attempts[i-1].Feedback+"\n\nFix it") {
+				t.Errorf("%s: try %d sent %+v", tt.name, i+1, sent)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"strings"
+
+	"q/theme"
+)
+
+// streamRenderer shows an answer in the TUI as it streams in. The blocks that
+// are complete, ending at a blank line outside a code fence, are rendered once
+// and kept; only the block still being written is rendered again with each
+// token, so long answers don't get slower to show as they grow. The answer is
+// rendered whole once it's all in.
+type streamRenderer struct {
+	render func(block string) string
+
+	text strings.Builder
+	// done is how much of text is rendered into blocks, and scanned how much
+	// of it has been split into lines
+	done, scanned int
+	// fence is the ``` or ~~~ that opened the code block text ends in, if any
+	fence  string
+	blocks strings.Builder
+	// tail is the block being written, rendered
+	tail string
+}
+
+func newStreamRenderer(render func(block string) string) *streamRenderer {
+	return &streamRenderer{render: render}
+}
+
+// write adds a piece of the answer
+func (r *streamRenderer) write(text string) {
+	r.text.WriteString(text)
+	all := r.text.String()
+	for {
+		end := strings.IndexByte(all[r.scanned:], '\n')
+		if end < 0 {
+			break
+		}
+		line := all[r.scanned : r.scanned+end]
+		r.scanned += end + 1
+		marker := fenceMarker(line)
+		switch {
+		case r.fence != "":
+			if strings.HasPrefix(marker, r.fence) && strings.TrimSpace(line) == marker {
+				r.fence = ""
+			}
+		case marker != "":
+			r.fence = marker
+		case strings.TrimSpace(line) == "":
+			r.finishBlock(all[r.done:r.scanned])
+		}
+	}
+
+	r.tail = ""
+	if tail := all[r.done:]; strings.TrimSpace(tail) != "" {
+		r.tail = theme.TrimBlankLines(r.render(tail))
+	}
+}
+
+// finishBlock renders a complete block and moves past it
+func (r *streamRenderer) finishBlock(block string) {
+	r.done = r.scanned
+	if strings.TrimSpace(block) == "" {
+		return
+	}
+	if r.blocks.Len() > 0 {
+		r.blocks.WriteString("\n\n")
+	}
+	r.blocks.WriteString(theme.TrimBlankLines(r.render(block)))
+}
+
+// String is the answer so far as it's shown, spaced like formatResponse
+// spaces a whole answer
+func (r *streamRenderer) String() string {
+	if r.text.Len() == 0 {
+		return ""
+	}
+	view := r.blocks.String()
+	if r.tail != "" {
+		if view != "" {
+			view += "\n\n"
+		}
+		view += r.tail
+	}
+	return "\n" + view + "\n"
+}
+
+// fenceMarker is the run of backticks or tildes a line opens or closes a
+// code fence with, or "" if it doesn't
+func fenceMarker(line string) string {
+	line = strings.TrimLeft(line, " \t")
+	for _, c := range []string{"`", "~"} {
+		if n := len(line) - len(strings.TrimLeft(line, c)); n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
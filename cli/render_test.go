@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStreamRenderer(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		// want is the blocks rendered, in brackets, as String shows them
+		want string
+	}{
+		{"one block", []string{"ls ", "-la"}, "[ls -la]"},
+		{"blocks", []string{"First.\n", "\nSec", "ond.\n\nThird"}, "[First.\n\n]\n\n[Second.\n\n]\n\n[Third]"},
+		{"blank line in a fence", []string{"Run:\n\n```", "bash\nls\n\nls -la\n", "```\n\nDone."}, "[Run:\n\n]\n\n[```bash\nls\n\nls -la\n```\n\n]\n\n[Done.]"},
+		{"fence split across pieces", []string{"~", "~~\na\n\nb\n~~", "~\n\nc"}, "[~~~\na\n\nb\n~~~\n\n]\n\n[c]"},
+		{"longer closing fence", []string{"````\na\n```\n\nb\n````\n\nc"}, "[````\na\n```\n\nb\n````\n\n]\n\n[c]"},
+	}
+	for _, tt := range tests {
+		renders := map[string]int{}
+		r := newStreamRenderer(func(block string) string {
+			renders[block]++
+			return "[" + block + "]"
+		})
+		for _, chunk := range tt.chunks {
+			r.write(chunk)
+		}
+		want := "\n" + tt.want + "\n"
+		if got := r.String(); got != want {
+			t.Errorf("%s: String() = %q, want %q", tt.name, got, want)
+		}
+		// A complete block is rendered once, however many pieces follow it
+		for block, n := range renders {
+			if n > 1 && strings.HasSuffix(block, "\n\n") {
+				t.Errorf("%s: block %q was rendered %d times", tt.name, block, n)
+			}
+		}
+	}
+}
+
+func TestFenceMarker(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"```", "```"},
+		{"```bash", "```"},
+		{"  ~~~~", "~~~~"},
+		{"``", ""},
+		{"text ```", ""},
+	}
+	for _, tt := range tests {
+		if got := fenceMarker(tt.line); got != tt.want {
+			t.Errorf("fenceMarker(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
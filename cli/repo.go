@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"q/gitrepo"
+	"q/llm"
+	"q/secrets"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// repoTokens is how much of the repository summary --repo sends
+const repoTokens = 2000
+
+var repoFlag bool
+
+// pinRepo pins a summary of the git repository the current directory is in
+// to the client's context for --repo, with any secrets in it blanked out
+func pinRepo(c *llm.LLMClient) error {
+	summary, err := gitrepo.Collect(".")
+	if err != nil {
+		return fmt.Errorf("--repo: %w", err)
+	}
+	text, cut := summary.Format(repoTokens)
+
+	note := "Attached a summary of the repository on " + summary.Branch
+	var notes []string
+	if cut {
+		notes = append(notes, fmt.Sprintf("cut to about %d tokens", repoTokens))
+	}
+	text, redacted := secrets.Redact(text)
+	if redacted > 0 {
+		notes = append(notes, fmt.Sprintf("%d %s redacted", redacted, pluralize(redacted, "secret", "secrets")))
+	}
+	if len(notes) > 0 {
+		note += " (" + strings.Join(notes, ", ") + ")"
+	}
+	fmt.Fprintln(util.Notes(), lipgloss.NewStyle().Faint(true).Render(note))
+
+	c.Pin(Message{
+		Role: "system",
+		Content: "The user is working in this git repository. Use it for questions about its history or changes, " +
+			"and say when something you'd need, like a full diff, isn't in it:\n\n```\n" + text + "\n```",
+	})
+	return nil
+}
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"q/exitcode"
+	"q/llm"
+	"q/rag"
+	"q/safety"
+	"q/sandbox"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxRunOutput caps how much of a failed command's stdout and stderr is sent
+// back to the model
+const maxRunOutput = 4000
+
+var (
+	runFlag       bool
+	repairFlag    int
+	noSandboxFlag bool
+)
+
+// runResult is what a command did
+type runResult struct {
+	exitCode int
+	stdout   string
+	stderr   string
+}
+
+// runAndRepair answers prompt and runs the command in the answer, once
+// confirmed. When the command fails, its output and exit code go back to the
+// model for a corrected command, up to repairFlag times, all in the same
+// conversation. With a sandbox configured, each command is tried there first,
+// and run for real only once it worked and you agree. It returns the status to
+// exit with: OK if the last command succeeded or none was run, the request's
+// status if it failed (see q/exitcode), or else Failure.
+func runAndRepair(c *llm.LLMClient, contextIndex *rag.Index, tee *responseTee, prompt string, sandboxConfig *SandboxConfig) int {
+	if strings.TrimSpace(prompt) == "" {
+		fmt.Fprintln(os.Stderr, "Error: --run needs a prompt")
+		return exitcode.Failure
+	}
+	if !util.IsTerminal(os.Stdin) {
+		fmt.Fprintln(os.Stderr, "Error: --run asks before running each command, so it needs a terminal")
+		return exitcode.Failure
+	}
+	var box *sandbox.Options
+	if sandboxConfig != nil && !noSandboxFlag {
+		box = &sandbox.Options{Backend: sandboxConfig.Backend, Image: sandboxConfig.Image, Network: sandboxConfig.Network}
+		if _, err := sandbox.Resolve(box.Backend); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: "+err.Error()+" (or use --no-sandbox)")
+			return exitcode.Failure
+		}
+	}
+	c.StreamHandler = llm.StreamFuncs{Token: tee.write}
+	styleDim := lipgloss.NewStyle().Faint(true)
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	r, _ := theme.MarkdownRenderer(util.GetTermSafeMaxWidth())
+
+	query := makeQuery(c, contextIndex, prompt)
+	for repairs := 0; ; repairs++ {
+		fmt.Fprintln(util.Notes(), styleDim.Render("Asking "+c.Model()+"..."))
+		msg := query().(responseMsg)
+		tee.finish(msg.response)
+		if msg.err != nil {
+			fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg.err.Error()))
+			return exitcode.For(msg.err)
+		}
+		if rendered, err := r.Render(msg.response); err == nil {
+			fmt.Print(theme.HangIndents(rendered, util.GetTermSafeMaxWidth()))
+		} else {
+			fmt.Println(msg.response)
+		}
+
+		command, _ := util.ExtractFirstCodeBlock(msg.response)
+		if command == "" {
+			fmt.Fprintln(util.Notes(), styleDim.Render("The answer has no command to run."))
+			return exitcode.OK
+		}
+		question := "Run this?"
+		if box != nil {
+			question = "Run this in the sandbox?"
+		}
+		if !confirmRun(command, question) {
+			return exitcode.OK
+		}
+		result, err := runShellCommand(command, box)
+		if err != nil {
+			fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+err.Error()))
+			return exitcode.Failure
+		}
+		sandboxed := box != nil
+		if sandboxed && result.exitCode == 0 {
+			fmt.Fprintln(util.Notes())
+			if !askYesNo("It worked in the sandbox. Run it for real?") {
+				fmt.Fprintln(os.Stderr, styleDim.Render("Not run."))
+				return exitcode.OK
+			}
+			if result, err = runShellCommand(command, nil); err != nil {
+				fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+err.Error()))
+				return exitcode.Failure
+			}
+			sandboxed = false
+		}
+		if result.exitCode == 0 {
+			fmt.Fprintln(util.Notes())
+			fmt.Fprintln(util.Notes(), lipgloss.NewStyle().Foreground(theme.Success()).Render("✓ Done"))
+			return exitcode.OK
+		}
+		if repairs == repairFlag {
+			fmt.Printf("\n  %v\n\n", styleRed.Render(fmt.Sprintf("Error: the command exited with %d", result.exitCode)))
+			return exitcode.Failure
+		}
+		fmt.Fprintln(util.Notes())
+		fmt.Fprintln(util.Notes(), styleDim.Render(fmt.Sprintf("Exited with %d, asking for a fix (%d of %d)...", result.exitCode, repairs+1, repairFlag)))
+		repair := repairPrompt(command, result)
+		if sandboxed {
+			repair = "It ran in a sandbox. " + sandbox.Describe(*box) + "\n\n" + repair
+		}
+		query = makeQuery(c, nil, repair)
+	}
+}
+
+// confirmRun shows what's risky about command and asks question
+func confirmRun(command, question string) bool {
+	dangerStyle := lipgloss.NewStyle().Foreground(theme.Error()).Bold(true)
+	cautionStyle := lipgloss.NewStyle().Foreground(theme.Highlight())
+	for _, finding := range safety.Analyze(command) {
+		label := cautionStyle.Render("Caution: ")
+		if finding.Severity == safety.Danger {
+			label = dangerStyle.Render("Danger: ")
+		}
+		fmt.Fprintln(os.Stderr, label+"`"+strings.Join(finding.Words, " ")+"` "+finding.Reason)
+	}
+	if !askYesNo(question) {
+		fmt.Fprintln(os.Stderr, lipgloss.NewStyle().Faint(true).Render("Not run."))
+		return false
+	}
+	return true
+}
+
+// askYesNo asks question, defaulting to no
+func askYesNo(question string) bool {
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fmt.Fprint(os.Stderr, styleDim.Render(question+" [y/N] "))
+	answer, err := stdinLines.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// runShellCommand runs command with the user's terminal attached, in box if
+// it isn't nil, also keeping the end of its output. The error is only for
+// commands that couldn't be started.
+func runShellCommand(command string, box *sandbox.Options) (runResult, error) {
+	var cmd *exec.Cmd
+	switch {
+	case box != nil:
+		var err error
+		if cmd, err = sandbox.Command(*box, command); err != nil {
+			return runResult{}, err
+		}
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("cmd", "/C", command)
+	default:
+		cmd = exec.Command("sh", "-c", command)
+	}
+	stdout, stderr := &tailBuffer{max: maxRunOutput}, &tailBuffer{max: maxRunOutput}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, stdout)
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+	fmt.Fprintln(os.Stderr)
+	err := cmd.Run()
+	result := runResult{stdout: stdout.String(), stderr: stderr.String()}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		result.exitCode = exitErr.ExitCode()
+		return result, nil
+	}
+	return result, err
+}
+
+// repairPrompt asks for a fix for a command that failed
+func repairPrompt(command string, result runResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "I ran:\n```\n%s\n```\nIt exited with code %d.\n", command, result.exitCode)
+	if s := strings.TrimSpace(result.stdout); s != "" {
+		fmt.Fprintf(&b, "\nstdout:\n```\n%s\n```\n", s)
+	}
+	if s := strings.TrimSpace(result.stderr); s != "" {
+		fmt.Fprintf(&b, "\nstderr:\n```\n%s\n```\n", s)
+	}
+	b.WriteString("\nWhat went wrong? Reply with a corrected command in a code block.")
+	return b.String()
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	data    []byte
+	max     int
+	dropped bool
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.data = append(t.data, p...)
+	if len(t.data) > t.max {
+		t.data = t.data[len(t.data)-t.max:]
+		t.dropped = true
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	if t.dropped {
+		return "... " + string(t.data)
+	}
+	return string(t.data)
+}
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"q/config"
+	"q/exitcode"
+	"q/llm"
+	"q/rag"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Ways a judge can settle sampled answers (see --judge)
+const (
+	judgePick  = "pick"
+	judgeMerge = "merge"
+)
+
+var (
+	samplesFlag int
+	judgeFlag   string
+)
+
+func init() {
+	RootCmd.Flags().IntVar(&samplesFlag, "n", 1, "Sample this many answers to the prompt and show them all, to compare them")
+	RootCmd.Flags().StringVar(&judgeFlag, "judge", "", "With --n, have the judge_model (default: the same model) pick the best answer, or merge them with --judge=merge")
+	RootCmd.Flags().Lookup("judge").NoOptDefVal = judgePick
+}
+
+// checkSampleFlags fails on --n and --judge values or combinations that
+// can't work
+func checkSampleFlags(prompt string) {
+	switch {
+	case samplesFlag < 1:
+		samplesFail("--n must be at least 1")
+	case judgeFlag != "" && judgeFlag != judgePick && judgeFlag != judgeMerge:
+		samplesFail("--judge must be pick or merge")
+	case judgeFlag != "" && samplesFlag < 2:
+		samplesFail("--judge needs several answers to choose from, like --n 3")
+	case samplesFlag < 2:
+	case strings.TrimSpace(prompt) == "":
+		samplesFail("--n needs a prompt")
+	case len(raceFlag) > 0:
+		samplesFail("--n and --race can't be used together")
+	case runFlag:
+		samplesFail("--n and --run can't be used together; pick an answer first")
+	case quietFlag && judgeFlag == "":
+		samplesFail("--quiet with --n needs --judge, to print one answer")
+	}
+}
+
+// runSamples samples several answers to prompt and shows them numbered, then
+// has a judge pick or merge them if --judge is given. With --quiet only the
+// judge's answer is printed, as runQuiet prints one. It returns the status to
+// exit with.
+func runSamples(c *llm.LLMClient, appConfig config.AppConfig, modelConfig ModelConfig, contextIndex *rag.Index, tee *responseTee, prompt string) int {
+	query := prompt
+	if contextIndex != nil {
+		results, err := contextIndex.Search(contextFlag, prompt, topKFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to search context: %v\n", err)
+			return exitcode.Failure
+		}
+		query = rag.BuildPrompt(contextFlag, prompt, results)
+		c.Sources = rag.Sources(contextFlag, results)
+	}
+
+	styleDim := lipgloss.NewStyle().Faint(true)
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	styleLabel := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	fmt.Fprintln(util.Notes(), styleDim.Render(fmt.Sprintf("Sampling %d answers from %s...", samplesFlag, c.Model())))
+	samples, err := c.Samples(query, samplesFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitcode.For(err)
+	}
+	group := samples[0].Entry.SampleGroup
+
+	var answers []string
+	var numbers []int
+	for i, sample := range samples {
+		if sample.Err != nil {
+			if !quietFlag {
+				fmt.Printf("%s %s\n\n", styleLabel.Render(fmt.Sprintf("Sample %d", i+1)), styleRed.Render("failed: "+firstLine(sample.Err.Error())))
+			}
+			continue
+		}
+		answers = append(answers, sample.Answer)
+		numbers = append(numbers, i+1)
+		if !quietFlag {
+			fmt.Println(styleLabel.Render(fmt.Sprintf("Sample %d", i+1)))
+			fmt.Println(renderAnswer(sample.Answer))
+		}
+	}
+
+	if judgeFlag == "" || len(answers) < 2 {
+		if judgeFlag != "" {
+			fmt.Fprintln(util.Notes(), "Warning: only one answer came back, so there's nothing to judge")
+		}
+		var all []string
+		for i, answer := range answers {
+			all = append(all, fmt.Sprintf("## Sample %d\n\n%s", numbers[i], answer))
+		}
+		tee.finish(strings.Join(all, "\n\n"))
+		if quietFlag {
+			fmt.Fprintln(answerOut, quietAnswer(answers[0]))
+		} else {
+			fmt.Println(styleDim.Render("Logged as sample group " + group + "."))
+		}
+		return exitcode.OK
+	}
+
+	judgeConfig := modelConfig
+	if name := appConfig.Preferences.JudgeModel; name != "" && name != modelConfig.ModelName {
+		judgeConfig, err = findModelConfig(appConfig, name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: judge_model: %v\n", err)
+			return exitcode.Failure
+		}
+	}
+	judge := llm.NewLLMClient(judgeConfig)
+	judge.ErrorLog = appConfig.Preferences.ErrorLog
+	judge.SampleGroup = group
+	verdict, err := judge.Judge(prompt, answers, judgeFlag == judgeMerge)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: the judge failed: %v\n", err)
+		return exitcode.For(err)
+	}
+	tee.finish(verdict.Answer)
+	if quietFlag {
+		fmt.Fprintln(answerOut, quietAnswer(verdict.Answer))
+		return exitcode.OK
+	}
+
+	styleGreen := lipgloss.NewStyle().Foreground(theme.Success()).Bold(true)
+	if verdict.Pick > 0 {
+		line := fmt.Sprintf("%s picked sample %d", judge.Model(), numbers[verdict.Pick-1])
+		if verdict.Reason != "" {
+			line += ": " + verdict.Reason
+		}
+		fmt.Println(styleGreen.Render(line))
+	} else {
+		fmt.Println(styleGreen.Render(fmt.Sprintf("Merged by %s", judge.Model())))
+		fmt.Println(renderAnswer(verdict.Answer))
+	}
+	fmt.Println(styleDim.Render("Logged as sample group " + group + "."))
+	return exitcode.OK
+}
+
+// renderAnswer renders an answer's markdown for the terminal, as the TUI
+// shows it, or leaves it as it is when stdout isn't one
+func renderAnswer(answer string) string {
+	answer = strings.TrimSpace(answer)
+	if !util.IsTerminal(os.Stdout) {
+		return answer + "\n"
+	}
+	width := util.GetTermSafeMaxWidth()
+	r, _ := theme.MarkdownRenderer(width)
+	rendered, err := r.Render(answer)
+	if err != nil {
+		return answer + "\n"
+	}
+	return theme.HangIndents(rendered, width)
+}
+
+func samplesFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"q/logger"
+	"q/metrics"
+	"q/theme"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var serveAddr string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a daemon exposing Prometheus metrics on /metrics",
+	Long: `Run in the foreground, serving Prometheus metrics of every request q
+makes on this machine: requests, tokens, cost and errors as counters, and
+answer latency as a histogram, all per model. They're read from the logs
+database on each scrape, so q commands run in other shells are counted too.
+Counters start from everything already logged.`,
+	Args: cobra.NoArgs,
+	Run:  runServeCommand,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "127.0.0.1:9464", "Address to listen on")
+	RootCmd.AddCommand(serveCmd)
+}
+
+func runServeCommand(cmd *cobra.Command, args []string) {
+	reqLogger, err := logger.NewRequestLogger()
+	if err != nil {
+		serveFail("failed to open logs database: " + err.Error())
+	}
+	defer reqLogger.Close()
+	if os.Getenv("SHELL_AI_DISABLE_LOGGING") != "" {
+		serveFail("logging is disabled by SHELL_AI_DISABLE_LOGGING, so there's nothing to measure")
+	}
+
+	collector := metrics.NewCollector()
+	if err := collector.Update(reqLogger); err != nil {
+		serveFail("failed to read logs: " + err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if err := collector.Update(reqLogger); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		collector.Write(w)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	fmt.Fprintf(util.Notes(), "Serving metrics on http://%s/metrics\n", serveAddr)
+	if err := http.ListenAndServe(serveAddr, mux); err != nil {
+		serveFail(err.Error())
+	}
+}
+
+func serveFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
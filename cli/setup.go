@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/keychain"
+	"q/llm"
+	"q/provider"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-tty"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// setupModels are the models suggested for each provider, the first being
+// the default; any other model the provider offers can be typed in
+var setupModels = map[string][]string{
+	"openai":    {"gpt-4.1", "gpt-4.1-mini"},
+	"azure":     {"gpt-4.1"},
+	"anthropic": {"claude-sonnet-4-0", "claude-3-5-haiku-latest"},
+	"mistral":   {"mistral-large-latest", "codestral-latest", "mistral-small-latest"},
+	"groq":      {"llama-3.3-70b-versatile", "llama-3.1-8b-instant"},
+	"deepseek":  {"deepseek-chat", "deepseek-reasoner"},
+	"xai":       {"grok-3", "grok-3-mini"},
+}
+
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Pick a provider and model, store the API key, and check that it works",
+	Long: `Walk through setting up q: it lists the providers whose API keys are
+already in the environment or the keychain, lets you pick one and a model,
+asks for the key if it's missing and offers to store it in the keychain
+(macOS, or Linux with secret-tool), writes the model to the config as the
+default, and sends it a test request.
+
+Other models and settings in the config are kept.`,
+	Args: cobra.NoArgs,
+	Run:  runSetupCommand,
+}
+
+func init() {
+	RootCmd.AddCommand(setupCmd)
+}
+
+func runSetupCommand(cmd *cobra.Command, args []string) {
+	if !util.IsTerminal(os.Stdin) {
+		setupFail("q setup asks questions, so it has to be run in a terminal")
+	}
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		config.PrintConfigErrorMessage(err)
+		os.Exit(exitStatus)
+	}
+	path, _ := config.Path()
+
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	okStyle := lipgloss.NewStyle().Foreground(theme.Success())
+	fmt.Println(headerStyle.Render("Setting up q"))
+	fmt.Println(dimStyle.Render("Writes to " + path + ", keeping your other models and settings."))
+	fmt.Println()
+
+	// Providers with a key already at hand come first
+	var names, ready []string
+	for _, name := range provider.Names() {
+		preset, _ := provider.Lookup(name)
+		if apiKey(preset.AuthEnvVar) != "" {
+			ready = append(ready, name)
+		} else {
+			names = append(names, name)
+		}
+	}
+	names = append(ready, names...)
+	for i, name := range names {
+		preset, _ := provider.Lookup(name)
+		status := dimStyle.Render(preset.AuthEnvVar + " not set")
+		if os.Getenv(preset.AuthEnvVar) != "" {
+			status = okStyle.Render("✓ " + preset.AuthEnvVar + " is set")
+		} else if i < len(ready) {
+			status = okStyle.Render("✓ " + preset.AuthEnvVar + " is in the keychain")
+		}
+		fmt.Printf("  %d. %-10s %s\n", i+1, name, status)
+	}
+	fmt.Println()
+	name := askChoice("Provider", names)
+	preset, _ := provider.Lookup(name)
+
+	model := ModelConfig{Provider: name}
+	if preset.Endpoint == "" {
+		fmt.Println(dimStyle.Render("  Like https://<resource>.openai.azure.com/openai/deployments/<deployment>/chat/completions?api-version=2024-10-21"))
+		for model.Endpoint == "" {
+			model.Endpoint = askLine("Endpoint", "")
+		}
+	}
+	suggested := setupModels[name]
+	fmt.Println(dimStyle.Render("  Suggested: " + strings.Join(suggested, ", ")))
+	model.ModelName = askLine("Model", suggested[0])
+
+	key := apiKey(preset.AuthEnvVar)
+	if key == "" {
+		key = askSecret("API key (hidden)")
+		if key == "" {
+			setupFail("no API key given")
+		}
+		switch {
+		case !keychain.Available():
+			fmt.Println(dimStyle.Render(fmt.Sprintf("  There's no keychain to keep it in, so export %s in your shell profile.", preset.AuthEnvVar)))
+		case askYesNo(fmt.Sprintf("Store it in the keychain, so q finds it without %s set?", preset.AuthEnvVar)):
+			if err := keychain.Set(preset.AuthEnvVar, key); err != nil {
+				setupFail(err.Error())
+			}
+			fmt.Println(okStyle.Render("✓ Stored as " + preset.AuthEnvVar + " under " + keychain.Service))
+		default:
+			fmt.Println(dimStyle.Render(fmt.Sprintf("  Not stored; export %s in your shell profile.", preset.AuthEnvVar)))
+		}
+	}
+
+	// Replace a model of the same name, keeping its prompt
+	model.Prompt = config.DefaultPrompt()
+	replaced := false
+	for i, existing := range appConfig.Models {
+		if existing.ModelName == model.ModelName {
+			model.Prompt = existing.Prompt
+			appConfig.Models[i] = model
+			replaced = true
+		}
+	}
+	if !replaced {
+		appConfig.Models = append(appConfig.Models, model)
+	}
+	appConfig.Preferences.DefaultModel = model.ModelName
+	if err := saveValidConfig(appConfig); err != nil {
+		setupFail(err.Error())
+	}
+	fmt.Println(okStyle.Render(fmt.Sprintf("✓ %s is the default model", model.ModelName)))
+
+	resolved, err := applyModel(model)
+	if err != nil {
+		setupFail(err.Error())
+	}
+	resolved.Auth = key
+	fmt.Println(dimStyle.Render("  Sending a test request..."))
+	elapsed, err := llm.NewLLMClient(resolved).Ping(20 * time.Second)
+	if err != nil {
+		setupFail(requestError(err) + "\n  " + pingHint(err, resolved) + "; then run q setup again, or q doctor")
+	}
+	fmt.Println(okStyle.Render(fmt.Sprintf("✓ %s answered in %dms. You're all set: try q list files over 100MB", model.ModelName, elapsed.Milliseconds())))
+}
+
+// saveValidConfig saves the config, unless it would no longer pass q config
+// validate
+func saveValidConfig(appConfig config.AppConfig) error {
+	data, err := yaml.Marshal(appConfig)
+	if err != nil {
+		return err
+	}
+	_, problems := config.Validate(data)
+	for _, problem := range problems {
+		if !problem.Warning {
+			return fmt.Errorf("the config would be invalid: %s", problem.String())
+		}
+	}
+	return config.SaveAppConfig(appConfig)
+}
+
+// askLine asks a question, returning the answer, or def if there's none
+func askLine(question, def string) string {
+	styleDim := lipgloss.NewStyle().Faint(true)
+	prompt := question + ": "
+	if def != "" {
+		prompt = fmt.Sprintf("%s [%s]: ", question, def)
+	}
+	fmt.Fprint(os.Stderr, styleDim.Render(prompt))
+	answer, err := stdinLines.ReadString('\n')
+	if err != nil && answer == "" {
+		setupFail("cancelled")
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def
+	}
+	return answer
+}
+
+// askChoice asks for one of choices, by number or name, the first by default
+func askChoice(question string, choices []string) string {
+	for {
+		answer := askLine(question, choices[0])
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(choices) {
+			return choices[n-1]
+		}
+		for _, choice := range choices {
+			if strings.EqualFold(answer, choice) {
+				return choice
+			}
+		}
+		fmt.Fprintf(os.Stderr, "  Pick 1-%d or a name.\n", len(choices))
+	}
+}
+
+// askSecret asks for a secret without echoing it
+func askSecret(question string) string {
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fmt.Fprint(os.Stderr, styleDim.Render(question+": "))
+	t, err := tty.Open()
+	if err != nil {
+		setupFail(err.Error())
+	}
+	defer t.Close()
+	secret, err := t.ReadPasswordNoEcho()
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		setupFail("cancelled")
+	}
+	return strings.TrimSpace(secret)
+}
+
+func setupFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
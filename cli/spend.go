@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"q/logger"
+	"q/spend"
+	"q/theme"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	spendToday   bool
+	spendMonth   bool
+	spendFormat  string
+	spendRefresh bool
+	spendPath    bool
+)
+
+var spendCmd = &cobra.Command{
+	Use:   "spend",
+	Short: "Show today's estimated spend, fast enough for a shell prompt",
+	Long: `Show the estimated cost of today's requests. The total is kept in a small
+env file next to the logs, rewritten after each request, so q spend
+doesn't open the database or read the config, and takes about as long as
+q --help (under 10ms on a typical machine): fit for a shell prompt. Days
+are local.
+
+  q spend --today --format short   # $0.42
+  q spend --month
+  source "$(q spend --path)"       # sets Q_SPEND_TODAY_SHORT and the rest
+
+Formats are short, long (the default), env and json. --month reads the logs,
+so it isn't meant for prompts.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runSpend()
+	},
+}
+
+func init() {
+	spendCmd.Flags().BoolVar(&spendToday, "today", false, "Today's spend (the default)")
+	spendCmd.Flags().BoolVar(&spendMonth, "month", false, "This month's spend, read from the logs")
+	spendCmd.Flags().StringVar(&spendFormat, "format", "long", "How to print it: short, long, env or json")
+	spendCmd.Flags().BoolVar(&spendRefresh, "refresh", false, "Recount today's spend from the logs and rewrite the env file")
+	spendCmd.Flags().BoolVar(&spendPath, "path", false, "Print where the env file is, for prompts that source it")
+	RootCmd.AddCommand(spendCmd)
+}
+
+func runSpend() {
+	path, err := spend.Path()
+	if err != nil {
+		spendFail(err.Error())
+	}
+	if spendPath {
+		fmt.Println(path)
+		return
+	}
+	if spendToday && spendMonth {
+		spendFail("use one of --today and --month")
+	}
+
+	now := time.Now()
+	period := "today"
+	var totals spend.Totals
+	if spendMonth {
+		period = "this month"
+		l := openSpendLogs()
+		defer l.Close()
+		totals.Day = spend.Day(now)
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+		if totals.Requests, totals.Cost, err = l.SpendSince(month); err != nil {
+			spendFail(err.Error())
+		}
+	} else {
+		// The env file is enough unless it's missing, as before the first
+		// request, or a recount is asked for
+		totals, err = spend.Read(path)
+		if err != nil || spendRefresh {
+			l := openSpendLogs()
+			defer l.Close()
+			if totals, err = l.WriteSpend(); err != nil {
+				spendFail(err.Error())
+			}
+		}
+		totals = totals.On(now)
+	}
+
+	switch spendFormat {
+	case "short":
+		fmt.Println(spend.Short(totals.Cost))
+	case "long":
+		fmt.Printf("$%.4f %s over %d %s\n", totals.Cost, period, totals.Requests, pluralize(totals.Requests, "request", "requests"))
+	case "env":
+		fmt.Print(totals.Env())
+	case "json":
+		data, _ := json.Marshal(struct {
+			Period   string  `json:"period"`
+			Day      string  `json:"day"`
+			Requests int     `json:"requests"`
+			Cost     float64 `json:"cost_usd"`
+		}{period, totals.Day, totals.Requests, totals.Cost})
+		fmt.Println(string(data))
+	default:
+		spendFail(fmt.Sprintf("--format %s is not short, long, env or json", spendFormat))
+	}
+}
+
+// openSpendLogs opens the logs to count spend from
+func openSpendLogs() *logger.RequestLogger {
+	l, err := logger.NewRequestLogger()
+	if err != nil {
+		spendFail(err.Error())
+	}
+	return l
+}
+
+func spendFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(1)
+}
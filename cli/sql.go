@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"q/llm"
+	"q/sqldb"
+	"q/theme"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// maxCellWidth caps the width of a column in the results table
+const maxCellWidth = 40
+
+// sqlTimeout bounds how long a query may run
+const sqlTimeout = 30 * time.Second
+
+var (
+	sqlDB    string
+	sqlRun   bool
+	sqlLimit int
+	sqlTries int
+)
+
+var sqlCmd = &cobra.Command{
+	Use:   "sql <question>",
+	Short: "Write an SQL query from the database's schema, and optionally run it",
+	Long: `Write an SQL query for a question, using the tables and columns of the
+database as context. With --run, the query is run read-only and the results
+shown as a table; if it fails, the error goes back to the model for a fix.
+
+The database is a postgres://, mysql:// or sqlite:// URL, or an SQLite file,
+given with --db or in DATABASE_URL.
+
+  q sql "the ten customers who spent the most last month" --db postgres://localhost/shop
+  q sql "how many books each author wrote" --db library.db --run`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runSQLCommand,
+}
+
+func init() {
+	sqlCmd.Flags().StringVar(&sqlDB, "db", "", "Database URL or SQLite file (default $DATABASE_URL)")
+	sqlCmd.Flags().BoolVar(&sqlRun, "run", false, "Run the query read-only and show the results")
+	sqlCmd.Flags().IntVar(&sqlLimit, "limit", 50, "Show at most this many rows")
+	sqlCmd.Flags().IntVar(&sqlTries, "tries", 3, "How many queries to try before giving up when running")
+	addQuietFlag(sqlCmd)
+	RootCmd.AddCommand(sqlCmd)
+}
+
+var dialectNames = map[string]string{
+	sqldb.Postgres: "PostgreSQL",
+	sqldb.MySQL:    "MySQL",
+	sqldb.SQLite:   "SQLite",
+}
+
+func runSQLCommand(cmd *cobra.Command, args []string) {
+	dsn := sqlDB
+	if dsn == "" {
+		dsn = os.Getenv("DATABASE_URL")
+	}
+	if dsn == "" {
+		generatorFail("give a database with --db or DATABASE_URL")
+	}
+	db, err := sqldb.Open(dsn)
+	if err != nil {
+		generatorFail(err.Error())
+	}
+	defer db.Close()
+	tables, err := db.Tables()
+	if err != nil {
+		generatorFail("failed to read the schema: " + err.Error())
+	}
+	if len(tables) == 0 {
+		fmt.Fprintln(util.Notes(), "Warning: the database has no tables")
+	}
+
+	request := fmt.Sprintf("Database: %s\n\nSchema:\n%s\nQuestion: %s",
+		dialectNames[db.Dialect], sqldb.Describe(tables), strings.Join(args, " "))
+	tries := 1
+	var result *sqldb.Result
+	check := func(string) (string, error) { return "", nil }
+	if sqlRun {
+		tries = sqlTries
+		request += "\n\nThe query will be run read-only, so it may only read."
+		check = func(query string) (string, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), sqlTimeout)
+			defer cancel()
+			var err error
+			if result, err = db.ReadOnlyQuery(ctx, query, sqlLimit); err != nil {
+				return "Running the query failed: " + err.Error(), nil
+			}
+			return "", nil
+		}
+	}
+
+	appConfig, modelConfig := loadModelConfig()
+	c := llm.NewLLMClient(modelConfig)
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	attempts, err := c.Refine(sqlPrompt, request, tries, "sql", check)
+	if !sqlRun || err != nil || len(attempts) == 0 || attempts[len(attempts)-1].Feedback != "" {
+		finishGenerator(attempts, err, "")
+		return
+	}
+
+	fmt.Fprintln(util.Notes(), lipgloss.NewStyle().Faint(true).Render(attempts[len(attempts)-1].Answer)+"\n")
+	if quietFlag || !util.IsTerminal(os.Stdout) {
+		fmt.Fprintln(answerOut, strings.Join(result.Columns, "\t"))
+		for _, row := range result.Rows {
+			fmt.Fprintln(answerOut, strings.Join(row, "\t"))
+		}
+	} else {
+		fmt.Print(renderResult(result))
+	}
+	if result.More {
+		fmt.Fprintf(util.Notes(), "Showing the first %d rows; use --limit for more\n", sqlLimit)
+	}
+}
+
+const sqlPrompt = "Write a single SQL query for the user's question, in the given database's dialect. " +
+	"Use only the tables and columns in the schema. " +
+	"Reply with only the query in a single code block."
+
+// renderResult draws query results as a table, cutting long values short
+func renderResult(result *sqldb.Result) string {
+	if len(result.Rows) == 0 {
+		return lipgloss.NewStyle().Faint(true).Render("No rows.") + "\n"
+	}
+	widths := make([]int, len(result.Columns))
+	cell := func(s string) string {
+		s = strings.Join(strings.Fields(s), " ")
+		if lipgloss.Width(s) > maxCellWidth {
+			s = string([]rune(s)[:maxCellWidth-1]) + "…"
+		}
+		return s
+	}
+	rows := make([][]string, len(result.Rows))
+	for i, row := range result.Rows {
+		rows[i] = make([]string, len(row))
+		for j, value := range row {
+			rows[i][j] = cell(value)
+		}
+	}
+	for j, column := range result.Columns {
+		widths[j] = lipgloss.Width(cell(column))
+		for _, row := range rows {
+			if w := lipgloss.Width(row[j]); w > widths[j] {
+				widths[j] = w
+			}
+		}
+	}
+
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	nullStyle := lipgloss.NewStyle().Faint(true)
+	line := func(cells []string, style func(string) string) string {
+		var b strings.Builder
+		for j, value := range cells {
+			if j > 0 {
+				b.WriteString("  ")
+			}
+			padding := ""
+			if j < len(cells)-1 {
+				padding = strings.Repeat(" ", widths[j]-lipgloss.Width(value))
+			}
+			b.WriteString(style(value) + padding)
+		}
+		return b.String() + "\n"
+	}
+
+	var b strings.Builder
+	header := make([]string, len(result.Columns))
+	for j, column := range result.Columns {
+		header[j] = cell(column)
+	}
+	b.WriteString(line(header, func(s string) string { return headerStyle.Render(s) }))
+	for _, row := range rows {
+		b.WriteString(line(row, func(s string) string {
+			if s == "NULL" {
+				return nullStyle.Render(s)
+			}
+			return s
+		}))
+	}
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"q/config"
+	"q/spend"
+	"q/theme"
+	"q/workspace"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusStarship bool
+	statusJSON     bool
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the current model, today's spend and what's left of the budget",
+	Long: `Show the model requests go to, the estimated cost of today's requests and,
+with daily_budget set in the preferences, what's left of it. Like q spend,
+today's total is read from the env file next to the logs, so this is fast
+enough for a shell prompt.
+
+  q status --starship   # gpt-4.1 $0.42 · $4.58 left
+  q status --json       # the same as JSON, for oh-my-posh and scripts`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runStatus()
+	},
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(&statusStarship, "starship", false, "Print one compact line for starship, oh-my-posh and other prompts")
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "Print it as JSON")
+	RootCmd.AddCommand(statusCmd)
+}
+
+// promptStatus is what `q status` shows
+type promptStatus struct {
+	Model     string  `json:"model"`
+	Workspace string  `json:"workspace,omitempty"`
+	Day       string  `json:"day"`
+	Requests  int     `json:"requests_today"`
+	Cost      float64 `json:"cost_today_usd"`
+	// Budget and Remaining are nil without a daily_budget
+	Budget    *float64 `json:"budget_usd,omitempty"`
+	Remaining *float64 `json:"budget_remaining_usd,omitempty"`
+}
+
+func runStatus() {
+	if statusStarship && statusJSON {
+		statusFail("use one of --starship and --json")
+	}
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		statusFail(err.Error())
+	}
+	status := promptStatus{Model: statusModel(appConfig), Workspace: workspace.Name()}
+
+	path, err := spend.Path()
+	if err != nil {
+		statusFail(err.Error())
+	}
+	// As in runSpend, the logs are only opened before the first request
+	totals, err := spend.Read(path)
+	if err != nil {
+		l := openSpendLogs()
+		defer l.Close()
+		if totals, err = l.WriteSpend(); err != nil {
+			statusFail(err.Error())
+		}
+	}
+	totals = totals.On(time.Now())
+	status.Day, status.Requests, status.Cost = totals.Day, totals.Requests, totals.Cost
+
+	if budget := appConfig.Preferences.DailyBudget; budget > 0 {
+		remaining := budget - totals.Cost
+		if remaining < 0 {
+			remaining = 0
+		}
+		status.Budget, status.Remaining = &budget, &remaining
+	}
+
+	switch {
+	case statusStarship:
+		fmt.Println(status.compact())
+	case statusJSON:
+		data, _ := json.Marshal(status)
+		fmt.Println(string(data))
+	default:
+		fmt.Printf("Model:     %s\n", status.Model)
+		if status.Workspace != "" {
+			fmt.Printf("Workspace: %s\n", status.Workspace)
+		}
+		fmt.Printf("Today:     $%.4f over %d %s\n", status.Cost, status.Requests, pluralize(status.Requests, "request", "requests"))
+		if status.Budget != nil {
+			fmt.Printf("Budget:    $%.2f a day, $%.2f left\n", *status.Budget, *status.Remaining)
+		}
+	}
+}
+
+// statusModel is the name of the model requests go to unless told otherwise:
+// the default model, or the first one if it isn't configured, as
+// getModelConfig picks it
+func statusModel(appConfig config.AppConfig) string {
+	for _, model := range appConfig.Models {
+		if model.ModelName == appConfig.Preferences.DefaultModel {
+			return model.ModelName
+		}
+	}
+	if len(appConfig.Models) > 0 {
+		return appConfig.Models[0].ModelName
+	}
+	return ""
+}
+
+// compact is the status as a prompt shows it, like "gpt-4.1 $0.42" or, with
+// a budget, "gpt-4.1 $0.42 · $4.58 left". It has no colors, leaving those to
+// the prompt's own styles.
+func (s promptStatus) compact() string {
+	line := s.Model + " " + spend.Short(s.Cost)
+	switch {
+	case s.Budget == nil:
+	case *s.Remaining > 0:
+		line += " · " + spend.Short(*s.Remaining) + " left"
+	default:
+		line += " · budget spent"
+	}
+	return line
+}
+
+func statusFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(1)
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"q/llm"
+	"q/readable"
+	"q/theme"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	summarySentences int
+	summaryBullets   bool
+)
+
+var summarizeCmd = &cobra.Command{
+	Use:   "summarize [file|url|-]...",
+	Short: "Summarize files, web pages, or stdin",
+	Long: `Summarize one or more files, web pages, or standard input (with - or no
+arguments). Web pages are reduced to their main text first. Text too long for
+the model is summarized in parts, and the part summaries are then combined.
+
+  q summarize notes.md
+  q summarize https://go.dev/blog/go1.22 --bullets
+  git log -50 | q summarize --sentences 3`,
+	Run: runSummarizeCommand,
+}
+
+func init() {
+	summarizeCmd.Flags().IntVar(&summarySentences, "sentences", 0, "Summarize in this many sentences (bullets with --bullets)")
+	summarizeCmd.Flags().BoolVar(&summaryBullets, "bullets", false, "Summarize as a bulleted list")
+	addQuietFlag(summarizeCmd)
+	RootCmd.AddCommand(summarizeCmd)
+}
+
+func runSummarizeCommand(cmd *cobra.Command, args []string) {
+	if summarySentences < 0 {
+		summarizeFail("--sentences must be positive")
+	}
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	var sources []string
+	for _, arg := range args {
+		name, text, err := readSummarySource(arg)
+		if err != nil {
+			summarizeFail(err.Error())
+		}
+		if strings.TrimSpace(text) == "" {
+			fmt.Fprintf(util.Notes(), "Warning: %s has no text, skipping it\n", name)
+			continue
+		}
+		if len(args) > 1 {
+			text = "# " + name + "\n\n" + text
+		}
+		sources = append(sources, text)
+	}
+	if len(sources) == 0 {
+		summarizeFail("there is nothing to summarize")
+	}
+
+	appConfig, modelConfig := loadModelConfig()
+	c := llm.NewLLMClient(modelConfig)
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	styleDim := lipgloss.NewStyle().Faint(true)
+	summary, err := c.Summarize(strings.Join(sources, "\n\n"), llm.SummaryOptions{
+		Sentences: summarySentences,
+		Bullets:   summaryBullets,
+	}, func(round, part, parts int) {
+		step := fmt.Sprintf("Summarizing part %d of %d", part, parts)
+		if round > 1 {
+			step += fmt.Sprintf(" (round %d)", round)
+		}
+		fmt.Fprintln(util.Notes(), styleDim.Render(step+"..."))
+	})
+	if err != nil {
+		summarizeFail(requestError(err))
+	}
+
+	summary = strings.TrimSpace(summary)
+	if quietFlag || !util.IsTerminal(os.Stdout) {
+		fmt.Fprintln(answerOut, summary)
+		return
+	}
+	width := util.GetTermSafeMaxWidth()
+	r, _ := theme.MarkdownRenderer(width)
+	rendered, err := r.Render(summary)
+	if err != nil {
+		rendered = summary + "\n"
+	}
+	fmt.Print(theme.HangIndents(rendered, width))
+}
+
+// readSummarySource reads a file, a web page's main text, or stdin for "-",
+// returning a name for it along with the text
+func readSummarySource(arg string) (name, text string, err error) {
+	switch {
+	case arg == "-":
+		if util.IsTerminal(os.Stdin) {
+			return "", "", fmt.Errorf("nothing to summarize: give a file or URL, or pipe text in")
+		}
+		data, err := io.ReadAll(os.Stdin)
+		return "stdin", string(data), err
+	case strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://"):
+		title, text, err := readable.Fetch(arg)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to fetch %s: %w", arg, err)
+		}
+		if title != "" {
+			return title + " (" + arg + ")", text, nil
+		}
+		return arg, text, nil
+	default:
+		data, err := os.ReadFile(arg)
+		if err != nil {
+			return "", "", err
+		}
+		return arg, string(data), nil
+	}
+}
+
+func summarizeFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(exitStatus)
+}
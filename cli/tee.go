@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// responseTee mirrors streamed responses into a file as raw markdown, without
+// any terminal styling. Each response in a session is separated by a blank line.
+type responseTee struct {
+	file *os.File
+	path string
+	// start is where the current response begins in the file, and streamed
+	// what of it was written so far
+	start    int64
+	streamed strings.Builder
+	started  bool
+}
+
+func newResponseTee(path string) (*responseTee, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(absPath)
+	if err != nil {
+		return nil, err
+	}
+	return &responseTee{file: file, path: absPath}, nil
+}
+
+// write appends the next piece of the response as it streams in
+func (t *responseTee) write(text string) {
+	if t == nil || text == "" {
+		return
+	}
+	if !t.started && t.file != nil {
+		if info, err := t.file.Stat(); err == nil && info.Size() > 0 {
+			t.file.WriteString("\n")
+		}
+		t.start, _ = t.file.Seek(0, io.SeekCurrent)
+		t.started = true
+	}
+	t.file.WriteString(text)
+	t.streamed.WriteString(text)
+}
+
+// finish flushes whatever part of the final response wasn't streamed and
+// prepares for the next one. If the final response isn't what was streamed,
+// such as when it was stopped at a code block or rewritten by a hook, it
+// replaces the streamed text.
+func (t *responseTee) finish(response string) {
+	if t == nil {
+		return
+	}
+	streamed := t.streamed.String()
+	if strings.HasPrefix(response, streamed) {
+		t.write(response[len(streamed):])
+	} else {
+		t.file.Truncate(t.start)
+		t.file.Seek(t.start, io.SeekStart)
+		t.file.WriteString(response)
+	}
+	if t.started {
+		t.file.WriteString("\n")
+	}
+	t.streamed.Reset()
+	t.started = false
+	t.file.Sync()
+}
+
+func (t *responseTee) Close() error {
+	if t == nil {
+		return nil
+	}
+	return t.file.Close()
+}
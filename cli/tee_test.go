@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResponseTee(t *testing.T) {
+	type response struct {
+		chunks []string
+		final  string
+	}
+	tests := []struct {
+		name      string
+		responses []response
+		want      string
+	}{
+		{"streamed whole", []response{{[]string{"ls ", "-la"}, "ls -la"}}, "ls -la\n"},
+		{"streamed in part", []response{{[]string{"ls "}, "ls -la"}}, "ls -la\n"},
+		{"not streamed", []response{{nil, "ls -la"}}, "ls -la\n"},
+		{"stopped at code", []response{{[]string{"Run:\n```\nls\n```\n", "It lists files."}, "Run:\n```\nls\n```"}}, "Run:\n```\nls\n```\n"},
+		{"rewritten", []response{{[]string{"ls -la ~/secret"}, "ls -la [redacted]"}}, "ls -la [redacted]\n"},
+		{"empty", []response{{nil, ""}}, ""},
+		{"session", []response{
+			{[]string{"ls"}, "ls"},
+			{[]string{"du -sh ", "/tmp/x"}, "du -sh"},
+			{[]string{"df"}, "df -h"},
+		}, "ls\n\ndu -sh\n\ndf -h\n"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "answer.md")
+		tee, err := newResponseTee(path)
+		if err != nil {
+			t.Fatalf("newResponseTee: %v", err)
+		}
+		for _, r := range tt.responses {
+			for _, chunk := range r.chunks {
+				tee.write(chunk)
+			}
+			tee.finish(r.final)
+		}
+		tee.Close()
+		if got, _ := os.ReadFile(path); string(got) != tt.want {
+			t.Errorf("%s: wrote %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"q/llm"
+	"q/theme"
+	"q/translate"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	translateTo       string
+	translateFrom     string
+	translateGlossary string
+)
+
+var translateCmd = &cobra.Command{
+	Use:   "translate [file|-]",
+	Short: "Translate a file or stdin into another language",
+	Long: `Translate a file, or standard input (with - or no argument), into the
+language given with --to, as an ISO 639-1 code or a name. The source language
+is detected unless --from is given. Code blocks, inline code, URLs, HTML tags
+and placeholders such as {name}, %s and $VAR are kept exactly as they are.
+
+A glossary makes terminology consistent: a YAML file of term: translation
+pairs, given with --glossary or the translate_glossary preference.
+
+  q translate --to de < README.md
+  q translate notes.txt --to "Brazilian Portuguese" --glossary terms.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runTranslateCommand,
+}
+
+func init() {
+	translateCmd.Flags().StringVar(&translateTo, "to", "", "Language to translate into, as a code (de) or name (German)")
+	translateCmd.Flags().StringVar(&translateFrom, "from", "", "Language of the text (detected by default)")
+	translateCmd.Flags().StringVar(&translateGlossary, "glossary", "", "YAML file of term: translation pairs to use")
+	translateCmd.MarkFlagRequired("to")
+	addQuietFlag(translateCmd)
+	RootCmd.AddCommand(translateCmd)
+}
+
+func runTranslateCommand(cmd *cobra.Command, args []string) {
+	source := "-"
+	if len(args) > 0 {
+		source = args[0]
+	}
+	var data []byte
+	var err error
+	if source == "-" {
+		if util.IsTerminal(os.Stdin) {
+			translateFail("nothing to translate: give a file, or pipe text in")
+		}
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		translateFail(err.Error())
+	}
+	text := string(data)
+	if strings.TrimSpace(text) == "" {
+		translateFail("there is nothing to translate")
+	}
+
+	appConfig, modelConfig := loadModelConfig()
+	opts := llm.TranslateOptions{From: translateFrom, To: translateTo}
+	glossaryPath := translateGlossary
+	if glossaryPath == "" {
+		glossaryPath = appConfig.Preferences.TranslateGlossary
+	}
+	if glossaryPath != "" {
+		if opts.Glossary, err = translate.LoadGlossary(util.ExpandHome(glossaryPath)); err != nil {
+			translateFail(err.Error())
+		}
+	}
+
+	c := llm.NewLLMClient(modelConfig)
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	styleDim := lipgloss.NewStyle().Faint(true)
+	if opts.From == "" {
+		detected, err := c.DetectLanguage(text)
+		if err != nil {
+			fmt.Fprintf(util.Notes(), "Warning: couldn't detect the language: %v\n", err)
+		} else {
+			opts.From = detected
+			fmt.Fprintln(util.Notes(), styleDim.Render("Detected "+translate.LanguageName(detected)+"."))
+		}
+	}
+	if opts.From != "" && translate.SameLanguage(opts.From, opts.To) {
+		fmt.Fprintln(util.Notes(), styleDim.Render("The text is already in "+translate.LanguageName(opts.To)+"."))
+		fmt.Fprint(answerOut, text)
+		return
+	}
+
+	translated, lost, err := c.Translate(text, opts, func(part, parts int) {
+		if parts > 1 {
+			fmt.Fprintln(util.Notes(), styleDim.Render(fmt.Sprintf("Translating part %d of %d...", part, parts)))
+		}
+	})
+	if err != nil {
+		translateFail(requestError(err))
+	}
+	if len(lost) > 0 {
+		fmt.Fprintf(util.Notes(), "Warning: the translation dropped %d protected span(s), such as %s\n", len(lost), lost[0])
+	}
+	fmt.Fprintln(answerOut, translated)
+}
+
+func translateFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(exitStatus)
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+
+	"q/config"
+	"q/llm"
+	"q/readable"
+	"q/tokens"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// defaultURLTokens is how much of each page --url sends when urls.max_tokens isn't set
+const defaultURLTokens = 4000
+
+// pinURLs fetches the --url pages and pins their main text to the client's
+// context, each cut to the token budget, so every answer in the session can
+// draw on them
+func pinURLs(c *llm.LLMClient, appConfig config.AppConfig) error {
+	var allow, deny []string
+	budget := defaultURLTokens
+	if urls := appConfig.Preferences.URLs; urls != nil {
+		allow, deny = urls.Allow, urls.Deny
+		if urls.MaxTokens > 0 {
+			budget = urls.MaxTokens
+		}
+	}
+
+	styleDim := lipgloss.NewStyle().Faint(true)
+	for _, url := range urlFlags {
+		title, text, err := readable.FetchAllowed(url, allow, deny)
+		if err != nil {
+			return fmt.Errorf("--url %s: %w", url, err)
+		}
+		note := "Fetched " + url
+		if parts := tokens.Split(text, budget); len(parts) > 1 {
+			text = parts[0] + "\n\n[... truncated ...]"
+			note += fmt.Sprintf(" (cut to about %d tokens)", budget)
+		}
+		if text == "" {
+			return fmt.Errorf("--url %s: the page has no readable text", url)
+		}
+		fmt.Fprintln(util.Notes(), styleDim.Render(note))
+
+		source := url
+		if title != "" {
+			source = fmt.Sprintf("%q (%s)", title, url)
+		}
+		c.Pin(Message{
+			Role: "system",
+			Content: fmt.Sprintf("The user has shared the web page %s. Here is its text:\n\n%s\n\n"+
+				"Use it to answer, and say so if it doesn't cover the question.", source, text),
+		})
+		c.URLs = append(c.URLs, url)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"q/config"
+	"q/llm"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	voiceFlag bool
+	audioFlag string
+)
+
+// stdinLines reads answers typed while recording and confirming, shared so
+// nothing typed ahead is lost between the two
+var stdinLines = bufio.NewReader(os.Stdin)
+
+// voicePrompt records from the microphone (--voice) or reads --audio,
+// transcribes it, and lets the user confirm or edit the transcript before it
+// becomes the prompt. Any prompt given as arguments comes first.
+func voicePrompt(appConfig config.AppConfig, modelConfig ModelConfig, prefix string) string {
+	voice := VoiceConfig{}
+	if appConfig.Preferences.Voice != nil {
+		voice = *appConfig.Preferences.Voice
+	}
+	if voice.Model == "" {
+		voice.Model = llm.DefaultTranscriptionModel
+	}
+	interactive := util.IsTerminal(os.Stdin) && !quietFlag
+
+	path := audioFlag
+	if voiceFlag {
+		if !util.IsTerminal(os.Stdin) {
+			voiceFail("--voice needs a terminal to stop the recording; use --audio with a file instead")
+		}
+		recording, err := recordAudio(voice.Recorder)
+		if recording != "" {
+			defer os.Remove(recording)
+		}
+		if err != nil {
+			voiceFail(err.Error())
+		}
+		path = recording
+	}
+
+	c := llm.NewLLMClient(modelConfig)
+	c.ErrorLog = appConfig.Preferences.ErrorLog
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fmt.Fprintln(util.Notes(), styleDim.Render(fmt.Sprintf("Transcribing with %s...", voice.Model)))
+	start := time.Now()
+	transcript, err := c.Transcribe(path, voice.Model, voice.Language)
+	c.LogTranscription(path, voice.Model, transcript, time.Since(start).Milliseconds(), err)
+	if err != nil {
+		voiceFail("transcription failed: " + requestError(err))
+	}
+	text := strings.TrimSpace(transcript.Text)
+	if text == "" {
+		voiceFail("no speech was recognized")
+	}
+
+	if interactive {
+		text = confirmTranscript(text)
+	}
+	if prefix != "" {
+		return prefix + " " + text
+	}
+	return text
+}
+
+// recordAudio records a mono WAV file until Enter is pressed
+func recordAudio(recorder string) (string, error) {
+	file, err := os.CreateTemp("", "q-voice-*.wav")
+	if err != nil {
+		return "", err
+	}
+	path := file.Name()
+	file.Close()
+	// The recorder writes the file itself
+	os.Remove(path)
+
+	cmd, err := recorderCommand(recorder, path)
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start the recorder: %w", err)
+	}
+	styleHighlight := lipgloss.NewStyle().Foreground(theme.Highlight())
+	fmt.Fprint(util.Notes(), styleHighlight.Render("● Recording, press Enter to stop... "))
+	stdinLines.ReadString('\n')
+
+	// Recorders finish the file when interrupted; kill any that don't stop
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		cmd.Process.Kill()
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		cmd.Process.Kill()
+		<-done
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Size() <= 44 {
+		return path, fmt.Errorf("nothing was recorded; check the microphone, or set voice.recorder in the config")
+	}
+	return path, nil
+}
+
+// recorderCommand builds the recording command: voice.recorder with {file}
+// replaced, or the first of sox, arecord and ffmpeg that is installed
+func recorderCommand(recorder, path string) (*exec.Cmd, error) {
+	if recorder != "" {
+		args := strings.Fields(recorder)
+		for i, arg := range args {
+			args[i] = strings.ReplaceAll(arg, "{file}", path)
+		}
+		return exec.Command(args[0], args[1:]...), nil
+	}
+	if _, err := exec.LookPath("rec"); err == nil {
+		return exec.Command("rec", "-q", "-c", "1", "-r", "16000", "-b", "16", path), nil
+	}
+	if _, err := exec.LookPath("arecord"); err == nil {
+		return exec.Command("arecord", "-q", "-f", "S16_LE", "-c", "1", "-r", "16000", path), nil
+	}
+	if _, err := exec.LookPath("ffmpeg"); err == nil {
+		input := []string{"-f", "pulse", "-i", "default"}
+		if runtime.GOOS == "darwin" {
+			input = []string{"-f", "avfoundation", "-i", ":0"}
+		}
+		args := append([]string{"-nostdin", "-loglevel", "error"}, input...)
+		return exec.Command("ffmpeg", append(args, "-ac", "1", "-ar", "16000", path)...), nil
+	}
+	return nil, fmt.Errorf("no recorder found: install sox or ffmpeg, or set voice.recorder in the config")
+}
+
+// confirmTranscript shows the transcript and asks whether to send it as it
+// is, edit it first, or give up
+func confirmTranscript(text string) string {
+	styleDim := lipgloss.NewStyle().Faint(true)
+	for {
+		fmt.Fprintln(util.Notes(), "\n  "+text+"\n")
+		fmt.Fprint(util.Notes(), styleDim.Render("Send this? [Y/n/e to edit] "))
+		answer, err := stdinLines.ReadString('\n')
+		if err != nil {
+			os.Exit(1)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "", "y", "yes":
+			return text
+		case "n", "no":
+			fmt.Fprintln(util.Notes(), styleDim.Render("Cancelled."))
+			os.Exit(0)
+		case "e", "edit":
+			edited, err := editText(text)
+			if err != nil {
+				fmt.Fprintf(util.Notes(), "Warning: %v\n", err)
+				continue
+			}
+			if edited == "" {
+				fmt.Fprintln(util.Notes(), styleDim.Render("Cancelled."))
+				os.Exit(0)
+			}
+			return edited
+		}
+	}
+}
+
+// editText opens text in $EDITOR and returns what was saved
+func editText(text string) (string, error) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("q-transcript-%d.txt", os.Getpid()))
+	if err := os.WriteFile(path, []byte(text+"\n"), 0600); err != nil {
+		return "", err
+	}
+	defer os.Remove(path)
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command(editor, path) //nolint:gosec
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor failed: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func voiceFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(exitStatus)
+}
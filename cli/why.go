@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"q/diagnose"
+	"q/llm"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// maxWhyErrorChars caps how much piped error output is sent
+const maxWhyErrorChars = 8000
+
+var whyCmd = &cobra.Command{
+	Use:     "why <command> [error]",
+	Aliases: []string{"which"},
+	Short:   "Explain why a command isn't found or can't run, from facts checked on this machine",
+	Long: `Find out why a command fails with "command not found" or "permission
+denied". q first checks the facts itself: where the program is on the PATH,
+or installed off it, programs with similar names, PATH entries that don't
+exist, the file's permissions and the interpreter its script asks for. It
+shows them, then has the model explain the failure from them, so it doesn't
+suggest installing what's already there. Give the error message after the
+command, or pipe it in:
+
+  q why rg
+  q why ./deploy.sh permission denied
+  ./deploy.sh 2>&1 | q why ./deploy.sh`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runWhy(args[0], strings.Join(args[1:], " "))
+	},
+}
+
+func init() {
+	addQuietFlag(whyCmd)
+	RootCmd.AddCommand(whyCmd)
+}
+
+func runWhy(command, errorText string) {
+	if errorText == "" && !util.IsTerminal(os.Stdin) {
+		data, err := io.ReadAll(io.LimitReader(os.Stdin, maxWhyErrorChars))
+		if err != nil {
+			whyFail(err.Error())
+		}
+		errorText = strings.TrimSpace(string(data))
+	}
+	report := diagnose.Inspect(command, diagnose.FromOS())
+	if report.Name == "" {
+		whyFail("give the command that fails")
+	}
+
+	styleDim := lipgloss.NewStyle().Faint(true)
+	var facts strings.Builder
+	for _, fact := range report.Facts {
+		facts.WriteString("- " + fact + "\n")
+	}
+	fmt.Fprintln(util.Notes(), styleDim.Render("Checked on this machine:\n"+strings.TrimSuffix(facts.String(), "\n")))
+
+	question := fmt.Sprintf("Why does running `%s` fail, and how do I fix it?", command)
+	if errorText != "" {
+		question = fmt.Sprintf("Running `%s` fails with:\n\n```\n%s\n```\n\nWhy, and how do I fix it?", command, errorText)
+	}
+	appConfig, modelConfig := loadModelConfig()
+	runSession(appConfig, modelConfig, question, func(c *llm.LLMClient) {
+		c.Pin(Message{
+			Role: "system",
+			Content: fmt.Sprintf("The user's command `%s` can't be run. These facts were checked on their machine, so they're certain:\n\n%s\n"+
+				"Explain the failure from these facts, most likely cause first, and give the fix as commands. "+
+				"Don't suggest anything they rule out, like installing a program that's already there. "+
+				"If they don't explain it, say so, and mention what they couldn't check, such as shell aliases and functions.",
+				command, facts.String()),
+		})
+	})
+}
+
+func whyFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Printf("\n  %v\n\n", styleRed.Render("Error: "+msg))
+	os.Exit(1)
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"q/theme"
+	"q/workspace"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var workspaceFlag string
+
+var workspacesCmd = &cobra.Command{
+	Use:   "workspaces",
+	Short: "List the workspaces, each with its own config, memory and logs",
+	Long: `List the workspaces that have been used. A workspace is a directory of its
+own under ~/.shell-ai/workspaces, with its own config, remembered facts,
+context index, conversations and logs, so client work, personal use and
+experiments never share a history or a budget. Select one for a run with
+--workspace, or for a shell with SHELL_AI_WORKSPACE:
+
+  q --workspace clientA how do I rotate the staging certs
+  export SHELL_AI_WORKSPACE=clientA
+
+A workspace is created the first time it's used, starting with a copy of the
+main config.`,
+	Args: cobra.NoArgs,
+	Run:  runWorkspacesCommand,
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&workspaceFlag, "workspace", "", "Use this workspace's config, memory and logs (default $SHELL_AI_WORKSPACE, or the main one)")
+	RootCmd.AddCommand(workspacesCmd)
+}
+
+// initWorkspace selects --workspace before anything reads the config or
+// logs. It's passed on in the environment, so commands q starts, like q
+// itself in a hook, use it too.
+func initWorkspace() {
+	if workspaceFlag != "" {
+		os.Setenv(workspace.EnvVar, workspaceFlag)
+	}
+	if name := workspace.Name(); name != "" {
+		if err := workspace.Check(name); err != nil {
+			workspaceFail(err.Error())
+		}
+	}
+}
+
+func runWorkspacesCommand(cmd *cobra.Command, args []string) {
+	names, err := workspace.List()
+	if err != nil {
+		workspaceFail(err.Error())
+	}
+	root, err := workspace.Root()
+	if err != nil {
+		workspaceFail(err.Error())
+	}
+	active := workspace.Name()
+	activeStyle := lipgloss.NewStyle().Foreground(theme.Accent()).Bold(true)
+	styleDim := lipgloss.NewStyle().Faint(true)
+
+	width := len("main")
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	line := func(name, dir string) {
+		marker, padded := "  ", fmt.Sprintf("%-*s", width, name)
+		if name == active || (name == "main" && active == "") {
+			marker, padded = "* ", activeStyle.Render(padded)
+		}
+		fmt.Printf("%s%s  %s\n", marker, padded, styleDim.Render(dir))
+	}
+	line("main", root)
+	for _, name := range names {
+		line(name, filepath.Join(root, "workspaces", name))
+	}
+}
+
+func workspaceFail(msg string) {
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error())
+	fmt.Fprintf(os.Stderr, "\n  %v\n\n", styleRed.Render("Error: "+strings.TrimSpace(msg)))
+	os.Exit(exitStatus)
+}
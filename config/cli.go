@@ -6,29 +6,38 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"q/theme"
 	"q/types"
 	"q/util"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
 )
 
 const listHeight = 12
 
 var (
-	styleRed          = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
-	greyStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
-	titleStyle        = lipgloss.NewStyle().MarginLeft(2).Foreground(lipgloss.Color("240"))
+	styleRed          lipgloss.Style
+	greyStyle         lipgloss.Style
+	titleStyle        lipgloss.Style
 	itemStyle         = lipgloss.NewStyle().PaddingLeft(4)
-	selectedItemStyle = lipgloss.NewStyle().PaddingLeft(2).Foreground(lipgloss.Color("170"))
+	selectedItemStyle lipgloss.Style
 	paginationStyle   = list.DefaultStyles().PaginationStyle.PaddingLeft(4)
 	helpStyle         = list.DefaultStyles().HelpStyle.PaddingLeft(4).PaddingBottom(1)
 	quitTextStyle     = lipgloss.NewStyle().Faint(true).Margin(1, 0, 2, 4)
 )
 
+// loadThemeStyles sets the colored styles from the active theme, which is
+// only known once the command line has been parsed
+func loadThemeStyles() {
+	styleRed = lipgloss.NewStyle().Foreground(theme.Error())
+	greyStyle = lipgloss.NewStyle().Foreground(theme.Muted())
+	titleStyle = lipgloss.NewStyle().MarginLeft(2).Foreground(theme.Muted())
+	selectedItemStyle = lipgloss.NewStyle().PaddingLeft(2).Foreground(theme.Highlight())
+}
+
 // type item string
 
 // func (i item) FilterValue() string { return "" }
@@ -395,6 +404,9 @@ func modelDetailsForModelMenu(appConfig AppConfig, modelConfig types.ModelConfig
 		{
 			title: "Name: " + modelConfig.ModelName,
 		},
+		{
+			title: "Provider: " + modelConfig.Provider,
+		},
 		{
 			title: "Endpoint: " + modelConfig.Endpoint,
 		},
@@ -413,12 +425,10 @@ func modelDetailsForModelMenu(appConfig AppConfig, modelConfig types.ModelConfig
 
 func PrintConfigErrorMessage(err error) {
 	maxWidth := util.GetTermSafeMaxWidth()
-	styleRed := lipgloss.NewStyle().Foreground(lipgloss.Color("9")).PaddingLeft(2)
+	styleRed := lipgloss.NewStyle().Foreground(theme.Error()).PaddingLeft(2)
 	styleDim := lipgloss.NewStyle().Faint(true).Width(maxWidth).PaddingLeft(2)
 
-	r, _ := glamour.NewTermRenderer(
-		glamour.WithAutoStyle(),
-	)
+	r, _ := theme.MarkdownRenderer(0)
 
 	msg1 := styleRed.Render("Failed to load config file.")
 
@@ -502,6 +512,7 @@ func handleResetOrRevert(arg string) {
 }
 
 func RunConfigProgram(args []string) {
+	loadThemeStyles()
 
 	handleConfigResets(args)
 
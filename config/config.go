@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	. "q/types"
+	"q/workspace"
+	"strings"
 
 	_ "embed"
 
@@ -12,9 +14,11 @@ import (
 )
 
 type AppConfig struct {
-	Models      []ModelConfig `yaml:"models"`
-	Preferences Preferences   `yaml:"preferences"`
-	Version     string        `yaml:"config_format_version"`
+	Models      []ModelConfig    `yaml:"models"`
+	Personas    []Persona        `yaml:"personas"`
+	Preferences Preferences      `yaml:"preferences"`
+	Themes      map[string]Theme `yaml:"themes,omitempty"`
+	Version     string           `yaml:"config_format_version"`
 }
 
 // //go:embed config.yaml
@@ -22,18 +26,24 @@ type AppConfig struct {
 
 //go:embed config.yaml
 var embeddedConfigFile []byte
-var configFilePath string = ".shell-ai/config.yaml"
-var backupConfigFilePath string = ".shell-ai/.backup-config.yaml"
+var configFilePath string = "config.yaml"
+var backupConfigFilePath string = ".backup-config.yaml"
 
+// FullFilePath returns where a file in the workspace's directory is
 func FullFilePath(relativeFilePath string) (string, error) {
-	homeDir, err := os.UserHomeDir()
+	dir, err := workspace.Dir()
 	if err != nil {
-		return "", fmt.Errorf("error getting home directory: %s", err)
+		return "", fmt.Errorf("error getting config directory: %s", err)
 	}
-	configFilePath := filepath.Join(homeDir, relativeFilePath)
+	configFilePath := filepath.Join(dir, relativeFilePath)
 	return configFilePath, nil
 }
 
+// Path returns where the config file is, whether or not it exists yet
+func Path() (string, error) {
+	return FullFilePath(configFilePath)
+}
+
 func LoadAppConfig() (config AppConfig, err error) {
 	filePath, err := FullFilePath(configFilePath)
 	if err != nil {
@@ -42,6 +52,9 @@ func LoadAppConfig() (config AppConfig, err error) {
 
 	// if file doesn't exist, create it with defaults
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		if workspace.Name() != "" {
+			return createWorkspaceConfig(filePath)
+		}
 		return createConfigWithDefaults(filePath)
 	}
 	return loadExistingConfig(filePath)
@@ -86,19 +99,77 @@ func createConfigWithDefaults(filePath string) (AppConfig, error) {
 	return config, writeConfigToFile(config)
 }
 
-func loadExistingConfig(filePath string) (AppConfig, error) {
-	config := AppConfig{}
-	yamlFile, err := os.ReadFile(filePath)
+// createWorkspaceConfig starts a workspace's config as a copy of the main
+// one, so its models and keys carry over, or with defaults if there's none
+func createWorkspaceConfig(filePath string) (AppConfig, error) {
+	root, err := workspace.Root()
 	if err != nil {
-		return config, fmt.Errorf("error reading config file: %s", err)
+		return createConfigWithDefaults(filePath)
 	}
-	err = yaml.Unmarshal(yamlFile, &config)
+	// The file is copied as it is, leaving ${VAR}s for each run to expand
+	data, err := os.ReadFile(filepath.Join(root, configFilePath))
+	if err != nil {
+		return createConfigWithDefaults(filePath)
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return AppConfig{}, fmt.Errorf("error creating directories: %s", err)
+	}
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return AppConfig{}, fmt.Errorf("error writing config to file: %s", err)
+	}
+	return loadExistingConfig(filePath)
+}
+
+func loadExistingConfig(filePath string) (AppConfig, error) {
+	config, problems, err := ValidateFile(filePath)
 	if err != nil {
-		return config, fmt.Errorf("error unmarshalling config file: %s", err)
+		return config, err
+	}
+	// Unknown keys are left for `q config validate` to point out
+	var errs []string
+	for _, problem := range problems {
+		if !problem.Warning {
+			errs = append(errs, problem.String())
+		}
+	}
+	if len(errs) > 0 {
+		return config, fmt.Errorf("invalid config file:\n%s", strings.Join(errs, "\n"))
+	}
+	// configs written before personas existed get the built-in ones
+	if config.Personas == nil {
+		config.Personas = defaultPersonas()
 	}
 	return config, nil
 }
 
+func defaultPersonas() []Persona {
+	defaults := AppConfig{}
+	if err := yaml.Unmarshal(embeddedConfigFile, &defaults); err != nil {
+		return nil
+	}
+	return defaults.Personas
+}
+
+// DefaultPrompt is the prompt of the default config's first model, for
+// models added without one
+func DefaultPrompt() []Message {
+	defaults := AppConfig{}
+	if err := yaml.Unmarshal(embeddedConfigFile, &defaults); err != nil || len(defaults.Models) == 0 {
+		return nil
+	}
+	return defaults.Models[0].Prompt
+}
+
+// FindPersona returns the persona with the given name
+func FindPersona(config AppConfig, name string) (Persona, error) {
+	for _, persona := range config.Personas {
+		if persona.Name == name {
+			return persona, nil
+		}
+	}
+	return Persona{}, fmt.Errorf("persona %q not found (see `q personas list`)", name)
+}
+
 func SaveBackupConfig(config AppConfig) error {
 	filePath, err := FullFilePath(backupConfigFilePath)
 	if err != nil {
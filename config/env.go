@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	. "q/types"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var (
+	// envReference matches ${VAR} and ${VAR:-default}
+	envReference = regexp.MustCompile(`\$\{([^}]*)\}`)
+	envName      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// envError is a bad or unset variable reference in a setting
+type envError struct {
+	at  path
+	msg string
+}
+
+func (e *envError) Error() string {
+	return e.at.String() + ": " + e.msg
+}
+
+// ExpandEnv returns model with the ${VAR} references in its settings replaced
+// by the variables' values, so one config can serve several machines.
+// ${VAR:-default} falls back to default when VAR is unset or empty. Prompts,
+// system prompt sections, examples and the prefill are left alone, since they
+// may well contain shell code. The settings are copied, so the config the
+// model came from is unchanged.
+func ExpandEnv(model ModelConfig) (ModelConfig, error) {
+	if err := expandValue(reflect.ValueOf(&model).Elem(), nil, os.LookupEnv); err != nil {
+		return model, fmt.Errorf("model %s: %w", model.ModelName, err)
+	}
+	return model, nil
+}
+
+// expandValue expands the strings in v, which is at the given path in a
+// model's settings, replacing any pointers, slices and maps it goes through
+// with copies
+func expandValue(v reflect.Value, at path, lookup func(string) (string, bool)) error {
+	switch v.Kind() {
+	case reflect.String:
+		expanded, err := expandEnv(v.String(), lookup)
+		if err != nil {
+			return &envError{at: at, msg: err.Error()}
+		}
+		v.SetString(expanded)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		copied := reflect.New(v.Elem().Type())
+		copied.Elem().Set(v.Elem())
+		v.Set(copied)
+		return expandValue(copied.Elem(), at, lookup)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(copied, v)
+		v.Set(copied)
+		for i := 0; i < copied.Len(); i++ {
+			if err := expandValue(copied.Index(i), at.with(i), lookup); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			if err := expandValue(value, at.with(fmt.Sprint(iter.Key().Interface())), lookup); err != nil {
+				return err
+			}
+			copied.SetMapIndex(iter.Key(), value)
+		}
+		v.Set(copied)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "-" || name == "prompt" || name == "system_prompt" || name == "examples" || name == "prefill" || field.PkgPath != "" {
+				continue
+			}
+			if err := expandValue(v.Field(i), at.with(name), lookup); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandEnv replaces the variable references in s with their values from lookup
+func expandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var err error
+	expanded := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name, fallback, hasFallback := ref[2:len(ref)-1], "", false
+		if parts := strings.SplitN(name, ":-", 2); len(parts) == 2 {
+			name, fallback, hasFallback = parts[0], parts[1], true
+		}
+		if !envName.MatchString(name) {
+			if err == nil {
+				err = fmt.Errorf("%s is not a valid variable reference", ref)
+			}
+			return ref
+		}
+		value, ok := lookup(name)
+		switch {
+		case value != "":
+			return value
+		case hasFallback:
+			return fallback
+		case !ok && err == nil:
+			err = fmt.Errorf("%s is not set", name)
+		}
+		return value
+	})
+	if err == nil && strings.Contains(envReference.ReplaceAllString(s, ""), "${") {
+		err = fmt.Errorf("%q has a ${ without a closing }", s)
+	}
+	return expanded, err
+}
@@ -0,0 +1,457 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"q/pkgmgr"
+	"q/provider"
+	"q/sysprompt"
+	"q/theme"
+	. "q/types"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Problem is a mistake in a config file
+type Problem struct {
+	// Line is where the problem is in the file, or 0 if it couldn't be placed
+	Line int
+	// Path is the setting at fault, like models[1].api
+	Path    string
+	Message string
+	// Warning marks problems q loads the config despite: unknown keys, which
+	// may be meant for a newer version of q
+	Warning bool
+}
+
+func (p Problem) String() string {
+	msg := p.Message
+	if p.Path != "" {
+		msg = p.Path + ": " + msg
+	}
+	if p.Line > 0 {
+		msg = fmt.Sprintf("line %d: %s", p.Line, msg)
+	}
+	return msg
+}
+
+// ValidateFile reads and validates the config file at path
+func ValidateFile(path string) (AppConfig, []Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return AppConfig{}, nil, fmt.Errorf("error reading config file: %s", err)
+	}
+	config, problems := Validate(data)
+	return config, problems, nil
+}
+
+// Validate parses a config file, reporting syntax errors, values of the wrong
+// type, unknown keys, missing required fields and values a setting doesn't
+// take, in the order they appear. The config is decoded as far as possible.
+func Validate(data []byte) (AppConfig, []Problem) {
+	var config AppConfig
+	err := yaml.UnmarshalStrict(data, &config)
+	var typeErr *yaml.TypeError
+	if err != nil && !errors.As(err, &typeErr) {
+		// A syntax error stops decoding altogether
+		return config, []Problem{parseProblem(strings.TrimPrefix(err.Error(), "yaml: "))}
+	}
+
+	var problems []Problem
+	if typeErr != nil {
+		for _, msg := range typeErr.Errors {
+			problems = append(problems, parseProblem(msg))
+		}
+	}
+	v := &validator{lines: splitLines(data)}
+	v.check(config)
+	problems = append(problems, v.problems...)
+	sort.SliceStable(problems, func(i, j int) bool {
+		// Problems that couldn't be placed go last
+		if problems[i].Line == 0 || problems[j].Line == 0 {
+			return problems[j].Line == 0 && problems[i].Line != 0
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return config, problems
+}
+
+var (
+	linePattern         = regexp.MustCompile(`^line (\d+): (.*)$`)
+	unknownFieldPattern = regexp.MustCompile(`^field (\S+) not found in type (\S+)$`)
+	// headerName matches the token characters RFC 9110 allows in field names
+	headerName = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+)
+
+// parseProblem turns one of the yaml package's messages into a Problem
+func parseProblem(msg string) Problem {
+	problem := Problem{Message: msg}
+	if m := linePattern.FindStringSubmatch(msg); m != nil {
+		problem.Line, _ = strconv.Atoi(m[1])
+		problem.Message = m[2]
+	}
+	if m := unknownFieldPattern.FindStringSubmatch(problem.Message); m != nil {
+		problem.Message = fmt.Sprintf("unknown key %q", m[1])
+		if suggestion := closest(m[1], configKeys()[m[2]]); suggestion != "" {
+			problem.Message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+		problem.Warning = true
+	}
+	return problem
+}
+
+// configKeys maps each struct type in the config, named as the yaml package
+// names it in errors, to its keys
+func configKeys() map[string][]string {
+	keys := map[string][]string{}
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || keys[t.String()] != nil {
+			return
+		}
+		keys[t.String()] = []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "-" || field.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			keys[t.String()] = append(keys[t.String()], name)
+			walk(field.Type)
+		}
+	}
+	walk(reflect.TypeOf(AppConfig{}))
+	return keys
+}
+
+// closest returns the candidate a misspelled word was most likely meant to be,
+// if any is within a couple of edits
+func closest(word string, candidates []string) string {
+	best, bestDistance := "", 3
+	for _, candidate := range candidates {
+		if d := editDistance(word, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// validator checks a decoded config for missing and unknown values, placing
+// each problem in the file it came from
+type validator struct {
+	lines    []yamlLine
+	problems []Problem
+}
+
+// path is where a setting is in the config: keys and list indexes
+type path []interface{}
+
+func (p path) String() string {
+	var b strings.Builder
+	for _, part := range p {
+		switch part := part.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", part)
+		default:
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+			fmt.Fprint(&b, part)
+		}
+	}
+	return b.String()
+}
+
+func (p path) with(parts ...interface{}) path {
+	return append(append(path(nil), p...), parts...)
+}
+
+func (v *validator) report(at path, msg string) {
+	v.problems = append(v.problems, Problem{Line: v.locate(at), Path: at.String(), Message: msg})
+}
+
+// required reports a setting that must be set
+func (v *validator) required(at path, value string) {
+	if value == "" {
+		v.report(at, "is required")
+	}
+}
+
+// oneOf reports a setting set to a value it doesn't take; unset is fine
+func (v *validator) oneOf(at path, value string, allowed ...string) {
+	if value == "" {
+		return
+	}
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.report(at, fmt.Sprintf("%q is not one of %s", value, strings.Join(allowed, ", ")))
+}
+
+func (v *validator) check(config AppConfig) {
+	for i, model := range config.Models {
+		at := path{"models", i}
+		v.required(at.with("name"), model.ModelName)
+		v.oneOf(at.with("provider"), model.Provider, provider.Names()...)
+		v.oneOf(at.with("context_strategy"), model.ContextStrategy, "truncate", "summarize")
+		v.oneOf(at.with("context_recovery"), model.ContextRecovery, "truncate", "summarize", "off")
+		v.oneOf(at.with("key_rotation"), model.KeyRotation, "failover", "round-robin")
+		if model.IdleTimeout != "" {
+			if d, err := time.ParseDuration(model.IdleTimeout); err != nil || d < 0 {
+				v.report(at.with("idle_timeout"), fmt.Sprintf("%q is not a duration like 20s or 1m", model.IdleTimeout))
+			}
+		}
+		v.oneOf(at.with("api"), model.API, "chat", "responses")
+		v.oneOf(at.with("reasoning_summary"), model.ReasoningSummary, "auto", "concise", "detailed")
+		v.oneOf(at.with("length"), model.Length, "short", "detailed")
+		for j, message := range model.Prompt {
+			v.required(at.with("prompt", j, "role"), message.Role)
+			v.oneOf(at.with("prompt", j, "role"), message.Role, "system", "user", "assistant")
+		}
+		for j, section := range model.SystemPrompt {
+			v.required(at.with("system_prompt", j, "section"), section.Section)
+			if _, err := sysprompt.Parse(section); err != nil && section.Section != "" {
+				v.report(at.with("system_prompt", j), err.Error())
+			}
+		}
+		v.examples(at, model.Examples)
+		for j, key := range model.Keys {
+			v.required(at.with("keys", j, "env_var"), key.EnvVar)
+		}
+		for name := range model.Headers {
+			if !headerName.MatchString(name) {
+				v.report(at.with("headers", name), fmt.Sprintf("%q is not a valid HTTP header name", name))
+			}
+		}
+		if model.Messages != nil {
+			v.oneOf(at.with("messages", "system"), model.Messages.System, "message", "first", "field", "user")
+		}
+		// Variables may be set on another machine; only the references are checked
+		anything := func(string) (string, bool) { return "x", true }
+		var envErr *envError
+		if err := expandValue(reflect.ValueOf(&model).Elem(), nil, anything); errors.As(err, &envErr) {
+			v.report(at.with(envErr.at...), envErr.msg)
+		}
+	}
+
+	for i, persona := range config.Personas {
+		at := path{"personas", i}
+		v.required(at.with("name"), persona.Name)
+		v.required(at.with("prompt"), persona.Prompt)
+		v.examples(at, persona.Examples)
+		v.oneOf(at.with("length"), persona.Length, "short", "detailed")
+	}
+
+	preferences := config.Preferences
+	at := path{"preferences"}
+	if !theme.Known(preferences.Theme, config.Themes) {
+		v.report(at.with("theme"), fmt.Sprintf("%q is not auto, dark, light, mono or one under themes", preferences.Theme))
+	}
+	v.oneOf(at.with("error_log"), preferences.ErrorLog, "record", "verbose", "off")
+	v.oneOf(at.with("offline_queue"), preferences.OfflineQueue, "auto", "manual", "off")
+	v.oneOf(at.with("thinking"), preferences.Thinking, "hide", "dim", "show")
+	v.oneOf(at.with("package_manager"), preferences.PackageManager, append([]string{"auto", "off"}, pkgmgr.Names()...)...)
+	for i, field := range preferences.FooterFields {
+		v.oneOf(at.with("footer_fields", i), field, "model", "tokens", "cost", "duration")
+	}
+	if preferences.DailyBudget < 0 {
+		v.report(at.with("daily_budget"), fmt.Sprintf("%v is not a budget: it can't be below 0", preferences.DailyBudget))
+	}
+	if preferences.NotifyAfter != "" {
+		if d, err := time.ParseDuration(preferences.NotifyAfter); err != nil || d < 0 {
+			v.report(at.with("notify_after"), fmt.Sprintf("%q is not a duration like 30s or 2m", preferences.NotifyAfter))
+		}
+	}
+	if preferences.DedupWindow != "" {
+		if d, err := time.ParseDuration(preferences.DedupWindow); err != nil || d < 0 {
+			v.report(at.with("dedup_window"), fmt.Sprintf("%q is not a duration like 5s or 1m", preferences.DedupWindow))
+		}
+	}
+	if routing := preferences.Routing; routing != nil {
+		for i, rule := range routing.Rules {
+			v.required(at.with("routing", "rules", i, "when"), rule.When)
+			v.oneOf(at.with("routing", "rules", i, "when"), strings.ToLower(rule.When), "code", "explain", "generate", "command", "long", "short")
+			v.required(at.with("routing", "rules", i, "model"), rule.Model)
+		}
+	}
+	if sandbox := preferences.Sandbox; sandbox != nil {
+		v.oneOf(at.with("sandbox", "backend"), sandbox.Backend, "auto", "bwrap", "firejail", "sandbox-exec", "docker")
+	}
+	if sink := preferences.LogSink; sink != nil {
+		if sink.URL == "" && sink.S3 == nil {
+			v.report(at.with("log_sink"), "needs url or s3")
+		} else if sink.URL != "" && sink.S3 != nil {
+			v.report(at.with("log_sink"), "has both url and s3; set one")
+		}
+		if sink.S3 != nil {
+			v.required(at.with("log_sink", "s3", "bucket"), sink.S3.Bucket)
+		}
+	}
+
+	names := make([]string, 0, len(config.Themes))
+	for name := range config.Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v.oneOf(path{"themes", name, "base"}, config.Themes[name].Base, "dark", "light", "mono")
+	}
+}
+
+// examples checks the few-shot examples of the model or persona at
+func (v *validator) examples(at path, examples []Example) {
+	for i, example := range examples {
+		v.required(at.with("examples", i, "prompt"), example.Prompt)
+		v.required(at.with("examples", i, "answer"), example.Answer)
+	}
+}
+
+// yamlLine is a line of block-style YAML, as far as locating keys needs
+type yamlLine struct {
+	// indent is the column the content starts at, past any "- " list markers
+	indent int
+	// marker is the column of the line's first list marker, or -1
+	marker int
+	// text is the content, or "" for blank lines and comments
+	text string
+}
+
+func splitLines(data []byte) []yamlLine {
+	var lines []yamlLine
+	for _, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		text := strings.TrimLeft(raw, " ")
+		line := yamlLine{indent: len(raw) - len(text), marker: -1}
+		for text == "-" || strings.HasPrefix(text, "- ") {
+			if line.marker < 0 {
+				line.marker = line.indent
+			}
+			rest := strings.TrimLeft(text[1:], " ")
+			line.indent += len(text) - len(rest)
+			text = rest
+		}
+		if !strings.HasPrefix(text, "#") {
+			line.text = text
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// locate returns the line a setting is on, or the line of the nearest
+// setting around it that is there, such as the list item missing a required
+// key. It returns 0 if the setting can't be found, as in flow-style YAML.
+func (v *validator) locate(at path) int {
+	start, end, found := 0, len(v.lines), 0
+	for _, part := range at {
+		first := start
+		for first < end && v.lines[first].text == "" {
+			first++
+		}
+		if first == end {
+			return found
+		}
+		match := -1
+		switch part := part.(type) {
+		case int:
+			// The part-th item of the list the region holds
+			marker := v.lines[first].marker
+			if marker < 0 {
+				return found
+			}
+			n := -1
+			for i := first; i < end; i++ {
+				if l := v.lines[i]; l.text != "" && l.marker == marker {
+					if n++; n == part {
+						match = i
+						break
+					}
+				}
+			}
+			if match < 0 {
+				return found
+			}
+			// The item's own keys start on its first line
+			start, end = match, v.blockEnd(match, marker, true, end)
+		default:
+			key := fmt.Sprint(part) + ":"
+			indent := v.lines[first].indent
+			for i := first; i < end; i++ {
+				l := v.lines[i]
+				if l.indent == indent && (l.marker < 0 || i == first) && strings.HasPrefix(l.text, key) {
+					match = i
+					break
+				}
+			}
+			if match < 0 {
+				return found
+			}
+			start, end = match+1, v.blockEnd(match, indent, false, end)
+		}
+		found = match + 1
+	}
+	return found
+}
+
+// blockEnd returns where the value of the key or list item at column indent
+// on line i ends: at the next line that isn't nested under it. A list may be
+// at the same column as its key, but not as another item.
+func (v *validator) blockEnd(i, indent int, item bool, end int) int {
+	for j := i + 1; j < end; j++ {
+		l := v.lines[j]
+		if l.text == "" {
+			continue
+		}
+		if l.marker < 0 && l.indent <= indent || l.marker >= 0 && (l.marker < indent || item && l.marker == indent) {
+			return j
+		}
+	}
+	return end
+}
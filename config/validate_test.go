@@ -0,0 +1,219 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	. "q/types"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestValidateDefaults(t *testing.T) {
+	if _, problems := Validate(embeddedConfigFile); len(problems) > 0 {
+		t.Errorf("default config has problems: %v", problems)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	data := `preferences:
+  default_model: gpt-4.1
+  theme: solarized
+  eror_log: verbose
+models:
+- name: gpt-4.1
+  prompt:
+  - role: system
+    content: hi
+  - role: sytem
+    content: hi
+  api: respones
+- provider: openai
+  context_window: lots
+personas:
+  - name: a
+    description: x
+themes:
+  ocean:
+    base: blue
+`
+	_, problems := Validate([]byte(data))
+	want := []string{
+		`line 3: preferences.theme: "solarized" is not auto, dark, light, mono or one under themes`,
+		`line 4: unknown key "eror_log" (did you mean "error_log"?)`,
+		`line 10: models[0].prompt[1].role: "sytem" is not one of system, user, assistant`,
+		`line 12: models[0].api: "respones" is not one of chat, responses`,
+		`line 13: models[1].name: is required`,
+		"line 14: cannot unmarshal !!str `lots` into int",
+		`line 16: personas[0].prompt: is required`,
+		`line 20: themes.ocean.base: "blue" is not one of dark, light, mono`,
+	}
+	var got []string
+	for _, problem := range problems {
+		got = append(got, problem.String())
+		if problem.Warning != strings.Contains(problem.Message, "unknown key") {
+			t.Errorf("%s: Warning = %v", problem, problem.Warning)
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidateSyntaxError(t *testing.T) {
+	_, problems := Validate([]byte("models:\n  - name: a\n bad: [\n"))
+	if len(problems) != 1 || problems[0].Line == 0 || problems[0].Warning {
+		t.Errorf("problems = %+v, want one placed error", problems)
+	}
+}
+
+// Configs q saves itself put list items at the same column as their key
+func TestLocateSavedConfig(t *testing.T) {
+	var config AppConfig
+	if err := yaml.Unmarshal(embeddedConfigFile, &config); err != nil {
+		t.Fatal(err)
+	}
+	config.Models[1].API = "chatty"
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, problems := Validate(data)
+	if len(problems) != 1 {
+		t.Fatalf("problems = %v, want one", problems)
+	}
+	lines := strings.Split(string(data), "\n")
+	if line := lines[problems[0].Line-1]; strings.TrimSpace(line) != "api: chatty" {
+		t.Errorf("placed on line %d, %q", problems[0].Line, line)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("Q_TEST_HOST", "gpu-box")
+	t.Setenv("Q_TEST_EMPTY", "")
+	model := ModelConfig{
+		ModelName: "llama",
+		Endpoint:  "http://${Q_TEST_HOST}:${Q_TEST_PORT:-11434}/v1/chat/completions",
+		OrgID:     "${Q_TEST_EMPTY:-ORG_ID}",
+		Prompt:    []Message{{Role: "system", Content: "echo ${HOME}"}},
+		Keys:      []APIKey{{EnvVar: "KEY_${Q_TEST_HOST}"}},
+		Hooks:     &HooksConfig{PreRequest: "~/hooks/${Q_TEST_HOST}.star"},
+	}
+	expanded, err := ExpandEnv(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expanded.Endpoint != "http://gpu-box:11434/v1/chat/completions" || expanded.OrgID != "ORG_ID" ||
+		expanded.Keys[0].EnvVar != "KEY_gpu-box" || expanded.Hooks.PreRequest != "~/hooks/gpu-box.star" {
+		t.Errorf("expanded = %+v", expanded)
+	}
+	if expanded.Prompt[0].Content != "echo ${HOME}" {
+		t.Errorf("prompt was expanded: %q", expanded.Prompt[0].Content)
+	}
+	if model.Keys[0].EnvVar != "KEY_${Q_TEST_HOST}" || model.Hooks.PreRequest != "~/hooks/${Q_TEST_HOST}.star" {
+		t.Errorf("the original model was changed: %+v", model)
+	}
+
+	model.Endpoint = "http://${Q_TEST_UNSET}/v1"
+	if _, err := ExpandEnv(model); err == nil || err.Error() != "model llama: endpoint: Q_TEST_UNSET is not set" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestValidateEnvReferences(t *testing.T) {
+	data := "models:\n  - name: a\n    endpoint: http://${HOST/v1\n  - name: b\n    endpoint: http://${NOT_SET_ANYWHERE}/v1\n"
+	_, problems := Validate([]byte(data))
+	if len(problems) != 1 || problems[0].Line != 3 || problems[0].Path != "models[0].endpoint" {
+		t.Errorf("problems = %v, want one on line 3", problems)
+	}
+}
+
+func TestValidateExamples(t *testing.T) {
+	data := "models:\n  - name: a\n    examples:\n      - prompt: print hi\n        answer: echo hi\n      - prompt: list files\npersonas:\n  - name: p\n    prompt: be brief\n    examples:\n      - answer: ok\n"
+	_, problems := Validate([]byte(data))
+	var got []string
+	for _, problem := range problems {
+		got = append(got, problem.String())
+	}
+	want := "line 6: models[0].examples[1].answer: is required\nline 11: personas[0].examples[0].prompt: is required"
+	if strings.Join(got, "\n") != want {
+		t.Errorf("got problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), want)
+	}
+}
+
+func TestValidateLength(t *testing.T) {
+	data := "models:\n  - name: a\n    length: short\npersonas:\n  - name: p\n    prompt: be brief\n    length: terse\n"
+	_, problems := Validate([]byte(data))
+	var got []string
+	for _, problem := range problems {
+		got = append(got, problem.String())
+	}
+	want := `line 7: personas[0].length: "terse" is not one of short, detailed`
+	if strings.Join(got, "\n") != want {
+		t.Errorf("got problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), want)
+	}
+}
+
+func TestValidateNotifyAfter(t *testing.T) {
+	for value, ok := range map[string]bool{"30s": true, "2m": true, "10": false, "-5s": false} {
+		_, problems := Validate([]byte("preferences:\n  notify_after: " + value + "\n"))
+		if ok != (len(problems) == 0) {
+			t.Errorf("notify_after: %s gave problems %v", value, problems)
+		}
+	}
+}
+
+func TestValidateFooterFields(t *testing.T) {
+	_, problems := Validate([]byte("preferences:\n  footer: true\n  footer_fields: [cost, time]\n"))
+	if len(problems) != 1 || problems[0].String() != `line 3: preferences.footer_fields[1]: "time" is not one of model, tokens, cost, duration` {
+		t.Errorf("problems = %v", problems)
+	}
+}
+
+func TestValidateDailyBudget(t *testing.T) {
+	_, problems := Validate([]byte("preferences:\n  daily_budget: -2\n"))
+	if len(problems) != 1 || problems[0].String() != `line 2: preferences.daily_budget: -2 is not a budget: it can't be below 0` {
+		t.Errorf("problems = %v", problems)
+	}
+}
+
+func TestValidateIdleTimeout(t *testing.T) {
+	for value, ok := range map[string]bool{"45s": true, "0": true, "20": false, "-1s": false} {
+		_, problems := Validate([]byte("models:\n  - name: a\n    idle_timeout: " + value + "\n"))
+		if ok != (len(problems) == 0) {
+			t.Errorf("idle_timeout: %s gave problems %v", value, problems)
+		}
+	}
+}
+
+func TestValidateHeaders(t *testing.T) {
+	data := "models:\n  - name: a\n    headers:\n      X-Tenant: ${TENANT}\n      Bad Header: x\n"
+	_, problems := Validate([]byte(data))
+	var got []string
+	for _, problem := range problems {
+		got = append(got, problem.String())
+	}
+	want := `line 5: models[0].headers.Bad Header: "Bad Header" is not a valid HTTP header name`
+	if strings.Join(got, "\n") != want {
+		t.Errorf("got problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), want)
+	}
+
+	t.Setenv("Q_TEST_TENANT", "acme")
+	expanded, err := ExpandEnv(ModelConfig{ModelName: "a", Headers: map[string]string{"X-Tenant": "${Q_TEST_TENANT}"}})
+	if err != nil || expanded.Headers["X-Tenant"] != "acme" {
+		t.Errorf("ExpandEnv headers = %v, %v; want X-Tenant: acme", expanded.Headers, err)
+	}
+}
+
+func TestValidateSystemPrompt(t *testing.T) {
+	data := "models:\n  - name: a\n    system_prompt:\n      - section: persona\n      - section: team\n      - section: rules\n        template: \"{{if}}\"\n      - template: hi\n"
+	_, problems := Validate([]byte(data))
+	var got []string
+	for _, problem := range problems {
+		got = append(got, problem.Path)
+	}
+	want := "models[0].system_prompt[1]\nmodels[0].system_prompt[2]\nmodels[0].system_prompt[3].section"
+	if strings.Join(got, "\n") != want {
+		t.Errorf("got problems at:\n%s\nwant:\n%s", strings.Join(got, "\n"), want)
+	}
+}
@@ -0,0 +1,83 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2024, 1, 31, 18, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"0 18 * * 1-5", []string{"2024-02-01 18:00", "2024-02-02 18:00", "2024-02-05 18:00"}},
+		{"*/15 * * * *", []string{"2024-01-31 18:45", "2024-01-31 19:00", "2024-01-31 19:15"}},
+		{"@daily", []string{"2024-02-01 00:00", "2024-02-02 00:00", "2024-02-03 00:00"}},
+		{"0 9 29 feb *", []string{"2024-02-29 09:00", "2028-02-29 09:00"}},
+		// Either day field matches when both are restricted
+		{"0 0 1 * sun", []string{"2024-02-01 00:00", "2024-02-04 00:00", "2024-02-11 00:00"}},
+		{"30 6 * * 7", []string{"2024-02-04 06:30", "2024-02-11 06:30", "2024-02-18 06:30"}},
+		{"5/20 0 1 1,7 *", []string{"2024-07-01 00:05", "2024-07-01 00:25", "2024-07-01 00:45"}},
+		{"0 0 30 2 *", nil},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		var got []string
+		for _, run := range s.NextN(from, len(tt.want)) {
+			got = append(got, run.Format("2006-01-02 15:04"))
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.spec, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: got %v, want %v", tt.spec, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@fortnightly",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) should fail", spec)
+		}
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line, schedule, command string
+	}{
+		{"0 18 * * 1-5  /usr/local/bin/backup --all", "0 18 * * 1-5", "/usr/local/bin/backup --all"},
+		{"@hourly cd /srv && make", "@hourly", "cd /srv && make"},
+	}
+	for _, tt := range tests {
+		schedule, command, err := SplitLine(tt.line)
+		if err != nil || schedule != tt.schedule || command != tt.command {
+			t.Errorf("SplitLine(%q) = %q, %q, %v", tt.line, schedule, command, err)
+		}
+	}
+	if _, _, err := SplitLine("0 18 * * 1-5"); err == nil {
+		t.Error("a line without a command should fail")
+	}
+}
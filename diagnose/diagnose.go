@@ -0,0 +1,282 @@
+// Package diagnose gathers facts about why a command can't be run, for
+// `q why`: where it is on the PATH or off it, the PATH entries that are
+// broken, the file's permissions and the interpreter its script asks for.
+// The facts are checked rather than guessed, so the model explaining them
+// doesn't suggest installing a program that's already there.
+package diagnose
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// maxSimilar caps the names on the PATH listed as close to a missing command
+const maxSimilar = 5
+
+// Env is what the facts are gathered from
+type Env struct {
+	// Path is the value of PATH, Home the user's home directory and Shell
+	// the value of SHELL
+	Path  string
+	Home  string
+	Shell string
+}
+
+// FromOS is the environment of the running process
+func FromOS() Env {
+	home, _ := os.UserHomeDir()
+	return Env{Path: os.Getenv("PATH"), Home: home, Shell: os.Getenv("SHELL")}
+}
+
+// Report is what was found about a command
+type Report struct {
+	// Name is the program, the first word of the command line given
+	Name string
+	// Facts are what was found, one sentence each, most telling first
+	Facts []string
+}
+
+// Inspect gathers the facts about running a command line's program
+func Inspect(command string, env Env) Report {
+	fields := strings.Fields(command)
+	r := Report{}
+	if len(fields) == 0 {
+		return r
+	}
+	r.Name = fields[0]
+	if env.Shell != "" {
+		r.add("The shell is %s (%s).", filepath.Base(env.Shell), env.Shell)
+	}
+
+	if strings.ContainsRune(r.Name, '/') {
+		r.inspectFile(r.Name)
+		return r
+	}
+
+	dirs := filepath.SplitList(env.Path)
+	var found []string
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if candidate := filepath.Join(dir, r.Name); isFile(candidate) {
+			found = append(found, candidate)
+		}
+	}
+	if len(found) == 0 {
+		r.add("%s is not in any directory on the PATH.", r.Name)
+		if elsewhere := offPath(r.Name, dirs, env.Home); len(elsewhere) > 0 {
+			r.add("It is installed outside the PATH, at %s.", strings.Join(elsewhere, ", "))
+		}
+		if similar := similarNames(r.Name, dirs); len(similar) > 0 {
+			r.add("Programs on the PATH with similar names: %s.", strings.Join(similar, ", "))
+		}
+	} else {
+		r.add("%s is on the PATH at %s, which is what runs.", r.Name, found[0])
+		if len(found) > 1 {
+			r.add("Other copies later on the PATH, which it hides: %s.", strings.Join(found[1:], ", "))
+		}
+		r.inspectFile(found[0])
+	}
+	r.inspectPath(dirs)
+	return r
+}
+
+func (r *Report) add(format string, args ...interface{}) {
+	r.Facts = append(r.Facts, fmt.Sprintf(format, args...))
+}
+
+// inspectFile checks a program's file: that it exists, is executable, and
+// that a script's interpreter is there
+func (r *Report) inspectFile(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if lst, lerr := os.Lstat(path); lerr == nil && lst.Mode()&os.ModeSymlink != 0 {
+			target, _ := os.Readlink(path)
+			r.add("%s is a symlink to %s, which doesn't exist.", path, target)
+			return
+		}
+		r.add("%s doesn't exist.", path)
+		return
+	}
+	if info.IsDir() {
+		r.add("%s is a directory, not a program.", path)
+		return
+	}
+	r.add("%s has permissions %s.", path, info.Mode().Perm())
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0 {
+		r.add("%s is not executable by anyone: it needs chmod +x.", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		r.add("%s can't be read: %v.", path, err)
+		return
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" || !strings.HasPrefix(line, "#!") {
+		return
+	}
+	if strings.HasSuffix(line, "\r\n") {
+		r.add("Its #! line ends in a Windows line ending (\\r\\n), so the interpreter's name includes a stray \\r.")
+	}
+	shebang := strings.Fields(strings.TrimSpace(strings.TrimPrefix(line, "#!")))
+	if len(shebang) == 0 {
+		return
+	}
+	interpreter := shebang[0]
+	if !isFile(interpreter) {
+		r.add("It's a script for %s, which doesn't exist.", interpreter)
+	} else if filepath.Base(interpreter) == "env" && len(shebang) > 1 {
+		r.add("It's a script run with %s from the PATH.", shebang[1])
+	} else {
+		r.add("It's a script for %s.", interpreter)
+	}
+}
+
+// inspectPath notes the PATH entries that can't work
+func (r *Report) inspectPath(dirs []string) {
+	var missing, notDirs, relative []string
+	seen := map[string]bool{}
+	duplicates := 0
+	for _, dir := range dirs {
+		if seen[dir] {
+			duplicates++
+			continue
+		}
+		seen[dir] = true
+		switch info, err := os.Stat(dir); {
+		case dir == "" || !filepath.IsAbs(dir):
+			relative = append(relative, fmt.Sprintf("%q", dir))
+		case err != nil:
+			missing = append(missing, dir)
+		case !info.IsDir():
+			notDirs = append(notDirs, dir)
+		}
+	}
+	if len(missing) > 0 {
+		r.add("PATH entries that don't exist: %s.", strings.Join(missing, ", "))
+	}
+	if len(notDirs) > 0 {
+		r.add("PATH entries that aren't directories: %s.", strings.Join(notDirs, ", "))
+	}
+	if len(relative) > 0 {
+		r.add("PATH entries relative to the current directory: %s.", strings.Join(relative, ", "))
+	}
+	if duplicates > 0 {
+		r.add("The PATH repeats %d of its entries.", duplicates)
+	}
+}
+
+// offPath finds a program in the usual places for user-installed programs
+// that aren't on the PATH
+func offPath(name string, dirs []string, home string) []string {
+	onPath := map[string]bool{}
+	for _, dir := range dirs {
+		onPath[filepath.Clean(dir)] = true
+	}
+	candidates := []string{"/usr/local/bin", "/usr/local/sbin", "/usr/sbin", "/sbin", "/opt/homebrew/bin", "/home/linuxbrew/.linuxbrew/bin", "/snap/bin", "/opt/local/bin", "/nix/var/nix/profiles/default/bin"}
+	if home != "" {
+		for _, dir := range []string{".local/bin", "bin", "go/bin", ".cargo/bin", ".npm-global/bin", ".yarn/bin", ".deno/bin", ".bun/bin", ".nix-profile/bin", ".pyenv/shims", ".rbenv/shims", ".asdf/shims", ".volta/bin", ".dotnet/tools"} {
+			candidates = append(candidates, filepath.Join(home, dir))
+		}
+	}
+	var found []string
+	for _, dir := range candidates {
+		if onPath[dir] {
+			continue
+		}
+		if candidate := filepath.Join(dir, name); isFile(candidate) {
+			found = append(found, candidate)
+		}
+	}
+	return found
+}
+
+// similarNames are the programs on the PATH a letter or two from name, as
+// with a typo
+func similarNames(name string, dirs []string) []string {
+	seen := map[string]bool{}
+	var similar []string
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			other := entry.Name()
+			if seen[other] || entry.IsDir() {
+				continue
+			}
+			seen[other] = true
+			if d := distance(strings.ToLower(name), strings.ToLower(other)); d > 0 && d <= maxDistance(name) {
+				similar = append(similar, other)
+			}
+		}
+	}
+	sort.Slice(similar, func(i, j int) bool {
+		di, dj := distance(name, similar[i]), distance(name, similar[j])
+		if di != dj {
+			return di < dj
+		}
+		return similar[i] < similar[j]
+	})
+	if len(similar) > maxSimilar {
+		similar = similar[:maxSimilar]
+	}
+	return similar
+}
+
+// maxDistance is how many edits still count as a typo of a name that long
+func maxDistance(name string) int {
+	if len(name) <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// distance is how many letters must be added, removed, changed or swapped
+// with the next to turn one string into the other
+func distance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
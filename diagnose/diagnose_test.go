@@ -0,0 +1,88 @@
+package diagnose
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	root := t.TempDir()
+	write := func(path, text string, mode os.FileMode) string {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	bin := filepath.Join(root, "bin")
+	other := filepath.Join(root, "other")
+	home := filepath.Join(root, "home")
+	write("bin/python3", "", 0755)
+	write("other/python3", "", 0755)
+	write("bin/deploy", "#!/no/such/bash\r\necho hi\n", 0644)
+	write("home/.cargo/bin/rg", "", 0755)
+	env := Env{
+		Path:  strings.Join([]string{bin, other, filepath.Join(root, "gone"), bin}, string(os.PathListSeparator)),
+		Home:  home,
+		Shell: "/bin/zsh",
+	}
+
+	has := func(r Report, parts ...string) {
+		t.Helper()
+		for _, fact := range r.Facts {
+			matched := true
+			for _, part := range parts {
+				matched = matched && strings.Contains(fact, part)
+			}
+			if matched {
+				return
+			}
+		}
+		t.Errorf("no fact about %s mentions %q in %q", r.Name, parts, r.Facts)
+	}
+
+	r := Inspect("rg -n foo", env)
+	if r.Name != "rg" {
+		t.Errorf("Name = %q, want rg", r.Name)
+	}
+	has(r, "zsh")
+	has(r, "not in any directory on the PATH")
+	has(r, "outside the PATH", filepath.Join(home, ".cargo/bin/rg"))
+	has(r, "don't exist", filepath.Join(root, "gone"))
+	has(r, "repeats 1")
+
+	has(Inspect("pyhton3", env), "similar names", "python3")
+
+	r = Inspect("python3 -V", env)
+	has(r, "on the PATH at", filepath.Join(bin, "python3"))
+	has(r, "hides", filepath.Join(other, "python3"))
+
+	r = Inspect("deploy", env)
+	has(r, "not executable")
+	has(r, "Windows line ending")
+	has(r, "/no/such/bash", "doesn't exist")
+
+	has(Inspect("./nope.sh", env), "./nope.sh doesn't exist")
+}
+
+func TestDistance(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"python", "pyhton", 1},
+		{"git", "gti", 1},
+		{"git", "got", 1},
+		{"kubectl", "kubectl", 0},
+		{"rg", "", 2},
+	} {
+		if got := distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package envcontext picks the environment variables worth sending with a
+// prompt about a failing tool or build, such as the PATH or the active
+// virtualenv, which often explain why a command isn't found or the wrong
+// version runs. Only allowlisted variables are sent, and the values of those
+// named like secrets are hashed.
+package envcontext
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"q/secrets"
+)
+
+// Defaults are the variables sent unless the config adds others: the ones
+// that decide which tools run and how they find their dependencies
+var Defaults = []string{
+	"PATH", "SHELL", "LANG",
+	"VIRTUAL_ENV", "CONDA_DEFAULT_ENV", "PYENV_VERSION", "PYTHONPATH", "PYTHONHOME",
+	"GOPATH", "GOROOT", "GOBIN", "GOFLAGS", "GO111MODULE", "GOOS", "GOARCH", "CGO_ENABLED", "GOPROXY",
+	"NODE_ENV", "NODE_OPTIONS", "NODE_PATH", "NVM_BIN",
+	"JAVA_HOME", "MAVEN_HOME", "GRADLE_HOME",
+	"CARGO_HOME", "RUSTUP_HOME", "RUSTUP_TOOLCHAIN",
+	"CC", "CXX", "CFLAGS", "CXXFLAGS", "LDFLAGS", "LD_LIBRARY_PATH", "DYLD_LIBRARY_PATH", "PKG_CONFIG_PATH",
+	"DOCKER_HOST", "KUBECONFIG",
+}
+
+// errorPattern matches the wording of errors from compilers, package
+// managers, interpreters and shells
+var errorPattern = regexp.MustCompile(`(?i)(\berror\b|\berr!|\bfailed\b|\bfailure\b|\bfatal\b|exception|traceback|\bpanic:|segmentation fault|not found|no such file|cannot find|can't find|could not (find|load|resolve|import)|unable to (find|load|locate|resolve)|undefined reference|unresolved (import|reference)|permission denied|exit (code|status) [1-9]|not installed|no module named|wrong version|version mismatch|incompatible)`)
+
+// LooksLikeError reports whether a prompt seems to be about a tooling or
+// build error, so that the environment could explain it
+func LooksLikeError(prompt string) bool {
+	return errorPattern.MatchString(prompt)
+}
+
+// sensitiveName matches the names of variables that may hold secrets
+var sensitiveName = regexp.MustCompile(`(?i)(token|secret|passw|key|auth|credential|cookie|session)`)
+
+// Var is an environment variable as it's sent
+type Var struct {
+	Name  string
+	Value string
+	// Hashed is set if Value is a hash of the real value
+	Hashed bool
+}
+
+// Collect returns the variables among names that are set, in order and
+// without repeats. The values of those named like secrets are replaced by a
+// short hash, which still shows whether two are the same, and any secrets
+// in the others, like a password in a URL, are redacted.
+func Collect(names []string, getenv func(string) string) []Var {
+	var vars []Var
+	seen := map[string]bool{}
+	for _, name := range names {
+		value := getenv(name)
+		if value == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if sensitiveName.MatchString(name) {
+			vars = append(vars, Var{Name: name, Value: hash(value), Hashed: true})
+			continue
+		}
+		value, _ = secrets.Redact(value)
+		vars = append(vars, Var{Name: name, Value: value})
+	}
+	return vars
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])[:12]
+}
+
+// Format writes variables one per line, as NAME=value
+func Format(vars []Var) string {
+	var b strings.Builder
+	for _, v := range vars {
+		fmt.Fprintf(&b, "%s=%s\n", v.Name, v.Value)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,54 @@
+package envcontext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLooksLikeError(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   bool
+	}{
+		{"why do I get: bash: cargo: command not found", true},
+		{"ModuleNotFoundError: No module named 'requests'", true},
+		{"go build fails with cannot find package \"x\"", true},
+		{"npm ERR! code ERESOLVE", true},
+		{"make exited with exit status 2", true},
+		{"undefined reference to `pthread_create'", true},
+		{"list files by size", false},
+		{"write a regex for semantic versions", false},
+		{"what is the terror of the deep", false},
+	}
+	for _, tt := range tests {
+		if got := LooksLikeError(tt.prompt); got != tt.want {
+			t.Errorf("LooksLikeError(%q) = %v, want %v", tt.prompt, got, tt.want)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	env := map[string]string{
+		"PATH":         "/usr/local/go/bin:/usr/bin",
+		"VIRTUAL_ENV":  "/home/me/app/.venv",
+		"NPM_TOKEN":    "npm_abcdefghijklmnopqrstuvwxyz",
+		"DATABASE_URL": "postgres://app:hunter22@db:5432/app",
+	}
+	vars := Collect([]string{"PATH", "GOPATH", "NPM_TOKEN", "DATABASE_URL", "VIRTUAL_ENV", "PATH"}, func(name string) string { return env[name] })
+	if len(vars) != 4 {
+		t.Fatalf("Collect = %+v, want the 4 set variables once each", vars)
+	}
+	if vars[0].Name != "PATH" || vars[0].Value != env["PATH"] || vars[3].Name != "VIRTUAL_ENV" {
+		t.Errorf("Collect should keep the order and values of plain variables, got %+v", vars)
+	}
+	if token := vars[1]; !token.Hashed || !strings.HasPrefix(token.Value, "sha256:") || strings.Contains(token.Value, "npm_") {
+		t.Errorf("NPM_TOKEN should be hashed, got %+v", token)
+	}
+	if url := vars[2]; strings.Contains(url.Value, "hunter22") || !strings.Contains(url.Value, "db:5432") {
+		t.Errorf("the password in DATABASE_URL should be redacted, got %q", url.Value)
+	}
+
+	if got := Format(vars[:1]); got != "PATH=/usr/local/go/bin:/usr/bin" {
+		t.Errorf("Format = %q", got)
+	}
+}
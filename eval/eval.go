@@ -0,0 +1,254 @@
+// Package eval runs a suite of prompts against models and checks the
+// answers, for `q eval`: with assertions on their text, commands run on
+// them, and a judge model's grades. Summaries compare the models side by
+// side, to tell whether a cheaper one would do.
+package eval
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"q/util"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ExecTimeout is how long an exec assertion may run
+const ExecTimeout = 30 * time.Second
+
+// Suite is a set of prompts to evaluate models on
+type Suite struct {
+	Name string `yaml:"name,omitempty"`
+	// Models are the models to run the suite on, unless others are named
+	Models []string `yaml:"models,omitempty"`
+	// Judge is the model that grades the answers, if any case needs one
+	Judge string `yaml:"judge,omitempty"`
+	Cases []Case `yaml:"cases"`
+}
+
+// Case is a prompt and what a good answer to it looks like
+type Case struct {
+	Name   string `yaml:"name,omitempty"`
+	Prompt string `yaml:"prompt"`
+	// Reference is a known good answer the judge grades against
+	Reference string `yaml:"reference,omitempty"`
+	Expect    Expect `yaml:"expect,omitempty"`
+}
+
+// Expect are the assertions on an answer; every one given must hold
+type Expect struct {
+	// Contains must be in the answer, and NotContains must not
+	Contains    string `yaml:"contains,omitempty"`
+	NotContains string `yaml:"not_contains,omitempty"`
+	// Regex must match the answer, and NotRegex must not
+	Regex    string `yaml:"regex,omitempty"`
+	NotRegex string `yaml:"not_regex,omitempty"`
+	// Exec is a shell command that must exit 0. It gets the answer on stdin,
+	// and the answer's command, its first code block, in $Q_COMMAND.
+	Exec string `yaml:"exec,omitempty"`
+	// Judge are criteria the judge grades the answer by, and MinScore the
+	// lowest grade that passes, if a low grade should fail the case
+	Judge    string `yaml:"judge,omitempty"`
+	MinScore int    `yaml:"min_score,omitempty"`
+}
+
+// Label names a case in reports: its name, or the start of its prompt
+func (c Case) Label() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	label := strings.Join(strings.Fields(c.Prompt), " ")
+	if len(label) > 50 {
+		label = strings.TrimSpace(label[:47]) + "..."
+	}
+	return label
+}
+
+// Judged reports whether the judge grades the case's answers
+func (c Case) Judged() bool {
+	return c.Expect.Judge != "" || c.Expect.MinScore > 0 || c.Reference != ""
+}
+
+// LoadSuite reads a suite from a YAML file, checking its cases
+func LoadSuite(path string) (Suite, error) {
+	var suite Suite
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return suite, err
+	}
+	if err := yaml.UnmarshalStrict(data, &suite); err != nil {
+		return suite, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(suite.Cases) == 0 {
+		return suite, fmt.Errorf("%s has no cases", path)
+	}
+	for i, c := range suite.Cases {
+		if strings.TrimSpace(c.Prompt) == "" {
+			return suite, fmt.Errorf("case %d of %s has no prompt", i+1, path)
+		}
+		for _, expr := range []string{c.Expect.Regex, c.Expect.NotRegex} {
+			if _, err := regexp.Compile(expr); err != nil {
+				return suite, fmt.Errorf("case %d of %s: %w", i+1, path, err)
+			}
+		}
+	}
+	return suite, nil
+}
+
+// CheckScore returns why a judge's grade fails a case, or "" if it doesn't
+func CheckScore(c Case, score int) string {
+	if c.Expect.MinScore > 0 && score < c.Expect.MinScore {
+		return fmt.Sprintf("graded %d, below %d", score, c.Expect.MinScore)
+	}
+	return ""
+}
+
+// Check runs a case's assertions on an answer, returning those that failed
+func Check(c Case, answer string) []string {
+	var failures []string
+	if c.Expect.Contains != "" && !strings.Contains(answer, c.Expect.Contains) {
+		failures = append(failures, fmt.Sprintf("doesn't contain %q", c.Expect.Contains))
+	}
+	if c.Expect.NotContains != "" && strings.Contains(answer, c.Expect.NotContains) {
+		failures = append(failures, fmt.Sprintf("contains %q", c.Expect.NotContains))
+	}
+	if c.Expect.Regex != "" && !regexp.MustCompile(c.Expect.Regex).MatchString(answer) {
+		failures = append(failures, fmt.Sprintf("doesn't match %s", c.Expect.Regex))
+	}
+	if c.Expect.NotRegex != "" && regexp.MustCompile(c.Expect.NotRegex).MatchString(answer) {
+		failures = append(failures, fmt.Sprintf("matches %s", c.Expect.NotRegex))
+	}
+	if c.Expect.Exec != "" {
+		if err := runExec(c.Expect.Exec, answer); err != nil {
+			failures = append(failures, fmt.Sprintf("exec failed: %v", err))
+		}
+	}
+	return failures
+}
+
+// runExec runs an exec assertion on an answer
+func runExec(command, answer string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ExecTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	code, _ := util.ExtractFirstCodeBlock(answer)
+	cmd.Env = append(os.Environ(), "Q_COMMAND="+code)
+	cmd.Stdin = strings.NewReader(answer)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("timed out after %s", ExecTimeout)
+	}
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%v: %s", err, firstLine(out))
+		}
+		return err
+	}
+	return nil
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// Result is how a model did on a case
+type Result struct {
+	Case   int    `json:"case"`
+	Label  string `json:"label"`
+	Model  string `json:"model"`
+	Answer string `json:"answer,omitempty"`
+	// Error is why the request failed, if it did
+	Error string `json:"error,omitempty"`
+	// Failures are the assertions that didn't hold
+	Failures []string `json:"failures,omitempty"`
+	// Score is the judge's grade, or 0 if it wasn't graded, and Reason why
+	Score      int     `json:"score,omitempty"`
+	Reason     string  `json:"reason,omitempty"`
+	DurationMs int64   `json:"duration_ms"`
+	Cost       float64 `json:"cost"`
+}
+
+// Passed reports whether the model answered and every assertion held
+func (r Result) Passed() bool {
+	return r.Error == "" && len(r.Failures) == 0
+}
+
+// Summary is how a model did on the whole suite
+type Summary struct {
+	Model  string `json:"model"`
+	Cases  int    `json:"cases"`
+	Passed int    `json:"passed"`
+	// Judged is how many answers were graded, and Score their mean grade
+	Judged int     `json:"judged"`
+	Score  float64 `json:"score,omitempty"`
+	// DurationMs is the mean time an answer took
+	DurationMs int64   `json:"duration_ms"`
+	Cost       float64 `json:"cost"`
+}
+
+// Summarize sums up results per model, in the order the models first appear
+func Summarize(results []Result) []Summary {
+	var summaries []Summary
+	index := map[string]int{}
+	totals := map[string]int{}
+	for _, r := range results {
+		i, ok := index[r.Model]
+		if !ok {
+			i = len(summaries)
+			index[r.Model] = i
+			summaries = append(summaries, Summary{Model: r.Model})
+		}
+		s := &summaries[i]
+		s.Cases++
+		if r.Passed() {
+			s.Passed++
+		}
+		if r.Score > 0 {
+			s.Judged++
+			totals[r.Model] += r.Score
+		}
+		s.DurationMs += r.DurationMs
+		s.Cost += r.Cost
+	}
+	for i := range summaries {
+		s := &summaries[i]
+		if s.Judged > 0 {
+			s.Score = float64(totals[s.Model]) / float64(s.Judged)
+		}
+		s.DurationMs /= int64(s.Cases)
+	}
+	return summaries
+}
+
+// scoreMargin is how far below the best mean grade still counts as as good
+const scoreMargin = 0.25
+
+// Cheaper finds the cheapest model that did as well as the best: as many
+// cases passed, and a mean grade within a quarter point. It returns it and
+// the best, or ok false if the best is already the cheapest.
+func Cheaper(summaries []Summary) (cheaper, best Summary, ok bool) {
+	if len(summaries) < 2 {
+		return cheaper, best, false
+	}
+	best = summaries[0]
+	for _, s := range summaries[1:] {
+		if s.Passed > best.Passed || (s.Passed == best.Passed && s.Score > best.Score) {
+			best = s
+		}
+	}
+	cheaper = best
+	for _, s := range summaries {
+		if s.Passed >= best.Passed && s.Score >= best.Score-scoreMargin && s.Cost < cheaper.Cost {
+			cheaper = s
+		}
+	}
+	return cheaper, best, cheaper.Model != best.Model
+}
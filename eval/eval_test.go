@@ -0,0 +1,121 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSuite(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	suite, err := LoadSuite(write("ok.yaml", `
+name: shell basics
+models: [gpt-4.1, gpt-4.1-mini]
+judge: gpt-4.1
+cases:
+  - prompt: list files by size
+    expect:
+      regex: 'ls .*-\w*S'
+      judge: sorts by size, largest first
+  - name: disk usage
+    prompt: how much space does this directory use
+    reference: du -sh .
+`))
+	if err != nil {
+		t.Fatalf("LoadSuite: %v", err)
+	}
+	if suite.Name != "shell basics" || len(suite.Models) != 2 || suite.Judge != "gpt-4.1" || len(suite.Cases) != 2 {
+		t.Fatalf("LoadSuite = %+v", suite)
+	}
+	if c := suite.Cases[0]; c.Label() != "list files by size" || !c.Judged() || c.Expect.Regex == "" {
+		t.Errorf("first case = %+v", c)
+	}
+	if c := suite.Cases[1]; c.Label() != "disk usage" || !c.Judged() {
+		t.Errorf("second case = %+v", c)
+	}
+
+	for name, text := range map[string]string{
+		"empty.yaml":    "name: nothing\n",
+		"noprompt.yaml": "cases:\n  - name: x\n",
+		"regex.yaml":    "cases:\n  - prompt: x\n    expect:\n      regex: '('\n",
+		"typo.yaml":     "cases:\n  - prompt: x\n    expcet:\n      regex: x\n",
+	} {
+		if _, err := LoadSuite(write(name, text)); err == nil {
+			t.Errorf("LoadSuite(%s) should fail", name)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	answer := "Use this:\n\n```bash\nls -lS\n```\n"
+	tests := []struct {
+		expect   Expect
+		failures int
+	}{
+		{Expect{}, 0},
+		{Expect{Contains: "ls -lS"}, 0},
+		{Expect{Contains: "du -sh"}, 1},
+		{Expect{NotContains: "rm "}, 0},
+		{Expect{NotContains: "Use"}, 1},
+		{Expect{Regex: `ls -\w*S`}, 0},
+		{Expect{Regex: `du `}, 1},
+		{Expect{NotRegex: `rm -rf`}, 0},
+		{Expect{NotRegex: `ls`}, 1},
+		{Expect{Exec: `test "$Q_COMMAND" = "ls -lS"`}, 0},
+		{Expect{Exec: `grep -q 'Use this'`}, 0},
+		{Expect{Exec: `echo nope; exit 3`}, 1},
+		{Expect{Regex: `du `, NotRegex: `ls`, Exec: `false`}, 3},
+	}
+	for _, tt := range tests {
+		failures := Check(Case{Prompt: "p", Expect: tt.expect}, answer)
+		if len(failures) != tt.failures {
+			t.Errorf("Check(%+v) = %q, want %d failures", tt.expect, failures, tt.failures)
+		}
+	}
+	if CheckScore(Case{Expect: Expect{MinScore: 3}}, 2) == "" || CheckScore(Case{Expect: Expect{MinScore: 3}}, 3) != "" || CheckScore(Case{}, 1) != "" {
+		t.Errorf("CheckScore should fail only grades below min_score")
+	}
+	if failures := Check(Case{Expect: Expect{Exec: `echo nope; exit 3`}}, answer); !strings.Contains(failures[0], "nope") {
+		t.Errorf("an exec failure should include its output, got %q", failures[0])
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	results := []Result{
+		{Case: 1, Model: "big", Score: 5, DurationMs: 1000, Cost: 0.02},
+		{Case: 2, Model: "big", Score: 4, DurationMs: 3000, Cost: 0.02},
+		{Case: 1, Model: "small", Score: 5, DurationMs: 400, Cost: 0.002},
+		{Case: 2, Model: "small", Score: 4, DurationMs: 600, Cost: 0.002, Failures: []string{"doesn't match x"}},
+		{Case: 1, Model: "tiny", Error: "boom", Cost: 0.0001},
+		{Case: 2, Model: "tiny", Score: 2, DurationMs: 100, Cost: 0.0001},
+	}
+	summaries := Summarize(results)
+	if len(summaries) != 3 || summaries[0].Model != "big" || summaries[1].Model != "small" {
+		t.Fatalf("Summarize = %+v", summaries)
+	}
+	if s := summaries[0]; s.Cases != 2 || s.Passed != 2 || s.Judged != 2 || s.Score != 4.5 || s.DurationMs != 2000 || s.Cost != 0.04 {
+		t.Errorf("big = %+v", s)
+	}
+	if s := summaries[2]; s.Passed != 1 || s.Judged != 1 || s.Score != 2 {
+		t.Errorf("tiny = %+v", s)
+	}
+	// small failed an assertion, so nothing cheaper did as well as big
+	if _, _, ok := Cheaper(summaries); ok {
+		t.Errorf("Cheaper should find nothing as good as big")
+	}
+
+	results[3].Failures = nil
+	cheaper, best, ok := Cheaper(Summarize(results))
+	if !ok || cheaper.Model != "small" || best.Model != "big" {
+		t.Errorf("Cheaper = %s, %s, %v; want small as good as big", cheaper.Model, best.Model, ok)
+	}
+}
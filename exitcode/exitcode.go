@@ -0,0 +1,60 @@
+// Package exitcode defines the statuses q exits with, so scripts wrapping it
+// can tell kinds of failure apart:
+//
+//	0    success
+//	1    any other failure, such as bad usage or a broken config
+//	2    the provider failed: it couldn't be reached, or it returned an error
+//	3    authentication failed: no API key is set, or the provider rejected it
+//	4    the account is out of quota or credit
+//	5    the provider's safety filter blocked the request or the answer
+//	130  interrupted with Ctrl-C
+package exitcode
+
+import (
+	"errors"
+)
+
+const (
+	OK          = 0
+	Failure     = 1
+	Provider    = 2
+	Auth        = 3
+	Budget      = 4
+	Blocked     = 5
+	Interrupted = 130
+)
+
+// Coder is an error that knows the status it should exit with
+type Coder interface {
+	ExitCode() int
+}
+
+type codeError struct {
+	code int
+	err  error
+}
+
+func (e *codeError) Error() string { return e.err.Error() }
+func (e *codeError) Unwrap() error { return e.err }
+func (e *codeError) ExitCode() int { return e.code }
+
+// Wrap returns err with the status it should exit with, or nil if err is nil
+func Wrap(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codeError{code: code, err: err}
+}
+
+// For returns the status to exit with after err: OK if it's nil, the status
+// of the first error in its chain that has one, or else Failure
+func For(err error) int {
+	if err == nil {
+		return OK
+	}
+	var coder Coder
+	if errors.As(err, &coder) {
+		return coder.ExitCode()
+	}
+	return Failure
+}
@@ -0,0 +1,34 @@
+package exitcode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFor(t *testing.T) {
+	base := errors.New("connection refused")
+	wrapped := Wrap(Provider, base)
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, OK},
+		{"plain", base, Failure},
+		{"wrapped", wrapped, Provider},
+		{"wrapped further", fmt.Errorf("request: %w", wrapped), Provider},
+		{"outermost wins", Wrap(Auth, wrapped), Auth},
+	}
+	for _, tt := range tests {
+		if got := For(tt.err); got != tt.want {
+			t.Errorf("%s: For = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if !errors.Is(wrapped, base) || wrapped.Error() != base.Error() {
+		t.Error("Wrap should keep the error's message and chain")
+	}
+	if Wrap(Provider, nil) != nil {
+		t.Error("Wrap(nil) should be nil")
+	}
+}
@@ -0,0 +1,194 @@
+// Package gitrepo summarizes a git repository for --repo: its branch, latest
+// commits, uncommitted changes and top-level files, cut to fit a token
+// budget, so questions like "write a changelog entry" or "what changed since
+// the last tag" can be answered from the repository itself.
+package gitrepo
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"q/tokens"
+)
+
+// Limits on what's read from git, before any cut for the token budget
+const (
+	maxCommits = 30
+	maxChanges = 200
+)
+
+// Summary is what's known about a repository
+type Summary struct {
+	// Root is the directory of the working tree
+	Root string
+	// Branch is the branch checked out, or the commit if none is
+	Branch string
+	// Upstream is the branch tracked, if any, with how far HEAD is Ahead of
+	// and Behind it
+	Upstream      string
+	Ahead, Behind int
+	// Tag is the latest tag reachable from HEAD, if any, and SinceTag the
+	// number of commits after it
+	Tag      string
+	SinceTag int
+	// Commits are the latest commits, newest first, one line each with any
+	// tags on them
+	Commits []string
+	// Changes are the uncommitted changes, as git status --short shows them,
+	// and DiffStat their size
+	Changes  []string
+	DiffStat string
+	// Tree is the files and directories at the top of the repository, with a
+	// trailing / on directories
+	Tree []string
+}
+
+// Collect summarizes the repository dir is in
+func Collect(dir string) (Summary, error) {
+	git := func(args ...string) (string, error) {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+				return "", errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return "", err
+		}
+		return strings.TrimRight(string(out), "\n"), nil
+	}
+
+	var s Summary
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return s, fmt.Errorf("not in a git repository: %v", err)
+	}
+	// Paths are shown from the top, wherever in the repository dir is
+	s.Root, dir = root, root
+	if s.Branch, err = git("symbolic-ref", "--short", "-q", "HEAD"); err != nil || s.Branch == "" {
+		head, err := git("rev-parse", "--short", "HEAD")
+		if err != nil {
+			head = "no commits yet"
+		}
+		s.Branch = "detached at " + head
+	}
+	if upstream, err := git("rev-parse", "--abbrev-ref", "@{upstream}"); err == nil {
+		s.Upstream = upstream
+		if counts, err := git("rev-list", "--left-right", "--count", "@{upstream}...HEAD"); err == nil {
+			if fields := strings.Fields(counts); len(fields) == 2 {
+				s.Behind, _ = strconv.Atoi(fields[0])
+				s.Ahead, _ = strconv.Atoi(fields[1])
+			}
+		}
+	}
+	if tag, err := git("describe", "--tags", "--abbrev=0"); err == nil {
+		s.Tag = tag
+		if count, err := git("rev-list", "--count", tag+"..HEAD"); err == nil {
+			s.SinceTag, _ = strconv.Atoi(count)
+		}
+	}
+	if log, err := git("log", "-n", strconv.Itoa(maxCommits), "--date=short", "--decorate=short", "--format=%h %ad %an: %s%d"); err == nil {
+		s.Commits = lines(log)
+	}
+	if status, err := git("status", "--short", "--untracked-files=normal"); err == nil {
+		s.Changes = lines(status)
+		if len(s.Changes) > maxChanges {
+			s.Changes = s.Changes[:maxChanges]
+		}
+	}
+	if stat, err := git("diff", "HEAD", "--shortstat"); err == nil {
+		s.DiffStat = strings.TrimSpace(stat)
+	}
+	if tree, err := git("ls-tree", "HEAD"); err == nil {
+		for _, line := range lines(tree) {
+			// <mode> <type> <object>\t<name>
+			tab := strings.Index(line, "\t")
+			if tab < 0 {
+				continue
+			}
+			name := line[tab+1:]
+			if strings.Contains(line[:tab], " tree ") {
+				name += "/"
+			}
+			s.Tree = append(s.Tree, name)
+		}
+	}
+	return s, nil
+}
+
+// Format writes the summary as text of about budget tokens at most. When
+// it's too long, the longest of the lists is cut first, keeping the start of
+// each, and cut reports that it was.
+func (s Summary) Format(budget int) (text string, cut bool) {
+	commits, changes, tree := s.Commits, s.Changes, s.Tree
+	for {
+		text = s.format(commits, changes, tree)
+		if tokens.Estimate(text) <= budget {
+			return text, cut
+		}
+		longest := &commits
+		for _, list := range []*[]string{&changes, &tree} {
+			if len(*list) > len(*longest) {
+				longest = list
+			}
+		}
+		if len(*longest) == 0 {
+			return text, cut
+		}
+		*longest = (*longest)[:len(*longest)-1]
+		cut = true
+	}
+}
+
+func (s Summary) format(commits, changes, tree []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Repository: %s\nBranch: %s", s.Root, s.Branch)
+	if s.Upstream != "" {
+		fmt.Fprintf(&b, ", tracking %s (%d ahead, %d behind)", s.Upstream, s.Ahead, s.Behind)
+	}
+	b.WriteString("\n")
+	if s.Tag != "" {
+		fmt.Fprintf(&b, "Latest tag: %s, %d %s since\n", s.Tag, s.SinceTag, plural(s.SinceTag, "commit", "commits"))
+	}
+	section(&b, "Latest commits", commits, len(s.Commits))
+	if len(s.Changes) == 0 {
+		b.WriteString("\nNo uncommitted changes.\n")
+	} else {
+		title := "Uncommitted changes"
+		if s.DiffStat != "" {
+			title += " (" + s.DiffStat + ")"
+		}
+		section(&b, title, changes, len(s.Changes))
+	}
+	section(&b, "Top-level files", tree, len(s.Tree))
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// section writes a titled list, noting how many of all it leaves out
+func section(b *strings.Builder, title string, items []string, all int) {
+	if all == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n%s:\n", title)
+	for _, item := range items {
+		b.WriteString("  " + item + "\n")
+	}
+	if more := all - len(items); more > 0 {
+		fmt.Fprintf(b, "  ... %d more\n", more)
+	}
+}
+
+func lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
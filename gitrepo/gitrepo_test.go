@@ -0,0 +1,81 @@
+package gitrepo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Ann", "-c", "user.email=ann@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	write := func(name, text string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Collect(dir); err == nil {
+		t.Error("Collect outside a repository should fail")
+	}
+	git("init", "-q", "-b", "main")
+	write("README.md", "hello\n")
+	write("cmd/main.go", "package main\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "First commit")
+	git("tag", "v1.0.0")
+	write("README.md", "hello again\n")
+	git("commit", "-q", "-am", "Say hello again")
+	write("README.md", "changed\n")
+	write("notes.txt", "new\n")
+
+	s, err := Collect(filepath.Join(dir, "cmd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Branch != "main" || s.Tag != "v1.0.0" || s.SinceTag != 1 {
+		t.Errorf("Collect = branch %q, tag %q +%d; want main, v1.0.0 +1", s.Branch, s.Tag, s.SinceTag)
+	}
+	if len(s.Commits) != 2 || !strings.Contains(s.Commits[0], "Ann: Say hello again") || !strings.Contains(s.Commits[1], "tag: v1.0.0") {
+		t.Errorf("Commits = %q", s.Commits)
+	}
+	if strings.Join(s.Changes, "|") != " M README.md|?? notes.txt" || s.DiffStat == "" {
+		t.Errorf("Changes = %q (%q)", s.Changes, s.DiffStat)
+	}
+	if strings.Join(s.Tree, " ") != "README.md cmd/" {
+		t.Errorf("Tree = %q", s.Tree)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	s := Summary{Root: "/src/app", Branch: "main", Upstream: "origin/main", Ahead: 2, Tree: []string{"go.mod", "cmd/"}}
+	for i := 0; i < 30; i++ {
+		s.Commits = append(s.Commits, fmt.Sprintf("abc%04d 2024-05-01 Ann: Change number %d of the parser", i, i))
+	}
+	text, cut := s.Format(10000)
+	if cut || !strings.Contains(text, "Branch: main, tracking origin/main (2 ahead, 0 behind)") || !strings.Contains(text, "No uncommitted changes.") || !strings.Contains(text, "Change number 29") {
+		t.Errorf("Format(10000) = %v\n%s", cut, text)
+	}
+
+	text, cut = s.Format(150)
+	if !cut || !strings.Contains(text, "more") || !strings.Contains(text, "Change number 0 ") || strings.Contains(text, "Change number 29") || !strings.Contains(text, "cmd/") {
+		t.Errorf("Format(150) should keep the newest commits and the tree, got %v\n%s", cut, text)
+	}
+}
@@ -0,0 +1,255 @@
+// Package hooks runs a model's Starlark hook scripts: pre_request may rewrite
+// the messages sent to the model, and post_response the answer it gives.
+// Starlark is a small dialect of Python, see https://github.com/bazelbuild/starlark.
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+
+	. "q/types"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Hook function names, defined by the scripts
+const (
+	PreRequest   = "pre_request"
+	PostResponse = "post_response"
+)
+
+// maxSteps stops a hook stuck in a loop
+const maxSteps = 10_000_000
+
+// scripts caches the globals of each script by path, since a hook runs on
+// every request; they're frozen once loaded, so safe to share
+var (
+	scriptsMu sync.Mutex
+	scripts   = map[string]starlark.StringDict{}
+)
+
+// load runs the script at path once and returns its globals
+func load(path string) (starlark.StringDict, error) {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	if globals, ok := scripts[path]; ok {
+		return globals, nil
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	globals, err := starlark.ExecFile(newThread(path), path, src, predeclared)
+	if err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+	scripts[path] = globals
+	return globals, nil
+}
+
+func newThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(os.Stderr, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(maxSteps)
+	return thread
+}
+
+// function returns the function named hook in the script at path
+func function(path, hook string) (starlark.Callable, error) {
+	globals, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := globals[hook].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't define a %s function", path, hook)
+	}
+	return fn, nil
+}
+
+// Check loads the script at path and checks that it defines hook
+func Check(path, hook string) error {
+	_, err := function(path, hook)
+	return err
+}
+
+// call calls the function named hook in the script at path
+func call(path, hook string, args starlark.Tuple) (starlark.Value, error) {
+	fn, err := function(path, hook)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.Call(newThread(path), fn, args, nil)
+}
+
+// Request runs the pre_request hook of the script at path, if one is
+// configured, returning the messages to send instead. The hook is called
+// with the messages, as a list of dicts with "role" and "content", and the
+// model name; it returns the new list, or None to leave them as they are.
+// Messages of a tool exchange also have "tool_calls", as JSON, or
+// "tool_call_id", which should be kept.
+func Request(path, model string, messages []Message) ([]Message, error) {
+	if path == "" {
+		return messages, nil
+	}
+	list := make([]starlark.Value, len(messages))
+	for i, msg := range messages {
+		dict := starlark.NewDict(2)
+		dict.SetKey(starlark.String("role"), starlark.String(msg.Role))
+		dict.SetKey(starlark.String("content"), starlark.String(msg.Content))
+		if len(msg.ToolCalls) > 0 {
+			calls, _ := json.Marshal(msg.ToolCalls)
+			dict.SetKey(starlark.String("tool_calls"), starlark.String(calls))
+		}
+		if msg.ToolCallID != "" {
+			dict.SetKey(starlark.String("tool_call_id"), starlark.String(msg.ToolCallID))
+		}
+		list[i] = dict
+	}
+	result, err := call(path, PreRequest, starlark.Tuple{starlark.NewList(list), starlark.String(model)})
+	if err != nil {
+		return nil, fmt.Errorf("%s hook: %w", PreRequest, err)
+	}
+	if result == starlark.None {
+		return messages, nil
+	}
+	out, err := toMessages(result)
+	if err != nil {
+		return nil, fmt.Errorf("%s hook: %w", PreRequest, err)
+	}
+	return out, nil
+}
+
+// toMessages converts a hook's list of message dicts back to messages
+func toMessages(value starlark.Value) ([]Message, error) {
+	list, ok := value.(*starlark.List)
+	if !ok {
+		return nil, fmt.Errorf("should return a list of messages or None, not %s", value.Type())
+	}
+	messages := make([]Message, list.Len())
+	for i := range messages {
+		dict, ok := list.Index(i).(*starlark.Dict)
+		if !ok {
+			return nil, fmt.Errorf("message %d is a %s, not a dict", i, list.Index(i).Type())
+		}
+		for _, field := range []struct {
+			key string
+			dst *string
+		}{{"role", &messages[i].Role}, {"content", &messages[i].Content}} {
+			v, found, _ := dict.Get(starlark.String(field.key))
+			s, ok := v.(starlark.String)
+			if !found || !ok {
+				return nil, fmt.Errorf("message %d needs a string %q", i, field.key)
+			}
+			*field.dst = string(s)
+		}
+		if v, found, _ := dict.Get(starlark.String("tool_call_id")); found {
+			id, _ := v.(starlark.String)
+			messages[i].ToolCallID = string(id)
+		}
+		if v, found, _ := dict.Get(starlark.String("tool_calls")); found {
+			calls, _ := v.(starlark.String)
+			if err := json.Unmarshal([]byte(calls), &messages[i].ToolCalls); err != nil {
+				return nil, fmt.Errorf("message %d has tool_calls that aren't valid JSON: %v", i, err)
+			}
+		}
+	}
+	return messages, nil
+}
+
+// Response runs the post_response hook of the script at path, if one is
+// configured, returning the answer to use instead. The hook is called with
+// the answer and the model name, and returns the new answer.
+func Response(path, model, response string) (string, error) {
+	if path == "" {
+		return response, nil
+	}
+	result, err := call(path, PostResponse, starlark.Tuple{starlark.String(response), starlark.String(model)})
+	if err != nil {
+		return "", fmt.Errorf("%s hook: %w", PostResponse, err)
+	}
+	s, ok := result.(starlark.String)
+	if !ok {
+		return "", fmt.Errorf("%s hook: should return a string, not %s", PostResponse, result.Type())
+	}
+	return string(s), nil
+}
+
+// predeclared are the globals available to scripts besides Starlark's
+// builtins: a small re module, since Starlark has no regular expressions
+var predeclared = starlark.StringDict{
+	"re": &starlarkstruct.Module{
+		Name: "re",
+		Members: starlark.StringDict{
+			"sub":     starlark.NewBuiltin("re.sub", reSub),
+			"search":  starlark.NewBuiltin("re.search", reSearch),
+			"findall": starlark.NewBuiltin("re.findall", reFindAll),
+		},
+	},
+}
+
+// compile compiles a pattern argument; patterns use Go's syntax (RE2)
+func compile(fn *starlark.Builtin, pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return re, nil
+}
+
+// reSub is re.sub(pattern, repl, s), replacing every match of pattern in s;
+// repl may refer to groups as $1 or ${name}
+func reSub(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, repl, s string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "repl", &repl, "s", &s); err != nil {
+		return nil, err
+	}
+	re, err := compile(fn, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(re.ReplaceAllString(s, repl)), nil
+}
+
+// reSearch is re.search(pattern, s), returning the first match or None
+func reSearch(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "s", &s); err != nil {
+		return nil, err
+	}
+	re, err := compile(fn, pattern)
+	if err != nil {
+		return nil, err
+	}
+	loc := re.FindStringIndex(s)
+	if loc == nil {
+		return starlark.None, nil
+	}
+	return starlark.String(s[loc[0]:loc[1]]), nil
+}
+
+// reFindAll is re.findall(pattern, s), returning every match
+func reFindAll(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "s", &s); err != nil {
+		return nil, err
+	}
+	re, err := compile(fn, pattern)
+	if err != nil {
+		return nil, err
+	}
+	var matches []starlark.Value
+	for _, m := range re.FindAllString(s, -1) {
+		matches = append(matches, starlark.String(m))
+	}
+	return starlark.NewList(matches), nil
+}
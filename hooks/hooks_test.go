@@ -0,0 +1,98 @@
+package hooks
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "q/types"
+)
+
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.star")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRequest(t *testing.T) {
+	path := writeScript(t, `
+def pre_request(messages, model):
+    for msg in messages:
+        if msg["role"] == "system":
+            msg["content"] = "ACME policy applies. " + msg["content"]
+    return messages
+`)
+	messages := []Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hi"}}
+	got, err := Request(path, "gpt-4.1", messages)
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if len(got) != 2 || got[0].Content != "ACME policy applies. Be brief." || !reflect.DeepEqual(got[1], messages[1]) {
+		t.Errorf("Request = %+v", got)
+	}
+	if messages[0].Content != "Be brief." {
+		t.Error("the hook shouldn't change the caller's messages")
+	}
+
+	same, err := Request(writeScript(t, "def pre_request(messages, model):\n    return None\n"), "gpt-4.1", messages)
+	if err != nil || len(same) != 2 || !reflect.DeepEqual(same[0], messages[0]) {
+		t.Errorf("returning None should leave the messages alone; got %+v, %v", same, err)
+	}
+
+	call := MessageToolCall{ID: "call_1", Type: "function"}
+	call.Function.Name, call.Function.Arguments = "kubectl", `{"args":["get","pods"]}`
+	exchange := []Message{{Role: "assistant", ToolCalls: []MessageToolCall{call}}, {Role: "tool", Content: "No resources found", ToolCallID: "call_1"}}
+	kept, err := Request(path, "gpt-4.1", exchange)
+	if err != nil || !reflect.DeepEqual(kept, exchange) {
+		t.Errorf("a tool exchange should come back as it was; got %+v, %v", kept, err)
+	}
+
+	bad := writeScript(t, "def pre_request(messages, model):\n    return [{\"role\": \"user\"}]\n")
+	if _, err := Request(bad, "gpt-4.1", messages); err == nil || !strings.Contains(err.Error(), `"content"`) {
+		t.Errorf("a message without content should be rejected, got %v", err)
+	}
+}
+
+func TestResponse(t *testing.T) {
+	path := writeScript(t, `
+def post_response(response, model):
+    return re.sub("[\\w.]+@[\\w.]+", "[email]", response)
+`)
+	got, err := Response(path, "gpt-4.1", "write to ann@example.com")
+	if err != nil || got != "write to [email]" {
+		t.Errorf("Response = %q, %v", got, err)
+	}
+
+	if got, err := Response("", "gpt-4.1", "unchanged"); err != nil || got != "unchanged" {
+		t.Errorf("no hook should leave the response alone; got %q, %v", got, err)
+	}
+
+	loop := writeScript(t, `
+def post_response(response, model):
+    n = 0
+    for i in range(1000000000):
+        n += i
+    return response
+`)
+	if _, err := Response(loop, "gpt-4.1", "x"); err == nil {
+		t.Error("a hook stuck in a loop should be stopped")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path := writeScript(t, "def post_response(response, model):\n    return response\n")
+	if err := Check(path, PostResponse); err != nil {
+		t.Errorf("Check(post_response) = %v", err)
+	}
+	if err := Check(path, PreRequest); err == nil {
+		t.Error("Check should fail for a hook the script doesn't define")
+	}
+	if err := Check(writeScript(t, "def post_response(:\n"), PostResponse); err == nil {
+		t.Error("Check should fail for a script that doesn't parse")
+	}
+}
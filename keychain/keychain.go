@@ -0,0 +1,99 @@
+// Package keychain keeps API keys in the operating system's credential
+// store, so they needn't be exported from a shell profile: the login
+// keychain on macOS, through the security command, and the Secret Service
+// (GNOME Keyring or KWallet) on Linux, through secret-tool. Keys are stored
+// under the service "shell-ai", by the name of the environment variable they
+// stand in for.
+package keychain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Service is what keys are stored under in the credential store
+const Service = "shell-ai"
+
+var (
+	// ErrUnsupported means there's no credential store q knows how to use
+	ErrUnsupported = errors.New("no supported keychain: needs macOS, or secret-tool on Linux")
+	// ErrNotFound means no key is stored under the name
+	ErrNotFound = errors.New("not in the keychain")
+)
+
+// goos is runtime.GOOS, a variable so tests can pretend to be on another system
+var goos = runtime.GOOS
+
+// Available reports whether keys can be stored on this system
+func Available() bool {
+	_, err := tool()
+	return err == nil
+}
+
+// tool is the command that talks to the credential store
+func tool() (string, error) {
+	name := ""
+	switch goos {
+	case "darwin":
+		name = "security"
+	case "linux", "freebsd", "openbsd", "netbsd":
+		name = "secret-tool"
+	default:
+		return "", ErrUnsupported
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", ErrUnsupported
+	}
+	return path, nil
+}
+
+// Get returns the key stored under name
+func Get(name string) (string, error) {
+	path, err := tool()
+	if err != nil {
+		return "", err
+	}
+	var cmd *exec.Cmd
+	if goos == "darwin" {
+		cmd = exec.Command(path, "find-generic-password", "-s", Service, "-a", name, "-w")
+	} else {
+		cmd = exec.Command(path, "lookup", "service", Service, "account", name)
+	}
+	out, err := cmd.Output()
+	key := strings.TrimRight(string(out), "\r\n")
+	if err != nil || key == "" {
+		// Both tools exit non-zero when there's no such key
+		return "", ErrNotFound
+	}
+	return key, nil
+}
+
+// Set stores key under name, replacing any key stored under it before
+func Set(name, key string) error {
+	path, err := tool()
+	if err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	if goos == "darwin" {
+		// security only takes the password as an argument or from a prompt
+		cmd = exec.Command(path, "add-generic-password", "-U", "-s", Service, "-a", name, "-l", Service+" "+name, "-w", key)
+	} else {
+		cmd = exec.Command(path, "store", "--label", Service+" "+name, "service", Service, "account", name)
+		cmd.Stdin = strings.NewReader(key)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("failed to store %s in the keychain: %s", name, msg)
+		}
+		return fmt.Errorf("failed to store %s in the keychain: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package keychain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeSecretTool puts a secret-tool first on PATH that keeps keys as files
+// in a temporary directory
+func fakeSecretTool(t *testing.T) {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+store="` + dir + `"
+case "$1" in
+store) cat > "$store/$7" ;;
+lookup) cat "$store/$5" 2>/dev/null || exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "secret-tool"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	goos = "linux"
+}
+
+func TestSetGet(t *testing.T) {
+	defer func(original string) { goos = original }(goos)
+	fakeSecretTool(t)
+
+	if !Available() {
+		t.Fatal("Available() = false with secret-tool on PATH")
+	}
+	if _, err := Get("OPENAI_API_KEY"); err != ErrNotFound {
+		t.Errorf("Get before Set: err = %v, want ErrNotFound", err)
+	}
+	if err := Set("OPENAI_API_KEY", "sk-first"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := Set("OPENAI_API_KEY", "sk-second"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if key, err := Get("OPENAI_API_KEY"); err != nil || key != "sk-second" {
+		t.Errorf("Get = %q, %v; want sk-second", key, err)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	defer func(original string) { goos = original }(goos)
+	goos = "plan9"
+	if Available() {
+		t.Error("Available() = true on an unsupported system")
+	}
+	if _, err := Get("X"); err != ErrUnsupported {
+		t.Errorf("Get: err = %v, want ErrUnsupported", err)
+	}
+	if err := Set("X", "y"); err != ErrUnsupported {
+		t.Errorf("Set: err = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,180 @@
+// Package kube runs read-only kubectl commands for `q k8s`, so the model can
+// look at the cluster's real state while troubleshooting. Only commands that
+// read are allowed, always against the context and namespace the session
+// started with, and never ones that show secrets or block waiting for
+// changes.
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"q/secrets"
+)
+
+// Timeout is how long a command may run before it's stopped
+const Timeout = 20 * time.Second
+
+// MaxOutput caps how much of a command's output is returned
+const MaxOutput = 12000
+
+// Target is the cluster and namespace commands are run against
+type Target struct {
+	Context   string
+	Namespace string
+}
+
+// readOnly are the kubectl commands allowed, with the subcommands allowed
+// for those that have some that change things
+var readOnly = map[string][]string{
+	"get":           nil,
+	"describe":      nil,
+	"logs":          nil,
+	"top":           nil,
+	"events":        nil,
+	"explain":       nil,
+	"api-resources": nil,
+	"api-versions":  nil,
+	"version":       nil,
+	"cluster-info":  nil,
+	"rollout":       {"status", "history"},
+	"auth":          {"can-i"},
+}
+
+// blockedFlags would watch for changes, read files, or run against another
+// cluster or as another user than the session's
+var blockedFlags = []string{
+	"-w", "--watch", "--watch-only", "-f", "--follow", "--filename", "-k", "--kustomize", "--raw",
+	"--kubeconfig", "--context", "--cluster", "--user", "--token", "--as", "--as-group", "--as-uid",
+	"-s", "--server", "--insecure-skip-tls-verify", "--certificate-authority", "--client-key", "--client-certificate",
+}
+
+// Check returns an error if args, a kubectl command line without the
+// kubectl, isn't read-only
+func Check(args []string) error {
+	if len(args) == 0 {
+		return errors.New("no kubectl command given")
+	}
+	subcommands, ok := readOnly[args[0]]
+	if !ok {
+		return fmt.Errorf("kubectl %s isn't allowed: only read-only commands are (%s)", args[0], strings.Join(Commands(), ", "))
+	}
+	if subcommands != nil && (len(args) < 2 || !contains(subcommands, args[1])) {
+		return fmt.Errorf("only kubectl %s %s are allowed", args[0], strings.Join(subcommands, " and "))
+	}
+	if args[0] == "cluster-info" && contains(args, "dump") {
+		return errors.New("kubectl cluster-info dump isn't allowed")
+	}
+	for _, arg := range args[1:] {
+		name := arg
+		if i := strings.Index(name, "="); i >= 0 {
+			name = name[:i]
+		}
+		if contains(blockedFlags, name) {
+			return fmt.Errorf("the %s flag isn't allowed", name)
+		}
+		if !strings.HasPrefix(arg, "-") && mentionsSecrets(arg) {
+			return errors.New("secrets can't be read")
+		}
+	}
+	return nil
+}
+
+// Commands are the kubectl commands allowed, in the order they're listed
+func Commands() []string {
+	return []string{"get", "describe", "logs", "top", "events", "explain", "api-resources", "api-versions", "version", "cluster-info", "rollout status", "rollout history", "auth can-i"}
+}
+
+// mentionsSecrets is whether a resource argument, like "secrets",
+// "pods,secret" or "secret/db", names secrets
+func mentionsSecrets(arg string) bool {
+	for _, part := range strings.Split(strings.ToLower(arg), ",") {
+		if i := strings.Index(part, "/"); i >= 0 {
+			part = part[:i]
+		}
+		if part == "secret" || part == "secrets" || strings.HasPrefix(part, "secrets.") {
+			return true
+		}
+	}
+	return false
+}
+
+// Args are the arguments to run kubectl with for args against t: its
+// context always, and its namespace unless args choose one or all
+func (t Target) Args(args []string) []string {
+	out := append([]string(nil), args...)
+	if t.Context != "" {
+		out = append(out, "--context", t.Context)
+	}
+	if t.Namespace == "" {
+		return out
+	}
+	for _, arg := range args {
+		if arg == "-A" || arg == "--all-namespaces" || arg == "-n" || strings.HasPrefix(arg, "-n=") || strings.HasPrefix(arg, "--namespace") {
+			return out
+		}
+	}
+	return append(out, "--namespace", t.Namespace)
+}
+
+// Current is the context and namespace of the current kubeconfig, with
+// run running kubectl with the arguments given and returning its output
+func Current(run func(args ...string) (string, error)) (Target, error) {
+	name, err := run("config", "current-context")
+	if err != nil {
+		return Target{}, fmt.Errorf("no current kubectl context: %v", err)
+	}
+	namespace, err := run("config", "view", "--minify", "-o", "jsonpath={..namespace}")
+	if err != nil || strings.TrimSpace(namespace) == "" {
+		namespace = "default"
+	}
+	return Target{Context: strings.TrimSpace(name), Namespace: strings.TrimSpace(namespace)}, nil
+}
+
+// Kubectl runs kubectl with args, returning its output, or what went wrong
+func Kubectl(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "kubectl", args...).CombinedOutput()
+	if ctx.Err() != nil {
+		return string(out), fmt.Errorf("timed out after %s", Timeout)
+	}
+	if err != nil {
+		return string(out), fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// Run checks args are read-only and runs them against t, returning the
+// output as the model should see it: capped and with any secrets in it
+// redacted
+func (t Target) Run(args []string, run func(args ...string) (string, error)) string {
+	if err := Check(args); err != nil {
+		return "Not run: " + err.Error() + "."
+	}
+	out, err := run(t.Args(args)...)
+	if err != nil {
+		out = "Failed: " + err.Error()
+	}
+	if len(out) > MaxOutput {
+		out = out[:MaxOutput] + "\n[output truncated]"
+	}
+	out, _ = secrets.Redact(out)
+	if strings.TrimSpace(out) == "" {
+		return "(no output)"
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
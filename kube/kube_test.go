@@ -0,0 +1,86 @@
+package kube
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"get", "pods", "-o", "wide"}, true},
+		{[]string{"describe", "deployment/api"}, true},
+		{[]string{"logs", "api-7d9f", "--tail=100", "--previous"}, true},
+		{[]string{"rollout", "status", "deployment/api"}, true},
+		{[]string{"auth", "can-i", "list", "pods"}, true},
+		{[]string{"get", "events", "--sort-by=.lastTimestamp", "-A"}, true},
+		{nil, false},
+		{[]string{"delete", "pod", "api-7d9f"}, false},
+		{[]string{"apply", "-f", "deploy.yaml"}, false},
+		{[]string{"rollout", "restart", "deployment/api"}, false},
+		{[]string{"auth", "reconcile"}, false},
+		{[]string{"get", "pods", "-w"}, false},
+		{[]string{"logs", "api-7d9f", "--follow"}, false},
+		{[]string{"get", "pods", "--context=prod"}, false},
+		{[]string{"get", "--raw", "/api/v1/namespaces"}, false},
+		{[]string{"get", "secrets"}, false},
+		{[]string{"get", "pods,Secret"}, false},
+		{[]string{"describe", "secret/db"}, false},
+		{[]string{"cluster-info", "dump"}, false},
+	}
+	for _, tt := range tests {
+		if err := Check(tt.args); (err == nil) != tt.ok {
+			t.Errorf("Check(%q) = %v, want allowed %v", tt.args, err, tt.ok)
+		}
+	}
+}
+
+func TestArgs(t *testing.T) {
+	target := Target{Context: "staging", Namespace: "shop"}
+	if got, want := target.Args([]string{"get", "pods"}), []string{"get", "pods", "--context", "staging", "--namespace", "shop"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Args = %q, want %q", got, want)
+	}
+	for _, args := range [][]string{{"get", "pods", "-A"}, {"get", "pods", "-n", "kube-system"}, {"get", "pods", "--namespace=web"}} {
+		if got := target.Args(args); strings.Contains(strings.Join(got, " "), "shop") {
+			t.Errorf("Args(%q) = %q should leave the namespace chosen", args, got)
+		}
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	run := func(args ...string) (string, error) {
+		if args[1] == "current-context" {
+			return "kind-dev\n", nil
+		}
+		return "", nil
+	}
+	target, err := Current(run)
+	if err != nil || target != (Target{Context: "kind-dev", Namespace: "default"}) {
+		t.Errorf("Current = %+v, %v", target, err)
+	}
+	if _, err := Current(func(...string) (string, error) { return "", errors.New("exit status 1") }); err == nil {
+		t.Error("Current should fail without a current context")
+	}
+}
+
+func TestRun(t *testing.T) {
+	target := Target{Context: "dev", Namespace: "default"}
+	var ran []string
+	run := func(args ...string) (string, error) {
+		ran = args
+		return "password=hunter2hunter2\n", nil
+	}
+	if out := target.Run([]string{"delete", "ns", "default"}, run); !strings.HasPrefix(out, "Not run:") || ran != nil {
+		t.Errorf("Run of a write should not run it, got %q", out)
+	}
+	if out := target.Run([]string{"get", "cm", "app", "-o", "yaml"}, run); strings.Contains(out, "hunter2") {
+		t.Errorf("Run should redact secrets in the output, got %q", out)
+	}
+	if ran[len(ran)-1] != "default" {
+		t.Errorf("Run ran %q without the namespace", ran)
+	}
+}
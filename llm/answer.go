@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"context"
+	"strings"
+
+	. "q/types"
+	"q/util"
+)
+
+// prefill is the text answers start with: Prefill if set, or else the
+// model's prefill setting
+func (c *LLMClient) prefill() string {
+	if c.Prefill != "" {
+		return c.Prefill
+	}
+	return c.config.Prefill
+}
+
+// primeAnswer seeds the assistant's turn of a request with the prefill, if
+// there is one. APIs that continue a trailing assistant message (see
+// MessageRules.Prefill) don't repeat it, so it's shown ahead of what streams,
+// and the function returned completes the answer with it. Other APIs are told
+// to start with it instead (see provider.Normalize).
+func (c *LLMClient) primeAnswer(payload *Payload) func(*Message) {
+	prefill := c.prefill()
+	if prefill == "" {
+		return func(*Message) {}
+	}
+	payload.Messages = append(append([]Message(nil), payload.Messages...), Message{Role: "assistant", Content: prefill})
+	if c.config.Messages == nil || !c.config.Messages.Prefill {
+		return func(*Message) {}
+	}
+	restore := c.showPrefill(prefill)
+	return func(message *Message) {
+		restore()
+		message.Content = prefill + message.Content
+	}
+}
+
+// stopAtCode puts a filter in front of the handler, when StopAtCode is set,
+// that ends the request with stop as soon as the answer's first code block is
+// complete. Only the answer up to the end of the block is shown. It returns a
+// function that restores the handler.
+func (c *LLMClient) stopAtCode(stop context.CancelFunc) func() {
+	if !c.StopAtCode {
+		return func() {}
+	}
+	var answer strings.Builder
+	return c.filterTokens(func(next StreamHandler, text string) {
+		if c.stoppedEarly {
+			// Chunks already read before the request ended
+			return
+		}
+		shown := answer.Len()
+		answer.WriteString(text)
+		if end := util.FirstCodeBlockEnd(answer.String()); end >= 0 {
+			c.stoppedEarly = true
+			stop()
+			if end <= shown {
+				return
+			}
+			text = answer.String()[shown:end]
+		}
+		next.OnToken(text)
+	})
+}
@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"q/logger"
+	. "q/types"
+)
+
+// streamResponse is the event stream of an answer sent in chunks of size
+// bytes, under the request ID id
+func streamResponse(id, content string, size int) string {
+	var body strings.Builder
+	for len(content) > 0 {
+		n := size
+		if n > len(content) {
+			n = len(content)
+		}
+		chunk, _ := json.Marshal(map[string]interface{}{
+			"id":      id,
+			"choices": []interface{}{map[string]interface{}{"delta": map[string]string{"content": content[:n]}}},
+		})
+		body.WriteString("data: " + string(chunk) + "\n\n")
+		content = content[n:]
+	}
+	body.WriteString("data: [DONE]\n\n")
+	return body.String()
+}
+
+func TestStopAtCode(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	content := "Use this:\n```bash\nls -la\n```\nIt lists every file, with details.\n"
+	want := "Use this:\n```bash\nls -la\n```"
+	for _, size := range []int{1, 4, 9, len(content)} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, streamResponse(fmt.Sprintf("req-%d", time.Now().UnixNano()), content, size))
+		}))
+		c := NewLLMClient(ModelConfig{ModelName: "gpt-4.1", Endpoint: server.URL + "/v1/chat/completions", Auth: "test"})
+		c.StopAtCode = true
+		var shown strings.Builder
+		c.StreamHandler = StreamFuncs{Token: func(text string) { shown.WriteString(text) }}
+		answer, err := c.Query("list files")
+		server.Close()
+		if err != nil || answer != want || shown.String() != want {
+			t.Errorf("in %d-byte deltas: got %q (shown %q), %v; want %q", size, answer, shown.String(), err, want)
+			continue
+		}
+
+		entry := c.LastEntry()
+		if !entry.StoppedEarly {
+			t.Errorf("in %d-byte deltas: the log entry isn't marked stopped early", size)
+		}
+		reqLogger, err := logger.Shared()
+		if err != nil {
+			t.Fatalf("logger.Shared: %v", err)
+		}
+		if logged, err := reqLogger.GetResponse(entry.RequestID); err != nil || !logged.StoppedEarly || logged.Response != want {
+			t.Errorf("in %d-byte deltas: logged %+v, %v; want the answer stopped early", size, logged, err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"q/exitcode"
+	. "q/types"
+)
+
+// Batch job statuses after which a job won't change anymore
+var finalBatchStatuses = map[string]bool{
+	"completed": true,
+	"failed":    true,
+	"expired":   true,
+	"cancelled": true,
+}
+
+// IsFinalBatchStatus reports whether a batch job with this status is done
+func IsFinalBatchStatus(status string) bool {
+	return finalBatchStatuses[status]
+}
+
+// apiBaseURL derives the API root (e.g. https://api.openai.com/v1) from the chat endpoint
+func (c *LLMClient) apiBaseURL() (string, error) {
+	if !strings.HasSuffix(c.config.Endpoint, "/chat/completions") {
+		return "", fmt.Errorf("this needs an OpenAI-style endpoint ending in /chat/completions, got %s", c.config.Endpoint)
+	}
+	return strings.TrimSuffix(c.config.Endpoint, "/chat/completions"), nil
+}
+
+// SubmitBatch uploads the requests as a JSONL file and starts a Batch API job
+// that runs them within 24 hours at a discount
+func (c *LLMClient) SubmitBatch(requests []BatchRequest) (BatchJob, error) {
+	var job BatchJob
+	base, err := c.apiBaseURL()
+	if err != nil {
+		return job, err
+	}
+
+	var input bytes.Buffer
+	encoder := json.NewEncoder(&input)
+	for _, request := range requests {
+		line := map[string]interface{}{
+			"custom_id": request.CustomID,
+			"method":    "POST",
+			"url":       "/v1/chat/completions",
+			"body":      Payload{Model: c.config.ModelName, Messages: request.Messages},
+		}
+		if err := encoder.Encode(line); err != nil {
+			return job, fmt.Errorf("failed to encode request %s: %w", request.CustomID, err)
+		}
+	}
+
+	fileID, err := c.uploadBatchFile(base, input.Bytes())
+	if err != nil {
+		return job, err
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"input_file_id":     fileID,
+		"endpoint":          "/v1/chat/completions",
+		"completion_window": "24h",
+	})
+	err = c.doJSON("POST", base+"/batches", bytes.NewReader(body), &job)
+	return job, err
+}
+
+func (c *LLMClient) uploadBatchFile(base string, data []byte) (string, error) {
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	writer.WriteField("purpose", "batch")
+	part, err := writer.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return "", err
+	}
+	part.Write(data)
+	writer.Close()
+
+	req, err := c.newAPIRequest("POST", base+"/files", &form)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	var file struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(req, &file); err != nil {
+		return "", fmt.Errorf("failed to upload batch file: %w", err)
+	}
+	return file.ID, nil
+}
+
+// GetBatch fetches the current state of a batch job
+func (c *LLMClient) GetBatch(id string) (BatchJob, error) {
+	var job BatchJob
+	base, err := c.apiBaseURL()
+	if err != nil {
+		return job, err
+	}
+	err = c.doJSON("GET", base+"/batches/"+id, nil, &job)
+	return job, err
+}
+
+// BatchOutputs downloads the output and error files of a finished batch job
+func (c *LLMClient) BatchOutputs(job BatchJob) ([]BatchOutput, error) {
+	base, err := c.apiBaseURL()
+	if err != nil {
+		return nil, err
+	}
+	var outputs []BatchOutput
+	for _, fileID := range []string{job.OutputFileID, job.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		req, err := c.newAPIRequest("GET", base+"/files/"+fileID+"/content", nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download batch results: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to download batch results: %s", resp.Status)
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var output BatchOutput
+			if err := json.Unmarshal(scanner.Bytes(), &output); err != nil {
+				resp.Body.Close()
+				return nil, fmt.Errorf("failed to parse batch results: %w", err)
+			}
+			outputs = append(outputs, output)
+		}
+		resp.Body.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read batch results: %w", err)
+		}
+	}
+	return outputs, nil
+}
+
+func (c *LLMClient) doJSON(method, url string, body io.Reader, out interface{}) error {
+	req, err := c.newAPIRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.do(req, out)
+}
+
+func (c *LLMClient) do(req *http.Request, out interface{}) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return exitcode.Wrap(exitcode.Provider, fmt.Errorf("failed to make the API request: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return newAPIError(resp, body, true)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse the response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"q/logger"
+	"q/provider"
+	"q/tokens"
+	. "q/types"
+)
+
+// Strategies for keeping a long conversation inside the model's context window
+const (
+	ContextTruncate  = "truncate"
+	ContextSummarize = "summarize"
+	// ContextRecoveryOff leaves a request rejected as too long failed
+	ContextRecoveryOff = "off"
+)
+
+// maxContextRecoveries caps the retries of a request rejected as too long,
+// each with about half the tokens of the last
+const maxContextRecoveries = 2
+
+// contextHeadroom is the share of the context window left free for the reply
+const contextHeadroom = 0.25
+
+const summaryPrompt = "Summarize the following conversation between a user and an assistant in a few short paragraphs. " +
+	"Keep facts, decisions, file names, commands and code identifiers that later messages may refer to. " +
+	"Reply with the summary only."
+
+// fitContext makes sure messages fit in the model's context window. The
+// configured prompt and the latest user message are always kept; the oldest
+// turns in between are dropped or, with the "summarize" strategy, replaced by
+// a summary. The returned note describes what happened, for the request log.
+func (c *LLMClient) fitContext(messages []Message) ([]Message, string) {
+	window := provider.ContextWindow(c.config)
+	if window <= 0 || len(messages) == 0 {
+		return messages, ""
+	}
+	budget := window - int(float64(window)*contextHeadroom)
+	if tokens.EstimateMessages(messages) <= budget {
+		return messages, ""
+	}
+	return c.shrinkContext(messages, budget, c.config.ContextStrategy)
+}
+
+// recoverContext shrinks messages the provider rejected as too long for the
+// model's context window to half their estimated size, with the model's
+// context_recovery strategy (its context_strategy unless set). The note is
+// empty if recovery is off or there are no old turns left to drop.
+func (c *LLMClient) recoverContext(messages []Message) ([]Message, string) {
+	strategy := c.config.ContextRecovery
+	if strategy == "" {
+		strategy = c.config.ContextStrategy
+	}
+	if strategy == ContextRecoveryOff {
+		return messages, ""
+	}
+	return c.shrinkContext(messages, tokens.EstimateMessages(messages)/2, strategy)
+}
+
+// shrinkContext fits messages into budget tokens with strategy, keeping the
+// configured prompt and the latest user message
+func (c *LLMClient) shrinkContext(messages []Message, budget int, strategy string) ([]Message, string) {
+	pinned := c.pinned
+	if pinned > len(messages)-1 {
+		pinned = len(messages) - 1
+	}
+	head := messages[:pinned]
+	history := messages[pinned : len(messages)-1]
+	latest := messages[len(messages)-1]
+
+	// cutFor returns how many of the oldest history messages to drop to fit target
+	cutFor := func(target int) int {
+		cut := 0
+		for cut < len(history) && tokens.EstimateMessages(joinMessages(head, history[cut:], []Message{latest})) > target {
+			cut++
+		}
+		// Keep whole turns: the remaining history should start with a user message
+		for cut < len(history) && history[cut].Role != "user" {
+			cut++
+		}
+		return cut
+	}
+
+	cut := cutFor(budget)
+	if cut == 0 {
+		return messages, ""
+	}
+	truncated := joinMessages(head, history[cut:], []Message{latest})
+
+	if strategy == ContextSummarize {
+		// Summarize down to half the budget so the summary itself has room
+		summaryCut := cutFor(budget / 2)
+		summary, err := c.summarize(history[:summaryCut])
+		if err != nil {
+			return truncated, fmt.Sprintf("dropped %d earlier messages (summary failed: %v)", cut, err)
+		}
+		summarized := joinMessages(head, []Message{{
+			Role:    "system",
+			Content: "Summary of the earlier conversation:\n" + strings.TrimSpace(summary),
+		}}, history[summaryCut:], []Message{latest})
+		if tokens.EstimateMessages(summarized) <= budget {
+			return summarized, fmt.Sprintf("summarized %d earlier messages", summaryCut)
+		}
+	}
+	return truncated, fmt.Sprintf("dropped %d earlier messages", cut)
+}
+
+// summarize condenses messages with the summary model (a cheap one, ideally).
+// The summary request is logged like any other request.
+func (c *LLMClient) summarize(messages []Message) (string, error) {
+	model := c.config.SummaryModel
+	if model == "" {
+		model = c.config.ModelName
+	}
+	var transcript strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, msg.Content)
+	}
+	request := []Message{
+		{Role: "system", Content: summaryPrompt},
+		{Role: "user", Content: transcript.String()},
+	}
+
+	startTime := time.Now()
+	message, usage, requestID, err := c.callCompletion(Payload{
+		Model:    model,
+		Messages: request,
+	})
+	entry := logger.CreateLogEntry(model, request, message.Content, usage, requestID, time.Since(startTime).Milliseconds(), err)
+	entry.ContextNote = "context summary"
+	c.writeLog(entry)
+	return message.Content, err
+}
+
+func joinMessages(parts ...[]Message) []Message {
+	var joined []Message
+	for _, part := range parts {
+		joined = append(joined, part...)
+	}
+	return joined
+}
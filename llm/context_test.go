@@ -0,0 +1,219 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"q/logger"
+	. "q/types"
+)
+
+func TestIsContextLengthError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   bool
+	}{
+		{"OpenAI code", 400, `{"error":{"code":"context_length_exceeded","message":"This model's maximum context length is 128000 tokens."}}`, true},
+		{"code on another status", 422, `{"error":{"code":"context_length_exceeded","message":"too long"}}`, true},
+		{"Anthropic message", 400, `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`, true},
+		{"vLLM message", 400, `{"error":{"type":"BadRequestError","message":"Please reduce the length of the messages or completion."}}`, true},
+		{"payload too large", 413, `{"error":{"message":"Request exceeds the context window of the model"}}`, true},
+		{"rate limited on tokens", 429, `{"error":{"code":"rate_limit_exceeded","message":"Rate limit reached: too many tokens per minute"}}`, false},
+		{"other bad request", 400, `{"error":{"code":"model_not_found","message":"The model does not exist"}}`, false},
+		{"no body", 400, ``, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Status: fmt.Sprintf("%d %s", tt.status, http.StatusText(tt.status))}
+		err := newAPIError(resp, []byte(tt.body), false)
+		if got := IsContextLengthError(err); got != tt.want {
+			t.Errorf("%s: IsContextLengthError = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := IsContextLengthError(fmt.Errorf("request failed: %w", err)); got != tt.want {
+			t.Errorf("%s: wrapped, IsContextLengthError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if IsContextLengthError(errors.New("context length exceeded")) {
+		t.Error("an error that isn't from the provider shouldn't count")
+	}
+}
+
+// turns is a conversation of n exchanges of about 100 tokens a message
+func turns(n int) []Message {
+	var messages []Message
+	for i := 1; i <= n; i++ {
+		messages = append(messages,
+			Message{Role: "user", Content: fmt.Sprintf("question %d: %s", i, strings.Repeat("word ", 100))},
+			Message{Role: "assistant", Content: fmt.Sprintf("answer %d: %s", i, strings.Repeat("word ", 100))})
+	}
+	return messages
+}
+
+// completionServer answers the summarizer model with a summary and rejects
+// any other
+func completionServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct{ Model string }
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Model != "summarizer" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"code":"model_not_found","message":"The model does not exist"}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"id":"req-%d","choices":[{"message":{"role":"assistant","content":"They asked three questions."}}]}`, time.Now().UnixNano())
+	}))
+}
+
+func TestRecoverContext(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := completionServer()
+	defer server.Close()
+
+	prompt := Message{Role: "system", Content: "Be terse."}
+	latest := Message{Role: "user", Content: "and now?"}
+	tests := []struct {
+		name         string
+		strategy     string
+		recovery     string
+		summaryModel string
+		history      []Message
+		// wantRoles are the roles of the messages kept, in order
+		wantRoles []string
+		wantNote  string
+	}{
+		{"truncate", "", "", "", turns(3), []string{"system", "user", "assistant", "user"}, "dropped 4 earlier messages"},
+		{"recovery after the context strategy", "summarize", "", "summarizer", turns(3), []string{"system", "system", "user"}, "summarized 6 earlier messages"},
+		{"recovery over the context strategy", "summarize", "truncate", "summarizer", turns(3), []string{"system", "user", "assistant", "user"}, "dropped 4 earlier messages"},
+		{"summary failing", "", "summarize", "broken", turns(3), []string{"system", "user", "assistant", "user"}, "dropped 4 earlier messages (summary failed: "},
+		{"recovery off", "truncate", "off", "", turns(3), []string{"system", "user", "assistant", "user", "assistant", "user", "assistant", "user"}, ""},
+		{"no old turns", "", "", "", nil, []string{"system", "user"}, ""},
+	}
+	for _, tt := range tests {
+		c := NewLLMClient(ModelConfig{
+			ModelName: "gpt-4.1", Endpoint: server.URL + "/v1/chat/completions", Auth: "test",
+			ContextStrategy: tt.strategy, ContextRecovery: tt.recovery, SummaryModel: tt.summaryModel,
+		})
+		c.pinned = 1
+		messages := append(append([]Message{prompt}, tt.history...), latest)
+		recovered, note := c.recoverContext(messages)
+
+		var roles []string
+		for _, msg := range recovered {
+			roles = append(roles, msg.Role)
+		}
+		if strings.Join(roles, " ") != strings.Join(tt.wantRoles, " ") {
+			t.Errorf("%s: kept %v, want %v", tt.name, roles, tt.wantRoles)
+			continue
+		}
+		if !strings.HasPrefix(note, tt.wantNote) || (tt.wantNote == "") != (note == "") {
+			t.Errorf("%s: note %q, want %q", tt.name, note, tt.wantNote)
+		}
+		// The configured prompt and the latest message are always kept
+		if recovered[0].Content != prompt.Content || recovered[len(recovered)-1].Content != latest.Content {
+			t.Errorf("%s: lost the prompt or the latest message: %+v", tt.name, recovered)
+		}
+		if strings.HasPrefix(note, "summarized") && !strings.HasPrefix(recovered[1].Content, "Summary of the earlier conversation:\nThey asked") {
+			t.Errorf("%s: got %q in place of the summary", tt.name, recovered[1].Content)
+		}
+		// The turns kept are the latest ones
+		if kept := len(recovered) - 2; strings.HasPrefix(note, "dropped") && kept > 0 && recovered[kept].Content != tt.history[len(tt.history)-1].Content {
+			t.Errorf("%s: kept %+v, want the latest turns", tt.name, recovered[1:kept+1])
+		}
+	}
+}
+
+// lengthServer rejects a request as too long while it has more than limit
+// messages, and streams answer otherwise; it counts the requests it gets
+type lengthServer struct {
+	limit    int
+	answer   string
+	requests *int
+}
+
+func (s lengthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload struct{ Messages []Message }
+	json.NewDecoder(r.Body).Decode(&payload)
+	*s.requests++
+	if len(payload.Messages) > s.limit {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"code":"context_length_exceeded","message":"This model's maximum context length is 128000 tokens."}}`)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprint(w, streamResponse(fmt.Sprintf("req-%d", time.Now().UnixNano()), s.answer, 3))
+}
+
+func TestQueryRecoversContext(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	reqLogger, err := logger.Shared()
+	if err != nil {
+		t.Fatalf("logger.Shared: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		limit     int
+		interrupt bool
+		// wantRequests is how many requests are sent, the rejected ones
+		// included
+		wantRequests int
+		wantErr      error
+		wantNote     string
+	}{
+		{"fits once shrunk", 12, false, 2, nil, "context length exceeded, dropped 12 earlier messages"},
+		{"fits once shrunk twice", 6, false, 3, nil, "context length exceeded, dropped 6 earlier messages"},
+		{"never fits", 0, false, maxContextRecoveries + 1, nil, "context length exceeded, dropped 6 earlier messages"},
+		{"interrupted once shrunk", 12, true, 2, ErrInterrupted, "context length exceeded, dropped 12 earlier messages"},
+	}
+	for _, tt := range tests {
+		requests := 0
+		server := httptest.NewServer(lengthServer{limit: tt.limit, answer: "ls -la", requests: &requests})
+		c := NewLLMClient(ModelConfig{ModelName: "gpt-4.1", Endpoint: server.URL + "/v1/chat/completions", Auth: "test"})
+		c.messages = turns(10)
+		c.StreamHandler = StreamFuncs{Token: func(string) {
+			if tt.interrupt {
+				c.Interrupt()
+			}
+		}}
+		_, err := c.Query("list files")
+		server.Close()
+
+		if requests != tt.wantRequests {
+			t.Errorf("%s: sent %d requests, want %d", tt.name, requests, tt.wantRequests)
+		}
+		switch {
+		case tt.limit == 0:
+			if !IsContextLengthError(err) {
+				t.Errorf("%s: got %v, want the provider's rejection", tt.name, err)
+			}
+		case err != tt.wantErr:
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.wantErr)
+		}
+
+		entry := c.LastEntry()
+		if entry.ContextNote != tt.wantNote || entry.Interrupted != tt.interrupt {
+			t.Errorf("%s: logged the note %q (interrupted %v), want %q", tt.name, entry.ContextNote, entry.Interrupted, tt.wantNote)
+		}
+		// Each rejection that was retried is logged too
+		logged, err := reqLogger.GetRecentResponses(20)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		retried := 0
+		for _, e := range logged {
+			if e.ConversationID == c.ConversationID && strings.HasSuffix(e.ContextNote, "context length exceeded, retrying") && e.Error != "" {
+				retried++
+			}
+		}
+		if retried != tt.wantRequests-1 {
+			t.Errorf("%s: logged %d retried rejections, want %d", tt.name, retried, tt.wantRequests-1)
+		}
+	}
+}
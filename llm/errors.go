@@ -0,0 +1,164 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"q/exitcode"
+	. "q/types"
+	"q/util"
+)
+
+// Kinds of errors recorded in the errors table
+const (
+	ErrorTransport = "transport"
+	ErrorHTTP      = "http"
+	ErrorSSE       = "sse"
+	ErrorJSON      = "json"
+)
+
+// Values of the error_log preference
+const (
+	ErrorLogRecord  = "record"
+	ErrorLogVerbose = "verbose"
+	ErrorLogOff     = "off"
+)
+
+// maxRecordedErrors caps the errors recorded per request, so a provider
+// streaming garbage can't flood the table
+const maxRecordedErrors = 20
+
+// recordError keeps a problem met while talking to the model for `q logs
+// errors` instead of printing it into the answer
+func (c *LLMClient) recordError(kind, message, detail, requestID string) {
+	if c.ErrorLog == ErrorLogOff || c.recordedErrors >= maxRecordedErrors {
+		return
+	}
+	c.recordedErrors++
+	if c.ErrorLog == ErrorLogVerbose {
+		fmt.Fprintf(util.Notes(), "Warning: %s error: %s\n", kind, message)
+	}
+	if c.logger != nil {
+		c.logger.LogError(ErrorRecord{
+			Kind:      kind,
+			Model:     c.config.ModelName,
+			RequestID: requestID,
+			Message:   message,
+			Detail:    detail,
+		})
+	}
+}
+
+// APIError is an error status from the provider's API
+type APIError struct {
+	StatusCode int
+	Status     string
+	// Code is the error's code or type from the body, such as insufficient_quota
+	Code string
+	// Message is the error's message from the body
+	Message string
+	// Detail, if set, is the start of the body, shown with the status
+	Detail string
+}
+
+func (e *APIError) Error() string {
+	if e.Detail != "" {
+		return "API request failed: " + e.Status + " " + e.Detail
+	}
+	return "API request failed: " + e.Status
+}
+
+// ExitCode tells rejected keys, exhausted quotas and safety filters apart from
+// other failures of the provider (see q/exitcode)
+func (e *APIError) ExitCode() int {
+	switch e.Code {
+	case "insufficient_quota", "billing_hard_limit_reached", "billing_not_active", "budget_exceeded":
+		return exitcode.Budget
+	case "content_filter", "content_policy_violation", "moderation_blocked":
+		return exitcode.Blocked
+	case "invalid_api_key", "authentication_error", "permission_error":
+		return exitcode.Auth
+	}
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return exitcode.Auth
+	case http.StatusPaymentRequired:
+		return exitcode.Budget
+	}
+	return exitcode.Provider
+}
+
+// ErrorCode is the error's code from the body, or else its HTTP status, for
+// the failure analytics of the log
+func (e *APIError) ErrorCode() string {
+	if e.Code != "" {
+		return e.Code
+	}
+	return strconv.Itoa(e.StatusCode)
+}
+
+// newAPIError reads the code of the error in an error response's body, which
+// OpenAI-style APIs put under error.code (or error.type, as Anthropic does).
+// With detail set, the start of the body is kept to show with the status.
+func newAPIError(resp *http.Response, body []byte, detail bool) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode, Status: resp.Status}
+	var parsed struct {
+		Error struct {
+			Code    interface{} `json:"code"`
+			Type    string      `json:"type"`
+			Message string      `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		apiErr.Message = parsed.Error.Message
+		if code, ok := parsed.Error.Code.(string); ok && code != "" {
+			apiErr.Code = code
+		} else {
+			apiErr.Code = parsed.Error.Type
+		}
+	}
+	if detail {
+		text := strings.TrimSpace(string(body))
+		if len(text) > 512 {
+			text = text[:512]
+		}
+		apiErr.Detail = text
+	}
+	return apiErr
+}
+
+// contextLengthMessage matches how providers word a request that doesn't fit
+// the model's context window, for those without a code for it
+var contextLengthMessage = regexp.MustCompile(`(?i)context.length|context.window|prompt is too long|too many tokens|reduce the length`)
+
+// IsContextLengthError reports whether err is the provider rejecting a
+// request as too long for the model's context window
+func IsContextLengthError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code == "context_length_exceeded" {
+		return true
+	}
+	return (apiErr.StatusCode == http.StatusBadRequest || apiErr.StatusCode == http.StatusRequestEntityTooLarge) &&
+		contextLengthMessage.MatchString(apiErr.Message)
+}
+
+// IsOffline reports whether err means the network is unreachable, such as
+// on a flight, rather than that the provider failed: the endpoint's name
+// couldn't be looked up, or there's no route to it
+func IsOffline(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETDOWN)
+}
@@ -0,0 +1,32 @@
+package llm
+
+import (
+	"q/provider"
+	"q/tokens"
+	. "q/types"
+)
+
+// exampleShare is the fraction of the context window examples may take by default
+const exampleShare = 8
+
+// Prompt returns the messages a conversation with the model starts with: its
+// prompt, then its examples as user and assistant turns, in order, as long as
+// they fit in the example budget
+func Prompt(config ModelConfig) []Message {
+	messages := append([]Message(nil), config.Prompt...)
+	budget := config.ExampleTokens
+	if budget == 0 {
+		// With an unknown context window, every example is sent
+		budget = provider.ContextWindow(config) / exampleShare
+	}
+	used := 0
+	for _, example := range config.Examples {
+		turn := []Message{{Role: "user", Content: example.Prompt}, {Role: "assistant", Content: example.Answer}}
+		used += tokens.EstimateMessages(turn)
+		if budget > 0 && used > budget {
+			break
+		}
+		messages = append(messages, turn...)
+	}
+	return messages
+}
@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Explanation is a breakdown of a shell command
+type Explanation struct {
+	Summary string          `json:"summary"`
+	Parts   []ExplainedPart `json:"parts"`
+	// Notes are the model's safety notes
+	Notes []string `json:"notes"`
+}
+
+// ExplainedPart is one word or flag of a command and what it does
+type ExplainedPart struct {
+	Part    string `json:"part"`
+	Meaning string `json:"meaning"`
+}
+
+const explainPrompt = `Explain the shell command the user gives, part by part. Reply with JSON only, in this shape:
+{"summary": "one or two sentences on what the whole command does",
+ "parts": [{"part": "the program, a flag with its value, an argument, an operator or a redirection, exactly as written", "meaning": "what it does here, in one short sentence"}],
+ "notes": ["anything that deletes, overwrites or is hard to undo, runs as root, or behaves surprisingly; empty if nothing"]}
+List the parts in the order they appear. Split combined short flags like -xzvf into one part per flag, written like -x.`
+
+// Explain asks the model for a flag-by-flag breakdown of a shell command
+func (c *LLMClient) Explain(command string) (Explanation, error) {
+	var explanation Explanation
+	answer, err := c.complete(explainPrompt, command, "explain")
+	if err != nil {
+		return explanation, err
+	}
+	answer = strings.TrimSpace(answer)
+	// Models often wrap JSON in a code block anyway
+	if strings.HasPrefix(answer, "```") {
+		answer = strings.TrimPrefix(strings.TrimPrefix(answer, "```json"), "```")
+		answer = strings.TrimSuffix(strings.TrimSpace(answer), "```")
+	}
+	if err := json.Unmarshal([]byte(answer), &explanation); err != nil {
+		return explanation, fmt.Errorf("the model's answer wasn't the expected JSON: %w", err)
+	}
+	return explanation, nil
+}
@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// credentialHeader matches the names of headers whose values are
+// credentials, which are masked when requests are recorded with --debug
+var credentialHeader = regexp.MustCompile(`(?i)auth|key|token|secret|password|cookie|signature`)
+
+// setHeaders adds the model's extra headers to a request, over any set already
+func (c *LLMClient) setHeaders(req *http.Request) {
+	for name, value := range c.config.Headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// maskHeaders returns the headers of a request for the log, with the values
+// of credentials cut down to their last four characters
+func maskHeaders(header http.Header) map[string]string {
+	masked := make(map[string]string, len(header))
+	for name := range header {
+		value := header.Get(name)
+		if credentialHeader.MatchString(name) {
+			value = maskValue(value)
+		}
+		masked[name] = value
+	}
+	return masked
+}
+
+func maskValue(value string) string {
+	if len(value) <= 12 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
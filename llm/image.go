@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"q/exitcode"
+	"q/logger"
+	. "q/types"
+)
+
+// DefaultImageModel is used by `q image` unless preferences.image_model is set
+const DefaultImageModel = "gpt-image-1"
+
+// ImageOptions are the settings of a generated image
+type ImageOptions struct {
+	Model   string
+	Size    string
+	Quality string
+}
+
+// GeneratedImage is an image returned by the Images API
+type GeneratedImage struct {
+	Data []byte
+	// RevisedPrompt is the prompt the model actually used, if it rewrote it (DALL·E 3)
+	RevisedPrompt string
+	RequestID     string
+}
+
+// DefaultImageQuality is the quality asked for when none is given, so the
+// price is known; DALL·E 2 has only one
+func DefaultImageQuality(model string) string {
+	switch {
+	case strings.HasPrefix(model, "gpt-image"):
+		return "medium"
+	case model == "dall-e-3":
+		return "standard"
+	}
+	return ""
+}
+
+// GenerateImage asks the Images API for one image of prompt
+func (c *LLMClient) GenerateImage(prompt string, opts ImageOptions) (GeneratedImage, error) {
+	var image GeneratedImage
+	base, err := c.apiBaseURL()
+	if err != nil {
+		return image, err
+	}
+	request := map[string]interface{}{
+		"model":  opts.Model,
+		"prompt": prompt,
+		"n":      1,
+	}
+	if opts.Size != "" {
+		request["size"] = opts.Size
+	}
+	if opts.Quality != "" {
+		request["quality"] = opts.Quality
+	}
+	// gpt-image models always return base64; DALL·E returns a URL unless asked
+	if strings.HasPrefix(opts.Model, "dall-e") {
+		request["response_format"] = "b64_json"
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return image, err
+	}
+	if c.Debug {
+		c.rawRequest = string(body)
+		c.rawResponse.Reset()
+	}
+
+	req, err := c.newAPIRequest("POST", base+"/images/generations", bytes.NewReader(body))
+	if err != nil {
+		return image, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Debug {
+		c.rawHeaders = maskHeaders(req.Header)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.recordError(ErrorTransport, err.Error(), "", "")
+		return image, exitcode.Wrap(exitcode.Provider, fmt.Errorf("failed to make the API request: %w", err))
+	}
+	defer resp.Body.Close()
+	image.RequestID = resp.Header.Get("X-Request-Id")
+	if resp.StatusCode != http.StatusOK {
+		return image, c.failedResponse(resp)
+	}
+
+	var result struct {
+		Data []struct {
+			B64JSON       string `json:"b64_json"`
+			URL           string `json:"url"`
+			RevisedPrompt string `json:"revised_prompt"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		c.recordError(ErrorJSON, "failed to parse the response: "+err.Error(), "", image.RequestID)
+		return image, fmt.Errorf("failed to parse the response: %w", err)
+	}
+	if len(result.Data) == 0 {
+		return image, fmt.Errorf("the response contained no image")
+	}
+	data := result.Data[0]
+	image.RevisedPrompt = data.RevisedPrompt
+	if data.B64JSON != "" {
+		image.Data, err = base64.StdEncoding.DecodeString(data.B64JSON)
+		if err != nil {
+			return image, fmt.Errorf("failed to decode the image: %w", err)
+		}
+		return image, nil
+	}
+	if data.URL == "" {
+		return image, fmt.Errorf("the response contained no image")
+	}
+	image.Data, err = download(c.httpClient, data.URL)
+	return image, err
+}
+
+// download fetches an image from the short-lived URL the API returned
+func download(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the image: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// LogImage logs a generated image saved as record describes, or the error
+// that stopped it
+func (c *LLMClient) LogImage(prompt string, opts ImageOptions, image GeneratedImage, record *ImageRecord, durationMs int64, err error) {
+	entry := LogEntry{
+		Timestamp:  time.Now().UTC(),
+		Model:      opts.Model,
+		Messages:   []Message{{Role: "user", Content: prompt}},
+		RequestID:  image.RequestID,
+		DurationMs: durationMs,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Image = record
+		entry.Response = "Image saved to " + record.Path
+		if image.RevisedPrompt != "" {
+			entry.Response += "\n\nRevised prompt: " + image.RevisedPrompt
+		}
+		entry.EstimatedCost = logger.ImageCost(opts.Model, opts.Size, opts.Quality)
+	}
+	c.writeLog(entry)
+}
@@ -0,0 +1,101 @@
+package llm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const judgePickPrompt = `You judge answers given to the same request. They are numbered [1], [2] and so on. Pick the one that is most correct, then most complete, then most concise. Reply with its number alone on the first line, then one short sentence on why.`
+
+const judgeMergePrompt = `You merge answers given to the same request. They are numbered [1], [2] and so on. Write the single best answer: keep what they agree on or what is clearly correct, and leave out what is wrong. Reply with only the answer, in the same format they use, without mentioning the numbered answers.`
+
+// Verdict is a judge's decision on sampled answers
+type Verdict struct {
+	// Pick is the number of the answer picked, from 1, or 0 if they were merged
+	Pick int
+	// Answer is the answer picked, or the merged one
+	Answer string
+	// Reason is why the judge picked it
+	Reason string
+}
+
+// pickNumber finds the number a judge's reply starts with, as in "2", "[2]"
+// or "Answer 2"
+var pickNumber = regexp.MustCompile(`^\D{0,20}?(\d+)`)
+
+// Judge has the model pick the best of answers to query, or merge them into
+// one if merge is set. Its request is logged like a summary's.
+func (c *LLMClient) Judge(query string, answers []string, merge bool) (Verdict, error) {
+	var user strings.Builder
+	fmt.Fprintf(&user, "Request:\n%s\n", query)
+	for i, answer := range answers {
+		fmt.Fprintf(&user, "\n[%d]\n%s\n", i+1, answer)
+	}
+	if merge {
+		answer, err := c.complete(judgeMergePrompt, user.String(), "judge: merge")
+		return Verdict{Answer: strings.TrimSpace(answer)}, err
+	}
+
+	reply, err := c.complete(judgePickPrompt, user.String(), "judge: pick")
+	if err != nil {
+		return Verdict{}, err
+	}
+	pick, reason, err := leadingNumber(reply)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("the judge didn't name an answer: %w", err)
+	}
+	if pick < 1 || pick > len(answers) {
+		return Verdict{}, fmt.Errorf("the judge picked answer %d of %d", pick, len(answers))
+	}
+	return Verdict{Pick: pick, Answer: answers[pick-1], Reason: reason}, nil
+}
+
+// leadingNumber reads a judge's reply: the number its first line starts
+// with, and the explanation after it
+func leadingNumber(reply string) (int, string, error) {
+	reply = strings.TrimSpace(reply)
+	first, rest := reply, ""
+	if i := strings.IndexByte(reply, '\n'); i >= 0 {
+		first, rest = reply[:i], strings.TrimSpace(reply[i+1:])
+	}
+	match := pickNumber.FindStringSubmatch(first)
+	if match == nil {
+		return 0, "", fmt.Errorf("no number in %q", first)
+	}
+	n, _ := strconv.Atoi(match[1])
+	return n, rest, nil
+}
+
+const judgeScorePrompt = `You grade an answer to a request from 1 to 5: 1 is wrong or useless, 3 is usable but flawed, 5 is correct, complete and concise. Grade by the criteria if given, and against the reference answer if given, which is known to be good. Reply with the grade alone on the first line, then one short sentence on why.`
+
+// MaxScore is the best grade Score gives
+const MaxScore = 5
+
+// Score has the model grade an answer to query from 1 to MaxScore, by
+// criteria and against a reference answer, either of which may be "". It
+// returns the grade and why. Its request is logged like a summary's.
+func (c *LLMClient) Score(query, answer, criteria, reference string) (int, string, error) {
+	var user strings.Builder
+	fmt.Fprintf(&user, "Request:\n%s\n", query)
+	if criteria != "" {
+		fmt.Fprintf(&user, "\nCriteria:\n%s\n", criteria)
+	}
+	if reference != "" {
+		fmt.Fprintf(&user, "\nReference answer:\n%s\n", reference)
+	}
+	fmt.Fprintf(&user, "\nAnswer to grade:\n%s\n", answer)
+	reply, err := c.complete(judgeScorePrompt, user.String(), "judge: score")
+	if err != nil {
+		return 0, "", err
+	}
+	score, reason, err := leadingNumber(reply)
+	if err != nil {
+		return 0, "", fmt.Errorf("the judge didn't give a grade: %w", err)
+	}
+	if score < 1 || score > MaxScore {
+		return 0, "", fmt.Errorf("the judge gave a grade of %d, not 1 to %d", score, MaxScore)
+	}
+	return score, reason, nil
+}
@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"q/exitcode"
+	"q/transport"
+)
+
+// Key rotation strategies for models with several API keys
+const (
+	KeyFailover   = "failover"
+	KeyRoundRobin = "round-robin"
+)
+
+// roundRobinNext is the next key of each round-robin model, shared by every
+// client in the process since `q batch` creates one per prompt
+var (
+	roundRobinMu   sync.Mutex
+	roundRobinNext = map[string]int{}
+)
+
+// nextRoundRobinKey returns the index of the key the next request to model uses
+func nextRoundRobinKey(model string, n int) int {
+	roundRobinMu.Lock()
+	defer roundRobinMu.Unlock()
+	i, ok := roundRobinNext[model]
+	if !ok {
+		// Start somewhere different in each process, so separate runs spread out too
+		i = int(time.Now().UnixNano() % int64(n))
+	}
+	roundRobinNext[model] = (i + 1) % n
+	return i % n
+}
+
+// apiKey returns the key requests are sent with
+func (c *LLMClient) apiKey() string {
+	if len(c.config.Keys) == 0 {
+		return c.config.Auth
+	}
+	return c.config.Keys[c.keyIndex%len(c.config.Keys)].Key
+}
+
+// keyAlias names the key of the latest request for the log, if the model has several
+func (c *LLMClient) keyAlias() string {
+	if len(c.config.Keys) == 0 {
+		return ""
+	}
+	return c.config.Keys[c.keyIndex%len(c.config.Keys)].Alias
+}
+
+// keyRejected reports whether a response status blames the key itself: rate
+// limited, out of quota or not authorized
+func keyRejected(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// send sends payload to the model's endpoint. With several keys it picks one
+// according to the model's key_rotation, and when a key is rejected it tries
+// the next, until each has been tried once.
+func (c *LLMClient) send(ctx context.Context, payload interface{}) (*http.Response, error) {
+	c.recordedErrors, c.retries = 0, 0
+	n := len(c.config.Keys)
+	if n > 1 && c.config.KeyRotation == KeyRoundRobin {
+		c.keyIndex = nextRoundRobinKey(c.config.ModelName, n)
+	}
+	for tried := 1; ; tried++ {
+		req, err := c.createRequest(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the request: %w", err)
+		}
+		resp, err := c.httpClient.Do(req.WithContext(ctx))
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				c.recordError(ErrorTransport, err.Error(), "", "")
+			}
+			return nil, exitcode.Wrap(exitcode.Provider, fmt.Errorf("failed to make the API request: %w", err))
+		}
+		if tried >= n || !keyRejected(resp.StatusCode) {
+			return resp, nil
+		}
+		transport.Release(resp.Body)
+		c.recordError(ErrorHTTP, fmt.Sprintf("%s with API key %s, trying the next", resp.Status, c.keyAlias()), "", "")
+		c.keyIndex = (c.keyIndex + 1) % n
+		c.retries++
+	}
+}
@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"q/logger"
+	. "q/types"
+)
+
+// keyServer answers with each key's status, or streams an answer for a key
+// without one, and records the keys requests were sent with
+type keyServer struct {
+	status map[string]int
+	mu     *sync.Mutex
+	used   *[]string
+}
+
+func newKeyServer(status map[string]int) keyServer {
+	return keyServer{status: status, mu: &sync.Mutex{}, used: &[]string{}}
+}
+
+func (s keyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	*s.used = append(*s.used, key)
+	s.mu.Unlock()
+	if status, ok := s.status[key]; ok {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprint(w, streamResponse(fmt.Sprintf("req-%d", time.Now().UnixNano()), "ls -la", 64))
+}
+
+// keysUsed returns the keys requests were sent with since the last call
+func (s keyServer) keysUsed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	used := *s.used
+	*s.used = nil
+	return used
+}
+
+func testKeys(names ...string) []APIKey {
+	var keys []APIKey
+	for _, name := range names {
+		keys = append(keys, APIKey{Alias: name, EnvVar: "KEY_" + strings.ToUpper(name), Key: "sk-" + name})
+	}
+	return keys
+}
+
+func TestKeyFailover(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	reqLogger, err := logger.Shared()
+	if err != nil {
+		t.Fatalf("logger.Shared: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		status map[string]int
+		// wantUsed are the keys tried, in order; the next query starts with
+		// the last of them
+		wantUsed  []string
+		wantAlias string
+		wantErr   string
+	}{
+		{"rate limited", map[string]int{"sk-first": 429}, []string{"sk-first", "sk-second"}, "second", ""},
+		{"unauthorized", map[string]int{"sk-first": 401}, []string{"sk-first", "sk-second"}, "second", ""},
+		{"forbidden twice", map[string]int{"sk-first": 403, "sk-second": 403}, []string{"sk-first", "sk-second", "sk-third"}, "third", ""},
+		{"first key working", map[string]int{"sk-second": 429}, []string{"sk-first"}, "first", ""},
+		{"every key rejected", map[string]int{"sk-first": 429, "sk-second": 429, "sk-third": 401}, []string{"sk-first", "sk-second", "sk-third"}, "third", "401"},
+		{"server error", map[string]int{"sk-first": 500}, []string{"sk-first"}, "first", "500"},
+	}
+	for _, tt := range tests {
+		keys := newKeyServer(tt.status)
+		server := httptest.NewServer(keys)
+		c := NewLLMClient(ModelConfig{ModelName: "gpt-4.1", Endpoint: server.URL + "/v1/chat/completions", Keys: testKeys("first", "second", "third")})
+		answer, err := c.Query("list files")
+
+		if used := keys.keysUsed(); strings.Join(used, " ") != strings.Join(tt.wantUsed, " ") {
+			t.Errorf("%s: tried %v, want %v", tt.name, used, tt.wantUsed)
+		}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got %q, %v; want the error %q", tt.name, answer, err, tt.wantErr)
+			}
+		} else if err != nil || answer != "ls -la" {
+			t.Errorf("%s: got %q, %v; want the answer", tt.name, answer, err)
+		}
+
+		entry := c.LastEntry()
+		if entry.KeyAlias != tt.wantAlias || entry.Retries != len(tt.wantUsed)-1 {
+			t.Errorf("%s: logged the key %q after %d retries, want %q after %d", tt.name, entry.KeyAlias, entry.Retries, tt.wantAlias, len(tt.wantUsed)-1)
+		}
+		// A failed request is logged without an ID, so it's found by its conversation
+		recent, err := reqLogger.GetRecentResponses(10)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		logged := false
+		for _, e := range recent {
+			if e.ConversationID == c.ConversationID {
+				logged = true
+				if e.KeyAlias != tt.wantAlias {
+					t.Errorf("%s: the log has the key %q, want %q", tt.name, e.KeyAlias, tt.wantAlias)
+				}
+			}
+		}
+		if !logged {
+			t.Errorf("%s: the request wasn't logged", tt.name)
+		}
+
+		// The client keeps using the key that last worked
+		if tt.wantErr == "" {
+			c.Query("and hidden ones")
+			if used := keys.keysUsed(); len(used) != 1 || used[0] != "sk-"+tt.wantAlias {
+				t.Errorf("%s: the next query tried %v, want only sk-%s", tt.name, used, tt.wantAlias)
+			}
+		}
+		server.Close()
+	}
+}
+
+func TestKeyRoundRobin(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	keys := newKeyServer(map[string]int{"sk-second": 429})
+	server := httptest.NewServer(keys)
+	defer server.Close()
+	// Each query is a new client, as in q batch, so the turns are taken
+	// across clients
+	config := ModelConfig{ModelName: "round-robin-test", Endpoint: server.URL + "/v1/chat/completions",
+		Keys: testKeys("first", "second", "third"), KeyRotation: KeyRoundRobin}
+
+	var used []string
+	var aliases []string
+	for i := 0; i < 6; i++ {
+		c := NewLLMClient(config)
+		if _, err := c.Query("list files"); err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+		used = append(used, strings.Join(keys.keysUsed(), ","))
+		aliases = append(aliases, c.LastEntry().KeyAlias)
+	}
+
+	// The first key is picked at random; from there the keys take turns, and
+	// the rate limited one falls over to the next
+	next := map[string]string{"sk-first": "sk-second,sk-third", "sk-second,sk-third": "sk-third", "sk-third": "sk-first"}
+	alias := map[string]string{"sk-first": "first", "sk-second,sk-third": "third", "sk-third": "third"}
+	for i, keys := range used {
+		if _, ok := next[keys]; !ok {
+			t.Fatalf("query %d tried %s, in %v", i, keys, used)
+		}
+		if i > 0 && next[used[i-1]] != keys {
+			t.Errorf("query %d tried %s after %s, in %v", i, keys, used[i-1], used)
+		}
+		if aliases[i] != alias[keys] {
+			t.Errorf("query %d logged the key %q, want %q", i, aliases[i], alias[keys])
+		}
+	}
+}
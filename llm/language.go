@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"strings"
+
+	. "q/types"
+)
+
+// languageNames are the English names of common ISO 639-1 language codes,
+// which models follow more reliably than the codes themselves
+var languageNames = map[string]string{
+	"ar": "Arabic",
+	"bg": "Bulgarian",
+	"ca": "Catalan",
+	"cs": "Czech",
+	"da": "Danish",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"et": "Estonian",
+	"fa": "Persian",
+	"fi": "Finnish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"hr": "Croatian",
+	"hu": "Hungarian",
+	"id": "Indonesian",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"lt": "Lithuanian",
+	"lv": "Latvian",
+	"ms": "Malay",
+	"nb": "Norwegian",
+	"nl": "Dutch",
+	"no": "Norwegian",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ro": "Romanian",
+	"ru": "Russian",
+	"sk": "Slovak",
+	"sl": "Slovenian",
+	"sr": "Serbian",
+	"sv": "Swedish",
+	"th": "Thai",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"vi": "Vietnamese",
+	"zh": "Chinese",
+}
+
+// LanguageName is the name of a language code like "ja", or the language as
+// given if it isn't a known code, so "Klingon" works too
+func LanguageName(language string) string {
+	if name, ok := languageNames[strings.ToLower(language)]; ok {
+		return name
+	}
+	return language
+}
+
+// LocaleLanguage is the language code of a POSIX locale like "ja_JP.UTF-8",
+// taken from LC_ALL, LC_MESSAGES or LANG as lookup finds them, or "" for the
+// C locale or none
+func LocaleLanguage(lookup func(string) string) string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		// language[_territory][.codeset][@modifier]
+		parts := strings.FieldsFunc(lookup(name), func(r rune) bool {
+			return r == '_' || r == '-' || r == '.' || r == '@'
+		})
+		if len(parts) == 0 {
+			continue
+		}
+		language := strings.ToLower(parts[0])
+		if language == "c" || language == "posix" {
+			return ""
+		}
+		return language
+	}
+	return ""
+}
+
+// applyLanguage asks for the answer in Language, with an instruction just
+// before the query
+func (c *LLMClient) applyLanguage(payload *Payload) {
+	if c.Language == "" || len(payload.Messages) == 0 {
+		return
+	}
+	instruction := "Write your answer in " + LanguageName(c.Language) + ", whatever language the question is in. " +
+		"Keep commands, code, flags, file names and error messages exactly as they are."
+	n := len(payload.Messages)
+	messages := append([]Message(nil), payload.Messages[:n-1]...)
+	messages = append(messages, Message{Role: "system", Content: instruction}, payload.Messages[n-1])
+	payload.Messages = messages
+}
@@ -0,0 +1,52 @@
+package llm
+
+import (
+	. "q/types"
+)
+
+// Answer lengths, for --short and --detailed
+const (
+	LengthShort    = "short"
+	LengthDetailed = "detailed"
+)
+
+// lengthPreset is how an answer length is asked for: an instruction sent with
+// the query, and a cap on the tokens of the answer
+type lengthPreset struct {
+	instruction string
+	maxTokens   int
+}
+
+var lengthPresets = map[string]lengthPreset{
+	LengthShort: {
+		instruction: "Keep your answer as short as possible: just the command, or a sentence or two. Don't explain unless asked.",
+		maxTokens:   300,
+	},
+	LengthDetailed: {
+		instruction: "Give a thorough answer: explain what each part of the command does, point out caveats and alternatives, and show examples where they help.",
+		maxTokens:   2000,
+	},
+}
+
+// length is the answer length asked for: Length if set, or else the model's
+// (or persona's) length setting
+func (c *LLMClient) length() string {
+	if c.Length != "" {
+		return c.Length
+	}
+	return c.config.Length
+}
+
+// applyLength asks for the answer length in a request, with an instruction
+// just before the query and a cap on its tokens
+func (c *LLMClient) applyLength(payload *Payload) {
+	preset, ok := lengthPresets[c.length()]
+	if !ok || len(payload.Messages) == 0 {
+		return
+	}
+	n := len(payload.Messages)
+	messages := append([]Message(nil), payload.Messages[:n-1]...)
+	messages = append(messages, Message{Role: "system", Content: preset.instruction}, payload.Messages[n-1])
+	payload.Messages = messages
+	payload.MaxTokens = preset.maxTokens
+}
@@ -1,152 +1,654 @@
 package llm
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
+	"net/url"
 	. "q/types"
 	"strings"
+	"sync"
 	"time"
 
+	"q/exitcode"
+	"q/hooks"
 	"q/logger"
+	"q/provider"
+	"q/rag"
+	"q/sse"
+	"q/tokens"
+	"q/tracing"
+	"q/transport"
+	"q/util"
 )
 
+// ErrInterrupted is returned by Query when Interrupt stops a response midway.
+// The part received before the interruption is returned with it.
+var ErrInterrupted = exitcode.Wrap(exitcode.Interrupted, errors.New("interrupted"))
+
 type LLMClient struct {
-	config   ModelConfig
-	messages []Message
+	config ModelConfig
+	// baseConfig is the config the client was created with, before any routing
+	baseConfig ModelConfig
+	messages   []Message
+	// pinned is the number of leading messages (the configured prompt) never dropped from the context
+	pinned int
+	// keyIndex is the API key in use, for models with several (see send)
+	keyIndex int
+
+	// StreamHandler, if set, is passed the answer as it streams in
+	StreamHandler StreamHandler
+	// ThinkingCallback, if set, is passed the reasoning so far as it streams
+	// in, before the answer
+	ThinkingCallback func(string)
 
-	StreamCallback func(string, error)
+	// OutputPath is recorded with each log entry when responses are also written to a file
+	OutputPath string
+	// Persona is the name of the persona whose prompt replaced the model's, if any
+	Persona string
+	// Temperature is the sampling temperature sent with each request (default 0)
+	Temperature float32
+	// RegeneratedFrom is the request ID of the answer this session is a new take on, if any
+	RegeneratedFrom string
+	// Debug records the exact request JSON and raw response of each call in the logs
+	Debug bool
+	// Requires lists capabilities the model needs for this session's requests (e.g. Vision)
+	Requires ModelCapabilities
+	// Route, if set, may switch to another model based on the first query of a
+	// conversation; follow-ups stay on the chosen model
+	Route func(query string) (ModelConfig, bool)
+	// Rivals, if set, are models the next query is also sent to at once; the
+	// first to answer is streamed and kept for follow-ups, and the others are
+	// interrupted and logged as having lost the race (see race)
+	Rivals []ModelConfig
+	// RoutedFrom is the model the router switched away from, if any
+	RoutedFrom string
+	// ConversationID groups the requests of this session in the logs; set it
+	// to continue a logged conversation, or clear it for one-off requests
+	ConversationID string
+	// ConversationVersion is the version of the conversation this session last
+	// saw; answers are only logged on top of it (see logger.LogTurn)
+	ConversationVersion int
+	// ConversationHead is the request ID of the conversation's latest answer,
+	// where this session forks off if another one continues it concurrently
+	ConversationHead string
+	// Sources are the labels of the numbered sources attached to the next query,
+	// matched against the [n] citations in its answer for the log
+	Sources []string
+	// URLs are the pages pinned to the context with --url, recorded with each log entry
+	URLs []string
+	// ErrorLog is the error_log preference: how stream and transport errors are reported
+	ErrorLog string
+	// Prefill, if set, is what answers to queries start with, instead of the model's prefill setting
+	Prefill string
+	// Memory is the remembered facts to send with every request, as an
+	// instruction (see q/memory)
+	Memory string
+	// PackageManager is an instruction to install software with the user's
+	// package manager, sent with every request, or "" (see q/pkgmgr)
+	PackageManager string
+	// Language, if set, is the language answers are asked for in, as a code
+	// like "ja" or a name, recorded with each log entry
+	Language string
+	// Length, if set, is the answer length asked for (LengthShort or
+	// LengthDetailed), instead of the model's length setting
+	Length string
+	// StopAtCode ends each answer once its first code block is complete,
+	// saving the tokens of any explanation after it
+	StopAtCode bool
+	// SampleGroup, if set, groups the requests logged with the answers
+	// sampled for the same prompt (see Samples)
+	SampleGroup string
+	// Tools are functions the model may call while answering; their results
+	// are sent back to it until it answers (see runTools)
+	Tools []Tool
 
 	httpClient *http.Client
 	logger     *logger.RequestLogger
+	lastEntry  LogEntry
+	// recordedErrors counts the errors recorded for the current request
+	recordedErrors int
+	// retries counts the times the current request was sent again with another key
+	retries int
+	// trace carries the span of the query in flight, the parent of its steps' spans
+	trace context.Context
+	// reasoning is the reasoning of the current request, if the model sent
+	// any: its thinking, or a summary of it
+	reasoning string
+	// calls are the function calls the model asked for in the current request
+	calls []ToolCall
+	// stoppedEarly is set when StopAtCode cut the current answer short
+	stoppedEarly bool
+	// parentHead is the answer the conversation's latest one followed, where
+	// Regenerate forks off
+	parentHead string
+
+	// raw request and response of the current call, kept when Debug is set
+	rawRequest  string
+	rawHeaders  map[string]string
+	rawResponse strings.Builder
+
+	// cancel stops the streaming request in flight; guarded by mu since
+	// Interrupt is called from other goroutines
+	mu          sync.Mutex
+	cancel      context.CancelFunc
+	interrupted bool
+	// racing is the race the current query is in, if it's sent to Rivals;
+	// rivals are the other clients in it, interrupted along with this one
+	racing *race
+	rivals []*LLMClient
 }
 
 func NewLLMClient(config ModelConfig) *LLMClient {
 	// Initialize logger (best effort, non-fatal if it fails)
-	reqLogger, _ := logger.NewRequestLogger()
+	reqLogger, _ := logger.Shared()
+	messages := Prompt(config)
 
 	return &LLMClient{
-		config:   config,
-		messages: append([]Message(nil), config.Prompt...),
+		config:     config,
+		baseConfig: config,
+		messages:   messages,
+		pinned:     len(messages),
 
-		httpClient: &http.Client{
-			Timeout: time.Second * 120,
-		},
-		logger: reqLogger,
+		ConversationID: logger.NewConversationID(),
+
+		httpClient: transport.Client(time.Second * 120),
+		logger:     reqLogger,
 	}
 }
 
-func (c *LLMClient) createRequest(payload Payload) (*http.Request, error) {
+func (c *LLMClient) createRequest(payload interface{}) (*http.Request, error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal payload: %w", err)
 	}
-	req, err := http.NewRequest("POST", c.config.Endpoint, bytes.NewBuffer(payloadBytes))
+	if c.Debug {
+		c.rawRequest = string(payloadBytes)
+		c.rawResponse.Reset()
+	}
+	req, err := c.newAPIRequest("POST", c.requestURL(), bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Debug {
+		c.rawHeaders = maskHeaders(req.Header)
+	}
+	return req, nil
+}
+
+// newAPIRequest creates a request to the model's API with its auth and extra
+// headers set
+func (c *LLMClient) newAPIRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	if strings.Contains(c.config.Endpoint, "openai.azure.com") {
-		req.Header.Set("Api-Key", c.config.Auth)
+	if c.config.AuthHeader == provider.AuthAPIKey || strings.Contains(c.config.Endpoint, "openai.azure.com") {
+		req.Header.Set("Api-Key", c.apiKey())
 	} else {
-		req.Header.Set("Authorization", "Bearer "+c.config.Auth)
+		req.Header.Set("Authorization", "Bearer "+c.apiKey())
 	}
 	if c.config.OrgID != "" {
 		req.Header.Set("OpenAI-Organization", c.config.OrgID)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	c.setHeaders(req)
 	return req, nil
 }
 
-func (c *LLMClient) Query(query string) (string, error) {
-	startTime := time.Now()
-	messages := c.messages
-	messages = append(messages, Message{Role: "user", Content: query})
+// Query sends query with the conversation so far and returns the answer,
+// streaming it to the StreamHandler, which is told how the query ended
+func (c *LLMClient) Query(query string) (answer string, err error) {
+	defer func() {
+		if err != nil {
+			c.handler().OnError(err)
+		} else {
+			c.handler().OnDone(answer)
+		}
+	}()
+	if c.Route != nil && len(c.messages) == c.pinned {
+		if routed, ok := c.Route(query); ok && routed.ModelName != c.config.ModelName {
+			c.RoutedFrom = c.config.ModelName
+			c.config = routed
+			c.messages = Prompt(routed)
+			c.pinned = len(c.messages)
+			c.keyIndex = 0
+		}
+		c.Route = nil
+	}
+	if len(c.Rivals) > 0 {
+		rivals := c.Rivals
+		c.Rivals = nil
+		return c.race(query, rivals)
+	}
+	return c.ask(query)
+}
 
-	payload := Payload{
-		Model:       c.config.ModelName,
-		Messages:    messages,
-		Temperature: 0,
-		Stream:      true,
-		StreamOptions: &StreamOptions{IncludeUsage: true},
+// ask sends query with the conversation so far, logging the request
+func (c *LLMClient) ask(query string) (answer string, err error) {
+	need := c.Requires
+	need.Streaming = true
+	if len(c.Tools) > 0 {
+		need.Tools = true
+		if c.usesResponses() {
+			return "", errToolsNeedChat
+		}
+	}
+	if err := provider.Check(c.config, need); err != nil {
+		return "", err
+	}
+	if err := c.checkConversation(); err != nil {
+		return "", err
 	}
 
-	message, usage, requestID, err := c.callStream(payload)
-	durationMs := time.Since(startTime).Milliseconds()
+	_, span := c.startTrace()
+	defer c.endTrace(span)
 
-	if err != nil {
-		// Log error case
-		if c.logger != nil {
-			logEntry := logger.CreateLogEntry(
-				c.config.ModelName,
-				messages,
-				"",
-				usage,
-				requestID,
-				durationMs,
-				err,
-			)
-			if logErr := c.logger.LogResponse(logEntry); logErr != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to write log: %v\n", logErr)
-			}
+	messages := append(append([]Message(nil), c.messages...), Message{Role: "user", Content: query})
+	messages, contextNote := c.fitContext(messages)
+	if contextNote != "" {
+		c.messages = append([]Message(nil), messages[:len(messages)-1]...)
+	}
+
+	var (
+		message     Message
+		usage       struct{ PromptTokens, CompletionTokens, TotalTokens int }
+		requestID   string
+		durationMs  int64
+		interrupted bool
+		// exchange is the tool calls the model made and their results, which
+		// go in the conversation ahead of its answer
+		exchange []Message
+		// toolUsage and toolMs are what the requests for tool calls took
+		toolUsage struct{ PromptTokens, CompletionTokens, TotalTokens int }
+		toolMs    int64
+		rounds    int
+	)
+	for attempt := 0; ; attempt++ {
+		var payload Payload
+		if payload, err = c.queryPayload(messages); err != nil {
+			return "", err
 		}
-		return "", err
+
+		startTime := time.Now()
+		ctx, cancel := context.WithCancel(c.traceContext())
+		c.mu.Lock()
+		c.cancel, c.interrupted = cancel, false
+		c.mu.Unlock()
+		message, usage, requestID, err = c.callStream(ctx, payload)
+		durationMs = toolMs + time.Since(startTime).Milliseconds()
+		usage.PromptTokens += toolUsage.PromptTokens
+		usage.CompletionTokens += toolUsage.CompletionTokens
+		usage.TotalTokens += toolUsage.TotalTokens
+		c.mu.Lock()
+		c.cancel = nil
+		interrupted = c.interrupted
+		c.mu.Unlock()
+		cancel()
+
+		if err == nil && !interrupted && len(message.ToolCalls) > 0 && rounds < maxToolRounds {
+			// Run the tools asked for and send their results back, until the
+			// model answers
+			results := c.runTools(message.ToolCalls)
+			exchange = append(append(exchange, message), results...)
+			messages = append(append(messages, message), results...)
+			toolUsage, toolMs = usage, durationMs
+			rounds++
+			continue
+		}
+		if interrupted || len(exchange) > 0 || attempt >= maxContextRecoveries || !IsContextLengthError(err) {
+			break
+		}
+		// The estimate was off or the window unknown: log the rejection, then
+		// try again with the oldest turns dropped or summarized
+		recovered, note := c.recoverContext(messages)
+		if note == "" {
+			break
+		}
+		entry := logger.CreateLogEntry(c.config.ModelName, messages, "", usage, requestID, durationMs, err)
+		entry.ContextNote = strings.TrimPrefix(contextNote+"; context length exceeded, retrying", "; ")
+		entry.ConversationID = c.ConversationID
+		c.writeLog(entry)
+		messages = recovered
+		contextNote = "context length exceeded, " + note
+		c.messages = append([]Message(nil), messages[:len(messages)-1]...)
 	}
 
-	c.messages = append(c.messages, message)
+	// Calls left once the rounds run out go unanswered
+	message.ToolCalls = nil
 
-	// Log successful case
-	if c.logger != nil {
-		logEntry := logger.CreateLogEntry(
+	if interrupted {
+		// Log what was received; the stream stopped before any usage arrived
+		c.messages = append(c.messages, Message{Role: "user", Content: query})
+		c.messages = append(append(c.messages, exchange...), message)
+		entry := logger.CreateLogEntry(c.config.ModelName, messages, message.Content, usage, requestID, durationMs, nil)
+		entry.ContextNote = contextNote
+		entry.ConversationID = c.ConversationID
+		entry.Interrupted = true
+		c.writeLog(entry)
+		return message.Content, ErrInterrupted
+	}
+
+	if err != nil {
+		// Log error case
+		// A stalled stream's partial answer is kept in the log
+		entry := logger.CreateLogEntry(
 			c.config.ModelName,
 			messages,
 			message.Content,
 			usage,
 			requestID,
 			durationMs,
-			nil,
+			err,
 		)
-		if logErr := c.logger.LogResponse(logEntry); logErr != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to write log: %v\n", logErr)
-		}
+		entry.ContextNote = contextNote
+		entry.ConversationID = c.ConversationID
+		c.writeLog(entry)
+		return message.Content, err
 	}
 
+	c.messages = append(c.messages, Message{Role: "user", Content: query})
+	c.messages = append(append(c.messages, exchange...), message)
+
+	// Log successful case
+	entry := logger.CreateLogEntry(
+		c.config.ModelName,
+		messages,
+		message.Content,
+		usage,
+		requestID,
+		durationMs,
+		nil,
+	)
+	entry.ContextNote = contextNote
+	entry.ConversationID = c.ConversationID
+	c.writeLog(entry)
+
 	return message.Content, nil
 }
 
+// queryPayload is the streaming request for a query's messages, with the
+// system prompt, remembered facts, package manager, language, length and
+// tools applied
+func (c *LLMClient) queryPayload(messages []Message) (Payload, error) {
+	payload := Payload{
+		Model:         c.config.ModelName,
+		Messages:      messages,
+		Temperature:   c.Temperature,
+		Stream:        true,
+		StreamOptions: &StreamOptions{IncludeUsage: true},
+	}
+	if err := c.applySystemPrompt(&payload); err != nil {
+		return payload, err
+	}
+	c.applyMemory(&payload)
+	c.applyPackageManager(&payload)
+	c.applyLanguage(&payload)
+	c.applyLength(&payload)
+	c.applyTools(&payload)
+	return payload, nil
+}
+
+// Interrupt stops the response being streamed, if any. Query then returns
+// the partial response with ErrInterrupted.
+func (c *LLMClient) Interrupt() {
+	c.stop()
+	c.mu.Lock()
+	rivals := c.rivals
+	c.mu.Unlock()
+	for _, rival := range rivals {
+		rival.stop()
+	}
+}
+
+// stop interrupts this client's request, but not its rivals'
+func (c *LLMClient) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+		c.interrupted = true
+	}
+}
+
+// LastEntry returns the log entry of the most recent request, including token usage and cost
+func (c *LLMClient) LastEntry() LogEntry {
+	return c.lastEntry
+}
+
+// Pin adds messages after the configured prompt that are always kept in the
+// context, such as reference material the conversation is about
+func (c *LLMClient) Pin(messages ...Message) {
+	head := append(append([]Message(nil), c.messages[:c.pinned]...), messages...)
+	c.messages = append(head, c.messages[c.pinned:]...)
+	c.pinned += len(messages)
+}
+
+// AppendHistory adds earlier turns to the conversation, as if they had happened in this session
+func (c *LLMClient) AppendHistory(messages ...Message) {
+	c.messages = append(c.messages, messages...)
+}
+
+// Model returns the name of the model requests are sent to
+func (c *LLMClient) Model() string {
+	return c.config.ModelName
+}
+
+// NextModel returns the model query will be sent to, taking routing into account
+func (c *LLMClient) NextModel(query string) string {
+	if c.Route != nil && len(c.messages) == c.pinned {
+		if routed, ok := c.Route(query); ok {
+			return routed.ModelName
+		}
+	}
+	return c.config.ModelName
+}
+
+// Reset starts a new conversation on the original model, keeping only the configured prompt
+func (c *LLMClient) Reset() {
+	c.config = c.baseConfig
+	c.messages = Prompt(c.config)
+	c.pinned = len(c.messages)
+	c.RoutedFrom = ""
+	c.ConversationID = logger.NewConversationID()
+	c.ConversationVersion, c.ConversationHead, c.parentHead = 0, "", ""
+}
+
+// Regenerate asks the last question again for a new answer at temperature,
+// in place of the last one. The conversation continues in a fork from the
+// turn before, so the first answer stays in the log.
+func (c *LLMClient) Regenerate(temperature float32) (string, error) {
+	n := len(c.messages)
+	if n < c.pinned+2 || c.messages[n-2].Role != "user" {
+		return "", fmt.Errorf("there's no answer to regenerate")
+	}
+	prompt := c.messages[n-2].Content
+	c.messages = c.messages[:n-2]
+
+	fork := ""
+	if c.logger != nil && c.ConversationHead != "" && c.parentHead != "" {
+		fork, _ = c.logger.ForkConversation(c.ConversationID, c.parentHead)
+	}
+	if fork != "" {
+		c.ConversationID, c.ConversationHead = fork, c.parentHead
+	} else {
+		// The last turn was the first, or the fork couldn't be made
+		c.ConversationID, c.ConversationHead = logger.NewConversationID(), ""
+	}
+	c.ConversationVersion, c.parentHead = 0, ""
+
+	from, temp := c.RegeneratedFrom, c.Temperature
+	c.RegeneratedFrom, c.Temperature = c.lastEntry.RequestID, temperature
+	defer func() { c.RegeneratedFrom, c.Temperature = from, temp }()
+	return c.Query(prompt)
+}
+
+// endpointHost is the host of an endpoint, for the log
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// writeLog adds client-level metadata to the entry and stores it (best effort)
+func (c *LLMClient) writeLog(entry LogEntry) {
+	_, span := tracing.Start(c.traceContext(), "log")
+	defer span.End()
+	entry.OutputPath = c.OutputPath
+	entry.Persona = c.Persona
+	entry.Language = c.Language
+	entry.RegeneratedFrom = c.RegeneratedFrom
+	entry.RoutedFrom = c.RoutedFrom
+	entry.SampleGroup = c.SampleGroup
+	entry.URLs = c.URLs
+	entry.KeyAlias = c.keyAlias()
+	entry.Endpoint = endpointHost(c.config.Endpoint)
+	entry.Retries, c.retries = c.retries, 0
+	entry.Reasoning, c.reasoning = c.reasoning, ""
+	entry.StoppedEarly, c.stoppedEarly = c.stoppedEarly, false
+	if len(c.Sources) > 0 {
+		entry.Citations = rag.Cite(entry.Response, c.Sources)
+	}
+	// Images and transcriptions are priced per item, not per token
+	if entry.TotalTokens == 0 && entry.Error == "" && entry.Image == nil && entry.AudioSeconds == 0 {
+		estimateUsage(&entry)
+	}
+	if c.Debug {
+		entry.RequestRaw = c.rawRequest
+		entry.RequestHeaders = c.rawHeaders
+		entry.ResponseRaw = c.rawResponse.String()
+		c.rawRequest, c.rawHeaders = "", nil
+		c.rawResponse.Reset()
+	}
+	if c.racing != nil {
+		if winner := c.racing.lostTo(c, entry.Error == ""); winner != "" {
+			// The loser's answer isn't a turn of the conversation
+			entry.ConversationID = ""
+			entry.ContextNote = strings.TrimPrefix(entry.ContextNote+"; lost the race to "+winner, "; ")
+		}
+	}
+	if c.logger != nil {
+		var logErr error
+		if entry.ConversationID != "" && entry.Error == "" {
+			logErr = c.logTurn(&entry)
+		} else {
+			logErr = c.logger.LogResponse(entry)
+		}
+		if logErr != nil {
+			fmt.Fprintf(util.Notes(), "Warning: failed to write log: %v\n", logErr)
+		}
+	}
+	c.lastEntry = entry
+}
+
+// logTurn logs an answer as the next turn of the session's conversation. If
+// another session continued the conversation while this answer streamed, the
+// answer starts a fork instead, so the two sessions' turns never interleave.
+func (c *LLMClient) logTurn(entry *LogEntry) error {
+	id, err := c.logger.LogTurn(*entry, c.ConversationVersion)
+	var conflict *logger.ConflictError
+	if errors.As(err, &conflict) {
+		fork, forkErr := c.logger.ForkConversation(c.ConversationID, c.ConversationHead)
+		if forkErr != nil {
+			return forkErr
+		}
+		fmt.Fprintf(util.Notes(), "Note: %v; this answer continues in a fork, %s\n", err, fork)
+		c.ConversationID, c.ConversationVersion = fork, 0
+		entry.ConversationID = fork
+		id, err = c.logger.LogTurn(*entry, 0)
+	}
+	if err != nil {
+		return err
+	}
+	entry.RequestID = id
+	c.parentHead, c.ConversationHead = c.ConversationHead, id
+	c.ConversationVersion++
+	return nil
+}
+
+// checkConversation fails with a *logger.ConflictError if another session
+// continued the conversation since this one last saw it
+func (c *LLMClient) checkConversation() error {
+	if c.logger == nil || c.ConversationID == "" {
+		return nil
+	}
+	return c.logger.CheckConversation(c.ConversationID, c.ConversationVersion)
+}
+
+// estimateUsage fills in the token counts of an answer the provider reported no
+// usage for, as some OpenAI-compatible servers never do, so stats and budgets
+// still see the request
+func estimateUsage(entry *LogEntry) {
+	entry.PromptTokens = tokens.EstimateMessages(entry.Messages)
+	entry.CompletionTokens = tokens.Estimate(entry.Response)
+	entry.TotalTokens = entry.PromptTokens + entry.CompletionTokens
+	entry.EstimatedCost = logger.CalculateCost(entry.Model, entry.PromptTokens, entry.CompletionTokens)
+	entry.TokensEstimated = true
+}
+
 func (c *LLMClient) processStream(resp *http.Response) (string, struct {
 	PromptTokens     int
 	CompletionTokens int
 	TotalTokens      int
 }, string, error) {
-	counter := 0
-	streamReader := bufio.NewReader(resp.Body)
-	totalData := ""
+	// Each delta is looked at once: think splits off any <think> block and the
+	// whitespace an answer starts with, and only the text it adds is passed
+	// on, so long answers stream as fast as short ones. fieldReasoning is
+	// reasoning sent in its own delta field.
+	var answer strings.Builder
+	var think thinkSplitter
+	var fieldReasoning strings.Builder
+	c.reasoning = ""
 	var usage struct {
 		PromptTokens     int
 		CompletionTokens int
 		TotalTokens      int
 	}
 	var requestID string
+	var calls toolCalls
+	handler := c.handler()
+	c.calls = nil
+	defer func() {
+		c.calls = calls.calls
+		calls.flush(handler)
+	}()
+
+	body := c.watchStall(resp.Body)
+	if c.Debug {
+		body = io.TeeReader(body, &c.rawResponse)
+	}
+	events := sse.NewReader(body)
+	events.Unknown = func(line string) {
+		c.recordError(ErrorSSE, "unexpected line in the stream", line, requestID)
+	}
 
 	for {
-		line, err := streamReader.ReadString('\n')
-		if err != nil {
-			break
+		event, err := events.Next()
+		if errors.Is(err, ErrStalled) {
+			c.recordError(ErrorTransport, err.Error(), "", requestID)
+			return answer.String(), usage, requestID, err
 		}
-		line = strings.TrimSpace(line)
-		if line == "data: [DONE]" {
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, context.Canceled) {
+				c.recordError(ErrorTransport, "the stream broke off: "+err.Error(), "", requestID)
+			}
 			break
 		}
-		if strings.HasPrefix(line, "data:") {
-			payload := strings.TrimPrefix(line, "data:")
+		for _, payload := range chunkPayloads(event.Data) {
+			if payload == "[DONE]" {
+				return answer.String(), usage, requestID, nil
+			}
 
 			var responseData ResponseData
 			err = json.Unmarshal([]byte(payload), &responseData)
 			if err != nil {
-				fmt.Println("Error parsing data:", err)
+				c.recordError(ErrorJSON, "failed to parse a stream chunk: "+err.Error(), payload, requestID)
 				continue
 			}
 
@@ -160,24 +662,47 @@ func (c *LLMClient) processStream(resp *http.Response) (string, struct {
 				usage.PromptTokens = responseData.Usage.PromptTokens
 				usage.CompletionTokens = responseData.Usage.CompletionTokens
 				usage.TotalTokens = responseData.Usage.TotalTokens
+				handler.OnUsage(usage.PromptTokens, usage.CompletionTokens)
 			}
 
 			if len(responseData.Choices) == 0 {
 				continue
 			}
-			content := responseData.Choices[0].Delta.Content
-			if counter < 2 && strings.Count(content, "\n") > 0 {
+			delta := responseData.Choices[0].Delta
+			for _, call := range delta.ToolCalls {
+				calls.add(call.Index, call.ID, call.Function.Name, call.Function.Arguments)
+			}
+			fieldReasoning.WriteString(delta.ReasoningContent + delta.Reasoning)
+			text, thinking := think.add(delta.Content)
+			c.setReasoning(joinReasoning(fieldReasoning.String(), thinking))
+			if text == "" {
 				continue
 			}
-			totalData += content
-			c.StreamCallback(totalData, nil)
-			counter++
+			answer.WriteString(text)
+			handler.OnToken(text)
 		}
 	}
-	return totalData, usage, requestID, nil
+	return answer.String(), usage, requestID, nil
 }
 
-func (c *LLMClient) callStream(payload Payload) (Message, struct {
+// chunkPayloads returns the JSON chunks in an event's data. Multi-line data
+// is one chunk by the spec, but some providers pack several chunks into one
+// event, one per data line.
+func chunkPayloads(data string) []string {
+	data = strings.TrimSpace(data)
+	if !strings.Contains(data, "\n") || json.Valid([]byte(data)) {
+		return []string{data}
+	}
+	var payloads []string
+	for _, line := range strings.Split(data, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			payloads = append(payloads, line)
+		}
+	}
+	return payloads
+}
+
+func (c *LLMClient) callStream(ctx context.Context, payload Payload) (Message, struct {
 	PromptTokens     int
 	CompletionTokens int
 	TotalTokens      int
@@ -187,20 +712,213 @@ func (c *LLMClient) callStream(payload Payload) (Message, struct {
 		CompletionTokens int
 		TotalTokens      int
 	}
-
-	req, err := c.createRequest(payload)
+	_, create := tracing.Start(ctx, "create request")
+	payload, err := c.preRequest(payload)
+	create.RecordError(err)
+	create.End()
 	if err != nil {
-		return Message{}, emptyUsage, "", fmt.Errorf("failed to create the request: %w", err)
+		return Message{}, emptyUsage, "", err
+	}
+	if c.config.Hooks != nil && c.config.Hooks.PostResponse != "" {
+		// Show the answer only once the hook has rewritten it, since it may
+		// remove what shouldn't be seen
+		defer c.hideTokens()()
 	}
-	resp, err := c.httpClient.Do(req)
+	finish := c.primeAnswer(&payload)
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	restoreStop := c.stopAtCode(stop)
+	ctx, stream := tracing.Start(ctx, "stream")
+	restore := c.traceFirstToken(stream)
+	message, usage, requestID, err := c.callChatStream(ctx, c.normalize(payload))
+	restore()
+	restoreStop()
+	finish(&message)
+	if c.stoppedEarly {
+		if end := util.FirstCodeBlockEnd(message.Content); end >= 0 {
+			message.Content = message.Content[:end]
+		}
+	}
+	stream.RecordError(err)
+	stream.End()
+	if err == nil {
+		message.Content, err = c.postResponse(message.Content)
+	}
+	return message, usage, requestID, err
+}
+
+func (c *LLMClient) callChatStream(ctx context.Context, payload Payload) (Message, struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}, string, error) {
+	var emptyUsage struct {
+		PromptTokens     int
+		CompletionTokens int
+		TotalTokens      int
+	}
+	if c.usesResponses() {
+		return c.callResponsesStream(ctx, payload)
+	}
+
+	resp, err := c.send(ctx, payload)
 	if err != nil {
-		return Message{}, emptyUsage, "", fmt.Errorf("failed to make the API request: %w", err)
+		return Message{}, emptyUsage, "", err
 	}
-	defer resp.Body.Close()
+	defer transport.Release(resp.Body)
 
 	if resp.StatusCode != 200 {
-		return Message{}, emptyUsage, "", fmt.Errorf("API request failed: %s", resp.Status)
+		return Message{}, emptyUsage, "", c.failedResponse(resp)
 	}
 	content, usage, requestID, err := c.processStream(resp)
-	return Message{Role: "assistant", Content: content}, usage, requestID, err
+	message := Message{Role: "assistant", Content: content}
+	if len(c.Tools) > 0 {
+		message.ToolCalls = messageToolCalls(c.calls)
+	}
+	return message, usage, requestID, err
+}
+
+// callCompletion makes a non-streaming chat completion request
+func (c *LLMClient) callCompletion(payload Payload) (Message, struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}, string, error) {
+	var usage struct {
+		PromptTokens     int
+		CompletionTokens int
+		TotalTokens      int
+	}
+	// Outside a query, such as for a summary, the request is traced on its own
+	_, span := tracing.Start(c.traceContext(), "chat "+payload.Model)
+	defer span.End()
+	span.SetAttribute("gen_ai.operation.name", "chat")
+	span.SetAttribute("gen_ai.system", c.system())
+	span.SetAttribute("gen_ai.request.model", payload.Model)
+	payload, err := c.preRequest(payload)
+	if err != nil {
+		span.RecordError(err)
+		return Message{}, usage, "", err
+	}
+	message, usage, requestID, err := c.callChat(c.normalize(payload))
+	span.SetAttribute("gen_ai.usage.input_tokens", usage.PromptTokens)
+	span.SetAttribute("gen_ai.usage.output_tokens", usage.CompletionTokens)
+	span.RecordError(err)
+	if err == nil {
+		message.Content, err = c.postResponse(message.Content)
+	}
+	return message, usage, requestID, err
+}
+
+func (c *LLMClient) callChat(payload Payload) (Message, struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}, string, error) {
+	if c.usesResponses() {
+		return c.callResponses(payload)
+	}
+	messages, reasonings, usage, requestID, err := c.callChoices(payload)
+	if err != nil {
+		return Message{}, usage, requestID, err
+	}
+	c.reasoning = reasonings[0]
+	return messages[0], usage, requestID, nil
+}
+
+// callChoices makes a non-streaming chat completion request, returning the
+// answer of each of its choices with its reasoning
+func (c *LLMClient) callChoices(payload Payload) ([]Message, []string, struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}, string, error) {
+	var usage struct {
+		PromptTokens     int
+		CompletionTokens int
+		TotalTokens      int
+	}
+	resp, err := c.send(context.Background(), payload)
+	if err != nil {
+		return nil, nil, usage, "", err
+	}
+	defer transport.Release(resp.Body)
+
+	if resp.StatusCode != 200 {
+		return nil, nil, usage, "", c.failedResponse(resp)
+	}
+	var body io.Reader = resp.Body
+	if c.Debug {
+		body = io.TeeReader(resp.Body, &c.rawResponse)
+	}
+	var completion CompletionResponse
+	if err := json.NewDecoder(body).Decode(&completion); err != nil {
+		c.recordError(ErrorJSON, "failed to parse the response: "+err.Error(), "", "")
+		return nil, nil, usage, "", fmt.Errorf("failed to parse the response: %w", err)
+	}
+	usage.PromptTokens = completion.Usage.PromptTokens
+	usage.CompletionTokens = completion.Usage.CompletionTokens
+	usage.TotalTokens = completion.Usage.TotalTokens
+	if len(completion.Choices) == 0 {
+		return nil, nil, usage, completion.ID, fmt.Errorf("the response contained no choices")
+	}
+	var messages []Message
+	var reasonings []string
+	for _, choice := range completion.Choices {
+		message, reasoning := choiceMessage(choice.Message)
+		messages = append(messages, message)
+		reasonings = append(reasonings, reasoning)
+	}
+	return messages, reasonings, usage, completion.ID, nil
+}
+
+// choiceMessage is the answer of a completion's choice, with its reasoning
+// split off
+func choiceMessage(message CompletionMessage) (Message, string) {
+	answer, thinking := splitThinking(message.Content)
+	return Message{Role: message.Role, Content: answer}, joinReasoning(message.ReasoningContent+message.Reasoning, thinking)
+}
+
+// preRequest passes the payload's messages through the model's pre_request hook, if any
+func (c *LLMClient) preRequest(payload Payload) (Payload, error) {
+	if c.config.Hooks == nil {
+		return payload, nil
+	}
+	messages, err := hooks.Request(util.ExpandHome(c.config.Hooks.PreRequest), payload.Model, payload.Messages)
+	if err != nil {
+		return payload, err
+	}
+	payload.Messages = messages
+	return payload, nil
+}
+
+// postResponse passes an answer through the model's post_response hook, if any
+func (c *LLMClient) postResponse(response string) (string, error) {
+	if c.config.Hooks == nil {
+		return response, nil
+	}
+	return hooks.Response(util.ExpandHome(c.config.Hooks.PostResponse), c.config.ModelName, response)
+}
+
+// normalize adapts the payload's messages to the model's role conventions
+func (c *LLMClient) normalize(payload Payload) Payload {
+	var rules MessageRules
+	if c.config.Messages != nil {
+		rules = *c.config.Messages
+	}
+	payload.System, payload.Messages = provider.Normalize(rules, payload.Messages)
+	return payload
+}
+
+// failedResponse records an error status with the start of its body, which
+// usually explains it, keeps the whole body for the debug log, and returns
+// the error to report
+func (c *LLMClient) failedResponse(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if c.Debug {
+		fmt.Fprintf(&c.rawResponse, "HTTP %s\n", resp.Status)
+		c.rawResponse.Write(body)
+	}
+	c.recordError(ErrorHTTP, resp.Status, string(body), resp.Header.Get("X-Request-Id"))
+	return newAPIError(resp, body, false)
 }
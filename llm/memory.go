@@ -0,0 +1,36 @@
+package llm
+
+import (
+	. "q/types"
+)
+
+// applyMemory adds the remembered facts in Memory to a request, after its
+// system prompt. Models with system_prompt sections get them from the memory
+// section instead.
+func (c *LLMClient) applyMemory(payload *Payload) {
+	if c.Memory == "" || len(c.config.SystemPrompt) > 0 {
+		return
+	}
+	addSystem(payload, c.Memory)
+}
+
+// applyPackageManager adds the PackageManager instruction to a request,
+// after its system prompt. Models with system_prompt sections get it from
+// the environment section instead.
+func (c *LLMClient) applyPackageManager(payload *Payload) {
+	if c.PackageManager == "" || len(c.config.SystemPrompt) > 0 {
+		return
+	}
+	addSystem(payload, c.PackageManager)
+}
+
+// addSystem adds a system message to a request, after the ones it starts with
+func addSystem(payload *Payload, content string) {
+	at := 0
+	for at < len(payload.Messages) && payload.Messages[at].Role == "system" {
+		at++
+	}
+	messages := append([]Message(nil), payload.Messages[:at]...)
+	messages = append(messages, Message{Role: "system", Content: content})
+	payload.Messages = append(messages, payload.Messages[at:]...)
+}
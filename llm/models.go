@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"q/exitcode"
+	"q/transport"
+)
+
+// ListModels returns the IDs of the models the endpoint offers for the key,
+// sorted, from its OpenAI-style /models list, giving up after timeout
+func (c *LLMClient) ListModels(timeout time.Duration) ([]string, error) {
+	base, err := c.apiBaseURL()
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newAPIRequest("GET", base+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	c.httpClient.Timeout = timeout
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.recordError(ErrorTransport, err.Error(), "", "")
+		return nil, exitcode.Wrap(exitcode.Provider, fmt.Errorf("failed to make the API request: %w", err))
+	}
+	defer transport.Release(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.failedResponse(resp)
+	}
+
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		c.recordError(ErrorJSON, "failed to parse the response: "+err.Error(), "", resp.Header.Get("X-Request-Id"))
+		return nil, fmt.Errorf("failed to parse the response: %w", err)
+	}
+	ids := make([]string, 0, len(result.Data))
+	for _, model := range result.Data {
+		if model.ID != "" {
+			ids = append(ids, model.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
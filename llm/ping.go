@@ -0,0 +1,26 @@
+package llm
+
+import (
+	"time"
+
+	"q/logger"
+	. "q/types"
+)
+
+// Ping sends the model a tiny request to check that its endpoint, key and
+// name all work, giving up after timeout. The request is logged like any
+// other, since it costs a few tokens.
+func (c *LLMClient) Ping(timeout time.Duration) (time.Duration, error) {
+	c.httpClient.Timeout = timeout
+	request := []Message{{Role: "user", Content: "Reply with the single word: ok"}}
+	startTime := time.Now()
+	message, usage, requestID, err := c.callCompletion(Payload{
+		Model:    c.config.ModelName,
+		Messages: request,
+	})
+	elapsed := time.Since(startTime)
+	entry := logger.CreateLogEntry(c.config.ModelName, request, message.Content, usage, requestID, elapsed.Milliseconds(), err)
+	entry.ContextNote = "connection check"
+	c.writeLog(entry)
+	return elapsed, err
+}
@@ -0,0 +1,187 @@
+package llm
+
+import (
+	"sync"
+
+	. "q/types"
+)
+
+// race is a query sent to several models at once. The first to stream any of
+// its answer or reasoning wins: it's shown, and the others are interrupted.
+type race struct {
+	mu      sync.Mutex
+	clients []*LLMClient
+	winner  *LLMClient
+}
+
+// claim makes c the winner if there's none yet, interrupting the others, and
+// reports whether c is the winner
+func (r *race) claim(c *LLMClient) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.winner == nil {
+		r.winner = c
+		for _, other := range r.clients {
+			if other != c {
+				other.stop()
+			}
+		}
+	}
+	return r.winner == c
+}
+
+// won reports whether c is the winner
+func (r *race) won(c *LLMClient) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.winner == c
+}
+
+// lostTo is the model c lost the race to, or "" if it won. A client that
+// ends without error before any other answers, as with an empty answer, wins
+// if canWin is set.
+func (r *race) lostTo(c *LLMClient, canWin bool) string {
+	if canWin && r.claim(c) {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.winner == nil || r.winner == c {
+		return ""
+	}
+	return r.winner.config.ModelName
+}
+
+// raceHandler passes a racing client's stream on to the session's handler
+// once the client has won, and interrupts it once it has lost
+type raceHandler struct {
+	race   *race
+	client *LLMClient
+	next   StreamHandler
+}
+
+func (h raceHandler) OnToken(text string) {
+	if h.race.claim(h.client) {
+		h.next.OnToken(text)
+	} else {
+		// It was still connecting when the race was won
+		h.client.stop()
+	}
+}
+
+func (h raceHandler) OnUsage(inputTokens, outputTokens int) {
+	if h.race.won(h.client) {
+		h.next.OnUsage(inputTokens, outputTokens)
+	}
+}
+
+func (h raceHandler) OnToolCall(call ToolCall) {
+	if h.race.won(h.client) {
+		h.next.OnToolCall(call)
+	}
+}
+
+// OnDone and OnError aren't called for racing clients: Query tells the
+// session's handler how the race ended
+func (h raceHandler) OnDone(answer string) {}
+
+func (h raceHandler) OnError(err error) {}
+
+// race sends query to this client's model and the rivals' at once, and
+// returns the winner's answer. If the winner is a rival, the client carries
+// on with its model and conversation, so follow-ups go to the model that won.
+// Every attempt is logged; the losers' as interrupted, and outside the
+// conversation. If none answers, the client's own error is returned.
+func (c *LLMClient) race(query string, rivals []ModelConfig) (string, error) {
+	clients := []*LLMClient{c}
+	for _, config := range rivals {
+		clients = append(clients, c.clone(config))
+	}
+	r := &race{clients: clients}
+	handler, thinking := c.StreamHandler, c.ThinkingCallback
+	next := c.handler()
+	for _, client := range clients {
+		client := client
+		client.racing = r
+		client.StreamHandler = raceHandler{race: r, client: client, next: next}
+		client.ThinkingCallback = func(reasoning string) {
+			if !r.claim(client) {
+				client.stop()
+			} else if thinking != nil {
+				thinking(reasoning)
+			}
+		}
+	}
+	c.mu.Lock()
+	c.rivals = clients[1:]
+	c.mu.Unlock()
+
+	answers := make([]string, len(clients))
+	errs := make([]error, len(clients))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client *LLMClient) {
+			defer wg.Done()
+			answers[i], errs[i] = client.ask(query)
+		}(i, client)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	c.rivals = nil
+	c.mu.Unlock()
+	c.racing = nil
+	c.StreamHandler, c.ThinkingCallback = handler, thinking
+	winner := 0
+	for i, client := range clients {
+		if client == r.winner {
+			winner = i
+		}
+	}
+	if winner > 0 {
+		c.adopt(clients[winner])
+	}
+	return answers[winner], errs[winner]
+}
+
+// clone is a client for config with this client's settings and
+// conversation, to race it or to sample answers alongside it
+func (c *LLMClient) clone(config ModelConfig) *LLMClient {
+	r := NewLLMClient(config)
+	// Context pinned after the configured prompt, like --url pages, goes too
+	r.Pin(c.messages[len(Prompt(c.config)):c.pinned]...)
+	r.AppendHistory(c.messages[c.pinned:]...)
+	r.OutputPath = c.OutputPath
+	r.Persona = c.Persona
+	r.Temperature = c.Temperature
+	r.RegeneratedFrom = c.RegeneratedFrom
+	r.Debug = c.Debug
+	r.Requires = c.Requires
+	r.ConversationID = c.ConversationID
+	r.ConversationVersion = c.ConversationVersion
+	r.ConversationHead = c.ConversationHead
+	r.parentHead = c.parentHead
+	r.Sources = c.Sources
+	r.URLs = c.URLs
+	r.ErrorLog = c.ErrorLog
+	r.Prefill = c.Prefill
+	r.Memory = c.Memory
+	r.PackageManager = c.PackageManager
+	r.Language = c.Language
+	r.Length = c.Length
+	r.StopAtCode = c.StopAtCode
+	r.SampleGroup = c.SampleGroup
+	r.Tools = c.Tools
+	return r
+}
+
+// adopt carries on with the model and conversation of a rival that won
+func (c *LLMClient) adopt(winner *LLMClient) {
+	c.config, c.baseConfig = winner.config, winner.baseConfig
+	c.messages, c.pinned, c.keyIndex = winner.messages, winner.pinned, winner.keyIndex
+	c.ConversationID = winner.ConversationID
+	c.ConversationVersion = winner.ConversationVersion
+	c.ConversationHead, c.parentHead = winner.ConversationHead, winner.parentHead
+	c.lastEntry = winner.lastEntry
+}
@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "q/types"
+)
+
+// raceServer streams each model's deltas, waiting delay before each, or
+// fails with the model's status
+type raceServer struct {
+	deltas map[string][]map[string]string
+	delay  map[string]time.Duration
+	status map[string]int
+}
+
+func (s raceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload struct{ Model string }
+	json.NewDecoder(r.Body).Decode(&payload)
+	if status, ok := s.status[payload.Model]; ok {
+		w.WriteHeader(status)
+		return
+	}
+	id := fmt.Sprintf("req-%d", time.Now().UnixNano())
+	deltas := s.deltas[payload.Model]
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, delta := range deltas {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(s.delay[payload.Model]):
+		}
+		chunk, _ := json.Marshal(map[string]interface{}{
+			"id":      id,
+			"choices": []interface{}{map[string]interface{}{"delta": delta}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", chunk)
+		w.(http.Flusher).Flush()
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func raceModels(url string, names ...string) []ModelConfig {
+	var models []ModelConfig
+	for _, name := range names {
+		models = append(models, ModelConfig{ModelName: name, Endpoint: url + "/v1/chat/completions", Auth: "test"})
+	}
+	return models
+}
+
+func TestRace(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(raceServer{
+		deltas: map[string][]map[string]string{
+			"fast":    {{"content": "ls"}, {"content": " -la"}},
+			"slow":    {{"content": "find"}, {"content": " ."}},
+			"thinker": {{"reasoning_content": "hmm"}, {"content": "du"}, {"content": " -sh"}},
+		},
+		delay:  map[string]time.Duration{"fast": 0, "slow": 500 * time.Millisecond, "thinker": 50 * time.Millisecond},
+		status: map[string]int{"down": http.StatusBadRequest, "broken": http.StatusNotFound},
+	})
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		models     []string
+		wantModel  string
+		wantAnswer string
+		wantErr    string
+	}{
+		{"won by a token", []string{"slow", "fast"}, "fast", "ls -la", ""},
+		{"won by the session's model", []string{"fast", "slow"}, "fast", "ls -la", ""},
+		{"won by reasoning", []string{"slow", "thinker"}, "thinker", "du -sh", ""},
+		{"a rival failing", []string{"down", "fast"}, "fast", "ls -la", ""},
+		{"all failing", []string{"down", "broken"}, "down", "", "400"},
+	}
+	for _, tt := range tests {
+		models := raceModels(server.URL, tt.models...)
+		c := NewLLMClient(models[0])
+		c.Rivals = models[1:]
+		var shown strings.Builder
+		var mu sync.Mutex
+		c.StreamHandler = StreamFuncs{Token: func(text string) {
+			mu.Lock()
+			defer mu.Unlock()
+			shown.WriteString(text)
+		}}
+		start := time.Now()
+		answer, err := c.Query("list files")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got %q, %v; want the error %q", tt.name, answer, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || answer != tt.wantAnswer || shown.String() != tt.wantAnswer {
+			t.Errorf("%s: got %q (shown %q), %v; want %q", tt.name, answer, shown.String(), err, tt.wantAnswer)
+		}
+		if c.Model() != tt.wantModel {
+			t.Errorf("%s: the client carries on with %s, want %s", tt.name, c.Model(), tt.wantModel)
+		}
+		// The slow loser is interrupted rather than waited for
+		if took := time.Since(start); took > 400*time.Millisecond {
+			t.Errorf("%s: took %s, so the loser wasn't stopped", tt.name, took)
+		}
+	}
+}
+
+func TestRaceHandlerStopsALateLoser(t *testing.T) {
+	winner, loser := &LLMClient{config: ModelConfig{ModelName: "fast"}}, &LLMClient{}
+	r := &race{clients: []*LLMClient{winner, loser}}
+	var shown []string
+	next := StreamFuncs{Token: func(text string) { shown = append(shown, text) }}
+	winnerHandler := raceHandler{race: r, client: winner, next: next}
+	loserHandler := raceHandler{race: r, client: loser, next: next}
+
+	winnerHandler.OnToken("ls")
+	// The loser was still connecting when the race was won, so only now
+	// has something to stop
+	stopped := false
+	loser.cancel = func() { stopped = true }
+	loserHandler.OnToken("find")
+	winnerHandler.OnToken(" -la")
+
+	if strings.Join(shown, "") != "ls -la" {
+		t.Errorf("shown %q, want only the winner's tokens", shown)
+	}
+	if !stopped || !loser.interrupted {
+		t.Error("the loser's first token should stop it")
+	}
+	if got := r.lostTo(loser, true); got != "fast" {
+		t.Errorf("lostTo(loser) = %q, want fast", got)
+	}
+	if got := r.lostTo(winner, true); got != "" {
+		t.Errorf("lostTo(winner) = %q, want \"\"", got)
+	}
+}
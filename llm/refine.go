@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"q/logger"
+	. "q/types"
+	"q/util"
+)
+
+// Attempt is one answer tried by Refine and what its check said
+type Attempt struct {
+	Answer string
+	// Feedback is what failed, empty if the answer passed
+	Feedback string
+}
+
+// Refine asks for an answer to request and checks it, sending the check's
+// feedback back to the model until an answer passes or tries run out. The
+// answer is the first code block of the reply, or the whole reply if it has
+// none. check returns "" for an answer that passes, and an error only when it
+// can't check at all. Every request is logged, noted with note and the try.
+func (c *LLMClient) Refine(system, request string, tries int, note string, check func(answer string) (string, error)) ([]Attempt, error) {
+	messages := []Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: request},
+	}
+	var attempts []Attempt
+	for try := 1; try <= tries; try++ {
+		startTime := time.Now()
+		message, usage, requestID, err := c.callCompletion(Payload{
+			Model:       c.config.ModelName,
+			Messages:    messages,
+			Temperature: c.Temperature,
+		})
+		entry := logger.CreateLogEntry(c.config.ModelName, messages, message.Content, usage, requestID, time.Since(startTime).Milliseconds(), err)
+		entry.ContextNote = fmt.Sprintf("%s: try %d/%d", note, try, tries)
+		c.writeLog(entry)
+		if err != nil {
+			return attempts, err
+		}
+
+		answer := strings.TrimSpace(message.Content)
+		if code, _ := util.ExtractFirstCodeBlock(answer); code != "" {
+			answer = strings.TrimSpace(code)
+		}
+		feedback, err := check(answer)
+		if err != nil {
+			return attempts, err
+		}
+		attempts = append(attempts, Attempt{Answer: answer, Feedback: feedback})
+		if feedback == "" {
+			break
+		}
+		messages = append(messages,
+			Message{Role: "assistant", Content: message.Content},
+			Message{Role: "user", Content: feedback + "\n\nFix it and reply with the corrected version only."})
+	}
+	return attempts, nil
+}
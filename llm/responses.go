@@ -0,0 +1,210 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"q/sse"
+	"q/transport"
+	. "q/types"
+)
+
+// Request formats a model can be called with (ModelConfig.API)
+const (
+	APIChat      = "chat"
+	APIResponses = "responses"
+)
+
+// tokenUsage is the usage returned alongside each answer
+type tokenUsage = struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// usesResponses reports whether the model is called through the Responses API
+func (c *LLMClient) usesResponses() bool {
+	return c.config.API == APIResponses
+}
+
+// requestURL is where requests are sent. For the Responses API, a Chat
+// Completions endpoint is swapped for the Responses endpoint next to it, so
+// switching a model over only takes `api: responses`.
+func (c *LLMClient) requestURL() string {
+	if c.usesResponses() && strings.HasSuffix(c.config.Endpoint, "/chat/completions") {
+		return strings.TrimSuffix(c.config.Endpoint, "/chat/completions") + "/responses"
+	}
+	return c.config.Endpoint
+}
+
+// responsesPayload maps a chat payload onto a Responses API request, with
+// each message as an input item
+func (c *LLMClient) responsesPayload(payload Payload) ResponsesPayload {
+	request := ResponsesPayload{
+		Model:           payload.Model,
+		Instructions:    payload.System,
+		Temperature:     payload.Temperature,
+		MaxOutputTokens: payload.MaxTokens,
+		Stream:          payload.Stream,
+	}
+	for _, msg := range payload.Messages {
+		request.Input = append(request.Input, ResponsesInputItem{Type: "message", Role: msg.Role, Content: msg.Content})
+	}
+	if c.config.ReasoningSummary != "" {
+		request.Reasoning = &ResponsesReasoning{Summary: c.config.ReasoningSummary}
+	}
+	return request
+}
+
+// responseText collects the answer text and the reasoning summary from a
+// response's output items
+func responseText(response ResponsesResponse) (text, reasoning string) {
+	var textParts, summaries []string
+	for _, item := range response.Output {
+		switch item.Type {
+		case "message":
+			for _, part := range item.Content {
+				if part.Type == "output_text" {
+					textParts = append(textParts, part.Text)
+				}
+			}
+		case "reasoning":
+			for _, part := range item.Summary {
+				summaries = append(summaries, part.Text)
+			}
+		}
+	}
+	return strings.Join(textParts, ""), strings.Join(summaries, "\n\n")
+}
+
+// responseError describes why a response failed
+func responseError(response ResponsesResponse) error {
+	if response.Error != nil && response.Error.Message != "" {
+		return fmt.Errorf("the response failed: %s", response.Error.Message)
+	}
+	return fmt.Errorf("the response %s", response.Status)
+}
+
+func usageOf(response ResponsesResponse) tokenUsage {
+	return tokenUsage{
+		PromptTokens:     response.Usage.InputTokens,
+		CompletionTokens: response.Usage.OutputTokens,
+		TotalTokens:      response.Usage.TotalTokens,
+	}
+}
+
+// callResponsesStream streams an answer from the Responses API
+func (c *LLMClient) callResponsesStream(ctx context.Context, payload Payload) (Message, tokenUsage, string, error) {
+	var usage tokenUsage
+	c.reasoning = ""
+	resp, err := c.send(ctx, c.responsesPayload(payload))
+	if err != nil {
+		return Message{}, usage, "", err
+	}
+	defer transport.Release(resp.Body)
+	if resp.StatusCode != 200 {
+		return Message{}, usage, "", c.failedResponse(resp)
+	}
+
+	body := c.watchStall(resp.Body)
+	if c.Debug {
+		body = io.TeeReader(body, &c.rawResponse)
+	}
+	var requestID string
+	events := sse.NewReader(body)
+	events.Unknown = func(line string) {
+		c.recordError(ErrorSSE, "unexpected line in the stream", line, requestID)
+	}
+
+	handler := c.handler()
+	var text, reasoning strings.Builder
+	for {
+		event, err := events.Next()
+		if errors.Is(err, ErrStalled) {
+			c.recordError(ErrorTransport, err.Error(), "", requestID)
+			c.reasoning = reasoning.String()
+			return Message{Role: "assistant", Content: text.String()}, usage, requestID, err
+		}
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, context.Canceled) {
+				c.recordError(ErrorTransport, "the stream broke off: "+err.Error(), "", requestID)
+			}
+			break
+		}
+		var data ResponsesEvent
+		if err := json.Unmarshal([]byte(event.Data), &data); err != nil {
+			c.recordError(ErrorJSON, "failed to parse a stream event: "+err.Error(), event.Data, requestID)
+			continue
+		}
+		if data.Type == "" {
+			data.Type = event.Type
+		}
+
+		switch data.Type {
+		case "response.created":
+			requestID = data.Response.ID
+		case "response.output_text.delta":
+			text.WriteString(data.Delta)
+			handler.OnToken(data.Delta)
+		case "response.reasoning_summary_part.added":
+			if reasoning.Len() > 0 {
+				reasoning.WriteString("\n\n")
+			}
+		case "response.reasoning_summary_text.delta":
+			reasoning.WriteString(data.Delta)
+			c.setReasoning(reasoning.String())
+		case "response.output_item.done":
+			if data.Item.Type == "function_call" {
+				handler.OnToolCall(ToolCall{ID: data.Item.CallID, Name: data.Item.Name, Arguments: data.Item.Arguments})
+			}
+		case "response.completed", "response.incomplete":
+			requestID = data.Response.ID
+			usage = usageOf(data.Response)
+			handler.OnUsage(usage.PromptTokens, usage.CompletionTokens)
+		case "response.failed":
+			c.reasoning = reasoning.String()
+			return Message{Role: "assistant", Content: text.String()}, usageOf(data.Response), data.Response.ID, responseError(data.Response)
+		case "error":
+			c.reasoning = reasoning.String()
+			return Message{Role: "assistant", Content: text.String()}, usage, requestID, fmt.Errorf("the API reported an error: %s", data.Message)
+		}
+	}
+	c.reasoning = reasoning.String()
+	return Message{Role: "assistant", Content: text.String()}, usage, requestID, nil
+}
+
+// callResponses makes a non-streaming Responses API request
+func (c *LLMClient) callResponses(payload Payload) (Message, tokenUsage, string, error) {
+	var usage tokenUsage
+	c.reasoning = ""
+	payload.Stream = false
+	resp, err := c.send(context.Background(), c.responsesPayload(payload))
+	if err != nil {
+		return Message{}, usage, "", err
+	}
+	defer transport.Release(resp.Body)
+	if resp.StatusCode != 200 {
+		return Message{}, usage, "", c.failedResponse(resp)
+	}
+
+	var body io.Reader = resp.Body
+	if c.Debug {
+		body = io.TeeReader(resp.Body, &c.rawResponse)
+	}
+	var response ResponsesResponse
+	if err := json.NewDecoder(body).Decode(&response); err != nil {
+		c.recordError(ErrorJSON, "failed to parse the response: "+err.Error(), "", "")
+		return Message{}, usage, "", fmt.Errorf("failed to parse the response: %w", err)
+	}
+	usage = usageOf(response)
+	if response.Status == "failed" {
+		return Message{}, usage, response.ID, responseError(response)
+	}
+	text, reasoning := responseText(response)
+	c.reasoning = reasoning
+	return Message{Role: "assistant", Content: text}, usage, response.ID, nil
+}
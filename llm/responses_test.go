@@ -0,0 +1,241 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "q/types"
+)
+
+func TestResponsesPayload(t *testing.T) {
+	payload := Payload{
+		Model:       "o4-mini",
+		System:      "Be terse.",
+		Messages:    []Message{{Role: "user", Content: "list files"}, {Role: "assistant", Content: "ls"}, {Role: "user", Content: "with sizes"}},
+		Temperature: 0.5,
+		MaxTokens:   200,
+		Stream:      true,
+	}
+	c := &LLMClient{config: ModelConfig{API: APIResponses, Endpoint: "https://api.openai.com/v1/chat/completions", ReasoningSummary: "auto"}}
+	request := c.responsesPayload(payload)
+	if request.Model != "o4-mini" || request.Instructions != "Be terse." || request.Temperature != 0.5 ||
+		request.MaxOutputTokens != 200 || !request.Stream || request.Store {
+		t.Errorf("got %+v", request)
+	}
+	if len(request.Input) != 3 || request.Input[2] != (ResponsesInputItem{Type: "message", Role: "user", Content: "with sizes"}) {
+		t.Errorf("got the input %+v, want each message as an item", request.Input)
+	}
+	if request.Reasoning == nil || request.Reasoning.Summary != "auto" {
+		t.Errorf("got the reasoning %+v, want the summary asked for", request.Reasoning)
+	}
+	if url := c.requestURL(); url != "https://api.openai.com/v1/responses" {
+		t.Errorf("requestURL() = %q, want the Responses endpoint", url)
+	}
+
+	c.config.ReasoningSummary = ""
+	if request := c.responsesPayload(payload); request.Reasoning != nil {
+		t.Errorf("got the reasoning %+v without a summary asked for", request.Reasoning)
+	}
+}
+
+func TestResponseParts(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantText      string
+		wantReasoning string
+		wantErr       string
+		wantUsage     tokenUsage
+	}{
+		{
+			name: "text and reasoning",
+			body: `{"id":"resp_1","status":"completed","output":[
+				{"type":"reasoning","summary":[{"type":"summary_text","text":"Listing."},{"type":"summary_text","text":"With sizes."}]},
+				{"type":"message","content":[{"type":"output_text","text":"ls "},{"type":"refusal","text":"no"},{"type":"output_text","text":"-la"}]}],
+				"usage":{"input_tokens":12,"output_tokens":30,"total_tokens":42}}`,
+			wantText:      "ls -la",
+			wantReasoning: "Listing.\n\nWith sizes.",
+			wantErr:       "the response completed",
+			wantUsage:     tokenUsage{PromptTokens: 12, CompletionTokens: 30, TotalTokens: 42},
+		},
+		{
+			name:      "failed with an error",
+			body:      `{"id":"resp_2","status":"failed","error":{"code":"server_error","message":"The model crashed"},"usage":{"input_tokens":12}}`,
+			wantErr:   "the response failed: The model crashed",
+			wantUsage: tokenUsage{PromptTokens: 12},
+		},
+		{
+			name:     "incomplete",
+			body:     `{"id":"resp_3","status":"incomplete","output":[{"type":"message","content":[{"type":"output_text","text":"ls"}]}]}`,
+			wantText: "ls",
+			wantErr:  "the response incomplete",
+		},
+	}
+	for _, tt := range tests {
+		var response ResponsesResponse
+		if err := json.Unmarshal([]byte(tt.body), &response); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if text, reasoning := responseText(response); text != tt.wantText || reasoning != tt.wantReasoning {
+			t.Errorf("%s: responseText = %q, %q; want %q, %q", tt.name, text, reasoning, tt.wantText, tt.wantReasoning)
+		}
+		if err := responseError(response); err.Error() != tt.wantErr {
+			t.Errorf("%s: responseError = %q, want %q", tt.name, err, tt.wantErr)
+		}
+		if usage := usageOf(response); usage != tt.wantUsage {
+			t.Errorf("%s: usageOf = %+v, want %+v", tt.name, usage, tt.wantUsage)
+		}
+	}
+}
+
+// responsesEvents is the event stream of a response, each event named by
+// its type as the Responses API sends them
+func responsesEvents(events ...string) string {
+	var body strings.Builder
+	for _, event := range events {
+		var data struct{ Type string }
+		json.Unmarshal([]byte(event), &data)
+		fmt.Fprintf(&body, "event: %s\ndata: %s\n\n", data.Type, event)
+	}
+	return body.String()
+}
+
+func TestCallResponses(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	completed := `{"type":"response.completed","response":{"id":"resp_1","status":"completed","usage":{"input_tokens":12,"output_tokens":30,"total_tokens":42}}}`
+	tests := []struct {
+		name   string
+		stream bool
+		status int
+		body   string
+		// want* are the answer, reasoning, request ID and usage returned, and
+		// the tokens shown
+		wantText      string
+		wantReasoning string
+		wantID        string
+		wantUsage     tokenUsage
+		wantShown     string
+		wantErr       string
+	}{
+		{
+			name:   "streamed",
+			stream: true,
+			body: responsesEvents(
+				`{"type":"response.created","response":{"id":"resp_1","status":"in_progress"}}`,
+				`{"type":"response.reasoning_summary_part.added"}`,
+				`{"type":"response.reasoning_summary_text.delta","delta":"Listing"}`,
+				`{"type":"response.reasoning_summary_text.delta","delta":" files."}`,
+				`{"type":"response.reasoning_summary_part.added"}`,
+				`{"type":"response.reasoning_summary_text.delta","delta":"With sizes."}`,
+				`{"type":"response.output_text.delta","delta":"ls "}`,
+				`{"type":"response.output_text.delta","delta":"-la"}`,
+				completed),
+			wantText:      "ls -la",
+			wantReasoning: "Listing files.\n\nWith sizes.",
+			wantID:        "resp_1",
+			wantUsage:     tokenUsage{PromptTokens: 12, CompletionTokens: 30, TotalTokens: 42},
+			wantShown:     "ls -la",
+		},
+		{
+			name:   "streamed and failed",
+			stream: true,
+			body: responsesEvents(
+				`{"type":"response.created","response":{"id":"resp_2","status":"in_progress"}}`,
+				`{"type":"response.output_text.delta","delta":"ls"}`,
+				`{"type":"response.failed","response":{"id":"resp_2","status":"failed","error":{"code":"server_error","message":"The model crashed"},"usage":{"input_tokens":12}}}`),
+			wantText:  "ls",
+			wantID:    "resp_2",
+			wantUsage: tokenUsage{PromptTokens: 12},
+			wantShown: "ls",
+			wantErr:   "the response failed: The model crashed",
+		},
+		{
+			name:   "streamed error event",
+			stream: true,
+			body: responsesEvents(
+				`{"type":"response.created","response":{"id":"resp_3","status":"in_progress"}}`,
+				`{"type":"error","code":"rate_limit_exceeded","message":"Slow down"}`),
+			wantID:  "resp_3",
+			wantErr: "the API reported an error: Slow down",
+		},
+		{
+			name: "whole",
+			body: `{"id":"resp_4","status":"completed","output":[
+				{"type":"reasoning","summary":[{"type":"summary_text","text":"Listing files."}]},
+				{"type":"message","content":[{"type":"output_text","text":"ls -la"}]}],
+				"usage":{"input_tokens":12,"output_tokens":30,"total_tokens":42}}`,
+			wantText:      "ls -la",
+			wantReasoning: "Listing files.",
+			wantID:        "resp_4",
+			wantUsage:     tokenUsage{PromptTokens: 12, CompletionTokens: 30, TotalTokens: 42},
+		},
+		{
+			name:      "whole and failed",
+			body:      `{"id":"resp_5","status":"failed","error":{"code":"server_error","message":"The model crashed"},"usage":{"input_tokens":12}}`,
+			wantID:    "resp_5",
+			wantUsage: tokenUsage{PromptTokens: 12},
+			wantErr:   "the response failed: The model crashed",
+		},
+		{
+			name:    "rejected",
+			status:  http.StatusBadRequest,
+			body:    `{"error":{"code":"invalid_value","message":"Unknown parameter"}}`,
+			wantErr: "400",
+		},
+	}
+	for _, tt := range tests {
+		var got ResponsesPayload
+		var path string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			json.NewDecoder(r.Body).Decode(&got)
+			if tt.status != 0 {
+				w.WriteHeader(tt.status)
+			} else if tt.stream {
+				w.Header().Set("Content-Type", "text/event-stream")
+			}
+			fmt.Fprint(w, tt.body)
+		}))
+		c := NewLLMClient(ModelConfig{ModelName: "o4-mini", Endpoint: server.URL + "/v1/chat/completions", Auth: "test", API: APIResponses})
+		var shown strings.Builder
+		var usage tokenUsage
+		c.StreamHandler = StreamFuncs{
+			Token: func(text string) { shown.WriteString(text) },
+			Usage: func(input, output int) { usage.PromptTokens, usage.CompletionTokens = input, output },
+		}
+		payload := Payload{Model: "o4-mini", Messages: []Message{{Role: "user", Content: "list files"}}, Stream: tt.stream}
+		var message Message
+		var gotUsage tokenUsage
+		var requestID string
+		var err error
+		if tt.stream {
+			message, gotUsage, requestID, err = c.callResponsesStream(context.Background(), payload)
+		} else {
+			message, gotUsage, requestID, err = c.callResponses(payload)
+		}
+		server.Close()
+
+		if path != "/v1/responses" || got.Stream != tt.stream || len(got.Input) != 1 {
+			t.Errorf("%s: sent %+v to %s", tt.name, got, path)
+		}
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: got the error %v, want %q", tt.name, err, tt.wantErr)
+		}
+		if message.Content != tt.wantText || c.reasoning != tt.wantReasoning || requestID != tt.wantID || gotUsage != tt.wantUsage {
+			t.Errorf("%s: got %q, reasoning %q, ID %q, usage %+v; want %q, %q, %q, %+v",
+				tt.name, message.Content, c.reasoning, requestID, gotUsage, tt.wantText, tt.wantReasoning, tt.wantID, tt.wantUsage)
+		}
+		if shown.String() != tt.wantShown {
+			t.Errorf("%s: shown %q, want %q", tt.name, shown.String(), tt.wantShown)
+		}
+		// Usage is passed on when the stream completes
+		if tt.stream && tt.wantErr == "" && (usage.PromptTokens != tt.wantUsage.PromptTokens || usage.CompletionTokens != tt.wantUsage.CompletionTokens) {
+			t.Errorf("%s: the handler was passed the usage %+v, want %+v", tt.name, usage, tt.wantUsage)
+		}
+	}
+}
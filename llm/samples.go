@@ -0,0 +1,147 @@
+package llm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"q/logger"
+	"q/provider"
+	"q/tracing"
+	. "q/types"
+)
+
+// sampleTemperature is the temperature answers are sampled at when none is
+// set, since at 0 they'd mostly be the same
+const sampleTemperature = 0.8
+
+// Sample is one of the answers sampled for a query
+type Sample struct {
+	Answer string
+	// Entry is the answer's log entry, with its request ID and cost
+	Entry LogEntry
+	Err   error
+}
+
+// Samples asks for n answers to query, to compare them or have a judge pick
+// the best (see Judge). Models that return several answers to one request
+// (ModelCapabilities.Samples) are sent one with n set; others, or any
+// answers missing from the reply, are requested separately, all at once.
+// Each answer is logged on its own under a new SampleGroup, and none becomes
+// a turn of the conversation. The error is the first answer's, if none came.
+func (c *LLMClient) Samples(query string, n int) ([]Sample, error) {
+	c.SampleGroup = logger.NewSampleGroupID()
+	defer func() { c.SampleGroup = "" }()
+	temperature := c.Temperature
+	if temperature == 0 {
+		c.Temperature = sampleTemperature
+		defer func() { c.Temperature = temperature }()
+	}
+
+	var samples []Sample
+	caps, _ := provider.CapabilitiesFor(c.config)
+	if caps.Samples && n > 1 && !c.usesResponses() && c.prefill() == "" && !c.StopAtCode {
+		samples = c.sampleAtOnce(query, n)
+		if len(samples) == 1 && samples[0].Err != nil {
+			return samples, samples[0].Err
+		}
+	}
+	if len(samples) < n {
+		samples = append(samples, c.sampleEach(query, n-len(samples))...)
+	}
+	for _, sample := range samples {
+		if sample.Err == nil {
+			return samples, nil
+		}
+	}
+	return samples, samples[0].Err
+}
+
+// sampleAtOnce asks for n answers in one request. Its prompt was sent once,
+// so its tokens are logged with the first answer, while the answers share
+// the completion tokens.
+func (c *LLMClient) sampleAtOnce(query string, n int) []Sample {
+	messages := append(append([]Message(nil), c.messages...), Message{Role: "user", Content: query})
+	messages, contextNote := c.fitContext(messages)
+	payload, err := c.queryPayload(messages)
+	if err != nil {
+		return []Sample{{Err: err}}
+	}
+	payload.Stream, payload.StreamOptions, payload.N = false, nil, n
+
+	start := time.Now()
+	answers, reasonings, usage, requestID, err := c.callSamples(payload)
+	durationMs := time.Since(start).Milliseconds()
+	if err != nil {
+		entry := logger.CreateLogEntry(c.config.ModelName, messages, "", usage, requestID, durationMs, err)
+		entry.ContextNote = contextNote
+		c.writeLog(entry)
+		return []Sample{{Entry: c.lastEntry, Err: err}}
+	}
+
+	samples := make([]Sample, len(answers))
+	for i, answer := range answers {
+		var share struct{ PromptTokens, CompletionTokens, TotalTokens int }
+		share.CompletionTokens = usage.CompletionTokens / len(answers)
+		id := requestID
+		if i == 0 {
+			share.PromptTokens = usage.PromptTokens
+			share.CompletionTokens += usage.CompletionTokens % len(answers)
+		} else if id != "" {
+			id = fmt.Sprintf("%s-%d", requestID, i+1)
+		}
+		share.TotalTokens = share.PromptTokens + share.CompletionTokens
+		c.reasoning = reasonings[i]
+		entry := logger.CreateLogEntry(c.config.ModelName, messages, answer.Content, share, id, durationMs, nil)
+		entry.ContextNote = contextNote
+		c.writeLog(entry)
+		samples[i] = Sample{Answer: answer.Content, Entry: c.lastEntry}
+	}
+	return samples
+}
+
+// callSamples makes the request of sampleAtOnce, passing it and its answers
+// through the model's hooks
+func (c *LLMClient) callSamples(payload Payload) ([]Message, []string, struct{ PromptTokens, CompletionTokens, TotalTokens int }, string, error) {
+	var usage struct{ PromptTokens, CompletionTokens, TotalTokens int }
+	_, span := tracing.Start(c.traceContext(), "chat "+payload.Model)
+	defer span.End()
+	span.SetAttribute("gen_ai.operation.name", "chat")
+	span.SetAttribute("gen_ai.system", c.system())
+	span.SetAttribute("gen_ai.request.model", payload.Model)
+	payload, err := c.preRequest(payload)
+	if err != nil {
+		span.RecordError(err)
+		return nil, nil, usage, "", err
+	}
+	answers, reasonings, usage, requestID, err := c.callChoices(c.normalize(payload))
+	span.SetAttribute("gen_ai.usage.input_tokens", usage.PromptTokens)
+	span.SetAttribute("gen_ai.usage.output_tokens", usage.CompletionTokens)
+	for i := range answers {
+		if err != nil {
+			break
+		}
+		answers[i].Content, err = c.postResponse(answers[i].Content)
+	}
+	span.RecordError(err)
+	return answers, reasonings, usage, requestID, err
+}
+
+// sampleEach asks for n answers in as many requests, sent at once
+func (c *LLMClient) sampleEach(query string, n int) []Sample {
+	samples := make([]Sample, n)
+	var wg sync.WaitGroup
+	for i := range samples {
+		client := c.clone(c.config)
+		// The answers aren't turns of the conversation
+		client.ConversationID = ""
+		wg.Add(1)
+		go func(i int, client *LLMClient) {
+			defer wg.Done()
+			answer, err := client.ask(query)
+			samples[i] = Sample{Answer: answer, Entry: client.lastEntry, Err: err}
+		}(i, client)
+	}
+	wg.Wait()
+	return samples
+}
@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"q/exitcode"
+)
+
+// DefaultIdleTimeout is how long a stream may go quiet once it has started
+// before it's taken to have stalled, unless the model sets idle_timeout
+const DefaultIdleTimeout = 20 * time.Second
+
+// ErrStalled is the error of a stream that stopped sending data partway
+var ErrStalled error = stallError{}
+
+type stallError struct{}
+
+func (stallError) Error() string { return "the stream stalled" }
+
+// ErrorCode is the code stalls are logged with
+func (stallError) ErrorCode() string { return "stalled" }
+
+// idleTimeout is the model's idle_timeout, or the default; 0 turns stall
+// detection off
+func (c *LLMClient) idleTimeout() time.Duration {
+	if c.config.IdleTimeout == "" {
+		return DefaultIdleTimeout
+	}
+	timeout, err := time.ParseDuration(c.config.IdleTimeout)
+	if err != nil || timeout < 0 {
+		return DefaultIdleTimeout
+	}
+	return timeout
+}
+
+// stallReader reads a streamed response body, closing it once no data has
+// arrived for timeout. The clock starts with the first data, since reasoning
+// models may think for a long while before that.
+type stallReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	stalled bool
+}
+
+// watchStall returns body, failing reads with ErrStalled if the stream goes
+// idle for longer than the model's idle timeout
+func (c *LLMClient) watchStall(body io.ReadCloser) io.Reader {
+	timeout := c.idleTimeout()
+	if timeout <= 0 {
+		return body
+	}
+	return &stallReader{body: body, timeout: timeout}
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stalled {
+		return n, exitcode.Wrap(exitcode.Provider, fmt.Errorf("%w: no data for %s", ErrStalled, r.timeout))
+	}
+	switch {
+	case err != nil:
+		if r.timer != nil {
+			r.timer.Stop()
+		}
+	case n > 0 && r.timer == nil:
+		r.timer = time.AfterFunc(r.timeout, r.stall)
+	case n > 0:
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// stall gives up on the stream, which unblocks the read waiting on it
+func (r *stallReader) stall() {
+	r.mu.Lock()
+	r.stalled = true
+	r.mu.Unlock()
+	r.body.Close()
+}
@@ -0,0 +1,138 @@
+package llm
+
+import (
+	. "q/types"
+)
+
+// StreamHandler receives an answer as it streams in, so the TUI, --quiet and
+// any other front end can each show it their own way. OnToken is passed each
+// piece of text added to the answer, OnUsage the token counts once the
+// provider reports them, and OnToolCall each function call the model asks
+// for. A query ends with OnDone and the whole answer, or with OnError.
+type StreamHandler interface {
+	OnToken(text string)
+	OnUsage(inputTokens, outputTokens int)
+	OnToolCall(call ToolCall)
+	OnDone(answer string)
+	OnError(err error)
+}
+
+// StreamFuncs is a StreamHandler made of functions, any of which may be nil,
+// for front ends that only need some of the events
+type StreamFuncs struct {
+	Token    func(text string)
+	Usage    func(inputTokens, outputTokens int)
+	ToolCall func(call ToolCall)
+	Done     func(answer string)
+	Error    func(err error)
+}
+
+func (f StreamFuncs) OnToken(text string) {
+	if f.Token != nil {
+		f.Token(text)
+	}
+}
+
+func (f StreamFuncs) OnUsage(inputTokens, outputTokens int) {
+	if f.Usage != nil {
+		f.Usage(inputTokens, outputTokens)
+	}
+}
+
+func (f StreamFuncs) OnToolCall(call ToolCall) {
+	if f.ToolCall != nil {
+		f.ToolCall(call)
+	}
+}
+
+func (f StreamFuncs) OnDone(answer string) {
+	if f.Done != nil {
+		f.Done(answer)
+	}
+}
+
+func (f StreamFuncs) OnError(err error) {
+	if f.Error != nil {
+		f.Error(err)
+	}
+}
+
+// handler is the client's StreamHandler, or one that ignores everything
+func (c *LLMClient) handler() StreamHandler {
+	if c.StreamHandler == nil {
+		return StreamFuncs{}
+	}
+	return c.StreamHandler
+}
+
+// tokenFilter passes a stream's events on to a handler, except its tokens,
+// which go to onToken. The client's handler is swapped for one while a
+// request needs to change what's shown, and restored after.
+type tokenFilter struct {
+	StreamHandler
+	onToken func(text string)
+}
+
+func (f tokenFilter) OnToken(text string) {
+	f.onToken(text)
+}
+
+// filterTokens puts onToken in front of the client's handler, returning a
+// function that restores it
+func (c *LLMClient) filterTokens(onToken func(next StreamHandler, text string)) func() {
+	handler := c.StreamHandler
+	next := c.handler()
+	c.StreamHandler = tokenFilter{next, func(text string) { onToken(next, text) }}
+	return func() { c.StreamHandler = handler }
+}
+
+// hideTokens keeps the answer from being shown as it streams in, returning a
+// function that shows it again
+func (c *LLMClient) hideTokens() func() {
+	return c.filterTokens(func(StreamHandler, string) {})
+}
+
+// showPrefill shows the prefill ahead of the first token
+func (c *LLMClient) showPrefill(prefill string) func() {
+	first := true
+	return c.filterTokens(func(next StreamHandler, text string) {
+		if first {
+			first = false
+			text = prefill + text
+		}
+		next.OnToken(text)
+	})
+}
+
+// toolCalls collects the function calls streamed in chat completion deltas,
+// which arrive in pieces keyed by their index
+type toolCalls struct {
+	calls []ToolCall
+	index map[int]int
+}
+
+func (t *toolCalls) add(index int, id, name, arguments string) {
+	if t.index == nil {
+		t.index = map[int]int{}
+	}
+	i, ok := t.index[index]
+	if !ok {
+		i = len(t.calls)
+		t.index[index] = i
+		t.calls = append(t.calls, ToolCall{})
+	}
+	call := &t.calls[i]
+	if id != "" {
+		call.ID = id
+	}
+	call.Name += name
+	call.Arguments += arguments
+}
+
+// flush passes the collected calls to the handler
+func (t *toolCalls) flush(handler StreamHandler) {
+	for _, call := range t.calls {
+		handler.OnToolCall(call)
+	}
+	t.calls, t.index = nil, nil
+}
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	. "q/types"
+)
+
+func TestStreamFuncsLeftNil(t *testing.T) {
+	var f StreamFuncs
+	f.OnToken("ls")
+	f.OnUsage(1, 2)
+	f.OnToolCall(ToolCall{Name: "run"})
+	f.OnDone("ls")
+	f.OnError(ErrInterrupted)
+
+	// A client without a handler streams into one that ignores everything
+	c := &LLMClient{}
+	c.handler().OnToken("ls")
+	restore := c.showPrefill("$ ")
+	c.handler().OnToken("ls")
+	restore()
+	if c.StreamHandler != nil {
+		t.Errorf("restored %#v, want no handler", c.StreamHandler)
+	}
+}
+
+func TestTokenFilters(t *testing.T) {
+	var shown strings.Builder
+	var usage []int
+	handler := StreamFuncs{
+		Token: func(text string) { shown.WriteString(text) },
+		Usage: func(input, output int) { usage = append(usage, input, output) },
+	}
+	c := &LLMClient{StreamHandler: handler}
+
+	restoreHidden := c.hideTokens()
+	c.handler().OnToken("hidden")
+	c.handler().OnUsage(1, 2)
+	restoreHidden()
+	c.handler().OnToken("shown")
+	if shown.String() != "shown" {
+		t.Errorf("shown %q, want only what came after the tokens were shown again", shown.String())
+	}
+	// Only tokens are held back
+	if len(usage) != 2 || usage[0] != 1 || usage[1] != 2 {
+		t.Errorf("passed on the usage %v, want [1 2]", usage)
+	}
+
+	shown.Reset()
+	restorePrefill := c.showPrefill("ls")
+	for _, text := range []string{" -la", " /tmp"} {
+		c.handler().OnToken(text)
+	}
+	restorePrefill()
+	c.handler().OnToken("\n")
+	if shown.String() != "ls -la /tmp\n" {
+		t.Errorf("shown %q, want the prefill once, ahead of the first token", shown.String())
+	}
+
+	// Filters restore in the reverse order they were put in front
+	shown.Reset()
+	restoreHidden = c.hideTokens()
+	restorePrefill = c.showPrefill("ls")
+	c.handler().OnToken(" -la")
+	restorePrefill()
+	c.handler().OnToken(" hidden")
+	restoreHidden()
+	c.handler().OnToken("shown")
+	if shown.String() != "shown" {
+		t.Errorf("shown %q, want nothing while hidden", shown.String())
+	}
+	if _, ok := c.StreamHandler.(StreamFuncs); !ok {
+		t.Errorf("restored %#v, want the client's own handler", c.StreamHandler)
+	}
+}
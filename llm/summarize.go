@@ -0,0 +1,104 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"q/logger"
+	"q/provider"
+	"q/tokens"
+	. "q/types"
+)
+
+// SummaryOptions controls the length and shape of a summary
+type SummaryOptions struct {
+	// Sentences is the number of sentences (or bullets); 0 lets the model choose
+	Sentences int
+	// Bullets asks for a bulleted list instead of prose
+	Bullets bool
+}
+
+const partSummaryPrompt = "You are summarizing a long text one part at a time. " +
+	"Summarize the following part in a few short paragraphs, keeping facts, figures, names, " +
+	"commands and conclusions a final summary of the whole text may need. Reply with the summary only."
+
+// maxSummaryChunk caps the size of each part even on models with huge windows,
+// since summaries of very long parts lose detail
+const maxSummaryChunk = 16000
+
+// Summarize summarizes text of any length. Text that doesn't fit in one
+// request is split into parts that are summarized separately, then their
+// summaries are combined (map-reduce), as many rounds as it takes. progress,
+// if set, is told about each part. Every request is logged.
+func (c *LLMClient) Summarize(text string, opts SummaryOptions, progress func(round, part, parts int)) (string, error) {
+	chunkTokens := provider.ContextWindow(c.config) / 2
+	if chunkTokens <= 0 {
+		// Unknown window: stay small enough for local models
+		chunkTokens = 4000
+	}
+	if chunkTokens > maxSummaryChunk {
+		chunkTokens = maxSummaryChunk
+	}
+
+	chunks := tokens.Split(text, chunkTokens)
+	if len(chunks) == 0 {
+		return "", fmt.Errorf("there is nothing to summarize")
+	}
+	for round := 1; len(chunks) > 1; round++ {
+		var partials []string
+		for i, chunk := range chunks {
+			if progress != nil {
+				progress(round, i+1, len(chunks))
+			}
+			part := fmt.Sprintf("Part %d of %d:\n\n%s", i+1, len(chunks), chunk)
+			summary, err := c.complete(partSummaryPrompt, part, fmt.Sprintf("summarize: part %d/%d", i+1, len(chunks)))
+			if err != nil {
+				return "", err
+			}
+			partials = append(partials, strings.TrimSpace(summary))
+		}
+		next := tokens.Split(strings.Join(partials, "\n\n"), chunkTokens)
+		if len(next) >= len(chunks) {
+			return "", fmt.Errorf("the part summaries aren't getting shorter; try a model with a larger context window")
+		}
+		chunks = next
+	}
+	return c.complete(finalSummaryPrompt(opts), chunks[0], "summarize")
+}
+
+// finalSummaryPrompt asks for the summary in the requested shape
+func finalSummaryPrompt(opts SummaryOptions) string {
+	shape := "in one short paragraph"
+	switch {
+	case opts.Bullets && opts.Sentences > 0:
+		shape = fmt.Sprintf("as exactly %d Markdown bullet points, one sentence each", opts.Sentences)
+	case opts.Bullets:
+		shape = "as a short list of Markdown bullet points"
+	case opts.Sentences == 1:
+		shape = "in exactly one sentence"
+	case opts.Sentences > 0:
+		shape = fmt.Sprintf("in exactly %d sentences", opts.Sentences)
+	}
+	return "Summarize the following text " + shape + ". " +
+		"It may be the text itself or summaries of its parts, in order. " +
+		"Focus on what a reader most needs to know. Reply with the summary only."
+}
+
+// complete makes one logged, non-streaming request with a system prompt
+func (c *LLMClient) complete(system, user, note string) (string, error) {
+	request := []Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: user},
+	}
+	startTime := time.Now()
+	message, usage, requestID, err := c.callCompletion(Payload{
+		Model:       c.config.ModelName,
+		Messages:    request,
+		Temperature: c.Temperature,
+	})
+	entry := logger.CreateLogEntry(c.config.ModelName, request, message.Content, usage, requestID, time.Since(startTime).Milliseconds(), err)
+	entry.ContextNote = note
+	c.writeLog(entry)
+	return message.Content, err
+}
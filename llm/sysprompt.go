@@ -0,0 +1,61 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"q/sysprompt"
+	. "q/types"
+)
+
+// applySystemPrompt builds a request's system prompt from the model's
+// system_prompt sections, if it has any, in place of the system messages its
+// prompt starts with, which become the persona section
+func (c *LLMClient) applySystemPrompt(payload *Payload) error {
+	if len(c.config.SystemPrompt) == 0 {
+		return nil
+	}
+	n := 0
+	var persona []string
+	for n < len(c.config.Prompt) && c.config.Prompt[n].Role == "system" {
+		persona = append(persona, c.config.Prompt[n].Content)
+		n++
+	}
+	if n > len(payload.Messages) {
+		n = 0
+	}
+	system, err := sysprompt.Build(c.config.SystemPrompt, sysprompt.Data{
+		Persona:        strings.Join(persona, "\n\n"),
+		Memory:         c.Memory,
+		PackageManager: c.PackageManager,
+		Model:          c.config.ModelName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build the system prompt: %w", err)
+	}
+	var messages []Message
+	if system != "" {
+		messages = append(messages, Message{Role: "system", Content: system})
+	}
+	payload.Messages = append(messages, payload.Messages[n:]...)
+	return nil
+}
+
+// SystemPrompt is the system prompt the next question would be sent with:
+// the system messages its request starts with, joined
+func (c *LLMClient) SystemPrompt() (string, error) {
+	payload := Payload{Messages: c.messages}
+	if err := c.applySystemPrompt(&payload); err != nil {
+		return "", err
+	}
+	c.applyMemory(&payload)
+	c.applyPackageManager(&payload)
+	var parts []string
+	for _, message := range payload.Messages {
+		if message.Role != "system" {
+			break
+		}
+		parts = append(parts, message.Content)
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
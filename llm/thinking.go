@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"strings"
+)
+
+// Ways of showing a model's reasoning (the thinking preference)
+const (
+	ThinkingHide = "hide"
+	ThinkingDim  = "dim"
+	ThinkingShow = "show"
+)
+
+// thinkOpen and thinkClose delimit the reasoning that models like DeepSeek-R1
+// and QwQ write at the start of their answer
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// splitThinking separates a leading <think> block from the answer. While the
+// block is still streaming all of it is reasoning, and a tag that's only
+// partly there is held back until it's complete.
+func splitThinking(text string) (answer, reasoning string) {
+	trimmed := strings.TrimLeft(text, " \t\r\n")
+	if !strings.HasPrefix(trimmed, thinkOpen) {
+		if trimmed != "" && strings.HasPrefix(thinkOpen, trimmed) {
+			return "", ""
+		}
+		return text, ""
+	}
+	rest := trimmed[len(thinkOpen):]
+	end := strings.Index(rest, thinkClose)
+	if end < 0 {
+		for i := len(thinkClose) - 1; i > 0; i-- {
+			if strings.HasSuffix(rest, thinkClose[:i]) {
+				rest = rest[:len(rest)-i]
+				break
+			}
+		}
+		return "", strings.TrimSpace(rest)
+	}
+	return strings.TrimLeft(rest[end+len(thinkClose):], " \t\r\n"), strings.TrimSpace(rest[:end])
+}
+
+// thinkSplitter separates a leading <think> block from an answer as it
+// streams in, like splitThinking but looking at each piece only once
+type thinkSplitter struct {
+	// raw is the content up to the end of the <think> block, if any
+	raw strings.Builder
+	// thinking is set inside the block, start being where its text begins
+	// and scanned how far it's been searched for the closing tag
+	thinking       bool
+	start, scanned int
+	// answering is set once the rest of the content is answer, and started
+	// once some of it has been passed on
+	answering, started bool
+	reasoning          string
+}
+
+// add takes the next piece of content, returning the text it adds to the
+// answer and the reasoning so far. Whitespace before the answer is dropped,
+// but nothing else is.
+func (s *thinkSplitter) add(content string) (text, reasoning string) {
+	if s.answering {
+		if !s.started {
+			// The answer after a <think> block starts at its first non-space
+			content = strings.TrimLeft(content, " \t\r\n")
+		}
+		s.started = s.started || content != ""
+		return content, s.reasoning
+	}
+	s.raw.WriteString(content)
+	raw := s.raw.String()
+	if !s.thinking {
+		trimmed := strings.TrimLeft(raw, " \t\r\n")
+		switch {
+		case strings.HasPrefix(trimmed, thinkOpen):
+			s.thinking = true
+			s.start = len(raw) - len(trimmed) + len(thinkOpen)
+			s.scanned = s.start
+		case trimmed == "" || strings.HasPrefix(thinkOpen, trimmed):
+			// Too early to tell
+			return "", ""
+		default:
+			// The answer starts at its first non-space, as after a block
+			s.answering, s.started = true, true
+			return trimmed, ""
+		}
+	}
+
+	// Search what's new for the closing tag, including any part of it that
+	// came with the last piece
+	from := s.scanned - len(thinkClose) + 1
+	if from < s.start {
+		from = s.start
+	}
+	if end := strings.Index(raw[from:], thinkClose); end >= 0 {
+		end += from
+		s.reasoning = strings.TrimSpace(raw[s.start:end])
+		s.answering = true
+		return s.add(raw[end+len(thinkClose):])
+	}
+	s.scanned = len(raw)
+	body := raw[s.start:]
+	for i := len(thinkClose) - 1; i > 0; i-- {
+		if strings.HasSuffix(body, thinkClose[:i]) {
+			body = body[:len(body)-i]
+			break
+		}
+	}
+	return "", strings.TrimSpace(body)
+}
+
+// setReasoning records the reasoning of the current answer so far and passes
+// it to ThinkingCallback, if it changed
+func (c *LLMClient) setReasoning(reasoning string) {
+	if reasoning == c.reasoning {
+		return
+	}
+	c.reasoning = reasoning
+	if c.ThinkingCallback != nil {
+		c.ThinkingCallback(reasoning)
+	}
+}
+
+// joinReasoning joins reasoning sent in a separate field with reasoning
+// written in the answer; a model normally uses one or the other
+func joinReasoning(parts ...string) string {
+	var joined []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			joined = append(joined, part)
+		}
+	}
+	return strings.Join(joined, "\n\n")
+}
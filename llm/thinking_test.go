@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestThinkSplitter(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []string
+		wantAnswer    string
+		wantReasoning string
+	}{
+		{"plain answer", []string{"ls ", "-la"}, "ls -la", ""},
+		{"leading whitespace", []string{"\n\n", "  ls", "\n-la\n"}, "ls\n-la\n", ""},
+		{"newline in the first pieces", []string{"Use this:\n", "```bash\nls\n", "```\n"}, "Use this:\n```bash\nls\n```\n", ""},
+		{"whole block", []string{"<think>hmm</think>\n\nls"}, "ls", "hmm"},
+		{"open tag split", []string{"<th", "ink>", "hmm", "</think>", "ls"}, "ls", "hmm"},
+		{"close tag split", []string{"<think>hmm</th", "ink>", "\n", "ls"}, "ls", "hmm"},
+		{"close tag split three ways", []string{"<think>a", "b</", "thi", "nk> ", "ls"}, "ls", "ab"},
+		{"whitespace before the block", []string{" \n", "<think>", "hmm", "</think>ls"}, "ls", "hmm"},
+		{"missing close tag", []string{"<think>still ", "thinking</thi"}, "", "still thinking"},
+		{"lookalike of the open tag", []string{"<th", "ere is"}, "<there is", ""},
+	}
+	for _, tt := range tests {
+		var s thinkSplitter
+		var answer strings.Builder
+		var reasoning string
+		for _, chunk := range tt.chunks {
+			text, r := s.add(chunk)
+			answer.WriteString(text)
+			reasoning = r
+		}
+		if answer.String() != tt.wantAnswer || reasoning != tt.wantReasoning {
+			t.Errorf("%s: got answer %q and reasoning %q, want %q and %q", tt.name, answer.String(), reasoning, tt.wantAnswer, tt.wantReasoning)
+		}
+		// Streamed or whole, the split is the same
+		if whole, r := splitThinking(strings.Join(tt.chunks, "")); tt.wantReasoning != "" && (whole != tt.wantAnswer || r != tt.wantReasoning) {
+			t.Errorf("%s: splitThinking = %q, %q", tt.name, whole, r)
+		}
+	}
+}
+
+func TestProcessStreamKeepsNewlines(t *testing.T) {
+	content := "\n\nUse this:\n```bash\nls -la\n```\nIt lists files."
+	for _, size := range []int{1, 3, 7, 64} {
+		c := &LLMClient{}
+		var shown strings.Builder
+		c.StreamHandler = StreamFuncs{Token: func(text string) { shown.WriteString(text) }}
+		answer, _, requestID, err := c.processStream(&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(streamResponse("req-1", content, size)))})
+		want := strings.TrimLeft(content, "\n")
+		if err != nil || answer != want || shown.String() != want || requestID != "req-1" {
+			t.Errorf("in %d-byte chunks: got %q (shown %q), %q, %v; want %q", size, answer, shown.String(), requestID, err, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"q/logger"
+	. "q/types"
+)
+
+const titlePrompt = "You name and summarize conversations between a user and a terminal assistant. " +
+	`Reply with JSON only, in the form {"title": "...", "summary": "..."}. ` +
+	"The title is at most eight words, with no quotes or final period. " +
+	"The summary is one short paragraph on what the user wanted and what they ended up with."
+
+// titleExcerptRunes caps each message sent for titling; the gist is at the start
+const titleExcerptRunes = 1500
+
+// TitleConversation asks the client's model, a cheap one ideally, for a title
+// and a one-paragraph summary of a conversation. The request is logged like
+// any other request.
+func (c *LLMClient) TitleConversation(turns []Message) (title, summary string, err error) {
+	var transcript strings.Builder
+	for _, msg := range turns {
+		content := msg.Content
+		if runes := []rune(content); len(runes) > titleExcerptRunes {
+			content = string(runes[:titleExcerptRunes]) + " ..."
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, content)
+	}
+	request := []Message{
+		{Role: "system", Content: titlePrompt},
+		{Role: "user", Content: transcript.String()},
+	}
+
+	startTime := time.Now()
+	message, usage, requestID, err := c.callCompletion(Payload{
+		Model:    c.config.ModelName,
+		Messages: request,
+	})
+	entry := logger.CreateLogEntry(c.config.ModelName, request, message.Content, usage, requestID, time.Since(startTime).Milliseconds(), err)
+	entry.ContextNote = "conversation title"
+	c.writeLog(entry)
+	if err != nil {
+		return "", "", err
+	}
+	title, summary = parseTitle(message.Content)
+	if title == "" {
+		return "", "", fmt.Errorf("the model returned no title")
+	}
+	return title, summary, nil
+}
+
+// parseTitle reads the title and summary from a reply, which should be JSON
+// but may come fenced as a code block, or as plain text with the title first
+func parseTitle(reply string) (title, summary string) {
+	reply = strings.TrimSpace(reply)
+	reply = strings.TrimPrefix(reply, "```json")
+	reply = strings.TrimPrefix(reply, "```")
+	reply = strings.TrimSpace(strings.TrimSuffix(reply, "```"))
+
+	var parsed struct {
+		Title   string `json:"title"`
+		Summary string `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(reply), &parsed); err == nil {
+		title, summary = parsed.Title, parsed.Summary
+	} else {
+		parts := strings.SplitN(reply, "\n", 2)
+		title = parts[0]
+		if len(parts) == 2 {
+			summary = parts[1]
+		}
+	}
+	title = strings.TrimSuffix(strings.Trim(strings.TrimSpace(title), `"'`), ".")
+	return title, strings.TrimSpace(summary)
+}
@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+
+	. "q/types"
+)
+
+// maxToolRounds caps the requests a query makes to answer tool calls, so a
+// model that keeps calling tools can't loop forever
+const maxToolRounds = 8
+
+// Tool is a function the model may call while answering a query. Run is
+// passed the call's arguments as JSON and returns what the model is told
+// came of it, errors included, as text.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments
+	Parameters string
+	Run        func(arguments string) string
+}
+
+// errToolsNeedChat is returned for tools on a model using the Responses
+// API, whose function calls aren't sent back to it yet
+var errToolsNeedChat = errors.New("tools need a model using the chat completions API")
+
+// applyTools offers the client's Tools to the model
+func (c *LLMClient) applyTools(payload *Payload) {
+	for _, tool := range c.Tools {
+		var spec ToolSpec
+		spec.Type = "function"
+		spec.Function.Name = tool.Name
+		spec.Function.Description = tool.Description
+		spec.Function.Parameters = json.RawMessage(tool.Parameters)
+		payload.Tools = append(payload.Tools, spec)
+	}
+}
+
+// messageToolCalls are the calls the model asked for, as they're sent back
+// to it in its message
+func messageToolCalls(calls []ToolCall) []MessageToolCall {
+	var out []MessageToolCall
+	for _, call := range calls {
+		var m MessageToolCall
+		m.ID, m.Type = call.ID, "function"
+		m.Function.Name, m.Function.Arguments = call.Name, call.Arguments
+		out = append(out, m)
+	}
+	return out
+}
+
+// runTools runs the calls in an assistant message, returning a tool message
+// with the result of each
+func (c *LLMClient) runTools(calls []MessageToolCall) []Message {
+	var results []Message
+	for _, call := range calls {
+		result := "There's no tool called " + call.Function.Name + "."
+		for _, tool := range c.Tools {
+			if tool.Name == call.Function.Name {
+				result = tool.Run(call.Function.Arguments)
+				break
+			}
+		}
+		results = append(results, Message{Role: "tool", Content: result, ToolCallID: call.ID})
+	}
+	return results
+}
@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"context"
+	"errors"
+
+	"q/tracing"
+)
+
+// startTrace starts the span of a query, following the OpenTelemetry
+// conventions for generative AI clients. The steps of the query are traced
+// as its children until endTrace.
+func (c *LLMClient) startTrace() (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(context.Background(), "chat "+c.config.ModelName)
+	span.SetAttribute("gen_ai.operation.name", "chat")
+	span.SetAttribute("gen_ai.system", c.system())
+	span.SetAttribute("gen_ai.request.model", c.config.ModelName)
+	span.SetAttribute("q.conversation_id", c.ConversationID)
+	c.trace = ctx
+	return ctx, span
+}
+
+// endTrace ends the span of a query once it's logged, recording what the log
+// entry says about it
+func (c *LLMClient) endTrace(span *tracing.Span) {
+	entry := c.lastEntry
+	if entry.RequestID != "" {
+		span.SetAttribute("gen_ai.response.id", entry.RequestID)
+	}
+	span.SetAttribute("gen_ai.usage.input_tokens", entry.PromptTokens)
+	span.SetAttribute("gen_ai.usage.output_tokens", entry.CompletionTokens)
+	span.SetAttribute("q.cost_usd", entry.EstimatedCost)
+	if entry.Interrupted {
+		span.SetAttribute("q.interrupted", true)
+	}
+	if entry.Error != "" {
+		span.RecordError(errors.New(entry.Error))
+	}
+	c.trace = nil
+	span.End()
+}
+
+// traceContext is the context a step of the current query is traced in
+func (c *LLMClient) traceContext() context.Context {
+	if c.trace == nil {
+		return context.Background()
+	}
+	return c.trace
+}
+
+// system names the provider for gen_ai.system
+func (c *LLMClient) system() string {
+	if c.config.Provider != "" {
+		return c.config.Provider
+	}
+	return "openai"
+}
+
+// traceFirstToken marks the first token in span, returning a function that
+// restores the handler
+func (c *LLMClient) traceFirstToken(span *tracing.Span) func() {
+	if span == nil {
+		return func() {}
+	}
+	first := true
+	return c.filterTokens(func(next StreamHandler, text string) {
+		if first && text != "" {
+			first = false
+			span.AddEvent("first token")
+			span.SetAttribute("q.time_to_first_token_ms", span.Elapsed().Milliseconds())
+		}
+		next.OnToken(text)
+	})
+}
@@ -0,0 +1,124 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"q/exitcode"
+	"q/logger"
+	. "q/types"
+)
+
+// DefaultTranscriptionModel is used for --voice unless voice.model is set
+const DefaultTranscriptionModel = "whisper-1"
+
+// Transcription is the text of an audio file
+type Transcription struct {
+	Text string
+	// Seconds is the length of the audio, for the cost (0 if unknown)
+	Seconds   float64
+	RequestID string
+}
+
+// Transcribe turns speech in an audio file into text with an OpenAI-style
+// /audio/transcriptions endpoint. language may be empty to detect it.
+func (c *LLMClient) Transcribe(path, model, language string) (Transcription, error) {
+	var transcript Transcription
+	base, err := c.apiBaseURL()
+	if err != nil {
+		return transcript, err
+	}
+	audio, err := os.ReadFile(path)
+	if err != nil {
+		return transcript, err
+	}
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	writer.WriteField("model", model)
+	// Only whisper-1 reports the audio's length
+	if model == "whisper-1" {
+		writer.WriteField("response_format", "verbose_json")
+	} else {
+		writer.WriteField("response_format", "json")
+	}
+	if language != "" {
+		writer.WriteField("language", language)
+	}
+	part, err := writer.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return transcript, err
+	}
+	part.Write(audio)
+	writer.Close()
+
+	req, err := c.newAPIRequest("POST", base+"/audio/transcriptions", &form)
+	if err != nil {
+		return transcript, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.recordError(ErrorTransport, err.Error(), "", "")
+		return transcript, exitcode.Wrap(exitcode.Provider, fmt.Errorf("failed to make the API request: %w", err))
+	}
+	defer resp.Body.Close()
+	transcript.RequestID = resp.Header.Get("X-Request-Id")
+	if resp.StatusCode != http.StatusOK {
+		return transcript, c.failedResponse(resp)
+	}
+
+	var result struct {
+		Text     string  `json:"text"`
+		Duration float64 `json:"duration"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		c.recordError(ErrorJSON, "failed to parse the response: "+err.Error(), "", transcript.RequestID)
+		return transcript, fmt.Errorf("failed to parse the response: %w", err)
+	}
+	transcript.Text = strings.TrimSpace(result.Text)
+	transcript.Seconds = result.Duration
+	if transcript.Seconds == 0 {
+		transcript.Seconds = wavSeconds(audio)
+	}
+	return transcript, nil
+}
+
+// wavSeconds is the length of a PCM WAV file from its header, or 0 for other formats
+func wavSeconds(data []byte) float64 {
+	if len(data) < 44 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0
+	}
+	byteRate := binary.LittleEndian.Uint32(data[28:32])
+	if byteRate == 0 {
+		return 0
+	}
+	return float64(len(data)-44) / float64(byteRate)
+}
+
+// LogTranscription logs a transcription as its own entry, so its cost is
+// counted apart from the answer to the transcribed prompt
+func (c *LLMClient) LogTranscription(path, model string, transcript Transcription, durationMs int64, err error) {
+	entry := LogEntry{
+		Timestamp:     time.Now().UTC(),
+		Model:         model,
+		Messages:      []Message{{Role: "user", Content: "[audio: " + filepath.Base(path) + "]"}},
+		Response:      transcript.Text,
+		RequestID:     transcript.RequestID,
+		DurationMs:    durationMs,
+		AudioSeconds:  transcript.Seconds,
+		EstimatedCost: logger.TranscriptionCost(model, transcript.Seconds),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	c.writeLog(entry)
+}
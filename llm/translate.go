@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"q/provider"
+	"q/tokens"
+	"q/translate"
+)
+
+// TranslateOptions are the languages and terminology of a translation
+type TranslateOptions struct {
+	// From is the source language; empty if it couldn't be detected
+	From     string
+	To       string
+	Glossary translate.Glossary
+}
+
+// maxTranslationChunk caps each part of a long text, since the translation
+// is about as long as the part and has to fit in the model's output
+const maxTranslationChunk = 2000
+
+// detectionSample is how much text is shown to the model to detect its language
+const detectionSample = 1000
+
+// DetectLanguage asks the model for the ISO 639-1 code of text's language
+func (c *LLMClient) DetectLanguage(text string) (string, error) {
+	if len(text) > detectionSample {
+		text = text[:detectionSample]
+	}
+	answer, err := c.complete("Identify the language of the user's text, ignoring any code. "+
+		"Reply with its two-letter ISO 639-1 code only, like en or de.", text, "translate: detect language")
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(strings.TrimFunc(strings.TrimSpace(answer), func(r rune) bool { return !unicode.IsLetter(r) }))
+	if len(code) < 2 || len(code) > 3 {
+		return "", fmt.Errorf("unexpected answer %q", answer)
+	}
+	return code, nil
+}
+
+// Translate translates text into opts.To. Code, URLs and placeholders are
+// swapped for markers the model copies, and put back afterwards; lost lists
+// any the model dropped. Long texts are translated in parts, and progress, if
+// set, is told about each. Every request is logged.
+func (c *LLMClient) Translate(text string, opts TranslateOptions, progress func(part, parts int)) (translated string, lost []string, err error) {
+	masked, spans := translate.Protect(text)
+
+	chunkTokens := provider.ContextWindow(c.config) / 4
+	if chunkTokens <= 0 || chunkTokens > maxTranslationChunk {
+		chunkTokens = maxTranslationChunk
+	}
+	chunks := tokens.Split(masked, chunkTokens)
+	if len(chunks) == 0 {
+		return "", nil, fmt.Errorf("there is nothing to translate")
+	}
+
+	prompt := translationPrompt(opts)
+	var parts []string
+	for i, chunk := range chunks {
+		if progress != nil {
+			progress(i+1, len(chunks))
+		}
+		note := "translate"
+		if len(chunks) > 1 {
+			note = fmt.Sprintf("translate: part %d/%d", i+1, len(chunks))
+		}
+		part, err := c.complete(prompt, chunk, note)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, strings.TrimSpace(part))
+	}
+	translated, lost = translate.Restore(strings.Join(parts, "\n\n"), spans)
+	return translated, lost, nil
+}
+
+// translationPrompt is the system prompt for each part of a translation
+func translationPrompt(opts TranslateOptions) string {
+	from := "from its language"
+	if opts.From != "" {
+		from = "from " + translate.LanguageName(opts.From)
+	}
+	prompt := fmt.Sprintf("You are a professional translator. Translate the user's text %s into %s. "+
+		"Keep the meaning, tone and formatting, including Markdown and line breaks. "+
+		"Markers like ⟦1⟧ stand for code, links and placeholders: copy each one exactly, where it belongs in the translation. "+
+		"Reply with the translation only, without notes or quotes.", from, translate.LanguageName(opts.To))
+	if glossary := opts.Glossary.Prompt(); glossary != "" {
+		prompt += "\n\n" + glossary
+	}
+	return prompt
+}
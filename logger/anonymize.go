@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	. "q/types"
+)
+
+// hashID replaces an ID with the start of its SHA-256, so records stay
+// distinct (and exports of overlapping ranges can be deduplicated) without
+// revealing the ID
+func hashID(id string) string {
+	if id == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Anonymize keeps only what's needed to account for a response: no prompt,
+// answer, persona, paths or error text, IDs hashed, and the time cut to the day
+func Anonymize(entry LogEntry) UsageRecord {
+	kind := "chat"
+	switch {
+	case entry.Image != nil:
+		kind = "image"
+	case entry.AudioSeconds > 0:
+		kind = "audio"
+	case entry.BatchID != "":
+		kind = "batch"
+	}
+	return UsageRecord{
+		ID:              hashID(entry.RequestID),
+		ConversationID:  hashID(entry.ConversationID),
+		Day:             entry.Timestamp.UTC().Format("2006-01-02"),
+		Model:           entry.Model,
+		Kind:            kind,
+		InputTokens:     entry.PromptTokens,
+		OutputTokens:    entry.CompletionTokens,
+		TokensEstimated: entry.TokensEstimated,
+		Cost:            entry.EstimatedCost,
+		DurationMs:      entry.DurationMs,
+		Failed:          entry.Error != "",
+		KeyAlias:        entry.KeyAlias,
+	}
+}
@@ -0,0 +1,14 @@
+package logger
+
+// transcriptionPricing is the price in USD per minute of audio
+var transcriptionPricing = map[string]float64{
+	"whisper-1":              0.006,
+	"gpt-4o-transcribe":      0.006,
+	"gpt-4o-mini-transcribe": 0.003,
+}
+
+// TranscriptionCost estimates the cost in USD of transcribing seconds of audio
+// (0 if the price is unknown)
+func TranscriptionCost(model string, seconds float64) float64 {
+	return transcriptionPricing[model] * seconds / 60
+}
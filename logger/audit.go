@@ -0,0 +1,207 @@
+package logger
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// audit chains each logged response to the one before it by hash and makes
+// the logs read-only, for an audit trail that shows tampering (see SetAudit)
+var audit bool
+
+// ErrAudit is returned for changes to the logs refused in audit mode
+var ErrAudit = errors.New("the logs are in audit mode, so entries can't be deleted or changed (audit_log in the config)")
+
+// SetAudit turns audit mode on or off. In audit mode each response logged
+// stores a hash of itself and of the response logged before it, so changing
+// or deleting one breaks the chain where VerifyChain finds it, and deleting
+// and redacting entries is refused.
+func SetAudit(on bool) {
+	audit = on
+}
+
+// chainedColumns are the columns of a response its hash covers: everything
+// it's logged with
+var chainedColumns = []string{
+	"id", "model", "prompt", "system", "response",
+	"conversation_id", "duration_ms", "datetime_utc",
+	"input_tokens", "output_tokens", "estimated_cost",
+	"error", "output_path", "persona", "context_note", "batch_id",
+	"regenerated_from", "request_raw", "response_raw", "routed_from",
+	"citations", "interrupted", "tokens_estimated", "urls", "key_alias",
+	"reasoning", "image", "audio_seconds", "stopped_early", "language",
+	"request_headers", "messages", "error_code", "endpoint", "retries",
+}
+
+// laterChainedColumns are columns added since the chain began. Each is only
+// hashed when set, so responses chained before it existed still verify.
+var laterChainedColumns = []string{"sample_group"}
+
+// chainedContent is the SQL for a response's hashed content: its columns
+// quoted as SQL literals, so NULL, numbers and text can't be mistaken for
+// one another, and joined with commas
+var chainedContent = func() string {
+	quoted := make([]string, len(chainedColumns))
+	for i, column := range chainedColumns {
+		quoted[i] = "quote(" + column + ")"
+	}
+	content := strings.Join(quoted, " || ',' || ")
+	for _, column := range laterChainedColumns {
+		content += " || COALESCE('," + column + "=' || quote(" + column + "), '')"
+	}
+	return content
+}()
+
+// initAudit creates the table recording the end of the chain. New responses
+// are chained from it rather than from the last response left, so deleting
+// the latest ones can't go unnoticed once more are logged.
+func (l *RequestLogger) initAudit() error {
+	_, err := l.db.Exec(`
+	CREATE TABLE IF NOT EXISTS audit_head (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		hash TEXT NOT NULL,
+		chained INTEGER NOT NULL
+	);`)
+	return err
+}
+
+// chainHash is a response's hash, given the hash before it ("" for the first)
+func chainHash(prev, content string) string {
+	sum := sha256.Sum256([]byte(prev + "\n" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+// chain adds a response just written in tx to the end of the chain. The
+// insert holds the write lock, so no other process can extend the chain from
+// the same hash.
+func chain(tx *sql.Tx, id string) error {
+	var prev string
+	err := tx.QueryRow(`SELECT hash FROM audit_head WHERE id = 1`).Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	var content string
+	if err := tx.QueryRow(`SELECT `+chainedContent+` FROM responses WHERE id = ?`, id).Scan(&content); err != nil {
+		return err
+	}
+	hash := chainHash(prev, content)
+	if _, err := tx.Exec(`UPDATE responses SET prev_hash = ?, row_hash = ? WHERE id = ?`, prev, hash, id); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO audit_head (id, hash, chained) VALUES (1, ?, 1)
+		ON CONFLICT(id) DO UPDATE SET hash = excluded.hash, chained = chained + 1`, hash)
+	return err
+}
+
+// ChainProblem is a break in the chain of logged responses
+type ChainProblem struct {
+	RequestID string
+	Logged    time.Time
+	Problem   string
+}
+
+// ChainReport is what VerifyChain found
+type ChainReport struct {
+	// Chained is how many responses are in the chain, and Unchained how many
+	// were logged after it began without audit mode
+	Chained, Unchained int
+	// First and Last are when the chain's first and latest responses were logged
+	First, Last time.Time
+	// Head is the latest response's hash; noting it down lets a later check
+	// tell whether responses were deleted from the end
+	Head     string
+	Problems []ChainProblem
+}
+
+// VerifyChain walks the chain of responses logged in audit mode, checking
+// each still has the hash it was logged with and follows the one logged
+// before it, and that the chain still ends where the last one was added. A
+// response that was changed fails the first check, and one deleted the
+// second or the third. If head is given, it must still be in the chain: a
+// hash noted down elsewhere catches the chain's end being rewritten too.
+func (l *RequestLogger) VerifyChain(head string) (ChainReport, error) {
+	var report ChainReport
+	if !l.enabled || l.db == nil {
+		return report, errors.New("logging is disabled")
+	}
+	if err := l.Flush(); err != nil {
+		return report, err
+	}
+	rows, err := l.db.Query(`SELECT id, datetime_utc, prev_hash, row_hash, ` + chainedContent + ` FROM responses ORDER BY rowid`)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	started, foundHead := false, false
+	for rows.Next() {
+		var (
+			id, content   string
+			datetime      sql.NullString
+			prev, rowHash sql.NullString
+		)
+		if err := rows.Scan(&id, &datetime, &prev, &rowHash, &content); err != nil {
+			return report, err
+		}
+		logged, _ := time.Parse(time.RFC3339, datetime.String)
+		problem := func(text string) {
+			report.Problems = append(report.Problems, ChainProblem{RequestID: id, Logged: logged, Problem: text})
+		}
+		if !rowHash.Valid {
+			if started {
+				report.Unchained++
+			}
+			continue
+		}
+
+		switch {
+		case !started && prev.String != "":
+			problem("the responses logged before it were deleted")
+		case started && prev.String != report.Head:
+			problem("the responses logged between it and the one before were deleted or changed")
+		}
+		if chainHash(prev.String, content) != rowHash.String {
+			problem("it was changed after it was logged")
+		}
+		if !started {
+			started = true
+			report.First = logged
+		}
+		report.Chained++
+		report.Last = logged
+		report.Head = rowHash.String
+		if rowHash.String == head {
+			foundHead = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+	var recorded string
+	var chained int
+	err = l.db.QueryRow(`SELECT hash, chained FROM audit_head WHERE id = 1`).Scan(&recorded, &chained)
+	if err != nil && err != sql.ErrNoRows {
+		return report, err
+	}
+	if recorded != report.Head {
+		report.Problems = append(report.Problems, ChainProblem{Problem: fmt.Sprintf("the chain should end at %s, its response number %d, so responses were deleted from its end", shortHash(recorded), chained)})
+	}
+	if head != "" && !foundHead {
+		report.Problems = append(report.Problems, ChainProblem{Problem: "the chain no longer has the hash " + head + ", so responses were deleted from its end or changed"})
+	}
+	return report, nil
+}
+
+// shortHash is the start of a hash, enough to tell it apart
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
@@ -0,0 +1,126 @@
+package logger
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "q/types"
+)
+
+// BatchPriceFactor is the share of the normal price charged for Batch API requests
+const BatchPriceFactor = 0.5
+
+// SaveBatch records a submitted batch job
+func (l *RequestLogger) SaveBatch(record BatchRecord) error {
+	if !l.enabled || l.db == nil {
+		return fmt.Errorf("logging is disabled, so batch jobs can't be tracked")
+	}
+	requests, err := json.Marshal(record.Requests)
+	if err != nil {
+		return err
+	}
+	_, err = l.db.Exec(
+		`INSERT OR REPLACE INTO batches (id, model, endpoint, status, created_utc, requests) VALUES (?, ?, ?, ?, ?, ?)`,
+		record.ID,
+		record.Model,
+		record.Endpoint,
+		record.Status,
+		record.CreatedAt.UTC().Format(time.RFC3339),
+		string(requests),
+	)
+	return err
+}
+
+// UpdateBatchStatus stores the latest known status of a batch job
+func (l *RequestLogger) UpdateBatchStatus(id, status string) error {
+	if !l.enabled || l.db == nil {
+		return nil
+	}
+	_, err := l.db.Exec(`UPDATE batches SET status = ? WHERE id = ?`, status, id)
+	return err
+}
+
+// ImportBatch logs the results of a finished batch job and marks it imported,
+// all in one transaction so a job is never imported twice
+func (l *RequestLogger) ImportBatch(id string, entries []LogEntry) error {
+	if !l.enabled || l.db == nil {
+		return nil
+	}
+	defer l.writeSpend()
+	defer l.shipDue()
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := l.logEntry(tx, entry); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE batches SET imported_utc = ? WHERE id = ?`, time.Now().UTC().Format(time.RFC3339), id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetBatch returns a tracked batch job by ID
+func (l *RequestLogger) GetBatch(id string) (BatchRecord, error) {
+	if !l.enabled || l.db == nil {
+		return BatchRecord{}, fmt.Errorf("logging is disabled, so batch jobs aren't tracked")
+	}
+	row := l.db.QueryRow(`
+		SELECT id, model, endpoint, status, created_utc, COALESCE(imported_utc, ''), requests
+		FROM batches WHERE id = ?`, id)
+	record, err := scanBatch(row)
+	if err == sql.ErrNoRows {
+		return record, fmt.Errorf("batch %s not found (see `q batch status`)", id)
+	}
+	return record, err
+}
+
+// ListBatches returns tracked batch jobs, newest first
+func (l *RequestLogger) ListBatches(limit int) ([]BatchRecord, error) {
+	if !l.enabled || l.db == nil {
+		return nil, nil
+	}
+	rows, err := l.db.Query(`
+		SELECT id, model, endpoint, status, created_utc, COALESCE(imported_utc, ''), requests
+		FROM batches ORDER BY created_utc DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []BatchRecord
+	for rows.Next() {
+		record, err := scanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func scanBatch(row interface{ Scan(...interface{}) error }) (BatchRecord, error) {
+	var (
+		record            BatchRecord
+		created, imported string
+		requests          string
+	)
+	if err := row.Scan(&record.ID, &record.Model, &record.Endpoint, &record.Status, &created, &imported, &requests); err != nil {
+		return record, err
+	}
+	record.CreatedAt, _ = time.Parse(time.RFC3339, created)
+	if imported != "" {
+		record.ImportedAt, _ = time.Parse(time.RFC3339, imported)
+	}
+	if err := json.Unmarshal([]byte(requests), &record.Requests); err != nil {
+		return record, fmt.Errorf("failed to parse requests of batch %s: %w", record.ID, err)
+	}
+	return record, nil
+}
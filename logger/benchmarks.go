@@ -0,0 +1,74 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+
+	. "q/types"
+)
+
+// initBenchmarks creates the table of `q bench` results, one row per model
+// and run
+func (l *RequestLogger) initBenchmarks() error {
+	_, err := l.db.Exec(`
+	CREATE TABLE IF NOT EXISTS benchmarks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		datetime_utc TEXT NOT NULL,
+		model TEXT NOT NULL,
+		runs INTEGER NOT NULL,
+		failures INTEGER NOT NULL,
+		error TEXT,
+		ttft_ms INTEGER,
+		duration_ms INTEGER,
+		tokens_per_sec REAL,
+		cost REAL
+	);
+	CREATE INDEX IF NOT EXISTS idx_benchmarks_model ON benchmarks(model, datetime_utc);`)
+	return err
+}
+
+// SaveBenchmark records how a model did in a `q bench` run
+func (l *RequestLogger) SaveBenchmark(b Benchmark) error {
+	if !l.enabled || l.db == nil {
+		return fmt.Errorf("logging is disabled")
+	}
+	if b.Time.IsZero() {
+		b.Time = time.Now()
+	}
+	_, err := l.db.Exec(`
+		INSERT INTO benchmarks (datetime_utc, model, runs, failures, error, ttft_ms, duration_ms, tokens_per_sec, cost)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.Time.UTC().Format(time.RFC3339), b.Model, b.Runs, b.Failures, nullIfEmpty(b.Error),
+		b.TTFTMs, b.DurationMs, b.TokensPerSec, b.Cost)
+	return err
+}
+
+// Benchmarks returns the benchmarks recorded since the given time, latest
+// first, or only each model's latest if latest is set
+func (l *RequestLogger) Benchmarks(since time.Time, latest bool) ([]Benchmark, error) {
+	if !l.enabled || l.db == nil {
+		return nil, fmt.Errorf("logging is disabled")
+	}
+	query := `SELECT datetime_utc, model, runs, failures, COALESCE(error, ''), ttft_ms, duration_ms, tokens_per_sec, cost
+		FROM benchmarks WHERE datetime_utc >= ?`
+	if latest {
+		query += ` AND id IN (SELECT MAX(id) FROM benchmarks GROUP BY model)`
+	}
+	rows, err := l.db.Query(query+` ORDER BY id DESC`, since.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var benchmarks []Benchmark
+	for rows.Next() {
+		var b Benchmark
+		var datetime string
+		if err := rows.Scan(&datetime, &b.Model, &b.Runs, &b.Failures, &b.Error, &b.TTFTMs, &b.DurationMs, &b.TokensPerSec, &b.Cost); err != nil {
+			return nil, err
+		}
+		b.Time, _ = time.Parse(time.RFC3339, datetime)
+		benchmarks = append(benchmarks, b)
+	}
+	return benchmarks, rows.Err()
+}
@@ -0,0 +1,369 @@
+package logger
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	. "q/types"
+)
+
+// NewConversationID generates the ID that groups the requests of one chat session
+func NewConversationID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "conv-" + hex.EncodeToString(b)
+}
+
+// conversationName derives a conversation's name from its first prompt
+func conversationName(prompt string) string {
+	name := strings.TrimSpace(prompt)
+	if i := strings.IndexByte(name, '\n'); i >= 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+	if runes := []rune(name); len(runes) > 60 {
+		name = string(runes[:57]) + "..."
+	}
+	return name
+}
+
+// conversationQuery reads conversations with their totals from the
+// conversation_usage rollup; forks nothing was asked in yet have no totals
+const conversationQuery = `
+	SELECT c.id, COALESCE(c.name, ''), COALESCE(c.model, ''), COALESCE(c.imported_from, ''),
+		COALESCE(u.requests, 0), COALESCE(u.cost, 0), COALESCE(u.first_utc, ''), COALESCE(u.last_utc, ''),
+		COALESCE(c.version, 0), COALESCE(c.parent_id, ''), COALESCE(c.fork_point, ''),
+		COALESCE(c.title, ''), COALESCE(c.summary, '')
+	FROM conversations c LEFT JOIN conversation_usage u ON u.conversation_id = c.id`
+
+func scanConversation(row interface{ Scan(...interface{}) error }) (Conversation, error) {
+	var conv Conversation
+	var started, updated string
+	if err := row.Scan(&conv.ID, &conv.Name, &conv.Model, &conv.ImportedFrom, &conv.Turns, &conv.Cost, &started, &updated,
+		&conv.Version, &conv.ParentID, &conv.ForkPoint, &conv.Title, &conv.Summary); err != nil {
+		return conv, err
+	}
+	conv.Started, _ = time.Parse(time.RFC3339, started)
+	conv.Updated, _ = time.Parse(time.RFC3339, updated)
+	return conv, nil
+}
+
+// ListConversations returns the most recently active conversations
+func (l *RequestLogger) ListConversations(limit int) ([]Conversation, error) {
+	if !l.enabled || l.db == nil {
+		return nil, nil
+	}
+	return l.queryConversations(conversationQuery+`
+		WHERE u.requests > 0 ORDER BY u.last_utc DESC LIMIT ?`, limit)
+}
+
+// CostliestConversations returns the conversations with the highest total cost
+func (l *RequestLogger) CostliestConversations(limit int) ([]Conversation, error) {
+	if !l.enabled || l.db == nil {
+		return nil, nil
+	}
+	return l.queryConversations(conversationQuery+`
+		WHERE u.requests > 0 ORDER BY u.cost DESC LIMIT ?`, limit)
+}
+
+func (l *RequestLogger) queryConversations(query string, args ...interface{}) ([]Conversation, error) {
+	rows, err := l.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		conv, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, conv)
+	}
+	return conversations, rows.Err()
+}
+
+// FindConversation looks up a conversation by its ID, the ID of one of its
+// requests, or "last" for the most recently active one
+func (l *RequestLogger) FindConversation(ref string) (Conversation, error) {
+	if !l.enabled || l.db == nil {
+		return Conversation{}, fmt.Errorf("logging is disabled")
+	}
+	if ref == "last" {
+		conversations, err := l.ListConversations(1)
+		if err != nil {
+			return Conversation{}, err
+		}
+		if len(conversations) == 0 {
+			return Conversation{}, fmt.Errorf("no conversations logged yet")
+		}
+		return conversations[0], nil
+	}
+
+	id := ref
+	var fromRequest string
+	err := l.db.QueryRow(`SELECT COALESCE(conversation_id, '') FROM responses WHERE id = ?`, ref).Scan(&fromRequest)
+	if err == nil && fromRequest != "" {
+		id = fromRequest
+	} else if err != nil && err != sql.ErrNoRows {
+		return Conversation{}, err
+	}
+
+	conv, err := scanConversation(l.db.QueryRow(conversationQuery+` WHERE c.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return conv, fmt.Errorf("no conversation with ID %s (see `q conversations`)", ref)
+	}
+	return conv, err
+}
+
+// ConversationEntries returns the successful requests of a conversation, oldest
+// first. A forked conversation starts with its parent's entries up to the fork.
+func (l *RequestLogger) ConversationEntries(id string) ([]LogEntry, error) {
+	if !l.enabled || l.db == nil {
+		return nil, fmt.Errorf("logging is disabled")
+	}
+
+	var entries []LogEntry
+	var parentID, forkPoint string
+	err := l.db.QueryRow(`SELECT COALESCE(parent_id, ''), COALESCE(fork_point, '') FROM conversations WHERE id = ?`, id).
+		Scan(&parentID, &forkPoint)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if parentID != "" {
+		parent, err := l.ConversationEntries(parentID)
+		if err != nil {
+			return nil, err
+		}
+		for i, entry := range parent {
+			if entry.RequestID == forkPoint {
+				entries = parent[:i+1]
+				break
+			}
+		}
+	}
+
+	own, err := l.BranchEntries(id)
+	return append(entries, own...), err
+}
+
+// BranchEntries returns the successful requests logged to a conversation
+// itself, oldest first, without any history it shares with a parent
+func (l *RequestLogger) BranchEntries(id string) ([]LogEntry, error) {
+	if !l.enabled || l.db == nil {
+		return nil, fmt.Errorf("logging is disabled")
+	}
+	rows, err := l.db.Query(`SELECT `+responseColumns+`
+		FROM responses
+		WHERE conversation_id = ? AND COALESCE(error, '') = ''
+		ORDER BY datetime_utc, rowid`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LogEntry
+	for rows.Next() {
+		entry, err := scanResponse(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Forks returns the conversations forked directly from id, oldest first
+func (l *RequestLogger) Forks(id string) ([]Conversation, error) {
+	if !l.enabled || l.db == nil {
+		return nil, nil
+	}
+	return l.queryConversations(conversationQuery+` WHERE c.parent_id = ? ORDER BY c.rowid`, id)
+}
+
+// ConflictError reports that another session added turns to a conversation
+// after this one loaded it
+type ConflictError struct {
+	ID       string
+	NewTurns int
+}
+
+func (e *ConflictError) Error() string {
+	turns := "a turn"
+	if e.NewTurns != 1 {
+		turns = fmt.Sprintf("%d turns", e.NewTurns)
+	}
+	return fmt.Sprintf("another session added %s to conversation %s since this one loaded it", turns, e.ID)
+}
+
+// conversationVersion returns a conversation's version, 0 if it hasn't been logged yet
+func conversationVersion(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, id string) (int, error) {
+	var version int
+	err := q.QueryRow(`SELECT COALESCE(version, 0) FROM conversations WHERE id = ?`, id).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// CheckConversation returns a *ConflictError if the conversation has moved on
+// from version, the version the caller last saw
+func (l *RequestLogger) CheckConversation(id string, version int) error {
+	if !l.enabled || l.db == nil {
+		return nil
+	}
+	current, err := conversationVersion(l.db, id)
+	if err != nil {
+		return err
+	}
+	if current != version {
+		return &ConflictError{ID: id, NewTurns: current - version}
+	}
+	return nil
+}
+
+// LogTurn logs an answer given in a conversation, advances the conversation's
+// version and returns the entry's ID. If another session advanced it past
+// version first, nothing is logged and a *ConflictError is returned, so turns
+// from two sessions never interleave.
+func (l *RequestLogger) LogTurn(entry LogEntry, version int) (string, error) {
+	if !l.enabled || l.db == nil {
+		return entry.RequestID, nil
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = newLocalID()
+	}
+	defer l.writeSpend()
+	defer l.shipDue()
+	tx, err := l.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	if err := l.logEntry(tx, entry); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	result, err := tx.Exec(`UPDATE conversations SET version = COALESCE(version, 0) + 1
+		WHERE id = ? AND COALESCE(version, 0) = ?`, entry.ConversationID, version)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		current, err := conversationVersion(tx, entry.ConversationID)
+		tx.Rollback()
+		if err != nil {
+			return "", err
+		}
+		return "", &ConflictError{ID: entry.ConversationID, NewTurns: current - version}
+	}
+	return entry.RequestID, tx.Commit()
+}
+
+// ForkConversation creates a conversation that shares the history of parentID
+// up to and including the response forkPoint, and returns its ID. The fork is
+// listed once its first turn is logged.
+func (l *RequestLogger) ForkConversation(parentID, forkPoint string) (string, error) {
+	if !l.enabled || l.db == nil {
+		return "", fmt.Errorf("logging is disabled, so conversations can't be forked")
+	}
+	id := NewConversationID()
+	result, err := l.db.Exec(`
+		INSERT INTO conversations (id, name, model, parent_id, fork_point)
+		SELECT ?, name, model, id, ? FROM conversations WHERE id = ?`,
+		id, forkPoint, parentID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return "", fmt.Errorf("no conversation with ID %s", parentID)
+	}
+	return id, nil
+}
+
+// ImportConversation stores a transcript as a new conversation, one log entry
+// per prompt and answer, keeping the original timestamps. source is recorded
+// as where the conversation came from.
+func (l *RequestLogger) ImportConversation(transcript Transcript, source string) (string, error) {
+	if !l.enabled || l.db == nil {
+		return "", fmt.Errorf("logging is disabled, so conversations can't be imported")
+	}
+
+	id := NewConversationID()
+	var entries []LogEntry
+	// history is what a live session would have sent before each prompt
+	var history []Message
+	messages := transcript.Messages
+	for i := 0; i < len(messages); i++ {
+		msg := messages[i]
+		switch msg.Role {
+		case "system":
+			history = append(history, Message{Role: "system", Content: msg.Content})
+			continue
+		case "user":
+		default:
+			return "", fmt.Errorf("message %d: expected a user or system message, got %q", i+1, msg.Role)
+		}
+
+		entry := LogEntry{
+			Timestamp:      msg.Timestamp,
+			Model:          transcript.Model,
+			ConversationID: id,
+			RequestID:      newLocalID(),
+		}
+		entry.Messages = append(append([]Message{}, history...), Message{Role: "user", Content: msg.Content})
+		history = append(history, Message{Role: "user", Content: msg.Content})
+		if i+1 < len(messages) && messages[i+1].Role == "assistant" {
+			i++
+			answer := messages[i]
+			entry.Response = answer.Content
+			history = append(history, Message{Role: "assistant", Content: answer.Content})
+			if answer.Model != "" {
+				entry.Model = answer.Model
+			}
+			if !answer.Timestamp.IsZero() {
+				if !msg.Timestamp.IsZero() {
+					entry.DurationMs = answer.Timestamp.Sub(msg.Timestamp).Milliseconds()
+				}
+				entry.Timestamp = answer.Timestamp
+			}
+		}
+		if entry.Timestamp.IsZero() {
+			entry.Timestamp = time.Now()
+		}
+		entry.Timestamp = entry.Timestamp.UTC()
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("the transcript has no prompts")
+	}
+
+	name := transcript.Name
+	if name == "" {
+		name = conversationName(entries[0].Messages[len(entries[0].Messages)-1].Content)
+	}
+	tx, err := l.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO conversations (id, name, model, imported_from) VALUES (?, ?, ?, ?)`,
+		id, name, transcript.Model, source,
+	); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	for _, entry := range entries {
+		if err := l.insertResponse(tx, entry); err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+	return id, tx.Commit()
+}
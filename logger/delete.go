@@ -0,0 +1,145 @@
+package logger
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Redacted replaces the text of a redacted entry
+const Redacted = "[redacted]"
+
+// DeleteResponse removes one logged response, the errors recorded for it, its
+// record if it's still waiting for the sink, and its conversation if no other
+// turns are left in it. The usage rollups follow through their triggers.
+func (l *RequestLogger) DeleteResponse(id string) error {
+	if !l.enabled || l.db == nil {
+		return fmt.Errorf("logging is disabled")
+	}
+	if audit {
+		return ErrAudit
+	}
+	defer l.writeSpend()
+	return l.scrub(func(tx *sql.Tx) error {
+		var conversationID sql.NullString
+		err := tx.QueryRow(`SELECT conversation_id FROM responses WHERE id = ?`, id).Scan(&conversationID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no log entry with ID %s", id)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM responses WHERE id = ?`, id); err != nil {
+			return err
+		}
+		for _, table := range []string{"errors", "sink_queue"} {
+			if _, err := tx.Exec(`DELETE FROM `+table+` WHERE request_id = ?`, id); err != nil {
+				return err
+			}
+		}
+		if !conversationID.Valid {
+			return nil
+		}
+		_, err = tx.Exec(`
+			DELETE FROM conversations WHERE id = ?
+			AND NOT EXISTS (SELECT 1 FROM responses WHERE conversation_id = ?)`,
+			conversationID.String, conversationID.String)
+		return err
+	})
+}
+
+// RedactResponse replaces the text of a logged response (its prompt, system
+// prompt, earlier turns, answer, reasoning, context and the raw request and
+// response) with Redacted, keeping the model, tokens, cost and timing for
+// accounting. If it's still waiting for the sink, the redacted entry is sent
+// instead.
+func (l *RequestLogger) RedactResponse(id string) error {
+	if !l.enabled || l.db == nil {
+		return fmt.Errorf("logging is disabled")
+	}
+	if audit {
+		return ErrAudit
+	}
+	return l.scrub(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			UPDATE responses SET
+				prompt = ?, response = ?,
+				system = CASE WHEN COALESCE(system, '') = '' THEN system ELSE ? END,
+				reasoning = CASE WHEN COALESCE(reasoning, '') = '' THEN reasoning ELSE ? END,
+				context_note = NULL, citations = NULL, urls = NULL, messages = NULL,
+				request_raw = NULL, request_headers = NULL, response_raw = NULL
+			WHERE id = ?`,
+			Redacted, Redacted, Redacted, Redacted, id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return fmt.Errorf("no log entry with ID %s", id)
+		}
+		if _, err := tx.Exec(`UPDATE errors SET detail = NULL WHERE request_id = ?`, id); err != nil {
+			return err
+		}
+		result, err = tx.Exec(`DELETE FROM sink_queue WHERE request_id = ?`, id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		entry, err := scanResponse(tx.QueryRow(`SELECT `+responseColumns+` FROM responses WHERE id = ?`, id))
+		if err != nil {
+			return err
+		}
+		return l.enqueue(tx, entry)
+	})
+}
+
+// Purge deletes every logged response, conversation, batch and error, any
+// records waiting for the sink, any prompts queued while offline and any
+// unsent drafts, and compacts the database file
+func (l *RequestLogger) Purge() error {
+	if !l.enabled || l.db == nil {
+		return fmt.Errorf("logging is disabled")
+	}
+	if audit {
+		return ErrAudit
+	}
+	if err := l.Flush(); err != nil {
+		return err
+	}
+	defer l.writeSpend()
+	err := l.scrub(func(tx *sql.Tx) error {
+		for _, table := range []string{"responses", "conversations", "batches", "errors", "sink_queue", "prompt_queue", "drafts"} {
+			if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = l.db.Exec(`VACUUM`)
+	return err
+}
+
+// scrub runs fn in a transaction with secure_delete on, so the removed text
+// is overwritten in the database file rather than left in free pages, and
+// then checkpoints the WAL so the old pages don't linger there either
+func (l *RequestLogger) scrub(fn func(tx *sql.Tx) error) error {
+	if _, err := l.db.Exec(`PRAGMA secure_delete = ON`); err != nil {
+		return err
+	}
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	_, err = l.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
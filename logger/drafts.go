@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+
+	. "q/types"
+)
+
+// draftExpiry is how long an abandoned draft is kept for restoring
+const draftExpiry = 30 * 24 * time.Hour
+
+// initDrafts creates the table of prompts being written in interactive
+// sessions, one per session
+func (l *RequestLogger) initDrafts() error {
+	_, err := l.db.Exec(`
+	CREATE TABLE IF NOT EXISTS drafts (
+		session TEXT PRIMARY KEY,
+		pid INTEGER NOT NULL,
+		saved_utc TEXT NOT NULL,
+		text TEXT NOT NULL,
+		sent INTEGER NOT NULL DEFAULT 0
+	)`)
+	return err
+}
+
+// SaveDraft keeps a session's draft in place of the one it saved before; an
+// empty one is dropped
+func (l *RequestLogger) SaveDraft(draft Draft) error {
+	if !l.enabled || l.db == nil {
+		return fmt.Errorf("logging is disabled")
+	}
+	if draft.Text == "" {
+		return l.DropDraft(draft.Session)
+	}
+	if draft.SavedAt.IsZero() {
+		draft.SavedAt = time.Now()
+	}
+	_, err := l.db.Exec(`INSERT OR REPLACE INTO drafts (session, pid, saved_utc, text, sent) VALUES (?, ?, ?, ?, ?)`,
+		draft.Session, draft.PID, draft.SavedAt.UTC().Format(time.RFC3339Nano), draft.Text, draft.Sent)
+	return err
+}
+
+// DropDraft removes a session's draft, once it's answered or cleared
+func (l *RequestLogger) DropDraft(session string) error {
+	if !l.enabled || l.db == nil {
+		return fmt.Errorf("logging is disabled")
+	}
+	_, err := l.db.Exec(`DELETE FROM drafts WHERE session = ?`, session)
+	return err
+}
+
+// TakeDraft removes and returns the latest draft left by a session that's
+// over, as running tells from its process ID, so it's restored only once.
+// Drafts older than 30 days are dropped. It returns nil if there's none.
+func (l *RequestLogger) TakeDraft(running func(pid int) bool) (*Draft, error) {
+	if !l.enabled || l.db == nil {
+		return nil, fmt.Errorf("logging is disabled")
+	}
+	if _, err := l.db.Exec(`DELETE FROM drafts WHERE saved_utc < ?`,
+		time.Now().Add(-draftExpiry).UTC().Format(time.RFC3339Nano)); err != nil {
+		return nil, err
+	}
+	rows, err := l.db.Query(`SELECT session, pid, saved_utc, text, sent FROM drafts ORDER BY saved_utc DESC`)
+	if err != nil {
+		return nil, err
+	}
+	var found *Draft
+	for rows.Next() {
+		var draft Draft
+		var saved string
+		if err := rows.Scan(&draft.Session, &draft.PID, &saved, &draft.Text, &draft.Sent); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if running(draft.PID) {
+			continue
+		}
+		draft.SavedAt, _ = time.Parse(time.RFC3339Nano, saved)
+		found = &draft
+		break
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, nil
+	}
+	return found, l.DropDraft(found.Session)
+}
@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+
+	. "q/types"
+)
+
+// maxErrorDetail caps the detail stored with an error, such as a response body
+const maxErrorDetail = 4096
+
+// LogError records a transport, HTTP or stream parsing error in the errors table
+func (l *RequestLogger) LogError(record ErrorRecord) error {
+	if !l.enabled || l.db == nil {
+		return nil
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+	if len(record.Detail) > maxErrorDetail {
+		record.Detail = record.Detail[:maxErrorDetail]
+	}
+	_, err := l.db.Exec(
+		`INSERT INTO errors (datetime_utc, kind, model, request_id, message, detail) VALUES (?, ?, ?, ?, ?, ?)`,
+		record.Timestamp.UTC().Format(time.RFC3339),
+		record.Kind,
+		record.Model,
+		nullIfEmpty(record.RequestID),
+		record.Message,
+		nullIfEmpty(record.Detail),
+	)
+	return err
+}
+
+// ErrorsAfter returns the errors recorded after the one with the given ID,
+// oldest first, with only their ID, kind and model set
+func (l *RequestLogger) ErrorsAfter(id int64) ([]ErrorRecord, error) {
+	if !l.enabled || l.db == nil {
+		return nil, fmt.Errorf("logging is disabled")
+	}
+	rows, err := l.db.Query(`SELECT id, kind, COALESCE(model, '') FROM errors WHERE id > ? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []ErrorRecord
+	for rows.Next() {
+		var record ErrorRecord
+		if err := rows.Scan(&record.ID, &record.Kind, &record.Model); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// RecentErrors returns the latest recorded errors, newest first, optionally
+// only those of one kind
+func (l *RequestLogger) RecentErrors(kind string, limit int) ([]ErrorRecord, error) {
+	if !l.enabled || l.db == nil {
+		return nil, fmt.Errorf("logging is disabled")
+	}
+	rows, err := l.db.Query(`
+		SELECT id, datetime_utc, kind, model, COALESCE(request_id, ''), message, COALESCE(detail, '')
+		FROM errors WHERE ? = '' OR kind = ?
+		ORDER BY id DESC LIMIT ?`, kind, kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []ErrorRecord
+	for rows.Next() {
+		var record ErrorRecord
+		var datetimeStr string
+		if err := rows.Scan(&record.ID, &datetimeStr, &record.Kind, &record.Model, &record.RequestID, &record.Message, &record.Detail); err != nil {
+			return nil, err
+		}
+		record.Timestamp, _ = time.Parse(time.RFC3339, datetimeStr)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
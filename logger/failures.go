@@ -0,0 +1,214 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errorCode is a short code for a failed request: the code or HTTP status the
+// provider sent (errors with an ErrorCode method know it), or the kind of
+// failure
+func errorCode(err error) string {
+	var coded interface{ ErrorCode() string }
+	if errors.As(err, &coded) {
+		return coded.ErrorCode()
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case netErr != nil:
+		return "transport"
+	}
+	return "other"
+}
+
+// apiStatus finds the HTTP status in the error of a failed request
+var apiStatus = regexp.MustCompile(`API request failed: (\d{3})`)
+
+// legacyErrorCode guesses the code of an error logged before codes were kept
+func legacyErrorCode(message string) string {
+	if m := apiStatus.FindStringSubmatch(message); m != nil {
+		return m[1]
+	}
+	switch {
+	case strings.Contains(message, "stream stalled"):
+		return "stalled"
+	case strings.Contains(message, "failed to make the API request"):
+		return "transport"
+	}
+	return "other"
+}
+
+// FailureStats counts the failed requests under a grouping key (a model, an
+// endpoint or a day)
+type FailureStats struct {
+	Key      string
+	Requests int
+	Failures int
+	// Retries is the total of times requests were sent again with another key
+	Retries int
+	// First and Last are when the first and last failures happened
+	First, Last time.Time
+}
+
+// Rate is the share of requests that failed
+func (s FailureStats) Rate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Requests)
+}
+
+// AvgRetries is how many times a request was retried on average
+func (s FailureStats) AvgRetries() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Retries) / float64(s.Requests)
+}
+
+// MTBF is the mean time between failures, or 0 with fewer than two
+func (s FailureStats) MTBF() time.Duration {
+	if s.Failures < 2 {
+		return 0
+	}
+	return s.Last.Sub(s.First) / time.Duration(s.Failures-1)
+}
+
+func (s *FailureStats) add(at time.Time, failed bool, retries int) {
+	s.Requests++
+	s.Retries += retries
+	if !failed {
+		return
+	}
+	s.Failures++
+	if s.First.IsZero() || at.Before(s.First) {
+		s.First = at
+	}
+	if at.After(s.Last) {
+		s.Last = at
+	}
+}
+
+// ErrorCount is how often requests failed with an error code
+type ErrorCount struct {
+	Code  string
+	Count int
+	// Example is the latest error message with the code
+	Example string
+}
+
+// FailureReport breaks down failed requests over a period
+type FailureReport struct {
+	Total FailureStats
+	// Models and Endpoints are ordered by failure rate, Days by day
+	Models    []FailureStats
+	Endpoints []FailureStats
+	Days      []FailureStats
+	// Codes are the error codes, most common first
+	Codes []ErrorCount
+}
+
+// FailureAnalysis looks at the requests logged in [since, until) for how
+// often and how they failed. Requests logged before endpoints were kept are
+// grouped under "unknown".
+func (l *RequestLogger) FailureAnalysis(since, until time.Time) (FailureReport, error) {
+	var report FailureReport
+	if !l.enabled || l.db == nil {
+		return report, nil
+	}
+	rows, err := l.db.Query(`
+		SELECT datetime_utc, model, COALESCE(endpoint, ''), COALESCE(error, ''),
+		       COALESCE(error_code, ''), COALESCE(retries, 0)
+		FROM responses
+		WHERE datetime_utc >= ? AND datetime_utc < ? AND image IS NULL AND COALESCE(audio_seconds, 0) = 0
+		ORDER BY datetime_utc`,
+		since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	models := map[string]*FailureStats{}
+	endpoints := map[string]*FailureStats{}
+	days := map[string]*FailureStats{}
+	codes := map[string]*ErrorCount{}
+	group := func(groups map[string]*FailureStats, key string) *FailureStats {
+		if groups[key] == nil {
+			groups[key] = &FailureStats{Key: key}
+		}
+		return groups[key]
+	}
+	for rows.Next() {
+		var datetimeStr, model, endpoint, message, code string
+		var retries int
+		if err := rows.Scan(&datetimeStr, &model, &endpoint, &message, &code, &retries); err != nil {
+			return report, err
+		}
+		at, _ := time.Parse(time.RFC3339, datetimeStr)
+		failed := message != ""
+		if endpoint == "" {
+			endpoint = "unknown"
+		}
+		report.Total.add(at, failed, retries)
+		group(models, model).add(at, failed, retries)
+		group(endpoints, endpoint).add(at, failed, retries)
+		group(days, at.Format("2006-01-02")).add(at, failed, retries)
+		if !failed {
+			continue
+		}
+		if code == "" {
+			code = legacyErrorCode(message)
+		}
+		if codes[code] == nil {
+			codes[code] = &ErrorCount{Code: code}
+		}
+		codes[code].Count++
+		codes[code].Example = message
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	report.Models = sortedByRate(models)
+	report.Endpoints = sortedByRate(endpoints)
+	for _, day := range days {
+		report.Days = append(report.Days, *day)
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Key < report.Days[j].Key })
+	for _, code := range codes {
+		report.Codes = append(report.Codes, *code)
+	}
+	sort.Slice(report.Codes, func(i, j int) bool {
+		if report.Codes[i].Count != report.Codes[j].Count {
+			return report.Codes[i].Count > report.Codes[j].Count
+		}
+		return report.Codes[i].Code < report.Codes[j].Code
+	})
+	return report, nil
+}
+
+// sortedByRate lists groups with the highest failure rate first, the busiest
+// first among equals
+func sortedByRate(groups map[string]*FailureStats) []FailureStats {
+	var sorted []FailureStats
+	for _, s := range groups {
+		sorted = append(sorted, *s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Rate() != sorted[j].Rate() {
+			return sorted[i].Rate() > sorted[j].Rate()
+		}
+		if sorted[i].Requests != sorted[j].Requests {
+			return sorted[i].Requests > sorted[j].Requests
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
@@ -0,0 +1,37 @@
+package logger
+
+// imagePricing is the price in USD of one image, by model and then quality and size
+var imagePricing = map[string]map[string]float64{
+	"gpt-image-1": {
+		"low/1024x1024":    0.011,
+		"low/1024x1536":    0.016,
+		"low/1536x1024":    0.016,
+		"medium/1024x1024": 0.042,
+		"medium/1024x1536": 0.063,
+		"medium/1536x1024": 0.063,
+		"high/1024x1024":   0.167,
+		"high/1024x1536":   0.25,
+		"high/1536x1024":   0.25,
+	},
+	"dall-e-3": {
+		"standard/1024x1024": 0.040,
+		"standard/1024x1792": 0.080,
+		"standard/1792x1024": 0.080,
+		"hd/1024x1024":       0.080,
+		"hd/1024x1792":       0.120,
+		"hd/1792x1024":       0.120,
+	},
+	"dall-e-2": {
+		"standard/256x256":   0.016,
+		"standard/512x512":   0.018,
+		"standard/1024x1024": 0.020,
+	},
+}
+
+// ImageCost estimates the cost in USD of one image (0 if the price is unknown)
+func ImageCost(model, size, quality string) float64 {
+	if quality == "" {
+		quality = "standard"
+	}
+	return imagePricing[model][quality+"/"+size]
+}
@@ -1,14 +1,21 @@
 package logger
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"q/provider"
+	"q/spend"
 	. "q/types"
+	"q/workspace"
 )
 
 // Model pricing as of December 2024 (per 1M tokens)
@@ -25,6 +32,35 @@ var modelPricing = map[string]ModelPricing{
 type RequestLogger struct {
 	db      *sql.DB
 	enabled bool
+	// spendPath is the workspace's spend file, kept up to date for shell
+	// prompts (see q/spend)
+	spendPath string
+
+	// statements prepared once and reused for every logged response
+	conversationStmt *sql.Stmt
+	responseStmt     *sql.Stmt
+
+	// pending holds responses not yet written while buffering; guarded by mu
+	// since batch workers log from several goroutines
+	mu         sync.Mutex
+	bufferSize int
+	pending    []LogEntry
+}
+
+var (
+	sharedOnce   sync.Once
+	sharedLogger *RequestLogger
+	sharedErr    error
+)
+
+// Shared returns a logger opened once per process and shared by every client,
+// since `q batch` creates one client per worker and opening the database
+// again for each would repeat the schema checks
+func Shared() (*RequestLogger, error) {
+	sharedOnce.Do(func() {
+		sharedLogger, sharedErr = NewRequestLogger()
+	})
+	return sharedLogger, sharedErr
 }
 
 // NewRequestLogger creates a new SQLite-based logger
@@ -33,31 +69,58 @@ func NewRequestLogger() (*RequestLogger, error) {
 		return &RequestLogger{enabled: false}, nil
 	}
 
-	homeDir, err := os.UserHomeDir()
+	logDir, err := workspace.Dir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return nil, err
 	}
-
-	logDir := filepath.Join(homeDir, ".shell-ai")
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create log directory: %w", err)
 	}
 
 	dbPath := filepath.Join(logDir, "logs.db")
-	db, err := sql.Open("sqlite3", dbPath)
+	// Wait for writers in other processes instead of failing with "database is
+	// locked". With WAL, readers don't block the writer, and NORMAL sync only
+	// risks the latest writes on power loss, never corruption.
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000&_journal_mode=WAL&_synchronous=NORMAL")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	// SQLite takes one writer at a time anyway; a single connection keeps the
+	// prepared statements and the page cache warm
+	db.SetMaxOpenConns(1)
 
-	logger := &RequestLogger{db: db, enabled: true}
+	logger := &RequestLogger{db: db, enabled: true, spendPath: filepath.Join(logDir, spend.FileName)}
 	if err := logger.initSchema(); err != nil {
-		db.Close()
+		logger.Close()
 		return nil, err
 	}
 
 	return logger, nil
 }
 
+// prepare prepares the statements used to log responses, once the schema is up to date
+func (l *RequestLogger) prepare() error {
+	var err error
+	l.conversationStmt, err = l.db.Prepare(`INSERT OR IGNORE INTO conversations (id, name, model) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	l.responseStmt, err = l.db.Prepare(`
+		INSERT INTO responses (
+			id, model, prompt, system, response,
+			conversation_id, duration_ms, datetime_utc,
+			input_tokens, output_tokens, estimated_cost,
+			error, output_path, persona, context_note, batch_id,
+			regenerated_from, request_raw, response_raw, routed_from,
+			citations, interrupted, tokens_estimated, urls, key_alias,
+			reasoning, image, audio_seconds, stopped_early, language,
+			request_headers, messages, error_code, endpoint, retries,
+			sample_group
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	return err
+}
+
 // initSchema creates the database schema if it doesn't exist
 func (l *RequestLogger) initSchema() error {
 	schema := `
@@ -84,19 +147,222 @@ func (l *RequestLogger) initSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_responses_datetime ON responses(datetime_utc);
 	CREATE INDEX IF NOT EXISTS idx_responses_conversation ON responses(conversation_id);
 	CREATE INDEX IF NOT EXISTS idx_responses_model ON responses(model);
+
+	CREATE TABLE IF NOT EXISTS batches (
+		id TEXT PRIMARY KEY,
+		model TEXT,
+		endpoint TEXT,
+		status TEXT,
+		created_utc TEXT,
+		imported_utc TEXT,
+		requests TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS errors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		datetime_utc TEXT,
+		kind TEXT,
+		model TEXT,
+		request_id TEXT,
+		message TEXT,
+		detail TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_errors_datetime ON errors(datetime_utc);
 	`
 
-	_, err := l.db.Exec(schema)
-	return err
+	if _, err := l.db.Exec(schema); err != nil {
+		return err
+	}
+	if err := l.migrate(); err != nil {
+		return err
+	}
+	if err := l.initRollups(); err != nil {
+		return err
+	}
+	if err := l.initSearch(); err != nil {
+		return err
+	}
+	if err := l.initSinkQueue(); err != nil {
+		return err
+	}
+	if err := l.initPromptQueue(); err != nil {
+		return err
+	}
+	if err := l.initPending(); err != nil {
+		return err
+	}
+	if err := l.initDrafts(); err != nil {
+		return err
+	}
+	if err := l.initAudit(); err != nil {
+		return err
+	}
+	if err := l.initBenchmarks(); err != nil {
+		return err
+	}
+	return l.prepare()
+}
+
+// columnMigrations adds columns introduced after the initial schema,
+// so databases created by older versions keep working
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"responses", "error", "TEXT"},
+	{"responses", "output_path", "TEXT"},
+	{"responses", "persona", "TEXT"},
+	{"responses", "context_note", "TEXT"},
+	{"responses", "batch_id", "TEXT"},
+	{"responses", "regenerated_from", "TEXT"},
+	{"responses", "request_raw", "TEXT"},
+	{"responses", "response_raw", "TEXT"},
+	{"responses", "routed_from", "TEXT"},
+	{"responses", "citations", "TEXT"},
+	{"conversations", "imported_from", "TEXT"},
+	{"responses", "interrupted", "INTEGER"},
+	{"responses", "tokens_estimated", "INTEGER"},
+	{"conversations", "version", "INTEGER"},
+	{"conversations", "parent_id", "TEXT"},
+	{"conversations", "fork_point", "TEXT"},
+	{"conversations", "title", "TEXT"},
+	{"conversations", "summary", "TEXT"},
+	{"responses", "urls", "TEXT"},
+	{"responses", "key_alias", "TEXT"},
+	{"responses", "reasoning", "TEXT"},
+	{"responses", "image", "TEXT"},
+	{"responses", "audio_seconds", "REAL"},
+	{"responses", "stopped_early", "INTEGER"},
+	{"responses", "language", "TEXT"},
+	{"responses", "request_headers", "TEXT"},
+	{"responses", "messages", "TEXT"},
+	{"responses", "error_code", "TEXT"},
+	{"responses", "endpoint", "TEXT"},
+	{"responses", "retries", "INTEGER"},
+	{"responses", "prev_hash", "TEXT"},
+	{"responses", "row_hash", "TEXT"},
+	{"responses", "sample_group", "TEXT"},
+}
+
+// migrate applies any column migrations missing from the database
+func (l *RequestLogger) migrate() error {
+	for _, m := range columnMigrations {
+		exists, err := l.hasColumn(m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)
+		if _, err := l.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to migrate %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
 }
 
-// LogResponse logs a single request/response to the database
+func (l *RequestLogger) hasColumn(table, column string) (bool, error) {
+	rows, err := l.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// LogResponse logs a single request/response to the database. While
+// buffering, it's held until the buffer fills or Flush is called.
 func (l *RequestLogger) LogResponse(entry LogEntry) error {
 	if !l.enabled || l.db == nil {
 		return nil
 	}
+	// Deferred first so they run after the unlock, without holding up other workers
+	defer l.writeSpend()
+	defer l.shipDue()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.bufferSize <= 1 {
+		return l.logEntry(nil, entry)
+	}
+	l.pending = append(l.pending, entry)
+	if len(l.pending) < l.bufferSize {
+		return nil
+	}
+	return l.flushLocked()
+}
 
-	// Extract system message from messages
+// Buffer makes LogResponse hold up to size responses and write them in one
+// transaction, for runs logging hundreds of them. A size of 0 or 1 writes
+// each at once again, after flushing what's held.
+func (l *RequestLogger) Buffer(size int) error {
+	if !l.enabled || l.db == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bufferSize = size
+	if size <= 1 {
+		return l.flushLocked()
+	}
+	return nil
+}
+
+// Flush writes the responses held while buffering
+func (l *RequestLogger) Flush() error {
+	if !l.enabled || l.db == nil {
+		return nil
+	}
+	defer l.writeSpend()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.flushLocked()
+}
+
+func (l *RequestLogger) flushLocked() error {
+	if len(l.pending) == 0 {
+		return nil
+	}
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, entry := range l.pending {
+		if err := l.logEntry(tx, entry); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	l.pending = nil
+	return nil
+}
+
+// insertResponse writes an entry with the prepared statements, inside tx if given
+func (l *RequestLogger) insertResponse(tx *sql.Tx, entry LogEntry) error {
+	// The latest system and user messages also go in their own columns, for
+	// search and the reports; messages keeps the whole exchange
 	var systemMsg string
 	var promptMsg string
 	for _, msg := range entry.Messages {
@@ -107,30 +373,234 @@ func (l *RequestLogger) LogResponse(entry LogEntry) error {
 		}
 	}
 
-	query := `
-		INSERT INTO responses (
-			id, model, prompt, system, response,
-			conversation_id, duration_ms, datetime_utc,
-			input_tokens, output_tokens, estimated_cost
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
+	var citations interface{}
+	if len(entry.Citations) > 0 {
+		data, err := json.Marshal(entry.Citations)
+		if err != nil {
+			return err
+		}
+		citations = string(data)
+	}
+	var urls interface{}
+	if len(entry.URLs) > 0 {
+		data, err := json.Marshal(entry.URLs)
+		if err != nil {
+			return err
+		}
+		urls = string(data)
+	}
+	var image interface{}
+	if entry.Image != nil {
+		data, err := json.Marshal(entry.Image)
+		if err != nil {
+			return err
+		}
+		image = string(data)
+	}
+	var headers interface{}
+	if len(entry.RequestHeaders) > 0 {
+		data, err := json.Marshal(entry.RequestHeaders)
+		if err != nil {
+			return err
+		}
+		headers = string(data)
+	}
+	var messages interface{}
+	if len(entry.Messages) > 0 {
+		data, err := json.Marshal(entry.Messages)
+		if err != nil {
+			return err
+		}
+		messages = string(data)
+	}
 
-	_, err := l.db.Exec(
-		query,
-		entry.RequestID,
+	conversationStmt, responseStmt := l.conversationStmt, l.responseStmt
+	if tx != nil {
+		conversationStmt, responseStmt = tx.Stmt(conversationStmt), tx.Stmt(responseStmt)
+	}
+
+	if entry.ConversationID != "" {
+		if _, err := conversationStmt.Exec(entry.ConversationID, conversationName(promptMsg), entry.Model); err != nil {
+			return err
+		}
+	}
+
+	// Failed requests often never receive a provider ID
+	requestID := entry.RequestID
+	if requestID == "" {
+		requestID = newLocalID()
+	}
+
+	_, err := responseStmt.Exec(
+		requestID,
 		entry.Model,
 		promptMsg,
 		systemMsg,
 		entry.Response,
-		nil, // conversation_id - can be added later
+		nullIfEmpty(entry.ConversationID),
 		entry.DurationMs,
 		entry.Timestamp.Format(time.RFC3339),
 		entry.PromptTokens,
 		entry.CompletionTokens,
 		entry.EstimatedCost,
+		entry.Error,
+		entry.OutputPath,
+		entry.Persona,
+		entry.ContextNote,
+		entry.BatchID,
+		entry.RegeneratedFrom,
+		nullIfEmpty(entry.RequestRaw),
+		nullIfEmpty(entry.ResponseRaw),
+		entry.RoutedFrom,
+		citations,
+		entry.Interrupted,
+		entry.TokensEstimated,
+		urls,
+		entry.KeyAlias,
+		nullIfEmpty(entry.Reasoning),
+		image,
+		entry.AudioSeconds,
+		entry.StoppedEarly,
+		nullIfEmpty(entry.Language),
+		headers,
+		messages,
+		nullIfEmpty(entry.ErrorCode),
+		nullIfEmpty(entry.Endpoint),
+		entry.Retries,
+		nullIfEmpty(entry.SampleGroup),
 	)
+	if err != nil || !audit {
+		return err
+	}
+	return chain(tx, requestID)
+}
 
-	return err
+// logEntry writes a response this machine made, and queues it for the sink
+func (l *RequestLogger) logEntry(tx *sql.Tx, entry LogEntry) error {
+	if tx == nil && audit {
+		// The response is chained to the one before in the same transaction
+		tx, err := l.db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := l.logEntry(tx, entry); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = newLocalID()
+	}
+	if err := l.insertResponse(tx, entry); err != nil {
+		return err
+	}
+	return l.enqueue(tx, entry)
+}
+
+// nullIfEmpty stores empty optional blobs as NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// newLocalID generates an ID for entries the provider didn't assign one to
+func newLocalID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return fmt.Sprintf("local-%x-%s", time.Now().UnixNano(), hex.EncodeToString(b))
+}
+
+// responseColumns are the columns read back into a LogEntry by scanResponse
+const responseColumns = `
+	id, model, prompt, system, response,
+	datetime_utc, input_tokens, output_tokens,
+	estimated_cost, duration_ms, COALESCE(error, ''),
+	COALESCE(output_path, ''), COALESCE(persona, ''),
+	COALESCE(context_note, ''), COALESCE(batch_id, ''),
+	COALESCE(regenerated_from, ''), COALESCE(routed_from, ''),
+	COALESCE(citations, ''), COALESCE(conversation_id, ''),
+	COALESCE(interrupted, 0), COALESCE(tokens_estimated, 0),
+	COALESCE(urls, ''), COALESCE(key_alias, ''), COALESCE(reasoning, ''),
+	COALESCE(image, ''), COALESCE(audio_seconds, 0), COALESCE(stopped_early, 0),
+	COALESCE(language, ''), COALESCE(messages, ''), COALESCE(error_code, ''),
+	COALESCE(endpoint, ''), COALESCE(retries, 0), COALESCE(sample_group, '')`
+
+func scanResponse(row interface{ Scan(...interface{}) error }) (LogEntry, error) {
+	var entry LogEntry
+	var datetimeStr string
+	var systemMsg, promptMsg sql.NullString
+	var citations, urls, image, messages string
+
+	err := row.Scan(
+		&entry.RequestID,
+		&entry.Model,
+		&promptMsg,
+		&systemMsg,
+		&entry.Response,
+		&datetimeStr,
+		&entry.PromptTokens,
+		&entry.CompletionTokens,
+		&entry.EstimatedCost,
+		&entry.DurationMs,
+		&entry.Error,
+		&entry.OutputPath,
+		&entry.Persona,
+		&entry.ContextNote,
+		&entry.BatchID,
+		&entry.RegeneratedFrom,
+		&entry.RoutedFrom,
+		&citations,
+		&entry.ConversationID,
+		&entry.Interrupted,
+		&entry.TokensEstimated,
+		&urls,
+		&entry.KeyAlias,
+		&entry.Reasoning,
+		&image,
+		&entry.AudioSeconds,
+		&entry.StoppedEarly,
+		&entry.Language,
+		&messages,
+		&entry.ErrorCode,
+		&entry.Endpoint,
+		&entry.Retries,
+		&entry.SampleGroup,
+	)
+	if err != nil {
+		return entry, err
+	}
+	if citations != "" {
+		json.Unmarshal([]byte(citations), &entry.Citations)
+	}
+	if urls != "" {
+		json.Unmarshal([]byte(urls), &entry.URLs)
+	}
+	if image != "" {
+		entry.Image = &ImageRecord{}
+		json.Unmarshal([]byte(image), entry.Image)
+	}
+	entry.TotalTokens = entry.PromptTokens + entry.CompletionTokens
+
+	// Entries logged before the whole exchange was kept (or redacted since)
+	// only have the latest system and user message
+	if messages != "" {
+		json.Unmarshal([]byte(messages), &entry.Messages)
+	}
+	if len(entry.Messages) == 0 {
+		if systemMsg.String != "" {
+			entry.Messages = append(entry.Messages, Message{Role: "system", Content: systemMsg.String})
+		}
+		if promptMsg.String != "" {
+			entry.Messages = append(entry.Messages, Message{Role: "user", Content: promptMsg.String})
+		}
+	}
+
+	// Parse timestamp
+	entry.Timestamp, _ = time.Parse(time.RFC3339, datetimeStr)
+	return entry, nil
 }
 
 // GetRecentResponses retrieves the N most recent responses
@@ -139,16 +609,29 @@ func (l *RequestLogger) GetRecentResponses(limit int) ([]LogEntry, error) {
 		return nil, nil
 	}
 
-	query := `
-		SELECT id, model, prompt, system, response,
-		       datetime_utc, input_tokens, output_tokens,
-		       estimated_cost, duration_ms
+	return l.recentResponses(`SELECT `+responseColumns+`
 		FROM responses
 		ORDER BY datetime_utc DESC
 		LIMIT ?
-	`
+	`, limit)
+}
 
-	rows, err := l.db.Query(query, limit)
+// RecentResponsesIn retrieves the most recent responses asked for in a
+// language (see LogEntry.Language)
+func (l *RequestLogger) RecentResponsesIn(language string, limit int) ([]LogEntry, error) {
+	if !l.enabled || l.db == nil {
+		return nil, nil
+	}
+	return l.recentResponses(`SELECT `+responseColumns+`
+		FROM responses
+		WHERE language = ? COLLATE NOCASE
+		ORDER BY datetime_utc DESC
+		LIMIT ?
+	`, language, limit)
+}
+
+func (l *RequestLogger) recentResponses(query string, args ...interface{}) ([]LogEntry, error) {
+	rows, err := l.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -156,60 +639,257 @@ func (l *RequestLogger) GetRecentResponses(limit int) ([]LogEntry, error) {
 
 	var entries []LogEntry
 	for rows.Next() {
-		var entry LogEntry
-		var datetimeStr string
-		var systemMsg, promptMsg string
-
-		err := rows.Scan(
-			&entry.RequestID,
-			&entry.Model,
-			&promptMsg,
-			&systemMsg,
-			&entry.Response,
-			&datetimeStr,
-			&entry.PromptTokens,
-			&entry.CompletionTokens,
-			&entry.EstimatedCost,
-			&entry.DurationMs,
-		)
+		entry, err := scanResponse(rows)
 		if err != nil {
 			continue
 		}
+		entries = append(entries, entry)
+	}
 
-		// Reconstruct messages
-		if systemMsg != "" {
-			entry.Messages = append(entry.Messages, Message{Role: "system", Content: systemMsg})
+	return entries, nil
+}
+
+// ResponsesBetween retrieves the responses logged in [since, until), oldest first
+func (l *RequestLogger) ResponsesBetween(since, until time.Time) ([]LogEntry, error) {
+	if !l.enabled || l.db == nil {
+		return nil, fmt.Errorf("logging is disabled")
+	}
+	rows, err := l.db.Query(`SELECT `+responseColumns+` FROM responses
+		WHERE datetime_utc >= ? AND datetime_utc < ?
+		ORDER BY datetime_utc ASC`,
+		since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []LogEntry
+	for rows.Next() {
+		entry, err := scanResponse(rows)
+		if err != nil {
+			return nil, err
 		}
-		if promptMsg != "" {
-			entry.Messages = append(entry.Messages, Message{Role: "user", Content: promptMsg})
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// UsageAfter calls fn with the usage of each response logged after rowid, in
+// the order logged, and returns the rowid of the last one (rowid itself if
+// there are none). Only the model, error, tokens, cost and duration are set,
+// which is all a metrics exporter tailing the log needs. If entries at the end
+// were deleted since, it picks up from the new end.
+func (l *RequestLogger) UsageAfter(rowid int64, fn func(entry LogEntry)) (int64, error) {
+	if !l.enabled || l.db == nil {
+		return rowid, fmt.Errorf("logging is disabled")
+	}
+	// Rowids of deleted entries at the end are reused
+	var last int64
+	if err := l.db.QueryRow(`SELECT COALESCE(MAX(rowid), 0) FROM responses`).Scan(&last); err != nil {
+		return rowid, err
+	}
+	if last < rowid {
+		return last, nil
+	}
+	rows, err := l.db.Query(`
+		SELECT rowid, COALESCE(model, ''), COALESCE(error, ''),
+			COALESCE(input_tokens, 0), COALESCE(output_tokens, 0),
+			COALESCE(estimated_cost, 0), COALESCE(duration_ms, 0)
+		FROM responses WHERE rowid > ? ORDER BY rowid`, rowid)
+	if err != nil {
+		return rowid, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry LogEntry
+		if err := rows.Scan(&rowid, &entry.Model, &entry.Error, &entry.PromptTokens,
+			&entry.CompletionTokens, &entry.EstimatedCost, &entry.DurationMs); err != nil {
+			return rowid, err
 		}
+		fn(entry)
+	}
+	return rowid, rows.Err()
+}
 
-		// Parse timestamp
-		entry.Timestamp, _ = time.Parse(time.RFC3339, datetimeStr)
+// GetResponse retrieves a single response by its request ID
+func (l *RequestLogger) GetResponse(id string) (LogEntry, error) {
+	if !l.enabled || l.db == nil {
+		return LogEntry{}, fmt.Errorf("logging is disabled")
+	}
+	row := l.db.QueryRow(`SELECT `+responseColumns+` FROM responses WHERE id = ?`, id)
+	entry, err := scanResponse(row)
+	if err == sql.ErrNoRows {
+		return entry, fmt.Errorf("no log entry with ID %s", id)
+	}
+	return entry, err
+}
 
+// GetRaw returns the raw request JSON, request headers and response stream
+// recorded with --debug
+func (l *RequestLogger) GetRaw(id string) (request string, headers map[string]string, response string, err error) {
+	if !l.enabled || l.db == nil {
+		return "", nil, "", fmt.Errorf("logging is disabled")
+	}
+	var headerJSON string
+	err = l.db.QueryRow(
+		`SELECT COALESCE(request_raw, ''), COALESCE(request_headers, ''), COALESCE(response_raw, '') FROM responses WHERE id = ?`, id,
+	).Scan(&request, &headerJSON, &response)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("no log entry with ID %s", id)
+	}
+	if headerJSON != "" {
+		json.Unmarshal([]byte(headerJSON), &headers)
+	}
+	return request, headers, response, err
+}
+
+// DailyUsage aggregates responses in [since, until) by UTC day, oldest first.
+// Usage is kept per whole day, so a day partly inside the range counts in full.
+func (l *RequestLogger) DailyUsage(since, until time.Time) ([]UsageStats, error) {
+	return l.usageBy("day", "key ASC", since, until)
+}
+
+// ModelUsage aggregates responses in [since, until) by model, busiest first
+func (l *RequestLogger) ModelUsage(since, until time.Time) ([]UsageStats, error) {
+	return l.usageBy("model", "requests DESC", since, until)
+}
+
+// ModelDayUsage aggregates responses in [since, until) by day and model, the
+// key being the day, a space and the model
+func (l *RequestLogger) ModelDayUsage(since, until time.Time) ([]UsageStats, error) {
+	return l.usageBy("day || ' ' || model", "key ASC", since, until)
+}
+
+func (l *RequestLogger) usageBy(groupExpr, order string, since, until time.Time) ([]UsageStats, error) {
+	if !l.enabled || l.db == nil {
+		return nil, nil
+	}
+
+	// Read from the daily rollup rather than scanning every response
+	query := fmt.Sprintf(`
+		SELECT %s AS key,
+		       SUM(requests) AS requests,
+		       SUM(errors),
+		       SUM(cost),
+		       SUM(input_tokens),
+		       SUM(output_tokens),
+		       COALESCE(CAST(SUM(answered_duration_ms) AS REAL) / NULLIF(SUM(requests) - SUM(errors), 0), 0)
+		FROM daily_usage
+		WHERE day >= ? AND day <= ?
+		GROUP BY key
+		ORDER BY %s
+	`, groupExpr, order)
+
+	lastDay := until.UTC().Add(-time.Nanosecond)
+	rows, err := l.db.Query(query, since.UTC().Format("2006-01-02"), lastDay.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []UsageStats
+	for rows.Next() {
+		var s UsageStats
+		var key sql.NullString
+		if err := rows.Scan(&key, &s.Requests, &s.Errors, &s.Cost,
+			&s.InputTokens, &s.OutputTokens, &s.AvgDurationMs); err != nil {
+			return nil, err
+		}
+		s.Key = key.String
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// TopResponses returns the most expensive responses in [since, until)
+func (l *RequestLogger) TopResponses(since, until time.Time, limit int) ([]LogEntry, error) {
+	if !l.enabled || l.db == nil {
+		return nil, nil
+	}
+
+	query := `
+		SELECT id, model, COALESCE(prompt, ''), datetime_utc,
+		       input_tokens, output_tokens, estimated_cost, duration_ms
+		FROM responses
+		WHERE datetime_utc >= ? AND datetime_utc < ?
+		ORDER BY estimated_cost DESC
+		LIMIT ?
+	`
+
+	rows, err := l.db.Query(query, since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LogEntry
+	for rows.Next() {
+		var entry LogEntry
+		var datetimeStr, promptMsg string
+		if err := rows.Scan(&entry.RequestID, &entry.Model, &promptMsg, &datetimeStr,
+			&entry.PromptTokens, &entry.CompletionTokens, &entry.EstimatedCost, &entry.DurationMs); err != nil {
+			continue
+		}
+		entry.Messages = []Message{{Role: "user", Content: promptMsg}}
+		entry.TotalTokens = entry.PromptTokens + entry.CompletionTokens
+		entry.Timestamp, _ = time.Parse(time.RFC3339, datetimeStr)
 		entries = append(entries, entry)
 	}
+	return entries, rows.Err()
+}
 
-	return entries, nil
+// IntegrityCheck runs SQLite's integrity check on the database, returning
+// the problems it finds (none if the database is sound)
+func (l *RequestLogger) IntegrityCheck() ([]string, error) {
+	if !l.enabled || l.db == nil {
+		return nil, fmt.Errorf("logging is disabled")
+	}
+	rows, err := l.db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
 }
 
 // GetDBPath returns the path to the logs database
 func (l *RequestLogger) GetDBPath() string {
-	homeDir, _ := os.UserHomeDir()
-	return filepath.Join(homeDir, ".shell-ai", "logs.db")
+	dir, _ := workspace.Dir()
+	return filepath.Join(dir, "logs.db")
 }
 
-// Close closes the database connection
+// Close writes any buffered responses and closes the database connection
 func (l *RequestLogger) Close() error {
-	if l.db != nil {
-		return l.db.Close()
+	if l.db == nil {
+		return nil
 	}
-	return nil
+	flushErr := l.Flush()
+	for _, stmt := range []*sql.Stmt{l.conversationStmt, l.responseStmt} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	if err := l.db.Close(); err != nil {
+		return err
+	}
+	return flushErr
 }
 
 // CalculateCost estimates the cost in USD based on token usage
 func CalculateCost(model string, promptTokens, completionTokens int) float64 {
 	pricing, ok := modelPricing[model]
+	if !ok {
+		pricing, ok = provider.Pricing(model)
+	}
 	if !ok {
 		return 0.0
 	}
@@ -241,6 +921,7 @@ func CreateLogEntry(model string, messages []Message, response string, usage str
 
 	if err != nil {
 		entry.Error = err.Error()
+		entry.ErrorCode = errorCode(err)
 	}
 
 	return entry
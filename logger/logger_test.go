@@ -1,9 +1,18 @@
 package logger
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,17 +26,19 @@ func TestCalculateCost(t *testing.T) {
 		completion int
 		expected   float64
 	}{
-		{"gpt-4.1", 1000, 500, 0.0025 + 0.0050},              // 2.50/M * 0.001M + 10.00/M * 0.0005M = 0.0075
-		{"gpt-4.1-mini", 10000, 5000, 0.0015 + 0.0030},       // 0.15/M * 0.01M + 0.60/M * 0.005M = 0.0045
-		{"gpt-4o", 2000, 1000, 0.0050 + 0.0100},              // 2.50/M * 0.002M + 10.00/M * 0.001M = 0.015
-		{"unknown-model", 1000, 500, 0.0},                    // Unknown model returns 0
-		{"gpt-3.5-turbo", 100000, 50000, 0.05 + 0.075},       // 0.50/M * 0.1M + 1.50/M * 0.05M = 0.125
+		{"gpt-4.1", 1000, 500, 0.0025 + 0.0050},          // 2.50/M * 0.001M + 10.00/M * 0.0005M = 0.0075
+		{"gpt-4.1-mini", 10000, 5000, 0.0015 + 0.0030},   // 0.15/M * 0.01M + 0.60/M * 0.005M = 0.0045
+		{"gpt-4o", 2000, 1000, 0.0050 + 0.0100},          // 2.50/M * 0.002M + 10.00/M * 0.001M = 0.015
+		{"unknown-model", 1000, 500, 0.0},                // Unknown model returns 0
+		{"gpt-3.5-turbo", 100000, 50000, 0.05 + 0.075},   // 0.50/M * 0.1M + 1.50/M * 0.05M = 0.125
+		{"deepseek-chat", 1000000, 1000000, 0.27 + 1.10}, // Provider preset pricing
+		{"llama-3.1-8b-instant", 1000000, 0, 0.05},       // Provider preset pricing
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.model, func(t *testing.T) {
 			result := CalculateCost(tt.model, tt.prompt, tt.completion)
-			if result != tt.expected {
+			if math.Abs(result-tt.expected) > 1e-12 {
 				t.Errorf("CalculateCost(%s, %d, %d) = %f; want %f",
 					tt.model, tt.prompt, tt.completion, result, tt.expected)
 			}
@@ -37,9 +48,17 @@ func TestCalculateCost(t *testing.T) {
 
 func TestLogEntry(t *testing.T) {
 	tmpDir := t.TempDir()
-	logPath := filepath.Join(tmpDir, "test.jsonl")
+	dbPath := filepath.Join(tmpDir, "test.db")
 
-	logger := &RequestLogger{logFilePath: logPath}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	logger := &RequestLogger{db: db, enabled: true}
+	defer logger.Close()
+	if err := logger.initSchema(); err != nil {
+		t.Fatalf("Failed to init schema: %v", err)
+	}
 
 	entry := LogEntry{
 		Timestamp:        time.Now().UTC(),
@@ -53,32 +72,28 @@ func TestLogEntry(t *testing.T) {
 		RequestID:        "test-req-123",
 	}
 
-	if err := logger.Log(entry); err != nil {
+	if err := logger.LogResponse(entry); err != nil {
 		t.Fatalf("Failed to log entry: %v", err)
 	}
 
-	// Verify file exists and contains data
-	data, err := os.ReadFile(logPath)
+	entries, err := logger.GetRecentResponses(10)
 	if err != nil {
-		t.Fatalf("Failed to read log file: %v", err)
-	}
-
-	if len(data) == 0 {
-		t.Error("Log file is empty")
+		t.Fatalf("Failed to read entries: %v", err)
 	}
-
-	// Verify it's valid JSON
-	var loggedEntry LogEntry
-	if err := json.Unmarshal(data[:len(data)-1], &loggedEntry); err != nil { // Remove trailing newline
-		t.Fatalf("Failed to unmarshal log entry: %v", err)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
 	}
+	loggedEntry := entries[0]
 
 	// Verify key fields
 	if loggedEntry.Model != entry.Model {
 		t.Errorf("Model mismatch: got %s, want %s", loggedEntry.Model, entry.Model)
 	}
-	if loggedEntry.TotalTokens != entry.TotalTokens {
-		t.Errorf("TotalTokens mismatch: got %d, want %d", loggedEntry.TotalTokens, entry.TotalTokens)
+	if loggedEntry.PromptTokens != entry.PromptTokens {
+		t.Errorf("PromptTokens mismatch: got %d, want %d", loggedEntry.PromptTokens, entry.PromptTokens)
+	}
+	if loggedEntry.Response != entry.Response {
+		t.Errorf("Response mismatch: got %s, want %s", loggedEntry.Response, entry.Response)
 	}
 }
 
@@ -104,6 +119,7 @@ func TestCreateLogEntry(t *testing.T) {
 		"Hi there!",
 		usage,
 		"req-123",
+		1200,
 		nil,
 	)
 
@@ -123,6 +139,9 @@ func TestCreateLogEntry(t *testing.T) {
 	if entry.RequestID != "req-123" {
 		t.Errorf("RequestID mismatch: got %s, want req-123", entry.RequestID)
 	}
+	if entry.DurationMs != 1200 {
+		t.Errorf("DurationMs mismatch: got %d, want 1200", entry.DurationMs)
+	}
 	if entry.Error != "" {
 		t.Errorf("Error should be empty, got %s", entry.Error)
 	}
@@ -143,7 +162,914 @@ func TestNewRequestLogger(t *testing.T) {
 	if err != nil {
 		t.Fatalf("NewRequestLogger should not error when disabled: %v", err)
 	}
-	if logger != nil {
-		t.Error("Logger should be nil when SHELL_AI_DISABLE_LOGGING is set")
+	if logger == nil || logger.enabled {
+		t.Error("Logger should be disabled when SHELL_AI_DISABLE_LOGGING is set")
+	}
+	if err := logger.LogResponse(LogEntry{Model: "gpt-4.1"}); err != nil {
+		t.Errorf("LogResponse should be a no-op when disabled: %v", err)
+	}
+}
+
+// newTestLogger is a logger with its database in a temporary home, closed
+// when the test ends
+func newTestLogger(t *testing.T) *RequestLogger {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	log, err := NewRequestLogger()
+	if err != nil {
+		t.Fatalf("NewRequestLogger: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+	return log
+}
+
+func TestUsageRollups(t *testing.T) {
+	log := newTestLogger(t)
+
+	day := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	entries := []LogEntry{
+		{RequestID: "a", Model: "gpt-4.1", Timestamp: day, PromptTokens: 100, CompletionTokens: 50, EstimatedCost: 0.5, DurationMs: 1000, ConversationID: "conv-1"},
+		{RequestID: "b", Model: "gpt-4.1", Timestamp: day.Add(time.Hour), PromptTokens: 200, CompletionTokens: 10, EstimatedCost: 0.25, DurationMs: 3000, ConversationID: "conv-1"},
+		{RequestID: "c", Model: "gpt-4.1-mini", Timestamp: day.AddDate(0, 0, 1), PromptTokens: 10, Error: "boom", DurationMs: 9000},
+	}
+	for _, entry := range entries {
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatalf("LogResponse: %v", err)
+		}
+	}
+
+	check := func(label string) {
+		daily, err := log.DailyUsage(day.Truncate(24*time.Hour), day.AddDate(0, 0, 2))
+		if err != nil {
+			t.Fatalf("%s: DailyUsage: %v", label, err)
+		}
+		if len(daily) != 2 || daily[0].Key != "2024-03-05" || daily[0].Requests != 2 || daily[0].InputTokens != 300 ||
+			daily[0].Cost != 0.75 || daily[0].AvgDurationMs != 2000 {
+			t.Errorf("%s: unexpected first day: %+v", label, daily)
+		}
+		if len(daily) == 2 && (daily[1].Errors != 1 || daily[1].AvgDurationMs != 0) {
+			t.Errorf("%s: unexpected second day: %+v", label, daily[1])
+		}
+		conv, err := log.FindConversation("conv-1")
+		if err != nil {
+			t.Fatalf("%s: FindConversation: %v", label, err)
+		}
+		if conv.Turns != 2 || conv.Cost != 0.75 || !conv.Updated.Equal(day.Add(time.Hour)) {
+			t.Errorf("%s: unexpected conversation totals: %+v", label, conv)
+		}
+	}
+	check("triggers")
+
+	// Rollups created for an existing database are filled from its responses
+	if _, err := log.db.Exec(`
+		DROP TRIGGER responses_rollup_insert; DROP TRIGGER responses_rollup_delete; DROP TRIGGER responses_rollup_update;
+		DROP TABLE daily_usage; DROP TABLE conversation_usage`); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.initRollups(); err != nil {
+		t.Fatalf("initRollups: %v", err)
+	}
+	check("backfill")
+
+	if _, err := log.db.Exec(`DELETE FROM responses WHERE id = 'b'`); err != nil {
+		t.Fatal(err)
+	}
+	models, err := log.ModelUsage(allDays())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range models {
+		if m.Key == "gpt-4.1" && (m.Requests != 1 || m.Cost != 0.5 || m.InputTokens != 100) {
+			t.Errorf("after delete: unexpected model usage: %+v", m)
+		}
+	}
+	if conv, err := log.FindConversation("conv-1"); err != nil || conv.Turns != 1 {
+		t.Errorf("after delete: unexpected conversation: %+v, %v", conv, err)
+	}
+}
+
+func allDays() (time.Time, time.Time) {
+	return time.Time{}, time.Now().AddDate(1, 0, 0)
+}
+
+func TestLogTurnConflictAndFork(t *testing.T) {
+	log := newTestLogger(t)
+
+	turn := func(id, prompt string) LogEntry {
+		return LogEntry{RequestID: id, Model: "gpt-4.1", Timestamp: time.Now().UTC(), ConversationID: "conv-1",
+			Messages: []Message{{Role: "user", Content: prompt}}, Response: "answer to " + prompt}
+	}
+	if _, err := log.LogTurn(turn("a", "first"), 0); err != nil {
+		t.Fatalf("first turn: %v", err)
+	}
+	if _, err := log.LogTurn(turn("b", "second"), 1); err != nil {
+		t.Fatalf("second turn: %v", err)
+	}
+
+	// A session that loaded the conversation after the first turn is now behind
+	if err := log.CheckConversation("conv-1", 1); err == nil {
+		t.Error("CheckConversation should report the turn added by the other session")
+	}
+	_, err := log.LogTurn(turn("c", "stale"), 1)
+	conflict, ok := err.(*ConflictError)
+	if !ok || conflict.NewTurns != 1 {
+		t.Fatalf("expected a conflict with 1 new turn, got %v", err)
+	}
+	if _, err := log.GetResponse("c"); err == nil {
+		t.Error("a conflicting turn should not be logged")
+	}
+
+	fork, err := log.ForkConversation("conv-1", "a")
+	if err != nil {
+		t.Fatalf("ForkConversation: %v", err)
+	}
+	forked := turn("c", "stale")
+	forked.ConversationID = fork
+	if _, err := log.LogTurn(forked, 0); err != nil {
+		t.Fatalf("turn in fork: %v", err)
+	}
+	entries, err := log.ConversationEntries(fork)
+	if err != nil {
+		t.Fatalf("ConversationEntries: %v", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.RequestID)
+	}
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "c" {
+		t.Errorf("fork entries = %v, want [a c]", ids)
+	}
+	if own, err := log.BranchEntries(fork); err != nil || len(own) != 1 {
+		t.Errorf("BranchEntries(fork) = %d entries, %v; want 1", len(own), err)
+	}
+	if forks, err := log.Forks("conv-1"); err != nil || len(forks) != 1 || forks[0].ForkPoint != "a" {
+		t.Errorf("Forks = %+v, %v; want the fork at a", forks, err)
+	}
+}
+
+func TestSearchConversations(t *testing.T) {
+	log := newTestLogger(t)
+
+	for _, id := range []string{"conv-1", "conv-2"} {
+		entry := LogEntry{RequestID: id + "-a", Model: "gpt-4.1", Timestamp: time.Now().UTC(), ConversationID: id,
+			Messages: []Message{{Role: "user", Content: "how do I undo a commit"}}}
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatalf("LogResponse: %v", err)
+		}
+	}
+	if err := log.SetConversationSummary("conv-2", "Reverting pushed commits", "Explained git revert versus reset."); err != nil {
+		t.Fatalf("SetConversationSummary: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"commit", 2},
+		{"revert", 1},
+		{"revert*", 1},
+		{"kubernetes", 0},
+	}
+	for _, tt := range tests {
+		found, err := log.SearchConversations(tt.query, 10)
+		if err != nil {
+			t.Fatalf("SearchConversations(%q): %v", tt.query, err)
+		}
+		if len(found) != tt.want {
+			t.Errorf("SearchConversations(%q) found %d, want %d", tt.query, len(found), tt.want)
+		}
+	}
+	if found, _ := log.SearchConversations("revert", 10); len(found) == 1 && found[0].Title != "Reverting pushed commits" {
+		t.Errorf("unexpected title %q", found[0].Title)
+	}
+}
+
+func TestBufferedLogging(t *testing.T) {
+	log := newTestLogger(t)
+
+	var mode string
+	if err := log.db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("journal_mode = %q (%v), want wal", mode, err)
+	}
+	var sync int
+	if err := log.db.QueryRow(`PRAGMA synchronous`).Scan(&sync); err != nil || sync != 1 {
+		t.Errorf("synchronous = %d (%v), want 1 (NORMAL)", sync, err)
+	}
+
+	log.Buffer(3)
+	for i := 0; i < 4; i++ {
+		entry := LogEntry{
+			Timestamp: time.Now().UTC(),
+			Model:     "gpt-4.1-mini",
+			Messages:  []Message{{Role: "user", Content: fmt.Sprintf("prompt %d", i)}},
+			Response:  "answer",
+			RequestID: fmt.Sprintf("req-%d", i),
+		}
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatalf("LogResponse: %v", err)
+		}
+	}
+	entries, err := log.GetRecentResponses(10)
+	if err != nil {
+		t.Fatalf("GetRecentResponses: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("a full buffer of 3 should be written, leaving 1 held; got %d logged", len(entries))
+	}
+
+	if err := log.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	entries, err = log.GetRecentResponses(10)
+	if err != nil {
+		t.Fatalf("GetRecentResponses: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("Flush should write the held response; got %d logged", len(entries))
+	}
+}
+
+func TestLogErrors(t *testing.T) {
+	log := newTestLogger(t)
+
+	records := []ErrorRecord{
+		{Kind: "http", Model: "gpt-4.1", Message: "429 Too Many Requests", Detail: `{"error": "slow down"}`},
+		{Kind: "json", Model: "gpt-4.1", RequestID: "chatcmpl-1", Message: "failed to parse a stream chunk", Detail: string(make([]byte, 10000))},
+		{Kind: "transport", Model: "local", Message: "connection refused"},
+	}
+	for _, record := range records {
+		if err := log.LogError(record); err != nil {
+			t.Fatalf("LogError: %v", err)
+		}
+	}
+
+	all, err := log.RecentErrors("", 10)
+	if err != nil {
+		t.Fatalf("RecentErrors: %v", err)
+	}
+	if len(all) != 3 || all[0].Kind != "transport" || all[2].Kind != "http" {
+		t.Fatalf("RecentErrors should return all 3 errors, newest first; got %+v", all)
+	}
+	if all[0].Timestamp.IsZero() {
+		t.Error("errors should be timestamped when logged")
+	}
+	if len(all[1].Detail) != maxErrorDetail {
+		t.Errorf("detail should be capped at %d bytes, got %d", maxErrorDetail, len(all[1].Detail))
+	}
+
+	jsonErrors, err := log.RecentErrors("json", 10)
+	if err != nil {
+		t.Fatalf("RecentErrors: %v", err)
+	}
+	if len(jsonErrors) != 1 || jsonErrors[0].RequestID != "chatcmpl-1" {
+		t.Errorf("RecentErrors(json) = %+v, want only the json error", jsonErrors)
+	}
+}
+
+func TestRecommendations(t *testing.T) {
+	log := newTestLogger(t)
+
+	now := time.Now().UTC()
+	for i := 0; i < 20; i++ {
+		output := 50
+		if i%5 == 0 {
+			output = 800
+		}
+		entry := LogEntry{RequestID: fmt.Sprintf("r%d", i), Model: "gpt-4o", Timestamp: now, PromptTokens: 1000, CompletionTokens: output}
+		entry.EstimatedCost = CalculateCost(entry.Model, entry.PromptTokens, entry.CompletionTokens)
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Too few requests to judge, and no cheaper model
+	for i, model := range []string{"gpt-4.1", "gpt-4o-mini"} {
+		entry := LogEntry{RequestID: fmt.Sprintf("x%d", i), Model: model, Timestamp: now, PromptTokens: 1000, CompletionTokens: 10, EstimatedCost: 1}
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recommendations, err := log.Recommendations(now.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recommendations) != 1 {
+		t.Fatalf("expected 1 recommendation, got %+v", recommendations)
+	}
+	r := recommendations[0]
+	if r.Model != "gpt-4o" || r.Alternative != "gpt-4o-mini" || r.Requests != 20 || r.Short != 16 {
+		t.Errorf("unexpected recommendation %+v", r)
+	}
+	want := CalculateCost("gpt-4o-mini", 16000, 800)
+	if math.Abs(r.AlternativeCost-want) > 1e-9 || r.Savings() <= 0 {
+		t.Errorf("AlternativeCost = %v, want %v", r.AlternativeCost, want)
+	}
+}
+
+func TestDeleteRedactPurge(t *testing.T) {
+	log := newTestLogger(t)
+
+	day := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	entries := []LogEntry{
+		{RequestID: "a", Model: "gpt-4.1", Timestamp: day, PromptTokens: 100, EstimatedCost: 0.5, ConversationID: "conv-1",
+			Messages: []Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "my secret"}}, Response: "the secret"},
+		{RequestID: "b", Model: "gpt-4.1", Timestamp: day.Add(time.Hour), PromptTokens: 200, EstimatedCost: 0.25, ConversationID: "conv-2",
+			Messages: []Message{{Role: "user", Content: "hello"}}, Response: "hi"},
+	}
+	for _, entry := range entries {
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatalf("LogResponse: %v", err)
+		}
+	}
+	log.LogError(ErrorRecord{Kind: "json", Model: "gpt-4.1", RequestID: "b", Message: "bad chunk"})
+
+	if err := log.RedactResponse("a"); err != nil {
+		t.Fatalf("RedactResponse: %v", err)
+	}
+	redacted, err := log.GetResponse("a")
+	if err != nil {
+		t.Fatalf("GetResponse: %v", err)
+	}
+	if redacted.Response != Redacted || len(redacted.Messages) != 2 ||
+		redacted.Messages[0].Content != Redacted || redacted.Messages[1].Content != Redacted {
+		t.Errorf("the prompt, system prompt and response should be redacted, got %+v", redacted)
+	}
+	if redacted.PromptTokens != 100 || redacted.EstimatedCost != 0.5 {
+		t.Errorf("redacting should keep tokens and cost, got %+v", redacted)
+	}
+
+	if err := log.DeleteResponse("b"); err != nil {
+		t.Fatalf("DeleteResponse: %v", err)
+	}
+	if _, err := log.GetResponse("b"); err == nil {
+		t.Error("the deleted entry should be gone")
+	}
+	if _, err := log.FindConversation("conv-2"); err == nil {
+		t.Error("a conversation should be deleted with its last turn")
+	}
+	if errs, _ := log.RecentErrors("", 10); len(errs) != 0 {
+		t.Errorf("errors recorded for the deleted entry should be deleted too, got %+v", errs)
+	}
+	usage, err := log.ModelUsage(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("ModelUsage: %v", err)
+	}
+	if len(usage) != 1 || usage[0].Requests != 1 || usage[0].Cost != 0.5 {
+		t.Errorf("usage should count only the redacted entry, got %+v", usage)
+	}
+	if err := log.DeleteResponse("b"); err == nil {
+		t.Error("deleting a missing entry should fail")
+	}
+
+	if _, err := log.QueuePrompt(QueuedPrompt{Prompt: "list files", Model: "gpt-4.1"}); err != nil {
+		t.Fatalf("QueuePrompt: %v", err)
+	}
+	if err := log.SaveDraft(Draft{Session: "s1", PID: 1, Text: "find large"}); err != nil {
+		t.Fatalf("SaveDraft: %v", err)
+	}
+	if err := log.Purge(); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if all, _ := log.GetRecentResponses(10); len(all) != 0 {
+		t.Errorf("Purge should delete every entry, %d left", len(all))
+	}
+	if conversations, _ := log.ListConversations(10); len(conversations) != 0 {
+		t.Errorf("Purge should delete every conversation, %d left", len(conversations))
+	}
+	if queued, _ := log.QueuedPrompts(); len(queued) != 0 {
+		t.Errorf("Purge should delete every queued prompt, %d left", len(queued))
+	}
+	if draft, _ := log.TakeDraft(func(int) bool { return false }); draft != nil {
+		t.Errorf("Purge should delete every draft, got %+v", draft)
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	entry := LogEntry{
+		RequestID: "chatcmpl-123", ConversationID: "conv-1", Model: "gpt-4.1",
+		Timestamp: time.Date(2024, 3, 5, 22, 30, 0, 0, time.UTC),
+		Messages:  []Message{{Role: "user", Content: "my secret"}}, Response: "the secret",
+		Persona: "lawyer", OutputPath: "/home/me/notes.md", Error: "HTTP 400: my secret was too long",
+		PromptTokens: 100, CompletionTokens: 20, EstimatedCost: 0.01, DurationMs: 900, BatchID: "batch_1",
+	}
+	record := Anonymize(entry)
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret", "chatcmpl-123", "conv-1", "lawyer", "notes.md", "22:30"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("the record shouldn't contain %q: %s", secret, data)
+		}
+	}
+	if record.ID != hashID("chatcmpl-123") || record.ID == "" || record.ConversationID == record.ID {
+		t.Errorf("IDs should be hashed consistently, got %+v", record)
+	}
+	if record.Day != "2024-03-05" || record.Kind != "batch" || !record.Failed ||
+		record.InputTokens != 100 || record.OutputTokens != 20 || record.Cost != 0.01 {
+		t.Errorf("the usage should be kept, got %+v", record)
+	}
+}
+
+// fakeSink records the batches sent to it, failing while fail is set
+type fakeSink struct {
+	batches []string
+	fail    bool
+}
+
+func (s *fakeSink) Send(ctx context.Context, batch []byte) error {
+	if s.fail {
+		return fmt.Errorf("unreachable")
+	}
+	s.batches = append(s.batches, string(batch))
+	return nil
+}
+
+func TestSinkQueue(t *testing.T) {
+	fake := &fakeSink{fail: true}
+	SetSink(fake, 2, true, "alice@laptop")
+	t.Cleanup(func() { SetSink(nil, 0, false, "") })
+	log := newTestLogger(t)
+
+	logN := func(n int) {
+		for i := 0; i < n; i++ {
+			entry := LogEntry{Timestamp: time.Now().UTC(), Model: "gpt-4.1", Messages: []Message{{Role: "user", Content: "secret"}}, Response: "answer", PromptTokens: 10}
+			if err := log.LogResponse(entry); err != nil {
+				t.Fatalf("LogResponse: %v", err)
+			}
+		}
+	}
+
+	logN(1)
+	if queued, _, _ := log.SinkQueue(); queued != 1 || len(fake.batches) != 0 {
+		t.Fatalf("a single record should wait for a full batch; queued %d", queued)
+	}
+	logN(1)
+	queued, failed, _ := log.SinkQueue()
+	if queued != 2 || failed != 2 {
+		t.Fatalf("a batch that failed should stay queued; queued %d, failed %d", queued, failed)
+	}
+	if errs, _ := log.RecentErrors("sink", 10); len(errs) != 1 {
+		t.Errorf("the failure should be recorded, got %+v", errs)
+	}
+
+	// Backing off, the full batch isn't tried again as more are logged
+	fake.fail = false
+	logN(1)
+	if len(fake.batches) != 0 {
+		t.Errorf("records backing off shouldn't be sent yet, got %q", fake.batches)
+	}
+
+	sent, err := log.Ship(true)
+	if err != nil || sent != 3 {
+		t.Fatalf("Ship(true) = %d, %v; want all 3 sent", sent, err)
+	}
+	if len(fake.batches) != 2 || strings.Count(fake.batches[0], "\n") != 2 {
+		t.Errorf("records should be sent in batches of 2, got %q", fake.batches)
+	}
+	if strings.Contains(fake.batches[0], "secret") || !strings.Contains(fake.batches[0], `"source":"alice@laptop"`) {
+		t.Errorf("anonymized records should carry the source and no text, got %s", fake.batches[0])
+	}
+	if queued, _, _ := log.SinkQueue(); queued != 0 {
+		t.Errorf("sent records should leave the queue, %d left", queued)
+	}
+}
+
+func TestPromptQueue(t *testing.T) {
+	log := newTestLogger(t)
+
+	first, err := log.QueuePrompt(QueuedPrompt{Prompt: "list open ports", Model: "gpt-4.1"})
+	if err != nil {
+		t.Fatalf("QueuePrompt: %v", err)
+	}
+	if _, err := log.QueuePrompt(QueuedPrompt{Prompt: "why is the pod pending", Model: "gpt-4.1", Persona: "k8s"}); err != nil {
+		t.Fatalf("QueuePrompt: %v", err)
+	}
+	if err := log.PromptFailed(first, errors.New("no such host")); err != nil {
+		t.Fatalf("PromptFailed: %v", err)
+	}
+
+	prompts, err := log.QueuedPrompts()
+	if err != nil {
+		t.Fatalf("QueuedPrompts: %v", err)
+	}
+	if len(prompts) != 2 || prompts[0].Prompt != "list open ports" || prompts[0].Attempts != 1 ||
+		prompts[0].LastError != "no such host" || prompts[1].Persona != "k8s" || prompts[1].QueuedAt.IsZero() {
+		t.Fatalf("unexpected queue: %+v", prompts)
+	}
+
+	if ok, err := log.DequeuePrompt(first); err != nil || !ok {
+		t.Errorf("DequeuePrompt = %v, %v", ok, err)
+	}
+	if ok, _ := log.DequeuePrompt(first); ok {
+		t.Error("DequeuePrompt of a removed prompt should report false")
+	}
+	if prompts, _ := log.QueuedPrompts(); len(prompts) != 1 {
+		t.Errorf("%d prompts left, want 1", len(prompts))
+	}
+}
+
+func TestRecentResponsesIn(t *testing.T) {
+	log := newTestLogger(t)
+
+	for i, language := range []string{"ja", "", "de", "ja"} {
+		entry := LogEntry{
+			Timestamp: time.Now().Add(time.Duration(i) * time.Second),
+			Model:     "gpt-4.1",
+			Messages:  []Message{{Role: "user", Content: fmt.Sprintf("query %d", i)}},
+			Response:  "answer",
+			RequestID: fmt.Sprintf("req-%d", i),
+			Language:  language,
+		}
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatalf("LogResponse: %v", err)
+		}
+	}
+
+	entries, err := log.RecentResponsesIn("JA", 10)
+	if err != nil {
+		t.Fatalf("RecentResponsesIn: %v", err)
+	}
+	if len(entries) != 2 || entries[0].RequestID != "req-3" || entries[1].RequestID != "req-0" || entries[0].Language != "ja" {
+		t.Errorf("RecentResponsesIn(JA) = %+v, want req-3 and req-0", entries)
+	}
+}
+
+func TestFullMessages(t *testing.T) {
+	log := newTestLogger(t)
+
+	messages := []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "system", Content: "Contents of main.go"},
+		{Role: "user", Content: "what does it do?"},
+		{Role: "assistant", Content: "it prints hello"},
+		{Role: "user", Content: "make it print bye"},
+	}
+	entry := LogEntry{RequestID: "multi", Model: "gpt-4.1", Timestamp: time.Now(), Messages: messages, Response: "done"}
+	if err := log.LogResponse(entry); err != nil {
+		t.Fatalf("LogResponse: %v", err)
+	}
+
+	entries, err := log.GetRecentResponses(1)
+	if err != nil {
+		t.Fatalf("GetRecentResponses: %v", err)
+	}
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0].Messages, messages) {
+		t.Fatalf("GetRecentResponses should return every message of the exchange, got %+v", entries)
+	}
+
+	if err := log.RedactResponse("multi"); err != nil {
+		t.Fatalf("RedactResponse: %v", err)
+	}
+	redacted, err := log.GetResponse("multi")
+	if err != nil {
+		t.Fatalf("GetResponse: %v", err)
+	}
+	for _, msg := range redacted.Messages {
+		if msg.Content != Redacted {
+			t.Errorf("redacting should drop the earlier turns, got %+v", redacted.Messages)
+			break
+		}
+	}
+}
+
+func TestFailureAnalysis(t *testing.T) {
+	log := newTestLogger(t)
+
+	start := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	entries := []LogEntry{
+		{Model: "gpt-4.1", Endpoint: "gateway.local", Timestamp: start, Error: "API request failed: 502 Bad Gateway", ErrorCode: "502"},
+		{Model: "gpt-4.1", Endpoint: "gateway.local", Timestamp: start.Add(time.Hour), Retries: 2},
+		{Model: "gpt-4.1", Endpoint: "gateway.local", Timestamp: start.Add(3 * time.Hour), Error: "API request failed: 502 Bad Gateway", ErrorCode: "502"},
+		{Model: "gpt-4.1", Timestamp: start.Add(4 * time.Hour), Error: "API request failed: 429 Too Many Requests"},
+		{Model: "gpt-4.1-mini", Endpoint: "api.openai.com", Timestamp: start.AddDate(0, 0, 1)},
+	}
+	for i, entry := range entries {
+		entry.RequestID = fmt.Sprintf("req-%d", i)
+		entry.Messages = []Message{{Role: "user", Content: "hi"}}
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatalf("LogResponse: %v", err)
+		}
+	}
+
+	report, err := log.FailureAnalysis(start, start.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("FailureAnalysis: %v", err)
+	}
+	if report.Total.Requests != 5 || report.Total.Failures != 3 || report.Total.AvgRetries() != 0.4 {
+		t.Errorf("Total = %+v, want 3 of 5 failed with 2 retries", report.Total)
+	}
+	if mtbf := report.Total.MTBF(); mtbf != 2*time.Hour {
+		t.Errorf("MTBF = %s, want 2h", mtbf)
+	}
+	if len(report.Models) != 2 || report.Models[0].Key != "gpt-4.1" || report.Models[0].Failures != 3 {
+		t.Errorf("Models = %+v, want gpt-4.1 first with 3 failures", report.Models)
+	}
+	if len(report.Endpoints) != 3 || report.Endpoints[0].Key != "unknown" || report.Endpoints[1].Key != "gateway.local" {
+		t.Errorf("Endpoints = %+v, want unknown, gateway.local, api.openai.com", report.Endpoints)
+	}
+	if len(report.Days) != 2 || report.Days[0].Failures != 3 || report.Days[1].Failures != 0 {
+		t.Errorf("Days = %+v", report.Days)
+	}
+	if len(report.Codes) != 2 || report.Codes[0].Code != "502" || report.Codes[0].Count != 2 || report.Codes[1].Code != "429" {
+		t.Errorf("Codes = %+v, want 502 twice and 429 (from the message) once", report.Codes)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("failed: %w", context.DeadlineExceeded), "timeout"},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "transport"},
+		{errors.New("something else"), "other"},
+	}
+	for _, tt := range tests {
+		if got := errorCode(tt.err); got != tt.want {
+			t.Errorf("errorCode(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+	entry := CreateLogEntry("gpt-4.1", nil, "", struct{ PromptTokens, CompletionTokens, TotalTokens int }{}, "", 0, errors.New("boom"))
+	if entry.ErrorCode != "other" {
+		t.Errorf("CreateLogEntry should set the error code, got %q", entry.ErrorCode)
+	}
+}
+
+func TestPendingRequests(t *testing.T) {
+	log := newTestLogger(t)
+
+	first, earlier, err := log.BeginRequest("abc", time.Minute)
+	if err != nil || earlier != nil {
+		t.Fatalf("BeginRequest = %v, %v; want no earlier request", earlier, err)
+	}
+	second, earlier, err := log.BeginRequest("abc", time.Minute)
+	if err != nil || earlier == nil || earlier.ID != first || !earlier.Finished.IsZero() {
+		t.Fatalf("BeginRequest = %+v, %v; want #%d in flight", earlier, err, first)
+	}
+	if _, earlier, _ := log.BeginRequest("other", time.Minute); earlier != nil {
+		t.Errorf("a different hash matched %+v", earlier)
+	}
+
+	// A failed request is forgotten, so trying again isn't a duplicate
+	if err := log.FinishRequest(second, ""); err != nil {
+		t.Fatalf("FinishRequest: %v", err)
+	}
+	if _, err := log.GetPendingRequest(second); err != sql.ErrNoRows {
+		t.Errorf("failed request is still marked: %v", err)
+	}
+	if err := log.FinishRequest(first, "req-1"); err != nil {
+		t.Fatalf("FinishRequest: %v", err)
+	}
+	_, earlier, err = log.BeginRequest("abc", time.Minute)
+	if err != nil || earlier == nil || earlier.ID != first || earlier.RequestID != "req-1" || earlier.Finished.IsZero() {
+		t.Errorf("BeginRequest = %+v, %v; want #%d answered as req-1", earlier, err, first)
+	}
+	// With no window, only requests still in flight count
+	if _, earlier, _ := log.BeginRequest("abc", 0); earlier == nil || !earlier.Finished.IsZero() {
+		t.Errorf("BeginRequest with no window = %+v; want the request still in flight", earlier)
+	}
+}
+
+func TestPendingTimeFormatSorts(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 5, 0, time.UTC)
+	times := []time.Time{base, base.Add(100 * time.Millisecond), base.Add(120 * time.Millisecond), base.Add(500 * time.Millisecond), base.Add(time.Second)}
+	for i := 1; i < len(times); i++ {
+		before, after := times[i-1].Format(pendingTimeFormat), times[i].Format(pendingTimeFormat)
+		if before >= after {
+			t.Errorf("%s sorts after %s", before, after)
+		}
+	}
+}
+
+func TestDrafts(t *testing.T) {
+	log := newTestLogger(t)
+
+	now := time.Now()
+	for _, draft := range []Draft{
+		{Session: "a", PID: 10, Text: "find files over", SavedAt: now.Add(-time.Hour)},
+		{Session: "a", PID: 10, Text: "find files over 1GB", SavedAt: now.Add(-time.Minute), Sent: true},
+		{Session: "b", PID: 20, Text: "still typing", SavedAt: now},
+		{Session: "c", PID: 30, Text: "long forgotten", SavedAt: now.Add(-40 * 24 * time.Hour)},
+	} {
+		if err := log.SaveDraft(draft); err != nil {
+			t.Fatalf("SaveDraft: %v", err)
+		}
+	}
+
+	running := func(pid int) bool { return pid == 20 }
+	draft, err := log.TakeDraft(running)
+	if err != nil || draft == nil || draft.Text != "find files over 1GB" || !draft.Sent || draft.SavedAt.IsZero() {
+		t.Fatalf("TakeDraft = %+v, %v; want session a's latest draft", draft, err)
+	}
+	if draft, err := log.TakeDraft(running); err != nil || draft != nil {
+		t.Errorf("TakeDraft = %+v, %v; drafts of running sessions and expired ones shouldn't be taken", draft, err)
+	}
+
+	if err := log.SaveDraft(Draft{Session: "b", PID: 20}); err != nil {
+		t.Fatalf("SaveDraft: %v", err)
+	}
+	if draft, _ := log.TakeDraft(func(int) bool { return false }); draft != nil {
+		t.Errorf("an empty draft should drop the session's: %+v", draft)
+	}
+}
+
+func TestAuditChain(t *testing.T) {
+	log := newTestLogger(t)
+
+	logAt := func(id string, at time.Time) {
+		entry := LogEntry{RequestID: id, Model: "gpt-4.1", Timestamp: at, PromptTokens: 10, EstimatedCost: 0.125,
+			Messages: []Message{{Role: "user", Content: "prompt " + id}}, Response: "answer " + id}
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatalf("LogResponse: %v", err)
+		}
+	}
+	day := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	logAt("before", day)
+
+	SetAudit(true)
+	defer SetAudit(false)
+	for i, id := range []string{"a", "b", "c", "d"} {
+		logAt(id, day.Add(time.Duration(i+1)*time.Hour))
+	}
+	report, err := log.VerifyChain("")
+	if err != nil {
+		t.Fatalf("VerifyChain: %v", err)
+	}
+	if report.Chained != 4 || report.Unchained != 0 || len(report.Problems) != 0 || !report.First.Equal(day.Add(time.Hour)) {
+		t.Fatalf("an intact chain should verify, got %+v", report)
+	}
+	head := report.Head
+
+	if err := log.DeleteResponse("b"); err != ErrAudit {
+		t.Errorf("DeleteResponse in audit mode = %v, want ErrAudit", err)
+	}
+	if err := log.RedactResponse("b"); err != ErrAudit {
+		t.Errorf("RedactResponse in audit mode = %v, want ErrAudit", err)
+	}
+
+	// Tampering with the database directly breaks the chain where it happened
+	if _, err := log.db.Exec(`UPDATE responses SET response = 'edited' WHERE id = 'b'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.db.Exec(`DELETE FROM responses WHERE id IN ('c', 'd')`); err != nil {
+		t.Fatal(err)
+	}
+	SetAudit(false)
+	logAt("e", day.Add(6*time.Hour))
+	SetAudit(true)
+	logAt("f", day.Add(7*time.Hour))
+
+	report, err = log.VerifyChain(head)
+	if err != nil {
+		t.Fatalf("VerifyChain: %v", err)
+	}
+	var problems []string
+	for _, problem := range report.Problems {
+		problems = append(problems, problem.RequestID)
+	}
+	// b was changed, f follows deleted responses, and head was deleted
+	if strings.Join(problems, ",") != "b,f," || report.Chained != 3 || report.Unchained != 1 {
+		t.Errorf("problems at %v (%d chained, %d not), want b, f and the head", problems, report.Chained, report.Unchained)
+	}
+
+	// Deleting the latest response leaves the chain ending short
+	if _, err := log.db.Exec(`DELETE FROM responses WHERE id = 'f'`); err != nil {
+		t.Fatal(err)
+	}
+	report, err = log.VerifyChain("")
+	if err != nil {
+		t.Fatalf("VerifyChain: %v", err)
+	}
+	if n := len(report.Problems); n == 0 || report.Problems[n-1].RequestID != "" {
+		t.Errorf("deleting the end of the chain should be found, got %+v", report.Problems)
+	}
+}
+
+func TestScrub(t *testing.T) {
+	log := newTestLogger(t)
+
+	entries := []LogEntry{
+		{RequestID: "a", Model: "gpt-4.1", Timestamp: time.Now().UTC(), ConversationID: "conv-1", RequestRaw: `{"messages":[{"content":"close ACME-123 <now>"}]}`,
+			Messages: []Message{{Role: "user", Content: "close ticket ACME-123 and ACME-7"}}, Response: "Closed ACME-123."},
+		{RequestID: "b", Model: "gpt-4.1", Timestamp: time.Now().UTC(), ConversationID: "conv-2",
+			Messages: []Message{{Role: "user", Content: "hello"}}, Response: "hi"},
+	}
+	for _, entry := range entries {
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatalf("LogResponse: %v", err)
+		}
+	}
+	pattern := regexp.MustCompile(`ACME-\d+`)
+
+	matches, err := log.Scrub(pattern, ScrubReplacement, true)
+	if err != nil {
+		t.Fatalf("Scrub dry run: %v", err)
+	}
+	var found []string
+	for _, match := range matches {
+		found = append(found, match.Table+"/"+match.ID)
+	}
+	if strings.Join(found, ",") != "responses/a,conversations/conv-1" || matches[0].Count != 6 || matches[0].Match != "ACME-123" {
+		t.Fatalf("dry run found %v (%+v), want a and its conversation", found, matches)
+	}
+	if entry, _ := log.GetResponse("a"); entry.Response != "Closed ACME-123." {
+		t.Errorf("a dry run shouldn't change anything, got %q", entry.Response)
+	}
+
+	if _, err := log.Scrub(pattern, ScrubReplacement, false); err != nil {
+		t.Fatalf("Scrub: %v", err)
+	}
+	entry, err := log.GetResponse("a")
+	if err != nil {
+		t.Fatalf("GetResponse: %v", err)
+	}
+	if entry.Response != "Closed [scrubbed]." || entry.Messages[0].Content != "close ticket [scrubbed] and [scrubbed]" {
+		t.Errorf("the text should be scrubbed, got %q and %+v", entry.Response, entry.Messages)
+	}
+	if raw, _, _, _ := log.GetRaw("a"); raw != `{"messages":[{"content":"close [scrubbed] <now>"}]}` {
+		t.Errorf("the raw request should stay valid JSON, got %s", raw)
+	}
+	if found, _ := log.SearchConversations("ACME", 10); len(found) != 0 {
+		t.Errorf("the conversation's name should be scrubbed, found %+v", found)
+	}
+	if matches, _ := log.Scrub(pattern, ScrubReplacement, true); len(matches) != 0 {
+		t.Errorf("nothing should be left to scrub, got %+v", matches)
+	}
+	if _, err := log.Scrub(regexp.MustCompile(`x*`), ScrubReplacement, true); err == nil {
+		t.Error("a pattern matching empty text should be refused")
+	}
+}
+
+func TestBenchmarks(t *testing.T) {
+	log := newTestLogger(t)
+
+	day := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	for _, b := range []Benchmark{
+		{Model: "gpt-4.1", Time: day, Runs: 3, TTFTMs: 900, DurationMs: 2000, TokensPerSec: 60, Cost: 0.002},
+		{Model: "gpt-4.1-mini", Time: day, Runs: 3, Failures: 1, Error: "timeout", TTFTMs: 400},
+		{Model: "gpt-4.1", Time: day.AddDate(0, 0, 2), Runs: 3, TTFTMs: 700},
+	} {
+		if err := log.SaveBenchmark(b); err != nil {
+			t.Fatalf("SaveBenchmark: %v", err)
+		}
+	}
+
+	latest, err := log.Benchmarks(time.Time{}, true)
+	if err != nil {
+		t.Fatalf("Benchmarks: %v", err)
+	}
+	if len(latest) != 2 || latest[0].Model != "gpt-4.1" || latest[0].TTFTMs != 700 || latest[1].Error != "timeout" {
+		t.Errorf("latest benchmarks = %+v, want each model's last", latest)
+	}
+	since, err := log.Benchmarks(day.AddDate(0, 0, 1), false)
+	if err != nil {
+		t.Fatalf("Benchmarks: %v", err)
+	}
+	if len(since) != 1 || !since[0].Time.Equal(day.AddDate(0, 0, 2)) {
+		t.Errorf("benchmarks since = %+v, want the last run only", since)
+	}
+}
+
+func TestSampleGroup(t *testing.T) {
+	log := newTestLogger(t)
+
+	SetAudit(true)
+	defer SetAudit(false)
+	group := NewSampleGroupID()
+	for _, id := range []string{"plain", "s1", "s2", "judge"} {
+		entry := LogEntry{RequestID: id, Model: "gpt-4.1", Timestamp: time.Now(), Response: "answer " + id,
+			Messages: []Message{{Role: "user", Content: "prompt"}}}
+		if id != "plain" {
+			entry.SampleGroup = group
+		}
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatalf("LogResponse: %v", err)
+		}
+	}
+
+	entries, err := log.SampleGroup(group)
+	if err != nil {
+		t.Fatalf("SampleGroup: %v", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.RequestID)
+	}
+	if strings.Join(ids, ",") != "judge,s2,s1" || entries[0].SampleGroup != group {
+		t.Errorf("SampleGroup = %v, want judge,s2,s1 in %s", ids, group)
+	}
+
+	// The group is hashed along with the rest, but only where it's set
+	report, err := log.VerifyChain("")
+	if err != nil || len(report.Problems) != 0 {
+		t.Fatalf("VerifyChain = %+v, %v; want no problems", report, err)
+	}
+	if _, err := log.db.Exec(`UPDATE responses SET sample_group = 'other' WHERE id = 's1'`); err != nil {
+		t.Fatal(err)
+	}
+	report, err = log.VerifyChain("")
+	if err != nil || len(report.Problems) != 1 || report.Problems[0].RequestID != "s1" {
+		t.Errorf("VerifyChain after moving s1 to another group = %+v, %v; want a problem with s1", report, err)
 	}
 }
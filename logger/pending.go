@@ -0,0 +1,116 @@
+package logger
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	. "q/types"
+)
+
+// staleRequest is how long a request may be marked in flight before it's
+// taken to have died with its process
+const staleRequest = 10 * time.Minute
+
+// pendingTimeFormat is how pending_requests stores times: fixed-width, unlike
+// RFC3339Nano, which drops trailing zeros, so that the cutoffs can compare
+// them as strings
+const pendingTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// initPending creates the table of requests in flight and just answered,
+// which the duplicate guard checks new prompts against
+func (l *RequestLogger) initPending() error {
+	_, err := l.db.Exec(`
+	CREATE TABLE IF NOT EXISTS pending_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		hash TEXT NOT NULL,
+		started_utc TEXT NOT NULL,
+		finished_utc TEXT,
+		request_id TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_pending_requests_hash ON pending_requests(hash);`)
+	return err
+}
+
+// BeginRequest marks a request with the given hash as in flight, returning
+// its ID, along with the latest request with the same hash that's still in
+// flight or was answered within window, if there is one; with a window of 0,
+// only a request still in flight is returned. Requests are
+// marked before looking for earlier ones, so of two started at once, the
+// second always finds the first.
+func (l *RequestLogger) BeginRequest(hash string, window time.Duration) (int64, *PendingRequest, error) {
+	if !l.enabled || l.db == nil {
+		return 0, nil, fmt.Errorf("logging is disabled")
+	}
+	now := time.Now().UTC()
+	if _, err := l.db.Exec(`DELETE FROM pending_requests WHERE started_utc < ?`,
+		now.Add(-time.Hour).Format(pendingTimeFormat)); err != nil {
+		return 0, nil, err
+	}
+	result, err := l.db.Exec(`INSERT INTO pending_requests (hash, started_utc) VALUES (?, ?)`,
+		hash, now.Format(pendingTimeFormat))
+	if err != nil {
+		return 0, nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	row := l.db.QueryRow(`
+		SELECT id, hash, started_utc, COALESCE(finished_utc, ''), COALESCE(request_id, '')
+		FROM pending_requests
+		WHERE hash = ? AND id < ?
+			AND ((finished_utc IS NULL AND started_utc >= ?) OR (? AND finished_utc >= ?))
+		ORDER BY id DESC LIMIT 1`,
+		hash, id, now.Add(-staleRequest).Format(pendingTimeFormat), window > 0, now.Add(-window).Format(pendingTimeFormat))
+	earlier, err := scanPending(row)
+	if err == sql.ErrNoRows {
+		return id, nil, nil
+	}
+	if err != nil {
+		return id, nil, err
+	}
+	return id, &earlier, nil
+}
+
+// FinishRequest marks a request as answered, under the ID it was logged
+// with. Failed requests, with no ID, are forgotten, so trying them again
+// isn't taken for a duplicate.
+func (l *RequestLogger) FinishRequest(id int64, requestID string) error {
+	if !l.enabled || l.db == nil {
+		return fmt.Errorf("logging is disabled")
+	}
+	var err error
+	if requestID == "" {
+		_, err = l.db.Exec(`DELETE FROM pending_requests WHERE id = ?`, id)
+	} else {
+		_, err = l.db.Exec(`UPDATE pending_requests SET finished_utc = ?, request_id = ? WHERE id = ?`,
+			time.Now().UTC().Format(pendingTimeFormat), requestID, id)
+	}
+	return err
+}
+
+// GetPendingRequest returns a request marked by BeginRequest, or
+// sql.ErrNoRows if it failed (or was never marked)
+func (l *RequestLogger) GetPendingRequest(id int64) (PendingRequest, error) {
+	if !l.enabled || l.db == nil {
+		return PendingRequest{}, fmt.Errorf("logging is disabled")
+	}
+	return scanPending(l.db.QueryRow(`
+		SELECT id, hash, started_utc, COALESCE(finished_utc, ''), COALESCE(request_id, '')
+		FROM pending_requests WHERE id = ?`, id))
+}
+
+func scanPending(row *sql.Row) (PendingRequest, error) {
+	var request PendingRequest
+	var started, finished string
+	if err := row.Scan(&request.ID, &request.Hash, &started, &finished, &request.RequestID); err != nil {
+		return request, err
+	}
+	request.Started, _ = time.Parse(time.RFC3339Nano, started)
+	if finished != "" {
+		request.Finished, _ = time.Parse(time.RFC3339Nano, finished)
+	}
+	return request, nil
+}
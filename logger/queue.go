@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+
+	. "q/types"
+)
+
+// initPromptQueue creates the table prompts written while offline wait in
+func (l *RequestLogger) initPromptQueue() error {
+	_, err := l.db.Exec(`
+	CREATE TABLE IF NOT EXISTS prompt_queue (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		queued_utc TEXT,
+		prompt TEXT,
+		model TEXT,
+		persona TEXT,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT
+	)`)
+	return err
+}
+
+// QueuePrompt keeps a prompt to send once the network is back, returning its ID
+func (l *RequestLogger) QueuePrompt(prompt QueuedPrompt) (int64, error) {
+	if !l.enabled || l.db == nil {
+		return 0, fmt.Errorf("logging is disabled")
+	}
+	if prompt.QueuedAt.IsZero() {
+		prompt.QueuedAt = time.Now()
+	}
+	result, err := l.db.Exec(`INSERT INTO prompt_queue (queued_utc, prompt, model, persona) VALUES (?, ?, ?, ?)`,
+		prompt.QueuedAt.UTC().Format(time.RFC3339), prompt.Prompt, prompt.Model, nullIfEmpty(prompt.Persona))
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// QueuedPrompts returns the prompts waiting to be sent, oldest first
+func (l *RequestLogger) QueuedPrompts() ([]QueuedPrompt, error) {
+	if !l.enabled || l.db == nil {
+		return nil, fmt.Errorf("logging is disabled")
+	}
+	rows, err := l.db.Query(`
+		SELECT id, queued_utc, prompt, model, COALESCE(persona, ''), attempts, COALESCE(last_error, '')
+		FROM prompt_queue ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prompts []QueuedPrompt
+	for rows.Next() {
+		var prompt QueuedPrompt
+		var queued string
+		if err := rows.Scan(&prompt.ID, &queued, &prompt.Prompt, &prompt.Model, &prompt.Persona, &prompt.Attempts, &prompt.LastError); err != nil {
+			return nil, err
+		}
+		prompt.QueuedAt, _ = time.Parse(time.RFC3339, queued)
+		prompts = append(prompts, prompt)
+	}
+	return prompts, rows.Err()
+}
+
+// PromptFailed records a failed try to send a queued prompt
+func (l *RequestLogger) PromptFailed(id int64, err error) error {
+	if !l.enabled || l.db == nil {
+		return fmt.Errorf("logging is disabled")
+	}
+	_, execErr := l.db.Exec(`UPDATE prompt_queue SET attempts = attempts + 1, last_error = ? WHERE id = ?`, err.Error(), id)
+	return execErr
+}
+
+// DequeuePrompt removes a queued prompt, once it's sent or dropped, reporting
+// whether there was one with that ID
+func (l *RequestLogger) DequeuePrompt(id int64) (bool, error) {
+	if !l.enabled || l.db == nil {
+		return false, fmt.Errorf("logging is disabled")
+	}
+	result, err := l.db.Exec(`DELETE FROM prompt_queue WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"sort"
+	"time"
+)
+
+// ShortAnswerTokens is the output length under which an answer counts as
+// short, the kind a smaller model handles as well
+const ShortAnswerTokens = 200
+
+// minRecommendRequests is how many requests a model needs before its usage
+// says anything
+const minRecommendRequests = 10
+
+// cheaperModels pairs models with a cheaper one from the same provider
+var cheaperModels = map[string]string{
+	"gpt-4.1":                  "gpt-4.1-mini",
+	"gpt-4o":                   "gpt-4o-mini",
+	"gpt-4-turbo":              "gpt-4o-mini",
+	"gpt-4":                    "gpt-4o-mini",
+	"claude-sonnet-4-0":        "claude-3-5-haiku-latest",
+	"claude-3-7-sonnet-latest": "claude-3-5-haiku-latest",
+	"mistral-large-latest":     "mistral-small-latest",
+	"llama-3.3-70b-versatile":  "llama-3.1-8b-instant",
+	"deepseek-reasoner":        "deepseek-chat",
+	"grok-beta":                "grok-3-mini",
+	"grok-2-latest":            "grok-3-mini",
+	"grok-3":                   "grok-3-mini",
+}
+
+// Recommendation suggests sending a model's short answers to a cheaper model
+type Recommendation struct {
+	Model       string
+	Alternative string
+	// Requests answered by Model, of which Short had short answers
+	Requests, Short int
+	// Cost is what the short requests cost, AlternativeCost what they would
+	// have on Alternative
+	Cost, AlternativeCost float64
+}
+
+// Savings is how much Alternative would have saved
+func (r Recommendation) Savings() float64 {
+	return r.Cost - r.AlternativeCost
+}
+
+// Recommendations looks at answered requests since a time for models that
+// mostly gave short answers and have a cheaper alternative, biggest savings
+// first
+func (l *RequestLogger) Recommendations(since time.Time) ([]Recommendation, error) {
+	if !l.enabled || l.db == nil {
+		return nil, nil
+	}
+	rows, err := l.db.Query(`
+		SELECT model, COUNT(*),
+		       COALESCE(SUM(output_tokens < ?), 0),
+		       COALESCE(SUM(CASE WHEN output_tokens < ? THEN input_tokens END), 0),
+		       COALESCE(SUM(CASE WHEN output_tokens < ? THEN output_tokens END), 0),
+		       COALESCE(SUM(CASE WHEN output_tokens < ? THEN estimated_cost END), 0)
+		FROM responses
+		WHERE datetime_utc >= ? AND COALESCE(error, '') = '' AND image IS NULL AND COALESCE(audio_seconds, 0) = 0
+		GROUP BY model`,
+		ShortAnswerTokens, ShortAnswerTokens, ShortAnswerTokens, ShortAnswerTokens,
+		since.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recommendations []Recommendation
+	for rows.Next() {
+		var r Recommendation
+		var inputTokens, outputTokens int
+		if err := rows.Scan(&r.Model, &r.Requests, &r.Short, &inputTokens, &outputTokens, &r.Cost); err != nil {
+			return nil, err
+		}
+		r.Alternative = cheaperModels[r.Model]
+		if r.Alternative == "" || r.Requests < minRecommendRequests || r.Short*2 < r.Requests {
+			continue
+		}
+		r.AlternativeCost = CalculateCost(r.Alternative, inputTokens, outputTokens)
+		if r.Savings() > 0 {
+			recommendations = append(recommendations, r)
+		}
+	}
+	sort.Slice(recommendations, func(i, j int) bool {
+		return recommendations[i].Savings() > recommendations[j].Savings()
+	})
+	return recommendations, rows.Err()
+}
@@ -0,0 +1,144 @@
+package logger
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// The rollup tables keep running totals of the responses table so stats don't
+// have to scan every response. daily_usage is kept per UTC day and model and
+// updated incrementally; conversation_usage is recomputed for the one
+// conversation a change touches, which the conversation index keeps cheap.
+const rollupSchema = `
+	CREATE TABLE daily_usage (
+		day TEXT NOT NULL,
+		model TEXT NOT NULL,
+		requests INTEGER NOT NULL DEFAULT 0,
+		errors INTEGER NOT NULL DEFAULT 0,
+		input_tokens INTEGER NOT NULL DEFAULT 0,
+		output_tokens INTEGER NOT NULL DEFAULT 0,
+		cost REAL NOT NULL DEFAULT 0,
+		answered_duration_ms INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (day, model)
+	);
+
+	CREATE TABLE conversation_usage (
+		conversation_id TEXT PRIMARY KEY,
+		requests INTEGER NOT NULL,
+		input_tokens INTEGER NOT NULL,
+		output_tokens INTEGER NOT NULL,
+		cost REAL NOT NULL,
+		first_utc TEXT,
+		last_utc TEXT
+	);
+`
+
+// dailyUsageDelta adds (sign 1) or removes (sign -1) a response row, NEW or
+// OLD, from its day's totals
+func dailyUsageDelta(row string, sign int) string {
+	failed := fmt.Sprintf("(COALESCE(%s.error, '') != '')", row)
+	stmt := strings.NewReplacer("$row", row, "$failed", failed, "$sign", fmt.Sprint(sign)).Replace(`
+		INSERT INTO daily_usage (day, model, requests, errors, input_tokens, output_tokens, cost, answered_duration_ms)
+		VALUES (
+			substr($row.datetime_utc, 1, 10), COALESCE($row.model, ''),
+			$sign, $sign * $failed,
+			$sign * COALESCE($row.input_tokens, 0), $sign * COALESCE($row.output_tokens, 0),
+			$sign * COALESCE($row.estimated_cost, 0),
+			CASE WHEN $failed THEN 0 ELSE $sign * COALESCE($row.duration_ms, 0) END
+		)
+		ON CONFLICT (day, model) DO UPDATE SET
+			requests = requests + excluded.requests,
+			errors = errors + excluded.errors,
+			input_tokens = input_tokens + excluded.input_tokens,
+			output_tokens = output_tokens + excluded.output_tokens,
+			cost = cost + excluded.cost,
+			answered_duration_ms = answered_duration_ms + excluded.answered_duration_ms;`)
+	if sign < 0 {
+		stmt += `
+		DELETE FROM daily_usage WHERE requests <= 0;`
+	}
+	return stmt
+}
+
+// conversationUsageRefresh recomputes the totals of the conversation a row belongs to
+func conversationUsageRefresh(row string) string {
+	return strings.ReplaceAll(`
+		DELETE FROM conversation_usage WHERE conversation_id = $row.conversation_id;
+		INSERT INTO conversation_usage
+		SELECT conversation_id, COUNT(*),
+		       COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+		       COALESCE(SUM(estimated_cost), 0), MIN(datetime_utc), MAX(datetime_utc)
+		FROM responses
+		WHERE conversation_id = $row.conversation_id
+		GROUP BY conversation_id;`, "$row", row)
+}
+
+// rollupTriggers keep the rollup tables in step with every write to responses
+func rollupTriggers() string {
+	return `
+	CREATE TRIGGER responses_rollup_insert AFTER INSERT ON responses BEGIN` +
+		dailyUsageDelta("NEW", 1) + conversationUsageRefresh("NEW") + `
+	END;
+
+	CREATE TRIGGER responses_rollup_delete AFTER DELETE ON responses BEGIN` +
+		dailyUsageDelta("OLD", -1) + conversationUsageRefresh("OLD") + `
+	END;
+
+	CREATE TRIGGER responses_rollup_update
+	AFTER UPDATE OF model, datetime_utc, error, input_tokens, output_tokens,
+		estimated_cost, duration_ms, conversation_id ON responses BEGIN` +
+		dailyUsageDelta("OLD", -1) + dailyUsageDelta("NEW", 1) +
+		conversationUsageRefresh("OLD") + conversationUsageRefresh("NEW") + `
+	END;`
+}
+
+// backfillRollups fills freshly created rollup tables from the responses already logged
+const backfillRollups = `
+	INSERT INTO daily_usage
+	SELECT substr(datetime_utc, 1, 10), COALESCE(model, ''), COUNT(*),
+	       SUM(CASE WHEN COALESCE(error, '') != '' THEN 1 ELSE 0 END),
+	       COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+	       COALESCE(SUM(estimated_cost), 0),
+	       COALESCE(SUM(CASE WHEN COALESCE(error, '') = '' THEN duration_ms END), 0)
+	FROM responses
+	GROUP BY 1, 2;
+
+	INSERT INTO conversation_usage
+	SELECT conversation_id, COUNT(*),
+	       COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+	       COALESCE(SUM(estimated_cost), 0), MIN(datetime_utc), MAX(datetime_utc)
+	FROM responses
+	WHERE conversation_id IS NOT NULL
+	GROUP BY conversation_id;
+`
+
+// initRollups creates the rollup tables and their triggers the first time a
+// database is opened by a version that has them, filling them from the
+// existing responses in the same transaction
+func (l *RequestLogger) initRollups() error {
+	var name string
+	err := l.db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'daily_usage'`).Scan(&name)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range []string{rollupSchema, rollupTriggers(), backfillRollups} {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			if strings.Contains(err.Error(), "already exists") {
+				// Another q process created them first
+				return nil
+			}
+			return fmt.Errorf("failed to create usage rollups: %w", err)
+		}
+	}
+	return tx.Commit()
+}
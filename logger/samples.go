@@ -0,0 +1,29 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	. "q/types"
+)
+
+// NewSampleGroupID generates the ID that groups the answers sampled for one
+// prompt (see LogEntry.SampleGroup)
+func NewSampleGroupID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "samples-" + hex.EncodeToString(b)
+}
+
+// SampleGroup retrieves the requests of a sample group, newest first like
+// GetRecentResponses
+func (l *RequestLogger) SampleGroup(group string) ([]LogEntry, error) {
+	if !l.enabled || l.db == nil {
+		return nil, nil
+	}
+	return l.recentResponses(`SELECT `+responseColumns+`
+		FROM responses
+		WHERE sample_group = ?
+		ORDER BY rowid DESC
+	`, group)
+}
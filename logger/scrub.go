@@ -0,0 +1,262 @@
+package logger
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ScrubReplacement is what scrubbed text is replaced with by default
+const ScrubReplacement = "[scrubbed]"
+
+// scrubbedTables are the tables and columns text that was sent or logged can
+// end up in, keyed by each row's ID. Columns in json hold JSON documents, in
+// which only the strings are scrubbed, so they stay valid.
+var scrubbedTables = []struct {
+	table, key string
+	columns    []string
+	json       map[string]bool
+}{
+	{"responses", "id",
+		[]string{"prompt", "system", "response", "reasoning", "context_note", "error", "messages", "citations", "urls", "request_raw", "request_headers", "response_raw"},
+		map[string]bool{"messages": true, "citations": true, "urls": true, "request_raw": true, "request_headers": true}},
+	{"conversations", "id", []string{"name", "title", "summary"}, nil},
+	{"errors", "id", []string{"message", "detail"}, nil},
+	{"batches", "id", []string{"requests"}, map[string]bool{"requests": true}},
+	{"prompt_queue", "id", []string{"prompt", "last_error"}, nil},
+	{"drafts", "session", []string{"text"}, nil},
+	{"sink_queue", "id", []string{"record"}, map[string]bool{"record": true}},
+}
+
+// ScrubMatch is a row with text matching a scrub pattern
+type ScrubMatch struct {
+	Table string
+	ID    string
+	// Columns are the columns the text was found in, and Count how many
+	// times it was found
+	Columns []string
+	Count   int
+	// Before, Match and After are the first match and the text around it
+	Before, Match, After string
+}
+
+// Scrub finds the text matching pattern anywhere it's stored in the logs:
+// prompts, answers, conversation names and summaries, errors, batches, queued
+// prompts, drafts and records waiting for the sink. Unless dryRun is set, it
+// replaces it with replacement, which can refer to submatches like $1, in the
+// same way as RedactResponse, so the old text doesn't linger in the file.
+func (l *RequestLogger) Scrub(pattern *regexp.Regexp, replacement string, dryRun bool) ([]ScrubMatch, error) {
+	if !l.enabled || l.db == nil {
+		return nil, fmt.Errorf("logging is disabled")
+	}
+	if pattern.MatchString("") {
+		return nil, fmt.Errorf("the pattern %q matches empty text, so it would scrub everything", pattern)
+	}
+	if !dryRun && audit {
+		return nil, ErrAudit
+	}
+	if err := l.Flush(); err != nil {
+		return nil, err
+	}
+
+	var matches []ScrubMatch
+	find := func(tx *sql.Tx) error {
+		for _, t := range scrubbedTables {
+			found, updates, err := scrubTable(tx, t.table, t.key, t.columns, t.json, pattern, replacement)
+			if err != nil {
+				return fmt.Errorf("scrubbing %s: %w", t.table, err)
+			}
+			matches = append(matches, found...)
+			if dryRun {
+				continue
+			}
+			for _, update := range updates {
+				if _, err := tx.Exec(update.query, update.args...); err != nil {
+					return fmt.Errorf("scrubbing %s: %w", t.table, err)
+				}
+			}
+			if t.table == "conversations" && len(found) > 0 {
+				// Merge the search index, so the old terms leave it too
+				if _, err := tx.Exec(`INSERT INTO conversations_fts (conversations_fts) VALUES ('optimize')`); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if dryRun {
+		tx, err := l.db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		return matches, find(tx)
+	}
+	return matches, l.scrub(find)
+}
+
+// scrubUpdate is an UPDATE that rewrites one row's scrubbed columns
+type scrubUpdate struct {
+	query string
+	args  []interface{}
+}
+
+// scrubTable finds the rows of a table with matching text, returning them and
+// the updates that scrub them. The rows are all read before any is updated.
+func scrubTable(tx *sql.Tx, table, key string, columns []string, jsonColumns map[string]bool, pattern *regexp.Regexp, replacement string) ([]ScrubMatch, []scrubUpdate, error) {
+	rows, err := tx.Query(`SELECT CAST(` + key + ` AS TEXT), ` + strings.Join(columns, ", ") + ` FROM ` + table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var (
+		matches []ScrubMatch
+		updates []scrubUpdate
+	)
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns)+1)
+	for i := range values {
+		dest[i+1] = &values[i]
+	}
+	for rows.Next() {
+		var id string
+		dest[0] = &id
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		s := scrubber{pattern: pattern, replacement: replacement}
+		match := ScrubMatch{Table: table, ID: id}
+		var sets []string
+		var args []interface{}
+		for i, column := range columns {
+			if !values[i].Valid {
+				continue
+			}
+			count := s.count
+			scrubbed := s.column(values[i].String, jsonColumns[column])
+			if s.count == count {
+				continue
+			}
+			match.Columns = append(match.Columns, column)
+			sets = append(sets, column+" = ?")
+			args = append(args, scrubbed)
+		}
+		if s.count == 0 {
+			continue
+		}
+		match.Count, match.Before, match.Match, match.After = s.count, s.before, s.match, s.after
+		matches = append(matches, match)
+		updates = append(updates, scrubUpdate{
+			query: `UPDATE ` + table + ` SET ` + strings.Join(sets, ", ") + ` WHERE ` + key + ` = ?`,
+			args:  append(args, id),
+		})
+	}
+	return matches, updates, rows.Err()
+}
+
+// scrubContext is how much text is kept either side of the first match
+const scrubContext = 30
+
+// scrubber replaces matching text, counting the matches and keeping the
+// first with the text around it
+type scrubber struct {
+	pattern     *regexp.Regexp
+	replacement string
+
+	count                int
+	before, match, after string
+}
+
+// column scrubs a column's value: the strings in it if it's a JSON document,
+// else its text
+func (s *scrubber) column(value string, isJSON bool) string {
+	if !isJSON {
+		return s.text(value)
+	}
+	// Escaped text can only match once it's decoded
+	if !strings.Contains(value, `\`) && !s.pattern.MatchString(value) {
+		return value
+	}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return s.text(value)
+	}
+	count := s.count
+	doc = s.walk(doc)
+	if s.count == count {
+		return value
+	}
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return s.text(value)
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// walk scrubs the strings in a decoded JSON document, keys included
+func (s *scrubber) walk(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return s.text(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = s.walk(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		scrubbed := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			scrubbed[s.text(key)] = s.walk(value)
+		}
+		return scrubbed
+	}
+	return v
+}
+
+// text scrubs a piece of text
+func (s *scrubber) text(text string) string {
+	found := s.pattern.FindAllStringIndex(text, -1)
+	if len(found) == 0 {
+		return text
+	}
+	if s.count == 0 {
+		start, end := found[0][0], found[0][1]
+		s.before = strings.TrimLeft(text[clampStart(text, start-scrubContext):start], " \n")
+		s.match = text[start:end]
+		s.after = strings.TrimRight(text[end:clampEnd(text, end+scrubContext)], " \n")
+	}
+	s.count += len(found)
+	return s.pattern.ReplaceAllString(text, s.replacement)
+}
+
+// clampStart moves i into text and onto the start of a character
+func clampStart(text string, i int) int {
+	if i <= 0 {
+		return 0
+	}
+	for i < len(text) && !utf8.RuneStart(text[i]) {
+		i++
+	}
+	return i
+}
+
+// clampEnd moves i into text and back onto the start of a character
+func clampEnd(text string, i int) int {
+	if i >= len(text) {
+		return len(text)
+	}
+	for i > 0 && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	return i
+}
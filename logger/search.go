@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	. "q/types"
+)
+
+// conversations_fts indexes each conversation's name, title and summary for
+// `q conversations search`. It uses FTS4, which the bundled SQLite has built
+// in, keyed by the conversation's rowid and kept in step by triggers.
+const searchSchema = `
+	CREATE VIRTUAL TABLE conversations_fts USING fts4(name, title, summary);
+
+	CREATE TRIGGER conversations_fts_insert AFTER INSERT ON conversations BEGIN
+		INSERT INTO conversations_fts (docid, name, title, summary)
+		VALUES (NEW.rowid, COALESCE(NEW.name, ''), COALESCE(NEW.title, ''), COALESCE(NEW.summary, ''));
+	END;
+
+	CREATE TRIGGER conversations_fts_update AFTER UPDATE OF name, title, summary ON conversations BEGIN
+		DELETE FROM conversations_fts WHERE docid = OLD.rowid;
+		INSERT INTO conversations_fts (docid, name, title, summary)
+		VALUES (NEW.rowid, COALESCE(NEW.name, ''), COALESCE(NEW.title, ''), COALESCE(NEW.summary, ''));
+	END;
+
+	CREATE TRIGGER conversations_fts_delete AFTER DELETE ON conversations BEGIN
+		DELETE FROM conversations_fts WHERE docid = OLD.rowid;
+	END;
+
+	INSERT INTO conversations_fts (docid, name, title, summary)
+	SELECT rowid, COALESCE(name, ''), COALESCE(title, ''), COALESCE(summary, '') FROM conversations;
+`
+
+// initSearch creates the search index the first time a database is opened by
+// a version that has it, filling it from the existing conversations
+func (l *RequestLogger) initSearch() error {
+	var name string
+	err := l.db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'conversations_fts'`).Scan(&name)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(searchSchema); err != nil {
+		tx.Rollback()
+		if strings.Contains(err.Error(), "already exists") {
+			// Another q process created it first
+			return nil
+		}
+		return fmt.Errorf("failed to create the conversation search index: %w", err)
+	}
+	return tx.Commit()
+}
+
+// SetConversationSummary stores a generated title and summary on a conversation
+func (l *RequestLogger) SetConversationSummary(id, title, summary string) error {
+	if !l.enabled || l.db == nil {
+		return nil
+	}
+	_, err := l.db.Exec(`UPDATE conversations SET title = ?, summary = ? WHERE id = ?`, title, summary, id)
+	return err
+}
+
+// SearchConversations returns the conversations whose name, title or summary
+// match query, most recently active first. query uses SQLite full-text
+// syntax: words, "quoted phrases", prefix* and OR.
+func (l *RequestLogger) SearchConversations(query string, limit int) ([]Conversation, error) {
+	if !l.enabled || l.db == nil {
+		return nil, fmt.Errorf("logging is disabled")
+	}
+	return l.queryConversations(conversationQuery+`
+		JOIN conversations_fts f ON f.docid = c.rowid
+		WHERE conversations_fts MATCH ? AND u.requests > 0
+		ORDER BY u.last_utc DESC LIMIT ?`, query, limit)
+}
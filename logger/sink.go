@@ -0,0 +1,237 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	. "q/types"
+)
+
+// Sink delivers logged responses to a central store, such as a team's HTTP
+// collector or an S3 bucket, as well as the local database
+type Sink interface {
+	// Send delivers one batch of records as JSON Lines
+	Send(ctx context.Context, batch []byte) error
+}
+
+const (
+	// defaultSinkBatch is how many records are sent together unless configured
+	defaultSinkBatch = 20
+	// sinkMaxWait is how long a record waits for a full batch before it's sent anyway
+	sinkMaxWait = 15 * time.Minute
+	// sinkTimeout bounds each batch sent, so an unreachable sink only delays a
+	// command briefly; what isn't sent stays queued for later
+	sinkTimeout = 10 * time.Second
+	// sinkMaxBackoff caps the wait before a failed batch is tried again
+	sinkMaxBackoff = 6 * time.Hour
+)
+
+var (
+	sink          Sink
+	sinkBatch     = defaultSinkBatch
+	sinkAnonymize bool
+	sinkSource    string
+	// shipping is set while a logger is sending, so concurrent batch
+	// workers don't send the same records twice
+	shipping int32
+)
+
+// SetSink queues every response logged from now on for s, in batches of
+// batchSize (0 for the default), as usage records if anonymize is set.
+// Records are tagged with source to tell machines apart.
+func SetSink(s Sink, batchSize int, anonymize bool, source string) {
+	sink, sinkAnonymize, sinkSource = s, anonymize, source
+	sinkBatch = batchSize
+	if sinkBatch <= 0 {
+		sinkBatch = defaultSinkBatch
+	}
+}
+
+// sinkRecord is one line sent to the sink: the full entry, or only its usage
+// when anonymizing
+type sinkRecord struct {
+	Source string       `json:"source"`
+	Entry  *LogEntry    `json:"entry,omitempty"`
+	Usage  *UsageRecord `json:"usage,omitempty"`
+}
+
+// initSinkQueue creates the table records wait in until they're sent
+func (l *RequestLogger) initSinkQueue() error {
+	_, err := l.db.Exec(`
+	CREATE TABLE IF NOT EXISTS sink_queue (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		request_id TEXT,
+		queued_utc TEXT,
+		record TEXT,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_utc TEXT
+	)`)
+	return err
+}
+
+// enqueue queues an entry for the sink, if there is one
+func (l *RequestLogger) enqueue(tx *sql.Tx, entry LogEntry) error {
+	if sink == nil {
+		return nil
+	}
+	record := sinkRecord{Source: sinkSource}
+	if sinkAnonymize {
+		usage := Anonymize(entry)
+		record.Usage = &usage
+	} else {
+		// The raw request and stream are for debugging, and can be large
+		entry.RequestRaw, entry.RequestHeaders, entry.ResponseRaw = "", nil, ""
+		record.Entry = &entry
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	query := `INSERT INTO sink_queue (request_id, queued_utc, record, next_attempt_utc) VALUES (?, ?, ?, ?)`
+	if tx != nil {
+		_, err = tx.Exec(query, entry.RequestID, now, string(data), now)
+	} else {
+		_, err = l.db.Exec(query, entry.RequestID, now, string(data), now)
+	}
+	return err
+}
+
+// SinkQueue returns how many records are waiting to be sent, and how many of
+// those failed to send at least once
+func (l *RequestLogger) SinkQueue() (queued, failed int, err error) {
+	if !l.enabled || l.db == nil {
+		return 0, 0, fmt.Errorf("logging is disabled")
+	}
+	err = l.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(attempts > 0), 0) FROM sink_queue`).Scan(&queued, &failed)
+	return queued, failed, err
+}
+
+// shipDue sends the queued records once a full batch is ready or the oldest
+// has waited sinkMaxWait, skipping records that are backing off after a failure
+func (l *RequestLogger) shipDue() {
+	if sink == nil {
+		return
+	}
+	now := time.Now().UTC()
+	var ready int
+	var oldest sql.NullString
+	err := l.db.QueryRow(`SELECT COUNT(*), MIN(queued_utc) FROM sink_queue WHERE next_attempt_utc <= ?`,
+		now.Format(time.RFC3339)).Scan(&ready, &oldest)
+	if err != nil || ready == 0 {
+		return
+	}
+	queued, _ := time.Parse(time.RFC3339, oldest.String)
+	if ready < sinkBatch && now.Sub(queued) < sinkMaxWait {
+		return
+	}
+	l.Ship(false)
+}
+
+// Ship sends the queued records to the sink in batches, stopping at the first
+// batch that fails. That batch is tried again later, waiting twice as long
+// after each failure (up to sinkMaxBackoff) unless all is set, which also
+// sends records that are backing off. It returns how many records were sent.
+func (l *RequestLogger) Ship(all bool) (int, error) {
+	if !l.enabled || l.db == nil {
+		return 0, fmt.Errorf("logging is disabled")
+	}
+	if sink == nil {
+		return 0, fmt.Errorf("no log sink is configured")
+	}
+	if !atomic.CompareAndSwapInt32(&shipping, 0, 1) {
+		return 0, nil
+	}
+	defer atomic.StoreInt32(&shipping, 0)
+
+	due := time.Now().UTC().Format(time.RFC3339)
+	if all {
+		due = "9999"
+	}
+	sent := 0
+	for lastID := int64(0); ; {
+		ids, batch, attempts, err := l.nextBatch(lastID, due)
+		if err != nil || len(ids) == 0 {
+			return sent, err
+		}
+		lastID = ids[len(ids)-1]
+
+		ctx, cancel := context.WithTimeout(context.Background(), sinkTimeout)
+		err = sink.Send(ctx, batch)
+		cancel()
+		if err != nil {
+			l.backOff(ids, attempts+1)
+			l.LogError(ErrorRecord{Kind: "sink", Message: "failed to send logs to the sink", Detail: err.Error()})
+			return sent, err
+		}
+		if err := l.dequeue(ids); err != nil {
+			return sent, err
+		}
+		sent += len(ids)
+	}
+}
+
+// nextBatch reads the next batch of due records after lastID, along with the
+// most attempts any of them has had
+func (l *RequestLogger) nextBatch(lastID int64, due string) ([]int64, []byte, int, error) {
+	rows, err := l.db.Query(`
+		SELECT id, record, attempts FROM sink_queue
+		WHERE id > ? AND next_attempt_utc <= ?
+		ORDER BY id LIMIT ?`, lastID, due, sinkBatch)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer rows.Close()
+	var ids []int64
+	var batch bytes.Buffer
+	maxAttempts := 0
+	for rows.Next() {
+		var id int64
+		var record string
+		var attempts int
+		if err := rows.Scan(&id, &record, &attempts); err != nil {
+			return nil, nil, 0, err
+		}
+		ids = append(ids, id)
+		batch.WriteString(record)
+		batch.WriteByte('\n')
+		if attempts > maxAttempts {
+			maxAttempts = attempts
+		}
+	}
+	return ids, batch.Bytes(), maxAttempts, rows.Err()
+}
+
+// backOff puts off the next attempt at a failed batch
+func (l *RequestLogger) backOff(ids []int64, attempts int) {
+	wait := sinkMaxBackoff
+	if attempts < 10 {
+		if d := time.Minute << uint(attempts-1); d < sinkMaxBackoff {
+			wait = d
+		}
+	}
+	next := time.Now().UTC().Add(wait).Format(time.RFC3339)
+	for _, id := range ids {
+		l.db.Exec(`UPDATE sink_queue SET attempts = ?, next_attempt_utc = ? WHERE id = ?`, attempts, next, id)
+	}
+}
+
+// dequeue removes records that were sent
+func (l *RequestLogger) dequeue(ids []int64) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec(`DELETE FROM sink_queue WHERE id = ?`, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
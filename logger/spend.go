@@ -0,0 +1,39 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+
+	"q/spend"
+)
+
+// SpendSince totals the requests logged since a time and their estimated cost
+func (l *RequestLogger) SpendSince(since time.Time) (requests int, cost float64, err error) {
+	if !l.enabled || l.db == nil {
+		return 0, 0, fmt.Errorf("logging is disabled")
+	}
+	err = l.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(estimated_cost), 0) FROM responses WHERE datetime_utc >= ?`,
+		since.UTC().Format(time.RFC3339)).Scan(&requests, &cost)
+	return requests, cost, err
+}
+
+// WriteSpend rewrites the workspace's spend file with today's totals, for
+// shell prompts, returning them
+func (l *RequestLogger) WriteSpend() (spend.Totals, error) {
+	now := time.Now()
+	totals := spend.Totals{Day: spend.Day(now)}
+	if !l.enabled || l.db == nil || l.spendPath == "" {
+		return totals, nil
+	}
+	var err error
+	if totals.Requests, totals.Cost, err = l.SpendSince(spend.Midnight(now)); err != nil {
+		return totals, err
+	}
+	return totals, spend.Write(l.spendPath, totals)
+}
+
+// writeSpend is WriteSpend after a change to the logs; a prompt showing a
+// stale total is no reason to fail the request
+func (l *RequestLogger) writeSpend() {
+	l.WriteSpend()
+}
@@ -0,0 +1,229 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"q/logger"
+	"q/theme"
+	. "q/types"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+const dashboardDays = 30
+
+var refreshFlag time.Duration
+
+var dashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "Show a live usage dashboard for the last 30 days",
+	Run:   runDashboardCommand,
+}
+
+func init() {
+	dashboardCmd.Flags().DurationVar(&refreshFlag, "refresh", 10*time.Second, "How often to reload stats from the database")
+	LogsCmd.AddCommand(dashboardCmd)
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders values as a row of block characters scaled to the maximum
+func sparkline(values []float64) string {
+	peak := 0.0
+	for _, v := range values {
+		if v > peak {
+			peak = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		if peak == 0 || v == 0 {
+			b.WriteRune(' ')
+			continue
+		}
+		i := int(v / peak * float64(len(sparkBlocks)-1))
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+type dashboardData struct {
+	days   []UsageStats
+	models []UsageStats
+	loaded time.Time
+	err    error
+}
+
+type dashboardDataMsg dashboardData
+type dashboardTickMsg time.Time
+
+type dashboardModel struct {
+	log  *logger.RequestLogger
+	data dashboardData
+}
+
+func loadDashboardData(log *logger.RequestLogger) tea.Cmd {
+	return func() tea.Msg {
+		now := time.Now().UTC()
+		since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -(dashboardDays - 1))
+		until := since.AddDate(0, 0, dashboardDays)
+		data := dashboardData{loaded: time.Now()}
+
+		daily, err := log.DailyUsage(since, until)
+		if err != nil {
+			data.err = err
+			return dashboardDataMsg(data)
+		}
+		// Fill in days without requests so the sparkline has one column per day
+		byDay := make(map[string]UsageStats)
+		for _, d := range daily {
+			byDay[d.Key] = d
+		}
+		for i := 0; i < dashboardDays; i++ {
+			day := since.AddDate(0, 0, i).Format("2006-01-02")
+			stats := byDay[day]
+			stats.Key = day
+			data.days = append(data.days, stats)
+		}
+
+		data.models, data.err = log.ModelUsage(since, until)
+		return dashboardDataMsg(data)
+	}
+}
+
+func dashboardTick() tea.Cmd {
+	if refreshFlag <= 0 {
+		return nil
+	}
+	return tea.Tick(refreshFlag, func(t time.Time) tea.Msg {
+		return dashboardTickMsg(t)
+	})
+}
+
+func (m dashboardModel) Init() tea.Cmd {
+	return tea.Batch(loadDashboardData(m.log), dashboardTick())
+}
+
+func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "esc", "ctrl+c", "ctrl+d":
+			return m, tea.Quit
+		case "r":
+			return m, loadDashboardData(m.log)
+		}
+	case dashboardTickMsg:
+		return m, tea.Batch(loadDashboardData(m.log), dashboardTick())
+	case dashboardDataMsg:
+		m.data = dashboardData(msg)
+	}
+	return m, nil
+}
+
+func (m dashboardModel) View() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	labelStyle := lipgloss.NewStyle().Foreground(theme.Muted()).Width(14)
+	sparkStyle := lipgloss.NewStyle().Foreground(theme.Success())
+	errorStyle := lipgloss.NewStyle().Foreground(theme.Error())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(fmt.Sprintf("ShellAI usage · last %d days", dashboardDays)))
+	if !m.data.loaded.IsZero() {
+		b.WriteString(dimStyle.Render("  updated " + m.data.loaded.Format("15:04:05")))
+	}
+	b.WriteString("\n\n")
+
+	if m.data.err != nil {
+		b.WriteString(errorStyle.Render("Error reading database: " + m.data.err.Error()))
+		b.WriteString("\n\n")
+	}
+
+	var spend, requests []float64
+	var totalCost, latencySum float64
+	var totalRequests, totalErrors, latencyCount int
+	for _, d := range m.data.days {
+		spend = append(spend, d.Cost)
+		requests = append(requests, float64(d.Requests))
+		totalCost += d.Cost
+		totalRequests += d.Requests
+		totalErrors += d.Errors
+		if ok := d.Requests - d.Errors; ok > 0 {
+			latencySum += d.AvgDurationMs * float64(ok)
+			latencyCount += ok
+		}
+	}
+	today := UsageStats{}
+	if len(m.data.days) > 0 {
+		today = m.data.days[len(m.data.days)-1]
+	}
+
+	b.WriteString(labelStyle.Render("Daily spend"))
+	b.WriteString(sparkStyle.Render(sparkline(spend)))
+	b.WriteString(fmt.Sprintf("  total $%.4f · today $%.4f\n", totalCost, today.Cost))
+
+	b.WriteString(labelStyle.Render("Requests"))
+	b.WriteString(sparkStyle.Render(sparkline(requests)))
+	b.WriteString(fmt.Sprintf("  total %d · today %d\n", totalRequests, today.Requests))
+
+	b.WriteString(labelStyle.Render("Error rate"))
+	rate := 0.0
+	if totalRequests > 0 {
+		rate = float64(totalErrors) / float64(totalRequests) * 100
+	}
+	rateText := fmt.Sprintf("%.1f%% (%d/%d)", rate, totalErrors, totalRequests)
+	if totalErrors > 0 {
+		rateText = errorStyle.Render(rateText)
+	}
+	b.WriteString(rateText + "\n")
+
+	b.WriteString(labelStyle.Render("Avg latency"))
+	if latencyCount > 0 {
+		b.WriteString(fmt.Sprintf("%.0fms", latencySum/float64(latencyCount)))
+	} else {
+		b.WriteString("-")
+	}
+	b.WriteString("\n\n")
+
+	headerStyle := lipgloss.NewStyle().Bold(true)
+	b.WriteString(headerStyle.Render(fmt.Sprintf("%-28s %9s %11s %7s %12s", "Model", "Requests", "Cost", "Errors", "Avg latency")))
+	b.WriteString("\n")
+	for _, model := range m.data.models {
+		name := model.Key
+		if len(name) > 28 {
+			name = name[:27] + "…"
+		}
+		b.WriteString(fmt.Sprintf("%-28s %9d %11s %7d %12s\n",
+			name, model.Requests, fmt.Sprintf("$%.4f", model.Cost), model.Errors,
+			fmt.Sprintf("%.0fms", model.AvgDurationMs)))
+	}
+	if len(m.data.models) == 0 {
+		b.WriteString(dimStyle.Render("No requests in this period."))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render(fmt.Sprintf("r refresh · q quit · auto-refresh every %s", refreshFlag)))
+	b.WriteString("\n")
+	return b.String()
+}
+
+func runDashboardCommand(cmd *cobra.Command, args []string) {
+	log, err := logger.NewRequestLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening logs database: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Close()
+
+	if _, err := tea.NewProgram(dashboardModel{log: log}).Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error running dashboard: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,142 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"q/logger"
+	. "q/types"
+
+	"github.com/spf13/cobra"
+)
+
+var purgeYes bool
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete <last|request-id>...",
+	Short: "Delete logged requests",
+	Long: `Delete logged requests, along with the errors recorded for them and their
+thumbnails. A conversation is deleted with its last turn, and the usage
+totals in q logs stats drop the deleted requests.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runDeleteCommand,
+}
+
+var redactCmd = &cobra.Command{
+	Use:   "redact <last|request-id>...",
+	Short: "Remove the prompt and response text of logged requests",
+	Long: `Replace the prompt, system prompt, response and reasoning of logged requests
+with "[redacted]", and drop their raw request and response, context and
+sources. The model, tokens, cost and timing are kept, so stats and budgets
+still count them.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runRedactCommand,
+}
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge --yes",
+	Short: "Delete all logged requests",
+	Long: `Delete every logged request, conversation, batch and error, and the image
+thumbnails, leaving an empty logs database.`,
+	Args: cobra.NoArgs,
+	Run:  runPurgeCommand,
+}
+
+func init() {
+	purgeCmd.Flags().BoolVar(&purgeYes, "yes", false, "Confirm deleting all logs")
+	LogsCmd.AddCommand(deleteCmd)
+	LogsCmd.AddCommand(redactCmd)
+	LogsCmd.AddCommand(purgeCmd)
+}
+
+// openLogs opens the logs database, exiting with an error if it can't
+func openLogs() *logger.RequestLogger {
+	log, err := logger.NewRequestLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening logs database: %v\n", err)
+		os.Exit(1)
+	}
+	return log
+}
+
+// findEntry looks up a logged request by ID, or the latest one for "last"
+func findEntry(log *logger.RequestLogger, ref string) (LogEntry, error) {
+	if ref != "last" {
+		return log.GetResponse(ref)
+	}
+	entries, err := log.GetRecentResponses(1)
+	if err == nil && len(entries) == 0 {
+		err = fmt.Errorf("no logs found")
+	}
+	if err != nil {
+		return LogEntry{}, err
+	}
+	return entries[0], nil
+}
+
+func runDeleteCommand(cmd *cobra.Command, args []string) {
+	log := openLogs()
+	defer log.Close()
+
+	failed := false
+	for _, ref := range args {
+		entry, err := findEntry(log, ref)
+		if err == nil {
+			err = log.DeleteResponse(entry.RequestID)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed = true
+			continue
+		}
+		if entry.Image != nil && entry.Image.Thumbnail != "" {
+			os.Remove(entry.Image.Thumbnail)
+		}
+		fmt.Printf("Deleted %s\n", entry.RequestID)
+	}
+	if failed {
+		log.Close()
+		os.Exit(1)
+	}
+}
+
+func runRedactCommand(cmd *cobra.Command, args []string) {
+	log := openLogs()
+	defer log.Close()
+
+	failed := false
+	for _, ref := range args {
+		entry, err := findEntry(log, ref)
+		if err == nil {
+			err = log.RedactResponse(entry.RequestID)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed = true
+			continue
+		}
+		fmt.Printf("Redacted %s\n", entry.RequestID)
+	}
+	if failed {
+		log.Close()
+		os.Exit(1)
+	}
+}
+
+func runPurgeCommand(cmd *cobra.Command, args []string) {
+	if !purgeYes {
+		fmt.Fprintln(os.Stderr, "Error: this deletes all logs; pass --yes to confirm")
+		os.Exit(1)
+	}
+	log := openLogs()
+	defer log.Close()
+
+	if err := log.Purge(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		log.Close()
+		os.Exit(1)
+	}
+	os.RemoveAll(filepath.Join(filepath.Dir(log.GetDBPath()), "thumbnails"))
+	fmt.Println("Deleted all logs.")
+}
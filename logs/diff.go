@@ -0,0 +1,157 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"q/logger"
+	"q/patch"
+	"q/theme"
+	. "q/types"
+	"q/util"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+var sideBySideFlag bool
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <id1> [id2]",
+	Short: "Show a colored diff of two logged responses",
+	Long: `Compare two logged responses, e.g. the same prompt on two models or before
+and after a prompt tweak. With a single ID, the response is compared with the
+answer it regenerated (see ` + "`q logs regenerate`" + `).`,
+	Args: cobra.RangeArgs(1, 2),
+	Run:  runDiffCommand,
+}
+
+func init() {
+	diffCmd.Flags().BoolVarP(&sideBySideFlag, "side-by-side", "y", false, "Show the responses in two columns")
+	LogsCmd.AddCommand(diffCmd)
+}
+
+func runDiffCommand(cmd *cobra.Command, args []string) {
+	log, err := logger.NewRequestLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening logs database: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Close()
+
+	b, err := log.GetResponse(args[len(args)-1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var a LogEntry
+	if len(args) == 2 {
+		a, err = log.GetResponse(args[0])
+	} else if b.RegeneratedFrom != "" {
+		a, err = log.GetResponse(b.RegeneratedFrom)
+	} else {
+		err = fmt.Errorf("%s wasn't regenerated from another answer; pass two IDs to compare", b.RequestID)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	removedStyle := lipgloss.NewStyle().Foreground(theme.Error())
+	addedStyle := lipgloss.NewStyle().Foreground(theme.Success())
+	hunkStyle := lipgloss.NewStyle().Foreground(theme.Info())
+	dimStyle := lipgloss.NewStyle().Foreground(theme.Muted())
+
+	describe := func(entry LogEntry) string {
+		prompt := ""
+		if len(entry.Messages) > 0 {
+			prompt = entry.Messages[len(entry.Messages)-1].Content
+		}
+		return fmt.Sprintf("%s  %s  %s  %q", entry.RequestID, entry.Model,
+			entry.Timestamp.Local().Format("2006-01-02 15:04"), truncate(prompt, 50))
+	}
+	fmt.Println(removedStyle.Render("--- " + describe(a)))
+	fmt.Println(addedStyle.Render("+++ " + describe(b)))
+
+	ops := patch.Lines(patch.SplitLines(a.Response), patch.SplitLines(b.Response))
+	hunks := patch.Hunks(ops, diffContext)
+	if len(hunks) == 0 {
+		fmt.Println(dimStyle.Render("The responses are identical."))
+		return
+	}
+
+	if sideBySideFlag {
+		printSideBySide(ops, removedStyle, addedStyle, dimStyle)
+		return
+	}
+	for _, hunk := range hunks {
+		fmt.Println(hunkStyle.Render(patch.HunkHeader(hunk)))
+		for _, op := range hunk {
+			line := string(op.Kind) + op.Text
+			switch op.Kind {
+			case '-':
+				fmt.Println(removedStyle.Render(line))
+			case '+':
+				fmt.Println(addedStyle.Render(line))
+			default:
+				fmt.Println(line)
+			}
+		}
+	}
+}
+
+// printSideBySide shows both responses in full, pairing up changed lines
+func printSideBySide(ops []patch.Op, removedStyle, addedStyle, dimStyle lipgloss.Style) {
+	width := (util.GetTermSafeMaxWidth() - 3) / 2
+	if width < 20 {
+		width = 20
+	}
+	cell := func(text string, style *lipgloss.Style) string {
+		text = truncate(strings.ReplaceAll(text, "\t", "    "), width)
+		padded := text + strings.Repeat(" ", width-len([]rune(text)))
+		if style == nil {
+			return padded
+		}
+		return style.Render(padded)
+	}
+	row := func(left, right string, marker string) {
+		fmt.Println(left + dimStyle.Render(" "+marker+" ") + right)
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == ' ' {
+			row(cell(ops[i].Text, nil), cell(ops[i].Text, nil), "│")
+			i++
+			continue
+		}
+		// Pair a run of removals with the run of additions that follows it
+		var removed, added []string
+		for ; i < len(ops) && ops[i].Kind == '-'; i++ {
+			removed = append(removed, ops[i].Text)
+		}
+		for ; i < len(ops) && ops[i].Kind == '+'; i++ {
+			added = append(added, ops[i].Text)
+		}
+		for k := 0; k < len(removed) || k < len(added); k++ {
+			left, right := cell("", nil), cell("", nil)
+			marker := "│"
+			if k < len(removed) {
+				left = cell(removed[k], &removedStyle)
+				marker = "<"
+			}
+			if k < len(added) {
+				right = cell(added[k], &addedStyle)
+				if marker == "<" {
+					marker = "|"
+				} else {
+					marker = ">"
+				}
+			}
+			row(left, right, marker)
+		}
+	}
+}
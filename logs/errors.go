@@ -0,0 +1,86 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"q/logger"
+	"q/theme"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	errorsLimit int
+	errorsKind  string
+	errorsJSON  bool
+)
+
+var errorsCmd = &cobra.Command{
+	Use:   "errors",
+	Short: "Show transport, HTTP and stream parsing errors",
+	Long: `Show problems met while talking to models that aren't part of any answer:
+failed connections ("transport"), error statuses with the start of the
+response body ("http"), and stream chunks that weren't valid SSE ("sse") or
+JSON ("json"), as well as batches the log sink couldn't send ("sink"). Set
+error_log under preferences to "verbose" to also see them as they happen, or
+to "off" to stop recording them.`,
+	Args: cobra.NoArgs,
+	Run:  runErrorsCommand,
+}
+
+func init() {
+	errorsCmd.Flags().IntVarP(&errorsLimit, "limit", "n", 20, "Number of recent errors to show")
+	errorsCmd.Flags().StringVar(&errorsKind, "kind", "", "Only show errors of this kind: transport, http, sse, json or sink")
+	errorsCmd.Flags().BoolVar(&errorsJSON, "json", false, "Output in JSON format")
+	LogsCmd.AddCommand(errorsCmd)
+}
+
+func runErrorsCommand(cmd *cobra.Command, args []string) {
+	log, err := logger.NewRequestLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening logs database: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Close()
+
+	records, err := log.RecentErrors(errorsKind, errorsLimit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading errors: %v\n", err)
+		os.Exit(1)
+	}
+	if len(records) == 0 {
+		fmt.Println("No errors recorded.")
+		return
+	}
+
+	if errorsJSON {
+		for _, record := range records {
+			data, err := json.MarshalIndent(record, "", "  ")
+			if err != nil {
+				continue
+			}
+			fmt.Println(string(data))
+		}
+		return
+	}
+
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	errorStyle := lipgloss.NewStyle().Foreground(theme.Error())
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	for _, record := range records {
+		header := fmt.Sprintf("%s [%s] %s", record.Timestamp.Local().Format("2006-01-02 15:04:05"), record.Kind, record.Model)
+		if record.RequestID != "" {
+			header += " · " + record.RequestID
+		}
+		fmt.Println(headerStyle.Render(header))
+		fmt.Println(errorStyle.Render(record.Message))
+		if record.Detail != "" {
+			fmt.Println(dimStyle.Render(truncate(strings.Join(strings.Fields(record.Detail), " "), 300)))
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,99 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"q/logger"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportSince     string
+	exportUntil     string
+	exportAnonymize bool
+	exportOut       string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export logged requests as JSON Lines",
+	Long: `Export logged requests as JSON Lines, one per line, oldest first.
+
+With --anonymize, each line keeps only what's needed for budgeting: the day,
+model, kind of request, tokens, cost, duration, whether it failed and the key
+alias. Prompts, answers, personas, paths and error text are left out, and the
+request and conversation IDs are hashed. Team leads can concatenate the files
+developers send them and total them with jq or any spreadsheet.`,
+	Args: cobra.NoArgs,
+	Run:  runExportCommand,
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportSince, "since", "", "Only export requests from this day on, as YYYY-MM-DD")
+	exportCmd.Flags().StringVar(&exportUntil, "until", "", "Only export requests before this day, as YYYY-MM-DD")
+	exportCmd.Flags().BoolVar(&exportAnonymize, "anonymize", false, "Strip all text and hash IDs, keeping only usage")
+	exportCmd.Flags().StringVarP(&exportOut, "out", "o", "", "Output file (default: stdout)")
+	LogsCmd.AddCommand(exportCmd)
+}
+
+// parseDay parses a --since or --until day, falling back to def when it's empty
+func parseDay(flag, value string, def time.Time) time.Time {
+	if value == "" {
+		return def
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --%s %q: expected YYYY-MM-DD\n", flag, value)
+		os.Exit(1)
+	}
+	return day
+}
+
+func runExportCommand(cmd *cobra.Command, args []string) {
+	since, until := allTime()
+	since = parseDay("since", exportSince, since)
+	until = parseDay("until", exportUntil, until)
+
+	log := openLogs()
+	defer log.Close()
+
+	entries, err := log.ResponsesBetween(since, until)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading logs: %v\n", err)
+		log.Close()
+		os.Exit(1)
+	}
+
+	var out io.Writer = os.Stdout
+	if exportOut != "" {
+		f, err := os.Create(exportOut)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", exportOut, err)
+			log.Close()
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	encoder := json.NewEncoder(out)
+	for _, entry := range entries {
+		var record interface{} = entry
+		if exportAnonymize {
+			record = logger.Anonymize(entry)
+		}
+		if err := encoder.Encode(record); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing export: %v\n", err)
+			log.Close()
+			os.Exit(1)
+		}
+	}
+	if exportOut != "" {
+		fmt.Printf("Exported %d requests to %s\n", len(entries), exportOut)
+	}
+}
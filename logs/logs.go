@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"q/logger"
+	"q/theme"
 	. "q/types"
 
 	"github.com/charmbracelet/lipgloss"
@@ -18,6 +19,9 @@ var (
 	jsonFlag   bool
 	pathFlag   bool
 	statusFlag bool
+	langFlag   string
+	// samplesFlag is a sample group to show (see q --n)
+	samplesFlag string
 )
 
 // LogsCmd is the root command for logs operations
@@ -33,6 +37,8 @@ func init() {
 	LogsCmd.Flags().BoolVar(&jsonFlag, "json", false, "Output in JSON format")
 	LogsCmd.Flags().BoolVar(&pathFlag, "path", false, "Show the path to the logs database")
 	LogsCmd.Flags().BoolVar(&statusFlag, "status", false, "Show database statistics")
+	LogsCmd.Flags().StringVar(&langFlag, "lang", "", "Only show answers asked for in this language, like ja")
+	LogsCmd.Flags().StringVar(&samplesFlag, "samples", "", "Show all the answers of a sample group (see q --n) and the judge's verdict")
 }
 
 func runLogsCommand(cmd *cobra.Command, args []string) {
@@ -56,7 +62,15 @@ func runLogsCommand(cmd *cobra.Command, args []string) {
 	}
 
 	// Default: show recent logs
-	entries, err := log.GetRecentResponses(limitFlag)
+	var entries []LogEntry
+	switch {
+	case samplesFlag != "":
+		entries, err = log.SampleGroup(samplesFlag)
+	case langFlag != "":
+		entries, err = log.RecentResponsesIn(langFlag, limitFlag)
+	default:
+		entries, err = log.GetRecentResponses(limitFlag)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error retrieving logs: %v\n", err)
 		os.Exit(1)
@@ -70,7 +84,7 @@ func runLogsCommand(cmd *cobra.Command, args []string) {
 	if jsonFlag {
 		printJSON(entries)
 	} else {
-		printFormatted(entries)
+		printFormatted(entries, false)
 	}
 }
 
@@ -84,13 +98,13 @@ func printJSON(entries []LogEntry) {
 	}
 }
 
-func printFormatted(entries []LogEntry) {
-	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
-	labelStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+// printFormatted prints entries for reading; long responses are cut short unless full is set
+func printFormatted(entries []LogEntry, full bool) {
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	labelStyle := lipgloss.NewStyle().Foreground(theme.Muted())
 	valueStyle := lipgloss.NewStyle()
-	errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
-	codeStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
-	dividerStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	errorStyle := lipgloss.NewStyle().Foreground(theme.Error())
+	dividerStyle := lipgloss.NewStyle().Foreground(theme.Muted())
 
 	for i, entry := range entries {
 		// Header with timestamp and model
@@ -98,17 +112,28 @@ func printFormatted(entries []LogEntry) {
 			len(entries)-i,
 			entry.Timestamp.Format("2006-01-02 15:04:05"),
 			entry.Model)
+		if entry.Persona != "" {
+			header += fmt.Sprintf(" as %s", entry.Persona)
+		}
 		fmt.Println(headerStyle.Render(header))
 		fmt.Println()
 
-		// Prompt
-		fmt.Print(labelStyle.Render("Prompt: "))
-		for _, msg := range entry.Messages {
-			if msg.Role == "user" {
-				fmt.Println(valueStyle.Render(msg.Content))
-				break
+		// Earlier turns, then the prompt that was answered
+		earlier, prompt := splitPrompt(entry.Messages)
+		if len(earlier) > 0 {
+			if full {
+				fmt.Println(labelStyle.Render("Earlier turns:"))
+				for _, msg := range earlier {
+					fmt.Println(labelStyle.Render(msg.Role+": ") + valueStyle.Render(msg.Content))
+				}
+			} else {
+				fmt.Print(labelStyle.Render("Earlier turns: "))
+				fmt.Printf("%d messages (q logs show %s for all of them)\n", len(earlier), entry.RequestID)
 			}
+			fmt.Println()
 		}
+		fmt.Print(labelStyle.Render("Prompt: "))
+		fmt.Println(valueStyle.Render(prompt))
 		fmt.Println()
 
 		// Response
@@ -116,24 +141,36 @@ func printFormatted(entries []LogEntry) {
 		if entry.Error != "" {
 			fmt.Println(errorStyle.Render("ERROR: " + entry.Error))
 		} else {
+			if entry.Reasoning != "" {
+				reasoning := entry.Reasoning
+				if !full && len(reasoning) > 300 {
+					reasoning = reasoning[:297] + "..."
+				}
+				fmt.Println(lipgloss.NewStyle().Faint(true).Render("(reasoning) " + reasoning))
+			}
 			// Truncate long responses
 			response := entry.Response
-			if len(response) > 500 {
+			if !full && len(response) > 500 {
 				response = response[:497] + "..."
 			}
-			// Highlight code blocks
-			if strings.Contains(response, "```") {
-				fmt.Println(codeStyle.Render(response))
-			} else {
-				fmt.Println(valueStyle.Render(response))
+			fmt.Println(theme.HighlightCode(response))
+			if entry.Interrupted {
+				fmt.Println(errorStyle.Render("(interrupted: partial response)"))
+			}
+			if entry.StoppedEarly {
+				fmt.Println(lipgloss.NewStyle().Faint(true).Render("(stopped after the first code block)"))
 			}
 		}
 		fmt.Println()
 
 		// Metadata
 		fmt.Print(labelStyle.Render("Tokens: "))
-		fmt.Printf("%d input + %d output = %d total\n",
+		fmt.Printf("%d input + %d output = %d total",
 			entry.PromptTokens, entry.CompletionTokens, entry.TotalTokens)
+		if entry.TokensEstimated {
+			fmt.Print(" (estimated)")
+		}
+		fmt.Println()
 
 		fmt.Print(labelStyle.Render("Cost: "))
 		fmt.Printf("$%.6f\n", entry.EstimatedCost)
@@ -148,6 +185,85 @@ func printFormatted(entries []LogEntry) {
 			fmt.Println(entry.RequestID)
 		}
 
+		if entry.KeyAlias != "" {
+			fmt.Print(labelStyle.Render("API key: "))
+			fmt.Println(entry.KeyAlias)
+		}
+
+		if entry.Language != "" {
+			fmt.Print(labelStyle.Render("Language: "))
+			fmt.Println(entry.Language)
+		}
+
+		if entry.ConversationID != "" {
+			fmt.Print(labelStyle.Render("Conversation: "))
+			fmt.Println(entry.ConversationID)
+		}
+
+		if entry.OutputPath != "" {
+			fmt.Print(labelStyle.Render("Output: "))
+			fmt.Println(entry.OutputPath)
+		}
+
+		if entry.AudioSeconds > 0 {
+			fmt.Print(labelStyle.Render("Audio: "))
+			fmt.Printf("%.1fs transcribed\n", entry.AudioSeconds)
+		}
+
+		if entry.Image != nil {
+			fmt.Print(labelStyle.Render("Image: "))
+			fmt.Printf("%s (%s, %s)\n", entry.Image.Path, entry.Image.Size, entry.Image.Quality)
+			if entry.Image.Thumbnail != "" {
+				fmt.Print(labelStyle.Render("Thumbnail: "))
+				fmt.Println(entry.Image.Thumbnail)
+			}
+		}
+
+		if entry.ContextNote != "" {
+			fmt.Print(labelStyle.Render("Context: "))
+			fmt.Println(entry.ContextNote)
+		}
+
+		if len(entry.URLs) > 0 {
+			fmt.Print(labelStyle.Render("Pages: "))
+			fmt.Println(strings.Join(entry.URLs, ", "))
+		}
+
+		if len(entry.Citations) > 0 {
+			var cited []string
+			for _, citation := range entry.Citations {
+				if citation.Cited {
+					cited = append(cited, fmt.Sprintf("[%d] %s", citation.N, citation.Source))
+				}
+			}
+			fmt.Print(labelStyle.Render("Sources: "))
+			fmt.Printf("%d of %d cited", len(cited), len(entry.Citations))
+			if len(cited) > 0 {
+				fmt.Print(": " + strings.Join(cited, ", "))
+			}
+			fmt.Println()
+		}
+
+		if entry.RoutedFrom != "" {
+			fmt.Print(labelStyle.Render("Routed from: "))
+			fmt.Println(entry.RoutedFrom)
+		}
+
+		if entry.RegeneratedFrom != "" {
+			fmt.Print(labelStyle.Render("Regenerated from: "))
+			fmt.Println(entry.RegeneratedFrom)
+		}
+
+		if entry.BatchID != "" {
+			fmt.Print(labelStyle.Render("Batch: "))
+			fmt.Println(entry.BatchID + " (Batch API pricing)")
+		}
+
+		if entry.SampleGroup != "" {
+			fmt.Print(labelStyle.Render("Samples: "))
+			fmt.Println(entry.SampleGroup + " (see q logs --samples)")
+		}
+
 		// Divider
 		if i < len(entries)-1 {
 			fmt.Println(dividerStyle.Render(strings.Repeat("─", 80)))
@@ -157,36 +273,62 @@ func printFormatted(entries []LogEntry) {
 }
 
 func printStatus(log *logger.RequestLogger) {
-	// For now, just show the database path and basic info
 	fmt.Println("Database path:", log.GetDBPath())
 
-	// Try to get some stats
-	entries, err := log.GetRecentResponses(1000000) // Get all entries
+	models, err := log.ModelUsage(allTime())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading database: %v\n", err)
 		return
 	}
 
-	if len(entries) == 0 {
+	if len(models) == 0 {
 		fmt.Println("Total requests: 0")
 		return
 	}
 
+	requests := 0
 	totalTokens := 0
 	totalCost := 0.0
-	modelCounts := make(map[string]int)
-
-	for _, entry := range entries {
-		totalTokens += entry.TotalTokens
-		totalCost += entry.EstimatedCost
-		modelCounts[entry.Model]++
+	for _, m := range models {
+		requests += m.Requests
+		totalTokens += m.InputTokens + m.OutputTokens
+		totalCost += m.Cost
 	}
 
-	fmt.Printf("Total requests: %d\n", len(entries))
+	fmt.Printf("Total requests: %d\n", requests)
 	fmt.Printf("Total tokens: %d\n", totalTokens)
 	fmt.Printf("Total estimated cost: $%.6f\n", totalCost)
 	fmt.Println("\nRequests by model:")
-	for model, count := range modelCounts {
-		fmt.Printf("  %s: %d\n", model, count)
+	for _, m := range models {
+		fmt.Printf("  %s: %d\n", m.Key, m.Requests)
+	}
+}
+
+// splitPrompt separates the last user message of a logged exchange from the
+// conversation turns sent before it, leaving out system messages
+func splitPrompt(messages []Message) ([]Message, string) {
+	prompt := ""
+	last := len(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			prompt, last = messages[i].Content, i
+			break
+		}
+	}
+	var earlier []Message
+	for _, msg := range messages[:last] {
+		if msg.Role != "system" {
+			earlier = append(earlier, msg)
+		}
+	}
+	return earlier, prompt
+}
+
+// truncate shortens s to at most max runes, marking the cut with "..."
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
 	}
+	return string(runes[:max-3]) + "..."
 }
@@ -0,0 +1,166 @@
+package logs
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"q/logger"
+	"q/reconcile"
+	"q/theme"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reconcileOpenAI    string
+	reconcileThreshold float64
+)
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile --openai-usage <usage.csv>",
+	Short: "Compare estimated costs with a provider's usage export",
+	Long: `Compare the costs estimated in the logs with what the provider billed,
+per day and model, from the usage export of OpenAI's dashboard (a costs or
+activity CSV). Only the models and days in the export are compared. Days whose
+estimate is off by more than --threshold percent are listed, and models off
+over the whole period are pointed out, since their prices in the pricing table
+are likely out of date. Exports without costs are compared by tokens.
+
+Snapshots like gpt-4.1-2025-04-14 are counted as the model they belong to.
+Requests made on other machines or outside q are billed but never logged, so
+an estimate that's lower every day may just mean the key is shared.`,
+	Args: cobra.NoArgs,
+	Run:  runReconcileCommand,
+}
+
+func init() {
+	reconcileCmd.Flags().StringVar(&reconcileOpenAI, "openai-usage", "", "Usage export CSV from the OpenAI dashboard")
+	reconcileCmd.Flags().Float64Var(&reconcileThreshold, "threshold", 5, "Percentage drift to highlight")
+	LogsCmd.AddCommand(reconcileCmd)
+}
+
+func runReconcileCommand(cmd *cobra.Command, args []string) {
+	if reconcileOpenAI == "" {
+		fmt.Fprintln(os.Stderr, "Error: pass the usage export with --openai-usage <usage.csv>")
+		os.Exit(1)
+	}
+	file, err := os.Open(reconcileOpenAI)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	export, err := reconcile.ParseOpenAI(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", reconcileOpenAI, err)
+		os.Exit(1)
+	}
+	if len(export.Usage) == 0 {
+		fmt.Println("The export has no model usage.")
+		return
+	}
+
+	log, err := logger.NewRequestLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening logs database: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Close()
+
+	first, _ := time.Parse("2006-01-02", export.Usage[0].Day)
+	last, _ := time.Parse("2006-01-02", export.Usage[len(export.Usage)-1].Day)
+	stats, err := log.ModelDayUsage(first, last.AddDate(0, 0, 1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading usage: %v\n", err)
+		os.Exit(1)
+	}
+	var local []reconcile.Usage
+	for _, s := range stats {
+		parts := strings.SplitN(s.Key, " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		local = append(local, reconcile.Usage{
+			Day:          parts[0],
+			Model:        parts[1],
+			Requests:     s.Requests,
+			InputTokens:  s.InputTokens,
+			OutputTokens: s.OutputTokens,
+			Cost:         s.Cost,
+		})
+	}
+	rows := reconcile.Compare(export, local)
+
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	labelStyle := lipgloss.NewStyle().Foreground(theme.Muted())
+	errorStyle := lipgloss.NewStyle().Foreground(theme.Error())
+	threshold := reconcileThreshold / 100
+
+	// byCost compares costs if the export has them, else tokens
+	byCost := export.HasCost
+	describe := func(r reconcile.Row) (string, float64) {
+		if byCost {
+			return fmt.Sprintf("billed $%.4f  estimated $%.4f", r.Billed.Cost, r.Local.Cost), r.CostDrift()
+		}
+		return fmt.Sprintf("billed %d tokens  logged %d", r.Billed.InputTokens+r.Billed.OutputTokens, r.Local.InputTokens+r.Local.OutputTokens), r.TokenDrift()
+	}
+	formatDrift := func(drift float64) string {
+		text := fmt.Sprintf("%+.1f%%", drift*100)
+		if math.Abs(drift) > threshold {
+			return errorStyle.Render(text)
+		}
+		return text
+	}
+
+	fmt.Println(headerStyle.Render(fmt.Sprintf("OpenAI usage from %s to %s", first.Format("2006-01-02"), last.Format("2006-01-02"))))
+	if !byCost {
+		fmt.Println(labelStyle.Render("  The export has no costs, so token counts are compared."))
+	}
+	var offModels []reconcile.Row
+	for _, r := range reconcile.ByModel(rows) {
+		text, drift := describe(r)
+		fmt.Printf("  %-24s %s  %s\n", r.Model, text, formatDrift(drift))
+		if byCost && math.Abs(drift) > threshold {
+			offModels = append(offModels, r)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(headerStyle.Render(fmt.Sprintf("Days off by more than %g%%", reconcileThreshold)))
+	off := 0
+	for _, r := range rows {
+		text, drift := describe(r)
+		// A day with nothing billed has no drift, but shouldn't have been estimated either
+		unbilled := r.Local.Requests > 0 && r.Billed.Cost == 0 && r.Billed.InputTokens+r.Billed.OutputTokens == 0
+		if math.Abs(drift) <= threshold && !unbilled {
+			continue
+		}
+		off++
+		fmt.Printf("  %s  %-24s %s  %s\n", labelStyle.Render(r.Day), r.Model, text, formatDrift(drift))
+	}
+	if off == 0 {
+		fmt.Println(labelStyle.Render("  None"))
+	}
+
+	for _, r := range offModels {
+		fmt.Println()
+		if r.Local.Requests == 0 {
+			fmt.Printf("No requests to %s were logged; it was used outside q or on another machine.\n", r.Model)
+			continue
+		}
+		if r.Local.Cost == 0 {
+			fmt.Printf("%s has no price in the pricing table, so its requests were logged as free.\n", r.Model)
+			continue
+		}
+		direction := "low"
+		if r.CostDrift() > 0 {
+			direction = "high"
+		}
+		fmt.Printf("Estimates for %s were %.1f%% too %s over the period; its price in the pricing table may be out of date.\n",
+			r.Model, math.Abs(r.CostDrift())*100, direction)
+	}
+}
@@ -0,0 +1,193 @@
+package logs
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"time"
+
+	"q/logger"
+	. "q/types"
+
+	"github.com/spf13/cobra"
+)
+
+//go:embed report.html.tmpl
+var reportTemplate string
+
+const (
+	chartHeight    = 160
+	chartBarWidth  = 18
+	chartBarGap    = 6
+	topPromptLimit = 10
+	promptMaxChars = 160
+)
+
+var (
+	monthFlag string
+	outFlag   string
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Export a self-contained HTML usage report for a month",
+	Run:   runReportCommand,
+}
+
+func init() {
+	reportCmd.Flags().StringVar(&monthFlag, "month", "", "Month to report on, as YYYY-MM (default: current month)")
+	reportCmd.Flags().StringVar(&outFlag, "out", "", "Output file (default: shell-ai-report-YYYY-MM.html)")
+	LogsCmd.AddCommand(reportCmd)
+}
+
+type reportBar struct {
+	X, Y, Height int
+	Label        string
+	Title        string
+}
+
+type reportModel struct {
+	UsageStats
+	SharePercent float64
+}
+
+type reportPrompt struct {
+	LogEntry
+	Prompt string
+}
+
+type reportData struct {
+	Month        string
+	Generated    string
+	TotalCost    float64
+	Requests     int
+	Errors       int
+	InputTokens  int
+	OutputTokens int
+	ChartWidth   int
+	ChartHeight  int
+	Bars         []reportBar
+	Models       []reportModel
+	TopPrompts   []reportPrompt
+}
+
+func buildReportData(log *logger.RequestLogger, start time.Time) (reportData, error) {
+	end := start.AddDate(0, 1, 0)
+	data := reportData{
+		Month:       start.Format("January 2006"),
+		Generated:   time.Now().Format("2006-01-02 15:04"),
+		ChartHeight: chartHeight,
+	}
+
+	daily, err := log.DailyUsage(start, end)
+	if err != nil {
+		return data, err
+	}
+	byDay := make(map[string]UsageStats)
+	peak := 0.0
+	for _, d := range daily {
+		byDay[d.Key] = d
+		if d.Cost > peak {
+			peak = d.Cost
+		}
+	}
+
+	days := int(end.Sub(start).Hours() / 24)
+	data.ChartWidth = days * (chartBarWidth + chartBarGap)
+	for i := 0; i < days; i++ {
+		day := start.AddDate(0, 0, i)
+		stats := byDay[day.Format("2006-01-02")]
+		height := 0
+		if peak > 0 {
+			height = int(stats.Cost / peak * float64(chartHeight-20))
+		}
+		data.Bars = append(data.Bars, reportBar{
+			X:      i * (chartBarWidth + chartBarGap),
+			Y:      chartHeight - 20 - height,
+			Height: height,
+			Label:  day.Format("2"),
+			Title:  fmt.Sprintf("%s: $%.4f, %d requests", day.Format("Jan 2"), stats.Cost, stats.Requests),
+		})
+	}
+
+	models, err := log.ModelUsage(start, end)
+	if err != nil {
+		return data, err
+	}
+	for _, m := range models {
+		data.TotalCost += m.Cost
+		data.Requests += m.Requests
+		data.Errors += m.Errors
+		data.InputTokens += m.InputTokens
+		data.OutputTokens += m.OutputTokens
+	}
+	for _, m := range models {
+		share := 0.0
+		if data.TotalCost > 0 {
+			share = m.Cost / data.TotalCost * 100
+		}
+		data.Models = append(data.Models, reportModel{UsageStats: m, SharePercent: share})
+	}
+
+	top, err := log.TopResponses(start, end, topPromptLimit)
+	if err != nil {
+		return data, err
+	}
+	for _, entry := range top {
+		prompt := ""
+		if len(entry.Messages) > 0 {
+			prompt = entry.Messages[0].Content
+		}
+		prompt = truncate(prompt, promptMaxChars)
+		data.TopPrompts = append(data.TopPrompts, reportPrompt{LogEntry: entry, Prompt: prompt})
+	}
+	return data, nil
+}
+
+func runReportCommand(cmd *cobra.Command, args []string) {
+	start := time.Now().UTC()
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if monthFlag != "" {
+		parsed, err := time.Parse("2006-01", monthFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --month %q: expected YYYY-MM\n", monthFlag)
+			os.Exit(1)
+		}
+		start = parsed
+	}
+	out := outFlag
+	if out == "" {
+		out = fmt.Sprintf("shell-ai-report-%s.html", start.Format("2006-01"))
+	}
+
+	log, err := logger.NewRequestLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening logs database: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Close()
+
+	data, err := buildReportData(log, start)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading logs: %v\n", err)
+		os.Exit(1)
+	}
+
+	tmpl, err := template.New("report").Parse(reportTemplate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing report template: %v\n", err)
+		os.Exit(1)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", out, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := tmpl.Execute(f, data); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Report for %s written to %s\n", data.Month, out)
+}
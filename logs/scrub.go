@@ -0,0 +1,99 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"q/logger"
+	"q/theme"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scrubPattern     string
+	scrubReplacement string
+	scrubDryRun      bool
+	scrubIgnoreCase  bool
+)
+
+var scrubCmd = &cobra.Command{
+	Use:   "scrub --pattern <regexp>",
+	Short: "Rewrite text matching a pattern everywhere it's logged",
+	Long: `Find text matching a regular expression everywhere it's stored in the logs,
+such as a client's identifiers sent by mistake, and replace it with
+"[scrubbed]". That covers prompts, system prompts, answers, reasoning,
+earlier turns, raw requests and responses, conversation names and summaries,
+errors, batches, queued prompts, drafts and records waiting for the log sink.
+As with q logs redact, the old text is overwritten in the database file.
+
+Run with --dry-run first to see what matches without changing anything.
+
+  q logs scrub --pattern 'ACME-\d+' --dry-run
+  q logs scrub --pattern 'ACME-\d+'
+  q logs scrub --pattern '(ACME)-\d+' --replace '$1-XXX'`,
+	Args: cobra.NoArgs,
+	Run:  runScrubCommand,
+}
+
+func init() {
+	scrubCmd.Flags().StringVar(&scrubPattern, "pattern", "", "Regular expression (Go syntax) of the text to scrub")
+	scrubCmd.Flags().StringVar(&scrubReplacement, "replace", logger.ScrubReplacement, "Text to replace each match with; $1 and so on refer to submatches")
+	scrubCmd.Flags().BoolVar(&scrubDryRun, "dry-run", false, "Show what matches without changing anything")
+	scrubCmd.Flags().BoolVarP(&scrubIgnoreCase, "ignore-case", "i", false, "Match regardless of case")
+	scrubCmd.MarkFlagRequired("pattern")
+	LogsCmd.AddCommand(scrubCmd)
+}
+
+func runScrubCommand(cmd *cobra.Command, args []string) {
+	expr := scrubPattern
+	if scrubIgnoreCase {
+		expr = "(?i)" + expr
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid pattern: %v\n", err)
+		os.Exit(1)
+	}
+	log := openLogs()
+	defer log.Close()
+
+	matches, err := log.Scrub(pattern, scrubReplacement, scrubDryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		log.Close()
+		os.Exit(1)
+	}
+	if len(matches) == 0 {
+		fmt.Println("Nothing in the logs matches.")
+		return
+	}
+
+	dim := lipgloss.NewStyle().Faint(true)
+	highlight := lipgloss.NewStyle().Foreground(theme.Error()).Bold(true)
+	total := 0
+	for _, match := range matches {
+		total += match.Count
+		fmt.Printf("%s %s %s\n", match.ID, dim.Render(fmt.Sprintf("(%s, in %s)", match.Table, strings.Join(match.Columns, ", "))), dim.Render(fmt.Sprintf("×%d", match.Count)))
+		fmt.Printf("  %s%s%s\n", dim.Render("…"+oneLine(match.Before)), highlight.Render(oneLine(match.Match)), dim.Render(oneLine(match.After)+"…"))
+	}
+	rows := "1 record"
+	if len(matches) > 1 {
+		rows = fmt.Sprintf("%d records", len(matches))
+	}
+	if scrubDryRun {
+		fmt.Printf("\n%d matches in %s. Run again without --dry-run to scrub them.\n", total, rows)
+		return
+	}
+	fmt.Printf("\nScrubbed %d matches in %s.\n", total, rows)
+}
+
+var spaces = regexp.MustCompile(`\s+`)
+
+// oneLine puts text on one line for a preview
+func oneLine(s string) string {
+	return spaces.ReplaceAllString(s, " ")
+}
@@ -0,0 +1,43 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var shipCmd = &cobra.Command{
+	Use:   "ship",
+	Short: "Send queued requests to the log sink now",
+	Long: `Send every request waiting for the log sink (log_sink under preferences)
+now, including those backing off after a failed attempt. Requests are
+otherwise sent in batches as they're logged.`,
+	Args: cobra.NoArgs,
+	Run:  runShipCommand,
+}
+
+func init() {
+	LogsCmd.AddCommand(shipCmd)
+}
+
+func runShipCommand(cmd *cobra.Command, args []string) {
+	log := openLogs()
+	defer log.Close()
+
+	sent, err := log.Ship(true)
+	if sent > 0 {
+		fmt.Printf("Sent %d requests.\n", sent)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if queued, _, qerr := log.SinkQueue(); qerr == nil && queued > 0 {
+			fmt.Fprintf(os.Stderr, "%d requests are still queued and will be retried.\n", queued)
+		}
+		log.Close()
+		os.Exit(1)
+	}
+	if sent == 0 {
+		fmt.Println("Nothing to send.")
+	}
+}
@@ -0,0 +1,103 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"q/logger"
+	"q/theme"
+	. "q/types"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var rawFlag bool
+
+var showCmd = &cobra.Command{
+	Use:   "show [last|<request-id>]",
+	Short: "Show one logged request in full",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   runShowCommand,
+}
+
+func init() {
+	showCmd.Flags().BoolVar(&rawFlag, "raw", false, "Dump the exact request JSON and response stream (requests made with --debug)")
+	showCmd.Flags().BoolVar(&jsonFlag, "json", false, "Output in JSON format")
+	LogsCmd.AddCommand(showCmd)
+}
+
+func runShowCommand(cmd *cobra.Command, args []string) {
+	log, err := logger.NewRequestLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening logs database: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Close()
+
+	ref := "last"
+	if len(args) > 0 {
+		ref = args[0]
+	}
+	entry, err := findEntry(log, ref)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if rawFlag {
+		entry.RequestRaw, entry.RequestHeaders, entry.ResponseRaw, err = log.GetRaw(entry.RequestID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if jsonFlag {
+		printJSON([]LogEntry{entry})
+		return
+	}
+	printFormatted([]LogEntry{entry}, true)
+	if rawFlag {
+		printRaw(entry)
+	}
+}
+
+func printRaw(entry LogEntry) {
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	dimStyle := lipgloss.NewStyle().Foreground(theme.Muted())
+
+	fmt.Println()
+	if entry.RequestRaw == "" && entry.ResponseRaw == "" {
+		fmt.Println(dimStyle.Render("No raw data was recorded for this request. Run it again with --debug to capture it."))
+		return
+	}
+
+	fmt.Println(headerStyle.Render("Raw request"))
+	names := make([]string, 0, len(entry.RequestHeaders))
+	for name := range entry.RequestHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(dimStyle.Render(name+": ") + entry.RequestHeaders[name])
+	}
+	if len(names) > 0 {
+		fmt.Println()
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, []byte(entry.RequestRaw), "", "  "); err == nil {
+		fmt.Println(pretty.String())
+	} else {
+		fmt.Println(entry.RequestRaw)
+	}
+
+	fmt.Println()
+	chunks := strings.Count(entry.ResponseRaw, "data:")
+	fmt.Println(headerStyle.Render(fmt.Sprintf("Raw response (%d data lines)", chunks)))
+	fmt.Println(strings.TrimRight(entry.ResponseRaw, "\n"))
+}
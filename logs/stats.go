@@ -0,0 +1,206 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"q/logger"
+	"q/theme"
+	. "q/types"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsDays   int
+	statsErrors bool
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize requests, tokens and cost by day, model and conversation",
+	Long: `Summarize usage from the rollup tables the log keeps up to date on every
+write, so this stays instant however many requests are logged. Models that
+mostly gave short answers over the last 30 days are listed with what a cheaper
+model would have cost for those requests.
+
+With --errors, break down the failed requests of the last --days days
+instead: the failure rate by model, endpoint and day, the most common error
+codes, how often requests were retried with another key, and the mean time
+between failures, to tell a flaky gateway from a flaky provider.`,
+	Args: cobra.NoArgs,
+	Run:  runStatsCommand,
+}
+
+func init() {
+	statsCmd.Flags().IntVarP(&statsDays, "days", "d", 7, "Number of recent days to break down")
+	statsCmd.Flags().BoolVar(&statsErrors, "errors", false, "Analyze failed requests instead")
+	LogsCmd.AddCommand(statsCmd)
+}
+
+// analysisDays is how far back the stats look for cheaper ways to get the same answers
+const analysisDays = 30
+
+// allTime is the range that covers every logged request
+func allTime() (time.Time, time.Time) {
+	return time.Time{}, time.Now().UTC().AddDate(0, 0, 1)
+}
+
+func runStatsCommand(cmd *cobra.Command, args []string) {
+	log, err := logger.NewRequestLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening logs database: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Close()
+
+	if statsErrors {
+		printFailureStats(log)
+		return
+	}
+
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	labelStyle := lipgloss.NewStyle().Foreground(theme.Muted())
+
+	since, until := allTime()
+	models, err := log.ModelUsage(since, until)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading usage: %v\n", err)
+		os.Exit(1)
+	}
+	if len(models) == 0 {
+		fmt.Println("No logs found. Make some requests to see them here!")
+		return
+	}
+
+	var total UsageStats
+	for _, m := range models {
+		total.Requests += m.Requests
+		total.Errors += m.Errors
+		total.Cost += m.Cost
+		total.InputTokens += m.InputTokens
+		total.OutputTokens += m.OutputTokens
+	}
+	fmt.Println(headerStyle.Render("All time"))
+	fmt.Printf("  %d requests (%d failed) · %d input + %d output tokens · $%.4f\n\n",
+		total.Requests, total.Errors, total.InputTokens, total.OutputTokens, total.Cost)
+
+	today := time.Now().UTC()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	daily, err := log.DailyUsage(today.AddDate(0, 0, -(statsDays-1)), today.AddDate(0, 0, 1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading usage: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(headerStyle.Render(fmt.Sprintf("Last %d days", statsDays)))
+	if len(daily) == 0 {
+		fmt.Println(labelStyle.Render("  No requests"))
+	}
+	for _, d := range daily {
+		fmt.Printf("  %s  %5d requests  %9d tokens  $%.4f\n",
+			labelStyle.Render(d.Key), d.Requests, d.InputTokens+d.OutputTokens, d.Cost)
+	}
+	fmt.Println()
+
+	fmt.Println(headerStyle.Render("By model"))
+	for _, m := range models {
+		fmt.Printf("  %-24s %5d requests  %9d tokens  $%.4f  %s\n",
+			m.Key, m.Requests, m.InputTokens+m.OutputTokens, m.Cost,
+			labelStyle.Render(fmt.Sprintf("avg %.1fs", m.AvgDurationMs/1000)))
+	}
+
+	conversations, err := log.CostliestConversations(5)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading conversations: %v\n", err)
+		os.Exit(1)
+	}
+	if len(conversations) > 0 {
+		fmt.Println()
+		fmt.Println(headerStyle.Render("Costliest conversations"))
+		for _, conv := range conversations {
+			fmt.Printf("  %s  $%.4f  %s\n", labelStyle.Render(conv.ID), conv.Cost, truncate(conv.Name, 50))
+		}
+	}
+
+	recommendations, err := log.Recommendations(time.Now().AddDate(0, 0, -analysisDays))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error analyzing usage: %v\n", err)
+		os.Exit(1)
+	}
+	if len(recommendations) > 0 {
+		fmt.Println()
+		fmt.Println(headerStyle.Render("Recommendations"))
+		for _, r := range recommendations {
+			fmt.Printf("  %.0f%% of your %s requests (%d of %d) got answers under %d tokens.\n",
+				float64(r.Short)*100/float64(r.Requests), r.Model, r.Short, r.Requests, logger.ShortAnswerTokens)
+			fmt.Printf("  %s\n", labelStyle.Render(fmt.Sprintf("Sending those to %s would have cost $%.4f instead of $%.4f, saving $%.4f over the last %d days.",
+				r.Alternative, r.AlternativeCost, r.Cost, r.Savings(), analysisDays)))
+		}
+	}
+}
+
+// printFailureStats breaks down the failed requests of the last statsDays days
+func printFailureStats(log *logger.RequestLogger) {
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	labelStyle := lipgloss.NewStyle().Foreground(theme.Muted())
+	errorStyle := lipgloss.NewStyle().Foreground(theme.Error())
+
+	today := time.Now().UTC()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	report, err := log.FailureAnalysis(today.AddDate(0, 0, -(statsDays-1)), today.AddDate(0, 0, 1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error analyzing failures: %v\n", err)
+		os.Exit(1)
+	}
+	if report.Total.Requests == 0 {
+		fmt.Printf("No requests in the last %d days.\n", statsDays)
+		return
+	}
+
+	fmt.Println(headerStyle.Render(fmt.Sprintf("Last %d days", statsDays)))
+	fmt.Printf("  %d of %d requests failed (%.1f%%) · %s\n",
+		report.Total.Failures, report.Total.Requests, report.Total.Rate()*100, failureDetail(report.Total))
+	if report.Total.Failures == 0 {
+		return
+	}
+
+	printRow := func(s logger.FailureStats, width int) {
+		rate := fmt.Sprintf("%5.1f%%", s.Rate()*100)
+		if s.Failures > 0 {
+			rate = errorStyle.Render(rate)
+		}
+		fmt.Printf("  %-*s %5d requests  %4d failed  %s  %s\n",
+			width, s.Key, s.Requests, s.Failures, rate, labelStyle.Render(failureDetail(s)))
+	}
+	fmt.Println()
+	fmt.Println(headerStyle.Render("By model"))
+	for _, s := range report.Models {
+		printRow(s, 24)
+	}
+	fmt.Println()
+	fmt.Println(headerStyle.Render("By endpoint"))
+	for _, s := range report.Endpoints {
+		printRow(s, 24)
+	}
+	fmt.Println()
+	fmt.Println(headerStyle.Render("By day"))
+	for _, s := range report.Days {
+		printRow(s, 10)
+	}
+	fmt.Println()
+	fmt.Println(headerStyle.Render("Most common errors"))
+	for _, c := range report.Codes {
+		fmt.Printf("  %-24s %5d  %s\n", c.Code, c.Count, labelStyle.Render(truncate(c.Example, 60)))
+	}
+}
+
+// failureDetail describes the retries and mean time between failures of a group
+func failureDetail(s logger.FailureStats) string {
+	detail := fmt.Sprintf("avg %.2f retries", s.AvgRetries())
+	if mtbf := s.MTBF(); mtbf > 0 {
+		detail += " · a failure every " + mtbf.Round(time.Second).String()
+	}
+	return detail
+}
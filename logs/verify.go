@@ -0,0 +1,96 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"q/logger"
+	"q/theme"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyHead string
+	verifyJSON bool
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the audit trail of logged requests hasn't been tampered with",
+	Long: `Check the requests logged with audit_log on haven't been changed or deleted.
+In audit mode each request is logged with a hash of itself and of the request
+logged before it, so editing the database breaks the chain where it happened,
+and q logs delete, redact, scrub and purge are refused.
+
+The latest hash is printed at the end. Keep it somewhere the logs can't be
+changed from, and pass it to --head later to also catch the chain's end
+being rewritten. Exits with 1 if anything doesn't check out.`,
+	Args: cobra.NoArgs,
+	Run:  runVerifyCommand,
+}
+
+func init() {
+	verifyCmd.Flags().StringVar(&verifyHead, "head", "", "A hash printed by an earlier check, which must still be in the chain")
+	verifyCmd.Flags().BoolVar(&verifyJSON, "json", false, "Output in JSON format")
+	LogsCmd.AddCommand(verifyCmd)
+}
+
+func runVerifyCommand(cmd *cobra.Command, args []string) {
+	log := openLogs()
+	defer log.Close()
+
+	report, err := log.VerifyChain(verifyHead)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		log.Close()
+		os.Exit(1)
+	}
+	if verifyJSON {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printChainReport(report)
+	}
+	if len(report.Problems) > 0 {
+		log.Close()
+		os.Exit(1)
+	}
+}
+
+func printChainReport(report logger.ChainReport) {
+	dim := lipgloss.NewStyle().Faint(true)
+	red := lipgloss.NewStyle().Foreground(theme.Error())
+	green := lipgloss.NewStyle().Foreground(theme.Success())
+
+	if report.Chained == 0 && len(report.Problems) == 0 {
+		fmt.Println("No requests have been logged in audit mode; set audit_log under preferences to start.")
+		return
+	}
+	fmt.Printf("%d requests in the audit trail, logged %s to %s.\n", report.Chained,
+		report.First.Local().Format("2006-01-02 15:04"), report.Last.Local().Format("2006-01-02 15:04"))
+	if report.Unchained > 0 {
+		fmt.Println(dim.Render(fmt.Sprintf("%d requests logged since it began aren't in it, because audit_log was off.", report.Unchained)))
+	}
+	if len(report.Problems) == 0 {
+		fmt.Println(green.Render("✓ Nothing was changed or deleted."))
+	} else {
+		found := "1 problem"
+		if len(report.Problems) > 1 {
+			found = fmt.Sprintf("%d problems", len(report.Problems))
+		}
+		fmt.Println(red.Render("✗ Found " + found + ":"))
+		for _, problem := range report.Problems {
+			if problem.RequestID == "" {
+				fmt.Printf("  %s\n", problem.Problem)
+				continue
+			}
+			fmt.Printf("  %s %s: %s\n", problem.RequestID, dim.Render(problem.Logged.Local().Format("2006-01-02 15:04")), problem.Problem)
+		}
+	}
+	if report.Head != "" {
+		fmt.Println(dim.Render("Latest hash: " + report.Head))
+	}
+}
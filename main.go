@@ -1,15 +1,23 @@
 package main
 
 import (
+	"os"
+
 	"q/cli"
+	"q/exitcode"
 	"q/logs"
+	"q/personas"
 )
 
 func main() {
 	// Add logs subcommand
+	logs.LogsCmd.AddCommand(cli.RegenerateCmd)
 	cli.RootCmd.AddCommand(logs.LogsCmd)
+	personas.PersonasCmd.AddCommand(cli.PersonasTestCmd)
+	cli.RootCmd.AddCommand(personas.PersonasCmd)
 
+	// Cobra has already printed the error and usage
 	if err := cli.RootCmd.Execute(); err != nil {
-		panic(err)
+		os.Exit(exitcode.Failure)
 	}
 }
@@ -0,0 +1,147 @@
+// Package memory keeps facts the user has pinned with `q remember`, such as
+// which cluster or package manager they use, in ~/.shell-ai/memory.db, so they
+// can be sent with every request. Facts belong to a profile, so work and home
+// setups can keep separate ones.
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"q/workspace"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// DefaultProfile is the profile used when SHELL_AI_PROFILE isn't set
+const DefaultProfile = "default"
+
+// Fact is one remembered fact
+type Fact struct {
+	ID      int64
+	Profile string
+	Text    string
+	Created time.Time
+}
+
+// Store is the database facts are kept in
+type Store struct {
+	db *sql.DB
+}
+
+// Profile is the active profile: SHELL_AI_PROFILE, or else DefaultProfile
+func Profile() string {
+	if profile := strings.TrimSpace(os.Getenv("SHELL_AI_PROFILE")); profile != "" {
+		return profile
+	}
+	return DefaultProfile
+}
+
+// Open opens (or creates) the memory database at ~/.shell-ai/memory.db, or in
+// the selected workspace's directory
+func Open() (*Store, error) {
+	dir, err := workspace.Dir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create memory directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "memory.db")+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open memory database: %w", err)
+	}
+
+	_, err = db.Exec(`
+	CREATE TABLE IF NOT EXISTS facts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		profile TEXT NOT NULL,
+		fact TEXT NOT NULL,
+		created_utc TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_facts_profile ON facts(profile);
+	`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database connection
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Add remembers a fact in a profile, returning its ID
+func (s *Store) Add(profile, text string) (int64, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, fmt.Errorf("the fact is empty")
+	}
+	result, err := s.db.Exec(`INSERT INTO facts (profile, fact, created_utc) VALUES (?, ?, ?)`,
+		profile, text, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// List returns a profile's facts, oldest first
+func (s *Store) List(profile string) ([]Fact, error) {
+	rows, err := s.db.Query(`SELECT id, profile, fact, COALESCE(created_utc, '') FROM facts WHERE profile = ? ORDER BY id`, profile)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var facts []Fact
+	for rows.Next() {
+		var fact Fact
+		var created string
+		if err := rows.Scan(&fact.ID, &fact.Profile, &fact.Text, &created); err != nil {
+			return nil, err
+		}
+		fact.Created, _ = time.Parse(time.RFC3339, created)
+		facts = append(facts, fact)
+	}
+	return facts, rows.Err()
+}
+
+// Forget deletes a profile's fact by ID, reporting whether there was one
+func (s *Store) Forget(profile string, id int64) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM facts WHERE profile = ? AND id = ?`, profile, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ForgetAll deletes every fact in a profile, returning how many there were
+func (s *Store) ForgetAll(profile string) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM facts WHERE profile = ?`, profile)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Prompt renders facts as an instruction for the system prompt, or "" if there are none
+func Prompt(facts []Fact) string {
+	if len(facts) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Facts the user has asked you to remember about their setup. Take them into account where they're relevant:\n")
+	for _, fact := range facts {
+		b.WriteString("\n- " + fact.Text)
+	}
+	return b.String()
+}
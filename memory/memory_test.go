@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	gke, err := store.Add("work", "our k8s cluster is on GKE 1.29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("work", "  we use pnpm  "); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("home", "I use fish"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("work", " "); err == nil {
+		t.Error("expected an error adding an empty fact")
+	}
+
+	facts, err := store.List("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(facts) != 2 || facts[0].Text != "our k8s cluster is on GKE 1.29" || facts[1].Text != "we use pnpm" {
+		t.Fatalf("unexpected facts: %+v", facts)
+	}
+
+	// A fact can only be forgotten from its own profile
+	if ok, err := store.Forget("home", gke); err != nil || ok {
+		t.Errorf("Forget from another profile = %v, %v", ok, err)
+	}
+	if ok, err := store.Forget("work", gke); err != nil || !ok {
+		t.Errorf("Forget = %v, %v", ok, err)
+	}
+	if n, err := store.ForgetAll("work"); err != nil || n != 1 {
+		t.Errorf("ForgetAll = %d, %v", n, err)
+	}
+	if facts, _ := store.List("home"); len(facts) != 1 {
+		t.Errorf("home profile has %d facts, want 1", len(facts))
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	if got := Prompt(nil); got != "" {
+		t.Errorf("Prompt(nil) = %q", got)
+	}
+	got := Prompt([]Fact{{Text: "we use pnpm"}, {Text: "prod is in eu-west-1"}})
+	if !strings.HasSuffix(got, "\n\n- we use pnpm\n- prod is in eu-west-1") {
+		t.Errorf("unexpected prompt: %q", got)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	t.Setenv("SHELL_AI_PROFILE", "")
+	if got := Profile(); got != DefaultProfile {
+		t.Errorf("Profile() = %q", got)
+	}
+	t.Setenv("SHELL_AI_PROFILE", "work")
+	if got := Profile(); got != "work" {
+		t.Errorf("Profile() = %q", got)
+	}
+}
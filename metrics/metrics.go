@@ -0,0 +1,154 @@
+// Package metrics keeps Prometheus counters and latency histograms of the
+// requests in the logs database, for `q serve` to expose on /metrics. Every
+// q process logs to the same database, so tailing it covers them all.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"q/logger"
+	. "q/types"
+)
+
+// Buckets are the upper bounds, in seconds, of the request latency histogram
+var Buckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120}
+
+// modelStats is what's been counted for one model
+type modelStats struct {
+	requests, failed          int64
+	inputTokens, outputTokens int64
+	cost                      float64
+	// latency counts answered requests per bucket (not cumulative), with one
+	// more for those slower than the last bucket
+	latency    []int64
+	latencySum float64
+}
+
+// Collector counts the requests and errors logged since it started reading.
+// Counts only grow, even if entries are deleted from the log later.
+type Collector struct {
+	mu        sync.Mutex
+	lastRowID int64
+	lastError int64
+	models    map[string]*modelStats
+	errors    map[string]int64
+}
+
+// NewCollector returns a collector that has counted nothing yet
+func NewCollector() *Collector {
+	return &Collector{models: map[string]*modelStats{}, errors: map[string]int64{}}
+}
+
+// Update counts the responses and errors logged since the last update
+func (c *Collector) Update(log *logger.RequestLogger) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last, err := log.UsageAfter(c.lastRowID, c.add)
+	c.lastRowID = last
+	if err != nil {
+		return err
+	}
+	records, err := log.ErrorsAfter(c.lastError)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		c.errors[record.Kind]++
+		c.lastError = record.ID
+	}
+	return nil
+}
+
+// add counts one response
+func (c *Collector) add(entry LogEntry) {
+	stats, ok := c.models[entry.Model]
+	if !ok {
+		stats = &modelStats{latency: make([]int64, len(Buckets)+1)}
+		c.models[entry.Model] = stats
+	}
+	stats.requests++
+	stats.inputTokens += int64(entry.PromptTokens)
+	stats.outputTokens += int64(entry.CompletionTokens)
+	stats.cost += entry.EstimatedCost
+	if entry.Error != "" {
+		stats.failed++
+		return
+	}
+	seconds := float64(entry.DurationMs) / 1000
+	i := sort.SearchFloat64s(Buckets, seconds)
+	stats.latency[i]++
+	stats.latencySum += seconds
+}
+
+// Write writes the metrics in the Prometheus text exposition format
+func (c *Collector) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	models := make([]string, 0, len(c.models))
+	for model := range c.models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	kinds := make([]string, 0, len(c.errors))
+	for kind := range c.errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var b strings.Builder
+	header := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	header("shell_ai_requests_total", "counter", "Requests logged, by model and whether they failed.")
+	for _, model := range models {
+		stats := c.models[model]
+		fmt.Fprintf(&b, "shell_ai_requests_total{model=%s,status=\"ok\"} %d\n", quote(model), stats.requests-stats.failed)
+		fmt.Fprintf(&b, "shell_ai_requests_total{model=%s,status=\"error\"} %d\n", quote(model), stats.failed)
+	}
+	header("shell_ai_tokens_total", "counter", "Tokens used, by model and direction.")
+	for _, model := range models {
+		stats := c.models[model]
+		fmt.Fprintf(&b, "shell_ai_tokens_total{model=%s,type=\"input\"} %d\n", quote(model), stats.inputTokens)
+		fmt.Fprintf(&b, "shell_ai_tokens_total{model=%s,type=\"output\"} %d\n", quote(model), stats.outputTokens)
+	}
+	header("shell_ai_cost_usd_total", "counter", "Estimated cost in US dollars, by model.")
+	for _, model := range models {
+		fmt.Fprintf(&b, "shell_ai_cost_usd_total{model=%s} %s\n", quote(model), number(c.models[model].cost))
+	}
+	header("shell_ai_errors_total", "counter", "Transport, HTTP, stream and log sink errors, by kind.")
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "shell_ai_errors_total{kind=%s} %d\n", quote(kind), c.errors[kind])
+	}
+	header("shell_ai_request_duration_seconds", "histogram", "Time to a complete answer, by model.")
+	for _, model := range models {
+		stats := c.models[model]
+		var cumulative int64
+		for i, bound := range Buckets {
+			cumulative += stats.latency[i]
+			fmt.Fprintf(&b, "shell_ai_request_duration_seconds_bucket{model=%s,le=\"%s\"} %d\n", quote(model), number(bound), cumulative)
+		}
+		cumulative += stats.latency[len(Buckets)]
+		fmt.Fprintf(&b, "shell_ai_request_duration_seconds_bucket{model=%s,le=\"+Inf\"} %d\n", quote(model), cumulative)
+		fmt.Fprintf(&b, "shell_ai_request_duration_seconds_sum{model=%s} %s\n", quote(model), number(stats.latencySum))
+		fmt.Fprintf(&b, "shell_ai_request_duration_seconds_count{model=%s} %d\n", quote(model), cumulative)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// quote quotes a label value, escaping backslashes, quotes and newlines
+func quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+func number(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"q/logger"
+	. "q/types"
+)
+
+func TestCollector(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	log, err := logger.NewRequestLogger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	logged := []LogEntry{
+		{RequestID: "a", Model: "gpt-4.1", PromptTokens: 100, CompletionTokens: 20, EstimatedCost: 0.5, DurationMs: 800},
+		{RequestID: "b", Model: "gpt-4.1", PromptTokens: 50, EstimatedCost: 0.25, DurationMs: 3000},
+		{RequestID: "c", Model: `odd"model`, Error: "HTTP 500", DurationMs: 100},
+	}
+	for _, entry := range logged {
+		entry.Timestamp = time.Now().UTC()
+		if err := log.LogResponse(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log.LogError(ErrorRecord{Kind: "http", Model: "gpt-4.1", Message: "500"})
+
+	c := NewCollector()
+	if err := c.Update(log); err != nil {
+		t.Fatal(err)
+	}
+	// Deleting an entry doesn't take it back out of the counters
+	if err := log.DeleteResponse("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Update(log); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := c.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		`shell_ai_requests_total{model="gpt-4.1",status="ok"} 2`,
+		`shell_ai_requests_total{model="odd\"model",status="error"} 1`,
+		`shell_ai_tokens_total{model="gpt-4.1",type="input"} 150`,
+		`shell_ai_cost_usd_total{model="gpt-4.1"} 0.75`,
+		`shell_ai_errors_total{kind="http"} 1`,
+		`shell_ai_request_duration_seconds_bucket{model="gpt-4.1",le="1"} 1`,
+		`shell_ai_request_duration_seconds_bucket{model="gpt-4.1",le="5"} 2`,
+		`shell_ai_request_duration_seconds_bucket{model="gpt-4.1",le="+Inf"} 2`,
+		`shell_ai_request_duration_seconds_sum{model="gpt-4.1"} 3.8`,
+		`shell_ai_request_duration_seconds_count{model="odd\"model"} 0`,
+		"# TYPE shell_ai_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %s in\n%s", want, out)
+		}
+	}
+
+	// New entries are counted after the log is purged and starts over
+	if err := log.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	c.Update(log)
+	log.LogResponse(LogEntry{RequestID: "d", Model: "gpt-4.1", Timestamp: time.Now().UTC(), DurationMs: 100})
+	c.Update(log)
+	b.Reset()
+	c.Write(&b)
+	if !strings.Contains(b.String(), `shell_ai_requests_total{model="gpt-4.1",status="ok"} 3`) {
+		t.Errorf("an entry logged after a purge should be counted:\n%s", b.String())
+	}
+}
@@ -0,0 +1,118 @@
+package patch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Result is an edit worked out against a file's content
+type Result struct {
+	Edit          FileEdit
+	Before, After string
+	// Hunks show each change, numbered by where it is in Before and After
+	Hunks [][]Op
+}
+
+// Apply works out the file's content after the edit. Each change's old lines
+// must be found in the file: at the line its diff gives if they're there,
+// otherwise the closest place they are, ignoring trailing whitespace if need be.
+func (e FileEdit) Apply(original string) (*Result, error) {
+	result := &Result{Edit: e, Before: original}
+	if e.Delete {
+		result.Hunks = numberedDeletion(SplitLines(original))
+		return result, nil
+	}
+	if e.Create && original != "" {
+		return nil, fmt.Errorf("%s already exists", e.Path)
+	}
+
+	lines := SplitLines(original)
+	// offset is how many lines earlier changes added, for the line hints
+	offset := 0
+	for n, change := range e.Changes {
+		// Search/replace blocks have no line, and go to the first match
+		hint := 0
+		if change.Line > 0 {
+			hint = change.Line - 1 + offset
+		}
+		at := -1
+		switch {
+		case len(change.Old) == 0 && original == "":
+			at = 0
+		case len(change.Old) == 0:
+			return nil, fmt.Errorf("%s: change %d has nothing to find; it only adds to a file that already exists", e.Path, n+1)
+		default:
+			at = find(lines, change.Old, hint, equalLines)
+			if at < 0 {
+				at = find(lines, change.Old, hint, equalTrimmed)
+			}
+		}
+		if at < 0 {
+			return nil, fmt.Errorf("%s: couldn't find the lines change %d replaces", e.Path, n+1)
+		}
+
+		ops := Lines(change.Old, change.New)
+		for i := range ops {
+			if ops[i].ALine > 0 {
+				ops[i].ALine += at - offset
+			}
+			if ops[i].BLine > 0 {
+				ops[i].BLine += at
+			}
+		}
+		result.Hunks = append(result.Hunks, Hunks(ops, 3)...)
+
+		updated := append(append([]string(nil), lines[:at]...), change.New...)
+		lines = append(updated, lines[at+len(change.Old):]...)
+		offset += len(change.New) - len(change.Old)
+	}
+	result.After = strings.Join(lines, "\n")
+	if len(lines) > 0 && (original == "" || strings.HasSuffix(original, "\n")) {
+		result.After += "\n"
+	}
+	return result, nil
+}
+
+// numberedDeletion is the diff of deleting every line
+func numberedDeletion(lines []string) [][]Op {
+	if len(lines) == 0 {
+		return nil
+	}
+	ops := make([]Op, len(lines))
+	for i, line := range lines {
+		ops[i] = Op{Kind: '-', Text: line, ALine: i + 1}
+	}
+	return [][]Op{ops}
+}
+
+func equalLines(a, b string) bool { return a == b }
+
+func equalTrimmed(a, b string) bool {
+	return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t")
+}
+
+// find returns where want starts in lines, the match closest to hint winning,
+// or -1 if it isn't there
+func find(lines, want []string, hint int, equal func(a, b string) bool) int {
+	best := -1
+	for start := 0; start+len(want) <= len(lines); start++ {
+		match := true
+		for i := range want {
+			if !equal(lines[start+i], want[i]) {
+				match = false
+				break
+			}
+		}
+		if match && (best < 0 || distance(start, hint) < distance(best, hint)) {
+			best = start
+		}
+	}
+	return best
+}
+
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
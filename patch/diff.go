@@ -0,0 +1,111 @@
+package patch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is a line of a diff
+type Op struct {
+	Kind byte // ' ', '-' or '+'
+	Text string
+	// ALine and BLine are 1-based line numbers in each side (0 when absent)
+	ALine, BLine int
+}
+
+// Lines computes a line diff of a and b from their longest common subsequence
+func Lines(a, b []string) []Op {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []Op
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, Op{Kind: ' ', Text: a[i], ALine: i + 1, BLine: j + 1})
+			i++
+			j++
+		case j >= len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, Op{Kind: '-', Text: a[i], ALine: i + 1})
+			i++
+		default:
+			ops = append(ops, Op{Kind: '+', Text: b[j], BLine: j + 1})
+			j++
+		}
+	}
+	return ops
+}
+
+// Hunks groups ops into hunks of changes with up to context unchanged lines around them
+func Hunks(ops []Op, context int) [][]Op {
+	var hunks [][]Op
+	start, end := -1, -1
+	for i, op := range ops {
+		if op.Kind == ' ' {
+			continue
+		}
+		lo, hi := i-context, i+context+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(ops) {
+			hi = len(ops)
+		}
+		if start != -1 && lo <= end {
+			end = hi
+			continue
+		}
+		if start != -1 {
+			hunks = append(hunks, ops[start:end])
+		}
+		start, end = lo, hi
+	}
+	if start != -1 {
+		hunks = append(hunks, ops[start:end])
+	}
+	return hunks
+}
+
+// HunkHeader returns the @@ -a,n +b,m @@ line for a hunk
+func HunkHeader(hunk []Op) string {
+	aStart, bStart, aCount, bCount := 0, 0, 0, 0
+	for _, op := range hunk {
+		if op.ALine > 0 {
+			if aStart == 0 {
+				aStart = op.ALine
+			}
+			aCount++
+		}
+		if op.BLine > 0 {
+			if bStart == 0 {
+				bStart = op.BLine
+			}
+			bCount++
+		}
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", aStart, aCount, bStart, bCount)
+}
+
+// SplitLines splits text into lines, without a trailing empty one
+func SplitLines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,49 @@
+package patch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	a := []string{"one", "two", "three", "four"}
+	b := []string{"one", "2", "three", "four", "five"}
+
+	var got []string
+	for _, op := range Lines(a, b) {
+		got = append(got, string(op.Kind)+op.Text)
+	}
+	want := []string{" one", "-two", "+2", " three", " four", "+five"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Lines() = %v, want %v", got, want)
+	}
+}
+
+func TestHunks(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20; i++ {
+		line := string(rune('a' + i))
+		a = append(a, line)
+		b = append(b, line)
+	}
+	b[2] = "changed"
+	b[15] = "changed too"
+
+	hunks := Hunks(Lines(a, b), 3)
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %d", len(hunks))
+	}
+	if header := HunkHeader(hunks[0]); header != "@@ -1,6 +1,6 @@" {
+		t.Errorf("first hunk header = %q", header)
+	}
+	if header := HunkHeader(hunks[1]); header != "@@ -13,7 +13,7 @@" {
+		t.Errorf("second hunk header = %q", header)
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	lines := []string{"same", "text"}
+	if hunks := Hunks(Lines(lines, lines), 3); len(hunks) != 0 {
+		t.Errorf("expected no hunks for identical input, got %d", len(hunks))
+	}
+}
@@ -0,0 +1,191 @@
+// Package patch finds file edits in a model's answer, as unified diffs or
+// search/replace blocks, and applies them.
+package patch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Change replaces Old lines with New ones. Line, if known, is where Old
+// starts in the file (1-based), a hint for finding it.
+type Change struct {
+	Old, New []string
+	Line     int
+}
+
+// FileEdit is every change to one file
+type FileEdit struct {
+	Path    string
+	Changes []Change
+	// Create is set for new files, Delete for ones to remove
+	Create, Delete bool
+}
+
+var (
+	hunkLine     = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+	searchMarker = regexp.MustCompile(`^<{5,9} ?SEARCH\s*$`)
+	dividerLine  = regexp.MustCompile(`^={5,9}\s*$`)
+	replaceMark  = regexp.MustCompile(`^>{5,9} ?REPLACE\s*$`)
+)
+
+// Parse finds the edits in text, in the order they appear. Edits to the same
+// file are merged.
+func Parse(text string) ([]FileEdit, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var edits []FileEdit
+	add := func(edit FileEdit) {
+		for i := range edits {
+			if edits[i].Path == edit.Path {
+				edits[i].Changes = append(edits[i].Changes, edit.Changes...)
+				edits[i].Delete = edits[i].Delete || edit.Delete
+				return
+			}
+		}
+		edits = append(edits, edit)
+	}
+
+	for i := 0; i < len(lines); i++ {
+		switch {
+		case strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			edit, next, err := parseDiff(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			add(edit)
+			i = next - 1
+		case searchMarker.MatchString(lines[i]):
+			path := blockPath(lines, i)
+			if path == "" {
+				return nil, fmt.Errorf("line %d: a SEARCH block without a file name before it", i+1)
+			}
+			change, next, err := parseBlock(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			add(FileEdit{Path: path, Changes: []Change{change}, Create: len(change.Old) == 0})
+			i = next - 1
+		}
+	}
+	return edits, nil
+}
+
+// parseDiff parses the unified diff of one file starting at lines[start],
+// returning the line after it
+func parseDiff(lines []string, start int) (FileEdit, int, error) {
+	from, to := diffPath(lines[start][4:]), diffPath(lines[start+1][4:])
+	edit := FileEdit{Path: to, Create: from == "/dev/null", Delete: to == "/dev/null"}
+	if edit.Delete {
+		edit.Path = from
+	}
+	if edit.Path == "" || edit.Path == "/dev/null" {
+		return edit, 0, fmt.Errorf("line %d: a diff without a file name", start+1)
+	}
+
+	i := start + 2
+	for i < len(lines) {
+		m := hunkLine.FindStringSubmatch(lines[i])
+		if m == nil {
+			break
+		}
+		line, _ := strconv.Atoi(m[1])
+		change := Change{Line: line}
+		// Counts in the header are often wrong in generated diffs, so a hunk
+		// runs until a line that can't be part of it
+	hunk:
+		for i++; i < len(lines); i++ {
+			l := lines[i]
+			if strings.HasPrefix(l, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+				break hunk
+			}
+			if l == "" {
+				// A blank context line that lost its leading space
+				change.Old = append(change.Old, "")
+				change.New = append(change.New, "")
+				continue
+			}
+			switch l[0] {
+			case ' ':
+				change.Old = append(change.Old, l[1:])
+				change.New = append(change.New, l[1:])
+				continue
+			case '-':
+				change.Old = append(change.Old, l[1:])
+				continue
+			case '+':
+				change.New = append(change.New, l[1:])
+				continue
+			case '\\':
+				// "\ No newline at end of file"
+				continue
+			}
+			break hunk
+		}
+		change.Old, change.New = trimBlankContext(change.Old, change.New)
+		edit.Changes = append(edit.Changes, change)
+	}
+	if len(edit.Changes) == 0 && !edit.Delete {
+		return edit, 0, fmt.Errorf("line %d: a diff of %s without any hunks", start+1, edit.Path)
+	}
+	return edit, i, nil
+}
+
+// trimBlankContext drops blank lines both sides end with, which are usually
+// the gap before the code fence or the next diff rather than the file's
+func trimBlankContext(old, new []string) ([]string, []string) {
+	for len(old) > 0 && len(new) > 0 && old[len(old)-1] == "" && new[len(new)-1] == "" {
+		old, new = old[:len(old)-1], new[:len(new)-1]
+	}
+	return old, new
+}
+
+// diffPath cleans up the path of a ---/+++ line: no timestamp, and no a/ or b/
+func diffPath(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+// blockPath finds the file a SEARCH block at lines[marker] edits: the
+// closest line before it that isn't blank or a code fence
+func blockPath(lines []string, marker int) string {
+	for i := marker - 1; i >= 0 && i >= marker-3; i-- {
+		l := strings.TrimSpace(lines[i])
+		if l == "" || strings.HasPrefix(l, "```") {
+			continue
+		}
+		l = strings.Trim(l, "`*: ")
+		if strings.ContainsAny(l, " \t") {
+			return ""
+		}
+		return l
+	}
+	return ""
+}
+
+// parseBlock parses the search/replace block starting at lines[start],
+// returning the line after it
+func parseBlock(lines []string, start int) (Change, int, error) {
+	var change Change
+	i := start + 1
+	for ; i < len(lines) && !dividerLine.MatchString(lines[i]); i++ {
+		change.Old = append(change.Old, lines[i])
+	}
+	if i == len(lines) {
+		return change, 0, fmt.Errorf("line %d: a SEARCH block without =======", start+1)
+	}
+	for i++; i < len(lines) && !replaceMark.MatchString(lines[i]); i++ {
+		change.New = append(change.New, lines[i])
+	}
+	if i == len(lines) {
+		return change, 0, fmt.Errorf("line %d: a SEARCH block without >>>>>>> REPLACE", start+1)
+	}
+	return change, i + 1, nil
+}
@@ -0,0 +1,120 @@
+package patch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const original = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+`
+
+func TestParseAndApplyDiff(t *testing.T) {
+	answer := "Here's the change:\n\n```diff\n" + `--- a/main.go
++++ b/main.go
+@@ -5,3 +5,4 @@ import "fmt"
+ func main() {
+-	fmt.Println("hello")
++	fmt.Println("hello, world")
++	fmt.Println("bye")
+ }
+` + "```\n"
+	edits, err := Parse(answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) != 1 || edits[0].Path != "main.go" || len(edits[0].Changes) != 1 {
+		t.Fatalf("unexpected edits %+v", edits)
+	}
+	result, err := edits[0].Apply(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(original, "\tfmt.Println(\"hello\")\n", "\tfmt.Println(\"hello, world\")\n\tfmt.Println(\"bye\")\n", 1)
+	if result.After != want {
+		t.Errorf("After = %q, want %q", result.After, want)
+	}
+	if len(result.Hunks) != 1 || HunkHeader(result.Hunks[0]) != "@@ -5,3 +5,4 @@" {
+		t.Errorf("unexpected hunks %v", result.Hunks)
+	}
+}
+
+func TestParseAndApplyBlocks(t *testing.T) {
+	answer := "main.go\n```go\n<<<<<<< SEARCH\n\tfmt.Println(\"hello\")  \n=======\n\tfmt.Println(\"hi\")\n>>>>>>> REPLACE\n```\n\n" +
+		"`notes.txt`\n```\n<<<<<<< SEARCH\n=======\nremember the milk\n>>>>>>> REPLACE\n```\n"
+	edits, err := Parse(answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) != 2 || edits[0].Path != "main.go" || edits[1].Path != "notes.txt" || !edits[1].Create {
+		t.Fatalf("unexpected edits %+v", edits)
+	}
+	// The search has trailing spaces the file doesn't
+	result, err := edits[0].Apply(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.After, "fmt.Println(\"hi\")") || strings.Contains(result.After, "hello") {
+		t.Errorf("unexpected After %q", result.After)
+	}
+	result, err = edits[1].Apply("")
+	if err != nil || result.After != "remember the milk\n" {
+		t.Errorf("new file = %q, %v", result.After, err)
+	}
+	if _, err := edits[1].Apply("already here\n"); err == nil {
+		t.Error("creating a file that exists should fail")
+	}
+}
+
+func TestApplyMissing(t *testing.T) {
+	edit := FileEdit{Path: "main.go", Changes: []Change{{Old: []string{"not in the file"}, New: []string{"x"}}}}
+	if _, err := edit.Apply(original); err == nil {
+		t.Error("a change whose lines aren't there should fail")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backups := filepath.Join(dir, "backups")
+	results := []*Result{
+		{Edit: FileEdit{Path: path}, Before: original, After: "changed\n"},
+		{Edit: FileEdit{Path: filepath.Join(dir, "sub", "new.txt"), Create: true}, After: "new\n"},
+	}
+	if err := Write(results, backups); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	info, _ := os.Stat(path)
+	if string(data) != "changed\n" || info.Mode().Perm() != 0600 {
+		t.Errorf("main.go is %q with mode %v", data, info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "sub", "new.txt")); string(data) != "new\n" {
+		t.Errorf("new.txt is %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(backups, path)); string(data) != original {
+		t.Errorf("backup is %q", data)
+	}
+
+	// A failure part way leaves every file as it was
+	results = []*Result{
+		{Edit: FileEdit{Path: path}, Before: "changed\n", After: "changed again\n"},
+		{Edit: FileEdit{Path: filepath.Join(dir, "missing.txt"), Delete: true}},
+	}
+	if err := Write(results, backups); err == nil {
+		t.Fatal("deleting a missing file should fail")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "changed\n" {
+		t.Errorf("main.go should be restored, is %q", data)
+	}
+}
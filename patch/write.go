@@ -0,0 +1,103 @@
+package patch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Write puts results on disk, all of them or none. Each file is first backed
+// up under backupDir, at its absolute path; the new contents are then written
+// to temporary files beside the originals and renamed over them. If anything
+// fails, the files already changed are put back.
+func Write(results []*Result, backupDir string) error {
+	modes := make([]os.FileMode, len(results))
+	existed := make([]bool, len(results))
+	for i, result := range results {
+		modes[i] = 0644
+		info, err := os.Stat(result.Edit.Path)
+		switch {
+		case err == nil:
+			modes[i], existed[i] = info.Mode().Perm(), true
+			if err := backup(result.Edit.Path, result.Before, modes[i], backupDir); err != nil {
+				return fmt.Errorf("failed to back up %s: %w", result.Edit.Path, err)
+			}
+		case !os.IsNotExist(err):
+			return err
+		}
+	}
+
+	temps := make([]string, len(results))
+	defer func() {
+		for _, temp := range temps {
+			if temp != "" {
+				os.Remove(temp)
+			}
+		}
+	}()
+	for i, result := range results {
+		if result.Edit.Delete {
+			continue
+		}
+		dir := filepath.Dir(result.Edit.Path)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		temp, err := os.CreateTemp(dir, "."+filepath.Base(result.Edit.Path)+".q-*")
+		if err != nil {
+			return err
+		}
+		temps[i] = temp.Name()
+		_, err = temp.WriteString(result.After)
+		if closeErr := temp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(temp.Name(), modes[i])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", result.Edit.Path, err)
+		}
+	}
+
+	for i, result := range results {
+		var err error
+		if result.Edit.Delete {
+			err = os.Remove(result.Edit.Path)
+		} else if err = os.Rename(temps[i], result.Edit.Path); err == nil {
+			temps[i] = ""
+		}
+		if err != nil {
+			restore(results[:i], modes, existed)
+			return fmt.Errorf("failed to update %s, so no files were changed: %w", result.Edit.Path, err)
+		}
+	}
+	return nil
+}
+
+// backup copies a file's content to the same path under dir
+func backup(path, content string, mode os.FileMode, dir string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	// Drop a Windows volume name, which can't be part of a path
+	abs = strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	target := filepath.Join(dir, abs)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, []byte(content), mode)
+}
+
+// restore puts back files Write already changed
+func restore(results []*Result, modes []os.FileMode, existed []bool) {
+	for i, result := range results {
+		if !existed[i] {
+			os.Remove(result.Edit.Path)
+			continue
+		}
+		os.WriteFile(result.Edit.Path, []byte(result.Before), modes[i])
+	}
+}
@@ -0,0 +1,233 @@
+package personas
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"q/config"
+	"q/theme"
+	. "q/types"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	promptFlag      string
+	descriptionFlag string
+	lengthFlag      string
+)
+
+// PersonasCmd is the root command for managing personas
+var PersonasCmd = &cobra.Command{
+	Use:   "personas",
+	Short: "List and manage personas (named system prompts)",
+	Long:  "Personas are named system prompts stored in ~/.shell-ai/config.yaml. Use one with `q as <persona> <request>`.",
+	Run:   runListCommand,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available personas",
+	Args:  cobra.NoArgs,
+	Run:   runListCommand,
+}
+
+var addCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a persona (prompt from --prompt, stdin, or your $EDITOR)",
+	Args:  cobra.ExactArgs(1),
+	Run:   runAddCommand,
+}
+
+var editCmd = &cobra.Command{
+	Use:   "edit <name>",
+	Short: "Edit a persona's prompt in your $EDITOR",
+	Args:  cobra.ExactArgs(1),
+	Run:   runEditCommand,
+}
+
+var removeCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a persona",
+	Args:  cobra.ExactArgs(1),
+	Run:   runRemoveCommand,
+}
+
+func init() {
+	addCmd.Flags().StringVar(&promptFlag, "prompt", "", "System prompt for the persona")
+	addCmd.Flags().StringVar(&descriptionFlag, "description", "", "Short description shown in q personas list")
+	addCmd.Flags().StringVar(&lengthFlag, "length", "", "Default answer length with this persona: short or detailed")
+	editCmd.Flags().StringVar(&descriptionFlag, "description", "", "Replace the persona's description")
+	editCmd.Flags().StringVar(&lengthFlag, "length", "", "Replace the persona's default answer length: short, detailed, or none")
+	PersonasCmd.AddCommand(listCmd, addCmd, editCmd, removeCmd)
+}
+
+func loadConfig() config.AppConfig {
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		config.PrintConfigErrorMessage(err)
+		os.Exit(1)
+	}
+	return appConfig
+}
+
+func saveConfig(appConfig config.AppConfig) {
+	if err := config.SaveAppConfig(appConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving config: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runListCommand(cmd *cobra.Command, args []string) {
+	appConfig := loadConfig()
+	if len(appConfig.Personas) == 0 {
+		fmt.Println("No personas defined. Add one with `q personas add <name>`.")
+		return
+	}
+
+	nameStyle := lipgloss.NewStyle().Bold(true).Foreground(theme.Accent())
+	dimStyle := lipgloss.NewStyle().Foreground(theme.Muted())
+	for _, persona := range appConfig.Personas {
+		fmt.Print(nameStyle.Render(persona.Name))
+		if persona.Description != "" {
+			fmt.Print(dimStyle.Render("  " + persona.Description))
+		}
+		fmt.Println()
+	}
+}
+
+func runAddCommand(cmd *cobra.Command, args []string) {
+	name := args[0]
+	appConfig := loadConfig()
+	if _, err := config.FindPersona(appConfig, name); err == nil {
+		fmt.Fprintf(os.Stderr, "Persona %q already exists. Use `q personas edit %s` to change it.\n", name, name)
+		os.Exit(1)
+	}
+
+	prompt := promptFlag
+	if prompt == "" {
+		var err error
+		prompt, err = readPrompt("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading prompt: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if strings.TrimSpace(prompt) == "" {
+		fmt.Fprintln(os.Stderr, "Persona prompt is empty, nothing saved.")
+		os.Exit(1)
+	}
+
+	appConfig.Personas = append(appConfig.Personas, Persona{
+		Name:        name,
+		Description: descriptionFlag,
+		Prompt:      strings.TrimSpace(prompt),
+		Length:      checkLength(lengthFlag),
+	})
+	saveConfig(appConfig)
+	fmt.Printf("Added persona %s. Try: q as %s <request>\n", name, name)
+}
+
+// checkLength exits unless length is empty or one of the answer lengths
+func checkLength(length string) string {
+	if length != "" && length != "short" && length != "detailed" {
+		fmt.Fprintf(os.Stderr, "Unknown length %q: use short or detailed.\n", length)
+		os.Exit(1)
+	}
+	return length
+}
+
+func runEditCommand(cmd *cobra.Command, args []string) {
+	name := args[0]
+	appConfig := loadConfig()
+	index := -1
+	for i, persona := range appConfig.Personas {
+		if persona.Name == name {
+			index = i
+		}
+	}
+	if index == -1 {
+		fmt.Fprintf(os.Stderr, "Persona %q not found (see `q personas list`).\n", name)
+		os.Exit(1)
+	}
+
+	persona := appConfig.Personas[index]
+	prompt, err := editInEditor(persona.Prompt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error editing prompt: %v\n", err)
+		os.Exit(1)
+	}
+	if strings.TrimSpace(prompt) == "" {
+		fmt.Fprintln(os.Stderr, "Persona prompt is empty, nothing saved.")
+		os.Exit(1)
+	}
+	persona.Prompt = strings.TrimSpace(prompt)
+	if descriptionFlag != "" {
+		persona.Description = descriptionFlag
+	}
+	if lengthFlag == "none" {
+		persona.Length = ""
+	} else if lengthFlag != "" {
+		persona.Length = checkLength(lengthFlag)
+	}
+	appConfig.Personas[index] = persona
+	saveConfig(appConfig)
+	fmt.Printf("Updated persona %s.\n", name)
+}
+
+func runRemoveCommand(cmd *cobra.Command, args []string) {
+	name := args[0]
+	appConfig := loadConfig()
+	var kept []Persona
+	for _, persona := range appConfig.Personas {
+		if persona.Name != name {
+			kept = append(kept, persona)
+		}
+	}
+	if len(kept) == len(appConfig.Personas) {
+		fmt.Fprintf(os.Stderr, "Persona %q not found (see `q personas list`).\n", name)
+		os.Exit(1)
+	}
+	appConfig.Personas = kept
+	saveConfig(appConfig)
+	fmt.Printf("Removed persona %s.\n", name)
+}
+
+// readPrompt reads a prompt from piped stdin, or from the editor when interactive
+func readPrompt(initial string) (string, error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
+		data, err := io.ReadAll(bufio.NewReader(os.Stdin))
+		return string(data), err
+	}
+	return editInEditor(initial)
+}
+
+func editInEditor(initial string) (string, error) {
+	f, err := os.CreateTemp("", "shell-ai-persona-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(initial); err != nil {
+		f.Close()
+		return "", err
+	}
+	f.Close()
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vim"
+	}
+	c := exec.Command(editor, f.Name()) //nolint:gosec
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(f.Name())
+	return string(data), err
+}
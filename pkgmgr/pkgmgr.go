@@ -0,0 +1,84 @@
+// Package pkgmgr finds the package manager software is installed with on
+// the user's system, so answers to "how do I install ripgrep" use the right
+// one
+package pkgmgr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Manager is a package manager and how to install a package with it
+type Manager struct {
+	Name string
+	// Binary is the executable its presence is detected by
+	Binary string
+	// Install is the command that installs a package, named <package>
+	Install string
+}
+
+// managers are the package managers known, by name
+var managers = map[string]Manager{
+	"brew":    {Name: "Homebrew", Binary: "brew", Install: "brew install <package>"},
+	"port":    {Name: "MacPorts", Binary: "port", Install: "sudo port install <package>"},
+	"apt":     {Name: "apt", Binary: "apt-get", Install: "sudo apt install <package>"},
+	"dnf":     {Name: "dnf", Binary: "dnf", Install: "sudo dnf install <package>"},
+	"yum":     {Name: "yum", Binary: "yum", Install: "sudo yum install <package>"},
+	"pacman":  {Name: "pacman", Binary: "pacman", Install: "sudo pacman -S <package>"},
+	"zypper":  {Name: "zypper", Binary: "zypper", Install: "sudo zypper install <package>"},
+	"apk":     {Name: "apk", Binary: "apk", Install: "sudo apk add <package>"},
+	"nix":     {Name: "Nix", Binary: "nix-env", Install: "nix-env -iA nixpkgs.<package>"},
+	"winget":  {Name: "winget", Binary: "winget", Install: "winget install <package>"},
+	"scoop":   {Name: "Scoop", Binary: "scoop", Install: "scoop install <package>"},
+	"choco":   {Name: "Chocolatey", Binary: "choco", Install: "choco install <package>"},
+	"pkg":     {Name: "pkg", Binary: "pkg", Install: "sudo pkg install <package>"},
+	"emerge":  {Name: "Portage", Binary: "emerge", Install: "sudo emerge <package>"},
+	"xbps":    {Name: "XBPS", Binary: "xbps-install", Install: "sudo xbps-install <package>"},
+	"flatpak": {Name: "Flatpak", Binary: "flatpak", Install: "flatpak install <package>"},
+}
+
+// preference is the order package managers are looked for in on each
+// system. On Linux, the distribution's own comes before add-ons like Nix and
+// Homebrew, which are used alongside it.
+var preference = map[string][]string{
+	"darwin":  {"brew", "port", "nix"},
+	"linux":   {"apt", "dnf", "yum", "pacman", "zypper", "apk", "emerge", "xbps", "nix", "brew", "flatpak"},
+	"windows": {"winget", "scoop", "choco"},
+	"freebsd": {"pkg"},
+}
+
+// Lookup returns the package manager called name, as in --pm apt
+func Lookup(name string) (Manager, error) {
+	if m, ok := managers[strings.ToLower(name)]; ok {
+		return m, nil
+	}
+	return Manager{}, fmt.Errorf("unknown package manager %q: use one of %s", name, strings.Join(Names(), ", "))
+}
+
+// Names are the names of the known package managers, sorted
+func Names() []string {
+	var names []string
+	for name := range managers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Detect finds the package manager installed on the system goos names, with
+// lookPath reporting whether an executable is on the PATH
+func Detect(goos string, lookPath func(string) (string, error)) (Manager, bool) {
+	for _, name := range preference[goos] {
+		m := managers[name]
+		if _, err := lookPath(m.Binary); err == nil {
+			return m, true
+		}
+	}
+	return Manager{}, false
+}
+
+// Instruction tells the model to install software with m
+func (m Manager) Instruction() string {
+	return fmt.Sprintf("Install software with %s (%s) unless the user names another way.", m.Name, m.Install)
+}
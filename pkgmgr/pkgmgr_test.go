@@ -0,0 +1,53 @@
+package pkgmgr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	onPath := func(binaries ...string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			for _, b := range binaries {
+				if b == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", errors.New("not found")
+		}
+	}
+	tests := []struct {
+		goos     string
+		binaries []string
+		want     string
+	}{
+		{"darwin", []string{"brew", "nix-env"}, "Homebrew"},
+		{"darwin", []string{"port"}, "MacPorts"},
+		{"linux", []string{"brew", "apt-get"}, "apt"},
+		{"linux", []string{"nix-env", "pacman"}, "pacman"},
+		{"linux", []string{"nix-env"}, "Nix"},
+		{"windows", []string{"choco", "winget"}, "winget"},
+		{"linux", nil, ""},
+		{"plan9", []string{"apt-get"}, ""},
+	}
+	for _, tt := range tests {
+		m, ok := Detect(tt.goos, onPath(tt.binaries...))
+		if m.Name != tt.want || ok != (tt.want != "") {
+			t.Errorf("Detect(%s, %v) = %q, %v; want %q", tt.goos, tt.binaries, m.Name, ok, tt.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	m, err := Lookup("APT")
+	if err != nil || m.Name != "apt" {
+		t.Fatalf("Lookup(APT) = %+v, %v", m, err)
+	}
+	if !strings.Contains(m.Instruction(), "sudo apt install <package>") {
+		t.Errorf("Instruction = %q", m.Instruction())
+	}
+	if _, err := Lookup("cargo"); err == nil || !strings.Contains(err.Error(), "winget") {
+		t.Errorf("Lookup(cargo) should fail listing the known ones, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	. "q/types"
+)
+
+// Capabilities of well-known models
+var capabilities = map[string]ModelCapabilities{
+	"gpt-4.1":       {ContextWindow: 1047576, Vision: true, Tools: true, JSONMode: true, Streaming: true, Samples: true},
+	"gpt-4.1-mini":  {ContextWindow: 1047576, Vision: true, Tools: true, JSONMode: true, Streaming: true, Samples: true},
+	"gpt-4o":        {ContextWindow: 128000, Vision: true, Tools: true, JSONMode: true, Streaming: true, Samples: true},
+	"gpt-4o-mini":   {ContextWindow: 128000, Vision: true, Tools: true, JSONMode: true, Streaming: true, Samples: true},
+	"gpt-4-turbo":   {ContextWindow: 128000, Vision: true, Tools: true, JSONMode: true, Streaming: true, Samples: true},
+	"gpt-4":         {ContextWindow: 8192, Tools: true, Streaming: true, Samples: true},
+	"gpt-3.5-turbo": {ContextWindow: 16385, Tools: true, JSONMode: true, Streaming: true, Samples: true},
+	"o1":            {ContextWindow: 200000, Vision: true, Tools: true, JSONMode: true, Streaming: true},
+	"o1-mini":       {ContextWindow: 128000, Streaming: true},
+	"o3-mini":       {ContextWindow: 200000, Tools: true, JSONMode: true, Streaming: true},
+
+	"claude-sonnet-4-0":        {ContextWindow: 200000, Vision: true, Tools: true, Streaming: true},
+	"claude-3-7-sonnet-latest": {ContextWindow: 200000, Vision: true, Tools: true, Streaming: true},
+	"claude-3-5-haiku-latest":  {ContextWindow: 200000, Vision: true, Tools: true, Streaming: true},
+
+	"mistral-large-latest": {ContextWindow: 128000, Tools: true, JSONMode: true, Streaming: true},
+	"mistral-small-latest": {ContextWindow: 32000, Vision: true, Tools: true, JSONMode: true, Streaming: true},
+	"codestral-latest":     {ContextWindow: 256000, Tools: true, JSONMode: true, Streaming: true},
+	"open-mistral-nemo":    {ContextWindow: 128000, Tools: true, JSONMode: true, Streaming: true},
+	"ministral-8b-latest":  {ContextWindow: 128000, Tools: true, JSONMode: true, Streaming: true},
+
+	"llama-3.3-70b-versatile": {ContextWindow: 128000, Tools: true, JSONMode: true, Streaming: true},
+	"llama-3.1-8b-instant":    {ContextWindow: 128000, Tools: true, JSONMode: true, Streaming: true},
+	"mixtral-8x7b-32768":      {ContextWindow: 32768, Tools: true, JSONMode: true, Streaming: true},
+	"gemma2-9b-it":            {ContextWindow: 8192, Tools: true, JSONMode: true, Streaming: true},
+
+	"deepseek-chat":     {ContextWindow: 64000, Tools: true, JSONMode: true, Streaming: true},
+	"deepseek-reasoner": {ContextWindow: 64000, Streaming: true},
+
+	"grok-2-latest": {ContextWindow: 131072, Tools: true, JSONMode: true, Streaming: true},
+	"grok-beta":     {ContextWindow: 131072, Tools: true, Streaming: true},
+	"grok-3":        {ContextWindow: 131072, Tools: true, JSONMode: true, Streaming: true},
+	"grok-3-mini":   {ContextWindow: 131072, Tools: true, JSONMode: true, Streaming: true},
+}
+
+// CapabilitiesFor returns what a model supports: the config's `capabilities`
+// if set, otherwise the built-in entry. known is false for models we know
+// nothing about, which are not validated.
+func CapabilitiesFor(config ModelConfig) (caps ModelCapabilities, known bool) {
+	if config.Capabilities != nil {
+		caps, known = *config.Capabilities, true
+	} else {
+		caps, known = capabilities[config.ModelName]
+	}
+	if config.ContextWindow > 0 {
+		caps.ContextWindow = config.ContextWindow
+	}
+	return caps, known
+}
+
+// ContextWindow returns the context window for a model, preferring the
+// configured value and falling back to the built-in table (0 if unknown)
+func ContextWindow(config ModelConfig) int {
+	caps, _ := CapabilitiesFor(config)
+	return caps.ContextWindow
+}
+
+// Check fails with a helpful message if a known model lacks a capability the
+// request needs, so it fails fast instead of with a cryptic 400 from the API
+func Check(config ModelConfig, need ModelCapabilities) error {
+	caps, known := CapabilitiesFor(config)
+	if !known {
+		return nil
+	}
+	var missing []string
+	if need.Vision && !caps.Vision {
+		missing = append(missing, "images")
+	}
+	if need.Tools && !caps.Tools {
+		missing = append(missing, "tool calls")
+	}
+	if need.JSONMode && !caps.JSONMode {
+		missing = append(missing, "JSON mode")
+	}
+	if need.Streaming && !caps.Streaming {
+		missing = append(missing, "streaming")
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("model %s doesn't support %s; pick another model with `q config`, or set `capabilities` for it in ~/.shell-ai/config.yaml if this is wrong",
+		config.ModelName, strings.Join(missing, " or "))
+}
+
+// nonChatModels matches the IDs of models in a provider's /models list that
+// don't answer chat requests: embeddings, speech, images, moderation and the
+// legacy completion models
+var nonChatModels = regexp.MustCompile(`(?i)embed|whisper|tts|transcri|dall-e|image|moderation|davinci|babbage|audio|realtime|rerank|guard`)
+
+// IsChatModel guesses from its ID whether a model answers chat requests, to
+// keep the rest out of `q models discover`
+func IsChatModel(id string) bool {
+	return !nonChatModels.MatchString(id)
+}
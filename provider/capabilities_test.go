@@ -0,0 +1,30 @@
+package provider
+
+import "testing"
+
+func TestIsChatModel(t *testing.T) {
+	tests := map[string]bool{
+		"gpt-4.1":                      true,
+		"gpt-4o-mini":                  true,
+		"claude-sonnet-4-0":            true,
+		"llama-3.3-70b-versatile":      true,
+		"deepseek-reasoner":            true,
+		"text-embedding-3-small":       false,
+		"mistral-embed":                false,
+		"whisper-large-v3":             false,
+		"tts-1-hd":                     false,
+		"gpt-4o-mini-transcribe":       false,
+		"dall-e-3":                     false,
+		"gpt-image-1":                  false,
+		"omni-moderation-latest":       false,
+		"davinci-002":                  false,
+		"gpt-4o-realtime-preview":      false,
+		"gpt-4o-audio-preview":         false,
+		"meta-llama/llama-guard-4-12b": false,
+	}
+	for id, want := range tests {
+		if got := IsChatModel(id); got != want {
+			t.Errorf("IsChatModel(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"strings"
+
+	. "q/types"
+)
+
+// Ways of sending system messages (MessageRules.System)
+const (
+	SystemMessage = "message"
+	SystemFirst   = "first"
+	SystemField   = "field"
+	SystemUser    = "user"
+)
+
+// conversationStart opens a conversation that would otherwise start with the
+// assistant, for APIs that require a user message first
+const conversationStart = "(Continuing our conversation.)"
+
+// Normalize adapts messages to an API's role conventions, so a conversation
+// can be sent to any provider as it was recorded. With SystemField the system
+// messages are returned separately, for the request's top-level field. The
+// messages passed in are not modified.
+func Normalize(rules MessageRules, messages []Message) (system string, normalized []Message) {
+	var systemParts []string
+	for _, msg := range messages {
+		if msg.Role == "system" && rules.System != "" && rules.System != SystemMessage {
+			systemParts = append(systemParts, msg.Content)
+			continue
+		}
+		normalized = append(normalized, msg)
+	}
+
+	// A trailing assistant message asks the model to start its answer with it
+	if n := len(normalized); !rules.Prefill && n > 0 && normalized[n-1].Role == "assistant" {
+		prefill := normalized[n-1].Content
+		normalized = normalized[:n-1]
+		normalized = appendToLastUser(normalized, "Begin your answer with exactly this text:\n\n"+prefill)
+	}
+
+	if rules.Alternate {
+		normalized = alternate(normalized)
+	}
+
+	system = strings.Join(systemParts, "\n\n")
+	switch {
+	case system == "":
+	case rules.System == SystemFirst:
+		normalized = append([]Message{{Role: "system", Content: system}}, normalized...)
+		system = ""
+	case rules.System == SystemUser:
+		normalized = prependToFirstUser(normalized, system)
+		system = ""
+	}
+	return system, normalized
+}
+
+// alternate merges consecutive messages with the same role, except tool
+// results, which each answer their own call, and makes sure the first
+// message after any system messages is the user's
+func alternate(messages []Message) []Message {
+	var merged []Message
+	for _, msg := range messages {
+		if n := len(merged); n > 0 && merged[n-1].Role == msg.Role && msg.Role != "tool" {
+			merged[n-1].Content += "\n\n" + msg.Content
+			continue
+		}
+		if msg.Role == "assistant" && (len(merged) == 0 || merged[len(merged)-1].Role == "system") {
+			merged = append(merged, Message{Role: "user", Content: conversationStart})
+		}
+		merged = append(merged, msg)
+	}
+	return merged
+}
+
+// appendToLastUser adds text to the last user message, or as a new one if there's none
+func appendToLastUser(messages []Message, text string) []Message {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			messages[i].Content += "\n\n" + text
+			return messages
+		}
+	}
+	return append(messages, Message{Role: "user", Content: text})
+}
+
+// prependToFirstUser puts text before the first user message, or in a new one if there's none
+func prependToFirstUser(messages []Message, text string) []Message {
+	for i := range messages {
+		if messages[i].Role == "user" {
+			messages[i].Content = text + "\n\n" + messages[i].Content
+			return messages
+		}
+	}
+	return append([]Message{{Role: "user", Content: text}}, messages...)
+}
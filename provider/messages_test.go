@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	. "q/types"
+)
+
+func TestNormalize(t *testing.T) {
+	sys := func(s string) Message { return Message{Role: "system", Content: s} }
+	user := func(s string) Message { return Message{Role: "user", Content: s} }
+	asst := func(s string) Message { return Message{Role: "assistant", Content: s} }
+	conversation := []Message{sys("Be brief."), sys("Page: ..."), user("hi"), user("list files"), asst("ls")}
+
+	tests := []struct {
+		name       string
+		rules      MessageRules
+		messages   []Message
+		wantSystem string
+		want       []Message
+	}{
+		{
+			name:     "no rules keeps everything but a prefill",
+			messages: []Message{sys("Be brief."), user("hi"), asst("ls")},
+			want:     []Message{sys("Be brief."), user("hi\n\nBegin your answer with exactly this text:\n\nls")},
+		},
+		{
+			name:     "first",
+			rules:    MessageRules{System: SystemFirst, Alternate: true, Prefill: true},
+			messages: conversation,
+			want:     []Message{sys("Be brief.\n\nPage: ..."), user("hi\n\nlist files"), asst("ls")},
+		},
+		{
+			name:       "field",
+			rules:      MessageRules{System: SystemField, Prefill: true},
+			messages:   conversation,
+			wantSystem: "Be brief.\n\nPage: ...",
+			want:       []Message{user("hi"), user("list files"), asst("ls")},
+		},
+		{
+			name:     "user",
+			rules:    MessageRules{System: SystemUser, Prefill: true},
+			messages: []Message{sys("Be brief."), user("hi")},
+			want:     []Message{user("Be brief.\n\nhi")},
+		},
+		{
+			name:     "alternate starts with the user",
+			rules:    MessageRules{System: SystemFirst, Alternate: true},
+			messages: []Message{sys("Summary."), asst("Earlier answer"), user("next")},
+			want:     []Message{sys("Summary."), user(conversationStart), asst("Earlier answer"), user("next")},
+		},
+	}
+	for _, tt := range tests {
+		original := append([]Message(nil), tt.messages...)
+		system, got := Normalize(tt.rules, tt.messages)
+		if system != tt.wantSystem || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Normalize() = %q, %q; want %q, %q", tt.name, system, got, tt.wantSystem, tt.want)
+		}
+		if !reflect.DeepEqual(tt.messages, original) {
+			t.Errorf("%s: Normalize() modified its input", tt.name)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	. "q/types"
+)
+
+// Auth header styles understood by the LLM client
+const (
+	AuthBearer = "bearer"
+	AuthAPIKey = "api-key"
+)
+
+// Preset describes an OpenAI-compatible provider so a model config only
+// needs `provider: <name>` instead of a full endpoint and auth setup
+type Preset struct {
+	Name       string
+	Endpoint   string
+	AuthEnvVar string
+	AuthHeader string
+	Pricing    map[string]ModelPricing
+	// Messages are the API's conventions for message roles
+	Messages MessageRules
+}
+
+// Provider presets and pricing as of January 2025 (per 1M tokens)
+var presets = map[string]Preset{
+	"openai": {
+		Name:       "openai",
+		Endpoint:   "https://api.openai.com/v1/chat/completions",
+		AuthEnvVar: "OPENAI_API_KEY",
+		AuthHeader: AuthBearer,
+	},
+	"azure": {
+		Name:       "azure",
+		AuthEnvVar: "AZURE_OPENAI_API_KEY",
+		AuthHeader: AuthAPIKey,
+	},
+	"anthropic": {
+		Name:       "anthropic",
+		Endpoint:   "https://api.anthropic.com/v1/chat/completions",
+		AuthEnvVar: "ANTHROPIC_API_KEY",
+		AuthHeader: AuthBearer,
+		Messages:   MessageRules{System: SystemFirst, Alternate: true, Prefill: true},
+		Pricing: map[string]ModelPricing{
+			"claude-sonnet-4-0":        {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+			"claude-3-7-sonnet-latest": {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+			"claude-3-5-haiku-latest":  {InputPerMillion: 0.80, OutputPerMillion: 4.00},
+		},
+	},
+	"mistral": {
+		Name:       "mistral",
+		Endpoint:   "https://api.mistral.ai/v1/chat/completions",
+		AuthEnvVar: "MISTRAL_API_KEY",
+		AuthHeader: AuthBearer,
+		Messages:   MessageRules{System: SystemFirst, Alternate: true},
+		Pricing: map[string]ModelPricing{
+			"mistral-large-latest": {InputPerMillion: 2.00, OutputPerMillion: 6.00},
+			"mistral-small-latest": {InputPerMillion: 0.20, OutputPerMillion: 0.60},
+			"codestral-latest":     {InputPerMillion: 0.30, OutputPerMillion: 0.90},
+			"open-mistral-nemo":    {InputPerMillion: 0.15, OutputPerMillion: 0.15},
+			"ministral-8b-latest":  {InputPerMillion: 0.10, OutputPerMillion: 0.10},
+		},
+	},
+	"groq": {
+		Name:       "groq",
+		Endpoint:   "https://api.groq.com/openai/v1/chat/completions",
+		AuthEnvVar: "GROQ_API_KEY",
+		AuthHeader: AuthBearer,
+		Pricing: map[string]ModelPricing{
+			"llama-3.3-70b-versatile": {InputPerMillion: 0.59, OutputPerMillion: 0.79},
+			"llama-3.1-8b-instant":    {InputPerMillion: 0.05, OutputPerMillion: 0.08},
+			"mixtral-8x7b-32768":      {InputPerMillion: 0.24, OutputPerMillion: 0.24},
+			"gemma2-9b-it":            {InputPerMillion: 0.20, OutputPerMillion: 0.20},
+		},
+	},
+	"deepseek": {
+		Name:       "deepseek",
+		Endpoint:   "https://api.deepseek.com/v1/chat/completions",
+		AuthEnvVar: "DEEPSEEK_API_KEY",
+		AuthHeader: AuthBearer,
+		Messages:   MessageRules{Alternate: true},
+		Pricing: map[string]ModelPricing{
+			"deepseek-chat":     {InputPerMillion: 0.27, OutputPerMillion: 1.10},
+			"deepseek-reasoner": {InputPerMillion: 0.55, OutputPerMillion: 2.19},
+		},
+	},
+	"xai": {
+		Name:       "xai",
+		Endpoint:   "https://api.x.ai/v1/chat/completions",
+		AuthEnvVar: "XAI_API_KEY",
+		AuthHeader: AuthBearer,
+		Pricing: map[string]ModelPricing{
+			"grok-2-latest": {InputPerMillion: 2.00, OutputPerMillion: 10.00},
+			"grok-beta":     {InputPerMillion: 5.00, OutputPerMillion: 15.00},
+			"grok-3":        {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+			"grok-3-mini":   {InputPerMillion: 0.30, OutputPerMillion: 0.50},
+		},
+	},
+}
+
+// Lookup returns the preset with the given name (case-insensitive)
+func Lookup(name string) (Preset, bool) {
+	preset, ok := presets[strings.ToLower(name)]
+	return preset, ok
+}
+
+// Names returns the names of all built-in presets, sorted
+func Names() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply fills any unset endpoint or auth fields of config from its provider preset.
+// Explicit values in the config always win.
+func Apply(config ModelConfig) (ModelConfig, error) {
+	if config.Provider == "" {
+		return config, nil
+	}
+	preset, ok := Lookup(config.Provider)
+	if !ok {
+		return config, fmt.Errorf("unknown provider %q for model %s (available: %s)",
+			config.Provider, config.ModelName, strings.Join(Names(), ", "))
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = preset.Endpoint
+	}
+	if config.Auth == "" {
+		config.Auth = preset.AuthEnvVar
+	}
+	if config.AuthHeader == "" {
+		config.AuthHeader = preset.AuthHeader
+	}
+	if config.Messages == nil {
+		rules := preset.Messages
+		config.Messages = &rules
+	}
+	if config.Endpoint == "" {
+		return config, fmt.Errorf("provider %s requires an endpoint for model %s", preset.Name, config.ModelName)
+	}
+	return config, nil
+}
+
+// Pricing looks up a model's price across all provider presets
+func Pricing(model string) (ModelPricing, bool) {
+	for _, preset := range presets {
+		if pricing, ok := preset.Pricing[model]; ok {
+			return pricing, true
+		}
+	}
+	return ModelPricing{}, false
+}
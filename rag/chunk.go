@@ -0,0 +1,56 @@
+package rag
+
+import (
+	"strings"
+)
+
+const (
+	defaultChunkLines   = 40
+	defaultChunkOverlap = 8
+)
+
+// Chunk is a contiguous range of lines from a single file
+type Chunk struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	Content   string
+}
+
+// ChunkText splits text into overlapping windows of maxLines lines.
+// Line numbers are 1-based and inclusive.
+func ChunkText(path, text string, maxLines, overlap int) []Chunk {
+	if maxLines <= 0 {
+		maxLines = defaultChunkLines
+	}
+	if overlap < 0 || overlap >= maxLines {
+		overlap = 0
+	}
+
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) == 1 && strings.TrimSpace(lines[0]) == "" {
+		return nil
+	}
+
+	var chunks []Chunk
+	step := maxLines - overlap
+	for start := 0; start < len(lines); start += step {
+		end := start + maxLines
+		if end > len(lines) {
+			end = len(lines)
+		}
+		content := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(content) != "" {
+			chunks = append(chunks, Chunk{
+				Path:      path,
+				StartLine: start + 1,
+				EndLine:   end,
+				Content:   content,
+			})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
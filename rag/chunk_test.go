@@ -0,0 +1,60 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunkText(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 25; i++ {
+		lines = append(lines, "line")
+	}
+	text := strings.Join(lines, "\n")
+
+	chunks := ChunkText("a.txt", text, 10, 2)
+	expected := [][2]int{{1, 10}, {9, 18}, {17, 25}}
+	if len(chunks) != len(expected) {
+		t.Fatalf("got %d chunks, want %d", len(chunks), len(expected))
+	}
+	for i, chunk := range chunks {
+		if chunk.StartLine != expected[i][0] || chunk.EndLine != expected[i][1] {
+			t.Errorf("chunk %d: got lines %d-%d, want %d-%d",
+				i, chunk.StartLine, chunk.EndLine, expected[i][0], expected[i][1])
+		}
+	}
+}
+
+func TestChunkTextEmpty(t *testing.T) {
+	if chunks := ChunkText("a.txt", "\n\n", 10, 2); len(chunks) != 0 {
+		t.Errorf("expected no chunks for blank text, got %d", len(chunks))
+	}
+}
+
+func TestEmbeddingsEndpoint(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"https://api.openai.com/v1/chat/completions", "https://api.openai.com/v1/embeddings"},
+		{"http://127.0.0.1:8080/v1/chat/completions", "http://127.0.0.1:8080/v1/embeddings"},
+		{
+			"https://x.openai.azure.com/openai/deployments/d/chat/completions?api-version=2024-02-01",
+			"https://x.openai.azure.com/openai/deployments/d/embeddings?api-version=2024-02-01",
+		},
+	}
+	for _, tt := range tests {
+		if got := EmbeddingsEndpoint(tt.in); got != tt.want {
+			t.Errorf("EmbeddingsEndpoint(%s) = %s; want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	a := []float32{1, 0}
+	if got := cosineSimilarity(a, decodeVector(encodeVector(a))); got != 1 {
+		t.Errorf("identical vectors: got %f, want 1", got)
+	}
+	if got := cosineSimilarity(a, []float32{0, 1}); got != 0 {
+		t.Errorf("orthogonal vectors: got %f, want 0", got)
+	}
+}
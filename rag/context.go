@@ -0,0 +1,75 @@
+package rag
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "q/types"
+)
+
+// citationPattern matches bracketed source numbers like [2] or [1, 3]
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// BuildPrompt prepends the retrieved chunks to query as numbered sources,
+// asking the model to cite them by number. Paths are shown relative to root.
+func BuildPrompt(root, query string, results []Result) string {
+	if len(results) == 0 {
+		return query
+	}
+
+	var b strings.Builder
+	b.WriteString("Use the following excerpts from local files to answer the request. ")
+	b.WriteString("Cite the sources you rely on by their bracketed number right after the statement they support, e.g. [1] or [1, 3]. ")
+	b.WriteString("If the excerpts are not relevant, answer normally.\n\n")
+	for i, result := range results {
+		fmt.Fprintf(&b, "[%d] %s\n", i+1, Citation(root, result.Chunk))
+		b.WriteString("```\n")
+		b.WriteString(result.Content)
+		b.WriteString("\n```\n\n")
+	}
+	b.WriteString("Request: ")
+	b.WriteString(query)
+	return b.String()
+}
+
+// Citation formats a chunk as path:start-end, relative to root when possible
+func Citation(root string, chunk Chunk) string {
+	path := chunk.Path
+	if absRoot, err := filepath.Abs(root); err == nil {
+		if rel, err := filepath.Rel(absRoot, chunk.Path); err == nil && !strings.HasPrefix(rel, "..") && rel != "." {
+			path = rel
+		} else if rel == "." {
+			path = filepath.Base(chunk.Path)
+		}
+	}
+	return fmt.Sprintf("%s:%d-%d", path, chunk.StartLine, chunk.EndLine)
+}
+
+// Sources returns the citation labels of results, in the order BuildPrompt numbers them
+func Sources(root string, results []Result) []string {
+	sources := make([]string, len(results))
+	for i, result := range results {
+		sources[i] = Citation(root, result.Chunk)
+	}
+	return sources
+}
+
+// Cite maps the numbered sources given with a prompt to whether the response cites them
+func Cite(response string, sources []string) []CitedSource {
+	cited := make(map[int]bool)
+	for _, match := range citationPattern.FindAllStringSubmatch(response, -1) {
+		for _, part := range strings.Split(match[1], ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+				cited[n] = true
+			}
+		}
+	}
+	citations := make([]CitedSource, len(sources))
+	for i, source := range sources {
+		citations[i] = CitedSource{N: i + 1, Source: source, Cited: cited[i+1]}
+	}
+	return citations
+}
@@ -0,0 +1,20 @@
+package rag
+
+import "testing"
+
+func TestCite(t *testing.T) {
+	sources := []string{"a.go:1-10", "b.go:5-20", "c.md:1-3"}
+	citations := Cite("Run make [1]. See also [1, 3] and [7].", sources)
+	expected := []bool{true, false, true}
+	if len(citations) != len(sources) {
+		t.Fatalf("got %d citations, want %d", len(citations), len(sources))
+	}
+	for i, citation := range citations {
+		if citation.N != i+1 || citation.Source != sources[i] {
+			t.Errorf("citation %d: got [%d] %s", i, citation.N, citation.Source)
+		}
+		if citation.Cited != expected[i] {
+			t.Errorf("citation [%d]: cited = %v, want %v", citation.N, citation.Cited, expected[i])
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package rag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"q/transport"
+	. "q/types"
+)
+
+const DefaultEmbeddingModel = "text-embedding-3-small"
+
+// maxBatchSize bounds the number of inputs sent per embeddings request
+const maxBatchSize = 64
+
+// Embedder turns text into vectors using an OpenAI-compatible embeddings endpoint
+type Embedder struct {
+	Model    string
+	endpoint string
+	auth     string
+	orgID    string
+
+	httpClient *http.Client
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// NewEmbedder creates an embedder that talks to the same provider as the given chat model.
+// config.Auth must already hold the resolved key, not the env var name.
+func NewEmbedder(config ModelConfig, model string) *Embedder {
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+	return &Embedder{
+		Model:      model,
+		endpoint:   EmbeddingsEndpoint(config.Endpoint),
+		auth:       config.Auth,
+		orgID:      config.OrgID,
+		httpClient: transport.Client(time.Second * 120),
+	}
+}
+
+// EmbeddingsEndpoint derives the embeddings URL from a chat completions URL
+func EmbeddingsEndpoint(chatEndpoint string) string {
+	if strings.HasSuffix(chatEndpoint, "/chat/completions") {
+		return strings.TrimSuffix(chatEndpoint, "/chat/completions") + "/embeddings"
+	}
+	// Azure-style endpoints carry the route before the query string
+	if i := strings.Index(chatEndpoint, "/chat/completions?"); i != -1 {
+		return chatEndpoint[:i] + "/embeddings" + chatEndpoint[i+len("/chat/completions"):]
+	}
+	return chatEndpoint
+}
+
+// Embed returns one vector per input, in order
+func (e *Embedder) Embed(inputs []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(inputs))
+	for start := 0; start < len(inputs); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(inputs) {
+			end = len(inputs)
+		}
+		batch, err := e.embedBatch(inputs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (e *Embedder) embedBatch(inputs []string) ([][]float32, error) {
+	payloadBytes, err := json.Marshal(embeddingRequest{Model: e.Model, Input: inputs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if strings.Contains(e.endpoint, "openai.azure.com") {
+		req.Header.Set("Api-Key", e.auth)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+e.auth)
+	}
+	if e.orgID != "" {
+		req.Header.Set("OpenAI-Organization", e.orgID)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make the embeddings request: %w", err)
+	}
+	defer transport.Release(resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("embeddings request failed: %s", resp.Status)
+	}
+
+	var data embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to parse embeddings response: %w", err)
+	}
+	if len(data.Data) != len(inputs) {
+		return nil, fmt.Errorf("embeddings response has %d vectors for %d inputs", len(data.Data), len(inputs))
+	}
+
+	vectors := make([][]float32, len(inputs))
+	for _, d := range data.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("embeddings response has out of range index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
@@ -0,0 +1,323 @@
+package rag
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"q/workspace"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// maxFileSize skips files that are unlikely to be useful prose or source
+const maxFileSize = 512 * 1024
+
+var skippedDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"__pycache__":  true,
+}
+
+// scopeClause matches a path that is either root itself or lives beneath it.
+// It takes root, len(root)+1, and root plus a trailing separator as arguments.
+const scopeClause = `(path = ? OR substr(path, 1, ?) = ?)`
+
+// Index is a local vector store of file chunks backed by SQLite
+type Index struct {
+	db       *sql.DB
+	embedder *Embedder
+}
+
+// Result is a chunk returned by a search, with its cosine similarity to the query
+type Result struct {
+	Chunk
+	Score float64
+}
+
+// OpenIndex opens (or creates) the index database at ~/.shell-ai/index.db, or
+// in the selected workspace's directory
+func OpenIndex(embedder *Embedder) (*Index, error) {
+	indexDir, err := workspace.Dir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(indexDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create index directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(indexDir, "index.db"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index database: %w", err)
+	}
+
+	index := &Index{db: db, embedder: embedder}
+	if err := index.initSchema(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return index, nil
+}
+
+// initSchema creates the database schema if it doesn't exist
+func (ix *Index) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS files (
+		path TEXT PRIMARY KEY,
+		hash TEXT,
+		embedding_model TEXT,
+		indexed_utc TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS chunks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		path TEXT REFERENCES files(path),
+		start_line INTEGER,
+		end_line INTEGER,
+		content TEXT,
+		embedding BLOB
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_chunks_path ON chunks(path);
+	`
+
+	_, err := ix.db.Exec(schema)
+	return err
+}
+
+// Close closes the database connection
+func (ix *Index) Close() error {
+	if ix.db != nil {
+		return ix.db.Close()
+	}
+	return nil
+}
+
+// Update walks root and (re)embeds every file whose content hash changed
+// since it was last indexed. Files that disappeared are dropped.
+// It returns the number of files that were re-embedded.
+func (ix *Index) Update(root string) (int, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return 0, err
+	}
+
+	known, err := ix.knownHashes(root)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	seen := make(map[string]bool)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path != root && (strings.HasPrefix(name, ".") || skippedDirs[name]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Size() == 0 || info.Size() > maxFileSize {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil || !isText(data) {
+			return nil
+		}
+		seen[path] = true
+
+		hash := hashContent(data)
+		if known[path] == hash {
+			return nil
+		}
+		if err := ix.indexFile(path, hash, string(data)); err != nil {
+			return fmt.Errorf("failed to index %s: %w", path, err)
+		}
+		updated++
+		return nil
+	})
+	if err != nil {
+		return updated, err
+	}
+
+	for path := range known {
+		if !seen[path] {
+			if err := ix.removeFile(path); err != nil {
+				return updated, err
+			}
+		}
+	}
+	return updated, nil
+}
+
+// knownHashes returns the stored hash of every file under root that was
+// embedded with the current embedding model
+func (ix *Index) knownHashes(root string) (map[string]string, error) {
+	rows, err := ix.db.Query(
+		`SELECT path, hash FROM files WHERE embedding_model = ? AND `+scopeClause,
+		ix.embedder.Model, root, len(root)+1, root+string(filepath.Separator),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var path, hash string
+		if err := rows.Scan(&path, &hash); err != nil {
+			continue
+		}
+		hashes[path] = hash
+	}
+	return hashes, rows.Err()
+}
+
+func (ix *Index) indexFile(path, hash, text string) error {
+	chunks := ChunkText(path, text, defaultChunkLines, defaultChunkOverlap)
+	inputs := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		inputs[i] = chunk.Content
+	}
+	vectors, err := ix.embedder.Embed(inputs)
+	if err != nil {
+		return err
+	}
+
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM chunks WHERE path = ?`, path); err != nil {
+		return err
+	}
+	for i, chunk := range chunks {
+		_, err := tx.Exec(
+			`INSERT INTO chunks (path, start_line, end_line, content, embedding) VALUES (?, ?, ?, ?, ?)`,
+			chunk.Path, chunk.StartLine, chunk.EndLine, chunk.Content, encodeVector(vectors[i]),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(
+		`INSERT OR REPLACE INTO files (path, hash, embedding_model, indexed_utc) VALUES (?, ?, ?, ?)`,
+		path, hash, ix.embedder.Model, time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ix *Index) removeFile(path string) error {
+	if _, err := ix.db.Exec(`DELETE FROM chunks WHERE path = ?`, path); err != nil {
+		return err
+	}
+	_, err := ix.db.Exec(`DELETE FROM files WHERE path = ?`, path)
+	return err
+}
+
+// Search returns the k chunks under root most similar to query
+func (ix *Index) Search(root, query string, k int) ([]Result, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors, err := ix.embedder.Embed([]string{query})
+	if err != nil {
+		return nil, err
+	}
+	queryVector := vectors[0]
+
+	rows, err := ix.db.Query(
+		`SELECT path, start_line, end_line, content, embedding FROM chunks WHERE `+scopeClause,
+		root, len(root)+1, root+string(filepath.Separator),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []Result
+	for rows.Next() {
+		var result Result
+		var blob []byte
+		if err := rows.Scan(&result.Path, &result.StartLine, &result.EndLine, &result.Content, &blob); err != nil {
+			continue
+		}
+		result.Score = cosineSimilarity(queryVector, decodeVector(blob))
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+func hashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func isText(data []byte) bool {
+	sample := data
+	if len(sample) > 8000 {
+		sample = sample[:8000]
+	}
+	return !bytes.Contains(sample, []byte{0}) && utf8.Valid(data)
+}
+
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return v
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
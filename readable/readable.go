@@ -0,0 +1,294 @@
+// Package readable extracts the main text of a web page, leaving out
+// navigation, ads, scripts and other boilerplate, in the spirit of
+// Readability.
+package readable
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// skipped elements never hold the main text
+var skipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Form: true, atom.Button: true, atom.Select: true, atom.Svg: true,
+	atom.Iframe: true, atom.Figure: true,
+}
+
+// boilerplateHints in a class or id mark sidebars, comments, cookie banners and the like
+var boilerplateHints = []string{
+	"sidebar", "comment", "footer", "header", "menu", "nav", "cookie", "banner",
+	"share", "social", "related", "promo", "advert", "subscribe", "newsletter",
+}
+
+// blocks start a new line in the extracted text
+var blocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Li: true, atom.Pre: true, atom.Blockquote: true, atom.Tr: true, atom.Br: true,
+	atom.Dt: true, atom.Dd: true, atom.Table: true, atom.Ul: true, atom.Ol: true,
+}
+
+// Extract returns the page title and its main text as plain paragraphs
+func Extract(r io.Reader) (title, text string, err error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", "", err
+	}
+	if t := find(doc, atom.Title); t != nil {
+		title = strings.TrimSpace(collapse(textOf(t)))
+	}
+
+	body := find(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+	content := find(body, atom.Article)
+	if content == nil {
+		content = find(body, atom.Main)
+	}
+	if content == nil {
+		content = densest(body)
+	}
+	if content == nil {
+		content = body
+	}
+
+	var b strings.Builder
+	render(content, &b)
+	return title, tidy(b.String()), nil
+}
+
+// find returns the first element of type a under n, depth first
+func find(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// densest returns the element whose direct <p> children hold the most text,
+// which on most pages is the container of the main text
+func densest(n *html.Node) *html.Node {
+	var best *html.Node
+	bestScore := 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (skipped[n.DataAtom] || isBoilerplate(n)) {
+			return
+		}
+		score := 0
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && (c.DataAtom == atom.P || c.DataAtom == atom.Pre) {
+				score += len(collapse(textOf(c)))
+			}
+		}
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return best
+}
+
+func isBoilerplate(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		if attr.Key != "class" && attr.Key != "id" && attr.Key != "role" {
+			continue
+		}
+		value := strings.ToLower(attr.Val)
+		for _, hint := range boilerplateHints {
+			if strings.Contains(value, hint) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// textOf returns all the text under n
+func textOf(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textOf(c))
+	}
+	return b.String()
+}
+
+// render writes the readable text under n, one block per line and with
+// preformatted text kept as is
+func render(n *html.Node, b *strings.Builder) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(collapse(n.Data))
+		return
+	case html.ElementNode:
+		if skipped[n.DataAtom] || isBoilerplate(n) {
+			return
+		}
+		if n.DataAtom == atom.Pre {
+			b.WriteString("\n\n" + textOf(n) + "\n\n")
+			return
+		}
+	}
+	block := n.Type == html.ElementNode && blocks[n.DataAtom]
+	if block {
+		b.WriteString("\n\n")
+	}
+	if n.DataAtom == atom.Li {
+		b.WriteString("- ")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		render(c, b)
+	}
+	if block {
+		b.WriteString("\n\n")
+	}
+}
+
+// collapse turns runs of whitespace into single spaces, as browsers do
+func collapse(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			return " "
+		}
+		return ""
+	}
+	out := strings.Join(fields, " ")
+	if strings.TrimLeft(s, " \t\r\n") != s {
+		out = " " + out
+	}
+	if strings.TrimRight(s, " \t\r\n") != s {
+		out += " "
+	}
+	return out
+}
+
+// tidy trims each line and leaves a single blank line between blocks
+func tidy(text string) string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		if strings.Contains(paragraph, "\n") {
+			// Preformatted text keeps its lines and indentation
+			paragraphs = append(paragraphs, strings.Trim(paragraph, "\n"))
+			continue
+		}
+		paragraphs = append(paragraphs, strings.TrimSpace(paragraph))
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// maxPageBytes caps how much of a page is read
+const maxPageBytes = 10 << 20
+
+// Fetch downloads a page and returns its title and main text. Plain text and
+// other non-HTML responses are returned as they are.
+func Fetch(url string) (title, text string, err error) {
+	return fetch(url, &http.Client{Timeout: 30 * time.Second})
+}
+
+// FetchAllowed is Fetch for pages that must pass CheckURL, including any
+// pages the request is redirected to
+func FetchAllowed(rawURL string, allow, deny []string) (title, text string, err error) {
+	if err := CheckURL(rawURL, allow, deny); err != nil {
+		return "", "", err
+	}
+	return fetch(rawURL, &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			return CheckURL(req.URL.String(), allow, deny)
+		},
+	})
+}
+
+func fetch(url string, client *http.Client) (title, text string, err error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("User-Agent", "shell-ai")
+	req.Header.Set("Accept", "text/html,text/plain;q=0.9,*/*;q=0.5")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	body := io.LimitReader(resp.Body, maxPageBytes)
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" || mediaType == "" {
+		return Extract(body)
+	}
+	if !strings.HasPrefix(mediaType, "text/") && mediaType != "application/json" {
+		return "", "", fmt.Errorf("%s is %s, not a page or text", url, mediaType)
+	}
+	data, err := io.ReadAll(body)
+	return "", string(data), err
+}
+
+// CheckURL returns an error unless rawURL is an http(s) URL whose host is
+// allowed: on the allow list, if there is one, and not on the deny list. A
+// domain on either list covers its subdomains too.
+func CheckURL(rawURL string, allow, deny []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s is not an http or https URL", rawURL)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("%s has no host", rawURL)
+	}
+	for _, domain := range deny {
+		if matchesDomain(host, domain) {
+			return fmt.Errorf("%s is on the deny list", host)
+		}
+	}
+	if len(allow) == 0 {
+		return nil
+	}
+	for _, domain := range allow {
+		if matchesDomain(host, domain) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not on the allow list", host)
+}
+
+// matchesDomain reports whether host is domain or one of its subdomains
+func matchesDomain(host, domain string) bool {
+	domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
@@ -0,0 +1,84 @@
+package readable
+
+import (
+	"strings"
+	"testing"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head><title> Rolling back a deploy </title><script>var tracking = 1;</script></head>
+<body>
+  <nav><a href="/">Home</a> <a href="/blog">Blog</a></nav>
+  <div class="sidebar"><p>Subscribe to our newsletter for more tips and tricks every week!</p></div>
+  <div id="content">
+    <h1>Rolling back</h1>
+    <p>To roll back, redeploy the previous
+       release tag.</p>
+    <pre>git checkout v1.2.3
+  make deploy</pre>
+    <ul><li>Check the logs</li><li>Tell the team</li></ul>
+  </div>
+  <footer><p>Copyright 2024, all rights reserved by the company.</p></footer>
+</body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	title, text, err := Extract(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if title != "Rolling back a deploy" {
+		t.Errorf("title = %q", title)
+	}
+
+	want := "Rolling back\n\n" +
+		"To roll back, redeploy the previous release tag.\n\n" +
+		"git checkout v1.2.3\n  make deploy\n\n" +
+		"- Check the logs\n\n- Tell the team"
+	if text != want {
+		t.Errorf("text =\n%s\n\nwant\n%s", text, want)
+	}
+	for _, boilerplate := range []string{"Home", "newsletter", "Copyright", "tracking"} {
+		if strings.Contains(text, boilerplate) {
+			t.Errorf("text should leave out %q", boilerplate)
+		}
+	}
+}
+
+func TestExtractPrefersArticle(t *testing.T) {
+	_, text, err := Extract(strings.NewReader(`<body><div><p>Some very long teaser text that is not the article at all, but is long.</p></div>
+		<article><p>The article.</p></article></body>`))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if text != "The article." {
+		t.Errorf("text = %q, want the article only", text)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	allow := []string{"go.dev", "Example.com"}
+	deny := []string{"private.example.com"}
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://go.dev/doc", true},
+		{"https://pkg.go.dev/net/url", true},
+		{"http://EXAMPLE.com:8080/x", true},
+		{"https://notgo.dev/", false},
+		{"https://private.example.com/", false},
+		{"https://api.private.example.com/", false},
+		{"ftp://go.dev/file", false},
+		{"file:///etc/passwd", false},
+	}
+	for _, tt := range tests {
+		if err := CheckURL(tt.url, allow, deny); (err == nil) != tt.ok {
+			t.Errorf("CheckURL(%q) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+	}
+	if err := CheckURL("https://anything.org/", nil, deny); err != nil {
+		t.Errorf("with no allow list, other domains should be allowed: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+// Package reconcile compares the usage a provider billed, from its usage
+// export, with the usage and costs estimated in the logs, for `q logs
+// reconcile`. Drift shows where the local pricing table is off.
+package reconcile
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Usage is a model's usage on one UTC day
+type Usage struct {
+	Day          string
+	Model        string
+	Requests     int
+	InputTokens  int
+	OutputTokens int
+	Cost         float64
+}
+
+// Export is a provider's usage export, summed per day and model
+type Export struct {
+	Usage []Usage
+	// HasCost and HasTokens tell which columns the export had
+	HasCost, HasTokens bool
+}
+
+// Columns of OpenAI's usage exports, by what they hold. Costs exports have a
+// line item per model and token type, activity exports a row per model with
+// token counts; the older exports used the n_* names.
+var (
+	dayColumns      = []string{"start_time_iso", "date", "day", "timestamp"}
+	unixColumns     = []string{"start_time"}
+	modelColumns    = []string{"model", "snapshot_id", "line_item"}
+	costColumns     = []string{"amount_value", "cost", "cost_usd", "amount", "cost (usd)"}
+	inputColumns    = []string{"input_tokens", "n_context_tokens_total"}
+	outputColumns   = []string{"output_tokens", "n_generated_tokens_total"}
+	requestsColumns = []string{"num_model_requests", "n_requests"}
+)
+
+// snapshotDate matches the date OpenAI appends to a model to name a snapshot
+var snapshotDate = regexp.MustCompile(`-\d{4}-\d{2}-\d{2}$`)
+
+// BaseModel strips the snapshot date from a model, so gpt-4.1-2025-04-14 is
+// counted as the gpt-4.1 that was asked for
+func BaseModel(model string) string {
+	return snapshotDate.ReplaceAllString(strings.TrimSpace(model), "")
+}
+
+// ParseOpenAI reads a usage export CSV from the OpenAI dashboard or Usage
+// API. Rows without a model, such as tool calls, are skipped.
+func ParseOpenAI(r io.Reader) (Export, error) {
+	var export Export
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return export, fmt.Errorf("failed to read the header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	find := func(names []string) int {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+
+	dayCol, unixCol, modelCol := find(dayColumns), find(unixColumns), find(modelColumns)
+	costCol, inputCol, outputCol, requestsCol := find(costColumns), find(inputColumns), find(outputColumns), find(requestsColumns)
+	if dayCol < 0 && unixCol < 0 {
+		return export, fmt.Errorf("no date column (expected one of %s)", strings.Join(append(dayColumns, unixColumns...), ", "))
+	}
+	if modelCol < 0 {
+		return export, fmt.Errorf("no model column (expected one of %s)", strings.Join(modelColumns, ", "))
+	}
+	export.HasCost = costCol >= 0
+	export.HasTokens = inputCol >= 0 || outputCol >= 0
+	if !export.HasCost && !export.HasTokens {
+		return export, fmt.Errorf("no cost or token columns (expected one of %s, or input_tokens and output_tokens)", strings.Join(costColumns, ", "))
+	}
+
+	sums := map[[2]string]*Usage{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return export, fmt.Errorf("line %d: %w", line, err)
+		}
+		field := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		model := field(modelCol)
+		if i := strings.Index(model, ","); i >= 0 {
+			// A line item like "gpt-4.1-2025-04-14, input"
+			model = model[:i]
+		}
+		model = BaseModel(model)
+		if model == "" {
+			continue
+		}
+		var day string
+		if dayCol >= 0 {
+			day, err = parseDay(field(dayCol))
+		} else {
+			day, err = parseUnixDay(field(unixCol))
+		}
+		if err != nil {
+			return export, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		key := [2]string{day, model}
+		usage := sums[key]
+		if usage == nil {
+			usage = &Usage{Day: day, Model: model}
+			sums[key] = usage
+		}
+		cost, err := parseNumber(field(costCol))
+		if err != nil {
+			return export, fmt.Errorf("line %d: cost: %w", line, err)
+		}
+		usage.Cost += cost
+		for _, n := range []struct {
+			col int
+			sum *int
+		}{{inputCol, &usage.InputTokens}, {outputCol, &usage.OutputTokens}, {requestsCol, &usage.Requests}} {
+			value, err := parseNumber(field(n.col))
+			if err != nil {
+				return export, fmt.Errorf("line %d: %s: %w", line, header[n.col], err)
+			}
+			*n.sum += int(value)
+		}
+	}
+
+	for _, usage := range sums {
+		export.Usage = append(export.Usage, *usage)
+	}
+	sortUsage(export.Usage)
+	return export, nil
+}
+
+// parseDay reads the UTC day of a date or timestamp
+func parseDay(value string) (string, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format("2006-01-02"), nil
+		}
+	}
+	if len(value) >= 10 {
+		if t, err := time.Parse("2006-01-02", value[:10]); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("can't read the date %q", value)
+}
+
+// parseUnixDay reads the UTC day of a Unix timestamp in seconds
+func parseUnixDay(value string) (string, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("can't read the timestamp %q", value)
+	}
+	return time.Unix(seconds, 0).UTC().Format("2006-01-02"), nil
+}
+
+// parseNumber reads an amount or count, which may be empty or have a $
+func parseNumber(value string) (float64, error) {
+	value = strings.TrimPrefix(strings.ReplaceAll(value, ",", ""), "$")
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func sortUsage(usage []Usage) {
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Day != usage[j].Day {
+			return usage[i].Day < usage[j].Day
+		}
+		return usage[i].Model < usage[j].Model
+	})
+}
+
+// Row is the local estimate of a day's usage of a model next to what was billed
+type Row struct {
+	Day, Model string
+	Local      Usage
+	Billed     Usage
+}
+
+// CostDrift is how far the local cost estimate is off what was billed, as a
+// share of the bill: positive if it's too high, 0 if nothing was billed
+func (r Row) CostDrift() float64 {
+	return drift(r.Local.Cost, r.Billed.Cost)
+}
+
+// TokenDrift is how far the logged token counts are off the billed ones
+func (r Row) TokenDrift() float64 {
+	return drift(float64(r.Local.InputTokens+r.Local.OutputTokens), float64(r.Billed.InputTokens+r.Billed.OutputTokens))
+}
+
+func drift(local, billed float64) float64 {
+	if billed == 0 {
+		return 0
+	}
+	return (local - billed) / billed
+}
+
+// Compare lines up the local usage with the export's, per day and model.
+// Only the models and days the export covers are compared, since the logs
+// also hold requests to other providers.
+func Compare(export Export, local []Usage) []Row {
+	if len(export.Usage) == 0 {
+		return nil
+	}
+	models := map[string]bool{}
+	first, last := export.Usage[0].Day, export.Usage[0].Day
+	for _, usage := range export.Usage {
+		models[usage.Model] = true
+		if usage.Day < first {
+			first = usage.Day
+		}
+		if usage.Day > last {
+			last = usage.Day
+		}
+	}
+
+	rows := map[[2]string]*Row{}
+	row := func(day, model string) *Row {
+		key := [2]string{day, model}
+		if rows[key] == nil {
+			rows[key] = &Row{Day: day, Model: model}
+		}
+		return rows[key]
+	}
+	for _, usage := range export.Usage {
+		row(usage.Day, usage.Model).Billed = usage
+	}
+	for _, usage := range local {
+		model := BaseModel(usage.Model)
+		if !models[model] || usage.Day < first || usage.Day > last {
+			continue
+		}
+		r := row(usage.Day, model)
+		r.Local.Requests += usage.Requests
+		r.Local.InputTokens += usage.InputTokens
+		r.Local.OutputTokens += usage.OutputTokens
+		r.Local.Cost += usage.Cost
+	}
+
+	var compared []Row
+	for _, r := range rows {
+		compared = append(compared, *r)
+	}
+	sort.Slice(compared, func(i, j int) bool {
+		if compared[i].Day != compared[j].Day {
+			return compared[i].Day < compared[j].Day
+		}
+		return compared[i].Model < compared[j].Model
+	})
+	return compared
+}
+
+// ByModel sums rows per model over the whole period, most billed first
+func ByModel(rows []Row) []Row {
+	sums := map[string]*Row{}
+	for _, r := range rows {
+		sum := sums[r.Model]
+		if sum == nil {
+			sum = &Row{Model: r.Model}
+			sums[r.Model] = sum
+		}
+		for _, pair := range [][2]*Usage{{&sum.Local, &r.Local}, {&sum.Billed, &r.Billed}} {
+			pair[0].Requests += pair[1].Requests
+			pair[0].InputTokens += pair[1].InputTokens
+			pair[0].OutputTokens += pair[1].OutputTokens
+			pair[0].Cost += pair[1].Cost
+		}
+	}
+	var models []Row
+	for _, sum := range sums {
+		models = append(models, *sum)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].Billed.Cost != models[j].Billed.Cost {
+			return models[i].Billed.Cost > models[j].Billed.Cost
+		}
+		return models[i].Model < models[j].Model
+	})
+	return models
+}
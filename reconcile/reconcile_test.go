@@ -0,0 +1,89 @@
+package reconcile
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseOpenAICosts(t *testing.T) {
+	csv := `start_time,end_time,start_time_iso,end_time_iso,organization_id,project_id,line_item,amount_value,amount_currency
+1740787200,1740873600,2025-03-01T00:00:00+00:00,2025-03-02T00:00:00+00:00,org-1,proj-1,"gpt-4.1-2025-04-14, input",0.50,usd
+1740787200,1740873600,2025-03-01T00:00:00+00:00,2025-03-02T00:00:00+00:00,org-1,proj-1,"gpt-4.1-2025-04-14, output",1.25,usd
+1740873600,1740960000,2025-03-02T00:00:00+00:00,2025-03-03T00:00:00+00:00,org-1,proj-1,"gpt-4.1-mini, input",0.10,usd
+1740873600,1740960000,2025-03-02T00:00:00+00:00,2025-03-03T00:00:00+00:00,org-1,proj-1,,0.99,usd
+`
+	export, err := ParseOpenAI(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("ParseOpenAI: %v", err)
+	}
+	if !export.HasCost || export.HasTokens {
+		t.Errorf("a costs export has costs and no tokens, got %+v", export)
+	}
+	want := []Usage{
+		{Day: "2025-03-01", Model: "gpt-4.1", Cost: 1.75},
+		{Day: "2025-03-02", Model: "gpt-4.1-mini", Cost: 0.10},
+	}
+	if len(export.Usage) != len(want) {
+		t.Fatalf("Usage = %+v, want %+v", export.Usage, want)
+	}
+	for i, u := range export.Usage {
+		if u.Day != want[i].Day || u.Model != want[i].Model || math.Abs(u.Cost-want[i].Cost) > 1e-9 {
+			t.Errorf("Usage[%d] = %+v, want %+v", i, u, want[i])
+		}
+	}
+}
+
+func TestParseOpenAIActivity(t *testing.T) {
+	csv := "start_time,end_time,model,num_model_requests,input_tokens,output_tokens\n" +
+		"1740787200,1740873600,gpt-4.1,3,1000,200\n" +
+		"1740787200,1740873600,gpt-4.1-2025-04-14,1,500,100\n"
+	export, err := ParseOpenAI(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("ParseOpenAI: %v", err)
+	}
+	if export.HasCost || !export.HasTokens {
+		t.Errorf("an activity export has tokens and no costs, got %+v", export)
+	}
+	if len(export.Usage) != 1 || export.Usage[0] != (Usage{Day: "2025-03-01", Model: "gpt-4.1", Requests: 4, InputTokens: 1500, OutputTokens: 300}) {
+		t.Errorf("Usage = %+v", export.Usage)
+	}
+}
+
+func TestParseOpenAIErrors(t *testing.T) {
+	for _, csv := range []string{
+		"model,amount_value\ngpt-4.1,1\n",
+		"date,amount_value\n2025-03-01,1\n",
+		"date,model\n2025-03-01,gpt-4.1\n",
+		"date,model,cost\nyesterday,gpt-4.1,1\n",
+		"date,model,cost\n2025-03-01,gpt-4.1,lots\n",
+	} {
+		if _, err := ParseOpenAI(strings.NewReader(csv)); err == nil {
+			t.Errorf("ParseOpenAI(%q) should fail", csv)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	export := Export{HasCost: true, Usage: []Usage{
+		{Day: "2025-03-01", Model: "gpt-4.1", Cost: 2},
+		{Day: "2025-03-02", Model: "gpt-4.1", Cost: 4},
+	}}
+	local := []Usage{
+		{Day: "2025-03-01", Model: "gpt-4.1", Requests: 2, Cost: 1.8},
+		{Day: "2025-03-02", Model: "gpt-4.1-2025-04-14", Requests: 1, Cost: 4},
+		{Day: "2025-03-02", Model: "claude-sonnet-4-0", Requests: 5, Cost: 3},
+		{Day: "2025-03-03", Model: "gpt-4.1", Requests: 1, Cost: 1},
+	}
+	rows := Compare(export, local)
+	if len(rows) != 2 {
+		t.Fatalf("only the export's models and days should be compared, got %+v", rows)
+	}
+	if math.Abs(rows[0].CostDrift()+0.1) > 1e-9 || rows[1].CostDrift() != 0 {
+		t.Errorf("drifts = %v, %v, want -10%% and 0", rows[0].CostDrift(), rows[1].CostDrift())
+	}
+	models := ByModel(rows)
+	if len(models) != 1 || models[0].Local.Requests != 3 || math.Abs(models[0].CostDrift()+0.2/6) > 1e-9 {
+		t.Errorf("ByModel = %+v", models)
+	}
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"regexp"
+	"strings"
+
+	"q/tokens"
+	. "q/types"
+)
+
+// DefaultMaxSimpleTokens is the longest prompt considered simple when not configured
+const DefaultMaxSimpleTokens = 60
+
+// Prompt intents
+const (
+	IntentExplain  = "explain"
+	IntentGenerate = "generate"
+	IntentCommand  = "command"
+)
+
+// Features are the signals a prompt is classified by
+type Features struct {
+	Tokens  int
+	HasCode bool
+	Intent  string
+}
+
+var (
+	explainPattern  = regexp.MustCompile(`(?i)^\s*(explain|what|why|how does|how do|what's|whats|describe|difference|is it|can you explain)\b|\b(explain|meaning of|what does)\b`)
+	generatePattern = regexp.MustCompile(`(?i)\b(write|create|generate|implement|build|refactor|scaffold|program|script|function|class|module|dockerfile|makefile|test suite)\b`)
+	codePattern     = regexp.MustCompile("```|\\b(func|def|class|import|return|const|let|var)\\b.*[({=]|[{};]\\s*$|^\\s*\\$ |\\|\\s*\\w+\\s+-")
+)
+
+// Classify extracts the routing features of a prompt
+func Classify(prompt string) Features {
+	features := Features{
+		Tokens: tokens.Estimate(prompt),
+		Intent: IntentCommand,
+	}
+	for _, line := range strings.Split(prompt, "\n") {
+		if codePattern.MatchString(line) {
+			features.HasCode = true
+			break
+		}
+	}
+	switch {
+	case explainPattern.MatchString(prompt):
+		features.Intent = IntentExplain
+	case generatePattern.MatchString(prompt):
+		features.Intent = IntentGenerate
+	}
+	return features
+}
+
+// matches reports whether a rule's class applies to the prompt's features
+func (f Features) matches(class string, maxSimple int) bool {
+	switch strings.ToLower(class) {
+	case "code":
+		return f.HasCode
+	case IntentExplain, IntentGenerate, IntentCommand:
+		return f.Intent == strings.ToLower(class)
+	case "long":
+		return f.Tokens > maxSimple
+	case "short":
+		return f.Tokens <= maxSimple
+	}
+	return false
+}
+
+// Complex reports whether a prompt needs the strong model: it contains code,
+// is long, or asks for something to be written
+func (f Features) Complex(maxSimple int) bool {
+	return f.HasCode || f.Tokens > maxSimple || f.Intent == IntentGenerate
+}
+
+// Route picks the model for a prompt and says why. Rules are tried in order;
+// otherwise simple prompts go to the simple model and complex ones to the
+// complex model. An empty model means no preference (use the default).
+func Route(config RoutingConfig, prompt string) (model, reason string) {
+	maxSimple := config.MaxSimpleTokens
+	if maxSimple <= 0 {
+		maxSimple = DefaultMaxSimpleTokens
+	}
+	features := Classify(prompt)
+	for _, rule := range config.Rules {
+		if features.matches(rule.When, maxSimple) {
+			return rule.Model, "rule: " + rule.When
+		}
+	}
+	if features.Complex(maxSimple) {
+		return config.ComplexModel, "complex prompt"
+	}
+	return config.SimpleModel, "simple prompt"
+}
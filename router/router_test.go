@@ -0,0 +1,44 @@
+package router
+
+import (
+	"testing"
+
+	. "q/types"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		prompt  string
+		intent  string
+		hasCode bool
+	}{
+		{"list files by size", IntentCommand, false},
+		{"explain what chmod 755 does", IntentExplain, false},
+		{"why is my disk full", IntentExplain, false},
+		{"write a python script that renames photos by date", IntentGenerate, false},
+		{"fix this:\n```go\nfunc main() {\n```", IntentCommand, true},
+		{"what does `cat x | grep -v foo` do", IntentExplain, true},
+	}
+	for _, tt := range tests {
+		got := Classify(tt.prompt)
+		if got.Intent != tt.intent || got.HasCode != tt.hasCode {
+			t.Errorf("Classify(%q) = %+v, want intent %s, hasCode %v", tt.prompt, got, tt.intent, tt.hasCode)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	config := RoutingConfig{SimpleModel: "cheap", ComplexModel: "strong"}
+
+	if model, _ := Route(config, "list files by size"); model != "cheap" {
+		t.Errorf("simple prompt routed to %q", model)
+	}
+	if model, _ := Route(config, "write a bash script that backs up my home directory"); model != "strong" {
+		t.Errorf("generate prompt routed to %q", model)
+	}
+
+	config.Rules = []RoutingRule{{When: "explain", Model: "explainer"}}
+	if model, reason := Route(config, "explain how git rebase works"); model != "explainer" || reason != "rule: explain" {
+		t.Errorf("rule not applied: %q (%s)", model, reason)
+	}
+}
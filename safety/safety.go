@@ -0,0 +1,270 @@
+// Package safety spots the destructive parts of shell commands, so they can be
+// pointed out before anyone runs them
+package safety
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Severity is how much harm a finding can do
+type Severity int
+
+const (
+	// Caution marks things worth a second look, like running as root
+	Caution Severity = iota + 1
+	// Danger marks things that destroy data or are hard to undo
+	Danger
+)
+
+func (s Severity) String() string {
+	if s == Danger {
+		return "danger"
+	}
+	return "caution"
+}
+
+// Finding is one risky part of a command
+type Finding struct {
+	Severity Severity
+	Reason   string
+	// Words are the words of the command the finding is about
+	Words []string
+}
+
+// Analyze returns the risky parts of a command line, most severe first
+func Analyze(command string) []Finding {
+	var findings []Finding
+	words := Split(command)
+	if forkBomb.MatchString(command) {
+		findings = append(findings, Finding{Danger, "is a fork bomb, which hangs the machine", []string{command}})
+	}
+
+	var commands [][]string
+	start := 0
+	for i, word := range words {
+		if !isOperator(word) {
+			continue
+		}
+		commands = append(commands, words[start:i])
+		start = i + 1
+		switch word {
+		case ">", "&>":
+			if i+1 < len(words) {
+				target := words[i+1]
+				if strings.HasPrefix(target, "/dev/sd") || strings.HasPrefix(target, "/dev/nvme") || strings.HasPrefix(target, "/dev/disk") {
+					findings = append(findings, Finding{Danger, "writes straight to the disk " + target + ", destroying its contents", []string{word, target}})
+				} else if target != "/dev/null" {
+					findings = append(findings, Finding{Caution, "replaces the contents of " + target, []string{word, target}})
+				}
+			}
+		case "|":
+			if i+1 < len(words) && shells[path.Base(words[i+1])] && i > 0 && fetchesScript(words[:i]) {
+				findings = append(findings, Finding{Danger, "runs a script downloaded from the internet without showing it first", []string{word, words[i+1]}})
+			}
+		}
+	}
+	commands = append(commands, words[start:])
+
+	for _, argv := range commands {
+		findings = append(findings, analyzeCommand(argv)...)
+	}
+
+	// Most severe first, otherwise in command order
+	var sorted []Finding
+	for _, severity := range []Severity{Danger, Caution} {
+		for _, finding := range findings {
+			if finding.Severity == severity {
+				sorted = append(sorted, finding)
+			}
+		}
+	}
+	return sorted
+}
+
+// Worst is the highest severity among findings, or 0 if there are none
+func Worst(findings []Finding) Severity {
+	var worst Severity
+	for _, finding := range findings {
+		if finding.Severity > worst {
+			worst = finding.Severity
+		}
+	}
+	return worst
+}
+
+var forkBomb = regexp.MustCompile(`:\s*\(\s*\)\s*\{\s*:\s*\|\s*:\s*&\s*\}`)
+
+var shells = map[string]bool{"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "fish": true}
+
+var sqlDestructive = regexp.MustCompile(`(?i)\b(drop\s+(table|database|schema)|truncate\s+table|delete\s+from\s+\w+\s*(;|$))`)
+
+// fetchesScript reports whether a pipeline stage downloads something
+func fetchesScript(words []string) bool {
+	for _, word := range words {
+		if base := path.Base(word); base == "curl" || base == "wget" {
+			return true
+		}
+	}
+	return false
+}
+
+// analyzeCommand checks one simple command, given as its words
+func analyzeCommand(argv []string) []Finding {
+	var findings []Finding
+	// Skip variable assignments and wrappers that run the real command
+	for len(argv) > 0 {
+		name := path.Base(argv[0])
+		if strings.Contains(argv[0], "=") && !strings.HasPrefix(argv[0], "-") {
+			argv = argv[1:]
+			continue
+		}
+		if name == "sudo" || name == "doas" {
+			findings = append(findings, Finding{Caution, "runs as root, so nothing stops it from changing system files", argv[:1]})
+			argv = skipOptions(argv[1:])
+			continue
+		}
+		if name == "env" || name == "nohup" || name == "time" || name == "xargs" {
+			argv = skipOptions(argv[1:])
+			continue
+		}
+		break
+	}
+	if len(argv) == 0 {
+		return findings
+	}
+
+	name, args := path.Base(argv[0]), argv[1:]
+	flags := shortFlags(args)
+	switch {
+	case name == "rm":
+		if flags['r'] || flags['R'] || hasArg(args, "--recursive") {
+			reason := "deletes directories and everything in them"
+			if flags['f'] || hasArg(args, "--force") {
+				reason += ", without asking"
+			}
+			for _, arg := range args {
+				if arg == "/" || arg == "/*" || arg == "~" || arg == "~/" || arg == "*" || arg == "." || arg == ".." {
+					reason += "; " + arg + " means everything under it"
+					break
+				}
+			}
+			findings = append(findings, Finding{Danger, reason, append([]string{argv[0]}, optionWords(args)...)})
+		} else {
+			findings = append(findings, Finding{Caution, "deletes files for good; there's no trash to restore them from", argv[:1]})
+		}
+	case name == "dd":
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "of=") {
+				findings = append(findings, Finding{Danger, "overwrites " + strings.TrimPrefix(arg, "of=") + " block by block", []string{argv[0], arg}})
+			}
+		}
+	case strings.HasPrefix(name, "mkfs") || name == "wipefs" || name == "shred" || name == "fdisk" || name == "parted":
+		findings = append(findings, Finding{Danger, "erases or repartitions a disk or file beyond recovery", argv[:1]})
+	case name == "shutdown" || name == "reboot" || name == "halt" || name == "poweroff":
+		findings = append(findings, Finding{Danger, "shuts down or restarts the machine", argv[:1]})
+	case name == "chmod" || name == "chown" || name == "chgrp":
+		if flags['R'] || hasArg(args, "--recursive") {
+			findings = append(findings, Finding{Caution, "changes permissions of everything below the path", append(argv[:1:1], optionWords(args)...)})
+		}
+		if name == "chmod" && (hasArg(args, "777") || hasArg(args, "a+rwx")) {
+			findings = append(findings, Finding{Caution, "lets every user read, change and run the files", []string{"777"}})
+		}
+	case name == "find":
+		if hasArg(args, "-delete") {
+			findings = append(findings, Finding{Danger, "deletes every file that matches", []string{"-delete"}})
+		}
+		for i, arg := range args {
+			if (arg == "-exec" || arg == "-execdir") && i+1 < len(args) && path.Base(args[i+1]) == "rm" {
+				findings = append(findings, Finding{Danger, "deletes every file that matches", []string{arg, args[i+1]}})
+			}
+		}
+	case name == "git" && len(args) > 0:
+		switch args[0] {
+		case "push":
+			if flags['f'] || hasArg(args, "--force") || hasArg(args, "--force-with-lease") || hasArgPrefix(args, "+") {
+				findings = append(findings, Finding{Danger, "rewrites the remote branch, which can drop others' commits", append([]string{"push"}, optionWords(args)...)})
+			}
+			if hasArg(args, "--delete") {
+				findings = append(findings, Finding{Danger, "deletes a remote branch", []string{"--delete"}})
+			}
+		case "reset":
+			if hasArg(args, "--hard") {
+				findings = append(findings, Finding{Danger, "throws away uncommitted changes", []string{"reset", "--hard"}})
+			}
+		case "clean":
+			if flags['f'] || hasArg(args, "--force") {
+				findings = append(findings, Finding{Danger, "deletes untracked files, which git can't bring back", []string{"clean"}})
+			}
+		case "checkout", "restore":
+			if hasArg(args, ".") || hasArg(args, "--") {
+				findings = append(findings, Finding{Caution, "discards uncommitted changes to the files", args[:1]})
+			}
+		}
+	case name == "kill" || name == "killall" || name == "pkill":
+		findings = append(findings, Finding{Caution, "stops running processes, which may lose unsaved work", argv[:1]})
+	case name == "truncate":
+		findings = append(findings, Finding{Caution, "cuts files to a size, discarding the rest", argv[:1]})
+	case name == "kubectl" && len(args) > 0 && args[0] == "delete":
+		findings = append(findings, Finding{Danger, "deletes cluster resources", []string{"delete"}})
+	case name == "docker" && (hasArg(args, "prune") || (len(args) > 1 && args[0] == "volume" && args[1] == "rm")):
+		findings = append(findings, Finding{Caution, "removes Docker data, possibly including volumes", args[:1]})
+	case name == "psql" || name == "mysql" || name == "sqlite3":
+		for _, arg := range args {
+			if sqlDestructive.MatchString(arg) {
+				findings = append(findings, Finding{Danger, "drops or deletes database data", []string{arg}})
+			}
+		}
+	}
+	return findings
+}
+
+// shortFlags collects the letters of short options like -rf
+func shortFlags(args []string) map[rune]bool {
+	flags := map[rune]bool{}
+	for _, arg := range args {
+		if len(arg) > 1 && arg[0] == '-' && arg[1] != '-' {
+			for _, r := range arg[1:] {
+				flags[r] = true
+			}
+		}
+	}
+	return flags
+}
+
+// optionWords returns the options among args
+func optionWords(args []string) []string {
+	var options []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			options = append(options, arg)
+		}
+	}
+	return options
+}
+
+func skipOptions(args []string) []string {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		args = args[1:]
+	}
+	return args
+}
+
+func hasArg(args []string, want string) bool {
+	for _, arg := range args {
+		if arg == want {
+			return true
+		}
+	}
+	return false
+}
+
+func hasArgPrefix(args []string, prefix string) bool {
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
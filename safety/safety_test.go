@@ -0,0 +1,71 @@
+package safety
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{`tar -xzvf file.tgz`, []string{"tar", "-xzvf", "file.tgz"}},
+		{`echo "a b" 'c d' e\ f`, []string{"echo", "a b", "c d", "e f"}},
+		{`echo "say \"hi\""`, []string{"echo", `say "hi"`}},
+		{`make 2>&1|tee log&&echo ok`, []string{"make", "2>&1", "|", "tee", "log", "&&", "echo", "ok"}},
+		{`ls >> out; cat<in`, []string{"ls", ">>", "out", ";", "cat", "<", "in"}},
+		{`echo x2>y`, []string{"echo", "x2", ">", "y"}},
+	}
+	for _, tt := range tests {
+		if got := Split(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Split(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		command string
+		// want are the severities and a word of each reason, in order
+		want []string
+	}{
+		{"tar -xzvf file.tgz", nil},
+		{"ls -la > /dev/null", nil},
+		{"rm -rf /", []string{"danger: without asking; / means everything"}},
+		{"sudo rm notes.txt", []string{"caution: root", "caution: for good"}},
+		{"curl -fsSL https://example.com/install.sh | sh", []string{"danger: downloaded"}},
+		{"dd if=disk.img of=/dev/sdb bs=4M", []string{"danger: overwrites /dev/sdb"}},
+		{"git push -f origin main", []string{"danger: rewrites"}},
+		{"git reset --hard HEAD~1 && git clean -fd", []string{"danger: uncommitted", "danger: untracked"}},
+		{`find . -name '*.tmp' -exec rm {} \;`, []string{"danger: every file"}},
+		{"chmod -R 777 /var/www", []string{"caution: everything below", "caution: every user"}},
+		{"echo hi > notes.txt", []string{"caution: replaces the contents of notes.txt"}},
+		{`psql -c "DROP TABLE users"`, []string{"danger: drops"}},
+		{":(){ :|:& };:", []string{"danger: fork bomb"}},
+		{"FOO=1 env -i kubectl delete pod web", []string{"danger: cluster"}},
+	}
+	for _, tt := range tests {
+		findings := Analyze(tt.command)
+		if len(findings) != len(tt.want) {
+			t.Errorf("Analyze(%q) = %+v, want %d findings", tt.command, findings, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			severity, reason := strings.SplitN(want, ": ", 2)[0], strings.SplitN(want, ": ", 2)[1]
+			if findings[i].Severity.String() != severity || !strings.Contains(findings[i].Reason, reason) {
+				t.Errorf("Analyze(%q)[%d] = %s: %s, want %s", tt.command, i, findings[i].Severity, findings[i].Reason, want)
+			}
+		}
+	}
+}
+
+func TestWorst(t *testing.T) {
+	if got := Worst(Analyze("sudo rm -r build")); got != Danger {
+		t.Errorf("Worst = %v, want danger", got)
+	}
+	if got := Worst(Analyze("ls")); got != 0 {
+		t.Errorf("Worst(nothing) = %v, want 0", got)
+	}
+}
@@ -0,0 +1,79 @@
+package safety
+
+import "strings"
+
+// operators separate the simple commands of a command line, longest first
+var operators = []string{"2>&1", "&&", "||", ">>", "&>", "2>", ">&", "|", ";", "&", ">", "<"}
+
+// Split breaks a command line into words and operators the way a POSIX shell
+// would, well enough to reason about it: quotes are removed, backslashes
+// escape, and operators are words of their own. Expansions aren't performed.
+func Split(command string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	flush := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	for i := 0; i < len(command); i++ {
+		ch := command[i]
+		switch {
+		case ch == '\\' && i+1 < len(command):
+			i++
+			word.WriteByte(command[i])
+			inWord = true
+		case ch == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				end = len(command) - i - 1
+			}
+			word.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case ch == '"':
+			i++
+			for ; i < len(command) && command[i] != '"'; i++ {
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("\"\\$`", command[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(command[i])
+			}
+			inWord = true
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			flush()
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(command[i:], o) {
+					op = o
+					break
+				}
+			}
+			// 2> only redirects at the start of a word
+			if op == "" || (op[0] == '2' && inWord) {
+				word.WriteByte(ch)
+				inWord = true
+				continue
+			}
+			flush()
+			words = append(words, op)
+			i += len(op) - 1
+		}
+	}
+	flush()
+	return words
+}
+
+// isOperator reports whether a word from Split is an operator
+func isOperator(word string) bool {
+	for _, o := range operators {
+		if word == o {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+// Package sandbox runs shell commands where they can read files but not
+// change them: the filesystem is read-only apart from a scratch /tmp, and
+// there's no network unless it's allowed.
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Backends
+const (
+	Auto        = "auto"
+	Bubblewrap  = "bwrap"
+	Firejail    = "firejail"
+	SandboxExec = "sandbox-exec"
+	Docker      = "docker"
+)
+
+// DefaultImage is the image the docker backend uses unless one is configured
+const DefaultImage = "alpine:3"
+
+// Options configure a sandbox
+type Options struct {
+	// Backend is one of the backends, or Auto for the first one installed
+	Backend string
+	// Image is the docker backend's image
+	Image string
+	// Network allows network access
+	Network bool
+}
+
+// candidates are the backends Auto tries on each platform, in order
+var candidates = map[string][]string{
+	"linux":  {Bubblewrap, Firejail, Docker},
+	"darwin": {SandboxExec, Docker},
+}
+
+// Resolve returns the backend to use, checking that it's installed
+func Resolve(backend string) (string, error) {
+	if backend == "" || backend == Auto {
+		for _, candidate := range candidates[runtime.GOOS] {
+			if _, err := exec.LookPath(candidate); err == nil {
+				return candidate, nil
+			}
+		}
+		if runtime.GOOS == "windows" {
+			return "", fmt.Errorf("no sandbox is available on Windows; install Docker and set the backend to docker")
+		}
+		names := candidates[runtime.GOOS]
+		return "", fmt.Errorf("no sandbox found: install %s or %s", strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+	}
+	switch backend {
+	case Bubblewrap, Firejail, SandboxExec, Docker:
+	default:
+		return "", fmt.Errorf("unknown sandbox %q: use auto, bwrap, firejail, sandbox-exec or docker", backend)
+	}
+	if _, err := exec.LookPath(backend); err != nil {
+		return "", fmt.Errorf("%s isn't installed", backend)
+	}
+	return backend, nil
+}
+
+// Command returns a command that runs the shell command line in the sandbox,
+// in the current directory
+func Command(opts Options, command string) (*exec.Cmd, error) {
+	backend, err := Resolve(opts.Backend)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	args := Args(backend, opts, dir, command)
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// Args returns the command line that runs command with backend, in dir
+func Args(backend string, opts Options, dir, command string) []string {
+	switch backend {
+	case Bubblewrap:
+		args := []string{"bwrap", "--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp",
+			"--unshare-all", "--die-with-parent", "--chdir", dir}
+		if opts.Network {
+			args = append(args, "--share-net")
+		}
+		return append(args, "sh", "-c", command)
+	case Firejail:
+		args := []string{"firejail", "--quiet", "--noprofile", "--read-only=/", "--private-tmp"}
+		if !opts.Network {
+			args = append(args, "--net=none")
+		}
+		return append(args, "sh", "-c", command)
+	case SandboxExec:
+		return []string{"sandbox-exec", "-p", seatbeltProfile(opts), "sh", "-c", command}
+	default:
+		image := opts.Image
+		if image == "" {
+			image = DefaultImage
+		}
+		args := []string{"docker", "run", "--rm", "-i", "--read-only", "--tmpfs", "/tmp",
+			"-v", dir + ":/work:ro", "-w", "/work"}
+		if !opts.Network {
+			args = append(args, "--network", "none")
+		}
+		return append(args, image, "sh", "-c", command)
+	}
+}
+
+// seatbeltProfile is the sandbox-exec profile: anything but writing files,
+// apart from temporary ones and /dev/null
+func seatbeltProfile(opts Options) string {
+	profile := `(version 1)
+(allow default)
+(deny file-write*)
+(allow file-write* (subpath "/private/tmp") (subpath "/private/var/folders") (literal "/dev/null") (literal "/dev/tty"))`
+	if !opts.Network {
+		profile += "\n(deny network*)"
+	}
+	return profile
+}
+
+// Describe says what a command in the sandbox can't do, for the model
+func Describe(opts Options) string {
+	if opts.Network {
+		return "The filesystem is read-only apart from /tmp."
+	}
+	return "The filesystem is read-only apart from /tmp, and there's no network."
+}
@@ -0,0 +1,39 @@
+package sandbox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		backend string
+		opts    Options
+		want    string
+	}{
+		{Bubblewrap, Options{}, "bwrap --ro-bind / / --dev /dev --proc /proc --tmpfs /tmp --unshare-all --die-with-parent --chdir /src sh -c ls -l"},
+		{Bubblewrap, Options{Network: true}, "bwrap --ro-bind / / --dev /dev --proc /proc --tmpfs /tmp --unshare-all --die-with-parent --chdir /src --share-net sh -c ls -l"},
+		{Firejail, Options{}, "firejail --quiet --noprofile --read-only=/ --private-tmp --net=none sh -c ls -l"},
+		{Docker, Options{}, "docker run --rm -i --read-only --tmpfs /tmp -v /src:/work:ro -w /work --network none alpine:3 sh -c ls -l"},
+		{Docker, Options{Image: "debian:stable-slim", Network: true}, "docker run --rm -i --read-only --tmpfs /tmp -v /src:/work:ro -w /work debian:stable-slim sh -c ls -l"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(Args(tt.backend, tt.opts, "/src", "ls -l"), " "); got != tt.want {
+			t.Errorf("Args(%s, %+v) = %q, want %q", tt.backend, tt.opts, got, tt.want)
+		}
+	}
+
+	args := Args(SandboxExec, Options{}, "/src", "ls -l")
+	if args[0] != "sandbox-exec" || !strings.Contains(args[2], "(deny file-write*)") || !strings.Contains(args[2], "(deny network*)") {
+		t.Errorf("unexpected sandbox-exec args %q", args)
+	}
+	if strings.Contains(Args(SandboxExec, Options{Network: true}, "/src", "ls")[2], "network") {
+		t.Error("network should be allowed")
+	}
+}
+
+func TestResolveUnknown(t *testing.T) {
+	if _, err := Resolve("chroot"); err == nil {
+		t.Error("unknown backends should fail")
+	}
+}
@@ -0,0 +1,146 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	. "q/types"
+)
+
+// s3Sink writes each batch as a new object, keyed by day so a bucket can be
+// queried by date with Athena or read back with the AWS CLI
+type s3Sink struct {
+	bucket, region, prefix, endpoint string
+	source                           string
+	creds                            s3Credentials
+	client                           *http.Client
+}
+
+type s3Credentials struct {
+	accessKey, secretKey, sessionToken string
+}
+
+func newS3Sink(cfg *S3SinkConfig, source string, client *http.Client) (*s3Sink, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("log_sink: s3 needs a bucket")
+	}
+	creds := s3Credentials{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKey == "" || creds.secretKey == "" {
+		return nil, fmt.Errorf("log_sink: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set for s3")
+	}
+	region := cfg.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &s3Sink{
+		bucket:   cfg.Bucket,
+		region:   region,
+		prefix:   strings.Trim(cfg.Prefix, "/"),
+		endpoint: strings.TrimSuffix(cfg.Endpoint, "/"),
+		source:   source,
+		creds:    creds,
+		client:   client,
+	}, nil
+}
+
+// objectURL is where a batch sent at t goes: virtual-hosted style on AWS, or
+// path style under a custom endpoint (MinIO, R2 and the like)
+func (s *s3Sink) objectURL(t time.Time) string {
+	key := fmt.Sprintf("%s/%s-%d.jsonl", t.Format("2006/01/02"), url.PathEscape(s.source), t.UnixNano())
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	if s.endpoint != "" {
+		return s.endpoint + "/" + s.bucket + "/" + key
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.region, key)
+}
+
+func (s *s3Sink) Send(ctx context.Context, batch []byte) error {
+	now := time.Now().UTC()
+	target := s.objectURL(now)
+	return retry(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "PUT", target, bytes.NewReader(batch))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		s.creds.sign(req, batch, s.region, time.Now().UTC())
+		return req, nil
+	}, s.client)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header for S3, signing
+// the host and every header already set
+func (c s3Credentials) sign(req *http.Request, payload []byte, region string, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	day := amzDate[:8]
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), day)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
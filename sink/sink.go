@@ -0,0 +1,113 @@
+// Package sink sends logged requests to a central store, an HTTP collector
+// or an S3 bucket, so a team can track its spend in one place. The logger
+// queues records and decides when to send them; a sink only delivers a batch.
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"q/logger"
+	. "q/types"
+)
+
+// attempts is how many times a batch is sent before giving up until the next
+// run; the logger backs off between runs
+const attempts = 3
+
+// New returns the sink described by cfg
+func New(cfg *LogSinkConfig) (logger.Sink, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	switch {
+	case cfg.URL != "" && cfg.S3 != nil:
+		return nil, fmt.Errorf("log_sink: set url or s3, not both")
+	case cfg.URL != "":
+		token := ""
+		if cfg.AuthEnvVar != "" {
+			if token = os.Getenv(cfg.AuthEnvVar); token == "" {
+				return nil, fmt.Errorf("log_sink: %s is not set", cfg.AuthEnvVar)
+			}
+		}
+		return &httpSink{url: cfg.URL, token: token, client: client}, nil
+	case cfg.S3 != nil:
+		return newS3Sink(cfg.S3, Source(cfg), client)
+	}
+	return nil, fmt.Errorf("log_sink: set url or s3")
+}
+
+// Source is how records from this machine are labeled: the configured source,
+// or user@host
+func Source(cfg *LogSinkConfig) string {
+	if cfg.Source != "" {
+		return cfg.Source
+	}
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
+
+// httpSink POSTs each batch as JSON Lines
+type httpSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (s *httpSink) Send(ctx context.Context, batch []byte) error {
+	return retry(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(batch))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		if s.token != "" {
+			req.Header.Set("Authorization", "Bearer "+s.token)
+		}
+		return req, nil
+	}, s.client)
+}
+
+// retry sends the request newRequest builds, trying again after a connection
+// failure, a 429 or a 5xx, until it succeeds, attempts run out, or ctx is done
+func retry(ctx context.Context, newRequest func() (*http.Request, error), client *http.Client) error {
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return lastErr
+			case <-time.After(time.Duration(i) * time.Second):
+			}
+		}
+		req, err := newRequest()
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		lastErr = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return lastErr
+		}
+	}
+	return lastErr
+}
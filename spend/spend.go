@@ -0,0 +1,140 @@
+// Package spend keeps today's estimated spend in a small env file next to
+// the logs, rewritten after each logged request, so a shell prompt can show
+// it without opening the database: `q spend --today` shows it in about the
+// time q takes to start, and powerlevel10k or starship can source it directly.
+package spend
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"q/workspace"
+)
+
+// FileName is the env file's name in the workspace directory
+const FileName = "spend.env"
+
+// dayFormat is how days are written: the local date, as `date +%F` prints it
+const dayFormat = "2006-01-02"
+
+// Totals is what was spent on a day
+type Totals struct {
+	// Day is the local date the totals are for
+	Day      string
+	Requests int
+	Cost     float64
+}
+
+// Path is where the selected workspace's env file is
+func Path() (string, error) {
+	dir, err := workspace.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FileName), nil
+}
+
+// Day is the date now falls on, as Totals.Day is written
+func Day(now time.Time) string {
+	return now.Local().Format(dayFormat)
+}
+
+// Midnight is when the local day now falls on started
+func Midnight(now time.Time) time.Time {
+	now = now.Local()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// On returns the totals if they're for the day now falls on, or none spent
+// that day: the file is only rewritten when a request is logged, so totals
+// of an earlier day mean nothing was spent since
+func (t Totals) On(now time.Time) Totals {
+	if day := Day(now); t.Day != day {
+		return Totals{Day: day}
+	}
+	return t
+}
+
+// Short is the cost as a prompt shows it: "$0.42", "$12", or "<$0.01" for
+// less than a cent but more than nothing
+func Short(cost float64) string {
+	switch {
+	case cost <= 0:
+		return "$0"
+	case cost < 0.01:
+		return "<$0.01"
+	case cost < 10:
+		return fmt.Sprintf("$%.2f", cost)
+	default:
+		return fmt.Sprintf("$%.0f", cost)
+	}
+}
+
+// Env is the totals as the env file holds them
+func (t Totals) Env() string {
+	return fmt.Sprintf("# Today's estimated LLM spend, written by q after each request\n"+
+		"Q_SPEND_DAY=%s\nQ_SPEND_REQUESTS=%d\nQ_SPEND_TODAY=%.4f\nQ_SPEND_TODAY_SHORT='%s'\n",
+		t.Day, t.Requests, t.Cost, Short(t.Cost))
+}
+
+// Write replaces the env file at path with t. It's written to a temporary
+// file first, so a prompt reading it never sees half of it.
+func Write(path string, t Totals) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), FileName+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(t.Env()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Read reads the env file at path
+func Read(path string) (Totals, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Totals{}, err
+	}
+	defer f.Close()
+	var t Totals
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		eq := strings.Index(line, "=")
+		if strings.HasPrefix(line, "#") || eq < 0 {
+			continue
+		}
+		value := line[eq+1:]
+		switch line[:eq] {
+		case "Q_SPEND_DAY":
+			t.Day = value
+		case "Q_SPEND_REQUESTS":
+			t.Requests, _ = strconv.Atoi(value)
+		case "Q_SPEND_TODAY":
+			t.Cost, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Totals{}, err
+	}
+	if t.Day == "" {
+		return Totals{}, fmt.Errorf("%s has no Q_SPEND_DAY", path)
+	}
+	return t, nil
+}
@@ -0,0 +1,50 @@
+package spend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShort(t *testing.T) {
+	for cost, want := range map[float64]string{0: "$0", 0.004: "<$0.01", 0.42: "$0.42", 3.456: "$3.46", 12.6: "$13"} {
+		if got := Short(cost); got != want {
+			t.Errorf("Short(%v) = %q, want %q", cost, got, want)
+		}
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	want := Totals{Day: "2024-05-01", Requests: 12, Cost: 0.4213}
+	if err := Write(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(path)
+	if err != nil || got != want {
+		t.Errorf("Read = %+v, %v; want %+v", got, err, want)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Write should leave only the env file, found %d files", len(entries))
+	}
+
+	if err := os.WriteFile(path, []byte("# nothing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); err == nil {
+		t.Error("Read of a file without Q_SPEND_DAY should fail")
+	}
+}
+
+func TestOn(t *testing.T) {
+	now := time.Date(2024, 5, 2, 9, 0, 0, 0, time.Local)
+	yesterday := Totals{Day: "2024-05-01", Requests: 3, Cost: 1.5}
+	if got := yesterday.On(now); got != (Totals{Day: "2024-05-02"}) {
+		t.Errorf("totals of an earlier day should count as none spent today, got %+v", got)
+	}
+	today := Totals{Day: "2024-05-02", Requests: 3, Cost: 1.5}
+	if got := today.On(now); got != today {
+		t.Errorf("On = %+v, want %+v", got, today)
+	}
+}
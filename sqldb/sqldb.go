@@ -0,0 +1,359 @@
+// Package sqldb connects to PostgreSQL, MySQL and SQLite databases to describe
+// their schema and run read-only queries.
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Dialects, named after their database/sql drivers
+const (
+	Postgres = "postgres"
+	MySQL    = "mysql"
+	SQLite   = "sqlite3"
+)
+
+// DB is an open database and its dialect
+type DB struct {
+	*sql.DB
+	Dialect string
+}
+
+// Open connects to a database URL: postgres://, mysql:// or sqlite://, or
+// the path of an SQLite file. SQLite files are opened read-only.
+func Open(dsn string) (*DB, error) {
+	dialect, source, err := driverSource(dsn)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(dialect, source)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	return &DB{DB: db, Dialect: dialect}, nil
+}
+
+// driverSource picks the driver for dsn and converts it to that driver's format
+func driverSource(dsn string) (dialect, source string, err error) {
+	scheme := ""
+	if i := strings.Index(dsn, "://"); i > 0 {
+		scheme = strings.ToLower(dsn[:i])
+	}
+	switch scheme {
+	case "postgres", "postgresql":
+		return Postgres, dsn, nil
+	case "mysql":
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", "", err
+		}
+		config := mysql.NewConfig()
+		config.Net = "tcp"
+		config.Addr = u.Host
+		if u.Port() == "" {
+			config.Addr += ":3306"
+		}
+		config.User = u.User.Username()
+		config.Passwd, _ = u.User.Password()
+		config.DBName = strings.TrimPrefix(u.Path, "/")
+		return MySQL, config.FormatDSN(), nil
+	case "sqlite", "sqlite3", "file":
+		dsn = dsn[len(scheme)+3:]
+	case "":
+	default:
+		return "", "", fmt.Errorf("unsupported database %s://: use postgres://, mysql:// or an SQLite file", scheme)
+	}
+	if _, err := os.Stat(dsn); err != nil {
+		return "", "", err
+	}
+	return SQLite, "file:" + dsn + "?mode=ro&_query_only=1", nil
+}
+
+// Column is a column of a table
+type Column struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+// Table is a table or view and its columns
+type Table struct {
+	Name    string
+	Columns []Column
+}
+
+// Tables lists the tables and views with their columns. Outside the default
+// schema, PostgreSQL names are qualified with their schema.
+func (db *DB) Tables() ([]Table, error) {
+	var query string
+	switch db.Dialect {
+	case Postgres:
+		query = `SELECT CASE WHEN table_schema = current_schema() THEN table_name ELSE table_schema || '.' || table_name END,
+			column_name, data_type, is_nullable = 'YES'
+			FROM information_schema.columns
+			WHERE table_schema NOT IN ('pg_catalog', 'information_schema')
+			ORDER BY table_schema, table_name, ordinal_position`
+	case MySQL:
+		query = `SELECT table_name, column_name, column_type, is_nullable = 'YES'
+			FROM information_schema.columns
+			WHERE table_schema = DATABASE()
+			ORDER BY table_name, ordinal_position`
+	default:
+		query = `SELECT m.name, p.name, p.type, p."notnull" = 0
+			FROM sqlite_master m JOIN pragma_table_info(m.name) p
+			WHERE m.type IN ('table', 'view') AND m.name NOT LIKE 'sqlite_%'
+			ORDER BY m.name, p.cid`
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []Table
+	for rows.Next() {
+		var table string
+		var column Column
+		if err := rows.Scan(&table, &column.Name, &column.Type, &column.Nullable); err != nil {
+			return nil, err
+		}
+		if len(tables) == 0 || tables[len(tables)-1].Name != table {
+			tables = append(tables, Table{Name: table})
+		}
+		last := &tables[len(tables)-1]
+		last.Columns = append(last.Columns, column)
+	}
+	return tables, rows.Err()
+}
+
+// Describe writes tables compactly for a prompt, one per line
+func Describe(tables []Table) string {
+	var b strings.Builder
+	for _, table := range tables {
+		var columns []string
+		for _, column := range table.Columns {
+			c := column.Name + " " + strings.ToLower(column.Type)
+			if !column.Nullable {
+				c += " not null"
+			}
+			columns = append(columns, c)
+		}
+		fmt.Fprintf(&b, "%s(%s)\n", table.Name, strings.Join(columns, ", "))
+	}
+	return b.String()
+}
+
+// readOnlyStatements are the statements a read-only query may start with
+var readOnlyStatements = []string{"select", "with", "explain", "show", "describe", "desc", "values", "table"}
+
+// CheckReadOnly reports an error unless query, in dialect, is a single
+// statement that only reads. It's a first line of defense; queries also run
+// as a single prepared statement in a read-only transaction.
+func CheckReadOnly(dialect, query string) error {
+	query = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+	if hasSemicolon(dialect, query) {
+		return fmt.Errorf("only a single statement can be run")
+	}
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) > 0 {
+		first := strings.TrimLeft(words[0], "(")
+		for _, statement := range readOnlyStatements {
+			if first == statement {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("only queries that read can be run, such as SELECT")
+}
+
+// hasSemicolon reports whether query has a semicolon outside the quotes and
+// comments of dialect. Where it can't tell, it errs towards finding one.
+func hasSemicolon(dialect, query string) bool {
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			// MySQL escapes quotes in strings with backslashes, and PostgreSQL
+			// in E'...' strings
+			escapes := dialect == MySQL && ch != '`' ||
+				dialect == Postgres && ch == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') && (i == 1 || !isIdentChar(query[i-2]))
+			end := closingQuote(query, i+1, ch, escapes)
+			if end < 0 {
+				// An unterminated string is a syntax error
+				return false
+			}
+			i = end
+		case ch == '[' && dialect == SQLite:
+			end := strings.IndexByte(query[i:], ']')
+			if end < 0 {
+				return false
+			}
+			i += end
+		case ch == '$' && dialect == Postgres && (i == 0 || !isIdentChar(query[i-1])):
+			tag := dollarTag(query[i:])
+			if tag == "" {
+				continue
+			}
+			end := strings.Index(query[i+len(tag):], tag)
+			if end < 0 {
+				return false
+			}
+			i += len(tag) + end + len(tag) - 1
+		case strings.HasPrefix(query[i:], "--") && (dialect != MySQL || i+2 == len(query) || query[i+2] <= ' '),
+			ch == '#' && dialect == MySQL:
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return false
+			}
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			// MySQL runs what's in /*! ... */, and PostgreSQL nests comments
+			if dialect == MySQL && (strings.HasPrefix(query[i:], "/*!") || strings.HasPrefix(query[i:], "/*+")) {
+				i++
+				continue
+			}
+			end := commentEnd(query, i, dialect == Postgres)
+			if end < 0 {
+				return false
+			}
+			i = end
+		case ch == ';':
+			return true
+		}
+	}
+	return false
+}
+
+// closingQuote is where the quote that opened a string or identifier before
+// from closes, or -1. A doubled quote reads as a closing quote and an opening
+// one, which comes to the same.
+func closingQuote(query string, from int, quote byte, escapes bool) int {
+	for j := from; j < len(query); j++ {
+		switch {
+		case escapes && query[j] == '\\':
+			j++
+		case query[j] == quote:
+			return j
+		}
+	}
+	return -1
+}
+
+// commentEnd is the index of the last character of the block comment starting
+// at from, or -1 if it doesn't end
+func commentEnd(query string, from int, nested bool) int {
+	depth := 0
+	for j := from; j+1 < len(query); j++ {
+		switch {
+		case query[j] == '/' && query[j+1] == '*' && (nested || depth == 0):
+			depth++
+			j++
+		case query[j] == '*' && query[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// dollarTag is the $tag$ that opens a PostgreSQL dollar-quoted string at the
+// start of s, or ""
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		switch {
+		case s[j] == '$':
+			return s[:j+1]
+		case !isIdentChar(s[j]) || j == 1 && s[j] >= '0' && s[j] <= '9':
+			// $1 is a parameter
+			return ""
+		}
+	}
+	return ""
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || ch == '$' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch >= 0x80
+}
+
+// Result is the outcome of a query
+type Result struct {
+	Columns []string
+	Rows    [][]string
+	// More is set when rows beyond the limit were left out
+	More bool
+}
+
+// ReadOnlyQuery runs a query in a read-only transaction, returning up to
+// limit rows as text. NULLs are shown as NULL.
+func (db *DB) ReadOnlyQuery(ctx context.Context, query string, limit int) (*Result, error) {
+	if err := CheckReadOnly(db.Dialect, query); err != nil {
+		return nil, err
+	}
+	return db.readOnly(ctx, query, limit)
+}
+
+// readOnly runs a query that passed CheckReadOnly. It's prepared first: a
+// prepared statement is a single statement, so whatever the check missed
+// can't end the transaction and run more (PostgreSQL and MySQL reject
+// several, and SQLite only prepares the first).
+func (db *DB) readOnly(ctx context.Context, query string, limit int) (*Result, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &Result{}
+	if result.Columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+	values := make([]sql.NullString, len(result.Columns))
+	pointers := make([]interface{}, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if len(result.Rows) == limit {
+			result.More = true
+			break
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(values))
+		for i, value := range values {
+			row[i] = "NULL"
+			if value.Valid {
+				row[i] = value.String
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
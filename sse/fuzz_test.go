@@ -0,0 +1,32 @@
+//go:build go1.18
+// +build go1.18
+
+package sse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// FuzzReader checks that any input parses without panicking, and to the same
+// events whether it arrives all at once or one byte at a time
+func FuzzReader(f *testing.F) {
+	for _, tt := range streamTests {
+		f.Add(tt.stream)
+	}
+	f.Fuzz(func(t *testing.T, stream string) {
+		whole, err := readAll(strings.NewReader(stream), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		bytewise, err := readAll(iotest.OneByteReader(strings.NewReader(stream)), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(whole, bytewise) {
+			t.Errorf("%q: whole %+v, bytewise %+v", stream, whole, bytewise)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+// Package sse reads Server-Sent Events streams, the format chat completion
+// APIs stream their answers in. It follows the WHATWG event stream spec:
+// lines may end in CRLF, LF or CR, an event may span several data lines and
+// reads, and comments and unknown fields are skipped.
+package sse
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Event is one dispatched event
+type Event struct {
+	// Type is the event: field, empty for the default "message" type
+	Type string
+	// ID is the last event ID seen in the stream, which carries over to
+	// later events that don't set their own
+	ID string
+	// Data is the event's data lines joined with newlines
+	Data string
+	// Retry is the reconnection time in milliseconds, if the event set one
+	Retry int
+}
+
+// Reader reads events from a stream
+type Reader struct {
+	r      *bufio.Reader
+	line   []byte
+	lastID string
+	// started is set once the first line is read, which may start with a BOM
+	started bool
+	// skipLF is set after a CR, whose LF (if any) belongs to the same line ending
+	skipLF bool
+
+	// Unknown, if set, is called with each line whose field isn't one of
+	// data, event, id or retry. Such lines are otherwise ignored.
+	Unknown func(line string)
+}
+
+// NewReader returns a Reader reading events from r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next event. At the end of the stream it returns io.EOF,
+// after dispatching a last event even if the stream ended without the blank
+// line that should follow it. Other read errors are returned as they are,
+// and a partly read event is dropped.
+func (r *Reader) Next() (Event, error) {
+	var event Event
+	var data strings.Builder
+	hasData := false
+	for {
+		line, err := r.readLine()
+		if err != nil && err != io.EOF {
+			return Event{}, err
+		}
+		if line == "" {
+			if hasData {
+				return r.dispatch(event, data.String()), nil
+			}
+			if err == io.EOF {
+				return Event{}, io.EOF
+			}
+			// A blank line with no data before it ends an empty event, which is dropped
+			event = Event{}
+			continue
+		}
+
+		if line[0] != ':' {
+			field, value := line, ""
+			if i := strings.IndexByte(line, ':'); i >= 0 {
+				field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+			}
+			switch field {
+			case "data":
+				if hasData {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+				hasData = true
+			case "event":
+				event.Type = value
+			case "id":
+				if !strings.ContainsRune(value, 0) {
+					r.lastID = value
+				}
+			case "retry":
+				if retry, err := strconv.Atoi(value); err == nil && retry >= 0 {
+					event.Retry = retry
+				}
+			default:
+				if r.Unknown != nil {
+					r.Unknown(line)
+				}
+			}
+		}
+
+		if err == io.EOF {
+			if hasData {
+				return r.dispatch(event, data.String()), nil
+			}
+			return Event{}, io.EOF
+		}
+	}
+}
+
+func (r *Reader) dispatch(event Event, data string) Event {
+	event.ID = r.lastID
+	event.Data = data
+	return event
+}
+
+// readLine returns the next line without its ending: CRLF, LF or a lone CR.
+// At the end of the stream it returns the unterminated last line, if any,
+// with io.EOF. It never waits for more input once a line has ended.
+func (r *Reader) readLine() (string, error) {
+	r.line = r.line[:0]
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return r.text(), io.EOF
+			}
+			return "", err
+		}
+		if r.skipLF {
+			r.skipLF = false
+			if b == '\n' {
+				continue
+			}
+		}
+		switch b {
+		case '\n':
+			return r.text(), nil
+		case '\r':
+			r.skipLF = true
+			return r.text(), nil
+		}
+		r.line = append(r.line, b)
+	}
+}
+
+// text returns the line read so far, without the byte order mark a stream may start with
+func (r *Reader) text() string {
+	line := string(r.line)
+	if !r.started {
+		r.started = true
+		line = strings.TrimPrefix(line, "\uFEFF")
+	}
+	return line
+}
@@ -0,0 +1,170 @@
+package sse
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// readAll returns every event in a stream and the error that ended it
+func readAll(r io.Reader, unknown func(string)) ([]Event, error) {
+	reader := NewReader(r)
+	reader.Unknown = unknown
+	var events []Event
+	for {
+		event, err := reader.Next()
+		if err != nil {
+			if err == io.EOF {
+				return events, nil
+			}
+			return events, err
+		}
+		events = append(events, event)
+	}
+}
+
+var streamTests = []struct {
+	name   string
+	stream string
+	want   []Event
+}{
+	{
+		name:   "openai",
+		stream: "data: {\"a\":1}\n\ndata: {\"a\":2}\n\ndata: [DONE]\n\n",
+		want:   []Event{{Data: `{"a":1}`}, {Data: `{"a":2}`}, {Data: "[DONE]"}},
+	},
+	{
+		name:   "crlf",
+		stream: "data: one\r\n\r\ndata: two\r\n\r\n",
+		want:   []Event{{Data: "one"}, {Data: "two"}},
+	},
+	{
+		name:   "lone cr",
+		stream: "data: one\r\rdata: two\r\r",
+		want:   []Event{{Data: "one"}, {Data: "two"}},
+	},
+	{
+		name:   "multi-line data",
+		stream: "data: first\ndata: second\ndata\n\n",
+		want:   []Event{{Data: "first\nsecond\n"}},
+	},
+	{
+		name:   "fields and comments",
+		stream: ": keep-alive\nevent: delta\nid: 7\nretry: 3000\ndata: x\n\n: ping\n\ndata: y\n\n",
+		want:   []Event{{Type: "delta", ID: "7", Data: "x", Retry: 3000}, {ID: "7", Data: "y"}},
+	},
+	{
+		name:   "no space after colon",
+		stream: "data:tight\ndata:  two spaces\n\n",
+		want:   []Event{{Data: "tight\n two spaces"}},
+	},
+	{
+		name:   "event without data is dropped",
+		stream: "event: ping\n\ndata: x\n\n",
+		want:   []Event{{Data: "x"}},
+	},
+	{
+		name:   "missing final blank line",
+		stream: "data: one\n\ndata: last",
+		want:   []Event{{Data: "one"}, {Data: "last"}},
+	},
+	{
+		name:   "byte order mark",
+		stream: "\uFEFFdata: x\n\n",
+		want:   []Event{{Data: "x"}},
+	},
+	{
+		name:   "invalid retry and id with NUL are ignored",
+		stream: "id: 1\ndata: a\n\nid: 2\x00\nretry: soon\ndata: b\n\n",
+		want:   []Event{{ID: "1", Data: "a"}, {ID: "1", Data: "b"}},
+	},
+	{
+		name:   "empty stream",
+		stream: "",
+		want:   nil,
+	},
+}
+
+func TestReader(t *testing.T) {
+	for _, tt := range streamTests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := readAll(strings.NewReader(tt.stream), nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(events, tt.want) {
+				t.Errorf("got %+v, want %+v", events, tt.want)
+			}
+		})
+	}
+}
+
+// splitReader returns its data in reads of random sizes, as a network would
+type splitReader struct {
+	data string
+	rnd  *rand.Rand
+}
+
+func (s *splitReader) Read(p []byte) (int, error) {
+	if len(s.data) == 0 {
+		return 0, io.EOF
+	}
+	n := 1 + s.rnd.Intn(len(s.data))
+	if n > len(p) {
+		n = len(p)
+	}
+	copy(p, s.data[:n])
+	s.data = s.data[n:]
+	return n, nil
+}
+
+func TestReaderSplitReads(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, tt := range streamTests {
+		for i := 0; i < 50; i++ {
+			events, err := readAll(&splitReader{data: tt.stream, rnd: rnd}, nil)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			if !reflect.DeepEqual(events, tt.want) {
+				t.Fatalf("%s: with split reads got %+v, want %+v", tt.name, events, tt.want)
+			}
+		}
+		events, err := readAll(iotest.OneByteReader(strings.NewReader(tt.stream)), nil)
+		if err != nil || !reflect.DeepEqual(events, tt.want) {
+			t.Errorf("%s: one byte at a time got %+v, %v; want %+v", tt.name, events, err, tt.want)
+		}
+	}
+}
+
+func TestReaderUnknownLines(t *testing.T) {
+	var unknown []string
+	events, err := readAll(strings.NewReader("what is this\ndata: x\nfoo: bar\n\n"), func(line string) {
+		unknown = append(unknown, line)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []Event{{Data: "x"}}; !reflect.DeepEqual(events, want) {
+		t.Errorf("got %+v, want %+v", events, want)
+	}
+	if want := []string{"what is this", "foo: bar"}; !reflect.DeepEqual(unknown, want) {
+		t.Errorf("unknown lines = %q, want %q", unknown, want)
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	broken := errors.New("connection reset")
+	r := io.MultiReader(strings.NewReader("data: one\n\ndata: partial"), iotest.ErrReader(broken))
+	events, err := readAll(r, nil)
+	if err != broken {
+		t.Errorf("err = %v, want %v", err, broken)
+	}
+	if want := []Event{{Data: "one"}}; !reflect.DeepEqual(events, want) {
+		t.Errorf("got %+v, want only the complete event %+v", events, want)
+	}
+}
@@ -0,0 +1,153 @@
+// Package sysprompt builds a model's system prompt from sections: its
+// persona, the user's environment, the facts remembered for them and safety
+// rules. Each section is a Go template, built in or from the config, and can
+// be switched off on its own.
+package sysprompt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+
+	. "q/types"
+)
+
+// The built-in sections
+const (
+	SectionPersona     = "persona"
+	SectionEnvironment = "environment"
+	SectionMemory      = "memory"
+	SectionSafety      = "safety"
+)
+
+// Builtins are the templates of the built-in sections, and Names the
+// sections in the order they usually go
+var (
+	Builtins = map[string]string{
+		SectionPersona:     `{{.Persona}}`,
+		SectionEnvironment: `The user is on {{os}} ({{arch}}) using {{shell}}, in the directory {{cwd}}. Today is {{date}}. Write commands that work there.{{with .PackageManager}} {{.}}{{end}}`,
+		SectionMemory:      `{{.Memory}}`,
+		SectionSafety:      `Point out any command that deletes data, overwrites files, changes permissions or system settings, or can't be undone, before the code block, with a safer alternative if there is one. Never pipe a download straight into a shell.`,
+	}
+	Names = []string{SectionPersona, SectionEnvironment, SectionMemory, SectionSafety}
+)
+
+// Data is what the templates are rendered with
+type Data struct {
+	// Persona is the model's or the persona's own system prompt
+	Persona string
+	// Memory is the remembered facts as an instruction, or ""
+	Memory string
+	// PackageManager is an instruction to install software with the user's
+	// package manager, or ""
+	PackageManager string
+	// Model is the name of the model the prompt is for
+	Model string
+}
+
+// funcs are the functions the templates can use besides the standard ones
+var funcs = template.FuncMap{
+	"env": os.Getenv,
+	"default": func(fallback, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+	"os":    osName,
+	"arch":  func() string { return runtime.GOARCH },
+	"shell": shellName,
+	"cwd": func() string {
+		dir, _ := os.Getwd()
+		return dir
+	},
+	"hostname": func() string {
+		name, _ := os.Hostname()
+		return name
+	},
+	"user": func() string {
+		if u, err := user.Current(); err == nil {
+			return u.Username
+		}
+		return os.Getenv("USER")
+	},
+	"date":  func() string { return time.Now().Format("2006-01-02") },
+	"now":   func(layout string) string { return time.Now().Format(layout) },
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// osName is the name people know the operating system by
+func osName() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "macOS"
+	case "linux":
+		return "Linux"
+	case "windows":
+		return "Windows"
+	case "freebsd":
+		return "FreeBSD"
+	}
+	return runtime.GOOS
+}
+
+// shellName is the user's shell, from $SHELL, or PowerShell on Windows
+// where that's not set
+func shellName() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return filepath.Base(shell)
+	}
+	if runtime.GOOS == "windows" {
+		return "PowerShell"
+	}
+	return "sh"
+}
+
+// Parse reads a section's template: its own, or the built-in one for its name
+func Parse(section PromptSection) (*template.Template, error) {
+	text := section.Template
+	if text == "" {
+		builtin, ok := Builtins[section.Section]
+		if !ok {
+			return nil, fmt.Errorf("section %q has no template, and isn't one of %s", section.Section, strings.Join(Names, ", "))
+		}
+		text = builtin
+	}
+	tmpl, err := template.New(section.Section).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("section %q: %w", section.Section, err)
+	}
+	return tmpl, nil
+}
+
+// Build renders the sections in order and joins them with blank lines,
+// leaving out those switched off and those that come out empty, like the
+// memory section when nothing is remembered
+func Build(sections []PromptSection, data Data) (string, error) {
+	var parts []string
+	for _, section := range sections {
+		if section.Disabled {
+			continue
+		}
+		tmpl, err := Parse(section)
+		if err != nil {
+			return "", err
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return "", fmt.Errorf("section %q: %w", section.Section, err)
+		}
+		if text := strings.TrimSpace(out.String()); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
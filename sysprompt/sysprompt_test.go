@@ -0,0 +1,64 @@
+package sysprompt
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	. "q/types"
+)
+
+func TestBuild(t *testing.T) {
+	t.Setenv("SHELL", "/usr/bin/fish")
+	t.Setenv("Q_TEST_TEAM", "")
+	sections := []PromptSection{
+		{Section: SectionPersona},
+		{Section: SectionEnvironment, Template: "{{os}} {{shell}}"},
+		{Section: SectionMemory},
+		{Section: SectionSafety, Disabled: true},
+		{Section: "team", Template: `Deploy with {{env "Q_TEST_TEAM" | default "kubectl"}} to {{.Model | upper}}.`},
+	}
+	got, err := Build(sections, Data{Persona: "You are a terminal assistant.", Model: "gpt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "You are a terminal assistant.\n\n" + osName() + " fish\n\nDeploy with kubectl to GPT."
+	if got != want {
+		t.Errorf("Build =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestBuildBuiltins(t *testing.T) {
+	var sections []PromptSection
+	for _, name := range Names {
+		sections = append(sections, PromptSection{Section: name})
+	}
+	got, err := Build(sections, Data{Persona: "Be brief.", Memory: "Facts: uses zsh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(got, "\n\n")
+	if len(parts) != 4 || parts[0] != "Be brief." || parts[2] != "Facts: uses zsh" || !strings.Contains(parts[1], runtime.GOARCH) {
+		t.Errorf("Build = %q", got)
+	}
+	if !strings.HasSuffix(parts[1], "work there.") {
+		t.Errorf("the environment section should end as it did with no package manager, got %q", parts[1])
+	}
+
+	got, err = Build(sections[1:2], Data{PackageManager: "Install software with apt."})
+	if err != nil || !strings.HasSuffix(got, "work there. Install software with apt.") {
+		t.Errorf("Build with a package manager = %q, %v", got, err)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	for _, section := range []PromptSection{
+		{Section: "team"},
+		{Section: "team", Template: "{{if}}"},
+		{Section: "team", Template: "{{.Nope}}"},
+	} {
+		if _, err := Build([]PromptSection{section}, Data{}); err == nil || !strings.Contains(err.Error(), `"team"`) {
+			t.Errorf("Build(%+v) err = %v", section, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package theme
+
+import (
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/formatters"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// codeBlock is a fenced code block found by splitCode
+type codeBlock struct {
+	// fence is the opening line, and closing the closing one ("" while the block is still open)
+	fence, closing string
+	lang           string
+	code           string
+}
+
+// splitCode splits markdown into the text between fenced code blocks and the blocks
+// themselves; text[i] comes before blocks[i], and text has one more element
+func splitCode(markdown string) (text []string, blocks []codeBlock) {
+	var current []string
+	var block *codeBlock
+	var code []string
+	for _, line := range strings.SplitAfter(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case block == nil && strings.HasPrefix(trimmed, "```"):
+			text = append(text, strings.Join(current, ""))
+			current = nil
+			block = &codeBlock{fence: line, lang: strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))}
+		case block != nil && trimmed == "```":
+			block.code, block.closing = strings.Join(code, ""), line
+			blocks = append(blocks, *block)
+			block, code = nil, nil
+		case block != nil:
+			code = append(code, line)
+		default:
+			current = append(current, line)
+		}
+	}
+	if block != nil {
+		block.code = strings.Join(code, "")
+		blocks = append(blocks, *block)
+	}
+	return append(text, strings.Join(current, "")), blocks
+}
+
+// lexer returns the lexer for a block: the one its fence names, or else the
+// one chroma detects from the code, as glamour does for answers
+func (b codeBlock) lexer() chroma.Lexer {
+	var lexer chroma.Lexer
+	if b.lang != "" {
+		lexer = lexers.Get(b.lang)
+	}
+	if lexer == nil {
+		lexer = lexers.Analyse(b.code)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	return lexer
+}
+
+// HighlightCode colors the code in the fenced blocks of markdown by language,
+// in the theme's code style, leaving the rest as it is. Like lipgloss styles,
+// it leaves the code plain when output isn't going to a color terminal.
+func HighlightCode(markdown string) string {
+	style, ok := styles.Registry[current.Code]
+	if !ok {
+		return markdown
+	}
+	var formatter chroma.Formatter
+	switch lipgloss.ColorProfile() {
+	case termenv.TrueColor:
+		formatter = formatters.Get("terminal16m")
+	case termenv.ANSI256:
+		formatter = formatters.Get("terminal256")
+	case termenv.ANSI:
+		formatter = formatters.Get("terminal")
+	default:
+		return markdown
+	}
+	text, blocks := splitCode(markdown)
+	var b strings.Builder
+	for i, block := range blocks {
+		b.WriteString(text[i])
+		b.WriteString(block.fence)
+		var highlighted strings.Builder
+		iterator, err := chroma.Coalesce(block.lexer()).Tokenise(nil, block.code)
+		if err == nil {
+			err = formatter.Format(&highlighted, style, iterator)
+		}
+		if err != nil {
+			b.WriteString(block.code)
+		} else {
+			b.WriteString(highlighted.String())
+		}
+		b.WriteString(block.closing)
+	}
+	b.WriteString(text[len(text)-1])
+	return b.String()
+}
@@ -0,0 +1,39 @@
+package theme
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+
+	. "q/types"
+)
+
+func TestHighlightCode(t *testing.T) {
+	defer func(saved Theme) { current = saved }(current)
+	defer lipgloss.SetColorProfile(lipgloss.ColorProfile())
+	lipgloss.SetColorProfile(termenv.ANSI256)
+
+	markdown := "Use:\n```bash\necho hi\n```\ndone"
+	current = builtin["dark"]
+	got := HighlightCode(markdown)
+	if !strings.HasPrefix(got, "Use:\n```bash\n") || !strings.HasSuffix(got, "```\ndone") {
+		t.Errorf("the text around the code should be left as it is, got %q", got)
+	}
+	if !strings.Contains(got, "\x1b[") || visible(got) != markdown {
+		t.Errorf("the code should be colored without changing its text, got %q", got)
+	}
+
+	// Blocks without a language are detected
+	untagged := strings.TrimPrefix(HighlightCode("```\n#!/bin/bash\necho hi\n```"), "```")
+	tagged := strings.TrimPrefix(HighlightCode("```bash\n#!/bin/bash\necho hi\n```"), "```bash")
+	if untagged != tagged {
+		t.Errorf("an untagged shell script should be highlighted as bash, got %q", untagged)
+	}
+
+	current = builtin["mono"]
+	if got := HighlightCode(markdown); got != markdown {
+		t.Errorf("mono shouldn't highlight anything, got %q", got)
+	}
+}
@@ -0,0 +1,157 @@
+package theme
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	. "q/types"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Auto picks the dark or light theme from the terminal's background color
+const Auto = "auto"
+
+// builtin are the themes available without any configuration
+var builtin = map[string]Theme{
+	"dark": {
+		Accent:    "12",
+		Muted:     "8",
+		Error:     "9",
+		Success:   "10",
+		Info:      "14",
+		Highlight: "205",
+		Markdown:  "dark",
+		Code:      "monokai",
+	},
+	"light": {
+		Accent:    "4",
+		Muted:     "243",
+		Error:     "1",
+		Success:   "2",
+		Info:      "6",
+		Highlight: "162",
+		Markdown:  "light",
+		Code:      "github",
+	},
+	// mono has no colors at all; emphasis comes from bold and faint text only
+	"mono": {
+		Markdown: "notty",
+	},
+}
+
+// current is the active theme; dark until Load is called
+var current = builtin["dark"]
+
+// Load makes the named theme active. An empty name or "auto" picks dark or
+// light from the terminal background, and NO_COLOR always selects mono.
+// Themes from the config may extend a built-in one through their base.
+func Load(name string, custom map[string]Theme) error {
+	if os.Getenv("NO_COLOR") != "" {
+		current = builtin["mono"]
+		return nil
+	}
+	if name == "" || name == Auto {
+		current = builtin["dark"]
+		if !lipgloss.HasDarkBackground() {
+			current = builtin["light"]
+		}
+		// Let glamour detect the background (and plain output) itself
+		current.Markdown = ""
+		return nil
+	}
+
+	if theme, ok := custom[name]; ok {
+		baseName := theme.Base
+		if baseName == "" {
+			baseName = "dark"
+		}
+		base, ok := builtin[baseName]
+		if !ok {
+			return fmt.Errorf("theme %s: unknown base %q (use %s)", name, baseName, builtinNames())
+		}
+		current = merge(base, theme)
+		return nil
+	}
+	if theme, ok := builtin[name]; ok {
+		current = theme
+		return nil
+	}
+	return fmt.Errorf("unknown theme %q (use auto, %s, or one under themes in your config)", name, builtinNames())
+}
+
+// merge fills the colors a theme leaves unset from its base
+func merge(base, theme Theme) Theme {
+	pick := func(value, fallback string) string {
+		if value != "" {
+			return value
+		}
+		return fallback
+	}
+	return Theme{
+		Accent:    pick(theme.Accent, base.Accent),
+		Muted:     pick(theme.Muted, base.Muted),
+		Error:     pick(theme.Error, base.Error),
+		Success:   pick(theme.Success, base.Success),
+		Info:      pick(theme.Info, base.Info),
+		Highlight: pick(theme.Highlight, base.Highlight),
+		Markdown:  pick(theme.Markdown, base.Markdown),
+		Code:      pick(theme.Code, base.Code),
+	}
+}
+
+// Known reports whether Load accepts name, given the themes in the config
+func Known(name string, custom map[string]Theme) bool {
+	if name == "" || name == Auto {
+		return true
+	}
+	if _, ok := custom[name]; ok {
+		return true
+	}
+	_, ok := builtin[name]
+	return ok
+}
+
+func builtinNames() string {
+	var names []string
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Accent is used for headers and names
+func Accent() lipgloss.Color { return lipgloss.Color(current.Accent) }
+
+// Muted is used for labels, dividers and secondary details
+func Muted() lipgloss.Color { return lipgloss.Color(current.Muted) }
+
+// Error is used for errors, failures and removed lines
+func Error() lipgloss.Color { return lipgloss.Color(current.Error) }
+
+// Success is used for confirmations and added lines
+func Success() lipgloss.Color { return lipgloss.Color(current.Success) }
+
+// Info is used for structural markers such as diff hunk headers
+func Info() lipgloss.Color { return lipgloss.Color(current.Info) }
+
+// Highlight is used for the spinner and the selected menu item
+func Highlight() lipgloss.Color { return lipgloss.Color(current.Highlight) }
+
+// MarkdownRenderer returns a glamour renderer in the active theme's style,
+// wrapping at width (no wrapping when width is 0)
+func MarkdownRenderer(width int) (*glamour.TermRenderer, error) {
+	style := glamour.WithAutoStyle()
+	if current.Markdown != "" {
+		style = glamour.WithStylePath(current.Markdown)
+	}
+	options := []glamour.TermRendererOption{style}
+	if width > 0 {
+		options = append(options, glamour.WithWordWrap(width))
+	}
+	return glamour.NewTermRenderer(options...)
+}
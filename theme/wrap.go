@@ -0,0 +1,104 @@
+package theme
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/muesli/reflow/wordwrap"
+)
+
+var (
+	ansiSequence = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	// listItem matches the start of a rendered list item: its indent and marker
+	listItem = regexp.MustCompile(`^( *)(• |[0-9]+\. )\S`)
+	// trailingPadding is the styled spaces glamour pads each line to the wrap width with
+	trailingPadding = regexp.MustCompile(`(?:\x1b\[[0-9;]*m| )+$`)
+)
+
+// HangIndents rewraps the list items of markdown rendered at width so that
+// their wrapped lines line up with the item's text instead of its bullet
+func HangIndents(rendered string, width int) string {
+	lines := strings.Split(rendered, "\n")
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		m := listItem.FindStringSubmatch(visible(lines[i]))
+		if m == nil {
+			out = append(out, lines[i])
+			continue
+		}
+		indent := len(m[1])
+		hang := indent + runewidth.StringWidth(m[2])
+		if width-hang < 10 {
+			out = append(out, lines[i])
+			continue
+		}
+
+		prefix, text := cutColumns(lines[i], hang)
+		parts := []string{trimPadding(text)}
+		for i+1 < len(lines) && isContinuation(visible(lines[i+1]), indent) {
+			i++
+			_, rest := cutColumns(lines[i], indent)
+			parts = append(parts, trimPadding(rest))
+		}
+		wrapped := strings.Split(wordwrap.String(strings.Join(parts, " "), width-hang), "\n")
+		out = append(out, prefix+wrapped[0])
+		for _, line := range wrapped[1:] {
+			out = append(out, strings.Repeat(" ", hang)+line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// isContinuation reports whether a line is the wrapped part of the list item
+// above, which glamour indents like the item's bullet
+func isContinuation(line string, indent int) bool {
+	text := strings.TrimLeft(line, " ")
+	return text != "" && len(line)-len(text) == indent && !listItem.MatchString(line)
+}
+
+// visible returns the text of a line without its styling
+func visible(s string) string {
+	return ansiSequence.ReplaceAllString(s, "")
+}
+
+// cutColumns splits a styled line after its first n columns of text
+func cutColumns(s string, n int) (prefix, rest string) {
+	col := 0
+	for i := 0; i < len(s); {
+		if col >= n {
+			return s[:i] + "\x1b[0m", s[i:]
+		}
+		if loc := ansiSequence.FindStringIndex(s[i:]); s[i] == '\x1b' && loc != nil && loc[0] == 0 {
+			i += loc[1]
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		col += runewidth.RuneWidth(r)
+		i += size
+	}
+	return s, ""
+}
+
+// trimPadding removes the styled spaces at the end of a line
+func trimPadding(s string) string {
+	trimmed := trailingPadding.ReplaceAllString(s, "")
+	if trimmed != s && strings.Contains(trimmed, "\x1b[") {
+		trimmed += "\x1b[0m"
+	}
+	return trimmed
+}
+
+// TrimBlankLines removes the lines around rendered markdown that show nothing
+// but padding, so pieces rendered separately can be joined evenly
+func TrimBlankLines(rendered string) string {
+	lines := strings.Split(rendered, "\n")
+	for len(lines) > 0 && strings.TrimSpace(visible(lines[0])) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(visible(lines[len(lines)-1])) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
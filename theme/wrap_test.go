@@ -0,0 +1,59 @@
+package theme
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHangIndents(t *testing.T) {
+	r, err := MarkdownRenderer(40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := r.Render("Steps:\n\n" +
+		"- install the package with **your** package manager of choice\n" +
+		"- done\n" +
+		"  1. then configure the nested settings that also wrap here\n\n" +
+		"A closing paragraph that is long enough to wrap onto two lines.\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(HangIndents(rendered, 40), "\n") {
+		line = strings.TrimRight(visible(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+		if w := len([]rune(line)); w > 40 {
+			t.Errorf("line is %d columns wide, over the width: %q", w, line)
+		}
+	}
+	want := []string{
+		"  Steps:",
+		"  • install the package with your",
+		"    package manager of choice",
+		"  • done",
+		"    1. then configure the nested",
+		"       settings that also wrap here",
+		"  A closing paragraph that is long",
+		"  enough to wrap onto two lines.",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("HangIndents =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCutColumns(t *testing.T) {
+	prefix, rest := cutColumns("\x1b[1m• \x1b[0m\x1b[32mtext\x1b[0m", 2)
+	if visible(prefix) != "• " || visible(rest) != "text" || !strings.Contains(rest, "\x1b[32mtext") {
+		t.Errorf("cutColumns = %q, %q; the text should keep its own style", prefix, rest)
+	}
+}
+
+func TestTrimBlankLines(t *testing.T) {
+	got := TrimBlankLines("\n\x1b[0m   \x1b[0m\n  text\n\n  more\x1b[0m\n\x1b[38;5;252m  \x1b[0m\n")
+	if got != "  text\n\n  more\x1b[0m" {
+		t.Errorf("TrimBlankLines = %q", got)
+	}
+}
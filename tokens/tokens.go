@@ -0,0 +1,125 @@
+package tokens
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	. "q/types"
+)
+
+// perMessageOverhead approximates the tokens chat formats add around each message
+const perMessageOverhead = 4
+
+// piecePattern splits text the way GPT tokenizers do before applying their
+// merges: contractions, words with their leading space, numbers in groups of
+// up to three digits, punctuation runs, and whitespace
+var piecePattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)| ?\pL+| ?\pN{1,3}| ?[^\s\pL\pN]+|\s+`)
+
+// Estimate approximates the number of tokens in text. It splits text into the
+// pieces a GPT tokenizer starts from and estimates how many tokens each piece
+// is merged into, which is much closer than counting characters for code and
+// non-English text. It never needs a vocabulary file.
+func Estimate(text string) int {
+	if text == "" {
+		return 0
+	}
+	total := 0
+	for _, piece := range piecePattern.FindAllString(text, -1) {
+		total += pieceTokens(piece)
+	}
+	return total
+}
+
+// pieceTokens estimates the tokens in one pre-tokenized piece
+func pieceTokens(piece string) int {
+	first, _ := utf8.DecodeRuneInString(piece)
+	if unicode.IsSpace(first) && len(piece) > 1 {
+		first, _ = utf8.DecodeRuneInString(piece[1:])
+	}
+	n := utf8.RuneCountInString(piece)
+	switch {
+	case unicode.IsSpace(first):
+		// Runs of spaces or newlines are usually a single token
+		return 1
+	case unicode.IsLetter(first):
+		wide := 0
+		for _, r := range piece {
+			if isWide(r) {
+				wide++
+			}
+		}
+		if wide > 0 {
+			// CJK text is roughly one token per character
+			return wide + (n-wide+3)/4
+		}
+		// Common words are one token; rarer, longer ones split into a few
+		return (n + 6) / 7
+	case unicode.IsDigit(first):
+		return 1
+	default:
+		// Common operator and bracket pairs merge, e.g. "()" or "://"
+		return (n + 1) / 2
+	}
+}
+
+// isWide reports whether r belongs to a script tokenizers rarely merge (CJK)
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// EstimateMessages approximates the prompt tokens for a list of chat messages
+func EstimateMessages(messages []Message) int {
+	total := 3 // every reply is primed with an assistant header
+	for _, msg := range messages {
+		total += perMessageOverhead + Estimate(msg.Role) + Estimate(msg.Content)
+	}
+	return total
+}
+
+// Split breaks text into chunks of at most max estimated tokens, at paragraph
+// breaks where possible, then at line breaks, then between words
+func Split(text string, max int) []string {
+	var chunks []string
+	var current strings.Builder
+	size := 0
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+		size = 0
+	}
+	add := func(piece, sep string, n int) {
+		if size > 0 && size+n > max {
+			flush()
+		}
+		if size > 0 {
+			current.WriteString(sep)
+		}
+		current.WriteString(piece)
+		size += n
+	}
+
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		n := Estimate(paragraph)
+		if n <= max {
+			add(paragraph, "\n\n", n)
+			continue
+		}
+		// Too long for one chunk: fill chunks line by line, and word by word
+		// for lines that are too long themselves
+		for _, line := range strings.Split(paragraph, "\n") {
+			if n := Estimate(line); n <= max {
+				add(line, "\n", n)
+				continue
+			}
+			for _, word := range strings.Fields(line) {
+				add(word, " ", Estimate(" "+word))
+			}
+		}
+	}
+	flush()
+	return chunks
+}
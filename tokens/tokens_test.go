@@ -0,0 +1,66 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		// Both match the cl100k_base tokenizer
+		{"Hello, world!", 4},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		// Numbers are split into groups of up to three digits
+		{"1234567", 3},
+		// CJK text is about a token per character
+		{"天気", 2},
+		// Whitespace runs are a single token
+		{"a\n\n    b", 3},
+	}
+	for _, tt := range tests {
+		if got := Estimate(tt.text); got != tt.want {
+			t.Errorf("Estimate(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateMessages(t *testing.T) {
+	if got := EstimateMessages(nil); got != 3 {
+		t.Errorf("EstimateMessages(nil) = %d, want 3", got)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	paragraph := strings.Repeat("word ", 40)
+	text := strings.Join([]string{paragraph, paragraph, paragraph}, "\n\n")
+	chunks := Split(text, 90)
+	if len(chunks) != 2 {
+		t.Fatalf("Split made %d chunks, want 2 (two paragraphs, then one)", len(chunks))
+	}
+	if !strings.Contains(chunks[0], "\n\n") {
+		t.Error("paragraphs in one chunk should keep their break")
+	}
+
+	// A single paragraph longer than max is split between words
+	long := strings.Repeat("word ", 300)
+	chunks = Split(long, 100)
+	if len(chunks) != 3 {
+		t.Errorf("Split made %d chunks of one long paragraph, want 3", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if n := Estimate(chunk); n > 100 {
+			t.Errorf("chunk of %d tokens exceeds max", n)
+		}
+	}
+	if got := strings.Join(chunks, " "); strings.Join(strings.Fields(got), " ") != strings.TrimSpace(long) {
+		t.Error("splitting should not lose words")
+	}
+
+	if chunks := Split("  \n\n ", 10); len(chunks) != 0 {
+		t.Errorf("Split of blank text = %q, want none", chunks)
+	}
+}
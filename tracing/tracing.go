@@ -0,0 +1,278 @@
+// Package tracing records OpenTelemetry spans for model requests and exports
+// them with OTLP over HTTP, in its JSON encoding, when an endpoint is set with
+// the standard OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+// variables. A W3C TRACEPARENT variable, as CI tracing tools set for the
+// steps they run, makes q's spans part of the caller's trace.
+//
+// Spans are exported when the outermost one in the process ends, since q
+// usually exits right after a request.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"q/util"
+)
+
+// exportTimeout bounds how long exporting spans can hold up q
+const exportTimeout = 5 * time.Second
+
+// Span is an operation being timed. A nil *Span, as Start returns when
+// tracing isn't configured, ignores every call.
+type Span struct {
+	traceID, spanID, parentID string
+	name                      string
+	start, end                time.Time
+	attributes                []keyValue
+	events                    []event
+	failed                    bool
+	message                   string
+	// root is set on the outermost span in this process, which exports the trace when it ends
+	root bool
+}
+
+type event struct {
+	name string
+	at   time.Time
+}
+
+type keyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+var (
+	mu       sync.Mutex
+	finished []*Span
+)
+
+type spanKey struct{}
+
+// Start starts a span named name, a child of the span in ctx if there is one,
+// or else of the trace in TRACEPARENT
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	if endpoint() == "" {
+		return ctx, nil
+	}
+	span := &Span{name: name, spanID: randomHex(8), start: time.Now()}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		span.traceID, span.parentID = parent.traceID, parent.spanID
+	} else {
+		span.root = true
+		span.traceID, span.parentID = parseTraceparent(os.Getenv("TRACEPARENT"))
+		if span.traceID == "" {
+			span.traceID = randomHex(16)
+		}
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttribute records a string, integer, float or boolean attribute
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	var v map[string]interface{}
+	switch value := value.(type) {
+	case string:
+		v = map[string]interface{}{"stringValue": value}
+	case int:
+		v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+	case int64:
+		v = map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+	case float64:
+		v = map[string]interface{}{"doubleValue": value}
+	case bool:
+		v = map[string]interface{}{"boolValue": value}
+	default:
+		v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+	}
+	s.attributes = append(s.attributes, keyValue{Key: key, Value: v})
+}
+
+// AddEvent marks a moment in the span, such as the first token arriving
+func (s *Span) AddEvent(name string) {
+	if s == nil {
+		return
+	}
+	s.events = append(s.events, event{name: name, at: time.Now()})
+}
+
+// RecordError marks the span as failed, if err is set
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.failed, s.message = true, err.Error()
+}
+
+// Elapsed is how long the span has been running
+func (s *Span) Elapsed() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Since(s.start)
+}
+
+// End ends the span; ending the outermost one exports the trace
+func (s *Span) End() {
+	if s == nil || !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+	mu.Lock()
+	finished = append(finished, s)
+	var spans []*Span
+	if s.root {
+		spans, finished = finished, nil
+	}
+	mu.Unlock()
+	if len(spans) > 0 {
+		if err := export(spans); err != nil {
+			fmt.Fprintf(util.Notes(), "Warning: failed to export traces: %v\n", err)
+		}
+	}
+}
+
+// endpoint is where traces are sent, or "" when tracing is off
+func endpoint() string {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return ""
+	}
+	if traces := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); traces != "" {
+		return traces
+	}
+	if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+		return strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// parseTraceparent returns the trace and span IDs of a W3C traceparent header
+// value like 00-<32 hex>-<16 hex>-01, or "" if it isn't one
+func parseTraceparent(value string) (traceID, spanID string) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", ""
+	}
+	if _, err := hex.DecodeString(parts[1] + parts[2]); err != nil ||
+		parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return "", ""
+	}
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2])
+}
+
+// parsePairs parses the k=v,k2=v2 lists of OTEL_EXPORTER_OTLP_HEADERS and
+// OTEL_RESOURCE_ATTRIBUTES, whose values may be URL-encoded
+func parsePairs(list string) map[string]string {
+	pairs := map[string]string{}
+	for _, item := range strings.Split(list, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, value := parts[0], parts[1]
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		pairs[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return pairs
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// export sends spans in an OTLP ExportTraceServiceRequest
+func export(spans []*Span) error {
+	resource := parsePairs(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		resource["service.name"] = name
+	} else if resource["service.name"] == "" {
+		resource["service.name"] = "q"
+	}
+	var resourceAttributes []keyValue
+	for key, value := range resource {
+		resourceAttributes = append(resourceAttributes, keyValue{Key: key, Value: map[string]interface{}{"stringValue": value}})
+	}
+
+	var otlpSpans []map[string]interface{}
+	for _, s := range spans {
+		span := map[string]interface{}{
+			"traceId":           s.traceID,
+			"spanId":            s.spanID,
+			"name":              s.name,
+			"kind":              1, // internal
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if len(s.attributes) > 0 {
+			span["attributes"] = s.attributes
+		}
+		if s.root {
+			// The outermost span is the call to the model
+			span["kind"] = 3 // client
+		}
+		if s.parentID != "" {
+			span["parentSpanId"] = s.parentID
+		}
+		var events []map[string]interface{}
+		for _, e := range s.events {
+			events = append(events, map[string]interface{}{"name": e.name, "timeUnixNano": strconv.FormatInt(e.at.UnixNano(), 10)})
+		}
+		if len(events) > 0 {
+			span["events"] = events
+		}
+		if s.failed {
+			span["status"] = map[string]interface{}{"code": 2, "message": s.message}
+		}
+		otlpSpans = append(otlpSpans, span)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": resourceAttributes},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "q"},
+				"spans": otlpSpans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range parsePairs(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")) {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s from %s", resp.Status, endpoint())
+	}
+	return nil
+}
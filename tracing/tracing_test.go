@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type exported struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []keyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID      string `json:"traceId"`
+				SpanID       string `json:"spanId"`
+				ParentSpanID string `json:"parentSpanId"`
+				Name         string `json:"name"`
+				Kind         int    `json:"kind"`
+				Events       []struct {
+					Name string `json:"name"`
+				} `json:"events"`
+				Status struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"status"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+func TestExport(t *testing.T) {
+	var got exported
+	var auth string
+	requests := 0
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("bad body: %v", err)
+		}
+	}))
+	defer collector.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL+"/")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20abc")
+	t.Setenv("OTEL_SERVICE_NAME", "ci-q")
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, root := Start(context.Background(), "chat gpt-4.1")
+	_, child := Start(ctx, "stream")
+	child.AddEvent("first token")
+	child.RecordError(errors.New("stream broke"))
+	child.End()
+	if requests != 0 {
+		t.Fatalf("exported before the root span ended")
+	}
+	root.End()
+	root.End()
+
+	if requests != 1 {
+		t.Fatalf("exported %d times, want 1", requests)
+	}
+	if auth != "Bearer abc" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	stream, chat := spans[0], spans[1]
+	if chat.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || chat.ParentSpanID != "00f067aa0ba902b7" || chat.Kind != 3 {
+		t.Errorf("root span = %+v, want it in the TRACEPARENT trace", chat)
+	}
+	if stream.TraceID != chat.TraceID || stream.ParentSpanID != chat.SpanID || stream.Kind != 1 {
+		t.Errorf("child span = %+v, want it under %s", stream, chat.SpanID)
+	}
+	if len(stream.Events) != 1 || stream.Events[0].Name != "first token" {
+		t.Errorf("events = %+v", stream.Events)
+	}
+	if stream.Status.Code != 2 || stream.Status.Message != "stream broke" {
+		t.Errorf("status = %+v", stream.Status)
+	}
+	attributes := got.ResourceSpans[0].Resource.Attributes
+	if len(attributes) != 1 || attributes[0].Key != "service.name" || attributes[0].Value["stringValue"] != "ci-q" {
+		t.Errorf("resource attributes = %+v", attributes)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:1")
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	ctx, span := Start(context.Background(), "chat")
+	if span != nil {
+		t.Fatalf("started a span with tracing disabled")
+	}
+	_, child := Start(ctx, "stream")
+	child.SetAttribute("n", 1)
+	child.AddEvent("first token")
+	child.End()
+	span.End()
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := map[string][2]string{
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01": {"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": {"", ""},
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-01":                  {"", ""},
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01": {"", ""},
+		"": {"", ""},
+	}
+	for value, want := range tests {
+		traceID, spanID := parseTraceparent(value)
+		if traceID != want[0] || spanID != want[1] {
+			t.Errorf("parseTraceparent(%q) = %q, %q, want %q, %q", value, traceID, spanID, want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package translate
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Glossary maps terms to the translations they must always get
+type Glossary map[string]string
+
+// LoadGlossary reads a YAML file of `term: translation` pairs
+func LoadGlossary(path string) (Glossary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var glossary Glossary
+	if err := yaml.Unmarshal(data, &glossary); err != nil {
+		return nil, fmt.Errorf("failed to parse glossary %s: %w", path, err)
+	}
+	return glossary, nil
+}
+
+// Prompt lists the glossary for a system prompt, sorted so requests are stable
+func (g Glossary) Prompt() string {
+	if len(g) == 0 {
+		return ""
+	}
+	terms := make([]string, 0, len(g))
+	for term := range g {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	var b strings.Builder
+	b.WriteString("Always translate these terms as given, adapting only their grammatical form:\n")
+	for _, term := range terms {
+		fmt.Fprintf(&b, "- %s → %s\n", term, g[term])
+	}
+	return b.String()
+}
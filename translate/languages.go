@@ -0,0 +1,49 @@
+package translate
+
+import "strings"
+
+// languages names the languages most often asked for by their ISO 639-1 code
+var languages = map[string]string{
+	"ar": "Arabic",
+	"cs": "Czech",
+	"da": "Danish",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fi": "Finnish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"hu": "Hungarian",
+	"id": "Indonesian",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"no": "Norwegian",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ro": "Romanian",
+	"ru": "Russian",
+	"sv": "Swedish",
+	"th": "Thai",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"vi": "Vietnamese",
+	"zh": "Chinese",
+}
+
+// LanguageName returns the English name of a language code, or the argument
+// as given if it isn't a known code (so names like "Brazilian Portuguese" work too)
+func LanguageName(language string) string {
+	if name, ok := languages[strings.ToLower(language)]; ok {
+		return name
+	}
+	return language
+}
+
+// SameLanguage reports whether two codes or names refer to the same language
+func SameLanguage(a, b string) bool {
+	return strings.EqualFold(LanguageName(a), LanguageName(b))
+}
@@ -0,0 +1,52 @@
+// Package translate keeps code, placeholders and terminology intact when text
+// is translated by a model
+package translate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// protected matches what must come through a translation unchanged: code
+// blocks and spans, URLs, HTML tags, and template and format placeholders
+var protected = regexp.MustCompile("(?s)```.*?```|~~~.*?~~~|`[^`\n]+`" +
+	`|https?://[^\s)>\]]*[^\s)>\].,;:!?'"]` +
+	`|</?[a-zA-Z][^<>\n]*>` +
+	`|\{\{.*?\}\}|\$\{[^}\n]+\}|\{[A-Za-z_][A-Za-z0-9_.]*\}` +
+	`|%(\([a-z_]+\))?[-+0#]?\d*(\.\d+)?[sdvfqxXeEgGbcoiu]` +
+	`|\$[A-Z_][A-Z0-9_]*`)
+
+// marker matches the markers Protect puts in place of protected spans
+var marker = regexp.MustCompile(`⟦(\d+)⟧`)
+
+// Protect replaces code, URLs, tags and placeholders with numbered markers
+// like ⟦1⟧ that a model is asked to copy, and returns what they stand for
+func Protect(text string) (masked string, spans []string) {
+	masked = protected.ReplaceAllStringFunc(text, func(span string) string {
+		spans = append(spans, span)
+		return fmt.Sprintf("⟦%d⟧", len(spans))
+	})
+	return masked, spans
+}
+
+// Restore puts the protected spans back in place of their markers. lost are
+// the spans whose markers the translation dropped.
+func Restore(translated string, spans []string) (text string, lost []string) {
+	seen := make([]bool, len(spans))
+	text = marker.ReplaceAllStringFunc(translated, func(m string) string {
+		var n int
+		fmt.Sscanf(strings.Trim(m, "⟦⟧"), "%d", &n)
+		if n < 1 || n > len(spans) {
+			return m
+		}
+		seen[n-1] = true
+		return spans[n-1]
+	})
+	for i, ok := range seen {
+		if !ok {
+			lost = append(lost, spans[i])
+		}
+	}
+	return text, lost
+}
@@ -0,0 +1,62 @@
+package translate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProtect(t *testing.T) {
+	text := "Run `make build`, then open {url} or http://localhost:8080/docs.\n\n" +
+		"```bash\nexport PATH=$HOME/bin\n```\n\n" +
+		"Hello %s, you have %d new messages. Set $API_KEY in ${HOME}/.env, 50% off, <b>now</b>."
+	masked, spans := Protect(text)
+
+	want := []string{"`make build`", "{url}", "http://localhost:8080/docs", "```bash\nexport PATH=$HOME/bin\n```",
+		"%s", "%d", "$API_KEY", "${HOME}", "<b>", "</b>"}
+	if !reflect.DeepEqual(spans, want) {
+		t.Errorf("spans = %q\nwant %q", spans, want)
+	}
+	wantMasked := "Run ⟦1⟧, then open ⟦2⟧ or ⟦3⟧.\n\n⟦4⟧\n\n" +
+		"Hello ⟦5⟧, you have ⟦6⟧ new messages. Set ⟦7⟧ in ⟦8⟧/.env, 50% off, ⟦9⟧now⟦10⟧."
+	if masked != wantMasked {
+		t.Errorf("masked = %q\nwant %q", masked, wantMasked)
+	}
+
+	restored, lost := Restore(masked, spans)
+	if restored != text || len(lost) != 0 {
+		t.Errorf("Restore(Protect(text)) = %q, lost %q", restored, lost)
+	}
+}
+
+func TestRestoreReportsLostSpans(t *testing.T) {
+	_, spans := Protect("Use `ls` and `pwd`.")
+	text, lost := Restore("Nutze ⟦2⟧ und ⟦7⟧.", spans)
+	if text != "Nutze `pwd` und ⟦7⟧." {
+		t.Errorf("text = %q", text)
+	}
+	if !reflect.DeepEqual(lost, []string{"`ls`"}) {
+		t.Errorf("lost = %q, want [`ls`]", lost)
+	}
+}
+
+func TestGlossary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "glossary.yaml")
+	os.WriteFile(path, []byte("deploy: bereitstellen\n\"pull request\": Pull Request\n"), 0644)
+	glossary, err := LoadGlossary(path)
+	if err != nil {
+		t.Fatalf("LoadGlossary: %v", err)
+	}
+	want := "Always translate these terms as given, adapting only their grammatical form:\n" +
+		"- deploy → bereitstellen\n- pull request → Pull Request\n"
+	if got := glossary.Prompt(); got != want {
+		t.Errorf("Prompt() = %q, want %q", got, want)
+	}
+}
+
+func TestSameLanguage(t *testing.T) {
+	if !SameLanguage("de", "German") || !SameLanguage("FR", "fr") || SameLanguage("de", "nl") {
+		t.Error("SameLanguage compares codes and names case-insensitively")
+	}
+}
@@ -0,0 +1,51 @@
+// Package transport is the HTTP transport shared by every request q makes to
+// a model's API in one process. Follow-ups in a chat, the prompts of a batch
+// and the embeddings of --context then reuse warm connections, over HTTP/2
+// where the server offers it, instead of each paying for a new TCP and TLS
+// handshake.
+package transport
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxDrain bounds how much of an unread response body Release reads to keep
+// its connection open; past that, closing the connection is cheaper
+const maxDrain = 64 << 10
+
+// Shared pools the connections to every API host. Up to 32 stay open per
+// host, so a batch's workers don't close and reopen connections as they
+// take turns, and idle ones are closed after 90 seconds.
+var Shared http.RoundTripper = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   32,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: time.Second,
+}
+
+// Client returns a client over the shared transport that gives up on a
+// request after timeout. Each caller gets its own client, so changing its
+// timeout doesn't affect the others.
+func Client(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: Shared, Timeout: timeout}
+}
+
+// Release closes a response body after reading what's left of it, up to a
+// point, since HTTP/1.1 connections are only reused once their last
+// response was read to the end. Streams usually have a few bytes left after
+// their final event.
+func Release(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, maxDrain))
+	body.Close()
+}
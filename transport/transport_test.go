@@ -0,0 +1,54 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnectionReuse(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {}\n\ndata: [DONE]\n\n")
+		w.(http.Flusher).Flush()
+		// The end of the stream arrives after the client stopped reading
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, "\n")
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	for i := 0; i < 3; i++ {
+		resp, err := Client(5 * time.Second).Get(server.URL)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		// Read just the events, as a stream reader stopping at [DONE] would
+		buf := make([]byte, len("data: {}\n\ndata: [DONE]\n\n"))
+		if _, err := resp.Body.Read(buf); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		Release(resp.Body)
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("3 requests opened %d connections, want 1", n)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	a, b := Client(time.Second), Client(2*time.Second)
+	a.Timeout = time.Minute
+	if b.Timeout != 2*time.Second || a.Transport != Shared || b.Transport != Shared {
+		t.Errorf("clients share more than the transport: %v, %v", a, b)
+	}
+}
@@ -1,22 +1,340 @@
 package types
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// PromptSection is a part of a model's system prompt
+type PromptSection struct {
+	// Section is the name of a built-in section (persona, environment, memory
+	// or safety) or of one of the config's own
+	Section string `yaml:"section"`
+	// Template is the section's Go template, in place of the built-in one
+	Template string `yaml:"template,omitempty"`
+	// Disabled leaves the section out
+	Disabled bool `yaml:"disabled,omitempty"`
+}
 
 type ModelConfig struct {
-	ModelName string    `yaml:"name"`
-	Endpoint  string    `yaml:"endpoint"`
-	Auth      string    `yaml:"auth_env_var"`
-	OrgID     string    `yaml:"org_env_var,omitempty"`
-	Prompt    []Message `yaml:"prompt"`
+	ModelName  string    `yaml:"name"`
+	Provider   string    `yaml:"provider,omitempty"`
+	Endpoint   string    `yaml:"endpoint,omitempty"`
+	Auth       string    `yaml:"auth_env_var,omitempty"`
+	AuthHeader string    `yaml:"auth_header,omitempty"`
+	OrgID      string    `yaml:"org_env_var,omitempty"`
+	Prompt     []Message `yaml:"prompt"`
+	// SystemPrompt builds the system prompt from sections, the prompt's
+	// system messages becoming the persona section (see package sysprompt)
+	SystemPrompt []PromptSection `yaml:"system_prompt,omitempty"`
+	// Examples are sample prompts with the answers wanted, sent after the
+	// prompt as earlier turns of the conversation
+	Examples []Example `yaml:"examples,omitempty"`
+	// ExampleTokens caps the tokens the examples may take; those that don't
+	// fit are left out, in order (default: an eighth of the context window)
+	ExampleTokens int `yaml:"example_tokens,omitempty"`
+	// Length is how long answers should be: "short", "detailed", or unset
+	// to leave it to the prompt (see --short and --detailed)
+	Length string `yaml:"length,omitempty"`
+	// Prefill is text the model's answers start with, such as "```bash\n" to
+	// get a command in a code block
+	Prefill string `yaml:"prefill,omitempty"`
+
+	// ContextWindow is the model's maximum context in tokens (0 uses the built-in value, if known)
+	ContextWindow int `yaml:"context_window,omitempty"`
+	// ContextStrategy is what to do with old turns near the limit: "truncate" (default) or "summarize"
+	ContextStrategy string `yaml:"context_strategy,omitempty"`
+	// ContextRecovery is what to do when the provider rejects a request as
+	// too long anyway: "truncate", "summarize" or "off" (default: ContextStrategy)
+	ContextRecovery string `yaml:"context_recovery,omitempty"`
+	// SummaryModel is the (cheap) model used by the "summarize" strategy; defaults to this model
+	SummaryModel string `yaml:"summary_model,omitempty"`
+	// Capabilities overrides what the model is known to support (see provider.CapabilitiesFor)
+	Capabilities *ModelCapabilities `yaml:"capabilities,omitempty"`
+	// Keys are several API keys to use instead of auth_env_var, to spread
+	// requests over or fall back on when one is rate limited
+	Keys []APIKey `yaml:"keys,omitempty"`
+	// KeyRotation picks among Keys: "failover" (default) keeps using a key
+	// until it's rate limited or rejected, "round-robin" takes turns
+	KeyRotation string `yaml:"key_rotation,omitempty"`
+	// Headers are extra HTTP headers sent with each request, such as the
+	// tenant ID or routing hint a gateway needs; they may set auth headers too
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// IdleTimeout is how long a streamed answer may stop sending data before
+	// it's given up on as stalled, like "45s" (default 20s, 0 to wait for the
+	// request timeout)
+	IdleTimeout string `yaml:"idle_timeout,omitempty"`
+	// API is the request format: "chat" (Chat Completions, the default) or
+	// "responses" (OpenAI's Responses API, at /v1/responses)
+	API string `yaml:"api,omitempty"`
+	// ReasoningSummary asks a reasoning model for a summary of its reasoning
+	// ("auto", "concise" or "detailed"); Responses API only
+	ReasoningSummary string `yaml:"reasoning_summary,omitempty"`
+	// Messages overrides the provider's conventions for message roles (see provider.Normalize)
+	Messages *MessageRules `yaml:"messages,omitempty"`
+	// Hooks are Starlark scripts this model's requests and answers pass through
+	Hooks *HooksConfig `yaml:"hooks,omitempty"`
+}
+
+// HooksConfig names the Starlark scripts run around each request (see package hooks)
+type HooksConfig struct {
+	// PreRequest defines pre_request(messages, model), which may rewrite the messages sent
+	PreRequest string `yaml:"pre_request,omitempty"`
+	// PostResponse defines post_response(response, model), which may rewrite the answer
+	PostResponse string `yaml:"post_response,omitempty"`
+}
+
+// MessageRules are an API's conventions for the roles in a conversation
+type MessageRules struct {
+	// System is how system messages are sent: "message" (as they are, the
+	// default), "first" (merged into one leading message), "field" (in the
+	// request's top-level system field) or "user" (folded into the first user message)
+	System string `yaml:"system,omitempty"`
+	// Alternate merges consecutive messages with the same role and starts
+	// with a user message, for APIs that require turns to alternate
+	Alternate bool `yaml:"alternate,omitempty"`
+	// Prefill means the API continues a trailing assistant message; otherwise
+	// it's turned into an instruction in the last user message
+	Prefill bool `yaml:"prefill,omitempty"`
+}
+
+// APIKey is one of a model's API keys, read from an environment variable
+type APIKey struct {
+	// Alias names the key in the logs (default: the env var name)
+	Alias  string `yaml:"alias,omitempty"`
+	EnvVar string `yaml:"env_var"`
+	// Key is the value of EnvVar once resolved; it is never saved
+	Key string `yaml:"-"`
+}
+
+// ModelCapabilities describes the features a model supports
+type ModelCapabilities struct {
+	ContextWindow int  `yaml:"context_window,omitempty"`
+	Vision        bool `yaml:"vision"`
+	Tools         bool `yaml:"tools"`
+	JSONMode      bool `yaml:"json_mode"`
+	Streaming     bool `yaml:"streaming"`
+	// Samples means the API returns several answers to one request when
+	// asked with n (see --n); otherwise they're requested one by one
+	Samples bool `yaml:"samples,omitempty"`
+}
+
+// Example is a few-shot example: a prompt and the answer it should get
+type Example struct {
+	Prompt string `yaml:"prompt"`
+	Answer string `yaml:"answer"`
 }
 
 type Message struct {
 	Role    string `yaml:"role" json:"role"`
 	Content string `yaml:"content" json:"content"`
+	// ToolCalls are the functions an assistant message asks to be run, and
+	// ToolCallID the call a "tool" message is the result of
+	ToolCalls  []MessageToolCall `yaml:"-" json:"tool_calls,omitempty"`
+	ToolCallID string            `yaml:"-" json:"tool_call_id,omitempty"`
+}
+
+// MessageToolCall is a function call in an assistant message, as the chat
+// completions API sends it back with the conversation
+type MessageToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// Persona is a named system prompt selectable with `q as <name>`
+type Persona struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Prompt      string `yaml:"prompt"`
+	// Examples replace the model's examples when the persona is used
+	Examples []Example `yaml:"examples,omitempty"`
+	// Length is the answer length used with the persona, like the model setting
+	Length string `yaml:"length,omitempty"`
 }
 
 type Preferences struct {
-	DefaultModel string `yaml:"default_model"`
+	DefaultModel   string `yaml:"default_model"`
+	EmbeddingModel string `yaml:"embedding_model,omitempty"`
+	// ImageModel is the model `q image` uses (default gpt-image-1)
+	ImageModel string         `yaml:"image_model,omitempty"`
+	Routing    *RoutingConfig `yaml:"routing,omitempty"`
+	// Theme is the color theme: auto (the default), dark, light, mono, or one under themes
+	Theme string `yaml:"theme,omitempty"`
+	// Width is the column output is wrapped at (default: fitted to the terminal, at most 100)
+	Width int `yaml:"width,omitempty"`
+	// StopAtCode ends answers once their first code block is complete, as --stop-at-code does
+	StopAtCode bool `yaml:"stop_at_code,omitempty"`
+	// Notify shows a desktop notification when a request takes longer than
+	// NotifyAfter, as --notify does
+	Notify bool `yaml:"notify,omitempty"`
+	// NotifyAfter is how long a request takes before it's worth a
+	// notification, like "30s" (default 10s)
+	NotifyAfter string `yaml:"notify_after,omitempty"`
+	// DedupWindow is how soon sending the same prompt again is taken for a
+	// mistake, like "10s" (default 5s, 0 to turn the guard off). Scripts are
+	// only guarded when it's set
+	DedupWindow string `yaml:"dedup_window,omitempty"`
+	// OfflineQueue is what happens to a prompt when the network is
+	// unreachable: "auto" (the default) queues it and sends it after the next
+	// answered request, "manual" queues it for `q queue flush`, and "off" doesn't
+	OfflineQueue string `yaml:"offline_queue,omitempty"`
+	// Language is the language to answer in, as a code like "ja" or a name:
+	// "auto" (the default) takes it from the locale in LANG, unless that's
+	// English, and "off" leaves it to the model
+	Language string `yaml:"language,omitempty"`
+	// PackageManager is what answers install software with: "auto" (the
+	// default) detects it, "off" leaves it to the model, or a name like "apt"
+	// (see --pm)
+	PackageManager string `yaml:"package_manager,omitempty"`
+	// Thinking is how the reasoning of models that think before answering is
+	// shown: "hide" (the default), "dim", or "show" (see --show-thinking)
+	Thinking string `yaml:"thinking,omitempty"`
+	// Footer shows a line after each answer with what it took, like a
+	// receipt: its model, tokens, estimated cost and duration. It's left out
+	// when the output isn't a terminal, and with --quiet.
+	Footer bool `yaml:"footer,omitempty"`
+	// FooterFields are what the footer shows, in order: any of model, tokens,
+	// cost and duration (default: all of them)
+	FooterFields []string `yaml:"footer_fields,omitempty"`
+	// DailyBudget is what you mean to spend a day, in US dollars, for `q status`
+	// to show what's left of it. Requests aren't stopped once it's spent.
+	DailyBudget float64 `yaml:"daily_budget,omitempty"`
+	// TitleModel, if set, titles and summarizes each conversation when a session ends
+	TitleModel string `yaml:"title_model,omitempty"`
+	// JudgeModel is the model that picks or merges the answers sampled with
+	// --n --judge (default: the model that answered)
+	JudgeModel string `yaml:"judge_model,omitempty"`
+	// ErrorLog is how stream and transport errors are reported: "record" (the
+	// default) keeps them for `q logs errors`, "verbose" also prints them to
+	// stderr, and "off" drops them
+	ErrorLog string `yaml:"error_log,omitempty"`
+	// URLs limits which pages --url may fetch and how much of each is sent
+	URLs *URLConfig `yaml:"urls,omitempty"`
+	// TranslateGlossary is the glossary `q translate` uses unless --glossary is given
+	TranslateGlossary string `yaml:"translate_glossary,omitempty"`
+	// Voice configures transcription for --voice and --audio
+	Voice *VoiceConfig `yaml:"voice,omitempty"`
+	// Validators overrides the command `q gen` checks each kind with, such as
+	// dockerfile or k8s; it reads the file on stdin, and "off" skips checking
+	Validators map[string]string `yaml:"validators,omitempty"`
+	// Sandbox, if set, runs commands from --run in a sandbox first
+	Sandbox *SandboxConfig `yaml:"sandbox,omitempty"`
+	// LogSink, if set, also sends logged requests to a team's central store
+	LogSink *LogSinkConfig `yaml:"log_sink,omitempty"`
+	// EnvContext sends the values of a few environment variables, like PATH
+	// and VIRTUAL_ENV, with prompts that look like a tooling or build error
+	// (see --env). Those named like secrets are hashed.
+	EnvContext bool `yaml:"env_context,omitempty"`
+	// EnvVars are variables EnvContext sends besides the built-in ones
+	EnvVars []string `yaml:"env_vars,omitempty"`
+	// AuditLog chains each logged request to the one before it by hash, for
+	// `q logs verify`, and refuses deleting or redacting logs
+	AuditLog bool `yaml:"audit_log,omitempty"`
+}
+
+// LogSinkConfig configures where logged requests are sent besides the local
+// database. Records wait in a queue in the database until they're sent, so
+// nothing is lost while offline.
+type LogSinkConfig struct {
+	// URL receives batches as JSON Lines in POST requests
+	URL string `yaml:"url,omitempty"`
+	// AuthEnvVar names the variable holding a bearer token for URL
+	AuthEnvVar string `yaml:"auth_env_var,omitempty"`
+	// S3 writes each batch as an object in a bucket instead
+	S3 *S3SinkConfig `yaml:"s3,omitempty"`
+	// Anonymize sends only usage, as `q logs export --anonymize` writes it
+	Anonymize bool `yaml:"anonymize,omitempty"`
+	// BatchSize is how many records are sent together (default 20); fewer are
+	// sent once the oldest has waited 15 minutes
+	BatchSize int `yaml:"batch_size,omitempty"`
+	// Source labels the records from this machine (default user@host)
+	Source string `yaml:"source,omitempty"`
+}
+
+// S3SinkConfig is a bucket batches are written to, with credentials from
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+type S3SinkConfig struct {
+	Bucket string `yaml:"bucket"`
+	// Region defaults to AWS_REGION, or us-east-1
+	Region string `yaml:"region,omitempty"`
+	// Prefix is prepended to the object keys, which are YYYY/MM/DD/<source>-<time>.jsonl
+	Prefix string `yaml:"prefix,omitempty"`
+	// Endpoint is an S3-compatible service to use instead of AWS
+	Endpoint string `yaml:"endpoint,omitempty"`
+}
+
+// SandboxConfig configures the sandbox --run tries commands in, where the
+// filesystem is read-only apart from /tmp
+type SandboxConfig struct {
+	// Backend is bwrap, firejail, sandbox-exec, docker, or auto (the
+	// default) for the first of them installed
+	Backend string `yaml:"backend,omitempty"`
+	// Image is the image the docker backend runs (default alpine:3)
+	Image string `yaml:"image,omitempty"`
+	// Network allows network access in the sandbox
+	Network bool `yaml:"network,omitempty"`
+}
+
+// VoiceConfig configures speech-to-text input
+type VoiceConfig struct {
+	// Model is the transcription model (default whisper-1)
+	Model string `yaml:"model,omitempty"`
+	// Language is the ISO-639-1 code of the spoken language, which helps
+	// accuracy; detected when unset
+	Language string `yaml:"language,omitempty"`
+	// Recorder is the command that records from the microphone, with {file}
+	// for the WAV file to write; it's stopped with an interrupt. Defaults to
+	// sox's rec, arecord or ffmpeg, whichever is installed.
+	Recorder string `yaml:"recorder,omitempty"`
+}
+
+// URLConfig controls `q --url`. Domains match themselves and their subdomains.
+type URLConfig struct {
+	// Allow, if set, is the only domains pages may be fetched from
+	Allow []string `yaml:"allow,omitempty"`
+	// Deny blocks domains, even ones that are allowed
+	Deny []string `yaml:"deny,omitempty"`
+	// MaxTokens is how much of each page's text is sent (default 4000)
+	MaxTokens int `yaml:"max_tokens,omitempty"`
+}
+
+// Theme is a color palette for q's output. Colors are anything lipgloss
+// accepts: an ANSI number ("9"), a 256-color number ("205") or hex ("#ff5f87").
+type Theme struct {
+	// Base is the built-in theme that colors left unset are taken from (default: dark)
+	Base      string `yaml:"base,omitempty"`
+	Accent    string `yaml:"accent,omitempty"`
+	Muted     string `yaml:"muted,omitempty"`
+	Error     string `yaml:"error,omitempty"`
+	Success   string `yaml:"success,omitempty"`
+	Info      string `yaml:"info,omitempty"`
+	Highlight string `yaml:"highlight,omitempty"`
+	// Markdown is the glamour style for answers: dark, light, notty, or a path to a JSON style
+	Markdown string `yaml:"markdown,omitempty"`
+	// Code is the chroma style code blocks are highlighted with outside of
+	// answers, such as in `q logs` (https://xyproto.github.io/splash/docs/)
+	Code string `yaml:"code,omitempty"`
+}
+
+// RoutingConfig picks a model per prompt: a cheap one for simple prompts and
+// a strong one for complex prompts, unless one of the rules matches first
+type RoutingConfig struct {
+	SimpleModel  string `yaml:"simple_model,omitempty"`
+	ComplexModel string `yaml:"complex_model,omitempty"`
+	// MaxSimpleTokens is the longest prompt still considered simple (default 60)
+	MaxSimpleTokens int           `yaml:"max_simple_tokens,omitempty"`
+	Rules           []RoutingRule `yaml:"rules,omitempty"`
+}
+
+// RoutingRule sends prompts matching a class ("code", "explain", "generate",
+// "command", "long" or "short") to a specific model
+type RoutingRule struct {
+	When  string `yaml:"when"`
+	Model string `yaml:"model"`
 }
 
 type StreamOptions struct {
@@ -25,12 +343,126 @@ type StreamOptions struct {
 
 type Payload struct {
 	Model         string         `json:"model"`
+	System        string         `json:"system,omitempty"`
 	Prompt        string         `json:"prompt,omitempty"`
 	MaxTokens     int            `json:"max_tokens,omitempty"`
 	Temperature   float32        `json:"temperature,omitempty"`
 	Messages      []Message      `json:"messages"`
 	Stream        bool           `json:"stream,omitempty"`
 	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+	// N asks for several answers at once, for models that can (see ModelCapabilities.Samples)
+	N int `json:"n,omitempty"`
+	// Tools are the functions the model may ask to be run (see ModelCapabilities.Tools)
+	Tools []ToolSpec `json:"tools,omitempty"`
+}
+
+// ToolSpec describes a function the model may call, with its parameters as
+// a JSON schema
+type ToolSpec struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters"`
+	} `json:"function"`
+}
+
+// CompletionResponse is a non-streaming chat completion
+type CompletionResponse struct {
+	ID    string `json:"id"`
+	Model string `json:"model"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+	Choices []struct {
+		Message      CompletionMessage `json:"message"`
+		Index        int               `json:"index"`
+		FinishReason string            `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// CompletionMessage is the answer of a chat completion, with the thinking
+// some models return beside it
+type CompletionMessage struct {
+	Message
+	ReasoningContent string `json:"reasoning_content"`
+	Reasoning        string `json:"reasoning"`
+}
+
+// ResponsesPayload is a request to the Responses API
+type ResponsesPayload struct {
+	Model           string               `json:"model"`
+	Instructions    string               `json:"instructions,omitempty"`
+	Input           []ResponsesInputItem `json:"input"`
+	Temperature     float32              `json:"temperature,omitempty"`
+	MaxOutputTokens int                  `json:"max_output_tokens,omitempty"`
+	Stream          bool                 `json:"stream,omitempty"`
+	Reasoning       *ResponsesReasoning  `json:"reasoning,omitempty"`
+	// Store is false so conversations aren't kept server-side; q sends the history itself
+	Store bool `json:"store"`
+}
+
+// ResponsesInputItem is a message in a Responses API request
+type ResponsesInputItem struct {
+	Type    string `json:"type"`
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ResponsesReasoning struct {
+	Summary string `json:"summary,omitempty"`
+}
+
+// ResponsesResponse is a Responses API response, returned whole or, when
+// streaming, in the response.completed and response.failed events
+type ResponsesResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Output []struct {
+		Type    string `json:"type"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Summary []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"summary"`
+	} `json:"output"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// ResponsesEvent is one event of a streamed Responses API response
+type ResponsesEvent struct {
+	Type     string            `json:"type"`
+	Delta    string            `json:"delta"`
+	Message  string            `json:"message"`
+	Response ResponsesResponse `json:"response"`
+	// Item is the output item of a response.output_item.done event
+	Item struct {
+		Type      string `json:"type"`
+		CallID    string `json:"call_id"`
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"item"`
+}
+
+// ToolCall is a function call a model asked for in its answer, with its
+// arguments as JSON
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 type ResponseData struct {
@@ -46,6 +478,20 @@ type ResponseData struct {
 	Choices []struct {
 		Delta struct {
 			Content string `json:"content"`
+			// ReasoningContent (DeepSeek) or Reasoning (OpenRouter, Groq)
+			// is the model's thinking, streamed before the answer
+			ReasoningContent string `json:"reasoning_content"`
+			Reasoning        string `json:"reasoning"`
+			// ToolCalls stream the function calls the model asks for in
+			// pieces, keyed by Index
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
 		} `json:"delta"`
 		Index        int    `json:"index"`
 		FinishReason string `json:"finish_reason"`
@@ -64,6 +510,246 @@ type LogEntry struct {
 	RequestID        string    `json:"request_id,omitempty"`
 	DurationMs       int64     `json:"duration_ms,omitempty"`
 	Error            string    `json:"error,omitempty"`
+	OutputPath       string    `json:"output_path,omitempty"`
+	Persona          string    `json:"persona,omitempty"`
+	Language         string    `json:"language,omitempty"`
+	ContextNote      string    `json:"context_note,omitempty"`
+	BatchID          string    `json:"batch_id,omitempty"`
+	RegeneratedFrom  string    `json:"regenerated_from,omitempty"`
+	RoutedFrom       string    `json:"routed_from,omitempty"`
+	ConversationID   string    `json:"conversation_id,omitempty"`
+	Interrupted      bool      `json:"interrupted,omitempty"`
+	// StoppedEarly means the answer was cut off after its first code block (--stop-at-code)
+	StoppedEarly    bool          `json:"stopped_early,omitempty"`
+	TokensEstimated bool          `json:"tokens_estimated,omitempty"`
+	Citations       []CitedSource `json:"citations,omitempty"`
+	URLs            []string      `json:"urls,omitempty"`
+	KeyAlias        string        `json:"key_alias,omitempty"`
+	Reasoning       string        `json:"reasoning,omitempty"`
+	Image           *ImageRecord  `json:"image,omitempty"`
+	AudioSeconds    float64       `json:"audio_seconds,omitempty"`
+	// RequestRaw and ResponseRaw hold the exact JSON sent and the raw SSE
+	// lines received, and RequestHeaders the headers sent, with credentials
+	// masked (--debug only)
+	RequestRaw     string            `json:"request_raw,omitempty"`
+	RequestHeaders map[string]string `json:"request_headers,omitempty"`
+	ResponseRaw    string            `json:"response_raw,omitempty"`
+	// ErrorCode is a short code for the failure: the provider's error code
+	// or HTTP status, or "stalled", "timeout", "transport" or "other"
+	ErrorCode string `json:"error_code,omitempty"`
+	// Endpoint is the host the request was sent to, telling a gateway apart
+	// from the provider behind it
+	Endpoint string `json:"endpoint,omitempty"`
+	// Retries counts the times the request was sent again with another key
+	Retries int `json:"retries,omitempty"`
+	// SampleGroup groups the answers sampled for the same prompt with --n,
+	// and the judge's verdict on them
+	SampleGroup string `json:"sample_group,omitempty"`
+}
+
+// ImageRecord describes an image made by `q image`
+type ImageRecord struct {
+	Path      string `json:"path"`
+	Thumbnail string `json:"thumbnail,omitempty"`
+	Size      string `json:"size,omitempty"`
+	Quality   string `json:"quality,omitempty"`
+}
+
+// CitedSource is a numbered source that was attached to a prompt, and whether the answer cited it
+type CitedSource struct {
+	N      int    `json:"n"`
+	Source string `json:"source"`
+	Cited  bool   `json:"cited"`
+}
+
+// Conversation is a logged chat session: a sequence of prompts and answers
+type Conversation struct {
+	ID           string
+	Name         string
+	Model        string
+	ImportedFrom string
+	Turns        int
+	Cost         float64
+	Started      time.Time
+	Updated      time.Time
+	// Version advances with every turn a session logs to the conversation, so
+	// a session can tell when another one continued it in the meantime
+	Version int
+	// ParentID is the conversation this one was forked from; it shares the
+	// parent's history up to and including the response ForkPoint
+	ParentID  string
+	ForkPoint string
+	// Title and Summary are written by the title model after a session, if configured
+	Title   string
+	Summary string
+}
+
+// Transcript is the portable form of a conversation, for sharing and importing
+type Transcript struct {
+	Version    int                 `json:"version"`
+	ID         string              `json:"id"`
+	Name       string              `json:"name,omitempty"`
+	Model      string              `json:"model,omitempty"`
+	ExportedAt time.Time           `json:"exported_at"`
+	Messages   []TranscriptMessage `json:"messages"`
+}
+
+// TranscriptMessage is one message of a transcript, with when it was sent
+type TranscriptMessage struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+	Model     string    `json:"model,omitempty"`
+}
+
+// UsageStats aggregates logged responses under a grouping key (a day or a model)
+type UsageStats struct {
+	Key           string
+	Requests      int
+	Errors        int
+	Cost          float64
+	InputTokens   int
+	OutputTokens  int
+	AvgDurationMs float64
+}
+
+// UsageRecord is a logged response with its text stripped and its IDs hashed,
+// as written by `q logs export --anonymize` for teams to pool for budgeting
+type UsageRecord struct {
+	ID             string `json:"id"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	Day            string `json:"day"`
+	Model          string `json:"model"`
+	// Kind is "chat", "batch", "image" or "audio"
+	Kind            string  `json:"kind"`
+	InputTokens     int     `json:"input_tokens"`
+	OutputTokens    int     `json:"output_tokens"`
+	TokensEstimated bool    `json:"tokens_estimated,omitempty"`
+	Cost            float64 `json:"cost_usd"`
+	DurationMs      int64   `json:"duration_ms"`
+	Failed          bool    `json:"failed,omitempty"`
+	KeyAlias        string  `json:"key_alias,omitempty"`
+}
+
+// BatchJob is the state of an OpenAI Batch API job
+type BatchJob struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	InputFileID   string `json:"input_file_id"`
+	OutputFileID  string `json:"output_file_id"`
+	ErrorFileID   string `json:"error_file_id"`
+	CreatedAt     int64  `json:"created_at"`
+	CompletedAt   int64  `json:"completed_at"`
+	RequestCounts struct {
+		Total     int `json:"total"`
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+	} `json:"request_counts"`
+}
+
+// BatchOutput is one line of a batch job's output or error file
+type BatchOutput struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int                `json:"status_code"`
+		RequestID  string             `json:"request_id"`
+		Body       CompletionResponse `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// BatchRequest is one prompt submitted in a batch job
+type BatchRequest struct {
+	CustomID string    `json:"custom_id"`
+	ID       string    `json:"id,omitempty"`
+	Line     int       `json:"line"`
+	Messages []Message `json:"messages"`
+}
+
+// BatchRecord tracks a submitted batch job locally until its results are imported
+type BatchRecord struct {
+	ID         string
+	Model      string
+	Endpoint   string
+	Status     string
+	CreatedAt  time.Time
+	ImportedAt time.Time
+	Requests   []BatchRequest
+}
+
+// ErrorRecord is a problem met while talking to a model that isn't part of
+// the answer: a failed connection, an error status, or a malformed stream chunk
+type ErrorRecord struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	// Kind is "transport", "http", "sse", "json" or "sink"
+	Kind      string `json:"kind"`
+	Model     string `json:"model"`
+	RequestID string `json:"request_id,omitempty"`
+	Message   string `json:"message"`
+	// Detail is the offending line or the start of the response body
+	Detail string `json:"detail,omitempty"`
+}
+
+// QueuedPrompt is a prompt written while offline, waiting in the logs
+// database to be sent
+type QueuedPrompt struct {
+	ID       int64
+	QueuedAt time.Time
+	Prompt   string
+	// Model and Persona are the names the prompt was written for
+	Model   string
+	Persona string
+	// Attempts counts the failed tries to send it, and LastError is why the
+	// latest one failed
+	Attempts  int
+	LastError string
+}
+
+// Draft is a prompt being written in an interactive session, kept in the
+// logs database so it outlives a closed terminal or a stray Ctrl-C
+type Draft struct {
+	// Session identifies the session that wrote it, and PID its process
+	Session string
+	PID     int
+	SavedAt time.Time
+	Text    string
+	// Sent is set once it was sent, until its answer arrives
+	Sent bool
+}
+
+// Benchmark is how a model did in one `q bench` run. The times and speed are
+// medians over the runs that succeeded.
+type Benchmark struct {
+	Model string    `json:"model"`
+	Time  time.Time `json:"time"`
+	// Runs is how many times the prompt was sent, and Failures how many of
+	// them failed, the last with Error
+	Runs     int    `json:"runs"`
+	Failures int    `json:"failures"`
+	Error    string `json:"error,omitempty"`
+	// TTFTMs is the time to the first token of the answer, and DurationMs to
+	// its end
+	TTFTMs     int64 `json:"ttft_ms"`
+	DurationMs int64 `json:"duration_ms"`
+	// TokensPerSec is how fast the answer streamed after its first token
+	TokensPerSec float64 `json:"tokens_per_sec"`
+	// Cost is the estimated cost of all the runs
+	Cost float64 `json:"cost"`
+}
+
+// PendingRequest is a request marked in flight for the duplicate guard
+type PendingRequest struct {
+	ID      int64
+	Hash    string
+	Started time.Time
+	// Finished is when it was answered, zero while it's in flight, and
+	// RequestID the ID it was logged under
+	Finished  time.Time
+	RequestID string
 }
 
 type ModelPricing struct {
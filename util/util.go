@@ -1,6 +1,8 @@
 package util
 
 import (
+	"io"
+	"os"
 	"os/exec"
 	"runtime"
 	"strings"
@@ -13,6 +15,35 @@ const (
 	TermSafeZonePadding = 10
 )
 
+// Quiet suppresses warnings and progress notes (--quiet)
+var Quiet bool
+
+// Notes is where warnings and progress notes are written: stderr, or nowhere when Quiet
+func Notes() io.Writer {
+	if Quiet {
+		return io.Discard
+	}
+	return os.Stderr
+}
+
+// IsTerminal reports whether f is a terminal rather than a pipe or file
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ExpandHome replaces a leading ~/ in path with the home directory
+func ExpandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return home + path[1:]
+}
+
 func StartsWithCodeBlock(s string) bool {
 	if len(s) <= 3 {
 		return strings.Repeat("`", len(s)) == s
@@ -61,10 +92,48 @@ func ExtractFirstCodeBlock(s string) (content string, isOnlyCode bool) {
 	return
 }
 
+// FirstCodeBlockEnd returns where the first fenced code block in s ends, just
+// after its closing fence, or -1 if s has no complete code block yet. The
+// closing fence only counts once its line is complete.
+func FirstCodeBlockEnd(s string) int {
+	fence := ""
+	for offset := 0; offset < len(s); {
+		end := strings.Index(s[offset:], "\n")
+		if end < 0 {
+			return -1
+		}
+		line := strings.TrimSpace(s[offset : offset+end])
+		switch {
+		case fence == "" && strings.HasPrefix(line, "```"):
+			fence = line[:len(line)-len(strings.TrimLeft(line, "`"))]
+		case fence != "" && strings.HasPrefix(line, fence) && strings.Trim(line, "`") == "":
+			return offset + len(strings.TrimRight(s[offset:offset+end], " \t\r"))
+		}
+		offset += end + 1
+	}
+	return -1
+}
+
+// Width, when set by --width or the width preference, is the column output
+// is wrapped at instead of one fitted to the terminal
+var Width int
+
+// GetTermSafeMaxWidth returns the column to wrap output at: Width if set,
+// otherwise TermMaxWidth, narrowed to fit the terminal. Output redirected to
+// a file or pipe isn't fitted to whichever terminal happens to run q.
 func GetTermSafeMaxWidth() int {
+	if Width > 0 {
+		return Width
+	}
 	maxWidth := TermMaxWidth
+	if !IsTerminal(os.Stdout) {
+		return maxWidth
+	}
 	termWidth, err := getTermWidth()
-	if err != nil || termWidth < maxWidth {
+	if err != nil || termWidth <= TermSafeZonePadding {
+		return maxWidth
+	}
+	if termWidth < maxWidth {
 		maxWidth = termWidth - TermSafeZonePadding
 	}
 	return maxWidth
@@ -98,3 +167,29 @@ func OpenBrowser(url string) error {
 
 	return cmd.Start()
 }
+
+// Notify shows a desktop notification, with notify-send on Linux, Notification
+// Center on macOS and a tray balloon on Windows
+func Notify(title, body string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "windows":
+		// The text is passed in the environment, so it needs no quoting
+		script := `Add-Type -AssemblyName System.Windows.Forms;` +
+			`$n = New-Object System.Windows.Forms.NotifyIcon;` +
+			`$n.Icon = [System.Drawing.SystemIcons]::Information;` +
+			`$n.Visible = $true;` +
+			`$n.ShowBalloonTip(10000, $env:Q_NOTIFY_TITLE, $env:Q_NOTIFY_BODY, 'Info');` +
+			`Start-Sleep -Seconds 5; $n.Dispose()`
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+		cmd.Env = append(os.Environ(), "Q_NOTIFY_TITLE="+title, "Q_NOTIFY_BODY="+body)
+	case "darwin":
+		quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace
+		cmd = exec.Command("osascript", "-e", `display notification "`+quote(body)+`" with title "`+quote(title)+`"`)
+	default: // For Linux or anything else
+		cmd = exec.Command("notify-send", "--app-name=q", title, body)
+	}
+
+	return cmd.Run()
+}
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFirstCodeBlockEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		// want is the answer up to the end of the block, or "" for none
+		want string
+	}{
+		{"no block", "ls lists files\n", ""},
+		{"block", "```bash\nls -la\n```\nIt lists files.\n", "```bash\nls -la\n```"},
+		{"text before", "Run:\n```\nls\n```\n", "Run:\n```\nls\n```"},
+		{"closing line incomplete", "```bash\nls -la\n```", ""},
+		{"closing fence with spaces", "```\nls\n  ```  \nmore\n", "```\nls\n  ```"},
+		{"still open", "```bash\nls -la\n", ""},
+		{"shorter fence inside", "````md\n```\nls\n```\n````\nafter\n", "````md\n```\nls\n```\n````"},
+		{"info string isn't a close", "```\nls\n```bash\n```\n", "```\nls\n```bash\n```"},
+		{"second block", "```\na\n```\n```\nb\n```\n", "```\na\n```"},
+	}
+	for _, tt := range tests {
+		end := FirstCodeBlockEnd(tt.s)
+		got := ""
+		if end >= 0 {
+			got = tt.s[:end]
+		}
+		if got != tt.want {
+			t.Errorf("%s: FirstCodeBlockEnd(%q) = %d (%q), want %q", tt.name, tt.s, end, got, tt.want)
+		}
+	}
+}
+
+func TestFirstCodeBlockEndStreamed(t *testing.T) {
+	// However the answer is split into deltas, the block ends only once the
+	// closing fence's line is complete, and at the same place
+	answer := "Use:\n```bash\nls -la\n```\nIt lists files.\n"
+	want := strings.Index(answer, "```\nIt") + len("```")
+	for size := 1; size <= len(answer); size++ {
+		found := -1
+		for n := size; ; n += size {
+			if n > len(answer) {
+				n = len(answer)
+			}
+			if end := FirstCodeBlockEnd(answer[:n]); end >= 0 {
+				found = end
+				if n < want+1 {
+					t.Errorf("in %d-byte deltas: the block ended at %d before its closing line was complete", size, n)
+				}
+				break
+			}
+			if n == len(answer) {
+				break
+			}
+		}
+		if found != want {
+			t.Errorf("in %d-byte deltas: FirstCodeBlockEnd = %d, want %d", size, found, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package workspace finds the directory q keeps its config, memory, index and
+// logs in. That's ~/.shell-ai, unless a workspace is selected with --workspace
+// or SHELL_AI_WORKSPACE: each workspace has a directory of its own under
+// ~/.shell-ai/workspaces, so client work, personal use and experiments never
+// share a history, a budget or remembered facts.
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// EnvVar selects the workspace; --workspace sets it for the run and the
+// commands it starts
+const EnvVar = "SHELL_AI_WORKSPACE"
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Name is the selected workspace, or "" for the main one
+func Name() string {
+	return strings.TrimSpace(os.Getenv(EnvVar))
+}
+
+// Check reports whether name can be a workspace's name: letters, digits,
+// dots, dashes and underscores, so it's always a single directory
+func Check(name string) error {
+	if len(name) > 64 || !validName.MatchString(name) {
+		return fmt.Errorf("workspace %q: names are up to 64 letters, digits, dots, dashes and underscores, starting with a letter or digit", name)
+	}
+	return nil
+}
+
+// Root is ~/.shell-ai, the main workspace's directory
+func Root() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".shell-ai"), nil
+}
+
+// Dir is the selected workspace's directory, whether or not it exists yet
+func Dir() (string, error) {
+	root, err := Root()
+	if err != nil {
+		return "", err
+	}
+	name := Name()
+	if name == "" {
+		return root, nil
+	}
+	if err := Check(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(root, "workspaces", name), nil
+}
+
+// List returns the names of the workspaces that have been used, sorted
+func List() ([]string, error) {
+	root, err := Root()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(root, "workspaces"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && Check(entry.Name()) == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
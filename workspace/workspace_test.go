@@ -0,0 +1,55 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	t.Setenv(EnvVar, "")
+	if dir, err := Dir(); err != nil || dir != filepath.Join(home, ".shell-ai") {
+		t.Errorf("Dir() = %q, %v; want the main directory", dir, err)
+	}
+
+	t.Setenv(EnvVar, " clientA ")
+	if dir, err := Dir(); err != nil || dir != filepath.Join(home, ".shell-ai", "workspaces", "clientA") {
+		t.Errorf("Dir() = %q, %v; want clientA's directory", dir, err)
+	}
+
+	// Names can't reach outside the workspaces directory
+	for _, name := range []string{"../logs", "a/b", ".hidden", "-x"} {
+		t.Setenv(EnvVar, name)
+		if dir, err := Dir(); err == nil {
+			t.Errorf("Dir() with %q = %q, want an error", name, dir)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	if names, err := List(); err != nil || len(names) != 0 {
+		t.Fatalf("List() = %v, %v; want none before any is used", names, err)
+	}
+	for _, name := range []string{"personal", "clientA", "exp.1"} {
+		if err := os.MkdirAll(filepath.Join(home, ".shell-ai", "workspaces", name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(home, ".shell-ai", "workspaces", "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	names, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"clientA", "exp.1", "personal"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List() = %v, want %v", names, want)
+	}
+}